@@ -0,0 +1,113 @@
+// Package alerts collects conditions that need an administrator's attention,
+// such as a scanner whose driver suddenly advertises different options.
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"DICOMScanStation/logging"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// maxAlerts bounds memory use; the oldest acknowledged alerts go first
+const maxAlerts = 200
+
+var ErrNotFound = errors.New("alert not found")
+
+// Alert is a single administrator notification
+type Alert struct {
+	ID           string      `json:"id"`
+	Severity     string      `json:"severity"`
+	Source       string      `json:"source"`
+	Message      string      `json:"message"`
+	Details      interface{} `json:"details,omitempty"`
+	CreatedAt    time.Time   `json:"createdAt"`
+	Acknowledged bool        `json:"acknowledged"`
+}
+
+// Store keeps alerts in memory until they are acknowledged
+type Store struct {
+	mu     sync.Mutex
+	alerts []*Alert
+	seq    int
+	logger *logrus.Logger
+}
+
+func NewStore() *Store {
+	return &Store{logger: logging.New()}
+}
+
+// Raise records a new alert and logs it
+func (s *Store) Raise(severity, source, message string, details interface{}) *Alert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	alert := &Alert{
+		ID:        fmt.Sprintf("A%d-%d", time.Now().Unix(), s.seq),
+		Severity:  severity,
+		Source:    source,
+		Message:   message,
+		Details:   details,
+		CreatedAt: time.Now(),
+	}
+	s.alerts = append(s.alerts, alert)
+	s.trim()
+
+	s.logger.WithFields(logrus.Fields{"source": source, "severity": severity}).Warnf("Admin alert: %s", message)
+	return alert
+}
+
+// List returns alerts newest first; acknowledged ones only if requested
+func (s *Store) List(includeAcknowledged bool) []Alert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]Alert, 0, len(s.alerts))
+	for _, a := range s.alerts {
+		if a.Acknowledged && !includeAcknowledged {
+			continue
+		}
+		result = append(result, *a)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
+
+// Acknowledge marks an alert as handled
+func (s *Store) Acknowledge(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.alerts {
+		if a.ID == id {
+			a.Acknowledged = true
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *Store) trim() {
+	for len(s.alerts) > maxAlerts {
+		idx := 0
+		for i, a := range s.alerts {
+			if a.Acknowledged {
+				idx = i
+				break
+			}
+		}
+		s.alerts = append(s.alerts[:idx], s.alerts[idx+1:]...)
+	}
+}
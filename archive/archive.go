@@ -0,0 +1,353 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"DICOMScanStation/config"
+	"DICOMScanStation/logging"
+
+	"github.com/sirupsen/logrus"
+)
+
+const metadataFile = "study.json"
+
+var ErrNotFound = errors.New("archived study not found")
+
+// Instance is one archived DICOM file
+type Instance struct {
+	Filename       string `json:"filename"`
+	SOPInstanceUID string `json:"sopInstanceUid"`
+	Size           int64  `json:"size"`
+	// StoredSize is the size on disk; it is smaller than Size for
+	// compressed instances and 0 for instances archived uncompressed
+	StoredSize int64 `json:"storedSize,omitempty"`
+	Compressed bool  `json:"compressed,omitempty"`
+}
+
+// storedName returns the name of the instance file on disk
+func (i Instance) storedName() string {
+	if i.Compressed {
+		return i.Filename + compressedSuffix
+	}
+	return i.Filename
+}
+
+// storedSize returns the size of the instance file on disk
+func (i Instance) storedSize() int64 {
+	if i.StoredSize > 0 {
+		return i.StoredSize
+	}
+	return i.Size
+}
+
+// Study is the metadata kept next to the archived files of a sent study
+type Study struct {
+	StudyInstanceUID string     `json:"studyInstanceUid"`
+	StudyID          string     `json:"studyId"`
+	PatientID        string     `json:"patientId"`
+	PatientName      string     `json:"patientName"`
+	PatientBirthDate string     `json:"patientBirthDate"`
+	DocumentCreator  string     `json:"documentCreator"`
+	Description      string     `json:"description"`
+	DocumentType     string     `json:"documentType,omitempty"`
+	Text             string     `json:"text,omitempty"`
+	ArchivedAt       time.Time  `json:"archivedAt"`
+	ExpiresAt        time.Time  `json:"expiresAt"`
+	Instances        []Instance `json:"instances"`
+}
+
+// Store keeps copies of sent studies for a configurable number of days
+type Store struct {
+	config *config.Config
+	logger *logrus.Logger
+	dir    string
+	mu     sync.Mutex
+}
+
+func NewStore(cfg *config.Config) (*Store, error) {
+	if !ValidCompression(cfg.ArchiveCompression) {
+		return nil, fmt.Errorf("unknown archive compression '%s' (use zstd or none)", cfg.ArchiveCompression)
+	}
+	if err := os.MkdirAll(cfg.ArchiveDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %v", err)
+	}
+	return &Store{
+		config: cfg,
+		logger: logging.New(),
+		dir:    cfg.ArchiveDir,
+	}, nil
+}
+
+// AddInstance copies a sent DICOM file into the archive and records it in
+// the study metadata
+func (s *Store) AddInstance(study Study, srcPath string, sopInstanceUID string) error {
+	if err := validateUID(study.StudyInstanceUID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	studyDir := filepath.Join(s.dir, study.StudyInstanceUID)
+	if err := os.MkdirAll(studyDir, 0755); err != nil {
+		return fmt.Errorf("failed to create study directory: %v", err)
+	}
+
+	existing, err := s.readStudy(study.StudyInstanceUID)
+	if err == nil {
+		study.Instances = existing.Instances
+		study.ArchivedAt = existing.ArchivedAt
+	} else {
+		study.Instances = nil
+		study.ArchivedAt = time.Now()
+	}
+	study.ExpiresAt = study.ArchivedAt.AddDate(0, 0, s.config.ArchiveRetentionDays)
+
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to archive %s: %v", srcPath, err)
+	}
+	instance := Instance{
+		Filename:       filepath.Base(srcPath),
+		SOPInstanceUID: sopInstanceUID,
+		Size:           info.Size(),
+		Compressed:     s.config.ArchiveCompression == CompressionZstd,
+	}
+
+	dst := filepath.Join(studyDir, instance.storedName())
+	if instance.Compressed {
+		instance.StoredSize, err = compressFile(srcPath, dst)
+	} else {
+		_, err = copyFile(srcPath, dst)
+	}
+	if err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("failed to archive %s: %v", instance.Filename, err)
+	}
+
+	study.Instances = append(study.Instances, instance)
+
+	if err := s.writeStudy(study); err != nil {
+		return err
+	}
+
+	s.logger.Debugf("Archive: Stored %s for study %s", instance.Filename, study.StudyInstanceUID)
+	return nil
+}
+
+// List returns all archived studies, newest first
+func (s *Store) List() ([]Study, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var studies []Study
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		study, err := s.readStudy(entry.Name())
+		if err != nil {
+			s.logger.Warnf("Archive: Skipping %s: %v", entry.Name(), err)
+			continue
+		}
+		studies = append(studies, *study)
+	}
+
+	sort.Slice(studies, func(i, j int) bool { return studies[i].ArchivedAt.After(studies[j].ArchivedAt) })
+	return studies, nil
+}
+
+// Get returns the metadata of one archived study
+func (s *Store) Get(studyInstanceUID string) (*Study, error) {
+	if err := validateUID(studyInstanceUID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readStudy(studyInstanceUID)
+}
+
+// Open returns the content of an archived instance, decompressed if it is
+// stored compressed
+func (s *Store) Open(studyInstanceUID string, filename string) (io.ReadCloser, *Instance, error) {
+	study, err := s.Get(studyInstanceUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, instance := range study.Instances {
+		if instance.Filename != filename {
+			continue
+		}
+		rc, err := openFile(filepath.Join(s.dir, studyInstanceUID, instance.storedName()))
+		if err != nil {
+			return nil, nil, err
+		}
+		return rc, &instance, nil
+	}
+	return nil, nil, ErrNotFound
+}
+
+// ReadInstance returns the decompressed content of an archived instance
+func (s *Store) ReadInstance(studyInstanceUID string, filename string) ([]byte, error) {
+	rc, _, err := s.Open(studyInstanceUID, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// Stats summarizes the disk space used by the archive
+type Stats struct {
+	Studies     int   `json:"studies"`
+	Instances   int   `json:"instances"`
+	Compressed  int   `json:"compressed"`
+	Bytes       int64 `json:"bytes"`
+	StoredBytes int64 `json:"storedBytes"`
+	SavedBytes  int64 `json:"savedBytes"`
+	// SavedPercent is the share of the original size saved by compression
+	SavedPercent float64 `json:"savedPercent"`
+}
+
+// Stats returns the sizes of all archived instances before and after
+// compression
+func (s *Store) Stats() (Stats, error) {
+	studies, err := s.List()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	var stats Stats
+	for _, study := range studies {
+		stats.Studies++
+		for _, instance := range study.Instances {
+			stats.Instances++
+			if instance.Compressed {
+				stats.Compressed++
+			}
+			stats.Bytes += instance.Size
+			stats.StoredBytes += instance.storedSize()
+		}
+	}
+	stats.SavedBytes = stats.Bytes - stats.StoredBytes
+	if stats.Bytes > 0 {
+		stats.SavedPercent = math.Round(float64(stats.SavedBytes)/float64(stats.Bytes)*1000) / 10
+	}
+	return stats, nil
+}
+
+// Purge removes studies whose retention period has expired
+func (s *Store) Purge() (int, error) {
+	studies, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	now := time.Now()
+	for _, study := range studies {
+		if now.Before(study.ExpiresAt) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.dir, study.StudyInstanceUID)); err != nil {
+			s.logger.Warnf("Archive: Failed to purge study %s: %v", study.StudyInstanceUID, err)
+			continue
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		s.logger.Infof("Archive: Purged %d expired studies", removed)
+	}
+	return removed, nil
+}
+
+// StartJanitor purges expired studies periodically until ctx is cancelled
+func (s *Store) StartJanitor(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Purge(); err != nil {
+			s.logger.Warnf("Archive: Purge failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Store) readStudy(studyInstanceUID string) (*Study, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, studyInstanceUID, metadataFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var study Study
+	if err := json.Unmarshal(data, &study); err != nil {
+		return nil, fmt.Errorf("invalid study metadata: %v", err)
+	}
+	return &study, nil
+}
+
+func (s *Store) writeStudy(study Study) error {
+	data, err := json.MarshalIndent(study, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.dir, study.StudyInstanceUID, metadataFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write study metadata: %v", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func copyFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	return io.Copy(out, in)
+}
+
+func validateUID(uid string) error {
+	if uid == "" || strings.Trim(uid, "0123456789.") != "" || strings.Contains(uid, "..") {
+		return fmt.Errorf("invalid study instance UID '%s'", uid)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressedSuffix marks archived files stored with zstd
+const compressedSuffix = ".zst"
+
+// Compression methods for ARCHIVE_COMPRESSION
+const (
+	CompressionNone = "none"
+	CompressionZstd = "zstd"
+)
+
+// ValidCompression reports whether method is a known compression method
+func ValidCompression(method string) bool {
+	return method == CompressionNone || method == CompressionZstd
+}
+
+// compressFile writes src zstd compressed to dst and returns the size of
+// the compressed file
+func compressFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	enc, err := zstd.NewWriter(out)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(enc, in); err != nil {
+		enc.Close()
+		return 0, err
+	}
+	if err := enc.Close(); err != nil {
+		return 0, err
+	}
+
+	info, err := out.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// zstdReader closes the decoder together with the file
+type zstdReader struct {
+	*zstd.Decoder
+	file *os.File
+}
+
+func (r *zstdReader) Close() error {
+	r.Decoder.Close()
+	return r.file.Close()
+}
+
+// openFile opens an archived file and decompresses it transparently
+func openFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, compressedSuffix) {
+		return f, nil
+	}
+
+	dec, err := zstd.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to decompress %s: %v", path, err)
+	}
+	return &zstdReader{Decoder: dec, file: f}, nil
+}
@@ -0,0 +1,58 @@
+package archive
+
+import (
+	"strings"
+	"time"
+)
+
+// Query filters archived studies. Empty fields match everything.
+type Query struct {
+	// Patient matches the patient ID exactly or a part of the patient name
+	Patient      string
+	DocumentType string
+	// Text matches the description or recognized document text
+	Text string
+	From time.Time
+	To   time.Time
+}
+
+// Search returns the archived studies matching q, newest first
+func (s *Store) Search(q Query) ([]Study, error) {
+	studies, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Study
+	for _, study := range studies {
+		if q.matches(study) {
+			result = append(result, study)
+		}
+	}
+	return result, nil
+}
+
+func (q Query) matches(study Study) bool {
+	if q.Patient != "" {
+		patient := strings.ToLower(q.Patient)
+		if !strings.EqualFold(study.PatientID, q.Patient) && !strings.Contains(strings.ToLower(study.PatientName), patient) {
+			return false
+		}
+	}
+	if q.DocumentType != "" && !strings.EqualFold(study.DocumentType, q.DocumentType) {
+		return false
+	}
+	if q.Text != "" {
+		text := strings.ToLower(q.Text)
+		if !strings.Contains(strings.ToLower(study.Description), text) && !strings.Contains(strings.ToLower(study.Text), text) {
+			return false
+		}
+	}
+	if !q.From.IsZero() && study.ArchivedAt.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !study.ArchivedAt.Before(q.To) {
+		return false
+	}
+	return true
+}
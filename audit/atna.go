@@ -0,0 +1,220 @@
+package audit
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"net"
+	"time"
+)
+
+// DICOM audit messages (PS3.15 A.5) as collected by IHE ATNA audit
+// repositories
+
+// code is a coded value of an audit message
+type code struct {
+	Code         string `xml:"csd-code,attr"`
+	System       string `xml:"codeSystemName,attr"`
+	OriginalText string `xml:"originalText,attr"`
+}
+
+func dcm(value string, text string) code {
+	return code{Code: value, System: "DCM", OriginalText: text}
+}
+
+func rfc3881(value string, text string) code {
+	return code{Code: value, System: "RFC-3881", OriginalText: text}
+}
+
+type auditMessage struct {
+	XMLName      xml.Name            `xml:"AuditMessage"`
+	Event        eventIdentification `xml:"EventIdentification"`
+	Participants []activeParticipant `xml:"ActiveParticipant"`
+	Source       auditSource         `xml:"AuditSourceIdentification"`
+	Objects      []participantObject `xml:"ParticipantObjectIdentification"`
+}
+
+type eventIdentification struct {
+	ActionCode string `xml:"EventActionCode,attr"`
+	DateTime   string `xml:"EventDateTime,attr"`
+	Outcome    string `xml:"EventOutcomeIndicator,attr"`
+	EventID    code   `xml:"EventID"`
+	TypeCode   *code  `xml:"EventTypeCode,omitempty"`
+}
+
+type activeParticipant struct {
+	UserID              string `xml:"UserID,attr"`
+	UserIsRequestor     bool   `xml:"UserIsRequestor,attr"`
+	NetworkAccessPoint  string `xml:"NetworkAccessPointID,attr,omitempty"`
+	NetworkAccessPointT string `xml:"NetworkAccessPointTypeCode,attr,omitempty"`
+	Role                *code  `xml:"RoleIDCode,omitempty"`
+}
+
+type auditSource struct {
+	ID       string `xml:"AuditSourceID,attr"`
+	TypeCode code   `xml:"AuditSourceTypeCode"`
+}
+
+type participantObject struct {
+	ID       string         `xml:"ParticipantObjectID,attr"`
+	TypeCode string         `xml:"ParticipantObjectTypeCode,attr"`
+	Role     string         `xml:"ParticipantObjectTypeCodeRole,attr"`
+	IDType   code           `xml:"ParticipantObjectIDTypeCode"`
+	Query    string         `xml:"ParticipantObjectQuery,omitempty"`
+	Details  []objectDetail `xml:"ParticipantObjectDetail,omitempty"`
+}
+
+type objectDetail struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// atnaEvent is how an action is reported in an audit message
+type atnaEvent struct {
+	id         code
+	actionCode string
+	typeCode   *code
+}
+
+var (
+	typeLogin  = dcm("110122", "Login")
+	typeLogout = dcm("110123", "Logout")
+	// typeSecurityAttributes covers lockouts and API keys
+	typeSecurityAttributes = dcm("110137", "User Security Attributes Changed")
+	typeConfiguration      = dcm("110131", "Software Configuration")
+)
+
+var atnaEvents = map[string]atnaEvent{
+	ActionLogin:          {dcm("110114", "User Authentication"), "E", &typeLogin},
+	ActionLogout:         {dcm("110114", "User Authentication"), "E", &typeLogout},
+	ActionAuthFailure:    {dcm("110114", "User Authentication"), "E", &typeLogin},
+	ActionLockout:        {dcm("110113", "Security Alert"), "E", &typeSecurityAttributes},
+	ActionUnlock:         {dcm("110113", "Security Alert"), "E", &typeSecurityAttributes},
+	ActionAPIKeyCreate:   {dcm("110113", "Security Alert"), "C", &typeSecurityAttributes},
+	ActionAPIKeyRevoke:   {dcm("110113", "Security Alert"), "D", &typeSecurityAttributes},
+	ActionConfigChange:   {dcm("110113", "Security Alert"), "U", &typeConfiguration},
+	ActionSupportBundle:  {dcm("110106", "Export"), "R", nil},
+	ActionRedact:         {dcm("110103", "DICOM Instances Accessed"), "U", nil},
+	ActionPatientSearch:  {dcm("110112", "Query"), "E", nil},
+	ActionStudyQuery:     {dcm("110112", "Query"), "E", nil},
+	ActionDocumentSearch: {dcm("110112", "Query"), "E", nil},
+	ActionSend:           {dcm("110104", "DICOM Instances Transferred"), "R", nil},
+	ActionExport:         {dcm("110106", "Export"), "R", nil},
+	ActionDelete:         {dcm("110103", "DICOM Instances Accessed"), "D", nil},
+}
+
+// queryObjectTypes are the queries of the search actions
+var queryObjectTypes = map[string]code{
+	ActionPatientSearch:  dcm("1.2.840.10008.5.1.4.1.2.1.1", "Patient Root Query/Retrieve Information Model - FIND"),
+	ActionStudyQuery:     dcm("1.2.840.10008.5.1.4.1.2.2.1", "Study Root Query/Retrieve Information Model - FIND"),
+	ActionDocumentSearch: {Code: "document-search", System: "DICOMScanStation", OriginalText: "Archive Document Search"},
+}
+
+// atnaMessage returns the DICOM audit message of an event. station is the
+// AE title of the station and host its address, sourceID identifies the
+// station to the audit repository.
+func atnaMessage(event Event, sourceID string, station string, host string) ([]byte, error) {
+	kind, ok := atnaEvents[event.Action]
+	if !ok {
+		kind = atnaEvent{id: dcm("110100", "Application Activity"), actionCode: "E"}
+	}
+	outcome := "0"
+	if event.Action == ActionAuthFailure {
+		outcome = "4"
+	} else if event.Details[DetailError] != "" {
+		outcome = "8"
+	}
+
+	user := event.User
+	if user == "" {
+		user = "unknown"
+	}
+	msg := auditMessage{
+		Event: eventIdentification{
+			ActionCode: kind.actionCode,
+			DateTime:   event.Time.UTC().Format(time.RFC3339Nano),
+			Outcome:    outcome,
+			EventID:    kind.id,
+			TypeCode:   kind.typeCode,
+		},
+		Participants: []activeParticipant{{
+			UserID:              user,
+			UserIsRequestor:     true,
+			NetworkAccessPoint:  event.Client,
+			NetworkAccessPointT: networkAccessPointType(event.Client),
+		}},
+		Source: auditSource{ID: sourceID, TypeCode: dcm("4", "Application Server Process")},
+	}
+
+	// The station acts for the user, and is the source of transfers
+	stationParticipant := activeParticipant{
+		UserID:              station,
+		NetworkAccessPoint:  host,
+		NetworkAccessPointT: networkAccessPointType(host),
+	}
+	destination := event.Details[DetailDestination]
+	if destination != "" {
+		source := dcm("110153", "Source Role ID")
+		stationParticipant.Role = &source
+	}
+	msg.Participants = append(msg.Participants, stationParticipant)
+	if destination != "" {
+		role := dcm("110152", "Destination Role ID")
+		msg.Participants = append(msg.Participants, activeParticipant{UserID: destination, Role: &role})
+	}
+
+	if patientID := event.Details[DetailPatientID]; patientID != "" {
+		msg.Objects = append(msg.Objects, participantObject{
+			ID:       patientID,
+			TypeCode: "1",
+			Role:     "1",
+			IDType:   rfc3881("2", "Patient Number"),
+		})
+	}
+	if studyUID := event.Details[DetailStudyUID]; studyUID != "" {
+		msg.Objects = append(msg.Objects, participantObject{
+			ID:       studyUID,
+			TypeCode: "2",
+			Role:     "3",
+			IDType:   dcm("110180", "Study Instance UID"),
+		})
+	}
+	if queryType, ok := queryObjectTypes[event.Action]; ok {
+		msg.Objects = append(msg.Objects, participantObject{
+			ID:       queryType.Code,
+			TypeCode: "2",
+			Role:     "24",
+			IDType:   queryType,
+			Query:    base64.StdEncoding.EncodeToString([]byte(event.Details[DetailQuery])),
+		})
+	}
+	// Files, pending documents and API keys the action was about
+	if len(msg.Objects) == 0 && event.Target != "" && event.Target != event.Client {
+		msg.Objects = append(msg.Objects, participantObject{
+			ID:       event.Target,
+			TypeCode: "2",
+			Role:     "4",
+			IDType:   rfc3881("12", "URI"),
+		})
+	}
+	// The files go with the study, or the patient of a new study
+	if files := event.Details[DetailFiles]; files != "" && len(msg.Objects) > 0 {
+		object := &msg.Objects[len(msg.Objects)-1]
+		if object.Role == "1" || object.Role == "3" || object.Role == "4" {
+			object.Details = append(object.Details, objectDetail{Type: "Files", Value: base64.StdEncoding.EncodeToString([]byte(files))})
+		}
+	}
+
+	return xml.Marshal(msg)
+}
+
+// networkAccessPointType is 2 for IP addresses and 1 for machine names
+func networkAccessPointType(address string) string {
+	switch {
+	case address == "":
+		return ""
+	case net.ParseIP(address) != nil:
+		return "2"
+	default:
+		return "1"
+	}
+}
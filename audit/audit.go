@@ -0,0 +1,115 @@
+// Package audit records security relevant actions of operators and every
+// access to patient data in an append-only log, and optionally forwards
+// them as DICOM audit messages to an ATNA syslog collector.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"DICOMScanStation/config"
+)
+
+const auditFile = "audit.jsonl"
+
+// Actions
+const (
+	ActionRedact        = "redact"
+	ActionAuthFailure   = "auth_failure"
+	ActionLogin         = "login"
+	ActionLogout        = "logout"
+	ActionLockout       = "lockout"
+	ActionUnlock        = "unlock"
+	ActionSupportBundle = "support_bundle"
+	ActionAPIKeyCreate  = "api_key_create"
+	ActionAPIKeyRevoke  = "api_key_revoke"
+	ActionConfigChange  = "config_change"
+	// Access to patient data
+	ActionPatientSearch  = "patient_search"
+	ActionStudyQuery     = "study_query"
+	ActionDocumentSearch = "document_search"
+	ActionSend           = "send"
+	ActionExport         = "export"
+	ActionDelete         = "delete"
+)
+
+// Details of patient data events, also used for the DICOM audit messages
+const (
+	DetailPatientID   = "patientId"
+	DetailStudyUID    = "studyUid"
+	DetailQuery       = "query"
+	DetailDestination = "destination"
+	DetailFiles       = "files"
+	// DetailError is set when the action failed
+	DetailError = "error"
+)
+
+// Event is one entry of the audit trail
+type Event struct {
+	Time    time.Time         `json:"time"`
+	User    string            `json:"user"`
+	Action  string            `json:"action"`
+	Target  string            `json:"target"`
+	Details map[string]string `json:"details,omitempty"`
+	// Client is the address of the user's computer
+	Client string `json:"client,omitempty"`
+}
+
+// Log appends events to a JSON lines file in the state directory
+type Log struct {
+	path    string
+	mu      sync.Mutex
+	forward *Syslog
+}
+
+func NewLog(cfg *config.Config) (*Log, error) {
+	if err := os.MkdirAll(cfg.StateDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %v", err)
+	}
+	return &Log{path: filepath.Join(cfg.StateDir, auditFile)}, nil
+}
+
+// ForwardTo sends every event recorded from now on to a syslog collector
+// as well
+func (l *Log) ForwardTo(s *Syslog) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.forward = s
+}
+
+// Record appends an event. The file is synced so that an event is not lost
+// when the station loses power right after the action. Forwarding to the
+// collector does not hold the action up.
+func (l *Log) Record(event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if l.forward != nil {
+		l.forward.Send(event)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package audit
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"DICOMScanStation/config"
+	"DICOMScanStation/logging"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// syslogPriority is facility authpriv (10) with severity notice (5)
+	syslogPriority = 10*8 + 5
+	syslogAppName  = "DICOMScanStation"
+	// syslogMsgID marks DICOM audit messages, see PS3.15 A.5
+	syslogMsgID = "DICOM+RFC3881"
+	// syslogQueueSize events wait while the collector is unreachable
+	syslogQueueSize = 1000
+	syslogRetry     = 5 * time.Second
+	syslogTimeout   = 10 * time.Second
+)
+
+// Syslog forwards audit events as DICOM audit messages to the ATNA syslog
+// collector of AUDIT_SYSLOG, e.g. "udp://collector:514" or
+// "tls://collector:6514". Messages follow RFC 5424; over TCP and TLS they
+// are framed by octet counting as in RFC 5425.
+type Syslog struct {
+	network   string
+	addr      string
+	tlsConfig *tls.Config
+	sourceID  string
+	station   string
+	host      string
+	queue     chan Event
+	conn      net.Conn
+	logger    *logrus.Logger
+}
+
+// NewSyslog returns the forwarder to the collector, nil without
+// AUDIT_SYSLOG. Over TLS the station presents the certificate of clientTLS
+// if given, the DICOM TLS settings of the station.
+func NewSyslog(cfg *config.Config, clientTLS *tls.Config) (*Syslog, error) {
+	target := strings.TrimSpace(cfg.AuditSyslog)
+	if target == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid AUDIT_SYSLOG '%s' (use udp://, tcp:// or tls://host:port)", target)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("AUDIT_SYSLOG '%s' has no port", target)
+	}
+
+	host, _ := os.Hostname()
+	s := &Syslog{
+		addr:     u.Host,
+		sourceID: strings.TrimSpace(cfg.AuditSourceID),
+		station:  cfg.DicomLocalAETitle,
+		host:     host,
+		queue:    make(chan Event, syslogQueueSize),
+		logger:   logging.New(),
+	}
+	if s.sourceID == "" {
+		s.sourceID = host
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		s.network = u.Scheme
+	case "tls":
+		s.network = "tcp"
+		if clientTLS != nil {
+			s.tlsConfig = clientTLS.Clone()
+		} else {
+			s.tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		// DICOM_TLS_SERVER_NAME names the PACS, not the collector
+		s.tlsConfig.ServerName = u.Hostname()
+	default:
+		return nil, fmt.Errorf("unknown AUDIT_SYSLOG transport '%s' (use udp, tcp or tls)", u.Scheme)
+	}
+	return s, nil
+}
+
+// Send queues an event for the collector. When the collector has been
+// unreachable for long, events are dropped; they remain in the local audit
+// trail.
+func (s *Syslog) Send(event Event) {
+	select {
+	case s.queue <- event:
+	default:
+		s.logger.Warnf("Audit syslog: Queue full, %s of %s not forwarded", event.Action, event.Target)
+	}
+}
+
+// Run delivers queued events until ctx is cancelled
+func (s *Syslog) Run(ctx context.Context) {
+	defer s.close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.queue:
+			for {
+				err := s.deliver(event)
+				if err == nil {
+					break
+				}
+				s.logger.Warnf("Audit syslog: Failed to reach %s: %v", s.addr, err)
+				s.close()
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(syslogRetry):
+				}
+			}
+		}
+	}
+}
+
+func (s *Syslog) deliver(event Event) error {
+	message, err := atnaMessage(event, s.sourceID, s.station, s.host)
+	if err != nil {
+		// Nothing a retry would change
+		s.logger.Errorf("Audit syslog: Failed to encode %s: %v", event.Action, err)
+		return nil
+	}
+	line := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		syslogPriority, event.Time.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		nilValue(s.host), syslogAppName, os.Getpid(), syslogMsgID, message)
+	if s.network == "tcp" {
+		line = fmt.Sprintf("%d %s", len(line), line)
+	}
+
+	if s.conn == nil {
+		dialer := &net.Dialer{Timeout: syslogTimeout}
+		if s.tlsConfig != nil {
+			s.conn, err = tls.DialWithDialer(dialer, s.network, s.addr, s.tlsConfig)
+		} else {
+			s.conn, err = dialer.Dial(s.network, s.addr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	_, err = s.conn.Write([]byte(line))
+	return err
+}
+
+func (s *Syslog) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// nilValue is the value of an empty syslog header field
+func nilValue(field string) string {
+	if field == "" {
+		return "-"
+	}
+	return field
+}
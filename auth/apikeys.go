@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"DICOMScanStation/config"
+)
+
+const apiKeysFile = "api-keys.json"
+
+// apiKeyPrefix marks the keys of the station, so a leaked key is easy to
+// recognize in logs and secret scanners
+const apiKeyPrefix = "dss_"
+
+// Scopes of API keys: each allows a group of API endpoints
+const (
+	ScopeScan    = "scan"
+	ScopeFiles   = "files"
+	ScopeDicom   = "dicom"
+	ScopeArchive = "archive"
+	ScopePending = "pending"
+	// ScopeAdmin allows the administration under /api/admin
+	ScopeAdmin = "admin"
+)
+
+// Scopes are all scopes a key can be given
+var Scopes = []string{ScopeScan, ScopeFiles, ScopeDicom, ScopeArchive, ScopePending, ScopeAdmin}
+
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// APIKey is a credential of a programmatic client. Only the SHA-256 hash
+// of the key is kept; the key itself is shown once when it is created.
+type APIKey struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Prefix is the start of the key, to tell keys apart
+	Prefix    string    `json:"prefix"`
+	Hash      string    `json:"hash,omitempty"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// APIKeys keeps the API keys in one JSON file in STATE_DIR
+type APIKeys struct {
+	path string
+	mu   sync.Mutex
+	keys map[string]APIKey
+}
+
+func NewAPIKeys(cfg *config.Config) (*APIKeys, error) {
+	s := &APIKeys{
+		path: filepath.Join(cfg.StateDir, apiKeysFile),
+		keys: make(map[string]APIKey),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err == nil {
+		if err := json.Unmarshal(data, &s.keys); err != nil {
+			return nil, fmt.Errorf("invalid API keys file: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return s, nil
+}
+
+// List returns the keys sorted by name
+func (s *APIKeys) List() []APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name)
+	})
+	return list
+}
+
+// Create adds a key with scopes for a client named name and returns it
+// with the secret key
+func (s *APIKeys) Create(name string, scopes []string, createdBy string) (APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return APIKey{}, "", fmt.Errorf("name is required")
+	}
+	if len(scopes) == 0 {
+		return APIKey{}, "", fmt.Errorf("at least one scope is required (available: %s)", strings.Join(Scopes, ", "))
+	}
+	for _, scope := range scopes {
+		if !contains(Scopes, scope) {
+			return APIKey{}, "", fmt.Errorf("unknown scope '%s' (available: %s)", scope, strings.Join(Scopes, ", "))
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return APIKey{}, "", err
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	key := apiKeyPrefix + hex.EncodeToString(secret)
+	apiKey := APIKey{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Scopes:    scopes,
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		Hash:      hashAPIKey(key),
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[apiKey.ID] = apiKey
+	if err := s.save(); err != nil {
+		delete(s.keys, apiKey.ID)
+		return APIKey{}, "", err
+	}
+	return apiKey, key, nil
+}
+
+// Revoke deletes a key, which stops working at once
+func (s *APIKeys) Revoke(id string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	apiKey, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	delete(s.keys, id)
+	return apiKey, s.save()
+}
+
+// Lookup returns the API key of a key a client presented
+func (s *APIKeys) Lookup(key string) (APIKey, bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return APIKey{}, false
+	}
+	hash := hashAPIKey(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, apiKey := range s.keys {
+		if apiKey.Hash == hash {
+			return apiKey, true
+		}
+	}
+	return APIKey{}, false
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *APIKeys) save() error {
+	data, err := json.MarshalIndent(s.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	// Hashes only, but still nothing for other users of the machine
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write API keys: %v", err)
+	}
+	return os.Rename(tmp, s.path)
+}
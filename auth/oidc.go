@@ -0,0 +1,456 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"DICOMScanStation/config"
+)
+
+// oidcStateTTL is how long a browser may take at the identity provider
+const oidcStateTTL = 10 * time.Minute
+
+// oidcTimeout limits each request to the identity provider
+const oidcTimeout = 10 * time.Second
+
+var ErrInvalidState = errors.New("login attempt is unknown or expired")
+
+// OIDC signs users in with an OpenID Connect identity provider such as
+// Keycloak, with the authorization code flow and PKCE. The provider is
+// discovered from the issuer on first use, so the station starts while it
+// is unreachable.
+type OIDC struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	userClaim    string
+	http         *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]crypto.PublicKey
+	pending   map[string]oidcAttempt
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// oidcAttempt is a login waiting for the browser to return from the
+// identity provider
+type oidcAttempt struct {
+	nonce    string
+	verifier string
+	expires  time.Time
+}
+
+// NewOIDC configures the login with OIDC_ISSUER; without it nil is
+// returned. The settings are checked by Config.Validate.
+func NewOIDC(cfg *config.Config) *OIDC {
+	issuer := strings.TrimRight(strings.TrimSpace(cfg.OIDCIssuer), "/")
+	if issuer == "" {
+		return nil
+	}
+	scopes := cfg.OIDCScopes
+	if !contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+	claim := cfg.OIDCUserClaim
+	if claim == "" {
+		claim = "preferred_username"
+	}
+	return &OIDC{
+		issuer:       issuer,
+		clientID:     cfg.OIDCClientID,
+		clientSecret: cfg.OIDCClientSecret,
+		redirectURL:  cfg.OIDCRedirectURL,
+		scopes:       scopes,
+		userClaim:    claim,
+		http:         &http.Client{Timeout: oidcTimeout},
+		pending:      make(map[string]oidcAttempt),
+	}
+}
+
+// AuthURL starts a login and returns where to send the browser; state
+// comes back with it to Exchange
+func (o *OIDC) AuthURL(ctx context.Context) (string, error) {
+	discovery, err := o.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	state, nonce, verifier := randomToken(), randomToken(), randomToken()
+	challenge := sha256.Sum256([]byte(verifier))
+
+	o.mu.Lock()
+	now := time.Now()
+	for key, attempt := range o.pending {
+		if now.After(attempt.expires) {
+			delete(o.pending, key)
+		}
+	}
+	o.pending[state] = oidcAttempt{nonce: nonce, verifier: verifier, expires: now.Add(oidcStateTTL)}
+	o.mu.Unlock()
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.clientID},
+		"redirect_uri":          {o.redirectURL},
+		"scope":                 {strings.Join(o.scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	return addQuery(discovery.AuthorizationEndpoint, query), nil
+}
+
+// Exchange redeems the code the browser brought back and returns the user
+// and the ID token, which LogoutURL needs
+func (o *OIDC) Exchange(ctx context.Context, state string, code string) (string, string, error) {
+	o.mu.Lock()
+	attempt, ok := o.pending[state]
+	delete(o.pending, state)
+	o.mu.Unlock()
+	if !ok || time.Now().After(attempt.expires) {
+		return "", "", ErrInvalidState
+	}
+
+	discovery, err := o.discover(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.redirectURL},
+		"code_verifier": {attempt.verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(o.clientID), url.QueryEscape(o.clientSecret))
+	resp, err := o.http.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("identity provider unreachable: %v", err)
+	}
+	defer resp.Body.Close()
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", "", fmt.Errorf("invalid token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return "", "", fmt.Errorf("token request failed: %s %s", token.Error, token.ErrorDescription)
+	}
+
+	claims, err := o.verify(ctx, token.IDToken)
+	if err != nil {
+		return "", "", err
+	}
+	if nonce, _ := claims["nonce"].(string); nonce != attempt.nonce {
+		return "", "", fmt.Errorf("ID token has the wrong nonce")
+	}
+	user, _ := claims[o.userClaim].(string)
+	if user == "" {
+		user, _ = claims["sub"].(string)
+	}
+	if user == "" {
+		return "", "", fmt.Errorf("ID token names no user")
+	}
+	return user, token.IDToken, nil
+}
+
+// LogoutURL returns where to send the browser to end the session at the
+// identity provider too, empty if it does not offer that
+func (o *OIDC) LogoutURL(ctx context.Context, idToken string, redirect string) string {
+	discovery, err := o.discover(ctx)
+	if err != nil || discovery.EndSessionEndpoint == "" {
+		return ""
+	}
+	query := url.Values{
+		"client_id":                {o.clientID},
+		"post_logout_redirect_uri": {redirect},
+	}
+	if idToken != "" {
+		query.Set("id_token_hint", idToken)
+	}
+	return addQuery(discovery.EndSessionEndpoint, query)
+}
+
+func (o *OIDC) discover(ctx context.Context) (*oidcDiscovery, error) {
+	o.mu.Lock()
+	discovery := o.discovery
+	o.mu.Unlock()
+	if discovery != nil {
+		return discovery, nil
+	}
+
+	discovery = &oidcDiscovery{}
+	if err := o.getJSON(ctx, o.issuer+"/.well-known/openid-configuration", discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %v", err)
+	}
+	if strings.TrimRight(discovery.Issuer, "/") != o.issuer {
+		return nil, fmt.Errorf("OIDC discovery failed: provider names issuer %s", discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery failed: endpoints missing")
+	}
+	o.mu.Lock()
+	o.discovery = discovery
+	o.mu.Unlock()
+	return discovery, nil
+}
+
+// verify checks the signature, issuer, audience and expiry of an ID token
+// and returns its claims
+func (o *OIDC) verify(ctx context.Context, idToken string) (map[string]interface{}, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed ID token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed ID token header: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ID token signature")
+	}
+	key, err := o.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed ID token claims: %v", err)
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimRight(iss, "/") != o.issuer {
+		return nil, fmt.Errorf("ID token from issuer %s", iss)
+	}
+	if !audienceContains(claims["aud"], o.clientID) {
+		return nil, fmt.Errorf("ID token is not for client %s", o.clientID)
+	}
+	exp, _ := claims["exp"].(float64)
+	if time.Now().After(time.Unix(int64(exp), 0)) {
+		return nil, fmt.Errorf("ID token expired")
+	}
+	return claims, nil
+}
+
+// key returns the signing key of the provider with the ID; the keys are
+// fetched again for an unknown ID, as providers rotate them
+func (o *OIDC) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	key, ok := o.keys[kid]
+	o.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	discovery, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := o.getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch the keys of the identity provider: %v", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if public, err := k.publicKey(); err == nil {
+			keys[k.Kid] = public
+		}
+	}
+	o.mu.Lock()
+	o.keys = keys
+	o.mu.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("ID token signed with unknown key %s", kid)
+}
+
+func (o *OIDC) getJSON(ctx context.Context, target string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := o.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", target, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// jsonWebKey is a key of a JWKS document, RSA or elliptic curve
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("malformed RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+		y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("malformed EC key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// verifySignature checks a JWS signature of the algorithms identity
+// providers sign ID tokens with
+func verifySignature(alg string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported ID token algorithm %s", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			break
+		}
+		if rsa.VerifyPKCS1v15(k, hash, digest, signature) != nil {
+			return fmt.Errorf("invalid ID token signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			break
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("invalid ID token signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("ID token algorithm %s does not match its key", alg)
+}
+
+func decodeSegment(segment string, out interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == clientID
+	case []interface{}:
+		for _, v := range a {
+			if s, _ := v.(string); s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func addQuery(endpoint string, query url.Values) string {
+	separator := "?"
+	if strings.Contains(endpoint, "?") {
+		separator = "&"
+	}
+	return endpoint + separator + query.Encode()
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Session is the login of a user in one browser
+type Session struct {
+	Token string
+	User  string
+	// IDToken is the ID token of a single sign-on, to end the session at
+	// the identity provider as well
+	IDToken   string
+	CreatedAt time.Time
+	LastSeen  time.Time
+}
+
+// Sessions keeps the login sessions in memory, so a restart signs everyone
+// out. A session ends when it was not used for the idle time.
+type Sessions struct {
+	idle     time.Duration
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func NewSessions(idle time.Duration) *Sessions {
+	return &Sessions{idle: idle, sessions: make(map[string]*Session)}
+}
+
+// Create starts a session for a user, signed on with idToken if not empty
+func (s *Sessions) Create(user string, idToken string) (Session, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return Session{}, err
+	}
+	now := time.Now()
+	session := &Session{Token: hex.EncodeToString(b), User: user, IDToken: idToken, CreatedAt: now, LastSeen: now}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purgeExpired(now)
+	s.sessions[session.Token] = session
+	return *session, nil
+}
+
+// Lookup returns the session of a token and keeps it alive
+func (s *Sessions) Lookup(token string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[token]
+	if !ok {
+		return Session{}, false
+	}
+	now := time.Now()
+	if now.Sub(session.LastSeen) >= s.idle {
+		delete(s.sessions, token)
+		return Session{}, false
+	}
+	session.LastSeen = now
+	return *session, true
+}
+
+// Delete ends a session
+func (s *Sessions) Delete(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, token)
+}
+
+func (s *Sessions) purgeExpired(now time.Time) {
+	for token, session := range s.sessions {
+		if now.Sub(session.LastSeen) >= s.idle {
+			delete(s.sessions, token)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Package auth signs operators in to the station with a user name and
+// password or single sign-on, keeps their login sessions and checks the
+// API keys of programmatic clients.
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"DICOMScanStation/config"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Users are the accounts that may sign in, read from the htpasswd file of
+// AUTH_USERS_FILE. Only bcrypt hashes are accepted (htpasswd -B).
+type Users struct {
+	hashes map[string][]byte
+	// dummy is compared against for unknown users, so a wrong user name
+	// takes as long as a wrong password
+	dummy []byte
+}
+
+// LoadUsers reads the accounts; without AUTH_USERS_FILE no login is
+// required and nil is returned
+func LoadUsers(cfg *config.Config) (*Users, error) {
+	file := strings.TrimSpace(cfg.AuthUsersFile)
+	if file == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %v", err)
+	}
+	defer f.Close()
+
+	users := &Users{hashes: make(map[string][]byte)}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, hash, ok := strings.Cut(text, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("users file %s, line %d: expected user:hash", file, line)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("users file %s, line %d: the password of %s is not a bcrypt hash (create it with htpasswd -B)", file, line, name)
+		}
+		if _, exists := users.hashes[name]; exists {
+			return nil, fmt.Errorf("users file %s, line %d: duplicate user %s", file, line, name)
+		}
+		users.hashes[name] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read users file: %v", err)
+	}
+	if len(users.hashes) == 0 {
+		return nil, errors.New("users file " + file + " has no users")
+	}
+	users.dummy, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+	return users, nil
+}
+
+// Verify reports whether the password is the one of the user
+func (u *Users) Verify(name string, password string) bool {
+	hash, ok := u.hashes[name]
+	if !ok {
+		bcrypt.CompareHashAndPassword(u.dummy, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
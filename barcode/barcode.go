@@ -0,0 +1,197 @@
+// Package barcode finds and decodes 1D barcodes on scanned pages. Only
+// Code 39, the symbology most common on hospital forms and separator
+// sheets, is supported.
+package barcode
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// scanLines is the number of rows and columns sampled per page
+const scanLines = 60
+
+// Scan returns the distinct values of all Code 39 barcodes found on the
+// image, horizontally or vertically, in any reading direction
+func Scan(img image.Image) []string {
+	seen := make(map[string]bool)
+	var values []string
+
+	for _, line := range sampleLines(img) {
+		runs := toRuns(line)
+		for _, r := range [][]int{runs, reversed(runs)} {
+			for _, value := range decodeCode39(r) {
+				if !seen[value] {
+					seen[value] = true
+					values = append(values, value)
+				}
+			}
+		}
+	}
+	return values
+}
+
+// sampleLines returns the luminance of evenly spaced rows and columns
+func sampleLines(img image.Image) [][]uint8 {
+	b := img.Bounds()
+	var lines [][]uint8
+	for i := 1; i <= scanLines; i++ {
+		y := b.Min.Y + b.Dy()*i/(scanLines+1)
+		line := make([]uint8, b.Dx())
+		for x := b.Min.X; x < b.Max.X; x++ {
+			line[x-b.Min.X] = luminance(img.At(x, y))
+		}
+		lines = append(lines, line)
+
+		x := b.Min.X + b.Dx()*i/(scanLines+1)
+		column := make([]uint8, b.Dy())
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			column[y-b.Min.Y] = luminance(img.At(x, y))
+		}
+		lines = append(lines, column)
+	}
+	return lines
+}
+
+func luminance(c color.Color) uint8 {
+	return color.GrayModel.Convert(c).(color.Gray).Y
+}
+
+// toRuns binarizes a scan line and returns the run lengths, starting and
+// ending with a dark run
+func toRuns(line []uint8) []int {
+	var runs []int
+	dark := false
+	length := 0
+	for _, v := range line {
+		isDark := v < 128
+		if len(runs) == 0 && length == 0 && !isDark {
+			continue // skip leading light area
+		}
+		if isDark == dark || length == 0 {
+			dark = isDark
+			length++
+			continue
+		}
+		runs = append(runs, length)
+		dark, length = isDark, 1
+	}
+	if length > 0 && dark {
+		runs = append(runs, length)
+	}
+	return runs
+}
+
+func reversed(runs []int) []int {
+	out := make([]int, len(runs))
+	for i, r := range runs {
+		out[len(runs)-1-i] = r
+	}
+	return out
+}
+
+// code39 maps the wide/narrow pattern of 9 elements (bar, space, ...; bit 8
+// is the first element, set for wide) to the character
+var code39 = buildCode39()
+
+func buildCode39() map[uint16]byte {
+	// Bar patterns (5 bars, two wide) shared by the four groups of ten
+	// characters, which differ in the position of the single wide space
+	bars := []string{"10001", "01001", "11000", "00101", "10100", "01100", "00011", "10010", "01010", "00110"}
+	groups := []struct {
+		chars  string
+		spaces string
+	}{
+		{"1234567890", "0100"},
+		{"ABCDEFGHIJ", "0010"},
+		{"KLMNOPQRST", "0001"},
+		{"UVWXYZ-. *", "1000"},
+	}
+
+	table := make(map[uint16]byte)
+	add := func(c byte, bar, space string) {
+		var p uint16
+		for i := 0; i < 9; i++ {
+			var wide byte
+			if i%2 == 0 {
+				wide = bar[i/2]
+			} else {
+				wide = space[i/2]
+			}
+			p <<= 1
+			if wide == '1' {
+				p |= 1
+			}
+		}
+		table[p] = c
+	}
+	for _, g := range groups {
+		for i := 0; i < 10; i++ {
+			add(g.chars[i], bars[i], g.spaces)
+		}
+	}
+	// Special characters have only narrow bars and three wide spaces
+	add('$', "00000", "1110")
+	add('/', "00000", "1101")
+	add('+', "00000", "1011")
+	add('%', "00000", "0111")
+	return table
+}
+
+// decodeCharacter classifies 9 runs as wide or narrow; exactly three must
+// be wide
+func decodeCharacter(runs []int) (byte, int, bool) {
+	sorted := append([]int(nil), runs...)
+	sort.Ints(sorted)
+	narrow, wide := sorted[5], sorted[6]
+	if float64(wide) < 1.5*float64(narrow) {
+		return 0, 0, false
+	}
+	threshold := (narrow + wide) / 2
+
+	var p uint16
+	for _, r := range runs {
+		p <<= 1
+		if r > threshold {
+			p |= 1
+		}
+	}
+	c, ok := code39[p]
+	return c, sorted[0], ok
+}
+
+// decodeCode39 finds *DATA* sequences in the runs of one scan line
+func decodeCode39(runs []int) []string {
+	var values []string
+	// Dark runs are at even indexes
+	for start := 0; start+9 <= len(runs); start += 2 {
+		c, narrow, ok := decodeCharacter(runs[start : start+9])
+		if !ok || c != '*' {
+			continue
+		}
+
+		var value []byte
+		pos := start + 9
+		for pos+10 <= len(runs) {
+			// The gap between characters is about one narrow element
+			if runs[pos] > 4*narrow {
+				break
+			}
+			c, _, ok := decodeCharacter(runs[pos+1 : pos+10])
+			if !ok {
+				break
+			}
+			pos += 10
+			if c == '*' {
+				if len(value) > 0 {
+					values = append(values, string(value))
+					start = pos - 1 // continue after this barcode
+				}
+				break
+			}
+			value = append(value, c)
+		}
+	}
+	return values
+}
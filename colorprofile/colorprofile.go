@@ -0,0 +1,264 @@
+// Package colorprofile attaches ICC color profiles to scanned pages so that
+// color-accurate scans keep their calibration through to the PACS.
+package colorprofile
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultProfile is used for scanners without a profile of their own
+const DefaultProfile = "default.icc"
+
+var (
+	ErrUnsupportedFormat = errors.New("colorprofile: unsupported image format")
+
+	jpegICCMarker = []byte("ICC_PROFILE\x00")
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+	unsafeChars   = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// maxSegment is the profile data that fits in one JPEG APP2 segment
+const maxSegment = 65535 - 2 - 14
+
+// Find returns the profile for a scanner from dir, which contains one
+// <scanner name>.icc per calibrated scanner (lower case, non-alphanumeric
+// characters replaced by '_') and optionally default.icc
+func Find(dir string, scannerName string) ([]byte, string, error) {
+	if dir == "" {
+		return nil, "", os.ErrNotExist
+	}
+	candidates := []string{DefaultProfile}
+	if name := strings.Trim(unsafeChars.ReplaceAllString(strings.ToLower(scannerName), "_"), "_"); name != "" {
+		candidates = append([]string{name + ".icc"}, candidates...)
+	}
+	for _, candidate := range candidates {
+		path := filepath.Join(dir, candidate)
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return data, path, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, path, err
+		}
+	}
+	return nil, "", os.ErrNotExist
+}
+
+// EmbedFile adds the profile to a JPEG or PNG file in place
+func EmbedFile(path string, profile []byte) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var out []byte
+	switch {
+	case isJPEG(data):
+		out = embedJPEG(data, profile)
+	case isPNG(data):
+		if out, err = embedPNG(data, profile); err != nil {
+			return err
+		}
+	default:
+		return ErrUnsupportedFormat
+	}
+
+	tmp := path + ".icc.tmp"
+	if err := os.WriteFile(tmp, out, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Extract returns the embedded profile of a JPEG or PNG file, or nil if it
+// has none
+func Extract(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case isJPEG(data):
+		return extractJPEG(data), nil
+	case isPNG(data):
+		return extractPNG(data)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+func isJPEG(data []byte) bool {
+	return len(data) > 2 && data[0] == 0xFF && data[1] == 0xD8
+}
+
+func isPNG(data []byte) bool {
+	return bytes.HasPrefix(data, pngSignature)
+}
+
+// embedJPEG inserts APP2 ICC_PROFILE segments after the JFIF header,
+// replacing an existing profile
+func embedJPEG(data []byte, profile []byte) []byte {
+	var segments [][]byte
+	for i := 0; i < len(profile); i += maxSegment {
+		segments = append(segments, profile[i:min(i+maxSegment, len(profile))])
+	}
+
+	var icc bytes.Buffer
+	for i, chunk := range segments {
+		icc.Write([]byte{0xFF, 0xE2})
+		binary.Write(&icc, binary.BigEndian, uint16(2+len(jpegICCMarker)+2+len(chunk)))
+		icc.Write(jpegICCMarker)
+		icc.Write([]byte{byte(i + 1), byte(len(segments))})
+		icc.Write(chunk)
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:2])
+	pos := 2
+	inserted := false
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := min(pos+2+length, len(data))
+
+		if marker == 0xE2 && bytes.HasPrefix(data[pos+4:end], jpegICCMarker) {
+			pos = end // drop the old profile
+			continue
+		}
+		if !inserted && marker != 0xE0 && marker != 0xE1 {
+			out.Write(icc.Bytes())
+			inserted = true
+		}
+		if marker == 0xDA {
+			break // entropy coded data follows
+		}
+		out.Write(data[pos:end])
+		pos = end
+	}
+	if !inserted {
+		out.Write(icc.Bytes())
+	}
+	out.Write(data[pos:])
+	return out.Bytes()
+}
+
+func extractJPEG(data []byte) []byte {
+	chunks := map[byte][]byte{}
+	count := 0
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF && data[pos+1] != 0xDA {
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := min(pos+2+length, len(data))
+		segment := data[pos+4 : end]
+		if data[pos+1] == 0xE2 && bytes.HasPrefix(segment, jpegICCMarker) && len(segment) > len(jpegICCMarker)+2 {
+			seq := segment[len(jpegICCMarker)]
+			count = int(segment[len(jpegICCMarker)+1])
+			chunks[seq] = segment[len(jpegICCMarker)+2:]
+		}
+		pos = end
+	}
+
+	var profile []byte
+	for i := 1; i <= count; i++ {
+		chunk, ok := chunks[byte(i)]
+		if !ok {
+			return nil
+		}
+		profile = append(profile, chunk...)
+	}
+	return profile
+}
+
+// embedPNG inserts an iCCP chunk after IHDR, replacing an existing one
+func embedPNG(data []byte, profile []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(profile)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	var chunkData bytes.Buffer
+	chunkData.WriteString("ICC profile\x00")
+	chunkData.WriteByte(0) // deflate
+	chunkData.Write(compressed.Bytes())
+
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	err := walkPNG(data, func(typ string, chunk []byte, raw []byte) {
+		switch typ {
+		case "iCCP", "sRGB":
+			// Only one color space chunk may be present
+			return
+		}
+		out.Write(raw)
+		if typ == "IHDR" {
+			writePNGChunk(&out, "iCCP", chunkData.Bytes())
+		}
+	})
+	return out.Bytes(), err
+}
+
+func extractPNG(data []byte) ([]byte, error) {
+	var profile []byte
+	var extractErr error
+	err := walkPNG(data, func(typ string, chunk []byte, raw []byte) {
+		if typ != "iCCP" {
+			return
+		}
+		nul := bytes.IndexByte(chunk, 0)
+		if nul < 0 || nul+2 > len(chunk) {
+			extractErr = ErrUnsupportedFormat
+			return
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(chunk[nul+2:]))
+		if err != nil {
+			extractErr = err
+			return
+		}
+		profile, extractErr = io.ReadAll(zr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return profile, extractErr
+}
+
+// walkPNG calls fn with the type, data and raw bytes of every chunk
+func walkPNG(data []byte, fn func(typ string, chunk []byte, raw []byte)) error {
+	pos := len(pngSignature)
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if end > len(data) {
+			return ErrUnsupportedFormat
+		}
+		typ := string(data[pos+4 : pos+8])
+		fn(typ, data[pos+8:pos+8+length], data[pos:end])
+		pos = end
+		if typ == "IEND" {
+			return nil
+		}
+	}
+	return ErrUnsupportedFormat
+}
+
+func writePNGChunk(w *bytes.Buffer, typ string, data []byte) {
+	binary.Write(w, binary.BigEndian, uint32(len(data)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	w.WriteString(typ)
+	w.Write(data)
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxAETitleLength is the maximum length of an AE title (PS3.5 AE value
+// representation)
+const maxAETitleLength = 16
+
+// ValidateAETitle checks an AE title against the DICOM rules: 1 to 16
+// characters of the default character repertoire without backslash, not
+// only spaces
+func ValidateAETitle(ae string) error {
+	if len(ae) > maxAETitleLength {
+		return fmt.Errorf("AE title '%s' is longer than %d characters", ae, maxAETitleLength)
+	}
+	if strings.TrimSpace(ae) == "" {
+		return fmt.Errorf("AE title must not be empty")
+	}
+	for _, r := range ae {
+		if r < 0x20 || r > 0x7e || r == '\\' {
+			return fmt.Errorf("AE title '%s' contains an invalid character %q", ae, r)
+		}
+	}
+	return nil
+}
+
+// ParseInstitutionAETitles parses "Institution=AETITLE" entries into a map
+// from the lower-case institution name to the calling AE title
+func ParseInstitutionAETitles(entries []string) (map[string]string, error) {
+	titles := make(map[string]string)
+	for _, entry := range entries {
+		institution, ae, ok := strings.Cut(entry, "=")
+		institution = strings.TrimSpace(institution)
+		ae = strings.TrimSpace(ae)
+		if !ok || institution == "" {
+			return nil, fmt.Errorf("invalid institution AE title '%s', expected Institution=AETITLE", entry)
+		}
+		if err := ValidateAETitle(ae); err != nil {
+			return nil, fmt.Errorf("institution '%s': %v", institution, err)
+		}
+		titles[strings.ToLower(institution)] = ae
+	}
+	return titles, nil
+}
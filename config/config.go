@@ -1,93 +1,651 @@
 package config
 
 import (
-	"os"
+	"fmt"
 	"strconv"
 	"strings"
 )
 
 type Config struct {
-	AppName             string
-	AppVersion          string
-	AppPort             string
-	AppHost             string
-	TempFilesDir        string
+	AppName      string
+	AppVersion   string
+	AppPort      string
+	AppHost      string
+	TempFilesDir string
+	// Give every browser a workspace of its own below TempFilesDir
+	WorkspaceSessions   bool
+	StateDir            string
 	MaxFileSize         int64
 	AllowedExtensions   []string
 	ScannerPollInterval int
 	ScannerTimeout      int
-	WebTitle            string
-	WebDescription      string
-	LogLevel            string
-	LogFormat           string
-	// DICOM Configuration for dcmtk findscu
+	// Resolution of preview scans in dpi
+	ScannerPreviewResolution int
+	ScannerJPEGQuality       int
+	// saned hosts whose scanners are used over the SANE net backend, and
+	// the timeout in seconds for connecting to them
+	ScannerNetHosts   []string
+	ScannerNetTimeout int
+	// JSON file with the default scan options of each scanner model
+	ScannerDefaults string
+	// Start scans with the buttons of the scanners, reported by scanbd
+	ScanButton     bool
+	WebTitle       string
+	WebDescription string
+	LogLevel       string
+	LogFormat      string
+	// Log file besides or instead of stdout, rotated by size and age, and
+	// how many rotated files are kept for how long
+	LogFile              string
+	LogStdout            bool
+	LogFileMaxSizeMB     int
+	LogFileMaxAgeHours   int
+	LogFileMaxBackups    int
+	LogFileRetentionDays int
+	// Syslog server and facility, and the systemd journal, that log
+	// entries are shipped to besides the other outputs
+	LogSyslog         string
+	LogSyslogFacility string
+	LogJournald       bool
+	// Patient data in the log is masked or hashed, with the fields that are
+	// always redacted and the key of the hashes
+	LogRedactPHI    string
+	LogRedactFields []string
+	LogRedactKey    string
+	// OTLP/HTTP collector spans of scans and sends are exported to, and the
+	// service name they are reported under
+	TracingEndpoint    string
+	TracingServiceName string
+	// DICOM Configuration
 	DicomLocalAETitle string
 	DicomQueryAETitle string
 	DicomStoreAETitle string
 	DicomRemoteHost   string
-	DicomFindscuPort  int
-	DicomStorescuPort int
-	DcmtkPath         string
+	// Query and store SCP hosts, default to DicomRemoteHost
+	DicomQueryHost string
+	DicomStoreHost string
+	// Calling AE titles per destination and per institution, default to
+	// DicomLocalAETitle
+	DicomQueryCallingAETitle string
+	DicomStoreCallingAETitle string
+	DicomInstitutionAETitles []string
+	// Keep store associations open and reuse them for the next document
+	DicomAssociationPool        bool
+	DicomAssociationIdleTimeout int
+	DicomFindscuPort            int
+	DicomStorescuPort           int
+	// TLS for query and store associations
+	DicomTLS           bool
+	DicomTLSCert       string
+	DicomTLSKey        string
+	DicomTLSCA         string
+	DicomTLSServerName string
+	DicomTLSPolicy     string
+	// Query information model and relational queries of the query archive
+	DicomQueryModel      string
+	DicomQueryRelational bool
+	// Seconds to wait for the query SCP to connect and for each response
+	DicomQueryTimeout int
 	// DICOM Station Configuration
 	DicomStationName string
+	// Organization root of generated UIDs, 2.25 UUID derived UIDs if empty
+	DicomUIDRoot string
+	// Specific Character Set of outgoing objects and queries
+	DicomCharacterSet string
+	// JSON file mapping document types to the attributes of their instances
+	DicomTagTemplates string
+	// Hold the whole study when a page fails conversion
+	DicomQuarantineFailedPages bool
+	// Fail the whole study if any instance is not stored
+	DicomAtomicSend bool
+	// Request storage commitment after sending, wait DicomCommitmentTimeout
+	// seconds for the report and accept reports on DicomCommitmentPort
+	DicomStorageCommitment bool
+	DicomCommitmentTimeout int
+	DicomCommitmentPort    int
+	// Secondary archive taking over when the store system cannot be
+	// reached; AE title and port default to those of the store system
+	DicomFailoverHost    string
+	DicomFailoverAETitle string
+	DicomFailoverPort    int
+	// Keep instances the PACS could not take in the outbox of the state
+	// directory and retry them with a growing delay
+	DicomOutbox           bool
+	DicomOutboxMaxBackoff int
+	// Report each send as a Modality Performed Procedure Step to the query
+	// system, or to DicomMPPSAETitle there
+	DicomMPPS        bool
+	DicomMPPSAETitle string
+	// Send pages as Secondary Capture images, one Encapsulated PDF or one
+	// multi-frame image
+	DicomSendFormat string
+	// Warn before sending if a similar study of the patient exists today
+	DicomDuplicateCheck bool
+	// ICC profiles of calibrated scanners, embedded into pages and DICOM
+	ICCProfileDir string
+	// Text recognition of the pages with tesseract, stored in the Image
+	// Comments of the DICOM objects
+	OCREnabled       bool
+	OCRTesseractPath string
+	OCRLanguages     string
+	OCRTimeout       int
+	// Local archive of sent studies
+	ArchiveEnabled       bool
+	ArchiveDir           string
+	ArchiveRetentionDays int
+	ArchiveCompression   string
+	// SQL database for the upload history and send queue, shared by
+	// several stations with PostgreSQL
+	DatabaseDriver string
+	DatabaseURL    string
+	// Shared send queue in the database: stations enqueue studies, one
+	// sender node with PACS access stores them
+	SendQueueMode         string
+	SendQueuePollInterval int
+	SendQueueMaxAttempts  int
+	// PDF/A export of archived studies to a file share
+	ExportDir string
+	// Deployment profile and feature toggles
+	Profile            string
+	DemoMode           bool
+	FeatureWebUI       bool
+	FeatureUpload      bool
+	FeatureSettingsAPI bool
+	// Kiosk lockdown: administration, reports and settings only on the
+	// management listener
+	KioskLockdown  bool
+	ManagementHost string
+	ManagementPort string
+	// HTTPS for the web interface: certificate and key, or a self-signed
+	// certificate for the host names, and the plain HTTP port redirected
+	// to HTTPS
+	WebTLSCert          string
+	WebTLSKey           string
+	WebTLSSelfSigned    bool
+	WebTLSHostnames     []string
+	WebHTTPRedirectPort string
+	// Content Security Policy of the web interface
+	CSPMode      string
+	CSPReportURI string
+	// Mobile capture handoff
+	FeatureMobileHandoff bool
+	HandoffTokenTTL      int
+	HandoffBaseURL       string
+	// Confirmation slip printing after a successful send
+	PrintConfirmation bool
+	PrinterURI        string
+	PrintTimeout      int
+	// Documents awaiting patient assignment
+	PendingDir   string
+	PDFRasterDPI int
+	PopplerPath  string
+	// Minutes an inbox lock is held without activity
+	PendingLockMinutes int
+	// Station grouping: this station's key for peers, and remote stations
+	// whose scanners are offered here
+	StationAPIKey        string
+	RemoteStations       []string
+	RemoteStationKeys    []string
+	RemoteStationTimeout int
+	// Lockout after repeated authentication failures (seconds)
+	AuthMaxFailures       int
+	AuthClientMaxFailures int
+	AuthFailureWindow     int
+	AuthLockout           int
+	AuthLockoutMax        int
+	// Scanner reservations in shared scan rooms
+	ScannerReservationDefaultMinutes int
+	ScannerReservationMaxMinutes     int
+	// Minutes without activity after which unsent scans move to the inbox
+	AutoLogoutMinutes int
+	// Splitting of multi-document ingests at separator pages
+	SeparationRules         []string
+	SeparationBlankMaxInk   int
+	SeparationBarcodePrefix string
+	// Splitting of ADF scan batches at separator sheets into inbox
+	// documents
+	ScanSeparation      bool
+	ScanSeparationRules []string
+	// Preselection of the patient by the Code 39 barcode on the first page
+	// of a scan
+	PatientBarcode       bool
+	PatientBarcodePrefix string
+	// Virtual printer ingestion
+	IPPPrinterEnabled bool
+	IPPPrinterPort    int
+	IPPPrinterName    string
+	// Mailbox ingestion
+	IMAPEnabled           bool
+	IMAPHost              string
+	IMAPPort              int
+	IMAPUsername          string
+	IMAPPassword          string
+	IMAPMailbox           string
+	IMAPPollInterval      int
+	IMAPDeleteAfterImport bool
+	// Fault injection for resilience testing (demo mode only)
+	FaultInjection           bool
+	FaultStoreFailurePercent int
+	FaultDicomLatency        int
+	FaultScanDelay           int
+	FaultDiskFull            bool
+	// Header carrying the user name set by a trusted reverse proxy
+	TrustedUserHeader string
+	// Accounts that sign in to the station, and minutes without requests
+	// after which a login ends
+	AuthUsersFile      string
+	AuthSessionMinutes int
+	// Signed-in users who may change PACS settings and API keys
+	AuthAdminUsers []string
+	// OpenID Connect single sign-on, e.g. with Keycloak
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       []string
+	OIDCUserClaim    string
+	// ATNA syslog collector the audit trail is forwarded to, and the ID
+	// the station reports as audit source
+	AuditSyslog   string
+	AuditSourceID string
+	// Reverse proxies whose X-Forwarded-For names the client address
+	TrustedProxies []string
+	// Steps the API requires before a document may be sent
+	WorkflowRequiredSteps []string
+	WorkflowDocumentTypes []string
+	// Logs included in support bundles
+	SupportLogUnit  string
+	SupportLogFiles []string
+	SupportLogLines int
+
+	settings []Setting
+	// invalid are the values Validate reports as unparseable
+	invalid []error
+	// env is the environment the configuration was resolved from
+	env environment
 }
 
 func LoadConfig() *Config {
-	return &Config{
-		AppName:             getEnv("APP_NAME", "DICOMScanStation"),
-		AppVersion:          getEnv("APP_VERSION", "1.0.0"),
-		AppPort:             getEnv("APP_PORT", "8081"),
-		AppHost:             getEnv("APP_HOST", "0.0.0.0"),
-		TempFilesDir:        getEnv("TEMP_FILES_DIR", "/tmp/DICOMScanStation/tempfiles"),
-		MaxFileSize:         getEnvAsInt64("MAX_FILE_SIZE", 10485760),
-		AllowedExtensions:   getEnvAsSlice("ALLOWED_EXTENSIONS", []string{"jpg", "jpeg", "png", "tiff", "tif"}),
-		ScannerPollInterval: getEnvAsInt("SCANNER_POLL_INTERVAL", 5000),
-		ScannerTimeout:      getEnvAsInt("SCANNER_TIMEOUT", 30000),
-		WebTitle:            getEnv("WEB_TITLE", "DICOM Scan Station"),
-		WebDescription:      getEnv("WEB_DESCRIPTION", "USB Document Scanner Web Interface"),
-		LogLevel:            getEnv("LOG_LEVEL", "info"),
-		LogFormat:           getEnv("LOG_FORMAT", "json"),
-		// DICOM Configuration for dcmtk findscu
-		DicomLocalAETitle: getEnv("DICOM_LOCAL_AETITLE", "DICOMScanStation"),
-		DicomQueryAETitle: getEnv("DICOM_QUERY_AETITLE", "DICOMScanStation"),
-		DicomStoreAETitle: getEnv("DICOM_STORE_AETITLE", "DICOMScanStation"),
-		DicomRemoteHost:   getEnv("DICOM_REMOTE_HOST", "localhost"),
-		DicomFindscuPort:  getEnvAsInt("DICOM_FINDSCU_PORT", 11112),
-		DicomStorescuPort: getEnvAsInt("DICOM_STORESCU_PORT", 11113),
-		DcmtkPath:         getEnv("DCMTK_PATH", "/usr/bin"),
+	// An unreadable .env was reported by LoadEnvFile
+	env, _ := readEnvironment()
+	return loadConfig(env, nil)
+}
+
+// loadConfig resolves the configuration from env with the settings changed
+// through the admin API; nil reads them from STATE_DIR
+func loadConfig(env environment, overrides map[string]string) *Config {
+	profile, _ := env.lookup("CONFIG_PROFILE")
+	l := &loader{env: env, profile: profiles[profile]}
+	if overrides == nil {
+		stateDir, _ := l.lookup("STATE_DIR")
+		if stateDir == "" {
+			stateDir = defaultStateDir
+		}
+		var err error
+		if overrides, err = readOverrides(stateDir); err != nil {
+			l.invalid = append(l.invalid, err)
+		}
+	}
+	l.overrides = overrides
+
+	cfg := &Config{
+		AppName:      l.getEnv("APP_NAME", "DICOMScanStation"),
+		AppVersion:   l.getEnv("APP_VERSION", "1.0.0"),
+		AppPort:      l.getEnv("APP_PORT", "8081"),
+		AppHost:      l.getEnv("APP_HOST", "0.0.0.0"),
+		TempFilesDir: l.getEnv("TEMP_FILES_DIR", "/tmp/DICOMScanStation/tempfiles"),
+		// Give every browser a workspace of its own below TempFilesDir
+		WorkspaceSessions:        l.getEnvAsBool("WORKSPACE_SESSIONS", false),
+		StateDir:                 l.getEnv("STATE_DIR", defaultStateDir),
+		MaxFileSize:              l.getEnvAsInt64("MAX_FILE_SIZE", 10485760),
+		AllowedExtensions:        l.getEnvAsSlice("ALLOWED_EXTENSIONS", []string{"jpg", "jpeg", "png", "tiff", "tif"}),
+		ScannerPollInterval:      l.getEnvAsInt("SCANNER_POLL_INTERVAL", 5000),
+		ScannerTimeout:           l.getEnvAsInt("SCANNER_TIMEOUT", 30000),
+		ScannerPreviewResolution: l.getEnvAsInt("SCANNER_PREVIEW_RESOLUTION", 75),
+		ScannerJPEGQuality:       l.getEnvAsInt("SCANNER_JPEG_QUALITY", 95),
+		// saned hosts whose scanners are used over the SANE net backend, and
+		// the timeout in seconds for connecting to them
+		ScannerNetHosts:   l.getEnvAsSlice("SCANNER_NET_HOSTS", []string{}),
+		ScannerNetTimeout: l.getEnvAsInt("SCANNER_NET_TIMEOUT", 10),
+		// JSON file with the default scan options of each scanner model
+		ScannerDefaults: l.getEnv("SCANNER_DEFAULTS", ""),
+		// Start scans with the buttons of the scanners, reported by scanbd
+		ScanButton:     l.getEnvAsBool("SCAN_BUTTON", false),
+		WebTitle:       l.getEnv("WEB_TITLE", "DICOM Scan Station"),
+		WebDescription: l.getEnv("WEB_DESCRIPTION", "USB Document Scanner Web Interface"),
+		LogLevel:       l.getEnv("LOG_LEVEL", "info"),
+		LogFormat:      l.getEnv("LOG_FORMAT", "json"),
+		// Log file besides or instead of stdout, rotated by size and age, and
+		// how many rotated files are kept for how long
+		LogFile:              l.getEnv("LOG_FILE", ""),
+		LogStdout:            l.getEnvAsBool("LOG_STDOUT", true),
+		LogFileMaxSizeMB:     l.getEnvAsInt("LOG_FILE_MAX_SIZE_MB", 50),
+		LogFileMaxAgeHours:   l.getEnvAsInt("LOG_FILE_MAX_AGE_HOURS", 24),
+		LogFileMaxBackups:    l.getEnvAsInt("LOG_FILE_MAX_BACKUPS", 14),
+		LogFileRetentionDays: l.getEnvAsInt("LOG_FILE_RETENTION_DAYS", 30),
+		// Syslog server and facility, and the systemd journal, that log
+		// entries are shipped to besides the other outputs
+		LogSyslog:         l.getEnv("LOG_SYSLOG", ""),
+		LogSyslogFacility: l.getEnv("LOG_SYSLOG_FACILITY", "local0"),
+		LogJournald:       l.getEnvAsBool("LOG_JOURNALD", false),
+		// Patient data in the log is masked or hashed, with the fields that are
+		// always redacted and the key of the hashes
+		LogRedactPHI:    l.getEnv("LOG_REDACT_PHI", "off"),
+		LogRedactFields: l.getEnvAsSlice("LOG_REDACT_FIELDS", []string{"patientId", "patientName", "birthDate", "searchTerm"}),
+		LogRedactKey:    l.getEnv("LOG_REDACT_KEY", ""),
+		// OTLP/HTTP collector spans of scans and sends are exported to, and the
+		// service name they are reported under
+		TracingEndpoint:    l.getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		TracingServiceName: l.getEnv("OTEL_SERVICE_NAME", "DICOMScanStation"),
+		// DICOM Configuration
+		DicomLocalAETitle: l.getEnv("DICOM_LOCAL_AETITLE", "DICOMScanStation"),
+		DicomQueryAETitle: l.getEnv("DICOM_QUERY_AETITLE", "DICOMScanStation"),
+		DicomStoreAETitle: l.getEnv("DICOM_STORE_AETITLE", "DICOMScanStation"),
+		DicomRemoteHost:   l.getEnv("DICOM_REMOTE_HOST", "localhost"),
+		// Query and store SCP hosts, default to DicomRemoteHost
+		DicomQueryHost: l.getEnv("DICOM_QUERY_HOST", ""),
+		DicomStoreHost: l.getEnv("DICOM_STORE_HOST", ""),
+		// Calling AE titles per destination and per institution, default to
+		// DicomLocalAETitle
+		DicomQueryCallingAETitle: l.getEnv("DICOM_QUERY_CALLING_AETITLE", ""),
+		DicomStoreCallingAETitle: l.getEnv("DICOM_STORE_CALLING_AETITLE", ""),
+		DicomInstitutionAETitles: l.getEnvAsSlice("DICOM_INSTITUTION_AETITLES", []string{}),
+		// Keep store associations open and reuse them for the next document
+		DicomAssociationPool:        l.getEnvAsBool("DICOM_ASSOCIATION_POOL", false),
+		DicomAssociationIdleTimeout: l.getEnvAsInt("DICOM_ASSOCIATION_IDLE_TIMEOUT", 60),
+		DicomFindscuPort:            l.getEnvAsInt("DICOM_FINDSCU_PORT", 11112),
+		DicomStorescuPort:           l.getEnvAsInt("DICOM_STORESCU_PORT", 11113),
+		// TLS for query and store associations
+		DicomTLS:           l.getEnvAsBool("DICOM_TLS", false),
+		DicomTLSCert:       l.getEnv("DICOM_TLS_CERT", ""),
+		DicomTLSKey:        l.getEnv("DICOM_TLS_KEY", ""),
+		DicomTLSCA:         l.getEnv("DICOM_TLS_CA", ""),
+		DicomTLSServerName: l.getEnv("DICOM_TLS_SERVER_NAME", ""),
+		DicomTLSPolicy:     l.getEnv("DICOM_TLS_POLICY", "bcp195"),
+		// Query information model and relational queries of the query archive
+		DicomQueryModel:      l.getEnv("DICOM_QUERY_MODEL", ""),
+		DicomQueryRelational: l.getEnvAsBool("DICOM_QUERY_RELATIONAL", false),
+		// Seconds to wait for the query SCP to connect and for each response
+		DicomQueryTimeout: l.getEnvAsInt("DICOM_QUERY_TIMEOUT", 30),
 		// DICOM Station Configuration
-		DicomStationName: getEnv("DICOM_STATION_NAME", "DICOMScanStation"),
+		DicomStationName: l.getEnv("DICOM_STATION_NAME", "DICOMScanStation"),
+		// Organization root of generated UIDs, 2.25 UUID derived UIDs if empty
+		DicomUIDRoot: l.getEnv("DICOM_UID_ROOT", ""),
+		// Specific Character Set of outgoing objects and queries
+		DicomCharacterSet: l.getEnv("DICOM_CHARACTER_SET", "ISO_IR 192"),
+		// JSON file mapping document types to the attributes of their instances
+		DicomTagTemplates: l.getEnv("DICOM_TAG_TEMPLATES", ""),
+		// Hold the whole study when a page fails conversion
+		DicomQuarantineFailedPages: l.getEnvAsBool("DICOM_QUARANTINE_FAILED_PAGES", true),
+		// Fail the whole study if any instance is not stored
+		DicomAtomicSend: l.getEnvAsBool("DICOM_ATOMIC_SEND", false),
+		// Request storage commitment after sending, wait DicomCommitmentTimeout
+		// seconds for the report and accept reports on DicomCommitmentPort
+		DicomStorageCommitment: l.getEnvAsBool("DICOM_STORAGE_COMMITMENT", false),
+		DicomCommitmentTimeout: l.getEnvAsInt("DICOM_COMMITMENT_TIMEOUT", 30),
+		DicomCommitmentPort:    l.getEnvAsInt("DICOM_COMMITMENT_PORT", 0),
+		// Secondary archive taking over when the store system cannot be
+		// reached; AE title and port default to those of the store system
+		DicomFailoverHost:    l.getEnv("DICOM_FAILOVER_HOST", ""),
+		DicomFailoverAETitle: l.getEnv("DICOM_FAILOVER_AETITLE", ""),
+		DicomFailoverPort:    l.getEnvAsInt("DICOM_FAILOVER_PORT", 0),
+		// Keep instances the PACS could not take in the outbox of the state
+		// directory and retry them with a growing delay
+		DicomOutbox:           l.getEnvAsBool("DICOM_OUTBOX", false),
+		DicomOutboxMaxBackoff: l.getEnvAsInt("DICOM_OUTBOX_MAX_BACKOFF", 3600),
+		// Report each send as a Modality Performed Procedure Step to the query
+		// system, or to DicomMPPSAETitle there
+		DicomMPPS:        l.getEnvAsBool("DICOM_MPPS", false),
+		DicomMPPSAETitle: l.getEnv("DICOM_MPPS_AETITLE", ""),
+		// Send pages as Secondary Capture images, one Encapsulated PDF or one
+		// multi-frame image
+		DicomSendFormat: l.getEnv("DICOM_SEND_FORMAT", "images"),
+		// Warn before sending if a similar study of the patient exists today
+		DicomDuplicateCheck: l.getEnvAsBool("DICOM_DUPLICATE_CHECK", false),
+		// ICC profiles of calibrated scanners, embedded into pages and DICOM
+		ICCProfileDir: l.getEnv("ICC_PROFILE_DIR", ""),
+		// Text recognition of the pages with tesseract, stored in the Image
+		// Comments of the DICOM objects
+		OCREnabled:       l.getEnvAsBool("OCR_ENABLED", false),
+		OCRTesseractPath: l.getEnv("OCR_TESSERACT_PATH", "/usr/bin/tesseract"),
+		OCRLanguages:     l.getEnv("OCR_LANGUAGES", "deu+eng"),
+		OCRTimeout:       l.getEnvAsInt("OCR_TIMEOUT", 60),
+		// Local archive of sent studies
+		ArchiveEnabled:       l.getEnvAsBool("ARCHIVE_ENABLED", false),
+		ArchiveDir:           l.getEnv("ARCHIVE_DIR", "/var/lib/DICOMScanStation/archive"),
+		ArchiveRetentionDays: l.getEnvAsInt("ARCHIVE_RETENTION_DAYS", 30),
+		ArchiveCompression:   l.getEnv("ARCHIVE_COMPRESSION", "zstd"),
+		// SQL database for the upload history and send queue, shared by
+		// several stations with PostgreSQL
+		DatabaseDriver: l.getEnv("DATABASE_DRIVER", ""),
+		DatabaseURL:    l.getEnv("DATABASE_URL", ""),
+		// Shared send queue in the database: stations enqueue studies, one
+		// sender node with PACS access stores them
+		SendQueueMode:         l.getEnv("SEND_QUEUE_MODE", ""),
+		SendQueuePollInterval: l.getEnvAsInt("SEND_QUEUE_POLL_INTERVAL", 10),
+		SendQueueMaxAttempts:  l.getEnvAsInt("SEND_QUEUE_MAX_ATTEMPTS", 10),
+		// PDF/A export of archived studies to a file share
+		ExportDir: l.getEnv("EXPORT_DIR", ""),
+		// Deployment profile and feature toggles
+		Profile:            l.getEnv("CONFIG_PROFILE", ""),
+		DemoMode:           l.getEnvAsBool("DEMO_MODE", false),
+		FeatureWebUI:       l.getEnvAsBool("FEATURE_WEB_UI", true),
+		FeatureUpload:      l.getEnvAsBool("FEATURE_UPLOAD", true),
+		FeatureSettingsAPI: l.getEnvAsBool("FEATURE_SETTINGS_API", true),
+		// Kiosk lockdown: administration, reports and settings only on the
+		// management listener
+		KioskLockdown:  l.getEnvAsBool("KIOSK_LOCKDOWN", false),
+		ManagementHost: l.getEnv("MANAGEMENT_HOST", "127.0.0.1"),
+		ManagementPort: l.getEnv("MANAGEMENT_PORT", "8082"),
+		// HTTPS for the web interface: certificate and key, or a self-signed
+		// certificate for the host names, and the plain HTTP port redirected
+		// to HTTPS
+		WebTLSCert:          l.getEnv("WEB_TLS_CERT", ""),
+		WebTLSKey:           l.getEnv("WEB_TLS_KEY", ""),
+		WebTLSSelfSigned:    l.getEnvAsBool("WEB_TLS_SELF_SIGNED", false),
+		WebTLSHostnames:     l.getEnvAsSlice("WEB_TLS_HOSTNAMES", []string{}),
+		WebHTTPRedirectPort: l.getEnv("WEB_HTTP_REDIRECT_PORT", ""),
+		// Content Security Policy of the web interface
+		CSPMode:      l.getEnv("CSP_MODE", "enforce"),
+		CSPReportURI: l.getEnv("CSP_REPORT_URI", ""),
+		// Mobile capture handoff
+		FeatureMobileHandoff: l.getEnvAsBool("FEATURE_MOBILE_HANDOFF", true),
+		HandoffTokenTTL:      l.getEnvAsInt("HANDOFF_TOKEN_TTL", 600),
+		HandoffBaseURL:       l.getEnv("HANDOFF_BASE_URL", ""),
+		// Confirmation slip printing after a successful send
+		PrintConfirmation: l.getEnvAsBool("PRINT_CONFIRMATION", false),
+		PrinterURI:        l.getEnv("PRINTER_URI", ""),
+		PrintTimeout:      l.getEnvAsInt("PRINT_TIMEOUT", 10),
+		// Documents awaiting patient assignment
+		PendingDir:   l.getEnv("PENDING_DIR", "/var/lib/DICOMScanStation/pending"),
+		PDFRasterDPI: l.getEnvAsInt("PDF_RASTER_DPI", 200),
+		PopplerPath:  l.getEnv("POPPLER_PATH", "/usr/bin"),
+		// Minutes an inbox lock is held without activity
+		PendingLockMinutes: l.getEnvAsInt("PENDING_LOCK_MINUTES", 15),
+		// Station grouping: this station's key for peers, and remote stations
+		// whose scanners are offered here
+		StationAPIKey:        l.getEnv("STATION_API_KEY", ""),
+		RemoteStations:       l.getEnvAsSlice("REMOTE_STATIONS", []string{}),
+		RemoteStationKeys:    l.getEnvAsSlice("REMOTE_STATION_KEYS", []string{}),
+		RemoteStationTimeout: l.getEnvAsInt("REMOTE_STATION_TIMEOUT", 300),
+		// Lockout after repeated authentication failures (seconds)
+		AuthMaxFailures:       l.getEnvAsInt("AUTH_MAX_FAILURES", 5),
+		AuthClientMaxFailures: l.getEnvAsInt("AUTH_CLIENT_MAX_FAILURES", 25),
+		AuthFailureWindow:     l.getEnvAsInt("AUTH_FAILURE_WINDOW", 900),
+		AuthLockout:           l.getEnvAsInt("AUTH_LOCKOUT", 300),
+		AuthLockoutMax:        l.getEnvAsInt("AUTH_LOCKOUT_MAX", 86400),
+		// Scanner reservations in shared scan rooms
+		ScannerReservationDefaultMinutes: l.getEnvAsInt("SCANNER_RESERVATION_DEFAULT_MINUTES", 5),
+		ScannerReservationMaxMinutes:     l.getEnvAsInt("SCANNER_RESERVATION_MAX_MINUTES", 30),
+		// Minutes without activity after which unsent scans move to the inbox
+		AutoLogoutMinutes: l.getEnvAsInt("AUTO_LOGOUT_MINUTES", 0),
+		// Splitting of multi-document ingests at separator pages
+		SeparationRules:         l.getEnvAsSlice("SEPARATION_RULES", []string{}),
+		SeparationBlankMaxInk:   l.getEnvAsInt("SEPARATION_BLANK_MAX_INK", 5),
+		SeparationBarcodePrefix: l.getEnv("SEPARATION_BARCODE_PREFIX", ""),
+		// Splitting of ADF scan batches at separator sheets into inbox
+		// documents
+		ScanSeparation:      l.getEnvAsBool("SCAN_SEPARATION", false),
+		ScanSeparationRules: l.getEnvAsSlice("SCAN_SEPARATION_RULES", []string{"patch"}),
+		// Preselection of the patient by the Code 39 barcode on the first page
+		// of a scan
+		PatientBarcode:       l.getEnvAsBool("PATIENT_BARCODE", false),
+		PatientBarcodePrefix: l.getEnv("PATIENT_BARCODE_PREFIX", ""),
+		// Virtual printer ingestion
+		IPPPrinterEnabled: l.getEnvAsBool("IPP_PRINTER_ENABLED", false),
+		IPPPrinterPort:    l.getEnvAsInt("IPP_PRINTER_PORT", 8631),
+		IPPPrinterName:    l.getEnv("IPP_PRINTER_NAME", "DICOMScanStation"),
+		// Mailbox ingestion
+		IMAPEnabled:           l.getEnvAsBool("IMAP_ENABLED", false),
+		IMAPHost:              l.getEnv("IMAP_HOST", ""),
+		IMAPPort:              l.getEnvAsInt("IMAP_PORT", 993),
+		IMAPUsername:          l.getEnv("IMAP_USERNAME", ""),
+		IMAPPassword:          l.getEnv("IMAP_PASSWORD", ""),
+		IMAPMailbox:           l.getEnv("IMAP_MAILBOX", "INBOX"),
+		IMAPPollInterval:      l.getEnvAsInt("IMAP_POLL_INTERVAL", 60),
+		IMAPDeleteAfterImport: l.getEnvAsBool("IMAP_DELETE_AFTER_IMPORT", false),
+		// Fault injection for resilience testing (demo mode only)
+		FaultInjection:           l.getEnvAsBool("FAULT_INJECTION", false),
+		FaultStoreFailurePercent: l.getEnvAsInt("FAULT_STORE_FAILURE_PERCENT", 0),
+		FaultDicomLatency:        l.getEnvAsInt("FAULT_DICOM_LATENCY", 0),
+		FaultScanDelay:           l.getEnvAsInt("FAULT_SCAN_DELAY", 0),
+		FaultDiskFull:            l.getEnvAsBool("FAULT_DISK_FULL", false),
+		// Header carrying the user name set by a trusted reverse proxy
+		TrustedUserHeader: l.getEnv("TRUSTED_USER_HEADER", ""),
+		// Accounts that sign in to the station, and minutes without requests
+		// after which a login ends
+		AuthUsersFile:      l.getEnv("AUTH_USERS_FILE", ""),
+		AuthSessionMinutes: l.getEnvAsInt("AUTH_SESSION_MINUTES", 60),
+		// Signed-in users who may change PACS settings and API keys
+		AuthAdminUsers: l.getEnvAsSlice("AUTH_ADMIN_USERS", []string{}),
+		// OpenID Connect single sign-on, e.g. with Keycloak
+		OIDCIssuer:       l.getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:     l.getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: l.getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:  l.getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:       l.getEnvAsSlice("OIDC_SCOPES", []string{"openid", "profile"}),
+		OIDCUserClaim:    l.getEnv("OIDC_USER_CLAIM", "preferred_username"),
+		// ATNA syslog collector the audit trail is forwarded to, and the ID
+		// the station reports as audit source
+		AuditSyslog:   l.getEnv("AUDIT_SYSLOG", ""),
+		AuditSourceID: l.getEnv("AUDIT_SOURCE_ID", ""),
+		// Reverse proxies whose X-Forwarded-For names the client address
+		TrustedProxies: l.getEnvAsSlice("TRUSTED_PROXIES", []string{}),
+		// Steps the API requires before a document may be sent
+		WorkflowRequiredSteps: l.getEnvAsSlice("WORKFLOW_REQUIRED_STEPS", []string{}),
+		WorkflowDocumentTypes: l.getEnvAsSlice("WORKFLOW_DOCUMENT_TYPES", []string{}),
+		// Logs included in support bundles
+		SupportLogUnit:  l.getEnv("SUPPORT_LOG_UNIT", "dicomscanstation.service"),
+		SupportLogFiles: l.getEnvAsSlice("SUPPORT_LOG_FILES", []string{}),
+		SupportLogLines: l.getEnvAsInt("SUPPORT_LOG_LINES", 5000),
+	}
+	// The query and store SCPs run on the PACS unless configured separately
+	if cfg.DicomQueryHost == "" {
+		cfg.DicomQueryHost = cfg.DicomRemoteHost
+	}
+	if cfg.DicomStoreHost == "" {
+		cfg.DicomStoreHost = cfg.DicomRemoteHost
 	}
+	cfg.settings = l.settings
+	cfg.invalid = l.invalid
+	cfg.env = env
+	return cfg
+}
+
+// defaultStateDir holds the state of the station unless STATE_DIR is set
+const defaultStateDir = "/var/lib/DICOMScanStation"
+
+// loader resolves a setting from the admin overrides, then the environment
+// and falls back to the selected profile before using the built-in
+// default. Every resolved value is recorded together with its source for
+// --print-config.
+type loader struct {
+	// overrides are the settings changed through the admin API
+	overrides map[string]string
+	env       environment
+	profile   map[string]string
+	settings  []Setting
+	// invalid are values that could not be parsed and were replaced by the
+	// default
+	invalid []error
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+func (l *loader) lookup(key string) (string, Source) {
+	if value := l.overrides[key]; value != "" {
+		return value, SourceAdmin
 	}
-	return defaultValue
+	if value, source := l.env.lookup(key); value != "" {
+		return value, source
+	}
+	if value := l.profile[key]; value != "" {
+		return value, SourceProfile
+	}
+	return "", SourceDefault
+}
+
+func (l *loader) record(key, kind, defaultValue, value string, source Source) {
+	l.settings = append(l.settings, Setting{
+		Key:     key,
+		Type:    kind,
+		Value:   value,
+		Default: defaultValue,
+		Source:  source,
+	})
 }
 
-func getEnvAsInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
+func (l *loader) getEnv(key, defaultValue string) string {
+	value, source := l.lookup(key)
+	if value == "" {
+		value, source = defaultValue, SourceDefault
+	}
+	l.record(key, "string", defaultValue, value, source)
+	return value
+}
+
+func (l *loader) getEnvAsInt(key string, defaultValue int) int {
+	result, source := defaultValue, SourceDefault
+	if value, src := l.lookup(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+			result, source = intValue, src
+		} else {
+			l.invalid = append(l.invalid, fmt.Errorf("%s: '%s' is not an integer", key, value))
 		}
 	}
-	return defaultValue
+	l.record(key, "integer", strconv.Itoa(defaultValue), strconv.Itoa(result), source)
+	return result
 }
 
-func getEnvAsInt64(key string, defaultValue int64) int64 {
-	if value := os.Getenv(key); value != "" {
+func (l *loader) getEnvAsInt64(key string, defaultValue int64) int64 {
+	result, source := defaultValue, SourceDefault
+	if value, src := l.lookup(key); value != "" {
 		if intValue, err := strconv.ParseInt(value, 10, 64); err == nil {
-			return intValue
+			result, source = intValue, src
+		} else {
+			l.invalid = append(l.invalid, fmt.Errorf("%s: '%s' is not an integer", key, value))
 		}
 	}
-	return defaultValue
+	l.record(key, "integer", strconv.FormatInt(defaultValue, 10), strconv.FormatInt(result, 10), source)
+	return result
 }
 
-func getEnvAsSlice(key string, defaultValue []string) []string {
-	if value := os.Getenv(key); value != "" {
-		return strings.Split(value, ",")
+func (l *loader) getEnvAsSlice(key string, defaultValue []string) []string {
+	result, source := defaultValue, SourceDefault
+	if value, src := l.lookup(key); value != "" {
+		result, source = strings.Split(value, ","), src
+	}
+	l.record(key, "array", strings.Join(defaultValue, ","), strings.Join(result, ","), source)
+	return result
+}
+
+func (l *loader) getEnvAsBool(key string, defaultValue bool) bool {
+	result, source := defaultValue, SourceDefault
+	if value, src := l.lookup(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			result, source = boolValue, src
+		} else {
+			l.invalid = append(l.invalid, fmt.Errorf("%s: '%s' is not a boolean (use true or false)", key, value))
+		}
 	}
-	return defaultValue
+	l.record(key, "boolean", strconv.FormatBool(defaultValue), strconv.FormatBool(result), source)
+	return result
 }
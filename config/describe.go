@@ -0,0 +1,313 @@
+package config
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Source tells where the effective value of a setting came from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceProfile Source = "profile"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	// SourceAdmin settings were changed through the admin API
+	SourceAdmin Source = "admin"
+)
+
+const redacted = "********"
+
+// Setting describes one resolved configuration variable
+type Setting struct {
+	Key         string `json:"key"`
+	Type        string `json:"type"`
+	Value       string `json:"value"`
+	Default     string `json:"default"`
+	Source      Source `json:"source"`
+	Description string `json:"description,omitempty"`
+	Secret      bool   `json:"secret,omitempty"`
+}
+
+type settingDoc struct {
+	description string
+	secret      bool
+}
+
+// docs documents every environment variable read by LoadConfig
+var docs = map[string]settingDoc{
+	"CONFIG_PROFILE":                      {description: "Deployment profile bundling defaults (kiosk, headless-batch, demo)"},
+	"APP_NAME":                            {description: "Application name shown in the settings API"},
+	"APP_VERSION":                         {description: "Application version shown in the settings API"},
+	"APP_PORT":                            {description: "TCP port of the web server"},
+	"APP_HOST":                            {description: "Listen address of the web server"},
+	"TEMP_FILES_DIR":                      {description: "Directory holding scanned and uploaded pages"},
+	"MAX_FILE_SIZE":                       {description: "Maximum upload size per file in bytes"},
+	"ALLOWED_EXTENSIONS":                  {description: "Accepted file extensions"},
+	"SCANNER_POLL_INTERVAL":               {description: "Scanner detection interval in milliseconds"},
+	"SCANNER_TIMEOUT":                     {description: "Single page scan timeout in milliseconds"},
+	"WEB_TITLE":                           {description: "Title of the web interface"},
+	"WEB_DESCRIPTION":                     {description: "Subtitle of the web interface"},
+	"LOG_LEVEL":                           {description: "Log level (debug, info, warn, error)"},
+	"LOG_FORMAT":                          {description: "Log output format (json, text)"},
+	"DICOM_LOCAL_AETITLE":                 {description: "Calling AE title of this station"},
+	"DICOM_QUERY_AETITLE":                 {description: "Called AE title of the query/retrieve SCP"},
+	"DICOM_STORE_AETITLE":                 {description: "Called AE title of the storage SCP"},
+	"DICOM_REMOTE_HOST":                   {description: "Host name or IP address of the PACS, used for queries and storage unless set separately"},
+	"DICOM_FINDSCU_PORT":                  {description: "Port of the query/retrieve SCP"},
+	"DICOM_STORESCU_PORT":                 {description: "Port of the storage SCP"},
+	"DICOM_STATION_NAME":                  {description: "StationName written into outgoing DICOM objects"},
+	"DICOM_QUARANTINE_FAILED_PAGES":       {description: "Hold the whole study when a page fails conversion until the operator resolves it"},
+	"DICOM_ATOMIC_SEND":                   {description: "Fail the whole study and keep all local files if any instance is not stored"},
+	"ARCHIVE_ENABLED":                     {description: "Keep a local copy of every sent study"},
+	"ARCHIVE_DIR":                         {description: "Directory of the local archive"},
+	"ARCHIVE_RETENTION_DAYS":              {description: "Days archived studies are kept before they are purged"},
+	"DEMO_MODE":                           {description: "Simulate patient search and PACS upload"},
+	"FEATURE_WEB_UI":                      {description: "Serve the operator web interface"},
+	"FEATURE_UPLOAD":                      {description: "Allow uploading files through the API"},
+	"FEATURE_SETTINGS_API":                {description: "Expose the resolved settings at /api/settings"},
+	"FEATURE_MOBILE_HANDOFF":              {description: "Allow adding phone photos to the current batch via QR code"},
+	"HANDOFF_TOKEN_TTL":                   {description: "Validity of a mobile handoff QR code in seconds"},
+	"HANDOFF_BASE_URL":                    {description: "Station URL reachable from phones, defaults to the request host"},
+	"PRINT_CONFIRMATION":                  {description: "Print a confirmation slip after every successful send"},
+	"PRINTER_URI":                         {description: "IPP URI of the slip printer, e.g. ipp://host:631/printers/label"},
+	"PRINT_TIMEOUT":                       {description: "Seconds to wait for the printer to accept a job"},
+	"PENDING_DIR":                         {description: "Directory for documents awaiting patient assignment"},
+	"PDF_RASTER_DPI":                      {description: "Resolution used to rasterize PDF pages to JPEG"},
+	"POPPLER_PATH":                        {description: "Directory containing pdftoppm (poppler-utils)"},
+	"IPP_PRINTER_ENABLED":                 {description: "Accept print jobs as an IPP virtual printer"},
+	"IPP_PRINTER_PORT":                    {description: "TCP port of the virtual printer"},
+	"IPP_PRINTER_NAME":                    {description: "Printer name announced to clients"},
+	"IMAP_ENABLED":                        {description: "Import PDF/JPEG mail attachments as pending documents"},
+	"IMAP_HOST":                           {description: "IMAP server host name"},
+	"IMAP_PORT":                           {description: "IMAP server port (implicit TLS)"},
+	"IMAP_USERNAME":                       {description: "Mailbox user name"},
+	"IMAP_PASSWORD":                       {description: "Mailbox password", secret: true},
+	"IMAP_MAILBOX":                        {description: "Mailbox folder to import from"},
+	"IMAP_POLL_INTERVAL":                  {description: "Seconds between mailbox polls"},
+	"IMAP_DELETE_AFTER_IMPORT":            {description: "Delete imported messages instead of marking them as read"},
+	"DICOM_DUPLICATE_CHECK":               {description: "Ask for confirmation if a study with the same patient, date and description already exists"},
+	"STATE_DIR":                           {description: "Directory for small persistent state files such as scanner capability baselines"},
+	"FAULT_INJECTION":                     {description: "Inject failures and latency for resilience testing (demo mode only)"},
+	"FAULT_STORE_FAILURE_PERCENT":         {description: "Chance in percent that a single instance fails C-STORE"},
+	"FAULT_DICOM_LATENCY":                 {description: "Added latency for PACS queries and uploads in milliseconds"},
+	"FAULT_SCAN_DELAY":                    {description: "Added delay for every scan in milliseconds"},
+	"FAULT_DISK_FULL":                     {description: "Simulate a full disk for scans and uploads"},
+	"TRUSTED_USER_HEADER":                 {description: "Request header with the user name set by a reverse proxy; only accepted from TRUSTED_PROXIES"},
+	"WORKFLOW_REQUIRED_STEPS":             {description: "Steps required before sending: preview, document_type, confirm_birth_date"},
+	"WORKFLOW_DOCUMENT_TYPES":             {description: "Document types allowed as description when document_type is required"},
+	"EXPORT_DIR":                          {description: "Directory (e.g. a mounted file share) for PDF/A exports of archived studies"},
+	"ICC_PROFILE_DIR":                     {description: "Directory with <scanner name>.icc or default.icc profiles embedded into color scans"},
+	"SEPARATION_RULES":                    {description: "Split ingested documents at separator pages: blank, patch, barcode"},
+	"SEPARATION_BLANK_MAX_INK":            {description: "Dark pixels in per mille up to which a page counts as blank"},
+	"SEPARATION_BARCODE_PREFIX":           {description: "Only Code 39 barcodes with this prefix mark a separator page"},
+	"PENDING_LOCK_MINUTES":                {description: "Minutes an operator keeps the lock on an inbox document without activity"},
+	"AUTO_LOGOUT_MINUTES":                 {description: "Minutes without activity after which the kiosk logs out and unsent scans move to the inbox (0 disables)"},
+	"SCANNER_RESERVATION_DEFAULT_MINUTES": {description: "Duration of a scanner reservation when the request does not specify one"},
+	"SCANNER_RESERVATION_MAX_MINUTES":     {description: "Longest scanner reservation that can be requested"},
+	"STATION_API_KEY":                     {description: "Key other stations must present to use this station's scanners (empty disables the station API)", secret: true},
+	"REMOTE_STATIONS":                     {description: "Remote stations whose scanners are offered here, as name=url"},
+	"REMOTE_STATION_KEYS":                 {description: "Keys of the remote stations, as name=key", secret: true},
+	"REMOTE_STATION_TIMEOUT":              {description: "Seconds to wait for a remote station, including the scan itself"},
+	"DICOM_QUERY_MODEL":                   {description: "Query information model of the query archive: patient, study or empty for Study Root with patient level searches"},
+	"DICOM_QUERY_RELATIONAL":              {description: "Use relational queries with the query archive"},
+	"DICOM_QUERY_HOST":                    {description: "Host of the query/retrieve or worklist SCP, e.g. the RIS"},
+	"DICOM_STORE_HOST":                    {description: "Host of the storage SCP, e.g. the VNA"},
+	"DICOM_QUERY_CALLING_AETITLE":         {description: "Calling AE title presented to the query SCP, defaults to DICOM_LOCAL_AETITLE"},
+	"DICOM_STORE_CALLING_AETITLE":         {description: "Calling AE title presented to the storage SCP, defaults to DICOM_LOCAL_AETITLE"},
+	"DICOM_INSTITUTION_AETITLES":          {description: "Calling AE titles for storing documents of an institution (Institution=AETITLE, comma separated)"},
+	"DICOM_ASSOCIATION_POOL":              {description: "Keep the store association open for the next document"},
+	"DICOM_ASSOCIATION_IDLE_TIMEOUT":      {description: "Seconds an unused store association is kept open"},
+	"ARCHIVE_COMPRESSION":                 {description: "Compression of archived instances: zstd or none"},
+	"DATABASE_DRIVER":                     {description: "SQL database for the upload history and send queue: sqlite, postgres or empty for files"},
+	"DATABASE_URL":                        {description: "Database connection string; SQLite defaults to station.db in STATE_DIR", secret: true},
+	"SEND_QUEUE_MODE":                     {description: "Shared send queue role: empty to send directly, enqueue to hand studies to the queue, sender to store queued studies"},
+	"SEND_QUEUE_POLL_INTERVAL":            {description: "Seconds between checks of the send queue on the sender node"},
+	"SEND_QUEUE_MAX_ATTEMPTS":             {description: "Attempts before a queued study is marked as failed"},
+	"KIOSK_LOCKDOWN":                      {description: "Serve administration, report, queue and settings endpoints only on the management listener"},
+	"MANAGEMENT_HOST":                     {description: "Interface of the management listener in kiosk lockdown"},
+	"MANAGEMENT_PORT":                     {description: "TCP port of the management listener in kiosk lockdown"},
+	"CSP_MODE":                            {description: "Content Security Policy of the web interface: enforce, report-only or off"},
+	"CSP_REPORT_URI":                      {description: "Endpoint browsers report Content Security Policy violations to"},
+	"AUTH_MAX_FAILURES":                   {description: "Failed sign-ins of an account within AUTH_FAILURE_WINDOW before it is locked out (0 disables the lockout)"},
+	"AUTH_CLIENT_MAX_FAILURES":            {description: "Failed authentication attempts of a client address within AUTH_FAILURE_WINDOW before it is locked out (0 disables the lockout)"},
+	"AUTH_FAILURE_WINDOW":                 {description: "Seconds in which failed authentication attempts are counted"},
+	"AUTH_LOCKOUT":                        {description: "Seconds of the first lockout; every further lockout doubles it"},
+	"AUTH_LOCKOUT_MAX":                    {description: "Upper limit of the lockout in seconds"},
+	"TRUSTED_PROXIES":                     {description: "Addresses or networks of reverse proxies whose X-Forwarded-For header names the client"},
+	"SUPPORT_LOG_UNIT":                    {description: "systemd unit whose journal is included in support bundles; empty skips the journal"},
+	"SUPPORT_LOG_FILES":                   {description: "Log files included in support bundles"},
+	"SUPPORT_LOG_LINES":                   {description: "Lines taken from the end of each log in a support bundle"},
+	"DICOM_QUERY_TIMEOUT":                 {description: "Seconds to wait for the query SCP to accept the association and for each C-FIND response"},
+	"DICOM_SEND_FORMAT":                   {description: "Send scanned pages as Secondary Capture images (images), or all pages of a study as one Encapsulated PDF (pdf) or one multi-frame Secondary Capture image (multiframe)"},
+	"DICOM_TLS":                           {description: "Encrypt query and store associations with TLS"},
+	"DICOM_TLS_CERT":                      {description: "Client certificate (PEM) presented to the PACS"},
+	"DICOM_TLS_KEY":                       {description: "Private key (PEM) of the client certificate"},
+	"DICOM_TLS_CA":                        {description: "CA certificates (PEM) the PACS certificate is verified against; empty uses the system roots"},
+	"DICOM_TLS_SERVER_NAME":               {description: "Host name expected in the PACS certificate; empty uses the configured host"},
+	"DICOM_TLS_POLICY":                    {description: "Allowed TLS versions and cipher suites: bcp195, tls13 or legacy"},
+	"DICOM_STORAGE_COMMITMENT":            {description: "Request storage commitment after sending and report the commitment state per instance"},
+	"DICOM_COMMITMENT_TIMEOUT":            {description: "Seconds to wait for the storage commitment report"},
+	"DICOM_COMMITMENT_PORT":               {description: "Port accepting the storage commitment reports the PACS sends on its own association, 0 to only accept them on the request association"},
+	"DICOM_MPPS":                          {description: "Report each send as a Modality Performed Procedure Step (N-CREATE, then N-SET to COMPLETED or DISCONTINUED)"},
+	"DICOM_MPPS_AETITLE":                  {description: "Called AE title for MPPS on the query host, empty for DICOM_QUERY_AETITLE"},
+	"DICOM_UID_ROOT":                      {description: "Organization UID root of generated study, series and instance UIDs (at most 30 characters); UUID derived 2.25 UIDs if empty"},
+	"DICOM_CHARACTER_SET":                 {description: "Specific Character Set of sent objects and queries: ISO_IR 192 (UTF-8), ISO_IR 100 (Latin-1) or ISO_IR 6 (ASCII)"},
+	"DICOM_TAG_TEMPLATES":                 {description: "JSON file mapping document types (the description) to DICOM attributes such as SeriesDescription, BodyPartExamined and Modality"},
+	"DICOM_FAILOVER_HOST":                 {description: "Secondary archive that receives the remaining instances of a send when the store system cannot be reached (empty disables failover)"},
+	"DICOM_FAILOVER_AETITLE":              {description: "AE title of the failover archive (default DICOM_STORE_AETITLE)"},
+	"DICOM_FAILOVER_PORT":                 {description: "Port of the failover archive (0 uses DICOM_STORESCU_PORT)"},
+	"DICOM_OUTBOX":                        {description: "Keep instances the PACS could not take in STATE_DIR/outbox and retry them until they are delivered"},
+	"DICOM_OUTBOX_MAX_BACKOFF":            {description: "Longest delay between two outbox retries in seconds; the delay starts at 30 seconds and doubles"},
+	"SCANNER_PREVIEW_RESOLUTION":          {description: "Resolution of quick preview scans in dpi"},
+	"SCANNER_JPEG_QUALITY":                {description: "JPEG quality of scanned pages (1-100) unless a scan asks for another"},
+	"OCR_ENABLED":                         {description: "Recognize the text of pages with tesseract and store it in the DICOM objects"},
+	"OCR_TESSERACT_PATH":                  {description: "Path of the tesseract executable"},
+	"OCR_LANGUAGES":                       {description: "Tesseract languages, e.g. deu+eng"},
+	"OCR_TIMEOUT":                         {description: "Seconds tesseract may take per page"},
+	"PATIENT_BARCODE":                     {description: "Preselect the patient by the Code 39 barcode on the first page of a scan"},
+	"PATIENT_BARCODE_PREFIX":              {description: "Only patient barcodes with this prefix are read; the prefix is not part of the ID"},
+	"SCAN_SEPARATION":                     {description: "Offer splitting ADF scan batches at separator sheets into inbox documents"},
+	"SCAN_SEPARATION_RULES":               {description: "Separator pages of scan batches: patch, barcode and/or blank"},
+	"SCANNER_NET_HOSTS":                   {description: "Hosts running saned whose scanners are used over the SANE net backend"},
+	"SCANNER_NET_TIMEOUT":                 {description: "Timeout in seconds for connecting to saned hosts"},
+	"SCANNER_DEFAULTS":                    {description: "JSON file mapping device or scanner names (patterns like fujitsu:* allowed) to their default scan options"},
+	"WORKSPACE_SESSIONS":                  {description: "Give every browser a workspace of its own below TEMP_FILES_DIR, so operators at different scanners work in parallel"},
+	"SCAN_BUTTON":                         {description: "Accept scanner button presses from scanbd on POST /api/scanners/:device/button; the web interface with the scanner selected starts a scan"},
+	"AUTH_USERS_FILE":                     {description: "htpasswd file with bcrypt hashes of the users who sign in; empty does not require a login"},
+	"AUTH_SESSION_MINUTES":                {description: "Minutes without requests after which a login ends"},
+	"OIDC_ISSUER":                         {description: "URL of the OpenID Connect issuer for single sign-on, e.g. a Keycloak realm; empty disables it"},
+	"OIDC_CLIENT_ID":                      {description: "Client ID of the station at the identity provider"},
+	"OIDC_CLIENT_SECRET":                  {description: "Client secret of the station at the identity provider", secret: true},
+	"OIDC_REDIRECT_URL":                   {description: "URL of /login/oidc/callback of the station, as registered at the identity provider"},
+	"OIDC_SCOPES":                         {description: "Scopes requested at the identity provider"},
+	"OIDC_USER_CLAIM":                     {description: "ID token claim with the user name"},
+	"AUDIT_SYSLOG":                        {description: "ATNA syslog collector the audit trail is forwarded to as DICOM audit messages (udp://, tcp:// or tls://host:port)"},
+	"AUDIT_SOURCE_ID":                     {description: "Audit source ID of the station in DICOM audit messages (default: host name)"},
+	"WEB_TLS_CERT":                        {description: "Certificate (PEM) of the web interface; serves HTTPS"},
+	"WEB_TLS_KEY":                         {description: "Private key (PEM) of WEB_TLS_CERT"},
+	"WEB_TLS_SELF_SIGNED":                 {description: "Serve HTTPS with a self-signed certificate generated in STATE_DIR"},
+	"WEB_TLS_HOSTNAMES":                   {description: "Additional host names and IP addresses of the self-signed certificate"},
+	"WEB_HTTP_REDIRECT_PORT":              {description: "Plain HTTP port redirected to HTTPS"},
+	"LOG_FILE":                            {description: "Log file written besides stdout, rotated by size and age"},
+	"LOG_STDOUT":                          {description: "Also log to stdout when LOG_FILE is set"},
+	"LOG_FILE_MAX_SIZE_MB":                {description: "Size in MB after which the log file is rotated; 0 disables"},
+	"LOG_FILE_MAX_AGE_HOURS":              {description: "Hours after which the log file is rotated; 0 disables"},
+	"LOG_FILE_MAX_BACKUPS":                {description: "Rotated log files kept; 0 keeps all"},
+	"LOG_FILE_RETENTION_DAYS":             {description: "Days after which rotated log files are deleted; 0 keeps them"},
+	"LOG_SYSLOG":                          {description: "Syslog server log entries are shipped to (udp://, tcp://, tls://host:port or unix:///dev/log)"},
+	"LOG_SYSLOG_FACILITY":                 {description: "Syslog facility of log entries (user, daemon, local0 to local7)"},
+	"LOG_JOURNALD":                        {description: "Write log entries with their fields to the systemd journal"},
+	"OTEL_EXPORTER_OTLP_ENDPOINT":         {description: "OTLP/HTTP collector spans of scans and sends are exported to, e.g. http://collector:4318"},
+	"OTEL_SERVICE_NAME":                   {description: "Service name spans are reported under"},
+	"LOG_REDACT_PHI":                      {description: "Patient data in the log: off, mask or hash"},
+	"LOG_REDACT_FIELDS":                   {description: "Log fields always redacted with LOG_REDACT_PHI"},
+	"LOG_REDACT_KEY":                      {description: "Key of the hashes of LOG_REDACT_PHI=hash; empty uses a key per start", secret: true},
+	"AUTH_ADMIN_USERS":                    {description: "Signed-in users who may use the administration, reports and settings endpoints"},
+}
+
+// Settings returns all resolved settings with their source. Secret values
+// are masked.
+func (c *Config) Settings() []Setting {
+	settings := make([]Setting, 0, len(c.settings))
+	for _, s := range c.settings {
+		doc := docs[s.Key]
+		s.Description = doc.description
+		s.Secret = doc.secret || isSecretKey(s.Key)
+		if s.Secret {
+			if s.Value != "" {
+				s.Value = redacted
+			}
+			if s.Default != "" {
+				s.Default = redacted
+			}
+		}
+		settings = append(settings, s)
+	}
+	return settings
+}
+
+// Schema returns a JSON schema describing all supported environment variables
+func (c *Config) Schema() map[string]interface{} {
+	properties := make(map[string]interface{})
+	for _, s := range c.Settings() {
+		property := map[string]interface{}{
+			"type":        s.Type,
+			"description": s.Description,
+		}
+		if s.Type == "array" {
+			property["type"] = "string"
+			property["description"] = strings.TrimSpace(s.Description + " (comma separated)")
+		}
+		if !s.Secret && s.Default != "" {
+			property["default"] = schemaValue(s.Type, s.Default)
+		}
+		if s.Secret {
+			property["writeOnly"] = true
+		}
+		properties[s.Key] = property
+	}
+
+	return map[string]interface{}{
+		"$schema":    "http://json-schema.org/draft-07/schema#",
+		"title":      "DICOMScanStation environment",
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+func schemaValue(kind, value string) interface{} {
+	switch kind {
+	case "integer":
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return v
+		}
+	case "boolean":
+		if v, err := strconv.ParseBool(value); err == nil {
+			return v
+		}
+	}
+	return value
+}
+
+func isSecretKey(key string) bool {
+	for _, marker := range []string{"PASSWORD", "SECRET", "TOKEN"} {
+		if strings.Contains(key, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// SecretValues returns the values of all secret settings that are set, so
+// they can be removed from logs and diagnostics. List settings contribute
+// each element and the value of name=value pairs.
+func (c *Config) SecretValues() []string {
+	var values []string
+	for _, s := range c.settings {
+		if s.Value == "" || !(docs[s.Key].secret || isSecretKey(s.Key)) {
+			continue
+		}
+		values = append(values, s.Value)
+		if s.Type != "array" {
+			continue
+		}
+		for _, item := range strings.Split(s.Value, ",") {
+			item = strings.TrimSpace(item)
+			if _, value, ok := strings.Cut(item, "="); ok {
+				item = value
+			}
+			if item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+// MarshalSettings renders the resolved settings as indented JSON
+func (c *Config) MarshalSettings() ([]byte, error) {
+	return json.MarshalIndent(c.Settings(), "", "  ")
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+)
+
+var (
+	envMu sync.Mutex
+	// startEnv is the environment the station started in, before .env was
+	// exported; nil until LoadEnvFile
+	startEnv map[string]string
+)
+
+// environment holds the variables a configuration is resolved from: the
+// environment the station started in, then the .env file
+type environment struct {
+	vars map[string]string
+	file map[string]string
+}
+
+// LoadEnvFile exports the variables of .env that are not set in the
+// environment
+func LoadEnvFile() error {
+	envMu.Lock()
+	startEnv = environ()
+	envMu.Unlock()
+	return godotenv.Load()
+}
+
+// readEnvironment returns the environment with the .env file as it is now.
+// The process environment is left alone, so a rejected .env changes
+// nothing.
+func readEnvironment() (environment, error) {
+	envMu.Lock()
+	vars := startEnv
+	envMu.Unlock()
+	if vars == nil {
+		vars = environ()
+	}
+	file, err := godotenv.Read()
+	if err != nil && !os.IsNotExist(err) {
+		return environment{}, err
+	}
+	return environment{vars: vars, file: file}, nil
+}
+
+// lookup returns a variable; .env does not override the environment, not
+// even with an empty variable
+func (e environment) lookup(key string) (string, Source) {
+	if value, ok := e.vars[key]; ok {
+		if value != "" {
+			return value, SourceEnv
+		}
+		return "", SourceDefault
+	}
+	if value := e.file[key]; value != "" {
+		return value, SourceFile
+	}
+	return "", SourceDefault
+}
+
+func environ() map[string]string {
+	vars := make(map[string]string)
+	for _, variable := range os.Environ() {
+		key, value, _ := strings.Cut(variable, "=")
+		vars[key] = value
+	}
+	return vars
+}
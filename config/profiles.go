@@ -0,0 +1,54 @@
+package config
+
+import "sort"
+
+// profiles bundle defaults for the different deployment roles. A profile is
+// selected with CONFIG_PROFILE; explicitly set environment variables always
+// take precedence over the profile values.
+var profiles = map[string]map[string]string{
+	// Ward or front desk kiosk: operator UI only, no configuration details
+	"kiosk": {
+		"FEATURE_WEB_UI":       "true",
+		"FEATURE_UPLOAD":       "false",
+		"FEATURE_SETTINGS_API": "false",
+		"LOG_LEVEL":            "warn",
+	},
+	// Back office batch station driven through the API only
+	"headless-batch": {
+		"FEATURE_WEB_UI":        "false",
+		"FEATURE_UPLOAD":        "true",
+		"FEATURE_SETTINGS_API":  "true",
+		"SCANNER_POLL_INTERVAL": "15000",
+		"SCANNER_TIMEOUT":       "120000",
+		"LOG_FORMAT":            "json",
+	},
+	// Trade show / training setup without a PACS
+	"demo": {
+		"DEMO_MODE":            "true",
+		"FEATURE_WEB_UI":       "true",
+		"FEATURE_UPLOAD":       "true",
+		"FEATURE_SETTINGS_API": "true",
+		"WEB_TITLE":            "DICOM Scan Station (Demo)",
+		"DICOM_REMOTE_HOST":    "localhost",
+		"LOG_LEVEL":            "debug",
+	},
+}
+
+// Profiles returns the names of all built-in configuration profiles
+func Profiles() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsKnownProfile reports whether name is empty or one of the built-in profiles
+func IsKnownProfile(name string) bool {
+	if name == "" {
+		return true
+	}
+	_, ok := profiles[name]
+	return ok
+}
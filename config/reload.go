@@ -0,0 +1,162 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// ErrInvalidConfig is returned for changes the station would not start with
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// Reconfigurable is a service that picks up changed runtime settings while
+// it runs
+type Reconfigurable interface {
+	Reconfigure(cfg *Config)
+}
+
+// Reloader holds the configuration the station currently runs with and
+// hands changed runtime settings to the services
+type Reloader struct {
+	// mu serializes changes; current is only replaced, never modified
+	mu      sync.Mutex
+	current *Config
+	checks  []func(*Config) error
+	targets []Reconfigurable
+}
+
+// NewReloader returns a reloader for the configuration the station started
+// with; a changed configuration is only applied if it passes Validate with
+// checks, like at startup
+func NewReloader(cfg *Config, checks ...func(*Config) error) *Reloader {
+	return &Reloader{current: cfg, checks: checks}
+}
+
+// Register adds a service to reconfigure on changes
+func (r *Reloader) Register(target Reconfigurable) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.targets = append(r.targets, target)
+}
+
+// Current returns the configuration the station runs with
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Commit stores what belongs to a change besides the settings, e.g. the
+// file a setting names. The returned function reverts it.
+type Commit func() (undo func(), err error)
+
+// Update changes runtime settings through the admin API: a value overrides
+// the setting, an empty value removes the override. Once the resulting
+// configuration is valid, commit runs, the changes are kept in STATE_DIR
+// and applied; if they cannot be, commit is undone. It returns the
+// settings whose value changed.
+func (r *Reloader) Update(changes map[string]string, commit Commit) ([]string, error) {
+	for key := range changes {
+		if !IsRuntimeKey(key) {
+			return nil, fmt.Errorf("%w: %s cannot be changed at runtime", ErrInvalidConfig, key)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	overrides := r.current.overrides()
+	for key, value := range changes {
+		if value == "" {
+			delete(overrides, key)
+		} else {
+			overrides[key] = value
+		}
+	}
+	fresh := loadConfig(r.current.env, overrides)
+	if err := fresh.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	// The checks may read what commit stores, e.g. the scanner defaults, so
+	// only they run again once it has
+	undo := func() {}
+	if commit != nil {
+		var err error
+		if undo, err = commit(); err != nil {
+			return nil, err
+		}
+	}
+	if err := joinProblems(runChecks(fresh, r.checks)); err != nil {
+		undo()
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	next := r.current.WithRuntimeSettings(fresh)
+	if err := writeOverrides(r.current.StateDir, overrides); err != nil {
+		undo()
+		return nil, err
+	}
+	return r.apply(next), nil
+}
+
+// Reload reads .env and the changes made through the admin API again, e.g.
+// after configuration management pushed a new .env, and applies the
+// runtime settings and the DICOM settings the services rebuild. It returns
+// the settings applied whose value changed and the other changed settings,
+// which take effect after a restart.
+func (r *Reloader) Reload() (changed []string, restart []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	env, err := readEnvironment()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read .env: %v", err)
+	}
+	fresh := loadConfig(env, nil)
+	next, err := r.prepare(fresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current := make(map[string]string)
+	for _, s := range r.current.settings {
+		current[s.Key] = s.Value
+	}
+	for _, s := range fresh.settings {
+		if !isReloadKey(s.Key) && current[s.Key] != s.Value {
+			restart = append(restart, s.Key)
+		}
+	}
+	slices.Sort(restart)
+	return r.apply(next), restart, nil
+}
+
+// prepare returns the current configuration with the runtime settings of
+// fresh, if fresh passes validation and the checks
+func (r *Reloader) prepare(fresh *Config) (*Config, error) {
+	if err := fresh.Validate(r.checks...); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	return r.current.WithRuntimeSettings(fresh), nil
+}
+
+// apply makes next the current configuration and reconfigures the
+// services; r.mu must be held
+func (r *Reloader) apply(next *Config) []string {
+	previous := make(map[string]string)
+	for _, s := range r.current.settings {
+		previous[s.Key] = s.Value
+	}
+	var changed []string
+	for _, s := range next.settings {
+		if isReloadKey(s.Key) && previous[s.Key] != s.Value {
+			changed = append(changed, s.Key)
+		}
+	}
+	slices.Sort(changed)
+
+	r.current = next
+	for _, target := range r.targets {
+		target.Reconfigure(next)
+	}
+	return changed
+}
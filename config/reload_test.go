@@ -0,0 +1,107 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// recorder is a service that records the configurations it is handed
+type recorder struct{ configs []*Config }
+
+func (r *recorder) Reconfigure(cfg *Config) { r.configs = append(r.configs, cfg) }
+
+func newTestReloader(t *testing.T, checks ...func(*Config) error) (*Reloader, *recorder) {
+	cfg := loadConfig(testEnvironment(t, nil), map[string]string{})
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	r := NewReloader(cfg, checks...)
+	target := &recorder{}
+	r.Register(target)
+	return r, target
+}
+
+func TestUpdate(t *testing.T) {
+	r, target := newTestReloader(t)
+	changed, err := r.Update(map[string]string{"DICOM_FINDSCU_PORT": "11113"}, nil)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if !slices.Equal(changed, []string{"DICOM_FINDSCU_PORT"}) {
+		t.Errorf("Update changed %v, want [DICOM_FINDSCU_PORT]", changed)
+	}
+	if port := r.Current().DicomFindscuPort; port != 11113 {
+		t.Errorf("DicomFindscuPort = %d, want 11113", port)
+	}
+	if len(target.configs) != 1 || target.configs[0] != r.Current() {
+		t.Errorf("service was reconfigured %d times, want once with the current configuration", len(target.configs))
+	}
+	if _, err := os.Stat(filepath.Join(r.Current().StateDir, overridesFile)); err != nil {
+		t.Errorf("overrides were not kept: %v", err)
+	}
+}
+
+func TestUpdateRejectionLeavesStateUntouched(t *testing.T) {
+	failingCheck := func(*Config) error { return errors.New("DICOM_TAG_TEMPLATES: unreadable") }
+	tests := []struct {
+		name    string
+		changes map[string]string
+		checks  []func(*Config) error
+		// committed tells whether commit ran and had to be undone
+		committed bool
+	}{
+		{"not a runtime setting", map[string]string{"APP_PORT": "9000"}, nil, false},
+		{"invalid port", map[string]string{"DICOM_FINDSCU_PORT": "99999"}, nil, false},
+		{"invalid AE title", map[string]string{"DICOM_STORE_AETITLE": "THIS_AE_TITLE_IS_TOO_LONG"}, nil, false},
+		{"failing check", map[string]string{"DICOM_FINDSCU_PORT": "11113"}, []func(*Config) error{failingCheck}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, target := newTestReloader(t, tt.checks...)
+			before := r.Current()
+
+			var committed, undone bool
+			commit := func() (func(), error) {
+				committed = true
+				return func() { undone = true }, nil
+			}
+			_, err := r.Update(tt.changes, commit)
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("Update error = %v, want ErrInvalidConfig", err)
+			}
+			if r.Current() != before {
+				t.Error("Update replaced the current configuration")
+			}
+			if len(target.configs) != 0 {
+				t.Error("Update reconfigured a service")
+			}
+			if committed != tt.committed || undone != tt.committed {
+				t.Errorf("commit ran %v and was undone %v, want %v", committed, undone, tt.committed)
+			}
+			if _, err := os.Stat(filepath.Join(before.StateDir, overridesFile)); !os.IsNotExist(err) {
+				t.Errorf("overrides were written: %v", err)
+			}
+		})
+	}
+}
+
+func TestReloadRejectionLeavesStateUntouched(t *testing.T) {
+	r, target := newTestReloader(t)
+	before := r.Current()
+	t.Setenv("TEMP_FILES_DIR", before.TempFilesDir)
+	t.Setenv("STATE_DIR", before.StateDir)
+	t.Setenv("DICOM_FINDSCU_PORT", "99999")
+
+	if _, _, err := r.Reload(); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Reload error = %v, want ErrInvalidConfig", err)
+	}
+	if r.Current() != before {
+		t.Error("Reload replaced the current configuration")
+	}
+	if len(target.configs) != 0 {
+		t.Error("Reload reconfigured a service")
+	}
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// overridesFile in STATE_DIR keeps the settings changed through the admin
+// API across restarts
+const overridesFile = "config-overrides.json"
+
+// RuntimeKeys are the settings the running services pick up without a
+// restart: the PACS hosts, ports and AE titles, and the scanner defaults.
+// Only these can be changed through the admin API.
+var RuntimeKeys = []string{
+	"DICOM_REMOTE_HOST",
+	"DICOM_QUERY_HOST",
+	"DICOM_STORE_HOST",
+	"DICOM_FINDSCU_PORT",
+	"DICOM_STORESCU_PORT",
+	"DICOM_LOCAL_AETITLE",
+	"DICOM_QUERY_AETITLE",
+	"DICOM_STORE_AETITLE",
+	"DICOM_QUERY_CALLING_AETITLE",
+	"DICOM_STORE_CALLING_AETITLE",
+	"SCANNER_DEFAULTS",
+}
+
+// reloadKeys are the settings a reload picks up besides RuntimeKeys: the
+// DICOM TLS settings, the institution AE titles, the UID root and the tag
+// templates, which the DICOM service rebuilds
+var reloadKeys = []string{
+	"DICOM_TLS",
+	"DICOM_TLS_CERT",
+	"DICOM_TLS_KEY",
+	"DICOM_TLS_CA",
+	"DICOM_TLS_SERVER_NAME",
+	"DICOM_TLS_POLICY",
+	"DICOM_INSTITUTION_AETITLES",
+	"DICOM_UID_ROOT",
+	"DICOM_TAG_TEMPLATES",
+}
+
+// IsRuntimeKey tells whether key is one of RuntimeKeys
+func IsRuntimeKey(key string) bool {
+	return slices.Contains(RuntimeKeys, key)
+}
+
+// isReloadKey tells whether the running services pick up key on a reload
+func isReloadKey(key string) bool {
+	return IsRuntimeKey(key) || slices.Contains(reloadKeys, key)
+}
+
+// WithRuntimeSettings returns a copy of c with the settings of fresh the
+// running services pick up; all other settings keep the values the station
+// started with
+func (c *Config) WithRuntimeSettings(fresh *Config) *Config {
+	next := *c
+	next.DicomRemoteHost = fresh.DicomRemoteHost
+	next.DicomQueryHost = fresh.DicomQueryHost
+	next.DicomStoreHost = fresh.DicomStoreHost
+	next.DicomFindscuPort = fresh.DicomFindscuPort
+	next.DicomStorescuPort = fresh.DicomStorescuPort
+	next.DicomLocalAETitle = fresh.DicomLocalAETitle
+	next.DicomQueryAETitle = fresh.DicomQueryAETitle
+	next.DicomStoreAETitle = fresh.DicomStoreAETitle
+	next.DicomQueryCallingAETitle = fresh.DicomQueryCallingAETitle
+	next.DicomStoreCallingAETitle = fresh.DicomStoreCallingAETitle
+	next.ScannerDefaults = fresh.ScannerDefaults
+	next.DicomTLS = fresh.DicomTLS
+	next.DicomTLSCert = fresh.DicomTLSCert
+	next.DicomTLSKey = fresh.DicomTLSKey
+	next.DicomTLSCA = fresh.DicomTLSCA
+	next.DicomTLSServerName = fresh.DicomTLSServerName
+	next.DicomTLSPolicy = fresh.DicomTLSPolicy
+	next.DicomInstitutionAETitles = fresh.DicomInstitutionAETitles
+	next.DicomUIDRoot = fresh.DicomUIDRoot
+	next.DicomTagTemplates = fresh.DicomTagTemplates
+	// Later changes build on the environment of fresh
+	next.env = fresh.env
+
+	next.settings = slices.Clone(c.settings)
+	for i, s := range next.settings {
+		if !isReloadKey(s.Key) {
+			continue
+		}
+		if j := slices.IndexFunc(fresh.settings, func(f Setting) bool { return f.Key == s.Key }); j >= 0 {
+			next.settings[i] = fresh.settings[j]
+		}
+	}
+	return &next
+}
+
+// RuntimeSettings returns the runtime settings with their source, which is
+// "admin" for the ones changed through the admin API
+func (c *Config) RuntimeSettings() []Setting {
+	var settings []Setting
+	for _, s := range c.Settings() {
+		if IsRuntimeKey(s.Key) {
+			settings = append(settings, s)
+		}
+	}
+	return settings
+}
+
+// overrides returns the settings changed through the admin API
+func (c *Config) overrides() map[string]string {
+	overrides := make(map[string]string)
+	for _, s := range c.settings {
+		if s.Source == SourceAdmin {
+			overrides[s.Key] = s.Value
+		}
+	}
+	return overrides
+}
+
+// readOverrides reads the settings changed through the admin API; a
+// station without changes has no file
+func readOverrides(stateDir string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(stateDir, overridesFile))
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", overridesFile, err)
+	}
+	var overrides map[string]string
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", overridesFile, err)
+	}
+	for key := range overrides {
+		if !IsRuntimeKey(key) {
+			return nil, fmt.Errorf("%s: %s cannot be changed at runtime", overridesFile, key)
+		}
+	}
+	return overrides, nil
+}
+
+func writeOverrides(stateDir string, overrides map[string]string) error {
+	data, err := json.MarshalIndent(overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(stateDir, overridesFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", overridesFile, err)
+	}
+	return os.Rename(tmp, path)
+}
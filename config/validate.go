@@ -0,0 +1,215 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// namedValue is a setting to check, with the key to report it under
+type namedValue struct{ key, value string }
+
+// Validate checks the configuration as a whole and reports every problem
+// at once: values that could not be parsed, missing settings, ports out of
+// range, directories the station cannot write to, invalid AE titles, TLS
+// and login settings and features that do not go together. The checks of
+// other packages, e.g. of files a setting names, are reported along with
+// them.
+func (c *Config) Validate(checks ...func(*Config) error) error {
+	problems := append([]error(nil), c.invalid...)
+	add := func(key string, format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	// Settings without which the station cannot work
+	required := []namedValue{
+		{"APP_PORT", c.AppPort},
+		{"TEMP_FILES_DIR", c.TempFilesDir},
+		{"STATE_DIR", c.StateDir},
+		{"DICOM_REMOTE_HOST", c.DicomRemoteHost},
+		{"DICOM_QUERY_HOST", c.DicomQueryHost},
+		{"DICOM_STORE_HOST", c.DicomStoreHost},
+	}
+	if c.IMAPEnabled {
+		required = append(required,
+			namedValue{"IMAP_HOST", c.IMAPHost},
+			namedValue{"IMAP_USERNAME", c.IMAPUsername})
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.value) == "" {
+			add(r.key, "is required")
+		}
+	}
+
+	// Every port setting, unless it is unset or 0 where 0 turns it off
+	for _, s := range c.settings {
+		if !strings.HasSuffix(s.Key, "_PORT") || s.Value == "" || (s.Value == "0" && s.Default == "0") {
+			continue
+		}
+		if port, err := strconv.Atoi(s.Value); err != nil || port < 1 || port > 65535 {
+			add(s.Key, "'%s' is not a port between 1 and 65535", s.Value)
+		}
+	}
+
+	// Directories the station writes to, as far as their feature is used
+	dirs := []namedValue{
+		{"TEMP_FILES_DIR", c.TempFilesDir},
+		{"STATE_DIR", c.StateDir},
+	}
+	if c.ArchiveEnabled {
+		dirs = append(dirs, namedValue{"ARCHIVE_DIR", c.ArchiveDir})
+	}
+	if c.ExportDir != "" {
+		dirs = append(dirs, namedValue{"EXPORT_DIR", c.ExportDir})
+	}
+	if c.IPPPrinterEnabled || c.IMAPEnabled || c.AutoLogoutMinutes > 0 || c.ScanSeparation {
+		dirs = append(dirs, namedValue{"PENDING_DIR", c.PendingDir})
+	}
+	for _, d := range dirs {
+		if strings.TrimSpace(d.value) == "" {
+			continue
+		}
+		if err := checkWritable(d.value); err != nil {
+			add(d.key, "'%s' is not writable: %v", d.value, err)
+		}
+	}
+
+	// AE titles; the calling and failover titles fall back to others
+	titles := []struct {
+		key, value string
+		optional   bool
+	}{
+		{"DICOM_LOCAL_AETITLE", c.DicomLocalAETitle, false},
+		{"DICOM_QUERY_AETITLE", c.DicomQueryAETitle, false},
+		{"DICOM_STORE_AETITLE", c.DicomStoreAETitle, false},
+		{"DICOM_QUERY_CALLING_AETITLE", c.DicomQueryCallingAETitle, true},
+		{"DICOM_STORE_CALLING_AETITLE", c.DicomStoreCallingAETitle, true},
+		{"DICOM_FAILOVER_AETITLE", c.DicomFailoverAETitle, true},
+	}
+	for _, t := range titles {
+		if t.value == "" && t.optional {
+			continue
+		}
+		if err := ValidateAETitle(t.value); err != nil {
+			add(t.key, "%v", err)
+		}
+	}
+	if _, err := ParseInstitutionAETitles(c.DicomInstitutionAETitles); err != nil {
+		add("DICOM_INSTITUTION_AETITLES", "%v", err)
+	}
+
+	if !IsKnownProfile(c.Profile) {
+		add("CONFIG_PROFILE", "unknown profile '%s' (available: %s)", c.Profile, strings.Join(Profiles(), ", "))
+	}
+
+	// Scanner settings that have no way to turn them off
+	if c.ScannerPreviewResolution <= 0 {
+		add("SCANNER_PREVIEW_RESOLUTION", "must be positive")
+	}
+	if c.ScannerJPEGQuality < 1 || c.ScannerJPEGQuality > 100 {
+		add("SCANNER_JPEG_QUALITY", "must be between 1 and 100")
+	}
+	if c.ScannerNetTimeout <= 0 {
+		add("SCANNER_NET_TIMEOUT", "must be positive")
+	}
+
+	// Login with a users file or single sign-on
+	if c.AuthUsersFile != "" || c.OIDCIssuer != "" {
+		if c.AuthSessionMinutes <= 0 {
+			add("AUTH_SESSION_MINUTES", "must be positive")
+		}
+	}
+	if issuer := strings.TrimSpace(c.OIDCIssuer); issuer != "" {
+		if !isURL(issuer) {
+			add("OIDC_ISSUER", "must be a URL")
+		}
+		if c.OIDCClientID == "" {
+			add("OIDC_CLIENT_ID", "is required with OIDC_ISSUER")
+		}
+		if !isURL(c.OIDCRedirectURL) {
+			add("OIDC_REDIRECT_URL", "must be the URL of /login/oidc/callback of the station")
+		}
+	}
+
+	// Certificates and keys are only loaded in pairs
+	if (c.DicomTLSCert == "") != (c.DicomTLSKey == "") {
+		add("DICOM_TLS_CERT", "DICOM_TLS_CERT and DICOM_TLS_KEY must be set together")
+	}
+	if (c.WebTLSCert == "") != (c.WebTLSKey == "") {
+		add("WEB_TLS_CERT", "WEB_TLS_CERT and WEB_TLS_KEY must be set together")
+	}
+	if c.WebHTTPRedirectPort != "" && c.WebTLSCert == "" && c.WebTLSKey == "" && !c.WebTLSSelfSigned {
+		add("WEB_HTTP_REDIRECT_PORT", "requires WEB_TLS_CERT or WEB_TLS_SELF_SIGNED")
+	}
+	if endpoint := strings.TrimSpace(c.TracingEndpoint); endpoint != "" &&
+		!strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		add("OTEL_EXPORTER_OTLP_ENDPOINT", "'%s' must start with http:// or https://", endpoint)
+	}
+
+	// Features that depend on others
+	if c.DicomStorageCommitment && c.DicomCommitmentPort > 0 && c.DicomTLS && c.DicomTLSCert == "" {
+		add("DICOM_COMMITMENT_PORT", "with DICOM_TLS requires DICOM_TLS_CERT and DICOM_TLS_KEY")
+	}
+	if c.SendQueueMode != "" && c.DatabaseDriver == "" {
+		add("SEND_QUEUE_MODE", "requires DATABASE_DRIVER")
+	}
+	if c.DicomOutbox && c.DicomOutboxMaxBackoff < 30 {
+		add("DICOM_OUTBOX_MAX_BACKOFF", "must be at least 30 seconds")
+	}
+	if c.OCREnabled && c.OCRTimeout <= 0 {
+		add("OCR_TIMEOUT", "must be positive")
+	}
+	if c.TrustedUserHeader != "" && len(c.TrustedProxies) == 0 {
+		add("TRUSTED_USER_HEADER", "requires TRUSTED_PROXIES, the only clients it is accepted from")
+	}
+	if c.FaultInjection && !c.DemoMode {
+		add("FAULT_INJECTION", "requires DEMO_MODE (the demo profile)")
+	}
+
+	problems = append(problems, runChecks(c, checks)...)
+	return joinProblems(problems)
+}
+
+// runChecks returns the problems the checks of other packages find
+func runChecks(c *Config, checks []func(*Config) error) []error {
+	var problems []error
+	for _, check := range checks {
+		if err := check(c); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	return problems
+}
+
+// joinProblems reports problems as one error, nil if there are none
+func joinProblems(problems []error) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	messages := make([]string, len(problems))
+	for i, p := range problems {
+		messages[i] = p.Error()
+	}
+	return fmt.Errorf("%d problem(s): %s", len(problems), strings.Join(messages, "; "))
+}
+
+// isURL tells whether value is an absolute URL
+func isURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// checkWritable creates dir if needed and writes a file to it
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testEnvironment returns an environment the station starts with, writing
+// to temporary directories, with vars set on top
+func testEnvironment(t *testing.T, vars map[string]string) environment {
+	env := environment{vars: map[string]string{
+		"TEMP_FILES_DIR": t.TempDir(),
+		"STATE_DIR":      t.TempDir(),
+	}}
+	for key, value := range vars {
+		env.vars[key] = value
+	}
+	return env
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		vars map[string]string
+		// problems are the keys reported, nil for a valid configuration
+		problems []string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name:     "port out of range",
+			vars:     map[string]string{"DICOM_FINDSCU_PORT": "70000"},
+			problems: []string{"DICOM_FINDSCU_PORT"},
+		},
+		{
+			name: "every problem at once",
+			vars: map[string]string{
+				"DICOM_STORE_HOST":     " ",
+				"DICOM_LOCAL_AETITLE":  "THIS_AE_TITLE_IS_TOO_LONG",
+				"CONFIG_PROFILE":       "nope",
+				"SCANNER_JPEG_QUALITY": "0",
+			},
+			problems: []string{"DICOM_STORE_HOST", "DICOM_LOCAL_AETITLE", "CONFIG_PROFILE", "SCANNER_JPEG_QUALITY"},
+		},
+		{
+			name: "settings that go together",
+			vars: map[string]string{
+				"DICOM_TLS_CERT":  "/etc/station/cert.pem",
+				"OIDC_ISSUER":     "not a url",
+				"FAULT_INJECTION": "true",
+			},
+			problems: []string{"DICOM_TLS_CERT", "OIDC_ISSUER", "OIDC_CLIENT_ID", "OIDC_REDIRECT_URL", "FAULT_INJECTION"},
+		},
+		{
+			name:     "user header without proxies",
+			vars:     map[string]string{"TRUSTED_USER_HEADER": "X-Remote-User"},
+			problems: []string{"TRUSTED_USER_HEADER"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadConfig(testEnvironment(t, tt.vars), map[string]string{})
+			err := cfg.Validate()
+			if len(tt.problems) == 0 {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate accepted the configuration, want problems with %s", strings.Join(tt.problems, ", "))
+			}
+			message := err.Error()
+			for _, key := range tt.problems {
+				if !strings.Contains(message, key+": ") {
+					t.Errorf("Validate did not report %s: %s", key, message)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateReportsChecks(t *testing.T) {
+	cfg := loadConfig(testEnvironment(t, map[string]string{"SCANNER_JPEG_QUALITY": "0"}), map[string]string{})
+	err := cfg.Validate(
+		func(*Config) error { return nil },
+		func(*Config) error { return errors.New("DICOM_TAG_TEMPLATES: unreadable") },
+	)
+	if err == nil {
+		t.Fatal("Validate ignored the failing check")
+	}
+	want := "2 problem(s): SCANNER_JPEG_QUALITY: must be between 1 and 100; DICOM_TAG_TEMPLATES: unreadable"
+	if err.Error() != want {
+		t.Errorf("Validate = %q, want %q", err, want)
+	}
+}
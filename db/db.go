@@ -0,0 +1,101 @@
+// Package db opens the optional SQL database shared by subsystems that keep
+// their state in tables instead of files, and applies their schema
+// migrations. SQLite suits a single station; PostgreSQL lets several
+// stations share one database.
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"DICOMScanStation/config"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Supported database drivers
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// DB is an open database together with its SQL dialect
+type DB struct {
+	*sql.DB
+	Driver string
+}
+
+// Enabled reports whether a database is configured
+func Enabled(cfg *config.Config) bool {
+	return cfg.DatabaseDriver != ""
+}
+
+// Open connects to the configured database. SQLite defaults to a file in
+// the state directory.
+func Open(cfg *config.Config) (*DB, error) {
+	switch cfg.DatabaseDriver {
+	case DriverSQLite:
+		dsn := cfg.DatabaseURL
+		if dsn == "" {
+			dsn = filepath.Join(cfg.StateDir, "station.db")
+		}
+		return OpenSQLite(dsn)
+	case DriverPostgres:
+		if cfg.DatabaseURL == "" {
+			return nil, fmt.Errorf("DATABASE_URL is required for PostgreSQL")
+		}
+		return open(DriverPostgres, "postgres", cfg.DatabaseURL)
+	default:
+		return nil, fmt.Errorf("unknown database driver '%s' (use sqlite or postgres)", cfg.DatabaseDriver)
+	}
+}
+
+// OpenSQLite opens a SQLite database file, also for subsystems that keep
+// their tables locally without a configured database
+func OpenSQLite(dsn string) (*DB, error) {
+	// Writers wait for each other instead of failing with "database is
+	// locked"
+	if !strings.Contains(dsn, "?") {
+		dsn += "?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=on"
+	}
+	return open(DriverSQLite, "sqlite3", dsn)
+}
+
+func open(driver string, driverName string, dsn string) (*DB, error) {
+	sqlDB, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if driver == DriverSQLite {
+		// One writer at a time keeps SQLite from returning busy errors
+		sqlDB.SetMaxOpenConns(1)
+	}
+	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to connect to the %s database: %v", driver, err)
+	}
+	return &DB{DB: sqlDB, Driver: driver}, nil
+}
+
+// Rebind converts the ? placeholders of a query to the $n placeholders
+// PostgreSQL expects
+func (d *DB) Rebind(query string) string {
+	if d.Driver != DriverPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
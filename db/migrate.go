@@ -0,0 +1,119 @@
+package db
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// Migration is one schema change of a subsystem. Statements run in order in
+// one transaction; Postgres replaces them when the dialects differ.
+type Migration struct {
+	Version    int
+	Name       string
+	Statements []string
+	Postgres   []string
+}
+
+// Applied is a migration recorded in the database
+type Applied struct {
+	Component string    `json:"component"`
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	component TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (component, version)
+)`
+
+// Migrate applies the migrations of a component that are not yet recorded.
+// Stations sharing a PostgreSQL database serialize on an advisory lock, so
+// only one of them applies a migration.
+func (d *DB) Migrate(component string, migrations []Migration) error {
+	if _, err := d.Exec(createMigrationsTable); err != nil {
+		return fmt.Errorf("failed to create the migrations table: %v", err)
+	}
+
+	last := 0
+	for _, m := range migrations {
+		if m.Version <= last {
+			return fmt.Errorf("%s: migration versions must be ascending (%d after %d)", component, m.Version, last)
+		}
+		last = m.Version
+		if err := d.apply(component, m); err != nil {
+			return fmt.Errorf("%s: migration %d (%s) failed: %v", component, m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+func (d *DB) apply(component string, m Migration) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if d.Driver == DriverPostgres {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", lockKey(component)); err != nil {
+			return err
+		}
+	}
+
+	var applied int
+	err = tx.QueryRow(d.Rebind("SELECT COUNT(*) FROM schema_migrations WHERE component = ? AND version = ?"), component, m.Version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	statements := m.Statements
+	if d.Driver == DriverPostgres && m.Postgres != nil {
+		statements = m.Postgres
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(d.Rebind("INSERT INTO schema_migrations (component, version, name, applied_at) VALUES (?, ?, ?, ?)"),
+		component, m.Version, m.Name, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Migrations lists the applied migrations of all components
+func (d *DB) Migrations() ([]Applied, error) {
+	rows, err := d.Query("SELECT component, version, name, applied_at FROM schema_migrations ORDER BY component, version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []Applied
+	for rows.Next() {
+		var a Applied
+		if err := rows.Scan(&a.Component, &a.Version, &a.Name, &a.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+// lockKey derives the advisory lock of a component
+func lockKey(component string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("schema_migrations:" + component))
+	return int64(h.Sum64())
+}
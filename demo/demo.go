@@ -0,0 +1,168 @@
+// Package demo simulates the PACS in demo mode, for trade shows and
+// training without a network: patient queries answer with made-up
+// patients, and sent pages are removed from the workspace as if the PACS
+// had stored them.
+package demo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"DICOMScanStation/config"
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/logging"
+
+	"github.com/sirupsen/logrus"
+)
+
+var patients = []dicom.PatientInfo{
+	{PatientID: "DEMO0001", Name: "Mustermann Max", BirthDate: "19700101", Gender: "M"},
+	{PatientID: "DEMO0002", Name: "Musterfrau Erika", BirthDate: "19851224", Gender: "F"},
+}
+
+// studies by patient ID
+var studies = map[string][]dicom.StudyInfo{
+	"DEMO0001": {
+		{StudyInstanceUID: "2.25.1001", StudyDate: "20240312", StudyTime: "091500", Description: "Thorax pa", Modalities: []string{"CR"}, Instances: 2},
+		{StudyInstanceUID: "2.25.1002", StudyDate: "20230705", StudyTime: "143000", Description: "Befund extern", Modalities: []string{"OT"}, Instances: 3},
+	},
+}
+
+// series by study instance UID
+var series = map[string][]dicom.SeriesInfo{
+	"2.25.1001": {{SeriesInstanceUID: "2.25.1001.1", SeriesNumber: "1", Modality: "CR", Description: "Thorax pa", SeriesDate: "20240312", Instances: 2}},
+	"2.25.1002": {{SeriesInstanceUID: "2.25.1002.1", SeriesNumber: "1", Modality: "OT", Description: "Scanner imported document", SeriesDate: "20230705", Instances: 3}},
+}
+
+// PACS answers queries with the demo patients and accepts every page
+type PACS struct {
+	config *config.Config
+	logger *logrus.Logger
+}
+
+func NewPACS(cfg *config.Config) *PACS {
+	return &PACS{config: cfg, logger: logging.New()}
+}
+
+func (p *PACS) SearchPatients(searchTerm string, searchType string) ([]dicom.PatientInfo, error) {
+	return patients, nil
+}
+
+func (p *PACS) PatientStudies(patientID string) ([]dicom.StudyInfo, error) {
+	if found := studies[patientID]; found != nil {
+		return found, nil
+	}
+	return []dicom.StudyInfo{}, nil
+}
+
+func (p *PACS) StudySeries(patientID string, studyInstanceUID string) ([]dicom.SeriesInfo, error) {
+	if found := series[studyInstanceUID]; found != nil {
+		return found, nil
+	}
+	return []dicom.SeriesInfo{}, nil
+}
+
+// SendToPacs removes the pages like a successful send does, so the
+// workspace is ready for the next scan
+func (p *PACS) SendToPacs(req dicom.SendRequest) ([]dicom.FileProgress, error) {
+	files, err := p.pageFiles(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get JPG files: %v", err)
+	}
+
+	progress := make([]dicom.FileProgress, 0, len(files))
+	for _, file := range files {
+		entry := dicom.FileProgress{
+			Filename: filepath.Base(file),
+			Status:   "completed",
+			Message:  "Successfully uploaded to PACs and cleaned up",
+			Progress: 100,
+		}
+		if err := os.Remove(file); err != nil {
+			p.logger.Warnf("Demo PACS: Failed to clean up %s: %v", file, err)
+		}
+		progress = append(progress, entry)
+	}
+	if req.OnProgress != nil {
+		req.OnProgress(append([]dicom.FileProgress(nil), progress...))
+	}
+	p.logger.WithField(logging.FieldPatientID, req.Patient.PatientID).Infof("Demo PACS: Simulated sending %d page(s) of patient", len(files))
+	return progress, nil
+}
+
+// pageFiles returns the pages of req like the DICOM service picks them:
+// the listed files, or all pages of the source directory
+func (p *PACS) pageFiles(req dicom.SendRequest) ([]string, error) {
+	paths := req.FilePaths
+	if len(paths) == 0 {
+		dir := req.SourceDir
+		if dir == "" {
+			dir = p.config.TempFilesDir
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				paths = append(paths, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+
+	var files []string
+	for _, path := range paths {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".jpg", ".png":
+		default:
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+func (p *PACS) ListQuarantine() []dicom.Quarantine {
+	return nil
+}
+
+func (p *PACS) ResolveQuarantinedPage(id string, filename string, decision string) (*dicom.Quarantine, error) {
+	return nil, dicom.ErrQuarantineNotFound
+}
+
+func (p *PACS) ReleaseQuarantine(id string) ([]dicom.FileProgress, error) {
+	return nil, dicom.ErrQuarantineNotFound
+}
+
+func (p *PACS) DiscardQuarantine(id string) error {
+	return dicom.ErrQuarantineNotFound
+}
+
+func (p *PACS) ResendArchived(studyInstanceUID string) ([]dicom.FileProgress, error) {
+	return nil, fmt.Errorf("local archive is not enabled")
+}
+
+func (p *PACS) TagTemplates() map[string]map[string]string {
+	return map[string]map[string]string{}
+}
+
+// Echo reports both simulated systems as reachable
+func (p *PACS) Echo() []dicom.EchoResult {
+	var results []dicom.EchoResult
+	for _, role := range []string{"query", "store"} {
+		results = append(results, dicom.EchoResult{
+			Role:      role,
+			AETitle:   "DEMO",
+			Host:      "localhost",
+			Reachable: true,
+			Accepted:  true,
+			Success:   true,
+			Status:    "0x0000",
+		})
+	}
+	return results
+}
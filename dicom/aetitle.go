@@ -0,0 +1,19 @@
+package dicom
+
+import (
+	"strings"
+)
+
+// callingAETitle returns the override if set, otherwise the local AE title
+func (ds *DicomService) callingAETitle(override string) string {
+	if override = strings.TrimSpace(override); override != "" {
+		return override
+	}
+	return ds.cfg().DicomLocalAETitle
+}
+
+// institutionAETitle returns the calling AE title registered for an
+// institution, or "" if there is none
+func (ds *DicomService) institutionAETitle(institution string) string {
+	return ds.current().institutionAEs[strings.ToLower(strings.TrimSpace(institution))]
+}
@@ -0,0 +1,96 @@
+package dicom
+
+import (
+	"fmt"
+	"os"
+
+	"DICOMScanStation/archive"
+)
+
+// SetArchive enables keeping a local copy of every sent instance
+func (ds *DicomService) SetArchive(store *archive.Store) {
+	ds.archive = store
+}
+
+func (ds *DicomService) archiveInstance(req SendRequest, study StudyIdentifiers, dcmFile string, sopInstanceUID string) {
+	if ds.archive == nil {
+		return
+	}
+
+	meta := archive.Study{
+		StudyInstanceUID: study.StudyInstanceUID,
+		StudyID:          study.StudyID,
+		PatientID:        req.Patient.PatientID,
+		PatientName:      req.Patient.Name,
+		PatientBirthDate: req.Patient.BirthDate,
+		DocumentCreator:  req.DocumentCreator,
+		Description:      req.Description,
+	}
+	if err := ds.archive.AddInstance(meta, dcmFile, sopInstanceUID); err != nil {
+		// The instance already reached the PACS, a missing local copy is not fatal
+		ds.logger.Warnf("DICOM service: Failed to archive %s: %v", dcmFile, err)
+	}
+}
+
+// ResendArchived sends all archived instances of a study to the PACS again
+func (ds *DicomService) ResendArchived(studyInstanceUID string) ([]FileProgress, error) {
+	if ds.archive == nil {
+		return nil, fmt.Errorf("local archive is not enabled")
+	}
+
+	study, err := ds.archive.Get(studyInstanceUID)
+	if err != nil {
+		return nil, err
+	}
+
+	ds.logger.Infof("DICOM service: Re-sending archived study %s (%d instances)", studyInstanceUID, len(study.Instances))
+
+	dest := ds.storeDestination(study.DocumentCreator)
+	progress := make([]FileProgress, len(study.Instances))
+	for i, instance := range study.Instances {
+		progress[i] = FileProgress{
+			Filename:       instance.Filename,
+			Status:         "sending",
+			Message:        "Sending to PACs server...",
+			Progress:       80,
+			SOPInstanceUID: instance.SOPInstanceUID,
+		}
+
+		if err := ds.resendInstance(dest, studyInstanceUID, instance.Filename); err != nil {
+			ds.logger.Errorf("DICOM service: Failed to re-send %s: %v", instance.Filename, err)
+			progress[i].Status = "failed"
+			progress[i].Message = fmt.Sprintf("Upload failed: %v", err)
+			progress[i].Progress = 0
+			continue
+		}
+
+		progress[i].Status = "completed"
+		progress[i].Message = "Re-sent from local archive"
+		progress[i].Progress = 100
+	}
+
+	return progress, nil
+}
+
+// resendInstance sends an archived instance from a decompressed temporary
+// copy
+func (ds *DicomService) resendInstance(dest StoreDestination, studyInstanceUID string, filename string) error {
+	data, err := ds.archive.ReadInstance(studyInstanceUID, filename)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "resend-*.dcm")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return ds.sendDicomToPacs(dest, tmp.Name())
+}
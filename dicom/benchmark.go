@@ -0,0 +1,294 @@
+package dicom
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"DICOMScanStation/config"
+	"DICOMScanStation/dimse"
+)
+
+// BenchmarkPatientID marks the synthetic instances so they can be found and
+// deleted in the PACS
+const BenchmarkPatientID = "DSS-BENCHMARK"
+
+// Benchmark limits keep a run from flooding the PACS
+const (
+	maxBenchmarkInstances   = 500
+	maxBenchmarkConcurrency = 16
+	maxBenchmarkSizeKB      = 10240
+)
+
+// benchmarkSyntaxes maps the names accepted in a benchmark request to
+// transfer syntaxes
+var benchmarkSyntaxes = map[string]string{
+	"jpeg":     dimse.JPEGBaseline,
+	"explicit": dimse.ExplicitVRLittleEndian,
+	"implicit": dimse.ImplicitVRLittleEndian,
+}
+
+// BenchmarkRequest describes a synthetic batch sent to the store
+// destination. Every combination of concurrency and transfer syntax is one
+// run.
+type BenchmarkRequest struct {
+	Instances        int      `json:"instances"`
+	SizeKB           int      `json:"sizeKb"`
+	Concurrency      []int    `json:"concurrency"`
+	TransferSyntaxes []string `json:"transferSyntaxes"`
+	// CalledAETitle sends to a test AE on the store host, e.g. one that
+	// discards what it receives
+	CalledAETitle string `json:"calledAeTitle"`
+	// ConfirmStore allows sending to the PACS store AE, where the instances
+	// are kept until deleted
+	ConfirmStore bool `json:"confirmStore"`
+}
+
+// BenchmarkRun is the result of one combination
+type BenchmarkRun struct {
+	Concurrency        int      `json:"concurrency"`
+	TransferSyntax     string   `json:"transferSyntax"`
+	Instances          int      `json:"instances"`
+	Stored             int      `json:"stored"`
+	Failed             int      `json:"failed"`
+	InstanceBytes      int      `json:"instanceBytes"`
+	DurationMs         int64    `json:"durationMs"`
+	InstancesPerSecond float64  `json:"instancesPerSecond"`
+	MBPerSecond        float64  `json:"mbPerSecond"`
+	Errors             []string `json:"errors,omitempty"`
+}
+
+// BenchmarkReport lists all runs and the fastest one without failures
+type BenchmarkReport struct {
+	Destination string         `json:"destination"`
+	PatientID   string         `json:"patientId"`
+	Runs        []BenchmarkRun `json:"runs"`
+	Best        *BenchmarkRun  `json:"best,omitempty"`
+}
+
+// normalize applies the defaults and checks the limits
+func (r *BenchmarkRequest) normalize() error {
+	if r.CalledAETitle == "" && !r.ConfirmStore {
+		return fmt.Errorf("benchmark instances would be stored in the PACS: set calledAeTitle to a test AE or confirmStore")
+	}
+	if r.CalledAETitle != "" {
+		if err := config.ValidateAETitle(r.CalledAETitle); err != nil {
+			return err
+		}
+	}
+	if r.Instances == 0 {
+		r.Instances = 20
+	}
+	if r.Instances < 1 || r.Instances > maxBenchmarkInstances {
+		return fmt.Errorf("instances must be between 1 and %d", maxBenchmarkInstances)
+	}
+	if r.SizeKB == 0 {
+		r.SizeKB = 500
+	}
+	if r.SizeKB < 1 || r.SizeKB > maxBenchmarkSizeKB {
+		return fmt.Errorf("sizeKb must be between 1 and %d", maxBenchmarkSizeKB)
+	}
+	if len(r.Concurrency) == 0 {
+		r.Concurrency = []int{1, 2, 4}
+	}
+	for _, c := range r.Concurrency {
+		if c < 1 || c > maxBenchmarkConcurrency {
+			return fmt.Errorf("concurrency must be between 1 and %d", maxBenchmarkConcurrency)
+		}
+	}
+	if len(r.TransferSyntaxes) == 0 {
+		r.TransferSyntaxes = []string{"jpeg", "explicit"}
+	}
+	for _, ts := range r.TransferSyntaxes {
+		if _, ok := benchmarkSyntaxes[ts]; !ok {
+			return fmt.Errorf("unknown transfer syntax '%s' (use jpeg, explicit or implicit)", ts)
+		}
+	}
+	return nil
+}
+
+// Benchmark sends synthetic secondary capture instances with the built-in
+// DICOM client and measures the throughput of each run
+func (ds *DicomService) Benchmark(req BenchmarkRequest) (*BenchmarkReport, error) {
+	if err := req.normalize(); err != nil {
+		return nil, err
+	}
+
+	dest := ds.storeDestination("")
+	if req.CalledAETitle != "" {
+		dest.AETitle = req.CalledAETitle
+	}
+	report := &BenchmarkReport{
+		Destination: fmt.Sprintf("%s@%s:%d", dest.AETitle, dest.Host, dest.Port),
+		PatientID:   BenchmarkPatientID,
+	}
+	ds.logger.Infof("DICOM service: Benchmarking %s with %d instances of %d KB", report.Destination, req.Instances, req.SizeKB)
+
+	for _, name := range req.TransferSyntaxes {
+		pixels, err := benchmarkPixels(name, req.SizeKB)
+		if err != nil {
+			return nil, err
+		}
+		for _, concurrency := range req.Concurrency {
+			run := ds.benchmarkRun(dest, name, pixels, req.Instances, concurrency)
+			report.Runs = append(report.Runs, run)
+			if run.Failed == 0 && (report.Best == nil || run.InstancesPerSecond > report.Best.InstancesPerSecond) {
+				best := run
+				report.Best = &best
+			}
+		}
+	}
+	return report, nil
+}
+
+// benchmarkRun sends the instances over concurrency associations
+func (ds *DicomService) benchmarkRun(dest StoreDestination, syntax string, pixels benchmarkImage, instances int, concurrency int) BenchmarkRun {
+	if concurrency > instances {
+		concurrency = instances
+	}
+	ts := benchmarkSyntaxes[syntax]
+	run := BenchmarkRun{Concurrency: concurrency, TransferSyntax: syntax, Instances: instances}
+
+	uids := ds.current().uids
+	studyUID := uids.New()
+	seriesUID := uids.New()
+	files := make([]*dimse.File, instances)
+	for i := range files {
+		files[i] = benchmarkInstance(ts, pixels, studyUID, seriesUID, i+1)
+	}
+	run.InstanceBytes = len(files[0].DataSet)
+
+	var mu sync.Mutex
+	addError := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(run.Errors) < 5 {
+			run.Errors = append(run.Errors, err.Error())
+		}
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			var share []*dimse.File
+			for i := w; i < len(files); i += concurrency {
+				share = append(share, files[i])
+			}
+
+			assoc, err := dimse.Dial(net.JoinHostPort(dest.Host, strconv.Itoa(dest.Port)), dimse.Options{
+				CallingAETitle: dest.CallingAETitle,
+				CalledAETitle:  dest.AETitle,
+				Timeout:        associationTimeout,
+				TLS:            ds.current().tls,
+			}, []dimse.Proposal{{AbstractSyntax: secondaryCaptureStorage, TransferSyntaxes: []string{ts}}})
+			if err != nil {
+				addError(err)
+				mu.Lock()
+				run.Failed += len(share)
+				mu.Unlock()
+				return
+			}
+			defer assoc.Release()
+
+			for _, f := range share {
+				_, err := assoc.Store(f)
+				mu.Lock()
+				if err != nil {
+					run.Failed++
+				} else {
+					run.Stored++
+				}
+				mu.Unlock()
+				if err != nil {
+					addError(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	run.DurationMs = elapsed.Milliseconds()
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		run.InstancesPerSecond = math.Round(float64(run.Stored)/seconds*100) / 100
+		run.MBPerSecond = math.Round(float64(run.Stored*run.InstanceBytes)/seconds/(1<<20)*100) / 100
+	}
+	return run
+}
+
+// benchmarkImage is the pixel data shared by all instances of a run
+type benchmarkImage struct {
+	rows, columns int
+	data          []byte
+	jpeg          bool
+}
+
+// benchmarkPixels creates a grey noise image of about sizeKB, encoded as
+// JPEG for the jpeg syntax. Noise keeps the JPEG close to the raw size.
+func benchmarkPixels(syntax string, sizeKB int) (benchmarkImage, error) {
+	// An even side keeps the raw pixel data at even length
+	side := int(math.Sqrt(float64(sizeKB*1024))) &^ 1
+	if side < 8 {
+		side = 8
+	}
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	if _, err := rand.Read(img.Pix); err != nil {
+		return benchmarkImage{}, err
+	}
+
+	if syntax != "jpeg" {
+		return benchmarkImage{rows: side, columns: side, data: img.Pix}, nil
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		return benchmarkImage{}, err
+	}
+	return benchmarkImage{rows: side, columns: side, data: buf.Bytes(), jpeg: true}, nil
+}
+
+// benchmarkInstance builds a minimal secondary capture data set
+func benchmarkInstance(ts string, img benchmarkImage, studyUID, seriesUID string, number int) *dimse.File {
+	instanceUID := sopInstanceUID(seriesUID, number)
+	elements := []dimse.Element{
+		dimse.String(dimse.Tag(0x0008, 0x0016), "UI", secondaryCaptureStorage),
+		dimse.String(dimse.Tag(0x0008, 0x0018), "UI", instanceUID),
+		dimse.String(dimse.Tag(0x0008, 0x0060), "CS", "OT"),
+		dimse.String(dimse.Tag(0x0008, 0x0064), "CS", "WSD"),
+		dimse.String(dimse.Tag(0x0008, 0x103E), "LO", "Send benchmark"),
+		dimse.String(dimse.Tag(0x0010, 0x0010), "PN", "BENCHMARK^DICOMSCANSTATION"),
+		dimse.String(dimse.Tag(0x0010, 0x0020), "LO", BenchmarkPatientID),
+		dimse.String(dimse.Tag(0x0020, 0x000D), "UI", studyUID),
+		dimse.String(dimse.Tag(0x0020, 0x000E), "UI", seriesUID),
+		dimse.String(dimse.Tag(0x0020, 0x0013), "IS", strconv.Itoa(number)),
+		dimse.US(dimse.Tag(0x0028, 0x0002), 1),
+		dimse.String(dimse.Tag(0x0028, 0x0004), "CS", "MONOCHROME2"),
+		dimse.US(dimse.Tag(0x0028, 0x0010), uint16(img.rows)),
+		dimse.US(dimse.Tag(0x0028, 0x0011), uint16(img.columns)),
+		dimse.US(dimse.Tag(0x0028, 0x0100), 8),
+		dimse.US(dimse.Tag(0x0028, 0x0101), 8),
+		dimse.US(dimse.Tag(0x0028, 0x0102), 7),
+		dimse.US(dimse.Tag(0x0028, 0x0103), 0),
+	}
+	pixelData := dimse.Element{Tag: dimse.Tag(0x7FE0, 0x0010), VR: "OB", Value: img.data}
+	if img.jpeg {
+		pixelData.Fragments = [][]byte{img.data}
+	}
+	elements = append(elements, pixelData)
+
+	return &dimse.File{
+		SOPClassUID:       secondaryCaptureStorage,
+		SOPInstanceUID:    instanceUID,
+		TransferSyntaxUID: ts,
+		DataSet:           dimse.EncodeDataSet(elements, ts != dimse.ImplicitVRLittleEndian),
+	}
+}
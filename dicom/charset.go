@@ -0,0 +1,155 @@
+package dicom
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"DICOMScanStation/dimse"
+)
+
+// Character sets of text values (Specific Character Set, PS3.3 C.12.1.1.2)
+const (
+	// CharacterSetASCII is the default repertoire; other characters are
+	// replaced by "?"
+	CharacterSetASCII = "ISO_IR 6"
+	// CharacterSetLatin1 covers Western European names including umlauts
+	CharacterSetLatin1 = "ISO_IR 100"
+	// CharacterSetUTF8 covers all names
+	CharacterSetUTF8 = "ISO_IR 192"
+)
+
+var tagSpecificCharacterSet = dimse.Tag(0x0008, 0x0005)
+
+// textVRs are the VRs whose values are encoded in the Specific Character
+// Set; all others are ASCII
+var textVRs = map[string]bool{
+	"SH": true, "LO": true, "ST": true, "LT": true, "PN": true, "UC": true, "UT": true,
+}
+
+// implicitTextTags are the text attributes of query responses, whose VR is
+// not transmitted in implicit VR
+var implicitTextTags = map[uint32]bool{
+	tagPatientName:       true,
+	tagPatientID:         true,
+	tagStudyDescription:  true,
+	tagAccessionNumber:   true,
+	tagStudyID:           true,
+	tagSeriesDescription: true,
+}
+
+// ValidCharacterSet reports whether name is a supported character set
+func ValidCharacterSet(name string) bool {
+	switch normalizeCharacterSet(name) {
+	case CharacterSetASCII, CharacterSetLatin1, CharacterSetUTF8:
+		return true
+	}
+	return false
+}
+
+// normalizeCharacterSet maps an empty setting to UTF-8 and accepts the
+// defined terms in any case
+func normalizeCharacterSet(name string) string {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "" {
+		return CharacterSetUTF8
+	}
+	return name
+}
+
+// characterSet returns the configured character set of outgoing objects
+// and queries
+func (ds *DicomService) characterSet() string {
+	return normalizeCharacterSet(ds.cfg().DicomCharacterSet)
+}
+
+// withCharacterSet encodes the text values of the elements in the
+// configured character set and declares it. The default repertoire is
+// declared by omitting Specific Character Set.
+func (ds *DicomService) withCharacterSet(elements []dimse.Element) []dimse.Element {
+	cs := ds.characterSet()
+	encoded := encodeElements(cs, elements)
+	if cs == CharacterSetASCII {
+		return encoded
+	}
+	return append(encoded, dimse.String(tagSpecificCharacterSet, "CS", cs))
+}
+
+// encodeElements returns the elements with their text values, also those
+// in sequence items, encoded in cs
+func encodeElements(cs string, elements []dimse.Element) []dimse.Element {
+	encoded := make([]dimse.Element, len(elements))
+	for i, e := range elements {
+		switch {
+		case e.Items != nil:
+			items := make([][]dimse.Element, len(e.Items))
+			for j, item := range e.Items {
+				items[j] = encodeElements(cs, item)
+			}
+			e.Items = items
+		case textVRs[e.VR] && e.Value != nil:
+			value := strings.TrimRight(string(e.Value), " ")
+			e = dimse.String(e.Tag, e.VR, string(encodeText(cs, value)))
+		}
+		encoded[i] = e
+	}
+	return encoded
+}
+
+// encodeText converts s to the bytes of cs; characters cs cannot represent
+// are replaced by "?"
+func encodeText(cs string, s string) []byte {
+	var limit rune
+	switch cs {
+	case CharacterSetLatin1:
+		limit = 0xFF
+	case CharacterSetASCII:
+		limit = 0x7F
+	default:
+		return []byte(s)
+	}
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > limit {
+			r = '?'
+		}
+		b = append(b, byte(r))
+	}
+	return b
+}
+
+// decodeText converts a value in cs to UTF-8. Values that are not valid
+// UTF-8 are read as Latin-1 unless declared otherwise, as archives often
+// store Latin-1 without declaring it.
+func decodeText(cs string, b []byte) string {
+	switch cs {
+	case CharacterSetLatin1, "ISO 2022 IR 100":
+	default:
+		if utf8.Valid(b) {
+			return string(b)
+		}
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// decodeResponse converts the text values of a query response to UTF-8,
+// in the character set it declares or else the configured one
+func (ds *DicomService) decodeResponse(response dimse.DataSet) dimse.DataSet {
+	cs := ds.characterSet()
+	if declared := response.Text(tagSpecificCharacterSet); declared != "" {
+		// With code extensions the first value is the default repertoire
+		values := strings.Split(declared, `\`)
+		cs = normalizeCharacterSet(values[len(values)-1])
+	}
+	decoded := make(dimse.DataSet, len(response))
+	for tag, e := range response {
+		if textVRs[e.VR] || (e.VR == "" && implicitTextTags[tag]) {
+			e.Value = []byte(decodeText(cs, e.Value))
+		}
+		decoded[tag] = e
+	}
+	return decoded
+}
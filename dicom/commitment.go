@@ -0,0 +1,210 @@
+package dicom
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"DICOMScanStation/dimse"
+)
+
+// Storage commitment states of an instance in the upload progress
+const (
+	CommitmentCommitted = "committed"
+	// CommitmentFailed means the PACS reported it could not commit the
+	// instance
+	CommitmentFailed = "failed"
+	// CommitmentPending means no report arrived within
+	// DICOM_COMMITMENT_TIMEOUT
+	CommitmentPending = "pending"
+	// CommitmentError means the commitment request itself failed
+	CommitmentError = "error"
+)
+
+// commitmentWaiters hands reports received by the listener to the sends
+// waiting for them, keyed by transaction UID
+type commitmentWaiters struct {
+	mu      sync.Mutex
+	waiting map[string]chan *dimse.CommitReport
+}
+
+func (w *commitmentWaiters) add(transactionUID string) chan *dimse.CommitReport {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.waiting == nil {
+		w.waiting = make(map[string]chan *dimse.CommitReport)
+	}
+	ch := make(chan *dimse.CommitReport, 1)
+	w.waiting[transactionUID] = ch
+	return ch
+}
+
+func (w *commitmentWaiters) remove(transactionUID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.waiting, transactionUID)
+}
+
+// deliver passes the report to its waiting send; it reports false if no
+// send waits for the transaction any more
+func (w *commitmentWaiters) deliver(report *dimse.CommitReport) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ch, ok := w.waiting[report.TransactionUID]
+	if !ok {
+		return false
+	}
+	delete(w.waiting, report.TransactionUID)
+	ch <- report
+	return true
+}
+
+// StartCommitmentListener accepts the associations the PACS opens to
+// report storage commitment results on DICOM_COMMITMENT_PORT. Without the
+// listener reports are only accepted on the association of the request.
+func (ds *DicomService) StartCommitmentListener() error {
+	var tlsConfig *tls.Config
+	if clientTLS := ds.current().tls; clientTLS != nil {
+		tlsConfig = listenerTLSConfig(clientTLS)
+	}
+	l, err := dimse.Listen(fmt.Sprintf(":%d", ds.cfg().DicomCommitmentPort), dimse.ListenOptions{
+		Timeout: associationTimeout,
+		TLS:     tlsConfig,
+	}, ds.commitmentReceived, func(format string, args ...interface{}) {
+		ds.logger.Warnf("DICOM service: Storage commitment listener: "+format, args...)
+	})
+	if err != nil {
+		return err
+	}
+	ds.commitListener = l
+	return nil
+}
+
+// listenerTLSConfig derives the server configuration of the commitment
+// listener from the client configuration: the station presents its
+// certificate and, with DICOM_TLS_CA, requires one of the PACS
+func listenerTLSConfig(client *tls.Config) *tls.Config {
+	server := &tls.Config{
+		Certificates: client.Certificates,
+		MinVersion:   client.MinVersion,
+		CipherSuites: client.CipherSuites,
+	}
+	if client.RootCAs != nil {
+		server.ClientCAs = client.RootCAs
+		server.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return server
+}
+
+func (ds *DicomService) commitmentReceived(report *dimse.CommitReport) {
+	if !ds.commitments.deliver(report) {
+		ds.logger.Warnf("DICOM service: Storage commitment report for transaction %s arrived after the send finished: %d committed, %d failed",
+			report.TransactionUID, len(report.Committed), len(report.Failed))
+		for _, f := range report.Failed {
+			ds.logger.Errorf("DICOM service: PACS did not commit %s: %s", f.SOPInstanceUID, f.ReasonText())
+		}
+	}
+}
+
+// commitInstances asks the PACS to commit the stored instances and records
+// the outcome per instance in the progress
+func (ds *DicomService) commitInstances(dest StoreDestination, refs []dimse.CommitReference, progress []FileProgress) {
+	timeout := time.Duration(ds.cfg().DicomCommitmentTimeout) * time.Second
+	transactionUID := ds.current().uids.New()
+	ds.logger.Infof("DICOM service: Requesting storage commitment of %d instance(s), transaction %s", len(refs), transactionUID)
+
+	report, err := ds.requestCommitment(dest, transactionUID, refs, timeout)
+	states := make(map[string]string)
+	messages := make(map[string]string)
+	switch {
+	case err != nil:
+		ds.logger.Errorf("DICOM service: Storage commitment request failed: %v", err)
+		for _, ref := range refs {
+			states[ref.SOPInstanceUID] = CommitmentError
+			messages[ref.SOPInstanceUID] = fmt.Sprintf("Uploaded, but the storage commitment request failed: %v", err)
+		}
+	case report == nil:
+		ds.logger.Warnf("DICOM service: No storage commitment report for transaction %s within %s", transactionUID, timeout)
+		for _, ref := range refs {
+			states[ref.SOPInstanceUID] = CommitmentPending
+			messages[ref.SOPInstanceUID] = fmt.Sprintf("Uploaded, commitment not confirmed within %d seconds", ds.cfg().DicomCommitmentTimeout)
+		}
+	default:
+		for _, ref := range refs {
+			states[ref.SOPInstanceUID] = CommitmentPending
+			messages[ref.SOPInstanceUID] = "Uploaded, but the PACS did not report on the instance"
+		}
+		for _, ref := range report.Committed {
+			states[ref.SOPInstanceUID] = CommitmentCommitted
+			messages[ref.SOPInstanceUID] = "Uploaded and committed by the PACS"
+		}
+		for _, f := range report.Failed {
+			ds.logger.Errorf("DICOM service: PACS did not commit %s: %s", f.SOPInstanceUID, f.ReasonText())
+			states[f.SOPInstanceUID] = CommitmentFailed
+			messages[f.SOPInstanceUID] = fmt.Sprintf("Uploaded, but the PACS did not commit the instance: %s", f.ReasonText())
+		}
+		ds.logger.Infof("DICOM service: Storage commitment %s: %d committed, %d failed", transactionUID, len(report.Committed), len(report.Failed))
+	}
+
+	for i := range progress {
+		if state, ok := states[progress[i].SOPInstanceUID]; ok {
+			progress[i].Commitment = state
+			progress[i].Message = messages[progress[i].SOPInstanceUID]
+		}
+	}
+}
+
+// requestCommitment sends the N-ACTION request and waits for the report,
+// on the listener if it runs and on the request association otherwise. A
+// nil report without error means none arrived in time.
+func (ds *DicomService) requestCommitment(dest StoreDestination, transactionUID string, refs []dimse.CommitReference, timeout time.Duration) (*dimse.CommitReport, error) {
+	// The report may arrive on the listener before the N-ACTION response
+	var received chan *dimse.CommitReport
+	if ds.commitListener != nil {
+		received = ds.commitments.add(transactionUID)
+		defer ds.commitments.remove(transactionUID)
+	}
+
+	assoc, err := dimse.Dial(net.JoinHostPort(dest.Host, strconv.Itoa(dest.Port)), dimse.Options{
+		CallingAETitle: dest.CallingAETitle,
+		CalledAETitle:  dest.AETitle,
+		Timeout:        associationTimeout,
+		TLS:            ds.current().tls,
+	}, []dimse.Proposal{{
+		AbstractSyntax:   dimse.StorageCommitment,
+		TransferSyntaxes: []string{dimse.ExplicitVRLittleEndian, dimse.ImplicitVRLittleEndian},
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("association with %s@%s:%d failed: %v", dest.AETitle, dest.Host, dest.Port, err)
+	}
+	if err := assoc.RequestCommitment(transactionUID, refs); err != nil {
+		assoc.Release()
+		return nil, fmt.Errorf("N-ACTION failed: %v", err)
+	}
+
+	if received == nil {
+		report, err := assoc.WaitCommitment(timeout)
+		assoc.Release()
+		if errors.Is(err, dimse.ErrNoReport) {
+			return nil, nil
+		}
+		if err == nil && report.TransactionUID != transactionUID {
+			return nil, fmt.Errorf("report for transaction %s instead of %s", report.TransactionUID, transactionUID)
+		}
+		return report, err
+	}
+
+	// The PACS reports on an association of its own once this one is
+	// released
+	assoc.Release()
+	select {
+	case report := <-received:
+		return report, nil
+	case <-time.After(timeout):
+		return nil, nil
+	}
+}
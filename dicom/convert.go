@@ -0,0 +1,239 @@
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"time"
+
+	"DICOMScanStation/colorprofile"
+	"DICOMScanStation/dimse"
+)
+
+// JPEG markers read when deciding whether a scan can be encapsulated as it is
+const (
+	markerSOF0 = 0xC0 // baseline
+	markerSOS  = 0xDA
+	markerEOI  = 0xD9
+)
+
+// maxImageSide is the largest number of rows or columns (US) an image may have
+const maxImageSide = 65535
+
+// jpegFrame is the frame header of a JPEG file
+type jpegFrame struct {
+	marker     byte
+	precision  byte
+	components int
+	// subsampled is set if the chroma components have fewer samples than
+	// the luminance
+	subsampled bool
+}
+
+// readJPEGFrame finds the start of frame marker of a JPEG file
+func readJPEGFrame(data []byte) (jpegFrame, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return jpegFrame{}, fmt.Errorf("not a JPEG file")
+	}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return jpegFrame{}, fmt.Errorf("invalid JPEG marker at offset %d", pos)
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++ // fill byte
+			continue
+		}
+		if marker == markerSOS || marker == markerEOI {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		segment := data[pos+4:]
+		if length < 2 || len(segment) < length-2 {
+			return jpegFrame{}, fmt.Errorf("truncated JPEG segment")
+		}
+		segment = segment[:length-2]
+
+		// SOF0 to SOF15, except DHT (C4), JPG (C8) and DAC (CC)
+		if marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC {
+			if len(segment) < 6 {
+				return jpegFrame{}, fmt.Errorf("truncated JPEG frame header")
+			}
+			frame := jpegFrame{marker: marker, precision: segment[0], components: int(segment[5])}
+			if frame.components == 3 && len(segment) >= 6+3*3 {
+				luma := segment[7]
+				for c := 1; c < 3; c++ {
+					if segment[7+3*c] != luma {
+						frame.subsampled = true
+					}
+				}
+			}
+			return frame, nil
+		}
+		pos += 2 + length
+	}
+	return jpegFrame{}, fmt.Errorf("JPEG file without frame header")
+}
+
+// convertImage builds a Secondary Capture instance from a scanned page.
+// Baseline JPEGs are encapsulated as they are; other images, e.g. lossless
+// PNG scans, are stored uncompressed. Patient and study attributes are
+// placeholders until the page is tagged.
+func convertImage(imageFile string) (*dimse.File, error) {
+	data, err := os.ReadFile(imageFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", filepath.Base(imageFile), err)
+	}
+	if config.Width > maxImageSide || config.Height > maxImageSide {
+		return nil, fmt.Errorf("%s is %dx%d pixels, DICOM allows at most %d per side", filepath.Base(imageFile), config.Width, config.Height, maxImageSide)
+	}
+
+	var pixels []dimse.Element
+	ts := dimse.ExplicitVRLittleEndian
+	if frame, err := readJPEGFrame(data); err == nil && frame.marker == markerSOF0 && frame.precision == 8 && (frame.components == 1 || frame.components == 3) {
+		pixels = encapsulatedPixels(data, config, frame)
+		ts = dimse.JPEGBaseline
+	} else {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %v", filepath.Base(imageFile), err)
+		}
+		pixels = nativePixels(img)
+	}
+
+	if profile, err := colorprofile.Extract(imageFile); err == nil && len(profile) > 0 {
+		// OB values must have an even length
+		if len(profile)%2 == 1 {
+			profile = append(profile, 0)
+		}
+		pixels = append(pixels, dimse.Element{Tag: dimse.Tag(0x0028, 0x2000), VR: "OB", Value: profile})
+	}
+
+	now := time.Now()
+	date, clock := now.Format("20060102"), now.Format("150405")
+	instanceUID := newUID()
+	elements := []dimse.Element{
+		dimse.String(dimse.Tag(0x0008, 0x0012), "DA", date), // Instance Creation Date
+		dimse.String(dimse.Tag(0x0008, 0x0013), "TM", clock),
+		dimse.String(dimse.Tag(0x0008, 0x0016), "UI", secondaryCaptureStorage),
+		dimse.String(dimse.Tag(0x0008, 0x0018), "UI", instanceUID),
+		dimse.String(dimse.Tag(0x0008, 0x0020), "DA", date), // Study Date
+		dimse.String(dimse.Tag(0x0008, 0x0023), "DA", date), // Content Date
+		dimse.String(dimse.Tag(0x0008, 0x0030), "TM", clock),
+		dimse.String(dimse.Tag(0x0008, 0x0033), "TM", clock),
+		dimse.String(dimse.Tag(0x0008, 0x0050), "SH", ""), // Accession Number
+		dimse.String(dimse.Tag(0x0008, 0x0060), "CS", "OT"),
+		dimse.String(dimse.Tag(0x0008, 0x0064), "CS", "WSD"), // Workstation
+		dimse.String(dimse.Tag(0x0008, 0x0090), "PN", ""),    // Referring Physician
+		dimse.String(dimse.Tag(0x0010, 0x0010), "PN", ""),
+		dimse.String(dimse.Tag(0x0010, 0x0020), "LO", ""),
+		dimse.String(dimse.Tag(0x0010, 0x0030), "DA", ""),
+		dimse.String(dimse.Tag(0x0010, 0x0040), "CS", ""),
+		dimse.String(dimse.Tag(0x0020, 0x000D), "UI", newUID()),
+		dimse.String(dimse.Tag(0x0020, 0x000E), "UI", newUID()),
+		dimse.String(dimse.Tag(0x0020, 0x0010), "SH", ""),
+		dimse.String(dimse.Tag(0x0020, 0x0011), "IS", "1"), // Series Number
+		dimse.String(dimse.Tag(0x0020, 0x0013), "IS", "1"),
+		dimse.String(dimse.Tag(0x0020, 0x0020), "CS", ""),    // Patient Orientation
+		dimse.String(dimse.Tag(0x0028, 0x0301), "CS", "YES"), // Burned In Annotation
+	}
+	elements = append(elements, pixels...)
+
+	return &dimse.File{
+		SOPClassUID:       secondaryCaptureStorage,
+		SOPInstanceUID:    instanceUID,
+		TransferSyntaxUID: ts,
+		DataSet:           dimse.EncodeDataSet(elements, true),
+	}, nil
+}
+
+// encapsulatedPixels describes a baseline JPEG stored as a single fragment
+func encapsulatedPixels(data []byte, config image.Config, frame jpegFrame) []dimse.Element {
+	photometric := "MONOCHROME2"
+	if frame.components == 3 {
+		photometric = "YBR_FULL"
+		if frame.subsampled {
+			photometric = "YBR_FULL_422"
+		}
+	}
+	elements := pixelModule(config.Height, config.Width, frame.components, 8, photometric)
+	return append(elements,
+		dimse.String(dimse.Tag(0x0028, 0x2110), "CS", "01"), // Lossy Image Compression
+		dimse.Element{Tag: dimse.Tag(0x7FE0, 0x0010), VR: "OB", Fragments: [][]byte{data}},
+	)
+}
+
+// nativePixels stores an image uncompressed: greyscale scans as MONOCHROME2
+// with 8 or 16 bits, everything else as 8 bit RGB
+func nativePixels(img image.Image) []dimse.Element {
+	b := img.Bounds()
+	rows, columns := b.Dy(), b.Dx()
+
+	var data []byte
+	var elements []dimse.Element
+	vr := "OB"
+	switch img.ColorModel() {
+	case color.GrayModel:
+		data = make([]byte, 0, rows*columns)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				data = append(data, color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+			}
+		}
+		elements = pixelModule(rows, columns, 1, 8, "MONOCHROME2")
+	case color.Gray16Model:
+		data = make([]byte, 0, rows*columns*2)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				data = binary.LittleEndian.AppendUint16(data, color.Gray16Model.Convert(img.At(x, y)).(color.Gray16).Y)
+			}
+		}
+		elements = pixelModule(rows, columns, 1, 16, "MONOCHROME2")
+		vr = "OW"
+	default:
+		data = make([]byte, 0, rows*columns*3)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, g, bl, _ := img.At(x, y).RGBA()
+				data = append(data, byte(r>>8), byte(g>>8), byte(bl>>8))
+			}
+		}
+		elements = pixelModule(rows, columns, 3, 8, "RGB")
+	}
+
+	// Pixel data must have an even length
+	if len(data)%2 == 1 {
+		data = append(data, 0)
+	}
+	return append(elements, dimse.Element{Tag: dimse.Tag(0x7FE0, 0x0010), VR: vr, Value: data})
+}
+
+// pixelModule returns the Image Pixel attributes
+func pixelModule(rows, columns, samples, bits int, photometric string) []dimse.Element {
+	elements := []dimse.Element{
+		dimse.US(dimse.Tag(0x0028, 0x0002), uint16(samples)),
+		dimse.String(dimse.Tag(0x0028, 0x0004), "CS", photometric),
+		dimse.US(dimse.Tag(0x0028, 0x0010), uint16(rows)),
+		dimse.US(dimse.Tag(0x0028, 0x0011), uint16(columns)),
+		dimse.US(dimse.Tag(0x0028, 0x0100), uint16(bits)),
+		dimse.US(dimse.Tag(0x0028, 0x0101), uint16(bits)),
+		dimse.US(dimse.Tag(0x0028, 0x0102), uint16(bits-1)),
+		dimse.US(dimse.Tag(0x0028, 0x0103), 0),
+	}
+	if samples > 1 {
+		elements = append(elements, dimse.US(dimse.Tag(0x0028, 0x0006), 0)) // Planar Configuration
+	}
+	return elements
+}
@@ -0,0 +1,156 @@
+package dicom
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"DICOMScanStation/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Send formats: every page as a Secondary Capture image, all pages of a
+// study as one Encapsulated PDF document, or as one multi-frame Secondary
+// Capture image
+const (
+	SendFormatImages     = "images"
+	SendFormatPDF        = "pdf"
+	SendFormatMultiframe = "multiframe"
+)
+
+// ValidSendFormat reports whether format is a known send format
+func ValidSendFormat(format string) bool {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", SendFormatImages, SendFormatPDF, SendFormatMultiframe:
+		return true
+	}
+	return false
+}
+
+// sendFormat returns the format of req, falling back to DICOM_SEND_FORMAT
+func (ds *DicomService) sendFormat(req SendRequest) string {
+	format := strings.ToLower(strings.TrimSpace(req.Format))
+	if format == "" {
+		format = strings.ToLower(strings.TrimSpace(ds.cfg().DicomSendFormat))
+	}
+	switch format {
+	case SendFormatPDF, SendFormatMultiframe:
+		return format
+	}
+	return SendFormatImages
+}
+
+// documentPage is a scanned page combined with others into one instance
+type documentPage struct {
+	index int
+	file  string
+}
+
+// prepareDocument combines the pages into one Encapsulated PDF or
+// multi-frame instance and tags it. Pages that cannot be read fail on their
+// own; if the instance cannot be written, every page fails.
+func (ds *DicomService) prepareDocument(req SendRequest, study StudyIdentifiers, jpgFiles []string, format string) ([]preparedFile, []FileProgress, []QuarantinedPage) {
+	check, convert, kind := checkFramePage, ds.convertPagesToMultiframe, "multi-frame image"
+	if format == SendFormatPDF {
+		check, convert, kind = checkPDFPage, ds.convertPagesToPDF, "PDF document"
+	}
+
+	progress := make([]FileProgress, len(jpgFiles))
+	var pages []documentPage
+	var failedPages []QuarantinedPage
+	for i, jpgFile := range jpgFiles {
+		filename := filepath.Base(jpgFile)
+		progress[i] = FileProgress{
+			Filename: filename,
+			Status:   "converting",
+			Message:  fmt.Sprintf("Adding page to the %s...", kind),
+			Progress: 20,
+		}
+		req.reportProgress(progress)
+		if err := check(jpgFile); err != nil {
+			ds.logger.Errorf("DICOM service: Failed to add %s to the %s: %v", jpgFile, kind, err)
+			progress[i].Status = "failed"
+			progress[i].Message = fmt.Sprintf("Conversion failed: %v", err)
+			progress[i].Progress = 0
+			failedPages = append(failedPages, QuarantinedPage{Filename: filename, Reason: progress[i].Message})
+			req.reportProgress(progress)
+			continue
+		}
+		pages = append(pages, documentPage{index: i, file: jpgFile})
+	}
+	if len(pages) == 0 {
+		return nil, progress, failedPages
+	}
+
+	fail := func(message string) ([]preparedFile, []FileProgress, []QuarantinedPage) {
+		for _, page := range pages {
+			progress[page.index].Status = "failed"
+			progress[page.index].Message = message
+			progress[page.index].Progress = 0
+			failedPages = append(failedPages, QuarantinedPage{Filename: progress[page.index].Filename, Reason: message})
+		}
+		req.reportProgress(progress)
+		return nil, progress, failedPages
+	}
+
+	var files []string
+	for _, page := range pages {
+		files = append(files, page.file)
+	}
+	_, span := tracing.Start(req.Trace, "convert document",
+		attribute.String("send.format", format),
+		attribute.Int("send.pages", len(files)))
+	dcmFile, err := convert(files, req, study)
+	tracing.End(span, err)
+	if err != nil {
+		ds.logger.Errorf("DICOM service: Failed to write the %s: %v", kind, err)
+		return fail(fmt.Sprintf("Conversion failed: %v", err))
+	}
+
+	first := pages[0].index
+	var text string
+	if ds.ocr != nil {
+		progress[first].Message = "Recognizing text..."
+		progress[first].Progress = 35
+		req.reportProgress(progress)
+		_, span := tracing.Start(req.Trace, "recognize text", attribute.Int("send.pages", len(files)))
+		text = ds.recognizeText(files)
+		span.End()
+	}
+
+	progress[first].Status = "updating"
+	progress[first].Message = "Updating DICOM with patient data..."
+	progress[first].Progress = 50
+	req.reportProgress(progress)
+	_, span = tracing.Start(req.Trace, "update tags", attribute.String("dicom.sop_instance_uid", sopInstanceUID(study.SeriesInstanceUID, 1)))
+	err = ds.updateDicomWithPatientData(dcmFile, req.Patient, req.DocumentCreator, req.Description, study, 1, text)
+	tracing.End(span, err)
+	if err != nil {
+		ds.logger.Errorf("DICOM service: Failed to update DICOM file %s: %v", dcmFile, err)
+		os.Remove(dcmFile)
+		return fail(fmt.Sprintf("Update failed: %v", err))
+	}
+	progress[first].SOPInstanceUID = sopInstanceUID(study.SeriesInstanceUID, 1)
+
+	return []preparedFile{{index: first, jpgFile: pages[0].file, dcmFile: dcmFile, pages: pages[1:]}}, progress, failedPages
+}
+
+// mirrorDocumentProgress copies the progress of an instance holding several
+// pages, kept on its first page, to its further pages
+func mirrorDocumentProgress(prepared []preparedFile, progress []FileProgress) {
+	for _, p := range prepared {
+		for _, page := range p.pages {
+			filename := progress[page.index].Filename
+			progress[page.index] = progress[p.index]
+			progress[page.index].Filename = filename
+		}
+	}
+}
+
+// documentFile returns the name of an instance combining the pages
+func documentFile(pages []string) string {
+	return filepath.Join(filepath.Dir(pages[0]), fmt.Sprintf("document-%s.dcm", time.Now().Format("20060102150405")))
+}
@@ -0,0 +1,106 @@
+package dicom
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"DICOMScanStation/dimse"
+)
+
+// StudyMatch is an existing study that looks like the one about to be sent
+type StudyMatch struct {
+	StudyInstanceUID string `json:"studyInstanceUid"`
+	StudyDate        string `json:"studyDate"`
+	StudyTime        string `json:"studyTime"`
+	StudyDescription string `json:"studyDescription"`
+	Source           string `json:"source"` // "pacs" or "archive"
+}
+
+// DuplicateStudyError is returned by SendToPacs when a likely duplicate
+// exists and the request was not forced
+type DuplicateStudyError struct {
+	Matches []StudyMatch
+}
+
+func (e *DuplicateStudyError) Error() string {
+	return fmt.Sprintf("%d similar study(s) already exist for this patient today", len(e.Matches))
+}
+
+// FindDuplicateStudies looks for studies of the same patient with the same
+// description from today, both on the PACS and in the local archive
+func (ds *DicomService) FindDuplicateStudies(req SendRequest) ([]StudyMatch, error) {
+	today := time.Now().Format("20060102")
+
+	matches, err := ds.findStudies(req.Patient.PatientID, today)
+	if err != nil {
+		return nil, err
+	}
+
+	var duplicates []StudyMatch
+	seen := make(map[string]bool)
+	for _, m := range matches {
+		if sameDescription(m.StudyDescription, req.Description) {
+			duplicates = append(duplicates, m)
+			seen[m.StudyInstanceUID] = true
+		}
+	}
+
+	if ds.archive != nil {
+		studies, err := ds.archive.List()
+		if err != nil {
+			ds.logger.Warnf("DICOM service: Duplicate check could not read the archive: %v", err)
+		}
+		for _, study := range studies {
+			if study.PatientID != req.Patient.PatientID || study.ArchivedAt.Format("20060102") != today {
+				continue
+			}
+			if seen[study.StudyInstanceUID] || !sameDescription(study.Description, req.Description) {
+				continue
+			}
+			duplicates = append(duplicates, StudyMatch{
+				StudyInstanceUID: study.StudyInstanceUID,
+				StudyDate:        study.ArchivedAt.Format("20060102"),
+				StudyTime:        study.ArchivedAt.Format("150405"),
+				StudyDescription: study.Description,
+				Source:           "archive",
+			})
+		}
+	}
+
+	return duplicates, nil
+}
+
+// findStudies runs a study level C-FIND for a patient and study date
+func (ds *DicomService) findStudies(patientID string, studyDate string) ([]StudyMatch, error) {
+	dest := ds.queryDestination()
+	responses, err := ds.find(dest, dest.studyQueryKeys(patientID,
+		dimse.String(tagStudyDate, "DA", studyDate),
+		dimse.String(tagStudyTime, "TM", ""),
+		dimse.String(tagStudyDescription, "LO", ""),
+		dimse.String(tagStudyInstanceUID, "UI", ""),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("study query failed: %v", err)
+	}
+
+	var studies []StudyMatch
+	for _, response := range responses {
+		study := StudyMatch{
+			StudyInstanceUID: response.Text(tagStudyInstanceUID),
+			StudyDate:        response.Text(tagStudyDate),
+			StudyTime:        response.Text(tagStudyTime),
+			StudyDescription: response.Text(tagStudyDescription),
+			Source:           "pacs",
+		}
+		if study.StudyInstanceUID != "" {
+			studies = append(studies, study)
+		}
+	}
+	return studies, nil
+}
+
+// sameDescription compares study descriptions as operators type them
+func sameDescription(a, b string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
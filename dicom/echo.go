@@ -0,0 +1,107 @@
+package dicom
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"DICOMScanStation/dimse"
+)
+
+// EchoResult is the outcome of a C-ECHO against one configured SCP
+type EchoResult struct {
+	// Role is "query", "store" or "failover"
+	Role           string `json:"role"`
+	AETitle        string `json:"aeTitle"`
+	Host           string `json:"host"`
+	Port           int    `json:"port"`
+	CallingAETitle string `json:"callingAeTitle"`
+	TLS            bool   `json:"tls"`
+	// Reachable is set once the connection, including the TLS handshake,
+	// was established
+	Reachable bool `json:"reachable"`
+	// Accepted is set if the SCP accepted the association
+	Accepted bool `json:"accepted"`
+	// Success is set if the C-ECHO returned a success status
+	Success bool   `json:"success"`
+	Status  string `json:"status,omitempty"`
+	// ConnectMs is the time to open the association, RoundTripMs the time
+	// of the C-ECHO request and response
+	ConnectMs   float64 `json:"connectMs"`
+	RoundTripMs float64 `json:"roundTripMs"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// Echo sends a C-ECHO to the query and the store SCP, and the failover
+// archive if configured. All are tested even if they are the same system,
+// as the AE titles may differ.
+func (ds *DicomService) Echo() []EchoResult {
+	query := ds.queryDestination()
+	store := ds.storeDestination("")
+	// An operator is waiting, so the shorter query timeout applies to both
+	timeout := time.Duration(ds.cfg().DicomQueryTimeout) * time.Second
+
+	results := []EchoResult{
+		ds.echo("query", query.AETitle, query.Host, query.Port, query.CallingAETitle, timeout),
+		ds.echo("store", store.AETitle, store.Host, store.Port, store.CallingAETitle, timeout),
+	}
+	if failover := ds.failoverDestination(store); failover != nil {
+		results = append(results, ds.echo("failover", failover.AETitle, failover.Host, failover.Port, failover.CallingAETitle, timeout))
+	}
+	return results
+}
+
+func (ds *DicomService) echo(role, aeTitle, host string, port int, callingAETitle string, timeout time.Duration) EchoResult {
+	result := EchoResult{
+		Role:           role,
+		AETitle:        aeTitle,
+		Host:           host,
+		Port:           port,
+		CallingAETitle: callingAETitle,
+		TLS:            ds.current().tls != nil,
+	}
+
+	start := time.Now()
+	assoc, err := dimse.Dial(net.JoinHostPort(host, strconv.Itoa(port)), dimse.Options{
+		CallingAETitle: callingAETitle,
+		CalledAETitle:  aeTitle,
+		Timeout:        timeout,
+		TLS:            ds.current().tls,
+	}, []dimse.Proposal{{
+		AbstractSyntax:   dimse.Verification,
+		TransferSyntaxes: []string{dimse.ExplicitVRLittleEndian, dimse.ImplicitVRLittleEndian},
+	}})
+	result.ConnectMs = milliseconds(time.Since(start))
+	if err != nil {
+		// Only a failed connect means the SCP was not reached; a rejected
+		// or aborted association came from the SCP itself
+		var connectErr *dimse.ConnectError
+		result.Reachable = !errors.As(err, &connectErr)
+		result.Error = err.Error()
+		ds.logger.Warnf("DICOM service: C-ECHO to %s@%s:%d failed: %v", aeTitle, host, port, err)
+		return result
+	}
+	defer assoc.Release()
+	result.Reachable = true
+	result.Accepted = true
+
+	start = time.Now()
+	status, err := assoc.Echo()
+	result.RoundTripMs = milliseconds(time.Since(start))
+	var statusErr *dimse.StatusError
+	if err == nil || errors.As(err, &statusErr) {
+		result.Status = storeStatus(status)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		ds.logger.Warnf("DICOM service: C-ECHO to %s@%s:%d failed: %v", aeTitle, host, port, err)
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
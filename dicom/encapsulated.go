@@ -0,0 +1,196 @@
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"DICOMScanStation/dimse"
+)
+
+var ErrNotEncapsulated = errors.New("DICOM file has no encapsulated pixel data")
+
+var ErrNotPDF = errors.New("DICOM file is not an Encapsulated PDF")
+
+// ExtractJPEG returns the JPEG stream of a single-frame secondary capture
+// written by convertImage, which stores a baseline JPEG scan without
+// recompression.
+// Only explicit VR little endian data sets are supported, which covers all
+// encapsulated transfer syntaxes.
+func ExtractJPEG(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 132 || string(data[128:132]) != "DICM" {
+		return nil, fmt.Errorf("%s is not a DICOM file", path)
+	}
+	return ExtractJPEGData(data)
+}
+
+// ExtractJPEGData returns the JPEG stream of a DICOM file read into memory,
+// e.g. from the compressed local archive. Of a multi-frame image only the
+// first frame is returned.
+func ExtractJPEGData(data []byte) ([]byte, error) {
+	frames, err := ExtractJPEGFrames(data)
+	if err != nil {
+		return nil, err
+	}
+	return frames[0], nil
+}
+
+// ExtractJPEGFrames returns the JPEG stream of every frame of a DICOM file
+// read into memory
+func ExtractJPEGFrames(data []byte) ([][]byte, error) {
+	if len(data) < 132 || string(data[128:132]) != "DICM" {
+		return nil, fmt.Errorf("not a DICOM file")
+	}
+
+	pos := 132
+	for pos+8 <= len(data) {
+		group := binary.LittleEndian.Uint16(data[pos:])
+		element := binary.LittleEndian.Uint16(data[pos+2:])
+		vr := string(data[pos+4 : pos+6])
+
+		var length uint32
+		switch vr {
+		case "OB", "OW", "OF", "OD", "OL", "SQ", "UT", "UN", "UC", "UR":
+			if pos+12 > len(data) {
+				return nil, ErrNotEncapsulated
+			}
+			length = binary.LittleEndian.Uint32(data[pos+8:])
+			pos += 12
+		default:
+			length = uint32(binary.LittleEndian.Uint16(data[pos+6:]))
+			pos += 8
+		}
+
+		if group == 0x7FE0 && element == 0x0010 {
+			if length != 0xFFFFFFFF {
+				return nil, ErrNotEncapsulated
+			}
+			return readFragments(data[pos:])
+		}
+
+		if length == 0xFFFFFFFF {
+			// Undefined length sequence, skip to its delimiter
+			end, err := skipUndefined(data, pos)
+			if err != nil {
+				return nil, err
+			}
+			pos = end
+			continue
+		}
+		pos += int(length)
+	}
+	return nil, ErrNotEncapsulated
+}
+
+// ExtractPDFData returns the document of an Encapsulated PDF instance read
+// into memory
+func ExtractPDFData(data []byte) ([]byte, error) {
+	f, err := dimse.ParseFile(data)
+	if err != nil {
+		return nil, err
+	}
+	if f.SOPClassUID != encapsulatedPDFStorage {
+		return nil, ErrNotPDF
+	}
+	dataSet, err := dimse.ParseDataSet(f.DataSet, f.TransferSyntaxUID != dimse.ImplicitVRLittleEndian)
+	if err != nil {
+		return nil, err
+	}
+	doc, ok := dataSet[dimse.Tag(0x0042, 0x0011)]
+	if !ok || len(doc.Value) == 0 {
+		return nil, ErrNotPDF
+	}
+	// Drop the padding to even length
+	return bytes.TrimSuffix(doc.Value, []byte{0}), nil
+}
+
+// readFragments concatenates the fragments after the basic offset table.
+// A fragment starting with a JPEG start of image marker begins a new frame.
+func readFragments(data []byte) ([][]byte, error) {
+	var frames [][]byte
+	var out bytes.Buffer
+	pos := 0
+	first := true
+	for pos+8 <= len(data) {
+		tag := binary.LittleEndian.Uint32(data[pos:])
+		length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		pos += 8
+		switch tag {
+		case 0xE0DDFFFE: // sequence delimitation
+			if out.Len() == 0 {
+				return nil, ErrNotEncapsulated
+			}
+			return append(frames, out.Bytes()), nil
+		case 0xE000FFFE: // item
+			if pos+length > len(data) {
+				return nil, ErrNotEncapsulated
+			}
+			fragment := data[pos : pos+length]
+			if !first && out.Len() > 0 && bytes.HasPrefix(fragment, []byte{0xFF, 0xD8}) {
+				frames = append(frames, bytes.Clone(out.Bytes()))
+				out.Reset()
+			}
+			if !first {
+				out.Write(fragment)
+			}
+			first = false
+			pos += length
+		default:
+			return nil, ErrNotEncapsulated
+		}
+	}
+	return nil, ErrNotEncapsulated
+}
+
+// skipUndefined returns the position after the sequence delimitation item
+// of an undefined length sequence starting at pos
+func skipUndefined(data []byte, pos int) (int, error) {
+	depth := 1
+	for pos+8 <= len(data) {
+		tag := binary.LittleEndian.Uint32(data[pos:])
+		length := binary.LittleEndian.Uint32(data[pos+4:])
+		switch tag {
+		case 0xE000FFFE: // item
+			pos += 8
+			if length == 0xFFFFFFFF {
+				depth++
+			} else {
+				pos += int(length)
+			}
+			continue
+		case 0xE00DFFFE, 0xE0DDFFFE: // item or sequence delimitation
+			pos += 8
+			depth--
+			if depth == 0 {
+				return pos, nil
+			}
+			continue
+		}
+
+		// A data element inside an item
+		vr := string(data[pos+4 : pos+6])
+		switch vr {
+		case "OB", "OW", "OF", "OD", "OL", "SQ", "UT", "UN", "UC", "UR":
+			if pos+12 > len(data) {
+				return 0, ErrNotEncapsulated
+			}
+			length = binary.LittleEndian.Uint32(data[pos+8:])
+			pos += 12
+		default:
+			length = uint32(binary.LittleEndian.Uint16(data[pos+6:]))
+			pos += 8
+		}
+		if length == 0xFFFFFFFF {
+			depth++
+			continue
+		}
+		pos += int(length)
+	}
+	return 0, ErrNotEncapsulated
+}
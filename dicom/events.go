@@ -0,0 +1,41 @@
+package dicom
+
+import "time"
+
+// StudyResult summarizes a finished upload attempt for observers
+type StudyResult struct {
+	Request    SendRequest
+	Study      StudyIdentifiers
+	Progress   []FileProgress
+	Completed  int
+	Failed     int
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Err        error
+	// Queued is set when the pages were handed to the shared send queue;
+	// the sender node reports the upload again once stored
+	Queued bool
+	// Station is the station that queued the study, set by the sender node
+	Station string
+}
+
+// Succeeded reports whether every page of the study reached the PACS
+func (r StudyResult) Succeeded() bool {
+	return r.Err == nil && r.Failed == 0 && r.Completed > 0
+}
+
+// SendObserver is notified after every upload attempt, successful or not
+type SendObserver interface {
+	StudySent(result StudyResult)
+}
+
+// AddObserver registers an observer for finished uploads
+func (ds *DicomService) AddObserver(o SendObserver) {
+	ds.observers = append(ds.observers, o)
+}
+
+func (ds *DicomService) notify(result StudyResult) {
+	for _, o := range ds.observers {
+		o.StudySent(result)
+	}
+}
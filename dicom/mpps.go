@@ -0,0 +1,185 @@
+package dicom
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"DICOMScanStation/dimse"
+)
+
+// States of a performed procedure step
+const (
+	mppsInProgress   = "IN PROGRESS"
+	mppsCompleted    = "COMPLETED"
+	mppsDiscontinued = "DISCONTINUED"
+)
+
+// performedStep is the MPPS instance reporting one send
+type performedStep struct {
+	uid     string
+	started time.Time
+}
+
+// mppsDestination returns the system receiving MPPS, the query system
+// unless DICOM_MPPS_AETITLE names another AE there
+func (ds *DicomService) mppsDestination() QueryDestination {
+	dest := ds.queryDestination()
+	if aeTitle := strings.TrimSpace(ds.cfg().DicomMPPSAETitle); aeTitle != "" {
+		dest.AETitle = aeTitle
+	}
+	return dest
+}
+
+// mpps opens an association for MPPS, runs fn on it and releases it
+func (ds *DicomService) mpps(fn func(*dimse.Association) error) error {
+	dest := ds.mppsDestination()
+	assoc, err := dimse.Dial(net.JoinHostPort(dest.Host, strconv.Itoa(dest.Port)), dimse.Options{
+		CallingAETitle: dest.CallingAETitle,
+		CalledAETitle:  dest.AETitle,
+		Timeout:        time.Duration(ds.cfg().DicomQueryTimeout) * time.Second,
+		TLS:            ds.current().tls,
+	}, []dimse.Proposal{{
+		AbstractSyntax:   dimse.ModalityPerformedProcedureStep,
+		TransferSyntaxes: []string{dimse.ExplicitVRLittleEndian, dimse.ImplicitVRLittleEndian},
+	}})
+	if err != nil {
+		return fmt.Errorf("association with %s@%s:%d failed: %v", dest.AETitle, dest.Host, dest.Port, err)
+	}
+	defer assoc.Release()
+	return fn(assoc)
+}
+
+// startProcedureStep creates an MPPS in progress for the send. The station
+// has no worklist, so the step is unscheduled and the RIS matches it by
+// patient and study. A failure is only logged and returns nil, as the
+// documents are sent regardless.
+func (ds *DicomService) startProcedureStep(req SendRequest, study StudyIdentifiers) *performedStep {
+	if !ds.cfg().DicomMPPS {
+		return nil
+	}
+	step := &performedStep{uid: ds.current().uids.New(), started: time.Now()}
+	patient := req.Patient
+	modality := "OT"
+	if ds.sendFormat(req) == SendFormatPDF {
+		modality = "DOC"
+	}
+	if value, ok := ds.current().templates.value(req.Description, "Modality"); ok && value != "" {
+		modality = strings.ToUpper(value)
+	}
+
+	attributes := []dimse.Element{
+		dimse.Sequence(dimse.Tag(0x0040, 0x0270), [][]dimse.Element{{ // Scheduled Step Attributes
+			tagValue(dimse.Tag(0x0020, 0x000D), "UI", study.StudyInstanceUID),
+			dimse.Sequence(dimse.Tag(0x0008, 0x1110), nil),    // Referenced Study
+			dimse.String(dimse.Tag(0x0008, 0x0050), "SH", ""), // Accession Number
+			dimse.String(dimse.Tag(0x0040, 0x1001), "SH", ""), // Requested Procedure ID
+			dimse.String(dimse.Tag(0x0032, 0x1060), "LO", ""), // Requested Procedure Description
+			dimse.String(dimse.Tag(0x0040, 0x0009), "SH", ""), // Scheduled Procedure Step ID
+			dimse.String(dimse.Tag(0x0040, 0x0007), "LO", ""), // Scheduled Procedure Step Description
+			dimse.Sequence(dimse.Tag(0x0040, 0x0008), nil),    // Scheduled Protocol Code
+		}}),
+		tagValue(dimse.Tag(0x0010, 0x0010), "PN", ds.formatPatientNameForDicom(patient.Name)),
+		tagValue(dimse.Tag(0x0010, 0x0020), "LO", patient.PatientID),
+		tagValue(dimse.Tag(0x0010, 0x0030), "DA", patient.BirthDate),
+		tagValue(dimse.Tag(0x0010, 0x0040), "CS", patient.Gender),
+		dimse.Sequence(dimse.Tag(0x0008, 0x1120), nil), // Referenced Patient
+		tagValue(dimse.Tag(0x0040, 0x0253), "SH", procedureStepID(step.started)),
+		tagValue(dimse.Tag(0x0040, 0x0241), "AE", ds.mppsDestination().CallingAETitle), // Performed Station AE Title
+		tagValue(dimse.Tag(0x0040, 0x0242), "SH", ds.cfg().DicomStationName),           // Performed Station Name
+		tagValue(dimse.Tag(0x0040, 0x0243), "SH", req.DocumentCreator),                 // Performed Location
+		dimse.String(dimse.Tag(0x0040, 0x0244), "DA", step.started.Format("20060102")),
+		dimse.String(dimse.Tag(0x0040, 0x0245), "TM", step.started.Format("150405")),
+		dimse.String(dimse.Tag(0x0040, 0x0252), "CS", mppsInProgress),
+		tagValue(dimse.Tag(0x0040, 0x0254), "LO", req.Description), // Performed Procedure Step Description
+		dimse.String(dimse.Tag(0x0040, 0x0255), "LO", ""),          // Performed Procedure Type Description
+		dimse.Sequence(dimse.Tag(0x0008, 0x1032), nil),             // Procedure Code
+		dimse.String(dimse.Tag(0x0040, 0x0250), "DA", ""),          // End Date
+		dimse.String(dimse.Tag(0x0040, 0x0251), "TM", ""),          // End Time
+		dimse.String(dimse.Tag(0x0008, 0x0060), "CS", modality),
+		tagValue(dimse.Tag(0x0020, 0x0010), "SH", study.StudyID),
+		dimse.Sequence(dimse.Tag(0x0040, 0x0260), nil), // Performed Protocol Code
+		dimse.Sequence(dimse.Tag(0x0040, 0x0340), nil), // Performed Series
+	}
+
+	err := ds.mpps(func(assoc *dimse.Association) error {
+		_, err := assoc.Create(dimse.ModalityPerformedProcedureStep, step.uid, ds.withCharacterSet(attributes))
+		return err
+	})
+	if err != nil {
+		ds.logger.Errorf("DICOM service: Failed to create MPPS for study %s: %v", study.StudyInstanceUID, err)
+		return nil
+	}
+	ds.logger.Infof("DICOM service: Created MPPS %s for study %s", step.uid, study.StudyInstanceUID)
+	return step
+}
+
+// finishProcedureStep completes the step with the stored instances, or
+// discontinues it if instances failed
+func (ds *DicomService) finishProcedureStep(step *performedStep, req SendRequest, study StudyIdentifiers, stored []dimse.CommitReference, completed bool) {
+	if step == nil {
+		return
+	}
+	state := mppsCompleted
+	if !completed {
+		state = mppsDiscontinued
+	}
+
+	var images, documents [][]dimse.Element
+	for _, ref := range stored {
+		item := []dimse.Element{
+			dimse.String(dimse.Tag(0x0008, 0x1150), "UI", ref.SOPClassUID),
+			dimse.String(dimse.Tag(0x0008, 0x1155), "UI", ref.SOPInstanceUID),
+		}
+		if ref.SOPClassUID == encapsulatedPDFStorage {
+			documents = append(documents, item)
+		} else {
+			images = append(images, item)
+		}
+	}
+	description := seriesDescription(study, req.Description)
+	if value, ok := ds.current().templates.value(req.Description, "SeriesDescription"); ok {
+		description = value
+	}
+	var series [][]dimse.Element
+	if len(stored) > 0 {
+		series = append(series, []dimse.Element{
+			dimse.String(dimse.Tag(0x0008, 0x1050), "PN", ""),          // Performing Physician's Name
+			tagValue(dimse.Tag(0x0018, 0x1030), "LO", "Document scan"), // Protocol Name
+			tagValue(dimse.Tag(0x0008, 0x1070), "PN", req.Operator),    // Operators' Name
+			tagValue(dimse.Tag(0x0020, 0x000E), "UI", study.SeriesInstanceUID),
+			tagValue(dimse.Tag(0x0008, 0x103E), "LO", description),
+			tagValue(dimse.Tag(0x0008, 0x0054), "AE", ds.cfg().DicomStoreAETitle), // Retrieve AE Title
+			dimse.Sequence(dimse.Tag(0x0008, 0x1140), images),                     // Referenced Image
+			dimse.Sequence(dimse.Tag(0x0040, 0x0220), documents),                  // Referenced Non-Image Composite SOP Instance
+		})
+	}
+
+	now := time.Now()
+	modifications := []dimse.Element{
+		dimse.String(dimse.Tag(0x0040, 0x0252), "CS", state),
+		dimse.String(dimse.Tag(0x0040, 0x0250), "DA", now.Format("20060102")),
+		dimse.String(dimse.Tag(0x0040, 0x0251), "TM", now.Format("150405")),
+		dimse.Sequence(dimse.Tag(0x0040, 0x0340), series),
+	}
+	err := ds.mpps(func(assoc *dimse.Association) error {
+		_, err := assoc.Set(dimse.ModalityPerformedProcedureStep, step.uid, ds.withCharacterSet(modifications))
+		return err
+	})
+	if err != nil {
+		ds.logger.Errorf("DICOM service: Failed to set MPPS %s to %s: %v", step.uid, state, err)
+		return
+	}
+	ds.logger.Infof("DICOM service: MPPS %s %s with %d instance(s)", step.uid, state, len(stored))
+}
+
+// procedureStepID returns a Performed Procedure Step ID fitting the 16
+// characters of SH
+func procedureStepID(started time.Time) string {
+	b := make([]byte, 1)
+	rand.Read(b)
+	return fmt.Sprintf("%s%02X", started.Format("20060102150405"), b[0])
+}
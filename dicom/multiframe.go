@@ -0,0 +1,266 @@
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"DICOMScanStation/colorprofile"
+	"DICOMScanStation/dimse"
+)
+
+// Multi-frame Secondary Capture SOP classes
+const (
+	multiframeGrayscaleByteStorage = "1.2.840.10008.5.1.4.1.1.7.2"
+	multiframeGrayscaleWordStorage = "1.2.840.10008.5.1.4.1.1.7.3"
+	multiframeTrueColorStorage     = "1.2.840.10008.5.1.4.1.1.7.4"
+)
+
+// maxPixelData is the largest native pixel data with a defined length
+const maxPixelData = 0xFFFFFFFE
+
+// checkFramePage reports whether a page can be read as a frame
+func checkFramePage(page string) error {
+	f, err := os.Open(page)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %v", filepath.Base(page), err)
+	}
+	if config.Width > maxImageSide || config.Height > maxImageSide {
+		return fmt.Errorf("%s is %dx%d pixels, DICOM allows at most %d per side", filepath.Base(page), config.Width, config.Height, maxImageSide)
+	}
+	return nil
+}
+
+// convertPagesToMultiframe writes the scanned pages as the frames of one
+// multi-frame Secondary Capture instance. Like convertJpgToDicom the patient
+// and study attributes are placeholders until the document is tagged.
+func (ds *DicomService) convertPagesToMultiframe(pages []string, req SendRequest, study StudyIdentifiers) (string, error) {
+	var frames [][]byte
+	for _, page := range pages {
+		data, err := os.ReadFile(page)
+		if err != nil {
+			return "", err
+		}
+		frames = append(frames, data)
+	}
+
+	f, err := multiframeImage(frames)
+	if err != nil {
+		return "", err
+	}
+	// The profile of the first page describes all frames of one scan
+	if profile, err := colorprofile.Extract(pages[0]); err == nil && len(profile) > 0 && f.SOPClassUID == multiframeTrueColorStorage {
+		if len(profile)%2 == 1 {
+			profile = append(profile, 0)
+		}
+		dataSet, err := dimse.SetElements(f.DataSet, true, []dimse.Element{{Tag: dimse.Tag(0x0028, 0x2000), VR: "OB", Value: profile}})
+		if err != nil {
+			return "", err
+		}
+		f.DataSet = dataSet
+	}
+
+	dcmFile := documentFile(pages)
+	if err := dimse.WriteFile(dcmFile, f); err != nil {
+		os.Remove(dcmFile)
+		return "", fmt.Errorf("failed to write %s: %v", dcmFile, err)
+	}
+	ds.logger.Debugf("DICOM service: Wrote %d page(s) as multi-frame image %s (%s)", len(pages), dcmFile, f.TransferSyntaxUID)
+	return dcmFile, nil
+}
+
+// multiframeImage builds a multi-frame Secondary Capture instance. Baseline
+// JPEGs of the same size and color layout become one fragment per frame
+// without recompression; otherwise all frames are stored uncompressed,
+// smaller pages padded with white to the size of the largest.
+func multiframeImage(frames [][]byte) (*dimse.File, error) {
+	var pixels []dimse.Element
+	var sopClass string
+	ts := dimse.ExplicitVRLittleEndian
+
+	if config, frame, ok := sameBaselineJPEGs(frames); ok {
+		pixels = encapsulatedPixels(frames[0], config, frame)
+		pixels[len(pixels)-1].Fragments = frames
+		sopClass = multiframeTrueColorStorage
+		if frame.components == 1 {
+			sopClass = multiframeGrayscaleByteStorage
+		}
+		ts = dimse.JPEGBaseline
+	} else {
+		var images []image.Image
+		for i, data := range frames {
+			img, _, err := image.Decode(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode page %d: %v", i+1, err)
+			}
+			images = append(images, img)
+		}
+		var err error
+		pixels, sopClass, err = nativeFrames(images)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Page Number Vector as Frame Increment Pointer: frame i is page i
+	numbers := make([]string, len(frames))
+	for i := range numbers {
+		numbers[i] = strconv.Itoa(i + 1)
+	}
+	pageNumberVector := dimse.Tag(0x0018, 0x2001)
+	pointer := binary.LittleEndian.AppendUint16(nil, uint16(pageNumberVector>>16))
+	pointer = binary.LittleEndian.AppendUint16(pointer, uint16(pageNumberVector))
+
+	now := time.Now()
+	date, clock := now.Format("20060102"), now.Format("150405")
+	instanceUID := newUID()
+	elements := []dimse.Element{
+		dimse.String(dimse.Tag(0x0008, 0x0012), "DA", date), // Instance Creation Date
+		dimse.String(dimse.Tag(0x0008, 0x0013), "TM", clock),
+		dimse.String(dimse.Tag(0x0008, 0x0016), "UI", sopClass),
+		dimse.String(dimse.Tag(0x0008, 0x0018), "UI", instanceUID),
+		dimse.String(dimse.Tag(0x0008, 0x0020), "DA", date), // Study Date
+		dimse.String(dimse.Tag(0x0008, 0x0023), "DA", date), // Content Date
+		dimse.String(dimse.Tag(0x0008, 0x0030), "TM", clock),
+		dimse.String(dimse.Tag(0x0008, 0x0033), "TM", clock),
+		dimse.String(dimse.Tag(0x0008, 0x0050), "SH", ""), // Accession Number
+		dimse.String(dimse.Tag(0x0008, 0x0060), "CS", "OT"),
+		dimse.String(dimse.Tag(0x0008, 0x0064), "CS", "WSD"), // Workstation
+		dimse.String(dimse.Tag(0x0008, 0x0090), "PN", ""),    // Referring Physician
+		dimse.String(dimse.Tag(0x0010, 0x0010), "PN", ""),
+		dimse.String(dimse.Tag(0x0010, 0x0020), "LO", ""),
+		dimse.String(dimse.Tag(0x0010, 0x0030), "DA", ""),
+		dimse.String(dimse.Tag(0x0010, 0x0040), "CS", ""),
+		dimse.String(dimse.Tag(0x0018, 0x2001), "IS", strings.Join(numbers, "\\")), // Page Number Vector
+		dimse.String(dimse.Tag(0x0020, 0x000D), "UI", newUID()),
+		dimse.String(dimse.Tag(0x0020, 0x000E), "UI", newUID()),
+		dimse.String(dimse.Tag(0x0020, 0x0010), "SH", ""),
+		dimse.String(dimse.Tag(0x0020, 0x0011), "IS", "1"), // Series Number
+		dimse.String(dimse.Tag(0x0020, 0x0013), "IS", "1"),
+		dimse.String(dimse.Tag(0x0020, 0x0020), "CS", ""), // Patient Orientation
+		dimse.String(dimse.Tag(0x0028, 0x0008), "IS", strconv.Itoa(len(frames))),
+		{Tag: dimse.Tag(0x0028, 0x0009), VR: "AT", Value: pointer},
+		dimse.String(dimse.Tag(0x0028, 0x0301), "CS", "YES"), // Burned In Annotation
+	}
+	if sopClass != multiframeTrueColorStorage {
+		elements = append(elements,
+			dimse.String(dimse.Tag(0x0028, 0x1052), "DS", "0"),        // Rescale Intercept
+			dimse.String(dimse.Tag(0x0028, 0x1053), "DS", "1"),        // Rescale Slope
+			dimse.String(dimse.Tag(0x0028, 0x1054), "LO", "US"),       // Rescale Type: unspecified
+			dimse.String(dimse.Tag(0x2050, 0x0020), "CS", "IDENTITY"), // Presentation LUT Shape
+		)
+	}
+	elements = append(elements, pixels...)
+
+	return &dimse.File{
+		SOPClassUID:       sopClass,
+		SOPInstanceUID:    instanceUID,
+		TransferSyntaxUID: ts,
+		DataSet:           dimse.EncodeDataSet(elements, true),
+	}, nil
+}
+
+// sameBaselineJPEGs reports whether all frames are 8 bit baseline JPEGs of
+// the same size, components and subsampling
+func sameBaselineJPEGs(frames [][]byte) (image.Config, jpegFrame, bool) {
+	var first image.Config
+	var firstFrame jpegFrame
+	for i, data := range frames {
+		frame, err := readJPEGFrame(data)
+		if err != nil || frame.marker != markerSOF0 || frame.precision != 8 || (frame.components != 1 && frame.components != 3) {
+			return image.Config{}, jpegFrame{}, false
+		}
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return image.Config{}, jpegFrame{}, false
+		}
+		if i == 0 {
+			first, firstFrame = config, frame
+			continue
+		}
+		if config.Width != first.Width || config.Height != first.Height || frame.components != firstFrame.components || frame.subsampled != firstFrame.subsampled {
+			return image.Config{}, jpegFrame{}, false
+		}
+	}
+	return first, firstFrame, len(frames) > 0
+}
+
+// nativeFrames stores the frames uncompressed: greyscale with 8 or 16 bits
+// if every page is greyscale, otherwise 8 bit RGB
+func nativeFrames(images []image.Image) ([]dimse.Element, string, error) {
+	rows, columns := 0, 0
+	gray, gray16 := true, true
+	for _, img := range images {
+		rows = max(rows, img.Bounds().Dy())
+		columns = max(columns, img.Bounds().Dx())
+		switch img.ColorModel() {
+		case color.GrayModel:
+			gray16 = false
+		case color.Gray16Model:
+		default:
+			gray, gray16 = false, false
+		}
+	}
+
+	samples, bytesPerSample, sopClass := 3, 1, multiframeTrueColorStorage
+	switch {
+	case gray16:
+		samples, bytesPerSample, sopClass = 1, 2, multiframeGrayscaleWordStorage
+	case gray:
+		samples, sopClass = 1, multiframeGrayscaleByteStorage
+	}
+	size := uint64(rows) * uint64(columns) * uint64(samples*bytesPerSample) * uint64(len(images))
+	if size > maxPixelData {
+		return nil, "", fmt.Errorf("%d pages of %dx%d pixels exceed the size of uncompressed pixel data", len(images), columns, rows)
+	}
+
+	data := make([]byte, 0, size+1)
+	for _, img := range images {
+		b := img.Bounds()
+		for y := 0; y < rows; y++ {
+			for x := 0; x < columns; x++ {
+				// White outside a smaller page
+				var c color.Color = color.White
+				if x < b.Dx() && y < b.Dy() {
+					c = img.At(b.Min.X+x, b.Min.Y+y)
+				}
+				switch sopClass {
+				case multiframeGrayscaleWordStorage:
+					data = binary.LittleEndian.AppendUint16(data, color.Gray16Model.Convert(c).(color.Gray16).Y)
+				case multiframeGrayscaleByteStorage:
+					data = append(data, color.GrayModel.Convert(c).(color.Gray).Y)
+				default:
+					r, g, bl, _ := c.RGBA()
+					data = append(data, byte(r>>8), byte(g>>8), byte(bl>>8))
+				}
+			}
+		}
+	}
+	// Pixel data must have an even length
+	if len(data)%2 == 1 {
+		data = append(data, 0)
+	}
+
+	vr := "OB"
+	elements := pixelModule(rows, columns, samples, 8, "RGB")
+	switch sopClass {
+	case multiframeGrayscaleWordStorage:
+		vr = "OW"
+		elements = pixelModule(rows, columns, 1, 16, "MONOCHROME2")
+	case multiframeGrayscaleByteStorage:
+		elements = pixelModule(rows, columns, 1, 8, "MONOCHROME2")
+	}
+	return append(elements, dimse.Element{Tag: dimse.Tag(0x7FE0, 0x0010), VR: vr, Value: data}), sopClass, nil
+}
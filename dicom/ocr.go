@@ -0,0 +1,53 @@
+package dicom
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"DICOMScanStation/dimse"
+)
+
+// imageComments holds the recognized text of a page
+var imageComments = dimse.Tag(0x0020, 0x4000)
+
+// recognizeText returns the text of the pages, one paragraph per page. Text
+// recognition is optional: pages it fails on are sent without text.
+func (ds *DicomService) recognizeText(pages []string) string {
+	if ds.ocr == nil {
+		return ""
+	}
+	var texts []string
+	for _, page := range pages {
+		start := time.Now()
+		text, err := ds.ocr.Recognize(page)
+		if err != nil {
+			ds.logger.Warnf("DICOM service: Text recognition failed for %s: %v", filepath.Base(page), err)
+			continue
+		}
+		ds.logger.Debugf("DICOM service: Recognized %d characters on %s in %v", len(text), filepath.Base(page), time.Since(start))
+		if text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// withRecognizedText stores the text in the Image Comments, after a comment
+// the document type template sets
+func withRecognizedText(tags []dimse.Element, text string) []dimse.Element {
+	if text == "" {
+		return tags
+	}
+	for i, e := range tags {
+		if e.Tag != imageComments {
+			continue
+		}
+		if comment := strings.TrimRight(string(e.Value), " \x00"); comment != "" {
+			text = comment + "\n\n" + text
+		}
+		tags[i] = tagValue(imageComments, "LT", text)
+		return tags
+	}
+	return append(tags, tagValue(imageComments, "LT", text))
+}
@@ -0,0 +1,411 @@
+package dicom
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"DICOMScanStation/dimse"
+)
+
+// outboxDir is the directory below STATE_DIR holding the instances that
+// wait for another attempt
+const outboxDir = "outbox"
+
+// outboxPollInterval is how often RunOutbox looks for due instances
+const outboxPollInterval = 10 * time.Second
+
+// outboxFirstBackoff is the delay before the first retry; it doubles with
+// every failed attempt up to DICOM_OUTBOX_MAX_BACKOFF
+const outboxFirstBackoff = 30 * time.Second
+
+// ErrOutboxEntryNotFound is returned for unknown outbox entries
+var ErrOutboxEntryNotFound = errors.New("outbox entry not found")
+
+// OutboxEntry is an instance the PACS could not take, kept on disk until
+// it is delivered. The ID is the SOP Instance UID.
+type OutboxEntry struct {
+	ID            string           `json:"id"`
+	Request       SendRequest      `json:"request"`
+	Study         StudyIdentifiers `json:"study"`
+	Filename      string           `json:"filename"`
+	Attempts      int              `json:"attempts"`
+	LastError     string           `json:"lastError,omitempty"`
+	CreatedAt     time.Time        `json:"createdAt"`
+	NextAttemptAt time.Time        `json:"nextAttemptAt"`
+}
+
+// outbox keeps each entry as <id>.dcm with its metadata in <id>.json
+type outbox struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// EnableOutbox keeps instances that could not be stored in the outbox of
+// the state directory; RunOutbox retries them
+func (ds *DicomService) EnableOutbox() error {
+	dir := filepath.Join(ds.cfg().StateDir, outboxDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create outbox directory: %v", err)
+	}
+	ds.outbox = &outbox{dir: dir}
+	return nil
+}
+
+// retryable reports whether a failed C-STORE may succeed later: the PACS
+// could not be reached or was out of resources. Instances it rejected are
+// not retried.
+func retryable(status dimse.Status, err error) bool {
+	return err != nil && (status == 0 || uint16(status)&0xff00 == 0xa700)
+}
+
+// holdInOutbox moves a prepared instance the PACS could not take into the
+// outbox and reports whether it did
+func (ds *DicomService) holdInOutbox(req SendRequest, study StudyIdentifiers, p preparedFile, progress []FileProgress, sendErr error) bool {
+	uid := progress[p.index].SOPInstanceUID
+	entry := OutboxEntry{
+		ID:            uid,
+		Request:       req,
+		Study:         study,
+		Filename:      progress[p.index].Filename,
+		Attempts:      1,
+		LastError:     sendErr.Error(),
+		CreatedAt:     time.Now(),
+		NextAttemptAt: time.Now().Add(ds.outboxBackoff(1)),
+	}
+	if err := ds.outbox.add(entry, p.dcmFile); err != nil {
+		ds.logger.Errorf("DICOM service: Failed to keep %s in the outbox: %v", uid, err)
+		return false
+	}
+	// The instance is in the outbox; only the source pages remain
+	if err := os.Remove(p.jpgFile); err != nil {
+		ds.logger.Warnf("DICOM service: Failed to remove JPG file %s: %v", p.jpgFile, err)
+	}
+	for _, page := range p.pages {
+		if err := os.Remove(page.file); err != nil {
+			ds.logger.Warnf("DICOM service: Failed to remove JPG file %s: %v", page.file, err)
+		}
+	}
+
+	progress[p.index].Status = "outbox"
+	progress[p.index].Message = "PACS not reachable, the upload is retried automatically"
+	progress[p.index].Progress = 90
+	ds.logger.Warnf("DICOM service: Keeping %s in the outbox, retrying at %s", uid, entry.NextAttemptAt.Format(time.RFC3339))
+	return true
+}
+
+// outboxBackoff returns the delay after the given number of failed
+// attempts
+func (ds *DicomService) outboxBackoff(attempts int) time.Duration {
+	limit := time.Duration(ds.cfg().DicomOutboxMaxBackoff) * time.Second
+	backoff := outboxFirstBackoff
+	for i := 1; i < attempts && backoff < limit; i++ {
+		backoff *= 2
+	}
+	if backoff > limit {
+		backoff = limit
+	}
+	return backoff
+}
+
+// OutboxEntries returns the instances waiting in the outbox, oldest first
+func (ds *DicomService) OutboxEntries() ([]OutboxEntry, error) {
+	if ds.outbox == nil {
+		return nil, fmt.Errorf("outbox is not enabled")
+	}
+	return ds.outbox.list()
+}
+
+// RetryOutboxEntry makes an entry due now; RunOutbox sends it with its next
+// round
+func (ds *DicomService) RetryOutboxEntry(id string) error {
+	if ds.outbox == nil {
+		return fmt.Errorf("outbox is not enabled")
+	}
+	return ds.outbox.update(id, func(entry *OutboxEntry) {
+		entry.NextAttemptAt = time.Now()
+	})
+}
+
+// DeleteOutboxEntry discards an entry that should not be delivered
+func (ds *DicomService) DeleteOutboxEntry(id string) error {
+	if ds.outbox == nil {
+		return fmt.Errorf("outbox is not enabled")
+	}
+	if _, err := ds.outbox.get(id); err != nil {
+		return err
+	}
+	ds.logger.Warnf("DICOM service: Discarding %s from the outbox", id)
+	return ds.outbox.remove(id)
+}
+
+// RunOutbox retries the due instances of the outbox until ctx is cancelled
+func (ds *DicomService) RunOutbox(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := ds.sendOutbox(); err != nil {
+			ds.logger.Warnf("DICOM service: Outbox: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendOutbox sends the due entries, study by study over one association
+func (ds *DicomService) sendOutbox() error {
+	entries, err := ds.outbox.list()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var studies []string
+	due := make(map[string][]OutboxEntry)
+	for _, entry := range entries {
+		if entry.NextAttemptAt.After(now) {
+			continue
+		}
+		uid := entry.Study.StudyInstanceUID
+		if _, ok := due[uid]; !ok {
+			studies = append(studies, uid)
+		}
+		due[uid] = append(due[uid], entry)
+	}
+
+	for _, uid := range studies {
+		ds.sendOutboxStudy(due[uid])
+	}
+	return nil
+}
+
+// sendOutboxStudy sends the due entries of one study and reports the
+// delivered ones to the observers
+func (ds *DicomService) sendOutboxStudy(entries []OutboxEntry) {
+	req, study := entries[0].Request, entries[0].Study
+	ds.logger.Infof("DICOM service: Retrying %d instance(s) of study %s from the outbox", len(entries), study.StudyInstanceUID)
+
+	startedAt := time.Now()
+	session := ds.openStore(ds.storeDestination(req.DocumentCreator))
+	defer session.close()
+
+	var progress []FileProgress
+	for i, entry := range entries {
+		dcmFile := ds.outbox.path(entry.ID, ".dcm")
+		status, err := session.store(dcmFile)
+		if err != nil {
+			ds.logger.Warnf("DICOM service: Outbox instance %s not stored (attempt %d): %v", entry.ID, entry.Attempts+1, err)
+			if status == 0 {
+				// The PACS cannot be reached; the other instances wait too
+				ds.postponeOutbox(entries[i:], err)
+				break
+			}
+			ds.postponeOutbox(entries[i:i+1], err)
+			continue
+		}
+
+		ds.archiveInstance(req, study, dcmFile, entry.ID)
+		if err := ds.outbox.remove(entry.ID); err != nil {
+			ds.logger.Warnf("DICOM service: Failed to remove %s from the outbox: %v", entry.ID, err)
+		}
+		progress = append(progress, FileProgress{
+			Filename:       entry.Filename,
+			Status:         "completed",
+			Message:        "Successfully uploaded to PACs from the outbox",
+			Progress:       100,
+			SOPInstanceUID: entry.ID,
+			StoreStatus:    storeStatus(status),
+			Archive:        session.dest.String(),
+		})
+		ds.logger.Infof("DICOM service: Delivered %s from the outbox after %d attempt(s)", entry.ID, entry.Attempts+1)
+	}
+	if len(progress) == 0 {
+		return
+	}
+
+	if ds.cfg().DicomStorageCommitment {
+		for dest, refs := range session.storedByArchive() {
+			ds.commitInstances(dest, refs, progress)
+		}
+	}
+	ds.notify(StudyResult{
+		Request:    req,
+		Study:      study,
+		Progress:   progress,
+		Completed:  len(progress),
+		StartedAt:  startedAt,
+		FinishedAt: time.Now(),
+	})
+}
+
+// postponeOutbox counts a failed attempt for the entries and schedules the
+// next one
+func (ds *DicomService) postponeOutbox(entries []OutboxEntry, sendErr error) {
+	for _, entry := range entries {
+		err := ds.outbox.update(entry.ID, func(e *OutboxEntry) {
+			e.Attempts++
+			e.LastError = sendErr.Error()
+			e.NextAttemptAt = time.Now().Add(ds.outboxBackoff(e.Attempts))
+		})
+		if err != nil {
+			ds.logger.Warnf("DICOM service: Failed to update outbox entry %s: %v", entry.ID, err)
+		}
+	}
+}
+
+// validOutboxID accepts SOP Instance UIDs only, so an ID cannot leave the
+// outbox directory
+func validOutboxID(id string) bool {
+	return id != "" && strings.Trim(id, "0123456789.") == ""
+}
+
+func (o *outbox) path(id string, ext string) string {
+	return filepath.Join(o.dir, id+ext)
+}
+
+// add moves the DICOM file into the outbox and writes its metadata
+func (o *outbox) add(entry OutboxEntry, dcmFile string) error {
+	if !validOutboxID(entry.ID) {
+		return fmt.Errorf("invalid SOP Instance UID %q", entry.ID)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err := moveFile(dcmFile, o.path(entry.ID, ".dcm")); err != nil {
+		return err
+	}
+	if err := o.write(entry); err != nil {
+		os.Remove(o.path(entry.ID, ".dcm"))
+		return err
+	}
+	return nil
+}
+
+func (o *outbox) list() ([]OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(o.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	entries := []OutboxEntry{}
+	for _, file := range files {
+		entry, err := o.read(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+	return entries, nil
+}
+
+func (o *outbox) get(id string) (*OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.read(id)
+}
+
+// update changes the metadata of an entry
+func (o *outbox) update(id string, fn func(*OutboxEntry)) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, err := o.read(id)
+	if err != nil {
+		return err
+	}
+	fn(entry)
+	return o.write(*entry)
+}
+
+func (o *outbox) remove(id string) error {
+	if !validOutboxID(id) {
+		return ErrOutboxEntryNotFound
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// Without metadata the instance is no longer listed or retried
+	if err := os.Remove(o.path(id, ".json")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(o.path(id, ".dcm")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (o *outbox) read(id string) (*OutboxEntry, error) {
+	if !validOutboxID(id) {
+		return nil, ErrOutboxEntryNotFound
+	}
+	data, err := os.ReadFile(o.path(id, ".json"))
+	if os.IsNotExist(err) {
+		return nil, ErrOutboxEntryNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var entry OutboxEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("invalid outbox entry %s: %v", id, err)
+	}
+	return &entry, nil
+}
+
+// write replaces the metadata atomically, so a crash leaves the old or the
+// new version
+func (o *outbox) write(entry OutboxEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := o.path(entry.ID, ".json.tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, o.path(entry.ID, ".json"))
+}
+
+// moveFile renames src to dst, copying it if they are on different file
+// systems
+func moveFile(src string, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
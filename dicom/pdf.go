@@ -0,0 +1,106 @@
+package dicom
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"DICOMScanStation/dimse"
+	"DICOMScanStation/pdfa"
+)
+
+const encapsulatedPDFStorage = "1.2.840.10008.5.1.4.1.1.104.1"
+
+// convertPagesToPDF writes the scanned pages as one Encapsulated PDF
+// instance. Like convertJpgToDicom the patient and study attributes are
+// placeholders until the document is tagged.
+func (ds *DicomService) convertPagesToPDF(pages []string, req SendRequest, study StudyIdentifiers) (string, error) {
+	var images [][]byte
+	for _, page := range pages {
+		data, err := os.ReadFile(page)
+		if err != nil {
+			return "", err
+		}
+		images = append(images, data)
+	}
+
+	now := time.Now()
+	doc := pdfa.Document{
+		Title:            req.Description,
+		Author:           req.DocumentCreator,
+		PatientID:        req.Patient.PatientID,
+		PatientName:      req.Patient.Name,
+		StudyInstanceUID: study.StudyInstanceUID,
+		Created:          now,
+		Producer:         fmt.Sprintf("%s %s", ds.cfg().AppName, ds.cfg().AppVersion),
+	}
+	var pdf bytes.Buffer
+	if err := pdfa.Write(&pdf, doc, images); err != nil {
+		return "", err
+	}
+
+	dcmFile := documentFile(pages)
+	if err := dimse.WriteFile(dcmFile, encapsulatedPDF(pdf.Bytes(), req.Description, ds.characterSet(), now)); err != nil {
+		os.Remove(dcmFile)
+		return "", fmt.Errorf("failed to write %s: %v", dcmFile, err)
+	}
+	ds.logger.Debugf("DICOM service: Wrote %d page(s) as Encapsulated PDF %s (%d bytes)", len(pages), dcmFile, pdf.Len())
+	return dcmFile, nil
+}
+
+// checkPDFPage reports whether a page can be embedded into the PDF
+func checkPDFPage(page string) error {
+	data, err := os.ReadFile(page)
+	if err != nil {
+		return err
+	}
+	return pdfa.Check(data)
+}
+
+// encapsulatedPDF builds an Encapsulated PDF instance (PS3.3 A.45.1). The
+// title is encoded in cs, which the tagging declares.
+func encapsulatedPDF(pdf []byte, title string, cs string, now time.Time) *dimse.File {
+	// OB values must have an even length
+	if len(pdf)%2 == 1 {
+		pdf = append(pdf, 0)
+	}
+	date, clock := now.Format("20060102"), now.Format("150405")
+	instanceUID := newUID()
+	elements := []dimse.Element{
+		dimse.String(dimse.Tag(0x0008, 0x0012), "DA", date), // Instance Creation Date
+		dimse.String(dimse.Tag(0x0008, 0x0013), "TM", clock),
+		dimse.String(dimse.Tag(0x0008, 0x0016), "UI", encapsulatedPDFStorage),
+		dimse.String(dimse.Tag(0x0008, 0x0018), "UI", instanceUID),
+		dimse.String(dimse.Tag(0x0008, 0x0020), "DA", date), // Study Date
+		dimse.String(dimse.Tag(0x0008, 0x0023), "DA", date), // Content Date
+		dimse.String(dimse.Tag(0x0008, 0x002A), "DT", ""),   // Acquisition DateTime
+		dimse.String(dimse.Tag(0x0008, 0x0030), "TM", clock),
+		dimse.String(dimse.Tag(0x0008, 0x0033), "TM", clock),
+		dimse.String(dimse.Tag(0x0008, 0x0050), "SH", ""), // Accession Number
+		dimse.String(dimse.Tag(0x0008, 0x0060), "CS", "DOC"),
+		dimse.String(dimse.Tag(0x0008, 0x0064), "CS", "WSD"), // Workstation
+		dimse.String(dimse.Tag(0x0008, 0x0090), "PN", ""),    // Referring Physician
+		dimse.String(dimse.Tag(0x0010, 0x0010), "PN", ""),
+		dimse.String(dimse.Tag(0x0010, 0x0020), "LO", ""),
+		dimse.String(dimse.Tag(0x0010, 0x0030), "DA", ""),
+		dimse.String(dimse.Tag(0x0010, 0x0040), "CS", ""),
+		dimse.String(dimse.Tag(0x0020, 0x000D), "UI", newUID()),
+		dimse.String(dimse.Tag(0x0020, 0x000E), "UI", newUID()),
+		dimse.String(dimse.Tag(0x0020, 0x0010), "SH", ""),
+		dimse.String(dimse.Tag(0x0020, 0x0011), "IS", "1"), // Series Number
+		dimse.String(dimse.Tag(0x0020, 0x0013), "IS", "1"),
+		dimse.String(dimse.Tag(0x0028, 0x0301), "CS", "YES"), // Burned In Annotation
+		{Tag: dimse.Tag(0x0040, 0xA043), VR: "SQ"},           // Concept Name Code Sequence
+		tagValue(dimse.Tag(0x0042, 0x0010), "ST", title),     // Document Title
+		{Tag: dimse.Tag(0x0042, 0x0011), VR: "OB", Value: pdf},
+		dimse.String(dimse.Tag(0x0042, 0x0012), "LO", "application/pdf"),
+	}
+
+	return &dimse.File{
+		SOPClassUID:       encapsulatedPDFStorage,
+		SOPInstanceUID:    instanceUID,
+		TransferSyntaxUID: dimse.ExplicitVRLittleEndian,
+		DataSet:           dimse.EncodeDataSet(encodeElements(cs, elements), true),
+	}
+}
@@ -0,0 +1,128 @@
+package dicom
+
+import (
+	"sync"
+	"time"
+
+	"DICOMScanStation/dimse"
+
+	"github.com/sirupsen/logrus"
+)
+
+// secondaryCaptureStorage is the SOP class convertImage encodes scanned
+// pages as
+const secondaryCaptureStorage = "1.2.840.10008.5.1.4.1.1.7"
+
+// associationPool keeps the store association of a destination open after a
+// document was sent and reuses it for the next one, saving the association
+// handshake on slow links. One idle association is kept per destination; it
+// is released after the idle timeout.
+type associationPool struct {
+	mu          sync.Mutex
+	idleTimeout time.Duration
+	idle        map[StoreDestination]*idleAssociation
+	logger      *logrus.Logger
+}
+
+type idleAssociation struct {
+	assoc *dimse.Association
+	timer *time.Timer
+}
+
+func newAssociationPool(idleTimeout time.Duration, logger *logrus.Logger) *associationPool {
+	if idleTimeout <= 0 {
+		idleTimeout = time.Minute
+	}
+	return &associationPool{
+		idleTimeout: idleTimeout,
+		idle:        make(map[StoreDestination]*idleAssociation),
+		logger:      logger,
+	}
+}
+
+// get takes the idle association of dest, or returns nil if there is none
+func (p *associationPool) get(dest StoreDestination) *dimse.Association {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, ok := p.idle[dest]
+	if !ok {
+		return nil
+	}
+	delete(p.idle, dest)
+	entry.timer.Stop()
+	return entry.assoc
+}
+
+// put returns an association for reuse. If another association of dest is
+// already idle, the returned one is released.
+func (p *associationPool) put(dest StoreDestination, assoc *dimse.Association) {
+	if assoc.Broken() {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.idle[dest]; ok {
+		go assoc.Release()
+		return
+	}
+	entry := &idleAssociation{assoc: assoc}
+	entry.timer = time.AfterFunc(p.idleTimeout, func() {
+		p.mu.Lock()
+		if p.idle[dest] != entry {
+			p.mu.Unlock()
+			return
+		}
+		delete(p.idle, dest)
+		p.mu.Unlock()
+
+		p.logger.Debugf("DICOM service: Releasing idle association to %s@%s", dest.AETitle, dest.Host)
+		assoc.Release()
+	})
+	p.idle[dest] = entry
+}
+
+// close releases all idle associations
+func (p *associationPool) close() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = make(map[StoreDestination]*idleAssociation)
+	p.mu.Unlock()
+
+	for _, entry := range idle {
+		entry.timer.Stop()
+		entry.assoc.Release()
+	}
+}
+
+// storeProposals returns the presentation contexts offered on a store
+// association: scanned pages in every transfer syntax the station writes,
+// plus the syntax of the file at hand
+func storeProposals(f *dimse.File) []dimse.Proposal {
+	standard := []string{dimse.JPEGBaseline, dimse.ExplicitVRLittleEndian, dimse.ImplicitVRLittleEndian}
+	proposals := []dimse.Proposal{{AbstractSyntax: secondaryCaptureStorage, TransferSyntaxes: standard}}
+
+	if f.SOPClassUID != secondaryCaptureStorage {
+		proposals = append(proposals, dimse.Proposal{AbstractSyntax: f.SOPClassUID, TransferSyntaxes: []string{f.TransferSyntaxUID}})
+		return proposals
+	}
+	for _, ts := range standard {
+		if ts == f.TransferSyntaxUID {
+			return proposals
+		}
+	}
+	proposals[0].TransferSyntaxes = append(proposals[0].TransferSyntaxes, f.TransferSyntaxUID)
+	return proposals
+}
+
+// Close releases the associations kept open by the pool
+func (ds *DicomService) Close() {
+	if ds.pool != nil {
+		ds.pool.close()
+	}
+	if ds.commitListener != nil {
+		ds.commitListener.Close()
+	}
+}
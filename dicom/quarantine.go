@@ -0,0 +1,169 @@
+package dicom
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DecisionPending = "pending"
+	DecisionSkip    = "skip"
+	DecisionRescan  = "rescan"
+)
+
+var ErrQuarantineNotFound = errors.New("quarantine entry not found")
+
+// QuarantinedPage is a page that failed conversion and needs an operator decision
+type QuarantinedPage struct {
+	Filename string `json:"filename"`
+	Reason   string `json:"reason"`
+	Decision string `json:"decision"`
+}
+
+// Quarantine is a study held back from transmission because of failed pages
+type Quarantine struct {
+	ID        string            `json:"id"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Request   SendRequest       `json:"request"`
+	Study     StudyIdentifiers  `json:"study"`
+	Pages     []QuarantinedPage `json:"pages"`
+}
+
+// Resolved reports whether the operator decided on every failed page
+func (q *Quarantine) Resolved() bool {
+	for _, p := range q.Pages {
+		if p.Decision == DecisionPending {
+			return false
+		}
+	}
+	return true
+}
+
+// QuarantineError is returned by SendToPacs when a study was held back
+type QuarantineError struct {
+	Quarantine *Quarantine
+}
+
+func (e *QuarantineError) Error() string {
+	return fmt.Sprintf("study held in quarantine %s: %d page(s) failed", e.Quarantine.ID, len(e.Quarantine.Pages))
+}
+
+type quarantineStore struct {
+	mu      sync.Mutex
+	entries map[string]*Quarantine
+	seq     int
+}
+
+func newQuarantineStore() *quarantineStore {
+	return &quarantineStore{entries: make(map[string]*Quarantine)}
+}
+
+func (qs *quarantineStore) add(req SendRequest, study StudyIdentifiers, pages []QuarantinedPage) *Quarantine {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	qs.seq++
+	for i := range pages {
+		pages[i].Decision = DecisionPending
+	}
+	q := &Quarantine{
+		ID:        fmt.Sprintf("Q%s-%d", time.Now().Format("20060102150405"), qs.seq),
+		CreatedAt: time.Now(),
+		Request:   req,
+		Study:     study,
+		Pages:     pages,
+	}
+	qs.entries[q.ID] = q
+	return q
+}
+
+func (qs *quarantineStore) get(id string) (*Quarantine, error) {
+	q, ok := qs.entries[id]
+	if !ok {
+		return nil, ErrQuarantineNotFound
+	}
+	return q, nil
+}
+
+// ListQuarantine returns all studies currently held in quarantine
+func (ds *DicomService) ListQuarantine() []Quarantine {
+	ds.quarantine.mu.Lock()
+	defer ds.quarantine.mu.Unlock()
+
+	list := make([]Quarantine, 0, len(ds.quarantine.entries))
+	for _, q := range ds.quarantine.entries {
+		list = append(list, *q)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// ResolveQuarantinedPage records the operator decision for a failed page.
+// Both skip and rescan remove the failed page from the workspace; on rescan
+// the operator adds the replacement page before releasing the study.
+func (ds *DicomService) ResolveQuarantinedPage(id string, filename string, decision string) (*Quarantine, error) {
+	if decision != DecisionSkip && decision != DecisionRescan {
+		return nil, fmt.Errorf("invalid decision '%s', expected '%s' or '%s'", decision, DecisionSkip, DecisionRescan)
+	}
+
+	ds.quarantine.mu.Lock()
+	defer ds.quarantine.mu.Unlock()
+
+	q, err := ds.quarantine.get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range q.Pages {
+		if q.Pages[i].Filename != filename {
+			continue
+		}
+		path := filepath.Join(ds.sourceDir(q.Request), filepath.Base(filename))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove quarantined page: %v", err)
+		}
+		q.Pages[i].Decision = decision
+		ds.logger.Infof("DICOM service: Quarantine %s page %s marked as %s", id, filename, decision)
+		copied := *q
+		return &copied, nil
+	}
+	return nil, fmt.Errorf("page '%s' is not part of quarantine %s", filename, id)
+}
+
+// ReleaseQuarantine sends a held study once all failed pages are resolved.
+// The original study identifiers are kept so the study stays consistent.
+func (ds *DicomService) ReleaseQuarantine(id string) ([]FileProgress, error) {
+	ds.quarantine.mu.Lock()
+	q, err := ds.quarantine.get(id)
+	if err != nil {
+		ds.quarantine.mu.Unlock()
+		return nil, err
+	}
+	if !q.Resolved() {
+		ds.quarantine.mu.Unlock()
+		return nil, fmt.Errorf("quarantine %s has unresolved pages", id)
+	}
+	delete(ds.quarantine.entries, id)
+	ds.quarantine.mu.Unlock()
+
+	ds.logger.Infof("DICOM service: Releasing quarantined study %s", q.Study.StudyInstanceUID)
+	return ds.sendStudy(q.Request, q.Study)
+}
+
+// DiscardQuarantine drops a held study without sending; the pages stay in
+// the workspace
+func (ds *DicomService) DiscardQuarantine(id string) error {
+	ds.quarantine.mu.Lock()
+	defer ds.quarantine.mu.Unlock()
+
+	if _, err := ds.quarantine.get(id); err != nil {
+		return err
+	}
+	delete(ds.quarantine.entries, id)
+	return nil
+}
@@ -0,0 +1,163 @@
+package dicom
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"DICOMScanStation/dimse"
+)
+
+// Query information models
+const (
+	QueryModelPatient = "patient"
+	QueryModelStudy   = "study"
+)
+
+// QueryDestination is the system answering C-FIND requests, e.g. a RIS
+// providing the worklist, together with the query model it expects
+type QueryDestination struct {
+	AETitle string
+	Host    string
+	Port    int
+	// Model is "patient" (Patient Root), "study" (Study Root) or "" for
+	// Study Root with patient level searches as sent by earlier versions
+	Model string
+	// Relational allows keys of lower levels without the unique keys of
+	// the levels above
+	Relational bool
+	// CallingAETitle is the AE title the station presents to the SCP
+	CallingAETitle string
+}
+
+// ValidQueryModel reports whether model is a known query model
+func ValidQueryModel(model string) bool {
+	switch strings.ToLower(strings.TrimSpace(model)) {
+	case "", QueryModelPatient, QueryModelStudy:
+		return true
+	}
+	return false
+}
+
+// queryDestination returns the configured archive for patient and study
+// queries
+func (ds *DicomService) queryDestination() QueryDestination {
+	cfg := ds.cfg()
+	return QueryDestination{
+		AETitle:        cfg.DicomQueryAETitle,
+		Host:           cfg.DicomQueryHost,
+		Port:           cfg.DicomFindscuPort,
+		Model:          strings.ToLower(strings.TrimSpace(cfg.DicomQueryModel)),
+		Relational:     cfg.DicomQueryRelational,
+		CallingAETitle: ds.callingAETitle(cfg.DicomQueryCallingAETitle),
+	}
+}
+
+// sopClass returns the C-FIND SOP class of the query model
+func (d QueryDestination) sopClass() string {
+	if d.Model == QueryModelPatient {
+		return dimse.PatientRootFind
+	}
+	return dimse.StudyRootFind
+}
+
+// patientLevel returns the level used to search patients. Study Root has no
+// patient level, so patients are found through their studies; the same holds
+// for relational Patient Root queries, which also return the study date.
+func (d QueryDestination) patientLevel() string {
+	switch {
+	case d.Model == QueryModelStudy:
+		return "STUDY"
+	case d.Model == QueryModelPatient && d.Relational:
+		return "STUDY"
+	default:
+		return "PATIENT"
+	}
+}
+
+// Attributes used as matching and return keys
+var (
+	tagQueryRetrieveLevel = dimse.Tag(0x0008, 0x0052)
+	tagStudyDate          = dimse.Tag(0x0008, 0x0020)
+	tagStudyTime          = dimse.Tag(0x0008, 0x0030)
+	tagStudyDescription   = dimse.Tag(0x0008, 0x1030)
+	tagPatientName        = dimse.Tag(0x0010, 0x0010)
+	tagPatientID          = dimse.Tag(0x0010, 0x0020)
+	tagPatientBirthDate   = dimse.Tag(0x0010, 0x0030)
+	tagPatientSex         = dimse.Tag(0x0010, 0x0040)
+	tagStudyInstanceUID   = dimse.Tag(0x0020, 0x000D)
+)
+
+// patientReturnKeys are requested with every patient search
+var patientReturnKeys = []dimse.Element{
+	dimse.String(tagPatientName, "PN", ""),
+	dimse.String(tagPatientID, "LO", ""),
+	dimse.String(tagPatientBirthDate, "DA", ""),
+	dimse.String(tagPatientSex, "CS", ""),
+}
+
+// patientQueryKeys returns the identifier for a patient search. Study level
+// searches also request the study date; results are de-duplicated by patient
+// ID by the caller.
+func (d QueryDestination) patientQueryKeys(match dimse.Element) []dimse.Element {
+	keys := []dimse.Element{dimse.String(tagQueryRetrieveLevel, "CS", d.patientLevel()), match}
+	for _, k := range patientReturnKeys {
+		if k.Tag != match.Tag {
+			keys = append(keys, k)
+		}
+	}
+	if d.patientLevel() == "STUDY" {
+		keys = append(keys, dimse.String(tagStudyDate, "DA", ""))
+	}
+	return keys
+}
+
+// studyQueryKeys returns the identifier for a study level search of one
+// patient. Hierarchical Patient Root queries must carry the patient ID as
+// unique key of the patient level, which every caller provides.
+func (d QueryDestination) studyQueryKeys(patientID string, keys ...dimse.Element) []dimse.Element {
+	return append([]dimse.Element{
+		dimse.String(tagQueryRetrieveLevel, "CS", "STUDY"),
+		dimse.String(tagPatientID, "LO", patientID),
+	}, keys...)
+}
+
+// openQuery opens an association with the query SCP. Several C-FIND
+// requests can be sent on it before it is released.
+func (ds *DicomService) openQuery(dest QueryDestination) (*dimse.Association, error) {
+	assoc, err := dimse.Dial(net.JoinHostPort(dest.Host, strconv.Itoa(dest.Port)), dimse.Options{
+		CallingAETitle: dest.CallingAETitle,
+		CalledAETitle:  dest.AETitle,
+		Timeout:        time.Duration(ds.cfg().DicomQueryTimeout) * time.Second,
+		TLS:            ds.current().tls,
+	}, []dimse.Proposal{{
+		AbstractSyntax:   dest.sopClass(),
+		TransferSyntaxes: []string{dimse.ExplicitVRLittleEndian, dimse.ImplicitVRLittleEndian},
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to DICOM server %s at %s:%d: %v", dest.AETitle, dest.Host, dest.Port, err)
+	}
+	return assoc, nil
+}
+
+// find runs one C-FIND request on its own association and returns all
+// matches
+func (ds *DicomService) find(dest QueryDestination, keys []dimse.Element) ([]dimse.DataSet, error) {
+	assoc, err := ds.openQuery(dest)
+	if err != nil {
+		return nil, err
+	}
+	defer assoc.Release()
+
+	var matches []dimse.DataSet
+	err = assoc.Find(dest.sopClass(), ds.withCharacterSet(keys), func(match dimse.DataSet) bool {
+		matches = append(matches, ds.decodeResponse(match))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
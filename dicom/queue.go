@@ -0,0 +1,481 @@
+package dicom
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"DICOMScanStation/db"
+)
+
+// Roles of a station in the shared send queue
+const (
+	// QueueModeEnqueue hands prepared studies to the queue instead of
+	// sending them
+	QueueModeEnqueue = "enqueue"
+	// QueueModeSender stores queued studies on the PACS
+	QueueModeSender = "sender"
+)
+
+// States of a queued study
+const (
+	JobQueued  = "queued"
+	JobSending = "sending"
+	JobSent    = "sent"
+	JobFailed  = "failed"
+)
+
+// ValidQueueMode reports whether mode is a supported queue role; empty
+// sends directly
+func ValidQueueMode(mode string) bool {
+	return mode == "" || mode == QueueModeEnqueue || mode == QueueModeSender
+}
+
+var queueMigrations = []db.Migration{
+	{
+		Version: 1,
+		Name:    "create send queue",
+		Statements: []string{
+			`CREATE TABLE send_jobs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				station TEXT NOT NULL,
+				request TEXT NOT NULL,
+				study TEXT NOT NULL,
+				instances INTEGER NOT NULL,
+				state TEXT NOT NULL,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				last_error TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL,
+				next_attempt_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX send_jobs_state ON send_jobs (state, next_attempt_at)`,
+			`CREATE TABLE send_job_instances (
+				job_id INTEGER NOT NULL REFERENCES send_jobs (id) ON DELETE CASCADE,
+				instance_number INTEGER NOT NULL,
+				sop_instance_uid TEXT NOT NULL,
+				data BLOB NOT NULL,
+				sent INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (job_id, instance_number)
+			)`,
+		},
+		Postgres: []string{
+			`CREATE TABLE send_jobs (
+				id BIGSERIAL PRIMARY KEY,
+				station TEXT NOT NULL,
+				request TEXT NOT NULL,
+				study TEXT NOT NULL,
+				instances INTEGER NOT NULL,
+				state TEXT NOT NULL,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				last_error TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL,
+				next_attempt_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX send_jobs_state ON send_jobs (state, next_attempt_at)`,
+			`CREATE TABLE send_job_instances (
+				job_id BIGINT NOT NULL REFERENCES send_jobs (id) ON DELETE CASCADE,
+				instance_number INTEGER NOT NULL,
+				sop_instance_uid TEXT NOT NULL,
+				data BYTEA NOT NULL,
+				sent INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (job_id, instance_number)
+			)`,
+		},
+	},
+}
+
+// QueuedJob is a study in the shared send queue
+type QueuedJob struct {
+	ID               int64     `json:"id"`
+	Station          string    `json:"station"`
+	PatientID        string    `json:"patientId"`
+	PatientName      string    `json:"patientName"`
+	Description      string    `json:"description"`
+	StudyInstanceUID string    `json:"studyInstanceUid"`
+	Instances        int       `json:"instances"`
+	State            string    `json:"state"`
+	Attempts         int       `json:"attempts"`
+	LastError        string    `json:"lastError,omitempty"`
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// sendQueue keeps queued studies and their instances in the database
+type sendQueue struct {
+	db *db.DB
+}
+
+// EnableQueue connects the service to the shared send queue. Depending on
+// SEND_QUEUE_MODE studies are enqueued or RunQueueSender stores them.
+func (ds *DicomService) EnableQueue(database *db.DB) error {
+	if err := database.Migrate("send_queue", queueMigrations); err != nil {
+		return err
+	}
+	ds.queue = &sendQueue{db: database}
+	return nil
+}
+
+// queueing reports whether studies go to the shared queue instead of the PACS
+func (ds *DicomService) queueing() bool {
+	return ds.queue != nil && ds.cfg().SendQueueMode == QueueModeEnqueue
+}
+
+// enqueueStudy stores the prepared instances of a study in the queue as one
+// job and removes the local files once the job is committed
+func (ds *DicomService) enqueueStudy(req SendRequest, study StudyIdentifiers, prepared []preparedFile, progress []FileProgress) ([]FileProgress, error) {
+	err := ds.queue.add(ds.cfg().DicomStationName, req, study, prepared, progress)
+	if err != nil {
+		ds.logger.Errorf("DICOM service: Failed to queue study %s: %v", study.StudyInstanceUID, err)
+		for _, p := range prepared {
+			os.Remove(p.dcmFile)
+			progress[p.index].Status = "failed"
+			progress[p.index].Message = fmt.Sprintf("Queueing failed: %v", err)
+			progress[p.index].Progress = 0
+		}
+		return progress, fmt.Errorf("failed to queue study: %v", err)
+	}
+
+	for _, p := range prepared {
+		ds.cleanupPrepared(p)
+		progress[p.index].Status = "completed"
+		progress[p.index].Message = "Queued for the central sender"
+		progress[p.index].Progress = 100
+	}
+
+	ds.logger.Infof("DICOM service: Queued study %s with %d instance(s)", study.StudyInstanceUID, len(prepared))
+	return progress, nil
+}
+
+func (q *sendQueue) add(station string, req SendRequest, study StudyIdentifiers, prepared []preparedFile, progress []FileProgress) error {
+	reqData, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	studyData, err := json.Marshal(study)
+	if err != nil {
+		return err
+	}
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var id int64
+	err = tx.QueryRow(q.db.Rebind(`INSERT INTO send_jobs
+		(station, request, study, instances, state, created_at, updated_at, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+		station, string(reqData), string(studyData), len(prepared), JobQueued, now, now, now).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range prepared {
+		data, err := os.ReadFile(p.dcmFile)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(q.db.Rebind(`INSERT INTO send_job_instances (job_id, instance_number, sop_instance_uid, data) VALUES (?, ?, ?, ?)`),
+			id, p.index+1, progress[p.index].SOPInstanceUID, data)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// QueuedJobs returns the most recent jobs of the shared send queue
+func (ds *DicomService) QueuedJobs(limit int) ([]QueuedJob, error) {
+	if ds.queue == nil {
+		return nil, fmt.Errorf("send queue is not enabled")
+	}
+	return ds.queue.jobs(limit)
+}
+
+func (q *sendQueue) jobs(limit int) ([]QueuedJob, error) {
+	rows, err := q.db.Query(q.db.Rebind(`SELECT j.id, j.station, j.request, j.study, j.state, j.attempts, j.last_error, j.created_at, j.updated_at, j.instances
+		FROM send_jobs j ORDER BY j.id DESC LIMIT ?`), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []QueuedJob{}
+	for rows.Next() {
+		var job QueuedJob
+		var reqData, studyData string
+		if err := rows.Scan(&job.ID, &job.Station, &reqData, &studyData, &job.State, &job.Attempts, &job.LastError, &job.CreatedAt, &job.UpdatedAt, &job.Instances); err != nil {
+			return nil, err
+		}
+		var req SendRequest
+		var study StudyIdentifiers
+		json.Unmarshal([]byte(reqData), &req)
+		json.Unmarshal([]byte(studyData), &study)
+		job.PatientID = req.Patient.PatientID
+		job.PatientName = req.Patient.Name
+		job.Description = req.Description
+		job.StudyInstanceUID = study.StudyInstanceUID
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// RunQueueSender stores queued studies on the PACS until ctx is cancelled.
+// Only the designated sender node runs it.
+func (ds *DicomService) RunQueueSender(ctx context.Context) {
+	// Jobs interrupted by a restart of the sender are sent again; instances
+	// already stored are skipped
+	if err := ds.queue.requeueInterrupted(); err != nil {
+		ds.logger.Warnf("DICOM service: Failed to requeue interrupted jobs: %v", err)
+	}
+
+	ticker := time.NewTicker(time.Duration(ds.cfg().SendQueuePollInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			sent, err := ds.sendNextJob()
+			if err != nil {
+				ds.logger.Warnf("DICOM service: Send queue: %v", err)
+				break
+			}
+			if !sent {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *sendQueue) requeueInterrupted() error {
+	_, err := q.db.Exec(q.db.Rebind(`UPDATE send_jobs SET state = ? WHERE state = ?`), JobQueued, JobSending)
+	return err
+}
+
+// claim marks the next due job as sending and returns its ID, or 0 if no
+// job is due
+func (q *sendQueue) claim() (int64, error) {
+	now := time.Now().UTC()
+	for {
+		var id int64
+		err := q.db.QueryRow(q.db.Rebind(`SELECT id FROM send_jobs WHERE state = ? AND next_attempt_at <= ? ORDER BY id LIMIT 1`), JobQueued, now).Scan(&id)
+		if err == sql.ErrNoRows {
+			return 0, nil
+		} else if err != nil {
+			return 0, err
+		}
+
+		res, err := q.db.Exec(q.db.Rebind(`UPDATE send_jobs SET state = ?, attempts = attempts + 1, updated_at = ? WHERE id = ? AND state = ?`),
+			JobSending, now, id, JobQueued)
+		if err != nil {
+			return 0, err
+		}
+		// Another sender may have claimed it in the meantime
+		if n, _ := res.RowsAffected(); n == 1 {
+			return id, nil
+		}
+	}
+}
+
+// sendNextJob sends one due job and reports whether there was one
+func (ds *DicomService) sendNextJob() (bool, error) {
+	id, err := ds.queue.claim()
+	if err != nil || id == 0 {
+		return false, err
+	}
+
+	var station, reqData, studyData string
+	var attempts int
+	err = ds.queue.db.QueryRow(ds.queue.db.Rebind(`SELECT station, request, study, attempts FROM send_jobs WHERE id = ?`), id).
+		Scan(&station, &reqData, &studyData, &attempts)
+	if err != nil {
+		return true, err
+	}
+	var req SendRequest
+	var study StudyIdentifiers
+	if err := json.Unmarshal([]byte(reqData), &req); err != nil {
+		return true, ds.queue.finish(id, JobFailed, fmt.Sprintf("invalid request: %v", err))
+	}
+	if err := json.Unmarshal([]byte(studyData), &study); err != nil {
+		return true, ds.queue.finish(id, JobFailed, fmt.Sprintf("invalid study: %v", err))
+	}
+
+	ds.logger.Infof("DICOM service: Sending queued study %s from station %s (attempt %d)", study.StudyInstanceUID, station, attempts)
+
+	startedAt := time.Now()
+	progress, sendErr := ds.sendJobInstances(id, req, study)
+
+	result := StudyResult{
+		Request:    req,
+		Study:      study,
+		Progress:   progress,
+		StartedAt:  startedAt,
+		FinishedAt: time.Now(),
+		Err:        sendErr,
+		Station:    station,
+	}
+	for _, p := range progress {
+		switch p.Status {
+		case "completed":
+			result.Completed++
+		case "failed":
+			result.Failed++
+		}
+	}
+
+	if sendErr == nil && result.Failed == 0 {
+		ds.notify(result)
+		return true, ds.queue.finish(id, JobSent, "")
+	}
+
+	var lastError string
+	if sendErr != nil {
+		lastError = sendErr.Error()
+	} else {
+		for _, p := range progress {
+			if p.Status == "failed" {
+				lastError = fmt.Sprintf("%d instance(s) not stored: %s", result.Failed, p.Message)
+				break
+			}
+		}
+	}
+	if attempts >= ds.cfg().SendQueueMaxAttempts {
+		ds.logger.Errorf("DICOM service: Giving up on queued study %s after %d attempts: %s", study.StudyInstanceUID, attempts, lastError)
+		ds.notify(result)
+		return true, ds.queue.finish(id, JobFailed, lastError)
+	}
+
+	ds.logger.Warnf("DICOM service: Queued study %s not sent, retrying later: %s", study.StudyInstanceUID, lastError)
+	return true, ds.queue.retry(id, attempts, lastError)
+}
+
+// sendJobInstances stores the instances of a job not yet sent by an earlier
+// attempt
+func (ds *DicomService) sendJobInstances(id int64, req SendRequest, study StudyIdentifiers) ([]FileProgress, error) {
+	rows, err := ds.queue.db.Query(ds.queue.db.Rebind(`SELECT instance_number, sop_instance_uid FROM send_job_instances WHERE job_id = ? AND sent = 0 ORDER BY instance_number`), id)
+	if err != nil {
+		return nil, err
+	}
+	type pendingInstance struct {
+		number int
+		uid    string
+	}
+	var instances []pendingInstance
+	for rows.Next() {
+		var inst pendingInstance
+		if err := rows.Scan(&inst.number, &inst.uid); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		instances = append(instances, inst)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tempDir, err := os.MkdirTemp(ds.cfg().TempFilesDir, "queue-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	session := ds.openStore(ds.storeDestination(req.DocumentCreator))
+	defer session.close()
+	progress := make([]FileProgress, len(instances))
+	for i, inst := range instances {
+		progress[i] = FileProgress{Filename: fmt.Sprintf("%d.dcm", inst.number), SOPInstanceUID: inst.uid}
+
+		var data []byte
+		err := ds.queue.db.QueryRow(ds.queue.db.Rebind(`SELECT data FROM send_job_instances WHERE job_id = ? AND instance_number = ?`), id, inst.number).Scan(&data)
+		if err != nil {
+			return progress[:i], err
+		}
+		dcmFile := filepath.Join(tempDir, progress[i].Filename)
+		if err := os.WriteFile(dcmFile, data, 0644); err != nil {
+			return progress[:i], err
+		}
+
+		status, err := session.store(dcmFile)
+		if status != 0 || err == nil {
+			progress[i].StoreStatus = storeStatus(status)
+		}
+		if err != nil {
+			ds.logger.Errorf("DICOM service: Failed to send queued instance %s: %v", inst.uid, err)
+			progress[i].Status = "failed"
+			progress[i].Message = fmt.Sprintf("Upload failed: %v", err)
+			continue
+		}
+		progress[i].Archive = session.dest.String()
+		ds.archiveInstance(req, study, dcmFile, inst.uid)
+
+		_, err = ds.queue.db.Exec(ds.queue.db.Rebind(`UPDATE send_job_instances SET sent = 1 WHERE job_id = ? AND instance_number = ?`), id, inst.number)
+		if err != nil {
+			return progress[:i+1], err
+		}
+		progress[i].Status = "completed"
+		progress[i].Message = "Successfully uploaded to PACs"
+		progress[i].Progress = 100
+	}
+	return progress, nil
+}
+
+func (q *sendQueue) finish(id int64, state, lastError string) error {
+	_, err := q.db.Exec(q.db.Rebind(`UPDATE send_jobs SET state = ?, last_error = ?, updated_at = ? WHERE id = ?`),
+		state, lastError, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if state == JobSent {
+		// The instances are on the PACS; keep only the job record
+		_, err = q.db.Exec(q.db.Rebind(`DELETE FROM send_job_instances WHERE job_id = ?`), id)
+	}
+	return err
+}
+
+// retry puts a job back into the queue with a backoff of one minute per
+// attempt, up to 15 minutes
+func (q *sendQueue) retry(id int64, attempts int, lastError string) error {
+	backoff := time.Duration(attempts) * time.Minute
+	if backoff > 15*time.Minute {
+		backoff = 15 * time.Minute
+	}
+	now := time.Now().UTC()
+	_, err := q.db.Exec(q.db.Rebind(`UPDATE send_jobs SET state = ?, last_error = ?, updated_at = ?, next_attempt_at = ? WHERE id = ?`),
+		JobQueued, lastError, now, now.Add(backoff), id)
+	return err
+}
+
+// ErrJobNotFound is returned for unknown or not failed jobs
+var ErrJobNotFound = errors.New("no failed job with this ID")
+
+// RetryQueuedJob puts a failed job back into the queue
+func (ds *DicomService) RetryQueuedJob(id int64) error {
+	if ds.queue == nil {
+		return fmt.Errorf("send queue is not enabled")
+	}
+	now := time.Now().UTC()
+	res, err := ds.queue.db.Exec(ds.queue.db.Rebind(`UPDATE send_jobs SET state = ?, attempts = 0, updated_at = ?, next_attempt_at = ? WHERE id = ? AND state = ?`),
+		JobQueued, now, now, id, JobFailed)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
@@ -3,16 +3,25 @@ package dicom
 import (
 	"context"
 	"crypto/rand"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"DICOMScanStation/archive"
 	"DICOMScanStation/config"
+	"DICOMScanStation/dimse"
+	"DICOMScanStation/logging"
+	"DICOMScanStation/ocr"
+	"DICOMScanStation/tracing"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type PatientInfo struct {
@@ -24,24 +33,106 @@ type PatientInfo struct {
 }
 
 type DicomService struct {
+	// state is replaced as a whole by Reconfigure
+	state      atomic.Pointer[serviceState]
+	logger     *logrus.Logger
+	quarantine *quarantineStore
+	archive    *archive.Store
+	observers  []SendObserver
+	// pool keeps store associations open between documents, nil if disabled
+	pool *associationPool
+	// queue is the shared send queue, nil if disabled
+	queue *sendQueue
+	// outbox keeps instances the PACS could not take for another attempt,
+	// nil if disabled
+	outbox *outbox
+	// commitListener receives storage commitment reports, nil if not
+	// started
+	commitListener *dimse.Listener
+	commitments    commitmentWaiters
+	// ocr recognizes the text of the pages, nil if disabled
+	ocr *ocr.Engine
+}
+
+// serviceState is the configuration of the service and what is built from
+// it
+type serviceState struct {
 	config *config.Config
-	logger *logrus.Logger
+	// calling AE titles by lower-case institution name
+	institutionAEs map[string]string
+	// tls encrypts query and store associations, nil if disabled
+	tls *tls.Config
+	// uids creates the UIDs of studies, series and instances
+	uids *UIDGenerator
+	// templates hold the attributes of each document type
+	templates *TagTemplates
+}
+
+// newServiceState builds the state of cfg. Invalid settings are rejected
+// by the checks at startup and before a reload.
+func newServiceState(cfg *config.Config) *serviceState {
+	institutionAEs, _ := config.ParseInstitutionAETitles(cfg.DicomInstitutionAETitles)
+	tlsConfig, _ := LoadTLSConfig(cfg)
+	uids, _ := NewUIDGenerator(cfg.DicomUIDRoot)
+	templates, _ := LoadTagTemplates(cfg)
+	return &serviceState{
+		config:         cfg,
+		institutionAEs: institutionAEs,
+		tls:            tlsConfig,
+		uids:           uids,
+		templates:      templates,
+	}
 }
 
 func NewDicomService(cfg *config.Config) *DicomService {
-	return &DicomService{
-		config: cfg,
-		logger: logrus.New(),
+	ds := &DicomService{
+		logger:     logging.New(),
+		quarantine: newQuarantineStore(),
+	}
+	ds.state.Store(newServiceState(cfg))
+	if cfg.DicomAssociationPool {
+		ds.pool = newAssociationPool(time.Duration(cfg.DicomAssociationIdleTimeout)*time.Second, ds.logger)
 	}
+	if cfg.OCREnabled {
+		ds.ocr = ocr.NewEngine(cfg.OCRTesseractPath, cfg.OCRLanguages, time.Duration(cfg.OCRTimeout)*time.Second)
+	}
+	return ds
+}
+
+// current returns the state of the current configuration
+func (ds *DicomService) current() *serviceState {
+	return ds.state.Load()
+}
+
+// cfg returns the current configuration
+func (ds *DicomService) cfg() *config.Config {
+	return ds.current().config
+}
+
+// Reconfigure applies changed PACS hosts, ports and AE titles and rebuilds
+// the TLS configuration, institution AE titles, UID generator and tag
+// templates. Sends and queries already running finish with the previous
+// ones; idle associations are released when TLS changed. The storage
+// commitment listener keeps its certificate until a restart.
+func (ds *DicomService) Reconfigure(cfg *config.Config) {
+	previous := ds.state.Swap(newServiceState(cfg))
+	if ds.pool != nil && !sameTLS(previous.config, cfg) {
+		ds.pool.close()
+	}
+}
+
+// TagTemplates returns the tag templates by document type
+func (ds *DicomService) TagTemplates() map[string]map[string]string {
+	return ds.current().templates.All()
 }
 
 func (ds *DicomService) SearchPatients(searchTerm string, searchType string) ([]PatientInfo, error) {
-	ds.logger.Infof("DICOM service: Searching for patients with term: %s (type: %s)", searchTerm, searchType)
+	ds.logger.WithField(logging.FieldSearchTerm, searchTerm).Infof("DICOM service: Searching for patients (type: %s)", searchType)
 
 	var searchPatterns []string
 
-	if searchType == "birthdate" {
-		// For birthdate search, use exact match
+	if searchType == "birthdate" || searchType == "id" {
+		// For birthdate and patient ID search, use exact match
 		searchPatterns = []string{searchTerm}
 	} else {
 		// For name search, try multiple patterns
@@ -52,119 +143,51 @@ func (ds *DicomService) SearchPatients(searchTerm string, searchType string) ([]
 		}
 	}
 
-	ds.logger.Debugf("DICOM service: Trying search patterns: %v for term: %s", searchPatterns, searchTerm)
+	ds.logger.WithField(logging.FieldSearchTerm, searchTerm).Debugf("DICOM service: Trying %d search patterns", len(searchPatterns))
+
+	dest := ds.queryDestination()
+	// All patterns are sent on one association
+	assoc, err := ds.openQuery(dest)
+	if err != nil {
+		ds.logger.Errorf("DICOM service: %v", err)
+		return nil, err
+	}
+	defer assoc.Release()
 
 	// Try each search pattern and collect all unique results
 	var allPatients []PatientInfo
 	seenPatients := make(map[string]bool) // Track unique patients by ID
 
 	for _, pattern := range searchPatterns {
-		ds.logger.Debugf("DICOM service: Trying pattern: %s", pattern)
-
-		// Build the findscu command based on search type
-		var cmd *exec.Cmd
-		if searchType == "birthdate" {
-			cmd = exec.Command(
-				ds.config.DcmtkPath+"/findscu",
-				"-v",                                // Verbose output
-				"-S",                                // Enable searching
-				"-aet", ds.config.DicomLocalAETitle, // Local AE Title (calling)
-				"-aec", ds.config.DicomQueryAETitle, // Remote AE Title for Query operations
-				"-k", "QueryRetrieveLevel=PATIENT", // Query level
-				"-k", "PatientName", // Request Patient Name
-				"-k", "PatientID", // Request Patient ID
-				"-k", fmt.Sprintf("PatientBirthDate=%s", pattern), // Patient birthdate search
-				"-k", "PatientSex", // Request Patient Sex
-				ds.config.DicomRemoteHost,                     // Remote host (at the end)
-				fmt.Sprintf("%d", ds.config.DicomFindscuPort), // Remote port (at the end)
-			)
-		} else {
-			// Name search
-			cmd = exec.Command(
-				ds.config.DcmtkPath+"/findscu",
-				"-v",                                // Verbose output
-				"-S",                                // Enable searching
-				"-aet", ds.config.DicomLocalAETitle, // Local AE Title (calling)
-				"-aec", ds.config.DicomQueryAETitle, // Remote AE Title for Query operations
-				"-k", "QueryRetrieveLevel=PATIENT", // Query level
-				"-k", fmt.Sprintf("PatientName=%s", pattern), // Patient name search with pattern
-				"-k", "PatientID", // Request Patient ID
-				"-k", "PatientBirthDate", // Request Patient Birth Date
-				"-k", "PatientSex", // Request Patient Sex
-				ds.config.DicomRemoteHost,                     // Remote host (at the end)
-				fmt.Sprintf("%d", ds.config.DicomFindscuPort), // Remote port (at the end)
-			)
-		}
-
-		ds.logger.Debugf("DICOM service: Executing command: %s", strings.Join(cmd.Args, " "))
-
-		// Set timeout for the command
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		cmd = exec.CommandContext(ctx, cmd.Path, cmd.Args[1:]...)
-
-		ds.logger.Debugf("DICOM service: Final command args: %v", cmd.Args)
-
-		// Capture both stdout and stderr
-		output, err := cmd.CombinedOutput()
-
-		if err != nil {
-			ds.logger.Debugf("DICOM service: Pattern %s failed: %v", pattern, err)
-			ds.logger.Debugf("DICOM service: Command output: %s", string(output))
-
-			// Check for connection errors based on findscu output
-			outputStr := string(output)
-			if strings.Contains(outputStr, "Association Request Failed") {
-				// Return the exact findscu error message
-				ds.logger.Errorf("DICOM service: findscu error: %s", outputStr)
-				return nil, fmt.Errorf("DICOM error: %s", strings.TrimSpace(outputStr))
-			}
-
-			continue // Try next pattern
+		ds.logger.WithField(logging.FieldSearchTerm, pattern).Debugf("DICOM service: Trying pattern")
+
+		var match dimse.Element
+		switch searchType {
+		case "birthdate":
+			match = dimse.String(tagPatientBirthDate, "DA", pattern) // Patient birthdate search
+		case "id":
+			match = dimse.String(tagPatientID, "LO", pattern) // Patient ID search
+		default:
+			match = dimse.String(tagPatientName, "PN", pattern) // Patient name search with pattern
 		}
 
-		ds.logger.Debugf("DICOM service: Pattern %s output: %s", pattern, string(output))
-
-		// Parse the output to extract patient information
-		patients, err := ds.parseFindscuOutput(string(output))
-		if err != nil {
-			ds.logger.Debugf("DICOM service: Failed to parse output for pattern %s: %v", pattern, err)
-			continue // Try next pattern
-		}
-
-		// Add unique patients to the result
-		for _, patient := range patients {
-			if patient.PatientID != "" && !seenPatients[patient.PatientID] {
+		err := assoc.Find(dest.sopClass(), ds.withCharacterSet(dest.patientQueryKeys(match)), func(response dimse.DataSet) bool {
+			patient := patientFromDataSet(ds.decodeResponse(response))
+			// Add unique patients to the result
+			if patient.Name != "" && patient.PatientID != "" && !seenPatients[patient.PatientID] {
 				allPatients = append(allPatients, patient)
 				seenPatients[patient.PatientID] = true
 			}
+			return true
+		})
+		var statusErr *dimse.StatusError
+		if errors.As(err, &statusErr) {
+			ds.logger.WithField(logging.FieldSearchTerm, pattern).Debugf("DICOM service: Pattern failed: %v", err)
+			continue // Try next pattern
 		}
-	}
-
-	// If no patients found and we tried all patterns, check if it was due to connection issues
-	if len(allPatients) == 0 {
-		ds.logger.Warn("DICOM service: No patients found after trying all patterns")
-		// Try a simple connection test
-		testCmd := exec.Command(
-			ds.config.DcmtkPath+"/findscu",
-			"-v",
-			"-S",
-			"-aet", ds.config.DicomLocalAETitle,
-			"-aec", ds.config.DicomQueryAETitle,
-			"-k", "QueryRetrieveLevel=PATIENT",
-			"-k", "PatientName=*",
-			ds.config.DicomRemoteHost,
-			fmt.Sprintf("%d", ds.config.DicomFindscuPort),
-		)
-
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		testCmd = exec.CommandContext(ctx, testCmd.Path, testCmd.Args[1:]...)
-
-		_, testErr := testCmd.CombinedOutput()
-		if testErr != nil {
-			ds.logger.Errorf("DICOM service: Connection test failed: %v", testErr)
-			return nil, fmt.Errorf("unable to connect to DICOM server at %s:%d", ds.config.DicomRemoteHost, ds.config.DicomFindscuPort)
+		if err != nil {
+			ds.logger.Errorf("DICOM service: C-FIND failed: %v", err)
+			return nil, fmt.Errorf("DICOM error: %v", err)
 		}
 	}
 
@@ -172,130 +195,212 @@ func (ds *DicomService) SearchPatients(searchTerm string, searchType string) ([]
 	return allPatients, nil
 }
 
-func (ds *DicomService) parseFindscuOutput(output string) ([]PatientInfo, error) {
-	var patients []PatientInfo
-
-	lines := strings.Split(output, "\n")
-	var currentPatient *PatientInfo
-	inResponse := false
+// patientFromDataSet reads a C-FIND response of a patient search
+func patientFromDataSet(response dimse.DataSet) PatientInfo {
+	return PatientInfo{
+		PatientID: response.Text(tagPatientID),
+		Name:      response.Text(tagPatientName),
+		BirthDate: response.Text(tagPatientBirthDate),
+		Gender:    response.Text(tagPatientSex),
+		StudyDate: response.Text(tagStudyDate),
+	}
+}
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
+type FileProgress struct {
+	Filename       string `json:"filename"`
+	Status         string `json:"status"` // "converting", "updating", "sending", "completed", "stored", "failed"
+	Message        string `json:"message"`
+	Progress       int    `json:"progress"` // 0-100
+	SOPInstanceUID string `json:"sopInstanceUid,omitempty"`
+	// StoreStatus is the C-STORE status returned by the SCP, e.g. 0x0000
+	StoreStatus string `json:"storeStatus,omitempty"`
+	// Commitment is the storage commitment state of the instance, see
+	// CommitmentCommitted, if DICOM_STORAGE_COMMITMENT is enabled
+	Commitment string `json:"commitment,omitempty"`
+	// Archive is the archive that stored the instance, AE@host:port; it
+	// differs from the store system after a failover
+	Archive string `json:"archive,omitempty"`
+}
 
-		// Look for "Find Response:" to start parsing a new patient
-		if strings.Contains(line, "Find Response:") {
-			if currentPatient != nil && currentPatient.Name != "" {
-				patients = append(patients, *currentPatient)
-			}
-			currentPatient = &PatientInfo{}
-			inResponse = true
-			continue
-		}
+// AtomicSendError is returned when an atomic upload did not store every
+// instance. StoredInstances lists what already reached the PACS and may need
+// to be removed there.
+type AtomicSendError struct {
+	StudyInstanceUID string   `json:"studyInstanceUid"`
+	StoredInstances  []string `json:"storedInstances"`
+	Failed           int      `json:"failed"`
+}
 
-		// Skip lines that are not part of a response
-		if !inResponse {
-			continue
-		}
+func (e *AtomicSendError) Error() string {
+	return fmt.Sprintf("atomic send of study %s failed: %d instance(s) not stored, %d already stored", e.StudyInstanceUID, e.Failed, len(e.StoredInstances))
+}
 
-		// Look for patient information in the output
-		if strings.Contains(line, "PatientName") {
-			// Extract patient name from line like: (0010,0010) PN [Rubo DEMO ]
-			if idx := strings.Index(line, "["); idx != -1 {
-				if endIdx := strings.Index(line, "]"); endIdx != -1 {
-					name := strings.TrimSpace(line[idx+1 : endIdx])
-					if name != "*" && name != "" { // Skip wildcard and empty names
-						currentPatient.Name = name
-					}
-				}
-			}
-		} else if strings.Contains(line, "PatientID") && currentPatient != nil {
-			// Extract patient ID
-			if idx := strings.Index(line, "["); idx != -1 {
-				if endIdx := strings.Index(line, "]"); endIdx != -1 {
-					currentPatient.PatientID = strings.TrimSpace(line[idx+1 : endIdx])
-				}
-			}
-		} else if strings.Contains(line, "PatientBirthDate") && currentPatient != nil {
-			// Extract birth date
-			if idx := strings.Index(line, "["); idx != -1 {
-				if endIdx := strings.Index(line, "]"); endIdx != -1 {
-					currentPatient.BirthDate = strings.TrimSpace(line[idx+1 : endIdx])
-				}
-			}
-		} else if strings.Contains(line, "PatientSex") && currentPatient != nil {
-			// Extract gender
-			ds.logger.Debugf("DICOM service: Found PatientSex line: %s", line)
-			if idx := strings.Index(line, "["); idx != -1 {
-				if endIdx := strings.Index(line, "]"); endIdx != -1 {
-					currentPatient.Gender = strings.TrimSpace(line[idx+1 : endIdx])
-					ds.logger.Debugf("DICOM service: Extracted gender: '%s'", currentPatient.Gender)
-				}
-			}
-		} else if strings.Contains(line, "StudyDate") && currentPatient != nil {
-			// Extract study date
-			if idx := strings.Index(line, "["); idx != -1 {
-				if endIdx := strings.Index(line, "]"); endIdx != -1 {
-					currentPatient.StudyDate = strings.TrimSpace(line[idx+1 : endIdx])
-				}
-			}
-		}
+func (ds *DicomService) generateStudyID() string {
+	// Generate a unique StudyID using timestamp and random bytes
+	timestamp := time.Now().Format("20060102150405")
+	randomBytes := make([]byte, 4)
+	rand.Read(randomBytes)
+	randomHex := fmt.Sprintf("%x", randomBytes)
+	return fmt.Sprintf("STUDY_%s_%s", timestamp, randomHex)
+}
 
-		// Check for end of response (empty line or new section)
-		if line == "" && inResponse {
-			inResponse = false
+func (ds *DicomService) SendToPacs(req SendRequest) ([]FileProgress, error) {
+	// Appending to a study the operator picked is never a duplicate
+	if req.StudyInstanceUID != "" {
+		study, err := ds.existingStudy(req.Patient.PatientID, req.StudyInstanceUID)
+		if err != nil {
+			return nil, err
 		}
+		return ds.sendStudy(req, study)
 	}
 
-	// Add the last patient if exists
-	if currentPatient != nil && currentPatient.Name != "" {
-		patients = append(patients, *currentPatient)
+	if ds.cfg().DicomDuplicateCheck && !req.Force {
+		duplicates, err := ds.FindDuplicateStudies(req)
+		if err != nil {
+			// An unreachable query service must not block sending
+			ds.logger.Warnf("DICOM service: Duplicate check failed, sending anyway: %v", err)
+		} else if len(duplicates) > 0 {
+			ds.logger.WithField(logging.FieldPatientID, req.Patient.PatientID).Warnf("DICOM service: Possible duplicate: %d matching study(s)", len(duplicates))
+			return nil, &DuplicateStudyError{Matches: duplicates}
+		}
 	}
 
-	// If no patients found in output, return empty list
-	if len(patients) == 0 {
-		ds.logger.Warn("DICOM service: No patients found in findscu output")
-		return []PatientInfo{}, nil
-	}
+	return ds.sendStudy(req, ds.newStudy())
+}
 
-	ds.logger.Debugf("DICOM service: Parsed %d patients from output", len(patients))
-	return patients, nil
+// SendRequest holds the operator input for one PACS upload
+type SendRequest struct {
+	PatientIDs      []string    `json:"patientIds"`
+	DocumentCreator string      `json:"documentCreator"`
+	Description     string      `json:"description"`
+	FilePaths       []string    `json:"filePaths"`
+	Patient         PatientInfo `json:"selectedPatient"`
+	// Atomic fails the whole study if any instance is not stored and keeps
+	// all local files
+	Atomic bool `json:"atomic"`
+	// Force skips the duplicate study check after the operator confirmed
+	Force bool `json:"force"`
+	// Format is "images", "pdf" or "multiframe"; empty uses
+	// DICOM_SEND_FORMAT
+	Format string `json:"format,omitempty"`
+	// StudyInstanceUID appends the pages as a new series to this existing
+	// study of the patient; empty creates a new study
+	StudyInstanceUID string `json:"studyInstanceUid,omitempty"`
+	// Operator and BatchStartedAt are filled in by the server for reporting
+	Operator       string    `json:"operator,omitempty"`
+	BatchStartedAt time.Time `json:"batchStartedAt,omitempty"`
+	// SourceDir holds the pages to send; empty means the scan workspace
+	SourceDir string `json:"-"`
+	// OnProgress receives a copy of the progress whenever a file changes
+	// its status; nil if no one follows the send
+	OnProgress func([]FileProgress) `json:"-"`
+	// Trace holds the span the send is part of; nil starts a new trace
+	Trace context.Context `json:"-"`
 }
 
-type FileProgress struct {
-	Filename string `json:"filename"`
-	Status   string `json:"status"` // "converting", "updating", "sending", "completed", "failed"
-	Message  string `json:"message"`
-	Progress int    `json:"progress"` // 0-100
+// reportProgress passes the current progress to the caller following the
+// send
+func (req SendRequest) reportProgress(progress []FileProgress) {
+	if req.OnProgress == nil {
+		return
+	}
+	snapshot := make([]FileProgress, len(progress))
+	copy(snapshot, progress)
+	req.OnProgress(snapshot)
 }
 
-func (ds *DicomService) generateStudyID() string {
-	// Generate a unique StudyID using timestamp and random bytes
-	timestamp := time.Now().Format("20060102150405")
-	randomBytes := make([]byte, 4)
-	rand.Read(randomBytes)
-	randomHex := fmt.Sprintf("%x", randomBytes)
-	return fmt.Sprintf("STUDY_%s_%s", timestamp, randomHex)
+// sourceDir returns the directory the pages of req are taken from
+func (ds *DicomService) sourceDir(req SendRequest) string {
+	if req.SourceDir != "" {
+		return req.SourceDir
+	}
+	return ds.cfg().TempFilesDir
 }
 
-func (ds *DicomService) SendToPacs(patientIDs []string, documentCreator string, description string, filePaths []string, selectedPatient PatientInfo) ([]FileProgress, error) {
-	ds.logger.Infof("DICOM service: Starting PACs upload process")
-	ds.logger.Infof("DICOM service: Selected patient: %+v", selectedPatient)
-	ds.logger.Infof("DICOM service: Document creator: %s", documentCreator)
-	ds.logger.Infof("DICOM service: Study description: %s", description)
-	ds.logger.Infof("DICOM service: Files to process: %v", filePaths)
+// StudyIdentifiers are generated once per upload and reused when a held
+// study is released after quarantine
+type StudyIdentifiers struct {
+	StudyID           string `json:"studyId"`
+	StudyInstanceUID  string `json:"studyInstanceUid"`
+	SeriesInstanceUID string `json:"seriesInstanceUid"`
+	// Appended is set when the pages form a new series of an existing
+	// study, whose attributes below the instances keep
+	Appended         bool   `json:"appended,omitempty"`
+	StudyDate        string `json:"studyDate,omitempty"`
+	StudyTime        string `json:"studyTime,omitempty"`
+	StudyDescription string `json:"studyDescription,omitempty"`
+	AccessionNumber  string `json:"accessionNumber,omitempty"`
+	SeriesNumber     int    `json:"seriesNumber,omitempty"`
+}
 
+func (ds *DicomService) newStudy() StudyIdentifiers {
 	// Generate a unique StudyID and Study Instance UID for this upload session
 	studyID := ds.generateStudyID()
-	timestamp := time.Now().Format("20060102150405")
-	studyInstanceUID := fmt.Sprintf("1.2.840.10008.1.2.3.%s", timestamp)
-	seriesInstanceUID := fmt.Sprintf("%s.1", studyInstanceUID)
+	studyInstanceUID := ds.current().uids.New()
+	seriesInstanceUID := ds.current().uids.New()
 
 	ds.logger.Infof("DICOM service: Generated StudyID: %s", studyID)
 	ds.logger.Infof("DICOM service: Generated Study Instance UID: %s", studyInstanceUID)
 	ds.logger.Infof("DICOM service: Generated Series Instance UID: %s", seriesInstanceUID)
 
+	return StudyIdentifiers{
+		StudyID:           studyID,
+		StudyInstanceUID:  studyInstanceUID,
+		SeriesInstanceUID: seriesInstanceUID,
+	}
+}
+
+// preparedFile is a page that was converted and tagged successfully
+type preparedFile struct {
+	index   int
+	jpgFile string
+	dcmFile string
+	// pages are the further pages of an Encapsulated PDF instance, with
+	// their index in the progress
+	pages []documentPage
+}
+
+func (ds *DicomService) sendStudy(req SendRequest, study StudyIdentifiers) ([]FileProgress, error) {
+	startedAt := time.Now()
+	ctx, span := tracing.Start(req.Trace, "send study",
+		attribute.String("dicom.study_instance_uid", study.StudyInstanceUID),
+		attribute.Int("send.pages", len(req.FilePaths)),
+		attribute.String("send.format", ds.sendFormat(req)))
+	req.Trace = ctx
+	progress, err := ds.transmitStudy(req, study)
+	tracing.End(span, err)
+
+	result := StudyResult{
+		Request:    req,
+		Study:      study,
+		Progress:   progress,
+		StartedAt:  startedAt,
+		FinishedAt: time.Now(),
+		Err:        err,
+		Queued:     ds.queueing() && err == nil,
+	}
+	for _, p := range progress {
+		switch p.Status {
+		case "completed":
+			result.Completed++
+		case "failed", "quarantined":
+			result.Failed++
+		}
+	}
+	ds.notify(result)
+
+	return progress, err
+}
+
+func (ds *DicomService) transmitStudy(req SendRequest, study StudyIdentifiers) ([]FileProgress, error) {
+	ds.logger.Infof("DICOM service: Starting PACs upload process")
+	ds.logger.Infof("DICOM service: Selected patient: %+v", req.Patient)
+	ds.logger.Infof("DICOM service: Document creator: %s", req.DocumentCreator)
+	ds.logger.Infof("DICOM service: Study description: %s", req.Description)
+	ds.logger.Infof("DICOM service: Files to process: %v", req.FilePaths)
+
 	// Get all JPG files from temp directory
-	jpgFiles, err := ds.getJpgFilesFromTempDir()
+	jpgFiles, err := ds.pageFiles(req)
 	if err != nil {
 		ds.logger.Errorf("DICOM service: Failed to get JPG files: %v", err)
 		return nil, fmt.Errorf("failed to get JPG files: %v", err)
@@ -303,104 +408,283 @@ func (ds *DicomService) SendToPacs(patientIDs []string, documentCreator string,
 
 	ds.logger.Infof("DICOM service: Found %d JPG files to convert", len(jpgFiles))
 
+	// Phase 1: convert and tag every page before anything leaves the station
+	var prepared []preparedFile
 	var progress []FileProgress
+	var failedPages []QuarantinedPage
+	if format := ds.sendFormat(req); format != SendFormatImages {
+		prepared, progress, failedPages = ds.prepareDocument(req, study, jpgFiles, format)
+	} else {
+		prepared, progress, failedPages = ds.preparePages(req, study, jpgFiles)
+	}
+
+	progress, err = ds.deliverStudy(req, study, prepared, progress, failedPages)
+	mirrorDocumentProgress(prepared, progress)
+	req.reportProgress(progress)
+	return progress, err
+}
+
+// preparePages converts and tags every page as a Secondary Capture instance
+func (ds *DicomService) preparePages(req SendRequest, study StudyIdentifiers, jpgFiles []string) ([]preparedFile, []FileProgress, []QuarantinedPage) {
+	progress := make([]FileProgress, len(jpgFiles))
+	var prepared []preparedFile
+	var failedPages []QuarantinedPage
 
-	// Process each JPG file
 	for i, jpgFile := range jpgFiles {
 		filename := filepath.Base(jpgFile)
+		ds.logger.Infof("DICOM service: Processing file: %s", jpgFile)
 
-		// Initialize progress for this file
-		fileProgress := FileProgress{
+		// Step 1: Convert JPG to DICOM
+		progress[i] = FileProgress{
 			Filename: filename,
 			Status:   "converting",
 			Message:  "Converting JPG to DICOM format...",
-			Progress: 0,
+			Progress: 20,
 		}
-		progress = append(progress, fileProgress)
-
-		ds.logger.Infof("DICOM service: Processing file: %s", jpgFile)
-
-		// Step 1: Convert JPG to DICOM using img2dcm
-		fileProgress.Status = "converting"
-		fileProgress.Message = "Converting JPG to DICOM format..."
-		fileProgress.Progress = 20
-		progress[i] = fileProgress
+		req.reportProgress(progress)
 
+		_, span := tracing.Start(req.Trace, "convert page", attribute.String("page.file", filename))
 		dcmFile, err := ds.convertJpgToDicom(jpgFile)
+		tracing.End(span, err)
 		if err != nil {
 			ds.logger.Errorf("DICOM service: Failed to convert %s to DICOM: %v", jpgFile, err)
-			fileProgress.Status = "failed"
-			fileProgress.Message = fmt.Sprintf("Conversion failed: %v", err)
-			fileProgress.Progress = 0
-			progress[i] = fileProgress
+			progress[i].Status = "failed"
+			progress[i].Message = fmt.Sprintf("Conversion failed: %v", err)
+			progress[i].Progress = 0
+			failedPages = append(failedPages, QuarantinedPage{Filename: filename, Reason: progress[i].Message})
+			req.reportProgress(progress)
 			continue
 		}
 
-		// Step 2: Update DICOM file with patient data
-		fileProgress.Status = "updating"
-		fileProgress.Message = "Updating DICOM with patient data..."
-		fileProgress.Progress = 50
-		progress[i] = fileProgress
+		// Step 2: Recognize the text of the page
+		var text string
+		if ds.ocr != nil {
+			progress[i].Message = "Recognizing text..."
+			progress[i].Progress = 35
+			req.reportProgress(progress)
+			_, span := tracing.Start(req.Trace, "recognize text", attribute.String("page.file", filename))
+			text = ds.recognizeText([]string{jpgFile})
+			span.End()
+		}
+
+		// Step 3: Update DICOM file with patient data
+		progress[i].Status = "updating"
+		progress[i].Message = "Updating DICOM with patient data..."
+		progress[i].Progress = 50
+		req.reportProgress(progress)
 
 		// Instance number starts from 1
 		instanceNumber := i + 1
-		err = ds.updateDicomWithPatientData(dcmFile, selectedPatient, documentCreator, description, studyID, studyInstanceUID, seriesInstanceUID, instanceNumber)
+		progress[i].SOPInstanceUID = sopInstanceUID(study.SeriesInstanceUID, instanceNumber)
+		_, span = tracing.Start(req.Trace, "update tags",
+			attribute.String("page.file", filename),
+			attribute.String("dicom.sop_instance_uid", progress[i].SOPInstanceUID))
+		err = ds.updateDicomWithPatientData(dcmFile, req.Patient, req.DocumentCreator, req.Description, study, instanceNumber, text)
+		tracing.End(span, err)
 		if err != nil {
 			ds.logger.Errorf("DICOM service: Failed to update DICOM file %s: %v", dcmFile, err)
-			fileProgress.Status = "failed"
-			fileProgress.Message = fmt.Sprintf("Update failed: %v", err)
-			fileProgress.Progress = 0
-			progress[i] = fileProgress
+			progress[i].Status = "failed"
+			progress[i].Message = fmt.Sprintf("Update failed: %v", err)
+			progress[i].Progress = 0
+			failedPages = append(failedPages, QuarantinedPage{Filename: filename, Reason: progress[i].Message})
+			os.Remove(dcmFile)
+			req.reportProgress(progress)
 			continue
 		}
 
-		// Step 3: Send DICOM file to PACs server
-		fileProgress.Status = "sending"
-		fileProgress.Message = "Sending to PACs server..."
-		fileProgress.Progress = 80
-		progress[i] = fileProgress
+		prepared = append(prepared, preparedFile{index: i, jpgFile: jpgFile, dcmFile: dcmFile})
+	}
+
+	return prepared, progress, failedPages
+}
 
-		err = ds.sendDicomToPacs(dcmFile)
+// deliverStudy holds, queues or transmits the prepared instances of a study
+func (ds *DicomService) deliverStudy(req SendRequest, study StudyIdentifiers, prepared []preparedFile, progress []FileProgress, failedPages []QuarantinedPage) ([]FileProgress, error) {
+	// Hold the whole study if a page could not be prepared
+	if len(failedPages) > 0 && ds.cfg().DicomQuarantineFailedPages {
+		for _, p := range prepared {
+			os.Remove(p.dcmFile)
+			progress[p.index].Status = "held"
+			progress[p.index].Message = "Held until quarantined pages are resolved"
+			progress[p.index].Progress = 0
+		}
+		for i := range progress {
+			if progress[i].Status == "failed" {
+				progress[i].Status = "quarantined"
+			}
+		}
+
+		req.reportProgress(progress)
+		q := ds.quarantine.add(req, study, failedPages)
+		ds.logger.Warnf("DICOM service: Study %s quarantined, %d of %d pages failed", study.StudyInstanceUID, len(failedPages), len(progress))
+		return progress, &QuarantineError{Quarantine: q}
+	}
+
+	// Another node stores the study
+	if ds.queueing() {
+		return ds.enqueueStudy(req, study, prepared, progress)
+	}
+
+	atomic := req.Atomic || ds.cfg().DicomAtomicSend
+	if atomic {
+		ds.logger.Infof("DICOM service: Atomic send enabled for study %s", study.StudyInstanceUID)
+	}
+
+	// Phase 2: transmit the prepared pages over one association
+	session := ds.openStore(ds.storeDestination(req.DocumentCreator))
+	defer session.close()
+	var stored []preparedFile
+	failed := len(failedPages)
+	// outboxed counts the instances left to the outbox
+	outboxed := 0
+
+	// The performed procedure step covers the transmission
+	step := ds.startProcedureStep(req, study)
+	defer func() {
+		ds.finishProcedureStep(step, req, study, session.stored, failed == 0 && outboxed == 0)
+	}()
+	for _, p := range prepared {
+		i := p.index
+
+		// Step 3: Send DICOM file to PACs server
+		progress[i].Status = "sending"
+		progress[i].Message = "Sending to PACs server..."
+		progress[i].Progress = 80
+		req.reportProgress(progress)
+
+		_, span := tracing.Start(req.Trace, "store",
+			attribute.String("dicom.sop_instance_uid", progress[i].SOPInstanceUID),
+			attribute.String("dicom.destination", session.dest.String()))
+		status, err := session.store(p.dcmFile)
+		if status != 0 || err == nil {
+			progress[i].StoreStatus = storeStatus(status)
+			span.SetAttributes(attribute.String("dicom.store_status", progress[i].StoreStatus))
+		}
+		tracing.End(span, err)
 		if err != nil {
-			ds.logger.Errorf("DICOM service: Failed to send %s to PACs: %v", dcmFile, err)
-			fileProgress.Status = "failed"
-			fileProgress.Message = fmt.Sprintf("Upload failed: %v", err)
-			fileProgress.Progress = 0
-			progress[i] = fileProgress
+			ds.logger.Errorf("DICOM service: Failed to send %s to PACs: %v", p.dcmFile, err)
+			// Atomic sends keep the whole study for another attempt instead
+			if !atomic && ds.outbox != nil && retryable(status, err) && ds.holdInOutbox(req, study, p, progress, err) {
+				outboxed++
+				req.reportProgress(progress)
+				continue
+			}
+			progress[i].Status = "failed"
+			progress[i].Message = fmt.Sprintf("Upload failed: %v", err)
+			progress[i].Progress = 0
+			failed++
+			req.reportProgress(progress)
 			continue
 		}
+		progress[i].Archive = session.dest.String()
 
-		// Step 4: Cleanup files after successful upload
-		fileProgress.Status = "cleaning"
-		fileProgress.Message = "Cleaning up temporary files..."
-		fileProgress.Progress = 90
-		progress[i] = fileProgress
+		if !atomic {
+			ds.archiveInstance(req, study, p.dcmFile, progress[i].SOPInstanceUID)
+		}
 
-		// Clean up both JPG and DCM files
-		err = ds.cleanupFiles(jpgFile, dcmFile)
-		if err != nil {
-			ds.logger.Warnf("DICOM service: Failed to cleanup files for %s: %v", jpgFile, err)
-			// Don't fail the upload if cleanup fails, just log it
+		if atomic {
+			// Cleanup waits until every instance of the study is stored
+			stored = append(stored, p)
+			progress[i].Status = "stored"
+			progress[i].Message = "Stored on PACs, waiting for the remaining instances"
+			progress[i].Progress = 90
+			req.reportProgress(progress)
+			continue
 		}
 
+		// Step 4: Cleanup files after successful upload
+		progress[i].Status = "cleaning"
+		progress[i].Message = "Cleaning up temporary files..."
+		progress[i].Progress = 90
+
+		// Clean up both JPG and DCM files; a failed cleanup is only logged
+		ds.cleanupPrepared(p)
+
 		// Step 5: Completed successfully
-		fileProgress.Status = "completed"
-		fileProgress.Message = "Successfully uploaded to PACs and cleaned up"
-		fileProgress.Progress = 100
-		progress[i] = fileProgress
+		progress[i].Status = "completed"
+		progress[i].Message = "Successfully uploaded to PACs and cleaned up"
+		progress[i].Progress = 100
+		req.reportProgress(progress)
 
-		ds.logger.Infof("DICOM service: Successfully processed, sent, and cleaned up %s", jpgFile)
+		ds.logger.Infof("DICOM service: Successfully processed, sent, and cleaned up %s", p.jpgFile)
+	}
+
+	if atomic {
+		if failed > 0 {
+			// Keep every local file so the study can be sent again as a whole
+			atomicErr := &AtomicSendError{StudyInstanceUID: study.StudyInstanceUID, Failed: failed}
+			for _, p := range stored {
+				atomicErr.StoredInstances = append(atomicErr.StoredInstances, progress[p.index].SOPInstanceUID)
+				progress[p.index].Message = "Stored on PACs, but the study failed; local files kept"
+			}
+			ds.logger.Errorf("DICOM service: %v", atomicErr)
+			if len(atomicErr.StoredInstances) > 0 {
+				ds.logger.Warnf("DICOM service: Instances stored before failure (may need cleanup on PACS): %v", atomicErr.StoredInstances)
+			}
+			return progress, atomicErr
+		}
+
+		for _, p := range stored {
+			ds.archiveInstance(req, study, p.dcmFile, progress[p.index].SOPInstanceUID)
+			ds.cleanupPrepared(p)
+			progress[p.index].Status = "completed"
+			progress[p.index].Message = "Successfully uploaded to PACs and cleaned up"
+			progress[p.index].Progress = 100
+		}
+		req.reportProgress(progress)
+	}
+
+	// Step 6: Ask the PACS to confirm it keeps the stored instances
+	if ds.cfg().DicomStorageCommitment {
+		for dest, refs := range session.storedByArchive() {
+			ds.commitInstances(dest, refs, progress)
+		}
+		req.reportProgress(progress)
+	}
+	if session.failedOver() {
+		ds.logger.Warnf("DICOM service: Study %s was stored on the failover archive %s", study.StudyInstanceUID, session.dest)
+	}
+
+	if outboxed > 0 {
+		ds.logger.Warnf("DICOM service: %d instance(s) of study %s wait in the outbox", outboxed, study.StudyInstanceUID)
 	}
 
 	ds.logger.Infof("DICOM service: PACs upload process completed")
 	return progress, nil
 }
 
-func (ds *DicomService) getJpgFilesFromTempDir() ([]string, error) {
-	ds.logger.Debugf("DICOM service: Scanning for JPG files in: %s", ds.config.TempFilesDir)
+// sopInstanceUID builds the SOP Instance UID from the series UID and instance number
+func sopInstanceUID(seriesInstanceUID string, instanceNumber int) string {
+	return fmt.Sprintf("%s.%d", seriesInstanceUID, instanceNumber)
+}
 
-	// Use find command to get all JPG files
-	cmd := exec.Command("find", ds.config.TempFilesDir, "-name", "*.jpg", "-type", "f")
+// pageFiles returns the pages to send in the order of req.FilePaths, which
+// follows the scan session. Pages that are gone, e.g. were sent before a
+// quarantined study was released, are skipped. Without FilePaths all pages
+// in the source directory are sent.
+func (ds *DicomService) pageFiles(req SendRequest) ([]string, error) {
+	if len(req.FilePaths) == 0 {
+		return ds.getJpgFiles(ds.sourceDir(req))
+	}
+	var files []string
+	for _, path := range req.FilePaths {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".jpg", ".png":
+		default:
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+func (ds *DicomService) getJpgFiles(dir string) ([]string, error) {
+	ds.logger.Debugf("DICOM service: Scanning for JPG files in: %s", dir)
+
+	// Use find command to get all JPG files and lossless PNG scans
+	cmd := exec.Command("find", dir, "-type", "f", "(", "-name", "*.jpg", "-o", "-name", "*.png", ")")
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to find JPG files: %v", err)
@@ -419,25 +703,23 @@ func (ds *DicomService) getJpgFilesFromTempDir() ([]string, error) {
 	return jpgFiles, nil
 }
 
+// convertJpgToDicom writes a scanned page as Secondary Capture next to it
 func (ds *DicomService) convertJpgToDicom(jpgFile string) (string, error) {
 	// Generate DICOM filename
-	dcmFile := strings.Replace(jpgFile, ".jpg", ".dcm", 1)
+	dcmFile := strings.TrimSuffix(jpgFile, filepath.Ext(jpgFile)) + ".dcm"
 
 	ds.logger.Debugf("DICOM service: Converting %s to %s", jpgFile, dcmFile)
 
-	// Run img2dcm command
-	cmd := exec.Command(
-		ds.config.DcmtkPath+"/img2dcm",
-		jpgFile,
-		dcmFile,
-	)
-
-	output, err := cmd.CombinedOutput()
+	f, err := convertImage(jpgFile)
 	if err != nil {
-		return "", fmt.Errorf("img2dcm failed: %v, output: %s", err, string(output))
+		return "", err
+	}
+	if err := dimse.WriteFile(dcmFile, f); err != nil {
+		os.Remove(dcmFile)
+		return "", fmt.Errorf("failed to write %s: %v", dcmFile, err)
 	}
 
-	ds.logger.Debugf("DICOM service: img2dcm output: %s", string(output))
+	ds.logger.Debugf("DICOM service: Converted %s (%s)", jpgFile, f.TransferSyntaxUID)
 	return dcmFile, nil
 }
 
@@ -467,72 +749,45 @@ func (ds *DicomService) formatPatientNameForDicom(name string) string {
 		formattedName += "^" + parts[2]
 	}
 
-	ds.logger.Debugf("DICOM service: Formatted patient name '%s' to DICOM format: '%s'", name, formattedName)
+	ds.logger.WithField(logging.FieldPatientName, formattedName).Debugf("DICOM service: Formatted patient name to DICOM format")
 	return formattedName
 }
 
-func (ds *DicomService) updateDicomWithPatientData(dcmFile string, patient PatientInfo, documentCreator string, description string, studyID string, studyInstanceUID string, seriesInstanceUID string, instanceNumber int) error {
+// updateDicomWithPatientData tags a converted instance; text is the
+// recognized text of its pages, if any
+func (ds *DicomService) updateDicomWithPatientData(dcmFile string, patient PatientInfo, documentCreator string, description string, study StudyIdentifiers, instanceNumber int, text string) error {
 	ds.logger.Debugf("DICOM service: Updating DICOM file %s with patient data", dcmFile)
-
-	// Generate SOP Instance UID based on pre-generated series UID and instance number
-	sopInstanceUID := fmt.Sprintf("%s.%d", seriesInstanceUID, instanceNumber)
-
 	ds.logger.Debugf("DICOM service: Generated SOP Instance UID: %s for Instance: %d",
-		sopInstanceUID, instanceNumber)
-
-	// Format patient name according to DICOM standard
-	formattedPatientName := ds.formatPatientNameForDicom(patient.Name)
-
-	// Build dcmodify command with patient data
-	cmd := exec.Command(
-		ds.config.DcmtkPath+"/dcmodify",
-		"-nb",                                                     // No backup
-		"-gin",                                                    // Group length implicit
-		"-i", fmt.Sprintf("(0010,0010)=%s", formattedPatientName), // PatientName (DICOM formatted)
-		"-i", fmt.Sprintf("(0010,0020)=%s", patient.PatientID), // PatientID
-		"-i", fmt.Sprintf("(0010,0030)=%s", patient.BirthDate), // PatientBirthDate
-		"-i", fmt.Sprintf("(0010,0040)=%s", patient.Gender), // PatientSex
-		"-i", fmt.Sprintf("(0008,0080)=%s", documentCreator), // InstitutionName
-		"-i", fmt.Sprintf("(0008,1010)=%s", ds.config.DicomStationName), // StationName
-		"-i", fmt.Sprintf("(0020,0010)=%s", studyID), // StudyID
-		"-i", fmt.Sprintf("(0020,000D)=%s", studyInstanceUID), // Study Instance UID
-		"-i", fmt.Sprintf("(0020,000E)=%s", seriesInstanceUID), // Series Instance UID
-		"-i", fmt.Sprintf("(0008,0018)=%s", sopInstanceUID), // SOP Instance UID
-		"-i", fmt.Sprintf("(0020,0013)=%d", instanceNumber), // Instance Number
-		"-i", fmt.Sprintf("(0008,1030)=%s", description), // Study Description
-		"-i", fmt.Sprintf("(0008,103E)=%s", "Scanner imported document"), // Series Description
-		dcmFile,
-	)
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("dcmodify failed: %v, output: %s", err, string(output))
-	}
+		sopInstanceUID(study.SeriesInstanceUID, instanceNumber), instanceNumber)
 
-	ds.logger.Debugf("DICOM service: dcmodify output: %s", string(output))
+	tags := ds.withCharacterSet(withRecognizedText(ds.pageTags(patient, documentCreator, description, study, instanceNumber), text))
+	if err := setTags(dcmFile, tags); err != nil {
+		return fmt.Errorf("failed to write patient data: %v", err)
+	}
 	return nil
 }
 
-func (ds *DicomService) sendDicomToPacs(dcmFile string) error {
-	ds.logger.Debugf("DICOM service: Sending %s to PACs server", dcmFile)
+// sendDicomToPacs sends a single DICOM file on its own association, or on
+// a pooled one
+func (ds *DicomService) sendDicomToPacs(dest StoreDestination, dcmFile string) error {
+	ds.logger.Debugf("DICOM service: Sending %s to PACs server %s@%s", dcmFile, dest.AETitle, dest.Host)
 
-	// Run dcmsend command
-	cmd := exec.Command(
-		ds.config.DcmtkPath+"/dcmsend",
-		"-aet", ds.config.DicomLocalAETitle,
-		"-aec", ds.config.DicomStoreAETitle,
-		ds.config.DicomRemoteHost,
-		fmt.Sprintf("%d", ds.config.DicomStorescuPort),
-		dcmFile,
-	)
+	session := ds.openStore(dest)
+	defer session.close()
+	_, err := session.store(dcmFile)
+	return err
+}
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("dcmsend failed: %v, output: %s", err, string(output))
+// cleanupPrepared removes the local files of a stored instance
+func (ds *DicomService) cleanupPrepared(p preparedFile) {
+	if err := ds.cleanupFiles(p.jpgFile, p.dcmFile); err != nil {
+		ds.logger.Warnf("DICOM service: Failed to cleanup files for %s: %v", p.jpgFile, err)
+	}
+	for _, page := range p.pages {
+		if err := os.Remove(page.file); err != nil {
+			ds.logger.Warnf("DICOM service: Failed to remove JPG file %s: %v", page.file, err)
+		}
 	}
-
-	ds.logger.Debugf("DICOM service: dcmsend output: %s", string(output))
-	return nil
 }
 
 func (ds *DicomService) cleanupFiles(jpgFile string, dcmFile string) error {
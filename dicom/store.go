@@ -0,0 +1,220 @@
+package dicom
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"DICOMScanStation/dimse"
+)
+
+// associationTimeout limits connecting and each C-STORE
+const associationTimeout = 60 * time.Second
+
+// StoreDestination is the storage SCP receiving the documents, e.g. a VNA.
+// It may be a different system than the query destination.
+type StoreDestination struct {
+	AETitle string
+	Host    string
+	Port    int
+	// CallingAETitle is the AE title the station presents to the SCP
+	CallingAETitle string
+}
+
+// storeDestination returns the configured storage SCP. Documents of an
+// institution with a registered AE title are sent under that calling AE.
+func (ds *DicomService) storeDestination(institution string) StoreDestination {
+	cfg := ds.cfg()
+	calling := ds.institutionAETitle(institution)
+	if calling == "" {
+		calling = ds.callingAETitle(cfg.DicomStoreCallingAETitle)
+	}
+	return StoreDestination{
+		AETitle:        cfg.DicomStoreAETitle,
+		Host:           cfg.DicomStoreHost,
+		Port:           cfg.DicomStorescuPort,
+		CallingAETitle: calling,
+	}
+}
+
+// failoverDestination returns the secondary archive taking over from dest
+// when it cannot be reached, nil if DICOM_FAILOVER_HOST is not set. The
+// calling AE title stays the same.
+func (ds *DicomService) failoverDestination(dest StoreDestination) *StoreDestination {
+	if ds.cfg().DicomFailoverHost == "" {
+		return nil
+	}
+	failover := StoreDestination{
+		AETitle:        ds.cfg().DicomFailoverAETitle,
+		Host:           ds.cfg().DicomFailoverHost,
+		Port:           ds.cfg().DicomFailoverPort,
+		CallingAETitle: dest.CallingAETitle,
+	}
+	if failover.AETitle == "" {
+		failover.AETitle = dest.AETitle
+	}
+	if failover.Port == 0 {
+		failover.Port = dest.Port
+	}
+	return &failover
+}
+
+// String names the archive in the upload progress
+func (d StoreDestination) String() string {
+	return fmt.Sprintf("%s@%s:%d", d.AETitle, d.Host, d.Port)
+}
+
+// storeSession sends the instances of a batch over one association. The
+// association is opened with the first instance, or taken from the pool,
+// and returned to the pool when the session is closed.
+type storeSession struct {
+	ds     *DicomService
+	dest   StoreDestination
+	assoc  *dimse.Association
+	reused bool
+	// stored lists the instances stored in the session
+	stored []dimse.CommitReference
+	// failover takes over the remaining instances once dest cannot be
+	// reached; nil if none is configured or the session already switched
+	failover *StoreDestination
+	// primary is the destination the session started with and
+	// primaryStored the number of instances stored there
+	primary       StoreDestination
+	primaryStored int
+}
+
+func (ds *DicomService) openStore(dest StoreDestination) *storeSession {
+	s := &storeSession{ds: ds, dest: dest, primary: dest, failover: ds.failoverDestination(dest)}
+	if ds.pool != nil {
+		s.assoc = ds.pool.get(dest)
+		s.reused = s.assoc != nil
+	}
+	return s
+}
+
+// failOver switches the session to the failover archive after dest could
+// not be reached; it reports false if there is none to switch to
+func (s *storeSession) failOver(err error) bool {
+	if s.failover == nil {
+		return false
+	}
+	s.ds.logger.Warnf("DICOM service: %v; failing over to %s", err, s.failover)
+	s.dest = *s.failover
+	s.failover = nil
+	s.primaryStored = len(s.stored)
+	s.assoc = nil
+	s.reused = false
+	if s.ds.pool != nil {
+		s.assoc = s.ds.pool.get(s.dest)
+		s.reused = s.assoc != nil
+	}
+	return true
+}
+
+// failedOver reports whether the session switched to the failover archive
+func (s *storeSession) failedOver() bool {
+	return s.dest != s.primary
+}
+
+// storedByArchive returns the stored instances by the archive that
+// received them
+func (s *storeSession) storedByArchive() map[StoreDestination][]dimse.CommitReference {
+	byArchive := make(map[StoreDestination][]dimse.CommitReference)
+	if !s.failedOver() {
+		if len(s.stored) > 0 {
+			byArchive[s.dest] = s.stored
+		}
+		return byArchive
+	}
+	if s.primaryStored > 0 {
+		byArchive[s.primary] = s.stored[:s.primaryStored]
+	}
+	if len(s.stored) > s.primaryStored {
+		byArchive[s.dest] = s.stored[s.primaryStored:]
+	}
+	return byArchive
+}
+
+// store sends a DICOM file with C-STORE and returns the status of the SCP.
+// A failure status is returned as *dimse.StatusError along with the
+// status. A reused association the SCP closed in the meantime is replaced
+// once. If the archive cannot be reached the session fails over, see
+// DICOM_FAILOVER_HOST; an archive rejecting the instance with a status
+// does not cause a failover.
+func (s *storeSession) store(dcmFile string) (dimse.Status, error) {
+	f, err := dimse.ReadFile(dcmFile)
+	if err != nil {
+		return 0, err
+	}
+
+	if s.assoc != nil && !s.assoc.Supports(f.SOPClassUID, f.TransferSyntaxUID) {
+		s.close()
+	}
+	for {
+		if s.assoc == nil {
+			s.assoc, err = dimse.Dial(net.JoinHostPort(s.dest.Host, strconv.Itoa(s.dest.Port)), dimse.Options{
+				CallingAETitle: s.dest.CallingAETitle,
+				CalledAETitle:  s.dest.AETitle,
+				Timeout:        associationTimeout,
+				TLS:            s.ds.current().tls,
+			}, storeProposals(f))
+			if err != nil {
+				s.assoc = nil
+				err = fmt.Errorf("association with %s@%s:%d failed: %v", s.dest.AETitle, s.dest.Host, s.dest.Port, err)
+				if s.failOver(err) {
+					continue
+				}
+				return 0, err
+			}
+			s.reused = false
+			s.ds.logger.Debugf("DICOM service: Opened association to %s@%s", s.dest.AETitle, s.dest.Host)
+		}
+
+		status, err := s.assoc.Store(f)
+		var statusErr *dimse.StatusError
+		if err != nil && !errors.As(err, &statusErr) {
+			s.assoc = nil
+			if s.reused {
+				s.ds.logger.Debugf("DICOM service: Reused association to %s@%s failed, opening a new one: %v", s.dest.AETitle, s.dest.Host, err)
+				continue
+			}
+			err = fmt.Errorf("C-STORE of %s failed: %v", f.SOPInstanceUID, err)
+			if s.failOver(err) {
+				continue
+			}
+			return 0, err
+		}
+		// Only the first instance may run into an association the SCP
+		// closed while it was idle
+		s.reused = false
+		if err != nil {
+			return status, fmt.Errorf("C-STORE of %s failed: %v", f.SOPInstanceUID, err)
+		}
+		if status.Warning() {
+			s.ds.logger.Warnf("DICOM service: PACS stored %s with %s", f.SOPInstanceUID, status)
+		}
+		s.stored = append(s.stored, dimse.CommitReference{SOPClassUID: f.SOPClassUID, SOPInstanceUID: f.SOPInstanceUID})
+		return status, nil
+	}
+}
+
+// close returns the association to the pool, or releases it if pooling is
+// disabled
+func (s *storeSession) close() {
+	if s.assoc == nil {
+		return
+	}
+	if s.ds.pool != nil {
+		s.ds.pool.put(s.dest, s.assoc)
+	} else {
+		s.assoc.Release()
+	}
+	s.assoc = nil
+}
+
+// storeStatus formats a C-STORE status for the upload progress
+func storeStatus(status dimse.Status) string {
+	return fmt.Sprintf("0x%04X", uint16(status))
+}
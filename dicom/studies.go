@@ -0,0 +1,208 @@
+package dicom
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"DICOMScanStation/dimse"
+	"DICOMScanStation/logging"
+)
+
+// StudyInfo is an existing study of a patient on the PACS
+type StudyInfo struct {
+	StudyInstanceUID string `json:"studyInstanceUid"`
+	StudyID          string `json:"studyId"`
+	StudyDate        string `json:"studyDate"`
+	StudyTime        string `json:"studyTime"`
+	Description      string `json:"description"`
+	AccessionNumber  string `json:"accessionNumber"`
+	// Modalities is empty if the PACS does not return Modalities in Study;
+	// the series of the study name them
+	Modalities []string `json:"modalities"`
+	Instances  int      `json:"instances,omitempty"`
+}
+
+// SeriesInfo is a series of an existing study
+type SeriesInfo struct {
+	SeriesInstanceUID string `json:"seriesInstanceUid"`
+	SeriesNumber      string `json:"seriesNumber"`
+	Modality          string `json:"modality"`
+	Description       string `json:"description"`
+	SeriesDate        string `json:"seriesDate"`
+	Instances         int    `json:"instances,omitempty"`
+}
+
+// ErrStudyNotFound is returned when pages are to be appended to a study the
+// PACS does not have for the patient
+var ErrStudyNotFound = errors.New("study not found for the patient")
+
+// Attributes of study and series queries
+var (
+	tagAccessionNumber   = dimse.Tag(0x0008, 0x0050)
+	tagModalitiesInStudy = dimse.Tag(0x0008, 0x0061)
+	tagSeriesDate        = dimse.Tag(0x0008, 0x0021)
+	tagModality          = dimse.Tag(0x0008, 0x0060)
+	tagSeriesDescription = dimse.Tag(0x0008, 0x103E)
+	tagSeriesInstanceUID = dimse.Tag(0x0020, 0x000E)
+	tagStudyID           = dimse.Tag(0x0020, 0x0010)
+	tagSeriesNumber      = dimse.Tag(0x0020, 0x0011)
+	tagStudyInstances    = dimse.Tag(0x0020, 0x1208) // Number of Study Related Instances
+	tagSeriesInstances   = dimse.Tag(0x0020, 0x1209) // Number of Series Related Instances
+)
+
+// PatientStudies returns the studies of a patient on the PACS, the newest
+// first, so the operator sees what already exists before sending
+func (ds *DicomService) PatientStudies(patientID string) ([]StudyInfo, error) {
+	if strings.TrimSpace(patientID) == "" {
+		return nil, fmt.Errorf("patient ID is required")
+	}
+	ds.logger.WithField(logging.FieldPatientID, patientID).Infof("DICOM service: Querying studies of patient")
+
+	dest := ds.queryDestination()
+	responses, err := ds.find(dest, dest.studyQueryKeys(patientID,
+		dimse.String(tagStudyDate, "DA", ""),
+		dimse.String(tagStudyTime, "TM", ""),
+		dimse.String(tagAccessionNumber, "SH", ""),
+		dimse.String(tagModalitiesInStudy, "CS", ""),
+		dimse.String(tagStudyDescription, "LO", ""),
+		dimse.String(tagStudyInstanceUID, "UI", ""),
+		dimse.String(tagStudyID, "SH", ""),
+		dimse.String(tagStudyInstances, "IS", ""),
+	))
+	if err != nil {
+		ds.logger.Errorf("DICOM service: Study query failed: %v", err)
+		return nil, fmt.Errorf("study query failed: %v", err)
+	}
+
+	studies := []StudyInfo{}
+	for _, response := range responses {
+		study := StudyInfo{
+			StudyInstanceUID: response.Text(tagStudyInstanceUID),
+			StudyID:          response.Text(tagStudyID),
+			StudyDate:        response.Text(tagStudyDate),
+			StudyTime:        response.Text(tagStudyTime),
+			Description:      response.Text(tagStudyDescription),
+			AccessionNumber:  response.Text(tagAccessionNumber),
+			Modalities:       multiValue(response.Text(tagModalitiesInStudy)),
+			Instances:        intValue(response.Text(tagStudyInstances)),
+		}
+		if study.StudyInstanceUID != "" {
+			studies = append(studies, study)
+		}
+	}
+	sort.SliceStable(studies, func(i, j int) bool {
+		return studies[i].StudyDate+studies[i].StudyTime > studies[j].StudyDate+studies[j].StudyTime
+	})
+
+	ds.logger.WithField(logging.FieldPatientID, patientID).Infof("DICOM service: Found %d studies of patient", len(studies))
+	return studies, nil
+}
+
+// StudySeries returns the series of a study. The patient ID is the unique
+// key of the patient level in hierarchical Patient Root queries.
+func (ds *DicomService) StudySeries(patientID string, studyInstanceUID string) ([]SeriesInfo, error) {
+	if strings.TrimSpace(studyInstanceUID) == "" {
+		return nil, fmt.Errorf("study instance UID is required")
+	}
+
+	dest := ds.queryDestination()
+	keys := []dimse.Element{
+		dimse.String(tagQueryRetrieveLevel, "CS", "SERIES"),
+		dimse.String(tagSeriesDate, "DA", ""),
+		dimse.String(tagModality, "CS", ""),
+		dimse.String(tagSeriesDescription, "LO", ""),
+		dimse.String(tagStudyInstanceUID, "UI", studyInstanceUID),
+		dimse.String(tagSeriesInstanceUID, "UI", ""),
+		dimse.String(tagSeriesNumber, "IS", ""),
+		dimse.String(tagSeriesInstances, "IS", ""),
+	}
+	if dest.Model == QueryModelPatient {
+		keys = append(keys, dimse.String(tagPatientID, "LO", patientID))
+	}
+	responses, err := ds.find(dest, keys)
+	if err != nil {
+		ds.logger.Errorf("DICOM service: Series query failed: %v", err)
+		return nil, fmt.Errorf("series query failed: %v", err)
+	}
+
+	series := []SeriesInfo{}
+	for _, response := range responses {
+		s := SeriesInfo{
+			SeriesInstanceUID: response.Text(tagSeriesInstanceUID),
+			SeriesNumber:      response.Text(tagSeriesNumber),
+			Modality:          response.Text(tagModality),
+			Description:       response.Text(tagSeriesDescription),
+			SeriesDate:        response.Text(tagSeriesDate),
+			Instances:         intValue(response.Text(tagSeriesInstances)),
+		}
+		if s.SeriesInstanceUID != "" {
+			series = append(series, s)
+		}
+	}
+	sort.SliceStable(series, func(i, j int) bool {
+		return intValue(series[i].SeriesNumber) < intValue(series[j].SeriesNumber)
+	})
+	return series, nil
+}
+
+// existingStudy looks up the study the pages are appended to, so the new
+// series carries its attributes. The series is numbered after the series
+// the study already has.
+func (ds *DicomService) existingStudy(patientID string, studyInstanceUID string) (StudyIdentifiers, error) {
+	studies, err := ds.PatientStudies(patientID)
+	if err != nil {
+		return StudyIdentifiers{}, err
+	}
+	for _, s := range studies {
+		if s.StudyInstanceUID != studyInstanceUID {
+			continue
+		}
+
+		seriesNumber := 1
+		series, err := ds.StudySeries(patientID, studyInstanceUID)
+		if err != nil {
+			// A duplicate series number is harmless, the UID tells them apart
+			ds.logger.Warnf("DICOM service: Could not number the new series of study %s: %v", studyInstanceUID, err)
+		}
+		for _, existing := range series {
+			if n := intValue(existing.SeriesNumber); n >= seriesNumber {
+				seriesNumber = n + 1
+			}
+		}
+
+		study := StudyIdentifiers{
+			StudyID:           s.StudyID,
+			StudyInstanceUID:  s.StudyInstanceUID,
+			SeriesInstanceUID: ds.current().uids.New(),
+			Appended:          true,
+			StudyDate:         s.StudyDate,
+			StudyTime:         s.StudyTime,
+			StudyDescription:  s.Description,
+			AccessionNumber:   s.AccessionNumber,
+			SeriesNumber:      seriesNumber,
+		}
+		ds.logger.Infof("DICOM service: Appending series %d (%s) to study %s", seriesNumber, study.SeriesInstanceUID, studyInstanceUID)
+		return study, nil
+	}
+	return StudyIdentifiers{}, fmt.Errorf("%w: %s", ErrStudyNotFound, studyInstanceUID)
+}
+
+// multiValue splits a multi-valued string element
+func multiValue(value string) []string {
+	values := []string{}
+	for _, v := range strings.Split(value, `\`) {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// intValue reads an IS element, 0 if it is empty or invalid
+func intValue(value string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(value))
+	return n
+}
@@ -0,0 +1,122 @@
+package dicom
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"DICOMScanStation/dimse"
+)
+
+// maxValueLength is the maximum length of a value per VR (PS3.5 6.2); VRs
+// without an entry are not limited here
+var maxValueLength = map[string]int{
+	"AE": 16, "CS": 16, "DA": 8, "IS": 12, "LO": 64, "PN": 64,
+	"SH": 16, "TM": 14, "UI": 64, "LT": 10240, "ST": 1024,
+}
+
+// tagValue returns a string element with a value that is valid for its VR:
+// control characters are removed, backslashes, which separate multiple
+// values, are replaced except in text VRs, and the value is cut to the
+// maximum length
+func tagValue(tag uint32, vr string, value string) dimse.Element {
+	text := vr == "LT" || vr == "ST" || vr == "UT"
+	value = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\\' && !text:
+			return '/'
+		case r == '\n' || r == '\r' || r == '\t':
+			if text {
+				return r
+			}
+			return ' '
+		case r < 0x20 || r == 0x7f:
+			return -1
+		}
+		return r
+	}, value)
+	value = strings.TrimSpace(value)
+	if max, ok := maxValueLength[vr]; ok && len(value) > max {
+		value = strings.TrimSpace(truncateUTF8(value, max))
+	}
+	return dimse.String(tag, vr, value)
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	for n > 0 && n < len(s) && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
+
+// setTags replaces or inserts elements in a DICOM file. A new SOP Instance
+// UID is also written to the file meta information.
+func setTags(dcmFile string, elements []dimse.Element) error {
+	f, err := dimse.ReadFile(dcmFile)
+	if err != nil {
+		return err
+	}
+	dataSet, err := dimse.SetElements(f.DataSet, f.TransferSyntaxUID != dimse.ImplicitVRLittleEndian, elements)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %v", dcmFile, err)
+	}
+	f.DataSet = dataSet
+	for _, e := range elements {
+		if e.Tag == dimse.Tag(0x0008, 0x0018) {
+			f.SOPInstanceUID = strings.TrimRight(string(e.Value), "\x00")
+		}
+	}
+
+	// Write next to the file and rename, so a failure leaves the original
+	tmp := dcmFile + ".tmp"
+	if err := dimse.WriteFile(tmp, f); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dcmFile)
+}
+
+// pageTags returns the patient, study and series attributes of a scanned page.
+// Pages appended to an existing study keep its study attributes and carry
+// the description in the series instead. The tag template of the document
+// type, the description, takes precedence.
+func (ds *DicomService) pageTags(patient PatientInfo, documentCreator string, description string, study StudyIdentifiers, instanceNumber int) []dimse.Element {
+	studyDescription := description
+	if study.Appended {
+		studyDescription = study.StudyDescription
+	}
+	tags := []dimse.Element{
+		tagValue(dimse.Tag(0x0010, 0x0010), "PN", ds.formatPatientNameForDicom(patient.Name)),
+		tagValue(dimse.Tag(0x0010, 0x0020), "LO", patient.PatientID),
+		tagValue(dimse.Tag(0x0010, 0x0030), "DA", patient.BirthDate),
+		tagValue(dimse.Tag(0x0010, 0x0040), "CS", patient.Gender),
+		tagValue(dimse.Tag(0x0008, 0x0080), "LO", documentCreator),           // InstitutionName
+		tagValue(dimse.Tag(0x0008, 0x1010), "SH", ds.cfg().DicomStationName), // StationName
+		tagValue(dimse.Tag(0x0020, 0x0010), "SH", study.StudyID),
+		tagValue(dimse.Tag(0x0020, 0x000D), "UI", study.StudyInstanceUID),
+		tagValue(dimse.Tag(0x0020, 0x000E), "UI", study.SeriesInstanceUID),
+		tagValue(dimse.Tag(0x0008, 0x0018), "UI", sopInstanceUID(study.SeriesInstanceUID, instanceNumber)),
+		tagValue(dimse.Tag(0x0020, 0x0013), "IS", strconv.Itoa(instanceNumber)),
+		tagValue(dimse.Tag(0x0008, 0x1030), "LO", studyDescription), // Study Description
+		tagValue(dimse.Tag(0x0008, 0x103E), "LO", seriesDescription(study, description)),
+	}
+	if study.Appended {
+		tags = append(tags,
+			tagValue(dimse.Tag(0x0008, 0x0020), "DA", study.StudyDate),
+			tagValue(dimse.Tag(0x0008, 0x0030), "TM", study.StudyTime),
+			tagValue(dimse.Tag(0x0008, 0x0050), "SH", study.AccessionNumber),
+			tagValue(dimse.Tag(0x0020, 0x0011), "IS", strconv.Itoa(study.SeriesNumber)),
+		)
+	}
+	return ds.current().templates.apply(description, tags)
+}
+
+// seriesDescription returns the Series Description of the scanned pages
+func seriesDescription(study StudyIdentifiers, description string) string {
+	if study.Appended {
+		return description
+	}
+	return "Scanner imported document"
+}
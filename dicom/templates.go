@@ -0,0 +1,141 @@
+package dicom
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"DICOMScanStation/config"
+	"DICOMScanStation/dimse"
+)
+
+// templateAttributes are the attributes a tag template may set, by keyword
+var templateAttributes = map[string]struct {
+	tag uint32
+	vr  string
+}{
+	"Modality":                    {dimse.Tag(0x0008, 0x0060), "CS"},
+	"ConversionType":              {dimse.Tag(0x0008, 0x0064), "CS"},
+	"StudyDescription":            {dimse.Tag(0x0008, 0x1030), "LO"},
+	"SeriesDescription":           {dimse.Tag(0x0008, 0x103E), "LO"},
+	"InstitutionalDepartmentName": {dimse.Tag(0x0008, 0x1040), "LO"},
+	"BodyPartExamined":            {dimse.Tag(0x0018, 0x0015), "CS"},
+	"ProtocolName":                {dimse.Tag(0x0018, 0x1030), "LO"},
+	"SeriesNumber":                {dimse.Tag(0x0020, 0x0011), "IS"},
+	"ImageComments":               {dimse.Tag(0x0020, 0x4000), "LT"},
+	"DocumentTitle":               {dimse.Tag(0x0042, 0x0010), "ST"},
+}
+
+// TagTemplates map a document type, the description the operator selects,
+// to the attributes written to its instances. They are read from the JSON
+// file of DICOM_TAG_TEMPLATES, e.g.
+//
+//	{"Consent": {"SeriesDescription": "Consent form", "Modality": "DOC"}}
+type TagTemplates struct {
+	// byType holds the attributes by lower-case document type
+	byType map[string]map[string]string
+	names  map[string]string
+}
+
+// LoadTagTemplates reads the templates file; without DICOM_TAG_TEMPLATES
+// no document type has a template
+func LoadTagTemplates(cfg *config.Config) (*TagTemplates, error) {
+	templates := &TagTemplates{byType: map[string]map[string]string{}, names: map[string]string{}}
+	path := strings.TrimSpace(cfg.DicomTagTemplates)
+	if path == "" {
+		return templates, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tag templates: %v", err)
+	}
+	var raw map[string]map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid tag templates file %s: %v", path, err)
+	}
+	for documentType, attributes := range raw {
+		key := strings.ToLower(strings.TrimSpace(documentType))
+		if key == "" {
+			return nil, fmt.Errorf("tag template with an empty document type")
+		}
+		if _, ok := templates.byType[key]; ok {
+			return nil, fmt.Errorf("document type '%s' has more than one tag template", documentType)
+		}
+		for keyword, value := range attributes {
+			attribute, ok := templateAttributes[keyword]
+			if !ok {
+				return nil, fmt.Errorf("tag template '%s': unsupported attribute '%s' (use %s)", documentType, keyword, strings.Join(TemplateAttributes(), ", "))
+			}
+			if _, err := strconv.Atoi(value); attribute.vr == "IS" && err != nil {
+				return nil, fmt.Errorf("tag template '%s': %s must be a number", documentType, keyword)
+			}
+		}
+		templates.byType[key] = attributes
+		templates.names[key] = strings.TrimSpace(documentType)
+	}
+	return templates, nil
+}
+
+// TemplateAttributes returns the keywords a tag template may set
+func TemplateAttributes() []string {
+	keywords := make([]string, 0, len(templateAttributes))
+	for keyword := range templateAttributes {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+	return keywords
+}
+
+// All returns the templates by document type as configured
+func (t *TagTemplates) All() map[string]map[string]string {
+	all := make(map[string]map[string]string)
+	if t == nil {
+		return all
+	}
+	for key, attributes := range t.byType {
+		all[t.names[key]] = attributes
+	}
+	return all
+}
+
+// value returns the value a template sets for the keyword
+func (t *TagTemplates) value(documentType string, keyword string) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	value, ok := t.byType[strings.ToLower(strings.TrimSpace(documentType))][keyword]
+	return value, ok
+}
+
+// apply replaces or adds the attributes of the document type's template
+func (t *TagTemplates) apply(documentType string, elements []dimse.Element) []dimse.Element {
+	if t == nil {
+		return elements
+	}
+	attributes, ok := t.byType[strings.ToLower(strings.TrimSpace(documentType))]
+	if !ok {
+		return elements
+	}
+	for keyword, value := range attributes {
+		attribute := templateAttributes[keyword]
+		if attribute.vr == "CS" {
+			value = strings.ToUpper(value)
+		}
+		e := tagValue(attribute.tag, attribute.vr, value)
+		replaced := false
+		for i := range elements {
+			if elements[i].Tag == attribute.tag {
+				elements[i] = e
+				replaced = true
+			}
+		}
+		if !replaced {
+			elements = append(elements, e)
+		}
+	}
+	return elements
+}
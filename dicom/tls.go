@@ -0,0 +1,90 @@
+package dicom
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"DICOMScanStation/config"
+)
+
+// TLS policies for DICOM associations
+const (
+	// TLSPolicyBCP195 follows the BCP 195 TLS Secure Transport Connection
+	// Profile (PS3.15 B.9): TLS 1.2 or newer with forward secret AEAD
+	// cipher suites
+	TLSPolicyBCP195 = "bcp195"
+	// TLSPolicyTLS13 accepts TLS 1.3 only
+	TLSPolicyTLS13 = "tls13"
+	// TLSPolicyLegacy also allows TLS 1.2 CBC suites for older archives
+	TLSPolicyLegacy = "legacy"
+)
+
+// bcp195CipherSuites are the TLS 1.2 suites of the BCP 195 policy; TLS 1.3
+// suites are not configurable and always secure
+var bcp195CipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// LoadTLSConfig returns the client TLS configuration for query and store
+// associations, nil if DICOM_TLS is disabled
+func LoadTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if !cfg.DicomTLS {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{ServerName: cfg.DicomTLSServerName}
+	switch strings.ToLower(strings.TrimSpace(cfg.DicomTLSPolicy)) {
+	case "", TLSPolicyBCP195:
+		tlsConfig.MinVersion = tls.VersionTLS12
+		tlsConfig.CipherSuites = bcp195CipherSuites
+	case TLSPolicyTLS13:
+		tlsConfig.MinVersion = tls.VersionTLS13
+	case TLSPolicyLegacy:
+		tlsConfig.MinVersion = tls.VersionTLS12
+	default:
+		return nil, fmt.Errorf("unknown DICOM_TLS_POLICY '%s' (use bcp195, tls13 or legacy)", cfg.DicomTLSPolicy)
+	}
+
+	// The client certificate identifies the station to archives that
+	// require mutual authentication
+	if cfg.DicomTLSCert != "" || cfg.DicomTLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.DicomTLSCert, cfg.DicomTLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the DICOM TLS certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	// Without a CA file the PACS certificate is verified against the
+	// system roots
+	if cfg.DicomTLSCA != "" {
+		pem, err := os.ReadFile(cfg.DicomTLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read DICOM_TLS_CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("DICOM_TLS_CA %s contains no PEM certificate", cfg.DicomTLSCA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// sameTLS tells whether a and b have the same DICOM TLS settings
+func sameTLS(a, b *config.Config) bool {
+	return a.DicomTLS == b.DicomTLS &&
+		a.DicomTLSCert == b.DicomTLSCert &&
+		a.DicomTLSKey == b.DicomTLSKey &&
+		a.DicomTLSCA == b.DicomTLSCA &&
+		a.DicomTLSServerName == b.DicomTLSServerName &&
+		a.DicomTLSPolicy == b.DicomTLSPolicy
+}
@@ -0,0 +1,87 @@
+package dicom
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// MaxUIDRootLength leaves room in the 64 characters of a UID for the
+// generated part and the series and instance numbers appended to it
+const MaxUIDRootLength = 30
+
+// dicomUIDRoot is reserved for UIDs defined by the standard
+const dicomUIDRoot = "1.2.840.10008"
+
+// UIDGenerator creates study, series and instance UIDs below the
+// organization root of DICOM_UID_ROOT. A UID is the root followed by the
+// time in seconds, a random number and a per-process counter, so it is
+// unique across restarts and across stations sharing a root. Without a
+// root UUID derived UIDs below 2.25 are created.
+type UIDGenerator struct {
+	root    string
+	counter atomic.Uint64
+}
+
+// NewUIDGenerator returns a generator for the root; an empty root uses 2.25
+func NewUIDGenerator(root string) (*UIDGenerator, error) {
+	root = strings.TrimSpace(root)
+	if err := ValidateUIDRoot(root); err != nil {
+		return nil, err
+	}
+	return &UIDGenerator{root: root}, nil
+}
+
+// ValidateUIDRoot checks that root is a valid UID prefix of at most
+// MaxUIDRootLength characters outside the DICOM standard root
+func ValidateUIDRoot(root string) error {
+	if root == "" {
+		return nil
+	}
+	if len(root) > MaxUIDRootLength {
+		return fmt.Errorf("UID root %q is longer than %d characters", root, MaxUIDRootLength)
+	}
+	for _, component := range strings.Split(root, ".") {
+		if component == "" || strings.Trim(component, "0123456789") != "" {
+			return fmt.Errorf("UID root %q must be numbers separated by dots", root)
+		}
+		if len(component) > 1 && component[0] == '0' {
+			return fmt.Errorf("UID root %q has a component with a leading zero", root)
+		}
+	}
+	if root == dicomUIDRoot || strings.HasPrefix(root, dicomUIDRoot+".") {
+		return fmt.Errorf("UID root %q is reserved for the DICOM standard", root)
+	}
+	return nil
+}
+
+// New returns a new unique UID
+func (g *UIDGenerator) New() string {
+	if g == nil || g.root == "" {
+		return newUID()
+	}
+	// The random part starts with 1-9, as UID components must not have
+	// leading zeros
+	n, err := rand.Int(rand.Reader, big.NewInt(90000000))
+	random := int64(0)
+	if err == nil {
+		random = n.Int64()
+	}
+	return g.root + "." +
+		strconv.FormatInt(time.Now().Unix(), 10) + "." +
+		strconv.FormatInt(10000000+random, 10) + "." +
+		strconv.FormatUint(g.counter.Add(1), 10)
+}
+
+// newUID returns a UUID derived UID (2.25 root)
+func newUID() string {
+	n, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Sprintf("2.25.%d", time.Now().UnixNano())
+	}
+	return "2.25." + n.String()
+}
@@ -0,0 +1,196 @@
+package dimse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Command fields (PS3.7 section E.1)
+const (
+	commandCStoreRQ  = 0x0001
+	commandCStoreRSP = 0x8001
+	commandCEchoRQ   = 0x0030
+	commandCEchoRSP  = 0x8030
+	commandCFindRQ   = 0x0020
+	commandCFindRSP  = 0x8020
+	commandCCancelRQ = 0x0FFF
+
+	commandNEventReportRQ  = 0x0100
+	commandNEventReportRSP = 0x8100
+	commandNSetRQ          = 0x0120
+	commandNSetRSP         = 0x8120
+	commandNActionRQ       = 0x0130
+	commandNActionRSP      = 0x8130
+	commandNCreateRQ       = 0x0140
+	commandNCreateRSP      = 0x8140
+)
+
+// Command elements of group 0000
+const (
+	tagGroupLength             = 0x0000
+	tagAffectedSOPClassUID     = 0x0002
+	tagRequestedSOPClassUID    = 0x0003
+	tagCommandField            = 0x0100
+	tagMessageID               = 0x0110
+	tagMessageIDRespondedTo    = 0x0120
+	tagPriority                = 0x0700
+	tagCommandDataSetType      = 0x0800
+	tagStatus                  = 0x0900
+	tagErrorComment            = 0x0902
+	tagAffectedSOPInstanceUID  = 0x1000
+	tagRequestedSOPInstanceUID = 0x1001
+	tagEventTypeID             = 0x1002
+	tagActionTypeID            = 0x1008
+)
+
+// Values of CommandDataSetType
+const (
+	dataSetPresent = 0x0000
+	noDataSet      = 0x0101
+)
+
+// command is a DIMSE command set, keyed by the element number of group 0000
+type command map[uint16][]byte
+
+func (c command) setUS(element uint16, v uint16) {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, v)
+	c[element] = b
+}
+
+func (c command) setUI(element uint16, uid string) {
+	b := []byte(uid)
+	if len(b)%2 != 0 {
+		b = append(b, 0)
+	}
+	c[element] = b
+}
+
+func (c command) us(element uint16) (uint16, bool) {
+	b, ok := c[element]
+	if !ok || len(b) != 2 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint16(b), true
+}
+
+func (c command) str(element uint16) string {
+	return strings.TrimRight(string(c[element]), "\x00 ")
+}
+
+// encode writes the command set in implicit VR little endian with the
+// group length first, as required for command sets
+func (c command) encode() []byte {
+	elements := make([]uint16, 0, len(c))
+	for e := range c {
+		if e != tagGroupLength {
+			elements = append(elements, e)
+		}
+	}
+	sort.Slice(elements, func(i, j int) bool { return elements[i] < elements[j] })
+
+	var body bytes.Buffer
+	for _, e := range elements {
+		writeElement(&body, e, c[e])
+	}
+
+	var b bytes.Buffer
+	length := make([]byte, 4)
+	binary.LittleEndian.PutUint32(length, uint32(body.Len()))
+	writeElement(&b, tagGroupLength, length)
+	b.Write(body.Bytes())
+	return b.Bytes()
+}
+
+func writeElement(b *bytes.Buffer, element uint16, value []byte) {
+	binary.Write(b, binary.LittleEndian, uint16(0x0000))
+	binary.Write(b, binary.LittleEndian, element)
+	binary.Write(b, binary.LittleEndian, uint32(len(value)))
+	b.Write(value)
+}
+
+func decodeCommand(data []byte) (command, error) {
+	c := command{}
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("truncated command element")
+		}
+		group := binary.LittleEndian.Uint16(data)
+		element := binary.LittleEndian.Uint16(data[2:])
+		length := int(binary.LittleEndian.Uint32(data[4:]))
+		if group != 0x0000 {
+			return nil, fmt.Errorf("unexpected group %04x in command set", group)
+		}
+		if len(data) < 8+length {
+			return nil, fmt.Errorf("command element (0000,%04x) exceeds the command set", element)
+		}
+		c[element] = data[8 : 8+length]
+		data = data[8+length:]
+	}
+	return c, nil
+}
+
+// Status is the status of a DIMSE response
+type Status uint16
+
+// Success reports whether the operation completed, possibly with a warning
+func (s Status) Success() bool {
+	return s == 0x0000 || s&0xf000 == 0xb000
+}
+
+// Pending reports whether more responses to the request follow
+func (s Status) Pending() bool {
+	return s == 0xff00 || s == 0xff01
+}
+
+// Cancelled reports whether the request ended after a C-CANCEL
+func (s Status) Cancelled() bool {
+	return s == 0xfe00
+}
+
+// Warning reports whether the operation completed with a warning
+func (s Status) Warning() bool {
+	return s != 0x0000 && s.Success()
+}
+
+func (s Status) String() string {
+	switch {
+	case s == 0x0000:
+		return "success"
+	case s.Pending():
+		return fmt.Sprintf("pending 0x%04X", uint16(s))
+	case s.Cancelled():
+		return "cancelled (0xFE00)"
+	case s.Warning():
+		return fmt.Sprintf("warning 0x%04X", uint16(s))
+	case s&0xff00 == 0xa700:
+		return fmt.Sprintf("out of resources (0x%04X)", uint16(s))
+	case s&0xff00 == 0xa900:
+		return fmt.Sprintf("data set does not match SOP class (0x%04X)", uint16(s))
+	case s&0xf000 == 0xc000:
+		return fmt.Sprintf("cannot understand (0x%04X)", uint16(s))
+	case s == 0x0122:
+		return "SOP class not supported (0x0122)"
+	case s == 0x0124:
+		return "refused: not authorized (0x0124)"
+	default:
+		return fmt.Sprintf("failure 0x%04X", uint16(s))
+	}
+}
+
+// StatusError is returned when the peer answers a request with a failure
+// status. The association stays usable.
+type StatusError struct {
+	Status  Status
+	Comment string
+}
+
+func (e *StatusError) Error() string {
+	if e.Comment != "" {
+		return fmt.Sprintf("%s: %s", e.Status, e.Comment)
+	}
+	return e.Status.String()
+}
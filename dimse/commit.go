@@ -0,0 +1,250 @@
+package dimse
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// StorageCommitment is the SOP class of the Storage Commitment Push Model
+// (PS3.4 annex J)
+const StorageCommitment = "1.2.840.10008.1.20.1"
+
+// storageCommitmentInstance is the well-known SOP instance of the push model
+const storageCommitmentInstance = "1.2.840.10008.1.20.1.1"
+
+// Action and event types of the push model
+const (
+	actionRequestCommitment    = 1
+	eventCommitted             = 1
+	eventCommittedWithFailures = 2
+)
+
+// Data elements of storage commitment requests and reports
+var (
+	tagTransactionUID           = Tag(0x0008, 0x1195)
+	tagReferencedSOPSequence    = Tag(0x0008, 0x1199)
+	tagFailedSOPSequence        = Tag(0x0008, 0x1198)
+	tagReferencedSOPClassUID    = Tag(0x0008, 0x1150)
+	tagReferencedSOPInstanceUID = Tag(0x0008, 0x1155)
+	tagFailureReason            = Tag(0x0008, 0x1197)
+)
+
+// ErrNoReport is returned by WaitCommitment when the SCP did not send the
+// commitment report on the association in time. It may still send it on
+// an association of its own.
+var ErrNoReport = errors.New("no storage commitment report on the association")
+
+// CommitReference names an instance in a storage commitment transaction
+type CommitReference struct {
+	SOPClassUID    string
+	SOPInstanceUID string
+}
+
+// CommitFailure is an instance the SCP did not commit
+type CommitFailure struct {
+	CommitReference
+	Reason uint16
+}
+
+// ReasonText describes the failure reason (PS3.4 section J.3.3.1.1)
+func (f CommitFailure) ReasonText() string {
+	switch f.Reason {
+	case 0x0110:
+		return "processing failure"
+	case 0x0112:
+		return "no such object instance"
+	case 0x0213:
+		return "resource limitation"
+	case 0x0122:
+		return "SOP class not supported"
+	case 0x0119:
+		return "class/instance conflict"
+	case 0x0131:
+		return "duplicate transaction UID"
+	default:
+		return fmt.Sprintf("failure 0x%04X", f.Reason)
+	}
+}
+
+// CommitReport is the N-EVENT-REPORT of a storage commitment transaction
+type CommitReport struct {
+	TransactionUID string
+	Committed      []CommitReference
+	Failed         []CommitFailure
+}
+
+// RequestCommitment asks the SCP with an N-ACTION request to commit the
+// instances. The result follows in an N-EVENT-REPORT, on this association
+// (see WaitCommitment) or on one the SCP opens. A failure status is
+// returned as *StatusError; any other error means the association broke.
+func (a *Association) RequestCommitment(transactionUID string, refs []CommitReference) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.broken {
+		return fmt.Errorf("association is closed")
+	}
+	pc, ok := a.accepted(StorageCommitment)
+	if !ok {
+		return fmt.Errorf("peer did not accept the Storage Commitment SOP class")
+	}
+	explicit := pc.TransferSyntax != ImplicitVRLittleEndian
+
+	items := make([][]Element, len(refs))
+	for i, ref := range refs {
+		items[i] = []Element{
+			String(tagReferencedSOPClassUID, "UI", ref.SOPClassUID),
+			String(tagReferencedSOPInstanceUID, "UI", ref.SOPInstanceUID),
+		}
+	}
+	dataSet := EncodeDataSet([]Element{
+		String(tagTransactionUID, "UI", transactionUID),
+		Sequence(tagReferencedSOPSequence, items),
+	}, explicit)
+
+	a.setDeadline()
+	messageID := a.nextMessageID()
+	cmd := command{}
+	cmd.setUI(tagRequestedSOPClassUID, StorageCommitment)
+	cmd.setUS(tagCommandField, commandNActionRQ)
+	cmd.setUS(tagMessageID, messageID)
+	cmd.setUS(tagCommandDataSetType, dataSetPresent)
+	cmd.setUI(tagRequestedSOPInstanceUID, storageCommitmentInstance)
+	cmd.setUS(tagActionTypeID, actionRequestCommitment)
+	if err := a.send(pc.ID, cmd, dataSet); err != nil {
+		return a.fail(err)
+	}
+
+	rsp, _, err := a.receive()
+	if err != nil {
+		return a.fail(err)
+	}
+	if field, _ := rsp.us(tagCommandField); field != commandNActionRSP {
+		return a.fail(fmt.Errorf("unexpected response command 0x%04x", field))
+	}
+	if id, _ := rsp.us(tagMessageIDRespondedTo); id != messageID {
+		return a.fail(fmt.Errorf("response to message %d instead of %d", id, messageID))
+	}
+	value, ok := rsp.us(tagStatus)
+	if !ok {
+		return a.fail(fmt.Errorf("response without status"))
+	}
+	if status := Status(value); !status.Success() {
+		return &StatusError{Status: status, Comment: rsp.str(tagErrorComment)}
+	}
+	return nil
+}
+
+// WaitCommitment waits up to timeout for the SCP to send the commitment
+// report on this association and acknowledges it. ErrNoReport is returned
+// if it does not; the association can still be released then.
+func (a *Association) WaitCommitment(timeout time.Duration) (*CommitReport, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.broken {
+		return nil, fmt.Errorf("association is closed")
+	}
+	a.conn.SetDeadline(time.Now().Add(timeout))
+	cmd, data, err := a.receive()
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return nil, ErrNoReport
+	}
+	if err != nil {
+		return nil, a.fail(err)
+	}
+	if field, _ := cmd.us(tagCommandField); field != commandNEventReportRQ {
+		return nil, a.fail(fmt.Errorf("unexpected command 0x%04x", field))
+	}
+	a.setDeadline()
+	report, err := a.answerEventReport(cmd, data)
+	if err != nil {
+		return nil, a.fail(err)
+	}
+	return report, nil
+}
+
+// answerEventReport decodes a storage commitment N-EVENT-REPORT and
+// acknowledges it
+func (a *Association) answerEventReport(cmd command, data []byte) (*CommitReport, error) {
+	if sopClass := cmd.str(tagAffectedSOPClassUID); sopClass != StorageCommitment {
+		return nil, fmt.Errorf("N-EVENT-REPORT of unexpected SOP class %s", sopClass)
+	}
+	if data == nil {
+		return nil, fmt.Errorf("N-EVENT-REPORT without data set")
+	}
+	eventType, _ := cmd.us(tagEventTypeID)
+	if eventType != eventCommitted && eventType != eventCommittedWithFailures {
+		return nil, fmt.Errorf("N-EVENT-REPORT of unexpected event type %d", eventType)
+	}
+	report, err := decodeCommitReport(data, a.explicit(a.received))
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage commitment report: %v", err)
+	}
+
+	messageID, _ := cmd.us(tagMessageID)
+	rsp := command{}
+	rsp.setUI(tagAffectedSOPClassUID, StorageCommitment)
+	rsp.setUS(tagCommandField, commandNEventReportRSP)
+	rsp.setUS(tagMessageIDRespondedTo, messageID)
+	rsp.setUS(tagCommandDataSetType, noDataSet)
+	rsp.setUS(tagStatus, 0)
+	rsp.setUI(tagAffectedSOPInstanceUID, cmd.str(tagAffectedSOPInstanceUID))
+	rsp.setUS(tagEventTypeID, eventType)
+	if err := a.send(a.received, rsp, nil); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func decodeCommitReport(data []byte, explicit bool) (*CommitReport, error) {
+	ds, err := ParseDataSet(data, explicit)
+	if err != nil {
+		return nil, err
+	}
+	report := &CommitReport{TransactionUID: ds.Text(tagTransactionUID)}
+	if report.TransactionUID == "" {
+		return nil, fmt.Errorf("missing transaction UID")
+	}
+
+	committed, err := SequenceItems(data, explicit, tagReferencedSOPSequence)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range committed {
+		report.Committed = append(report.Committed, commitReference(item))
+	}
+	failed, err := SequenceItems(data, explicit, tagFailedSOPSequence)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range failed {
+		f := CommitFailure{CommitReference: commitReference(item)}
+		if e, ok := item[tagFailureReason]; ok && len(e.Value) == 2 {
+			f.Reason = uint16(e.Value[0]) | uint16(e.Value[1])<<8
+		}
+		report.Failed = append(report.Failed, f)
+	}
+	return report, nil
+}
+
+func commitReference(item DataSet) CommitReference {
+	return CommitReference{
+		SOPClassUID:    item.Text(tagReferencedSOPClassUID),
+		SOPInstanceUID: item.Text(tagReferencedSOPInstanceUID),
+	}
+}
+
+// explicit reports whether data sets of the presentation context are in
+// explicit VR
+func (a *Association) explicit(contextID byte) bool {
+	for _, pc := range a.contexts {
+		if pc.ID == contextID {
+			return pc.TransferSyntax != ImplicitVRLittleEndian
+		}
+	}
+	return false
+}
@@ -0,0 +1,360 @@
+package dimse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Element is one data element of a data set
+type Element struct {
+	Tag   uint32
+	VR    string
+	Value []byte
+	// Fragments holds encapsulated pixel data; Value is ignored when set
+	Fragments [][]byte
+	// Items holds the items of a sequence built with Sequence
+	Items [][]Element
+}
+
+// Tag combines group and element number
+func Tag(group, element uint16) uint32 {
+	return uint32(group)<<16 | uint32(element)
+}
+
+// String returns an element with a text value padded to even length
+func String(tag uint32, vr string, value string) Element {
+	b := []byte(value)
+	if len(b)%2 != 0 {
+		if vr == "UI" {
+			b = append(b, 0)
+		} else {
+			b = append(b, ' ')
+		}
+	}
+	return Element{Tag: tag, VR: vr, Value: b}
+}
+
+// US returns an unsigned short element
+func US(tag uint32, value uint16) Element {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, value)
+	return Element{Tag: tag, VR: "US", Value: b}
+}
+
+// longVR lists the VRs with a 4 byte length in explicit VR encoding
+var longVR = map[string]bool{
+	"OB": true, "OD": true, "OF": true, "OL": true, "OV": true, "OW": true,
+	"SQ": true, "SV": true, "UC": true, "UN": true, "UR": true, "UT": true, "UV": true,
+}
+
+// EncodeDataSet writes the elements in ascending tag order in explicit or
+// implicit VR little endian
+func EncodeDataSet(elements []Element, explicit bool) []byte {
+	sorted := append([]Element(nil), elements...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Tag < sorted[j].Tag })
+
+	var b bytes.Buffer
+	for _, e := range sorted {
+		binary.Write(&b, binary.LittleEndian, uint16(e.Tag>>16))
+		binary.Write(&b, binary.LittleEndian, uint16(e.Tag))
+
+		if e.VR == "SQ" && e.Value == nil {
+			var items bytes.Buffer
+			for _, item := range e.Items {
+				data := EncodeDataSet(item, explicit)
+				writeItemTag(&items, 0xE000, uint32(len(data)))
+				items.Write(data)
+			}
+			e.Value = items.Bytes()
+		}
+		length := uint32(len(e.Value))
+		if e.Fragments != nil {
+			length = 0xFFFFFFFF
+		}
+		switch {
+		case !explicit:
+			binary.Write(&b, binary.LittleEndian, length)
+		case longVR[e.VR]:
+			b.WriteString(e.VR)
+			b.Write([]byte{0, 0})
+			binary.Write(&b, binary.LittleEndian, length)
+		default:
+			b.WriteString(e.VR)
+			binary.Write(&b, binary.LittleEndian, uint16(length))
+		}
+
+		if e.Fragments == nil {
+			b.Write(e.Value)
+			continue
+		}
+		// Empty basic offset table, the fragments and the sequence delimiter
+		writeItemTag(&b, 0xE000, 0)
+		for _, f := range e.Fragments {
+			if len(f)%2 != 0 {
+				f = append(f[:len(f):len(f)], 0)
+			}
+			writeItemTag(&b, 0xE000, uint32(len(f)))
+			b.Write(f)
+		}
+		writeItemTag(&b, 0xE0DD, 0)
+	}
+	return b.Bytes()
+}
+
+// Sequence returns a sequence element holding the items. It is encoded
+// with defined length in the transfer syntax of the data set.
+func Sequence(tag uint32, items [][]Element) Element {
+	return Element{Tag: tag, VR: "SQ", Items: items}
+}
+
+func writeItemTag(b *bytes.Buffer, element uint16, length uint32) {
+	binary.Write(b, binary.LittleEndian, uint16(0xFFFE))
+	binary.Write(b, binary.LittleEndian, element)
+	binary.Write(b, binary.LittleEndian, length)
+}
+
+// DataSet is a decoded data set, keyed by tag. Sequences are kept as
+// elements without value; SequenceItems decodes their items.
+type DataSet map[uint32]Element
+
+// Text returns the value of a string element without padding, "" if the
+// element is missing
+func (d DataSet) Text(tag uint32) string {
+	e, ok := d[tag]
+	if !ok {
+		return ""
+	}
+	return strings.TrimRight(string(e.Value), "\x00 ")
+}
+
+// undefinedLength marks sequences and items delimited by a delimiter item
+const undefinedLength = 0xFFFFFFFF
+
+// ParseDataSet decodes a data set in explicit or implicit VR little endian
+func ParseDataSet(data []byte, explicit bool) (DataSet, error) {
+	d := DataSet{}
+	_, err := parseElements(data, explicit, false, d)
+	return d, err
+}
+
+// SequenceItems decodes the items of a sequence in the top level of a data
+// set. A missing sequence has no items.
+func SequenceItems(data []byte, explicit bool, tag uint32) ([]DataSet, error) {
+	pos := 0
+	for pos < len(data) {
+		e, err := readElement(data, pos, explicit)
+		if err != nil {
+			return nil, err
+		}
+		if e.tag == tag {
+			return parseItems(data[e.start:e.end], explicit)
+		}
+		pos = e.end
+	}
+	return nil, nil
+}
+
+// parseItems decodes the items of a sequence, which ends with the data or
+// with a sequence delimiter
+func parseItems(data []byte, explicit bool) ([]DataSet, error) {
+	var items []DataSet
+	pos := 0
+	for pos+8 <= len(data) {
+		tag := Tag(binary.LittleEndian.Uint16(data[pos:]), binary.LittleEndian.Uint16(data[pos+2:]))
+		length := binary.LittleEndian.Uint32(data[pos+4:])
+		pos += 8
+		switch tag {
+		case sequenceDelimitationTag:
+			return items, nil
+		case itemTag:
+			item := DataSet{}
+			if length == undefinedLength {
+				n, err := parseElements(data[pos:], explicit, true, item)
+				if err != nil {
+					return nil, err
+				}
+				pos += n
+			} else {
+				if uint64(pos)+uint64(length) > uint64(len(data)) {
+					return nil, fmt.Errorf("sequence item exceeds the data set")
+				}
+				if _, err := parseElements(data[pos:pos+int(length)], explicit, false, item); err != nil {
+					return nil, err
+				}
+				pos += int(length)
+			}
+			items = append(items, item)
+		default:
+			return nil, fmt.Errorf("unexpected tag (%04X,%04X) in sequence", tag>>16, tag&0xFFFF)
+		}
+	}
+	return items, nil
+}
+
+// rawElement is an element as found in an encoded data set
+type rawElement struct {
+	tag   uint32
+	vr    string
+	value []byte
+	// undefined is set for sequences and encapsulated pixel data of
+	// undefined length, whose items are not decoded
+	undefined bool
+	// start is the offset of the value, end the offset after the element
+	start int
+	end   int
+}
+
+// readElement reads the element at pos
+func readElement(data []byte, pos int, explicit bool) (rawElement, error) {
+	if pos+8 > len(data) {
+		return rawElement{}, fmt.Errorf("truncated data element at offset %d", pos)
+	}
+	e := rawElement{tag: Tag(binary.LittleEndian.Uint16(data[pos:]), binary.LittleEndian.Uint16(data[pos+2:]))}
+
+	var length uint32
+	header := 8
+	switch {
+	case !explicit || e.tag>>16 == 0xFFFE:
+		length = binary.LittleEndian.Uint32(data[pos+4:])
+	default:
+		e.vr = string(data[pos+4 : pos+6])
+		if longVR[e.vr] {
+			if pos+12 > len(data) {
+				return rawElement{}, fmt.Errorf("truncated data element at offset %d", pos)
+			}
+			length = binary.LittleEndian.Uint32(data[pos+8:])
+			header = 12
+		} else {
+			length = uint32(binary.LittleEndian.Uint16(data[pos+6:]))
+		}
+	}
+	pos += header
+	e.start = pos
+
+	if length == undefinedLength && e.tag>>16 != 0xFFFE {
+		// A sequence, encapsulated pixel data or UN holding an implicit VR
+		// sequence
+		n, err := skipSequence(data[pos:], explicit && e.vr != "UN")
+		if err != nil {
+			return rawElement{}, err
+		}
+		e.undefined = true
+		e.end = pos + n
+		return e, nil
+	}
+	if length != undefinedLength && uint64(pos)+uint64(length) > uint64(len(data)) {
+		return rawElement{}, fmt.Errorf("element (%04X,%04X) exceeds the data set", e.tag>>16, e.tag&0xFFFF)
+	}
+	if length != undefinedLength {
+		e.value = data[pos : pos+int(length)]
+		pos += int(length)
+	}
+	e.end = pos
+	return e, nil
+}
+
+// parseElements decodes elements into d, which may be nil to skip them.
+// Inside an item of undefined length it stops after the item delimiter and
+// returns the number of bytes consumed.
+func parseElements(data []byte, explicit bool, inItem bool, d DataSet) (int, error) {
+	pos := 0
+	for pos < len(data) {
+		e, err := readElement(data, pos, explicit)
+		if err != nil {
+			return 0, err
+		}
+		if e.tag == itemDelimitationTag {
+			if !inItem {
+				return 0, fmt.Errorf("unexpected item delimiter at offset %d", pos)
+			}
+			return e.end, nil
+		}
+		pos = e.end
+		if d == nil {
+			continue
+		}
+		switch {
+		case e.undefined && e.vr == "":
+			d[e.tag] = Element{Tag: e.tag, VR: "SQ"}
+		case e.undefined || e.vr == "SQ":
+			d[e.tag] = Element{Tag: e.tag, VR: e.vr}
+		default:
+			d[e.tag] = Element{Tag: e.tag, VR: e.vr, Value: e.value}
+		}
+	}
+	if inItem {
+		return 0, fmt.Errorf("item without delimiter")
+	}
+	return pos, nil
+}
+
+// SetElements returns the data set with the given elements replaced or
+// inserted. All other elements, including sequences and pixel data, are
+// kept byte for byte.
+func SetElements(data []byte, explicit bool, elements []Element) ([]byte, error) {
+	set := append([]Element(nil), elements...)
+	sort.Slice(set, func(i, j int) bool { return set[i].Tag < set[j].Tag })
+
+	var b bytes.Buffer
+	pos := 0
+	for pos < len(data) {
+		e, err := readElement(data, pos, explicit)
+		if err != nil {
+			return nil, err
+		}
+		for len(set) > 0 && set[0].Tag < e.tag {
+			b.Write(EncodeDataSet(set[:1], explicit))
+			set = set[1:]
+		}
+		if len(set) > 0 && set[0].Tag == e.tag {
+			b.Write(EncodeDataSet(set[:1], explicit))
+			set = set[1:]
+		} else {
+			b.Write(data[pos:e.end])
+		}
+		pos = e.end
+	}
+	b.Write(EncodeDataSet(set, explicit))
+	return b.Bytes(), nil
+}
+
+// Tags of the items and delimiters of sequences
+const (
+	itemTag                 = 0xFFFEE000
+	itemDelimitationTag     = 0xFFFEE00D
+	sequenceDelimitationTag = 0xFFFEE0DD
+)
+
+// skipSequence returns the length of a sequence of undefined length up to
+// and including its delimiter
+func skipSequence(data []byte, explicit bool) (int, error) {
+	pos := 0
+	for pos+8 <= len(data) {
+		tag := Tag(binary.LittleEndian.Uint16(data[pos:]), binary.LittleEndian.Uint16(data[pos+2:]))
+		length := binary.LittleEndian.Uint32(data[pos+4:])
+		pos += 8
+		switch tag {
+		case sequenceDelimitationTag:
+			return pos, nil
+		case itemTag:
+			if length == undefinedLength {
+				n, err := parseElements(data[pos:], explicit, true, nil)
+				if err != nil {
+					return 0, err
+				}
+				pos += n
+				continue
+			}
+			if uint64(pos)+uint64(length) > uint64(len(data)) {
+				return 0, fmt.Errorf("sequence item exceeds the data set")
+			}
+			pos += int(length)
+		default:
+			return 0, fmt.Errorf("unexpected tag (%04X,%04X) in sequence", tag>>16, tag&0xFFFF)
+		}
+	}
+	return 0, fmt.Errorf("sequence without delimiter")
+}
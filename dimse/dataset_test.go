@@ -0,0 +1,129 @@
+package dimse
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeDataSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		elements []Element
+		explicit bool
+		want     []byte
+	}{
+		{
+			name:     "text padded with a space",
+			elements: []Element{String(Tag(0x0010, 0x0010), "PN", "Doe^J")},
+			explicit: true,
+			want:     []byte{0x10, 0x00, 0x10, 0x00, 'P', 'N', 6, 0, 'D', 'o', 'e', '^', 'J', ' '},
+		},
+		{
+			name:     "UID padded with zero",
+			elements: []Element{String(Tag(0x0008, 0x0018), "UI", "1.2.3")},
+			explicit: true,
+			want:     []byte{0x08, 0x00, 0x18, 0x00, 'U', 'I', 6, 0, '1', '.', '2', '.', '3', 0},
+		},
+		{
+			name:     "implicit VR",
+			elements: []Element{String(Tag(0x0010, 0x0010), "PN", "Doe^J")},
+			explicit: false,
+			want:     []byte{0x10, 0x00, 0x10, 0x00, 6, 0, 0, 0, 'D', 'o', 'e', '^', 'J', ' '},
+		},
+		{
+			name: "ascending tag order",
+			elements: []Element{
+				US(Tag(0x0028, 0x0010), 512),
+				String(Tag(0x0010, 0x0020), "LO", "42"),
+			},
+			explicit: true,
+			want: []byte{
+				0x10, 0x00, 0x20, 0x00, 'L', 'O', 2, 0, '4', '2',
+				0x28, 0x00, 0x10, 0x00, 'U', 'S', 2, 0, 0x00, 0x02,
+			},
+		},
+		{
+			name:     "long VR",
+			elements: []Element{{Tag: Tag(0x7FE0, 0x0010), VR: "OB", Value: []byte{1, 2}}},
+			explicit: true,
+			want:     []byte{0xE0, 0x7F, 0x10, 0x00, 'O', 'B', 0, 0, 2, 0, 0, 0, 1, 2},
+		},
+		{
+			name:     "encapsulated fragments",
+			elements: []Element{{Tag: Tag(0x7FE0, 0x0010), VR: "OB", Fragments: [][]byte{{1, 2, 3}}}},
+			explicit: true,
+			want: []byte{
+				0xE0, 0x7F, 0x10, 0x00, 'O', 'B', 0, 0, 0xFF, 0xFF, 0xFF, 0xFF,
+				0xFE, 0xFF, 0x00, 0xE0, 0, 0, 0, 0,
+				0xFE, 0xFF, 0x00, 0xE0, 4, 0, 0, 0, 1, 2, 3, 0,
+				0xFE, 0xFF, 0xDD, 0xE0, 0, 0, 0, 0,
+			},
+		},
+		{
+			name: "sequence of defined length",
+			elements: []Element{Sequence(Tag(0x0008, 0x1199), [][]Element{
+				{String(Tag(0x0008, 0x1150), "UI", "1.2")},
+			})},
+			explicit: true,
+			want: []byte{
+				0x08, 0x00, 0x99, 0x11, 'S', 'Q', 0, 0, 20, 0, 0, 0,
+				0xFE, 0xFF, 0x00, 0xE0, 12, 0, 0, 0,
+				0x08, 0x00, 0x50, 0x11, 'U', 'I', 4, 0, '1', '.', '2', 0,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EncodeDataSet(tt.elements, tt.explicit)
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("EncodeDataSet =\n% x\nwant\n% x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDataSet(t *testing.T) {
+	elements := []Element{
+		String(Tag(0x0010, 0x0010), "PN", "Doe^J"),
+		String(Tag(0x0010, 0x0020), "LO", "42"),
+		String(Tag(0x0020, 0x000D), "UI", "1.2.3"),
+	}
+	for _, explicit := range []bool{true, false} {
+		d, err := ParseDataSet(EncodeDataSet(elements, explicit), explicit)
+		if err != nil {
+			t.Fatalf("ParseDataSet (explicit %v): %v", explicit, err)
+		}
+		want := map[uint32]string{
+			Tag(0x0010, 0x0010): "Doe^J",
+			Tag(0x0010, 0x0020): "42",
+			Tag(0x0020, 0x000D): "1.2.3",
+			Tag(0x0010, 0x0030): "",
+		}
+		for tag, text := range want {
+			if got := d.Text(tag); got != text {
+				t.Errorf("Text(%08x) (explicit %v) = %q, want %q", tag, explicit, got, text)
+			}
+		}
+	}
+}
+
+func TestCommandEncode(t *testing.T) {
+	c := command{}
+	c.setUS(tagCommandField, 0x0030)
+	want := []byte{
+		0x00, 0x00, 0x00, 0x00, 4, 0, 0, 0, 10, 0, 0, 0,
+		0x00, 0x00, 0x00, 0x01, 2, 0, 0, 0, 0x30, 0x00,
+	}
+	got := c.encode()
+	if !bytes.Equal(got, want) {
+		t.Fatalf("encode = % x, want % x", got, want)
+	}
+
+	decoded, err := decodeCommand(got)
+	if err != nil {
+		t.Fatalf("decodeCommand: %v", err)
+	}
+	if !bytes.Equal(decoded[tagCommandField], []byte{0x30, 0x00}) {
+		t.Errorf("decodeCommand command field = % x, want 30 00", decoded[tagCommandField])
+	}
+}
@@ -0,0 +1,380 @@
+// Package dimse implements the client side of the DICOM upper layer protocol
+// (PS3.8) and the DIMSE services the station uses to talk to a PACS without
+// spawning a dcmtk process per request, plus a listener for the storage
+// commitment reports the PACS sends back.
+package dimse
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	applicationContextUID = "1.2.840.10008.3.1.1.1"
+
+	// ImplementationClassUID identifies this implementation to the peer
+	ImplementationClassUID = "2.25.121774912081782909569455096113353415548"
+	// ImplementationVersionName is sent along with the class UID
+	ImplementationVersionName = "DICOMSCANSTATION"
+
+	// maxReceivePDU is the largest P-DATA-TF PDU the peer may send
+	maxReceivePDU = 1 << 20
+	// defaultSendPDU is used when the peer does not limit the PDU length
+	defaultSendPDU = 1 << 20
+)
+
+// Transfer syntaxes
+const (
+	ImplicitVRLittleEndian = "1.2.840.10008.1.2"
+	ExplicitVRLittleEndian = "1.2.840.10008.1.2.1"
+	JPEGBaseline           = "1.2.840.10008.1.2.4.50"
+)
+
+// Result values of a presentation context in the A-ASSOCIATE-AC
+const (
+	contextAccepted = 0
+)
+
+// ErrAborted is returned when the peer aborted the association
+var ErrAborted = errors.New("association aborted by the peer")
+
+// errReleased is returned by receive when the peer asks to release the
+// association instead of sending a message
+var errReleased = errors.New("peer released the association during a request")
+
+// Options describe the association to open
+type Options struct {
+	CallingAETitle string
+	CalledAETitle  string
+	// Timeout limits connecting and each request; 0 means no limit
+	Timeout time.Duration
+	// TLS encrypts the association; nil connects over plain TCP
+	TLS *tls.Config
+}
+
+// Proposal is an abstract syntax offered with the transfer syntaxes the
+// station can send it in
+type Proposal struct {
+	AbstractSyntax   string
+	TransferSyntaxes []string
+}
+
+// PresentationContext is a proposed abstract syntax together with the result
+// of the negotiation
+type PresentationContext struct {
+	ID             byte
+	AbstractSyntax string
+	// TransferSyntax is the one accepted by the peer
+	TransferSyntax string
+	Result         byte
+
+	proposed []string
+}
+
+// ConnectError is returned when the connection, including the TLS
+// handshake, could not be established
+type ConnectError struct {
+	Err error
+}
+
+func (e *ConnectError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// RejectedError is returned when the peer rejects the association
+type RejectedError struct {
+	Result byte
+	Source byte
+	Reason byte
+}
+
+func (e *RejectedError) Error() string {
+	reason := fmt.Sprintf("reason %d", e.Reason)
+	if e.Source == 1 {
+		switch e.Reason {
+		case 3:
+			reason = "calling AE title not recognized"
+		case 7:
+			reason = "called AE title not recognized"
+		case 2:
+			reason = "application context not supported"
+		}
+	}
+	kind := "permanently"
+	if e.Result == 2 {
+		kind = "transiently"
+	}
+	return fmt.Sprintf("association rejected %s: %s", kind, reason)
+}
+
+// Association is an open association with a peer. Requests on one
+// association are serialized.
+type Association struct {
+	mu        sync.Mutex
+	conn      net.Conn
+	timeout   time.Duration
+	maxPDU    uint32
+	contexts  []PresentationContext
+	messageID uint16
+	// received is the presentation context of the last received message
+	received byte
+	// broken is set after a transport error; the association must not be
+	// used any more
+	broken bool
+}
+
+// Dial opens an association and negotiates one presentation context per
+// abstract and transfer syntax, so the peer can accept each combination on
+// its own
+func Dial(addr string, opts Options, proposals []Proposal) (*Association, error) {
+	var contexts []PresentationContext
+	id := byte(1)
+	for _, p := range proposals {
+		for _, ts := range p.TransferSyntaxes {
+			if id > 255-2 {
+				return nil, fmt.Errorf("too many presentation contexts")
+			}
+			contexts = append(contexts, PresentationContext{ID: id, AbstractSyntax: p.AbstractSyntax, proposed: []string{ts}})
+			id += 2
+		}
+	}
+	if len(contexts) == 0 {
+		return nil, fmt.Errorf("no presentation context to propose")
+	}
+
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	var conn net.Conn
+	var err error
+	if opts.TLS != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, opts.TLS)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, &ConnectError{Err: err}
+	}
+
+	a := &Association{conn: conn, timeout: opts.Timeout, contexts: contexts}
+	a.setDeadline()
+	if err := a.negotiate(opts); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *Association) negotiate(opts Options) error {
+	if err := writePDU(a.conn, pduAssociateRQ, encodeAssociateRQ(opts, a.contexts)); err != nil {
+		return err
+	}
+
+	p, err := readPDU(a.conn)
+	if err != nil {
+		return err
+	}
+	switch p.kind {
+	case pduAssociateAC:
+		maxPDU, err := decodeAssociateAC(p.data, a.contexts)
+		if err != nil {
+			return err
+		}
+		a.maxPDU = maxPDU
+		return nil
+	case pduAssociateRJ:
+		if len(p.data) < 4 {
+			return fmt.Errorf("truncated A-ASSOCIATE-RJ")
+		}
+		return &RejectedError{Result: p.data[1], Source: p.data[2], Reason: p.data[3]}
+	case pduAbort:
+		return ErrAborted
+	default:
+		return fmt.Errorf("unexpected PDU type 0x%02x during association", p.kind)
+	}
+}
+
+// Accepted returns the presentation contexts accepted by the peer
+func (a *Association) Accepted() []PresentationContext {
+	var accepted []PresentationContext
+	for _, pc := range a.contexts {
+		if pc.Result == contextAccepted && pc.TransferSyntax != "" {
+			accepted = append(accepted, pc)
+		}
+	}
+	return accepted
+}
+
+// Supports reports whether data of the abstract syntax can be sent in the
+// transfer syntax
+func (a *Association) Supports(abstractSyntax, transferSyntax string) bool {
+	_, ok := a.context(abstractSyntax, transferSyntax)
+	return ok
+}
+
+func (a *Association) context(abstractSyntax, transferSyntax string) (byte, bool) {
+	for _, pc := range a.Accepted() {
+		if pc.AbstractSyntax == abstractSyntax && (transferSyntax == "" || pc.TransferSyntax == transferSyntax) {
+			return pc.ID, true
+		}
+	}
+	return 0, false
+}
+
+// Broken reports whether the association failed and must be closed
+func (a *Association) Broken() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.broken
+}
+
+// Release ends the association orderly and closes the connection
+func (a *Association) Release() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	defer a.conn.Close()
+
+	if a.broken {
+		return nil
+	}
+	a.setDeadline()
+	if err := writePDU(a.conn, pduReleaseRQ, make([]byte, 4)); err != nil {
+		return err
+	}
+	for {
+		p, err := readPDU(a.conn)
+		if err != nil {
+			return err
+		}
+		switch p.kind {
+		case pduReleaseRP:
+			return nil
+		case pduAbort:
+			return ErrAborted
+		}
+		// Late P-DATA of a cancelled request is ignored
+	}
+}
+
+// Abort ends the association immediately
+func (a *Association) Abort() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.broken {
+		writePDU(a.conn, pduAbort, make([]byte, 4))
+		a.broken = true
+	}
+	a.conn.Close()
+}
+
+func (a *Association) setDeadline() {
+	if a.timeout > 0 {
+		a.conn.SetDeadline(time.Now().Add(a.timeout))
+	} else {
+		a.conn.SetDeadline(time.Time{})
+	}
+}
+
+func (a *Association) nextMessageID() uint16 {
+	a.messageID++
+	return a.messageID
+}
+
+// send writes a command and optional data set as P-DATA-TF PDUs, split to
+// the maximum length accepted by the peer
+func (a *Association) send(contextID byte, cmd command, dataSet []byte) error {
+	if err := a.sendFragments(contextID, true, cmd.encode()); err != nil {
+		return err
+	}
+	if dataSet != nil {
+		return a.sendFragments(contextID, false, dataSet)
+	}
+	return nil
+}
+
+func (a *Association) sendFragments(contextID byte, isCommand bool, data []byte) error {
+	maxPDU := int(a.maxPDU)
+	if maxPDU <= 6 || maxPDU > defaultSendPDU {
+		maxPDU = defaultSendPDU
+	}
+	// Each PDV item has 6 bytes of length, context ID and control header
+	size := maxPDU - 6
+
+	for {
+		n := len(data)
+		if n > size {
+			n = size
+		}
+		last := n == len(data)
+		if err := writePDU(a.conn, pduDataTF, encodePDV(contextID, isCommand, last, data[:n])); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		data = data[n:]
+	}
+}
+
+// receive reads the next DIMSE message and returns its command set and data
+// set
+func (a *Association) receive() (command, []byte, error) {
+	var cmdData, dataSet []byte
+	var cmd command
+	for {
+		p, err := readPDU(a.conn)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch p.kind {
+		case pduDataTF:
+		case pduAbort:
+			return nil, nil, ErrAborted
+		case pduReleaseRQ:
+			return nil, nil, errReleased
+		default:
+			return nil, nil, fmt.Errorf("unexpected PDU type 0x%02x", p.kind)
+		}
+
+		pdvs, err := decodePDVs(p.data)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, v := range pdvs {
+			if v.command {
+				cmdData = append(cmdData, v.data...)
+				if !v.last {
+					continue
+				}
+				if cmd, err = decodeCommand(cmdData); err != nil {
+					return nil, nil, err
+				}
+				a.received = v.contextID
+				if t, _ := cmd.us(tagCommandDataSetType); t == noDataSet {
+					return cmd, nil, nil
+				}
+				continue
+			}
+			dataSet = append(dataSet, v.data...)
+			if v.last && cmd != nil {
+				return cmd, dataSet, nil
+			}
+		}
+	}
+}
+
+// fail marks the association broken after a transport error
+func (a *Association) fail(err error) error {
+	var statusErr *StatusError
+	if err != nil && !errors.As(err, &statusErr) {
+		a.broken = true
+		a.conn.Close()
+	}
+	return err
+}
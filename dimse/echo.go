@@ -0,0 +1,53 @@
+package dimse
+
+import "fmt"
+
+// Verification is the SOP class of C-ECHO
+const Verification = "1.2.840.10008.1.1"
+
+// Echo sends a C-ECHO request. A failure status is returned as
+// *StatusError; any other error means the association broke.
+func (a *Association) Echo() (Status, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.broken {
+		return 0, fmt.Errorf("association is closed")
+	}
+	pc, ok := a.accepted(Verification)
+	if !ok {
+		return 0, fmt.Errorf("peer did not accept the Verification SOP class")
+	}
+
+	a.setDeadline()
+	messageID := a.nextMessageID()
+	cmd := command{}
+	cmd.setUI(tagAffectedSOPClassUID, Verification)
+	cmd.setUS(tagCommandField, commandCEchoRQ)
+	cmd.setUS(tagMessageID, messageID)
+	cmd.setUS(tagCommandDataSetType, noDataSet)
+	if err := a.send(pc.ID, cmd, nil); err != nil {
+		return 0, a.fail(err)
+	}
+
+	rsp, _, err := a.receive()
+	if err != nil {
+		return 0, a.fail(err)
+	}
+	if field, _ := rsp.us(tagCommandField); field != commandCEchoRSP {
+		return 0, a.fail(fmt.Errorf("unexpected response command 0x%04x", field))
+	}
+	if id, _ := rsp.us(tagMessageIDRespondedTo); id != messageID {
+		return 0, a.fail(fmt.Errorf("response to message %d instead of %d", id, messageID))
+	}
+	value, ok := rsp.us(tagStatus)
+	if !ok {
+		return 0, a.fail(fmt.Errorf("response without status"))
+	}
+
+	status := Status(value)
+	if !status.Success() {
+		return status, &StatusError{Status: status, Comment: rsp.str(tagErrorComment)}
+	}
+	return status, nil
+}
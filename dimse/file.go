@@ -0,0 +1,108 @@
+package dimse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// File is a DICOM Part 10 file split into the identifiers from its file meta
+// information and the data set that is sent over the network
+type File struct {
+	SOPClassUID       string
+	SOPInstanceUID    string
+	TransferSyntaxUID string
+	DataSet           []byte
+}
+
+// ReadFile reads a DICOM Part 10 file
+func ReadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFile(data)
+}
+
+// ParseFile splits a DICOM Part 10 file into its meta information and data
+// set
+func ParseFile(data []byte) (*File, error) {
+	if len(data) < 132 || !bytes.Equal(data[128:132], []byte("DICM")) {
+		return nil, fmt.Errorf("not a DICOM file")
+	}
+
+	f := &File{}
+	pos := 132
+	// The file meta information is always explicit VR little endian
+	for pos+8 <= len(data) {
+		group := binary.LittleEndian.Uint16(data[pos:])
+		if group != 0x0002 {
+			break
+		}
+		element := binary.LittleEndian.Uint16(data[pos+2:])
+		vr := string(data[pos+4 : pos+6])
+
+		var length, header int
+		switch vr {
+		case "OB", "OW", "OF", "SQ", "UT", "UN", "UC", "UR", "OD", "OL", "OV", "SV", "UV":
+			if pos+12 > len(data) {
+				return nil, fmt.Errorf("truncated file meta information")
+			}
+			length = int(binary.LittleEndian.Uint32(data[pos+8:]))
+			header = 12
+		default:
+			length = int(binary.LittleEndian.Uint16(data[pos+6:]))
+			header = 8
+		}
+		if length < 0 || pos+header+length > len(data) {
+			return nil, fmt.Errorf("file meta element (0002,%04x) exceeds the file", element)
+		}
+
+		value := strings.TrimRight(string(data[pos+header:pos+header+length]), "\x00 ")
+		switch element {
+		case 0x0002:
+			f.SOPClassUID = value
+		case 0x0003:
+			f.SOPInstanceUID = value
+		case 0x0010:
+			f.TransferSyntaxUID = value
+		}
+		pos += header + length
+	}
+
+	if f.SOPClassUID == "" || f.SOPInstanceUID == "" || f.TransferSyntaxUID == "" {
+		return nil, fmt.Errorf("file meta information lacks the SOP class, instance or transfer syntax")
+	}
+	f.DataSet = data[pos:]
+	return f, nil
+}
+
+// Encode returns f as a DICOM Part 10 file with preamble and file meta
+// information
+func (f *File) Encode() []byte {
+	meta := EncodeDataSet([]Element{
+		{Tag: Tag(0x0002, 0x0001), VR: "OB", Value: []byte{0, 1}},
+		String(Tag(0x0002, 0x0002), "UI", f.SOPClassUID),
+		String(Tag(0x0002, 0x0003), "UI", f.SOPInstanceUID),
+		String(Tag(0x0002, 0x0010), "UI", f.TransferSyntaxUID),
+		String(Tag(0x0002, 0x0012), "UI", ImplementationClassUID),
+		String(Tag(0x0002, 0x0013), "SH", ImplementationVersionName),
+	}, true)
+	groupLength := make([]byte, 4)
+	binary.LittleEndian.PutUint32(groupLength, uint32(len(meta)))
+
+	var b bytes.Buffer
+	b.Write(make([]byte, 128))
+	b.WriteString("DICM")
+	b.Write(EncodeDataSet([]Element{{Tag: Tag(0x0002, 0x0000), VR: "UL", Value: groupLength}}, true))
+	b.Write(meta)
+	b.Write(f.DataSet)
+	return b.Bytes()
+}
+
+// WriteFile writes f as a DICOM Part 10 file
+func WriteFile(path string, f *File) error {
+	return os.WriteFile(path, f.Encode(), 0644)
+}
@@ -0,0 +1,97 @@
+package dimse
+
+import "fmt"
+
+// SOP classes of the C-FIND query/retrieve information models
+const (
+	PatientRootFind = "1.2.840.10008.5.1.4.1.2.1.1"
+	StudyRootFind   = "1.2.840.10008.5.1.4.1.2.2.1"
+)
+
+// Find sends a C-FIND request with the identifier and calls match for
+// every matching data set. If match returns false, the request is
+// cancelled and the remaining matches are discarded. A failure status is
+// returned as *StatusError; any other error means the association broke.
+func (a *Association) Find(sopClass string, identifier []Element, match func(DataSet) bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.broken {
+		return fmt.Errorf("association is closed")
+	}
+	pc, ok := a.accepted(sopClass)
+	if !ok {
+		return fmt.Errorf("peer did not accept SOP class %s", sopClass)
+	}
+	explicit := pc.TransferSyntax != ImplicitVRLittleEndian
+
+	a.setDeadline()
+	messageID := a.nextMessageID()
+	cmd := command{}
+	cmd.setUI(tagAffectedSOPClassUID, sopClass)
+	cmd.setUS(tagCommandField, commandCFindRQ)
+	cmd.setUS(tagMessageID, messageID)
+	cmd.setUS(tagPriority, 0)
+	cmd.setUS(tagCommandDataSetType, dataSetPresent)
+	if err := a.send(pc.ID, cmd, EncodeDataSet(identifier, explicit)); err != nil {
+		return a.fail(err)
+	}
+
+	cancelled := false
+	for {
+		// The timeout applies to each response, so long result lists are
+		// not cut off
+		a.setDeadline()
+		rsp, data, err := a.receive()
+		if err != nil {
+			return a.fail(err)
+		}
+		if field, _ := rsp.us(tagCommandField); field != commandCFindRSP {
+			return a.fail(fmt.Errorf("unexpected response command 0x%04x", field))
+		}
+		if id, _ := rsp.us(tagMessageIDRespondedTo); id != messageID {
+			return a.fail(fmt.Errorf("response to message %d instead of %d", id, messageID))
+		}
+		value, ok := rsp.us(tagStatus)
+		if !ok {
+			return a.fail(fmt.Errorf("response without status"))
+		}
+
+		status := Status(value)
+		switch {
+		case status.Pending():
+			if cancelled || data == nil {
+				continue
+			}
+			ds, err := ParseDataSet(data, explicit)
+			if err != nil {
+				return a.fail(fmt.Errorf("invalid C-FIND response: %v", err))
+			}
+			if !match(ds) {
+				cancel := command{}
+				cancel.setUS(tagCommandField, commandCCancelRQ)
+				cancel.setUS(tagMessageIDRespondedTo, messageID)
+				cancel.setUS(tagCommandDataSetType, noDataSet)
+				if err := a.send(pc.ID, cancel, nil); err != nil {
+					return a.fail(err)
+				}
+				cancelled = true
+			}
+		case status.Success(), status.Cancelled():
+			return nil
+		default:
+			return &StatusError{Status: status, Comment: rsp.str(tagErrorComment)}
+		}
+	}
+}
+
+// accepted returns the first accepted presentation context of the abstract
+// syntax
+func (a *Association) accepted(abstractSyntax string) (PresentationContext, bool) {
+	for _, pc := range a.Accepted() {
+		if pc.AbstractSyntax == abstractSyntax {
+			return pc, true
+		}
+	}
+	return PresentationContext{}, false
+}
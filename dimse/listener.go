@@ -0,0 +1,254 @@
+package dimse
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Item types only found in the user information of an A-ASSOCIATE-RQ
+const itemRoleSelection = 0x54
+
+// Results of a presentation context in the A-ASSOCIATE-AC
+const (
+	contextAbstractSyntaxNotSupported = 3
+	contextTransferSyntaxNotSupported = 4
+)
+
+// ListenOptions describe the associations a Listener accepts
+type ListenOptions struct {
+	// Timeout limits each request and the idle time between requests
+	Timeout time.Duration
+	// TLS encrypts the associations; nil listens on plain TCP
+	TLS *tls.Config
+}
+
+// Listener accepts the associations a storage commitment SCP opens to send
+// its N-EVENT-REPORT, and answers C-ECHO on them
+type Listener struct {
+	ln     net.Listener
+	opts   ListenOptions
+	report func(*CommitReport)
+	errorf func(format string, args ...interface{})
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+	wg    sync.WaitGroup
+}
+
+// Listen accepts associations on addr. report is called with every
+// commitment report received; errorf logs failed associations.
+func Listen(addr string, opts ListenOptions, report func(*CommitReport), errorf func(format string, args ...interface{})) (*Listener, error) {
+	var ln net.Listener
+	var err error
+	if opts.TLS != nil {
+		ln, err = tls.Listen("tcp", addr, opts.TLS)
+	} else {
+		ln, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	l := &Listener{ln: ln, opts: opts, report: report, errorf: errorf, conns: make(map[net.Conn]bool)}
+	l.wg.Add(1)
+	go l.accept()
+	return l, nil
+}
+
+// Addr returns the address the listener accepts associations on
+func (l *Listener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+// Close stops accepting associations, closes the open ones and waits for
+// their handlers
+func (l *Listener) Close() error {
+	err := l.ln.Close()
+	l.mu.Lock()
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+	l.wg.Wait()
+	return err
+}
+
+func (l *Listener) accept() {
+	defer l.wg.Done()
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				l.errorf("accepting association failed: %v", err)
+			}
+			return
+		}
+		l.mu.Lock()
+		l.conns[conn] = true
+		l.mu.Unlock()
+
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			defer func() {
+				l.mu.Lock()
+				delete(l.conns, conn)
+				l.mu.Unlock()
+				conn.Close()
+			}()
+			if err := l.serve(conn); err != nil {
+				l.errorf("association from %s failed: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// serve negotiates an association and answers its requests until the peer
+// releases it
+func (l *Listener) serve(conn net.Conn) error {
+	a := &Association{conn: conn, timeout: l.opts.Timeout}
+	a.setDeadline()
+	p, err := readPDU(conn)
+	if err != nil {
+		return err
+	}
+	if p.kind != pduAssociateRQ {
+		writePDU(conn, pduAbort, make([]byte, 4))
+		return fmt.Errorf("unexpected PDU type 0x%02x instead of A-ASSOCIATE-RQ", p.kind)
+	}
+	ac, err := l.acceptAssociation(a, p.data)
+	if err != nil {
+		return err
+	}
+	if err := writePDU(conn, pduAssociateAC, ac); err != nil {
+		return err
+	}
+
+	for {
+		a.setDeadline()
+		cmd, data, err := a.receive()
+		if errors.Is(err, errReleased) {
+			return writePDU(conn, pduReleaseRP, make([]byte, 4))
+		}
+		if err != nil {
+			return err
+		}
+
+		switch field, _ := cmd.us(tagCommandField); field {
+		case commandNEventReportRQ:
+			report, err := a.answerEventReport(cmd, data)
+			if err != nil {
+				writePDU(conn, pduAbort, make([]byte, 4))
+				return err
+			}
+			l.report(report)
+		case commandCEchoRQ:
+			messageID, _ := cmd.us(tagMessageID)
+			rsp := command{}
+			rsp.setUI(tagAffectedSOPClassUID, Verification)
+			rsp.setUS(tagCommandField, commandCEchoRSP)
+			rsp.setUS(tagMessageIDRespondedTo, messageID)
+			rsp.setUS(tagCommandDataSetType, noDataSet)
+			rsp.setUS(tagStatus, 0)
+			if err := a.send(a.received, rsp, nil); err != nil {
+				return err
+			}
+		default:
+			writePDU(conn, pduAbort, make([]byte, 4))
+			return fmt.Errorf("unsupported command 0x%04x", field)
+		}
+	}
+}
+
+// acceptAssociation decodes an A-ASSOCIATE-RQ into the contexts of a and
+// returns the A-ASSOCIATE-AC body. Any called AE title is accepted, as the
+// station stores under several calling AE titles.
+func (l *Listener) acceptAssociation(a *Association, data []byte) ([]byte, error) {
+	if len(data) < 68 {
+		return nil, fmt.Errorf("truncated A-ASSOCIATE-RQ")
+	}
+	items, err := readItems(data[68:])
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.Write(data[:68])
+	writeItem(&b, itemApplicationContext, []byte(applicationContextUID))
+
+	var roles [][]byte
+	for _, it := range items {
+		switch it.kind {
+		case itemPresentationRQ:
+			if len(it.data) < 4 {
+				return nil, fmt.Errorf("truncated presentation context item")
+			}
+			subs, err := readItems(it.data[4:])
+			if err != nil {
+				return nil, err
+			}
+			pc := PresentationContext{ID: it.data[0], Result: contextAbstractSyntaxNotSupported}
+			for _, s := range subs {
+				switch s.kind {
+				case itemAbstractSyntax:
+					pc.AbstractSyntax = trimUID(s.data)
+				case itemTransferSyntax:
+					pc.proposed = append(pc.proposed, trimUID(s.data))
+				}
+			}
+			if pc.AbstractSyntax == StorageCommitment || pc.AbstractSyntax == Verification {
+				pc.Result = contextTransferSyntaxNotSupported
+				for _, ts := range pc.proposed {
+					if ts == ExplicitVRLittleEndian || ts == ImplicitVRLittleEndian {
+						pc.Result = contextAccepted
+						pc.TransferSyntax = ts
+						break
+					}
+				}
+			}
+			a.contexts = append(a.contexts, pc)
+
+			var sub bytes.Buffer
+			sub.Write([]byte{pc.ID, 0, pc.Result, 0})
+			ts := pc.TransferSyntax
+			if ts == "" {
+				ts = ImplicitVRLittleEndian
+			}
+			writeItem(&sub, itemTransferSyntax, []byte(ts))
+			writeItem(&b, itemPresentationAC, sub.Bytes())
+		case itemUserInformation:
+			subs, err := readItems(it.data)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range subs {
+				switch {
+				case s.kind == itemMaxLength && len(s.data) == 4:
+					a.maxPDU = binary.BigEndian.Uint32(s.data)
+				case s.kind == itemRoleSelection:
+					// The SCP sends the report in the SCP role of the
+					// storage commitment SOP class; the proposed roles
+					// are accepted as they are
+					roles = append(roles, s.data)
+				}
+			}
+		}
+	}
+
+	var user bytes.Buffer
+	maxLength := make([]byte, 4)
+	binary.BigEndian.PutUint32(maxLength, maxReceivePDU)
+	writeItem(&user, itemMaxLength, maxLength)
+	writeItem(&user, itemImplementationUID, []byte(ImplementationClassUID))
+	for _, role := range roles {
+		writeItem(&user, itemRoleSelection, role)
+	}
+	writeItem(&user, itemImplementationName, []byte(ImplementationVersionName))
+	writeItem(&b, itemUserInformation, user.Bytes())
+	return b.Bytes(), nil
+}
@@ -0,0 +1,72 @@
+package dimse
+
+import "fmt"
+
+// ModalityPerformedProcedureStep is the SOP class of MPPS (PS3.4 annex F)
+const ModalityPerformedProcedureStep = "1.2.840.10008.3.1.2.3.3"
+
+// Create sends an N-CREATE request for a new SOP instance with the
+// attributes. A failure status is returned as *StatusError; any other
+// error means the association broke.
+func (a *Association) Create(sopClass, sopInstance string, attributes []Element) (Status, error) {
+	cmd := command{}
+	cmd.setUI(tagAffectedSOPClassUID, sopClass)
+	cmd.setUS(tagCommandField, commandNCreateRQ)
+	cmd.setUI(tagAffectedSOPInstanceUID, sopInstance)
+	return a.normalized(sopClass, cmd, commandNCreateRSP, attributes)
+}
+
+// Set sends an N-SET request modifying the attributes of a SOP instance. A
+// failure status is returned as *StatusError; any other error means the
+// association broke.
+func (a *Association) Set(sopClass, sopInstance string, modifications []Element) (Status, error) {
+	cmd := command{}
+	cmd.setUI(tagRequestedSOPClassUID, sopClass)
+	cmd.setUS(tagCommandField, commandNSetRQ)
+	cmd.setUI(tagRequestedSOPInstanceUID, sopInstance)
+	return a.normalized(sopClass, cmd, commandNSetRSP, modifications)
+}
+
+// normalized sends a DIMSE-N request with a data set and reads its response
+func (a *Association) normalized(sopClass string, cmd command, responseField uint16, elements []Element) (Status, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.broken {
+		return 0, fmt.Errorf("association is closed")
+	}
+	pc, ok := a.accepted(sopClass)
+	if !ok {
+		return 0, fmt.Errorf("peer did not accept SOP class %s", sopClass)
+	}
+	explicit := pc.TransferSyntax != ImplicitVRLittleEndian
+
+	a.setDeadline()
+	messageID := a.nextMessageID()
+	cmd.setUS(tagMessageID, messageID)
+	cmd.setUS(tagCommandDataSetType, dataSetPresent)
+	if err := a.send(pc.ID, cmd, EncodeDataSet(elements, explicit)); err != nil {
+		return 0, a.fail(err)
+	}
+
+	rsp, _, err := a.receive()
+	if err != nil {
+		return 0, a.fail(err)
+	}
+	if field, _ := rsp.us(tagCommandField); field != responseField {
+		return 0, a.fail(fmt.Errorf("unexpected response command 0x%04x", field))
+	}
+	if id, _ := rsp.us(tagMessageIDRespondedTo); id != messageID {
+		return 0, a.fail(fmt.Errorf("response to message %d instead of %d", id, messageID))
+	}
+	value, ok := rsp.us(tagStatus)
+	if !ok {
+		return 0, a.fail(fmt.Errorf("response without status"))
+	}
+
+	status := Status(value)
+	if !status.Success() {
+		return status, &StatusError{Status: status, Comment: rsp.str(tagErrorComment)}
+	}
+	return status, nil
+}
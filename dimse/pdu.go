@@ -0,0 +1,233 @@
+package dimse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PDU types of the DICOM upper layer protocol (PS3.8 section 9.3)
+const (
+	pduAssociateRQ = 0x01
+	pduAssociateAC = 0x02
+	pduAssociateRJ = 0x03
+	pduDataTF      = 0x04
+	pduReleaseRQ   = 0x05
+	pduReleaseRP   = 0x06
+	pduAbort       = 0x07
+)
+
+// Item types of the A-ASSOCIATE PDUs
+const (
+	itemApplicationContext = 0x10
+	itemPresentationRQ     = 0x20
+	itemPresentationAC     = 0x21
+	itemAbstractSyntax     = 0x30
+	itemTransferSyntax     = 0x40
+	itemUserInformation    = 0x50
+	itemMaxLength          = 0x51
+	itemImplementationUID  = 0x52
+	itemImplementationName = 0x55
+)
+
+// pdu is one protocol data unit as read from the connection
+type pdu struct {
+	kind byte
+	data []byte
+}
+
+// maxIncomingPDU limits PDUs read from the peer regardless of the announced
+// maximum, so a broken peer cannot make the station allocate gigabytes
+const maxIncomingPDU = 64 << 20
+
+func readPDU(r io.Reader) (pdu, error) {
+	var header [6]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return pdu{}, err
+	}
+	length := binary.BigEndian.Uint32(header[2:])
+	if length > maxIncomingPDU {
+		return pdu{}, fmt.Errorf("PDU of %d bytes exceeds the limit", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return pdu{}, err
+	}
+	return pdu{kind: header[0], data: data}, nil
+}
+
+func writePDU(w io.Writer, kind byte, data []byte) error {
+	buf := make([]byte, 6+len(data))
+	buf[0] = kind
+	binary.BigEndian.PutUint32(buf[2:], uint32(len(data)))
+	copy(buf[6:], data)
+	_, err := w.Write(buf)
+	return err
+}
+
+// writeItem appends an A-ASSOCIATE item or sub-item
+func writeItem(b *bytes.Buffer, kind byte, data []byte) {
+	b.WriteByte(kind)
+	b.WriteByte(0)
+	binary.Write(b, binary.BigEndian, uint16(len(data)))
+	b.Write(data)
+}
+
+// item is one variable item of an A-ASSOCIATE PDU
+type item struct {
+	kind byte
+	data []byte
+}
+
+func readItems(data []byte) ([]item, error) {
+	var items []item
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("truncated item")
+		}
+		length := int(binary.BigEndian.Uint16(data[2:]))
+		if len(data) < 4+length {
+			return nil, fmt.Errorf("item 0x%02x exceeds the PDU", data[0])
+		}
+		items = append(items, item{kind: data[0], data: data[4 : 4+length]})
+		data = data[4+length:]
+	}
+	return items, nil
+}
+
+// aeField returns an AE title as the 16 byte, space padded PDU field
+func aeField(ae string) []byte {
+	field := []byte(fmt.Sprintf("%-16s", ae))
+	return field[:16]
+}
+
+// trimUID removes the padding some implementations add to UIDs
+func trimUID(b []byte) string {
+	return strings.TrimRight(string(b), "\x00 ")
+}
+
+// encodeAssociateRQ builds the A-ASSOCIATE-RQ PDU body
+func encodeAssociateRQ(opts Options, contexts []PresentationContext) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint16(1)) // protocol version
+	b.Write([]byte{0, 0})
+	b.Write(aeField(opts.CalledAETitle))
+	b.Write(aeField(opts.CallingAETitle))
+	b.Write(make([]byte, 32))
+
+	writeItem(&b, itemApplicationContext, []byte(applicationContextUID))
+
+	for _, pc := range contexts {
+		var sub bytes.Buffer
+		sub.Write([]byte{pc.ID, 0, 0, 0})
+		writeItem(&sub, itemAbstractSyntax, []byte(pc.AbstractSyntax))
+		for _, ts := range pc.proposed {
+			writeItem(&sub, itemTransferSyntax, []byte(ts))
+		}
+		writeItem(&b, itemPresentationRQ, sub.Bytes())
+	}
+
+	var user bytes.Buffer
+	maxLength := make([]byte, 4)
+	binary.BigEndian.PutUint32(maxLength, maxReceivePDU)
+	writeItem(&user, itemMaxLength, maxLength)
+	writeItem(&user, itemImplementationUID, []byte(ImplementationClassUID))
+	writeItem(&user, itemImplementationName, []byte(ImplementationVersionName))
+	writeItem(&b, itemUserInformation, user.Bytes())
+
+	return b.Bytes()
+}
+
+// decodeAssociateAC reads the accepted presentation contexts and the
+// maximum PDU length of the peer into the proposed contexts
+func decodeAssociateAC(data []byte, contexts []PresentationContext) (maxPDU uint32, err error) {
+	if len(data) < 68 {
+		return 0, fmt.Errorf("truncated A-ASSOCIATE-AC")
+	}
+	items, err := readItems(data[68:])
+	if err != nil {
+		return 0, err
+	}
+
+	for _, it := range items {
+		switch it.kind {
+		case itemPresentationAC:
+			if len(it.data) < 4 {
+				return 0, fmt.Errorf("truncated presentation context item")
+			}
+			id, result := it.data[0], it.data[2]
+			subs, err := readItems(it.data[4:])
+			if err != nil {
+				return 0, err
+			}
+			for i := range contexts {
+				if contexts[i].ID != id {
+					continue
+				}
+				contexts[i].Result = result
+				for _, s := range subs {
+					if s.kind == itemTransferSyntax {
+						contexts[i].TransferSyntax = trimUID(s.data)
+					}
+				}
+			}
+		case itemUserInformation:
+			subs, err := readItems(it.data)
+			if err != nil {
+				return 0, err
+			}
+			for _, s := range subs {
+				if s.kind == itemMaxLength && len(s.data) == 4 {
+					maxPDU = binary.BigEndian.Uint32(s.data)
+				}
+			}
+		}
+	}
+	return maxPDU, nil
+}
+
+// pdv is one presentation data value of a P-DATA-TF PDU
+type pdv struct {
+	contextID byte
+	command   bool
+	last      bool
+	data      []byte
+}
+
+func decodePDVs(data []byte) ([]pdv, error) {
+	var pdvs []pdv
+	for len(data) > 0 {
+		if len(data) < 6 {
+			return nil, fmt.Errorf("truncated PDV")
+		}
+		length := int(binary.BigEndian.Uint32(data))
+		if length < 2 || len(data) < 4+length {
+			return nil, fmt.Errorf("invalid PDV length %d", length)
+		}
+		header := data[5]
+		pdvs = append(pdvs, pdv{
+			contextID: data[4],
+			command:   header&0x01 != 0,
+			last:      header&0x02 != 0,
+			data:      data[6 : 4+length],
+		})
+		data = data[4+length:]
+	}
+	return pdvs, nil
+}
+
+func encodePDV(contextID byte, command bool, last bool, data []byte) []byte {
+	buf := make([]byte, 6+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(2+len(data)))
+	buf[4] = contextID
+	if command {
+		buf[5] |= 0x01
+	}
+	if last {
+		buf[5] |= 0x02
+	}
+	copy(buf[6:], data)
+	return buf
+}
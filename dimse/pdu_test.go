@@ -0,0 +1,110 @@
+package dimse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestEncodePDV(t *testing.T) {
+	tests := []struct {
+		name      string
+		contextID byte
+		command   bool
+		last      bool
+		data      []byte
+		want      []byte
+	}{
+		{"last command fragment", 1, true, true, []byte{0xAA, 0xBB}, []byte{0, 0, 0, 4, 1, 0x03, 0xAA, 0xBB}},
+		{"data fragment", 3, false, false, []byte{1, 2, 3, 4}, []byte{0, 0, 0, 6, 3, 0x00, 1, 2, 3, 4}},
+		{"last data fragment without data", 5, false, true, nil, []byte{0, 0, 0, 2, 5, 0x02}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := encodePDV(tt.contextID, tt.command, tt.last, tt.data)
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("encodePDV = % x, want % x", got, tt.want)
+			}
+			pdvs, err := decodePDVs(got)
+			if err != nil {
+				t.Fatalf("decodePDVs: %v", err)
+			}
+			if len(pdvs) != 1 {
+				t.Fatalf("decodePDVs returned %d PDVs, want 1", len(pdvs))
+			}
+			p := pdvs[0]
+			if p.contextID != tt.contextID || p.command != tt.command || p.last != tt.last || !bytes.Equal(p.data, tt.data) {
+				t.Errorf("decodePDVs = %+v, want context %d, command %v, last %v, data % x", p, tt.contextID, tt.command, tt.last, tt.data)
+			}
+		})
+	}
+}
+
+func TestDecodePDVs(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    int
+		wantErr string
+	}{
+		{"empty", nil, 0, ""},
+		{"two PDVs", append(encodePDV(1, true, true, []byte{1, 2}), encodePDV(1, false, true, []byte{3})...), 2, ""},
+		{"truncated header", []byte{0, 0, 0, 2, 1}, 0, "truncated PDV"},
+		{"length too short", []byte{0, 0, 0, 1, 1, 0}, 0, "invalid PDV length 1"},
+		{"length beyond data", []byte{0, 0, 0, 8, 1, 0, 1, 2}, 0, "invalid PDV length 8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pdvs, err := decodePDVs(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("decodePDVs error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodePDVs: %v", err)
+			}
+			if len(pdvs) != tt.want {
+				t.Errorf("decodePDVs returned %d PDVs, want %d", len(pdvs), tt.want)
+			}
+		})
+	}
+}
+
+func TestWritePDU(t *testing.T) {
+	var b bytes.Buffer
+	if err := writePDU(&b, pduDataTF, []byte{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{pduDataTF, 0, 0, 0, 0, 2, 1, 2}
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Fatalf("writePDU = % x, want % x", b.Bytes(), want)
+	}
+
+	p, err := readPDU(&b)
+	if err != nil {
+		t.Fatalf("readPDU: %v", err)
+	}
+	if p.kind != pduDataTF || !bytes.Equal(p.data, []byte{1, 2}) {
+		t.Errorf("readPDU = %+v, want kind %d with data 01 02", p, pduDataTF)
+	}
+}
+
+func TestReadPDURejectsOversizedPDU(t *testing.T) {
+	header := make([]byte, 6)
+	header[0] = pduDataTF
+	binary.BigEndian.PutUint32(header[2:], maxIncomingPDU+1)
+	if _, err := readPDU(bytes.NewReader(header)); err == nil {
+		t.Fatal("readPDU accepted a PDU above the limit")
+	}
+}
+
+func TestWriteItem(t *testing.T) {
+	var b bytes.Buffer
+	writeItem(&b, itemMaxLength, []byte{0, 0, 0x40, 0})
+	want := []byte{itemMaxLength, 0, 0, 4, 0, 0, 0x40, 0}
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Fatalf("writeItem = % x, want % x", b.Bytes(), want)
+	}
+}
@@ -0,0 +1,52 @@
+package dimse
+
+import "fmt"
+
+// Store sends the data set of f with a C-STORE request. A failure status is
+// returned as *StatusError; any other error means the association broke.
+func (a *Association) Store(f *File) (Status, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.broken {
+		return 0, fmt.Errorf("association is closed")
+	}
+	contextID, ok := a.context(f.SOPClassUID, f.TransferSyntaxUID)
+	if !ok {
+		return 0, fmt.Errorf("peer did not accept SOP class %s in transfer syntax %s", f.SOPClassUID, f.TransferSyntaxUID)
+	}
+
+	a.setDeadline()
+	messageID := a.nextMessageID()
+	cmd := command{}
+	cmd.setUI(tagAffectedSOPClassUID, f.SOPClassUID)
+	cmd.setUS(tagCommandField, commandCStoreRQ)
+	cmd.setUS(tagMessageID, messageID)
+	cmd.setUS(tagPriority, 0)
+	cmd.setUS(tagCommandDataSetType, dataSetPresent)
+	cmd.setUI(tagAffectedSOPInstanceUID, f.SOPInstanceUID)
+	if err := a.send(contextID, cmd, f.DataSet); err != nil {
+		return 0, a.fail(err)
+	}
+
+	rsp, _, err := a.receive()
+	if err != nil {
+		return 0, a.fail(err)
+	}
+	if field, _ := rsp.us(tagCommandField); field != commandCStoreRSP {
+		return 0, a.fail(fmt.Errorf("unexpected response command 0x%04x", field))
+	}
+	if id, _ := rsp.us(tagMessageIDRespondedTo); id != messageID {
+		return 0, a.fail(fmt.Errorf("response to message %d instead of %d", id, messageID))
+	}
+	value, ok := rsp.us(tagStatus)
+	if !ok {
+		return 0, a.fail(fmt.Errorf("response without status"))
+	}
+
+	status := Status(value)
+	if !status.Success() {
+		return status, &StatusError{Status: status, Comment: rsp.str(tagErrorComment)}
+	}
+	return status, nil
+}
@@ -0,0 +1,102 @@
+// Package events passes progress of scans and sends to the clients
+// following them live, e.g. over the WebSocket of the web interface.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	ScanStarted  = "scan.started"
+	ScanPage     = "scan.page"
+	ScanFinished = "scan.finished"
+	ScanButton   = "scan.button"
+	SendStarted  = "send.started"
+	SendFile     = "send.file"
+	SendFinished = "send.finished"
+)
+
+// subscriberBuffer is the number of events a slow subscriber may lag
+// behind before events are dropped for it
+const subscriberBuffer = 64
+
+// Event is one progress notification
+type Event struct {
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// Hub fans events out to all subscribers. Publishing never blocks: a
+// subscriber that does not keep up misses events.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[chan Event]struct{})}
+}
+
+// Publish sends an event to every subscriber; a nil hub discards it
+func (h *Hub) Publish(eventType string, data interface{}) {
+	if h == nil {
+		return
+	}
+	event := Event{Type: eventType, Time: time.Now(), Data: data}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the events published from now on
+// and a function that ends the subscription
+func (h *Hub) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers, ch)
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// ScanProgress is the data of scan events
+type ScanProgress struct {
+	// JobID is the scan to cancel with POST /api/scan/:jobId/cancel; pages
+	// are only reported by device
+	JobID  string `json:"jobId,omitempty"`
+	Device string `json:"device"`
+	// Page and Filename name the page a scan.page event reports
+	Page     int    `json:"page,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	// Pages and Error are set when the scan finished, ErrorCode for
+	// failures the operator can fix at the scanner like a paper jam
+	Pages     int    `json:"pages,omitempty"`
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"errorCode,omitempty"`
+}
+
+// ScanButtonPress is the data of scan.button events: the button of a
+// scanner was pressed, and the web interface that has it selected starts
+// a scan with its current options
+type ScanButtonPress struct {
+	Device string `json:"device"`
+	// Action is the button scanbd reports, e.g. "scan" or "email"
+	Action string `json:"action,omitempty"`
+}
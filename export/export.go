@@ -0,0 +1,126 @@
+// Package export renders archived studies as PDF/A documents for long-term
+// storage outside the PACS.
+package export
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"DICOMScanStation/archive"
+	"DICOMScanStation/config"
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/logging"
+	"DICOMScanStation/pdfa"
+
+	"github.com/sirupsen/logrus"
+)
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Exporter converts studies from the local archive
+type Exporter struct {
+	config  *config.Config
+	archive *archive.Store
+	logger  *logrus.Logger
+}
+
+func NewExporter(cfg *config.Config, store *archive.Store) *Exporter {
+	return &Exporter{
+		config:  cfg,
+		archive: store,
+		logger:  logging.New(),
+	}
+}
+
+// PDF renders all instances of an archived study as one PDF/A-2b document
+func (e *Exporter) PDF(studyInstanceUID string) ([]byte, *archive.Study, error) {
+	study, err := e.archive.Get(studyInstanceUID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pages [][]byte
+	for _, instance := range study.Instances {
+		data, err := e.archive.ReadInstance(studyInstanceUID, instance.Filename)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %v", instance.Filename, err)
+		}
+		frames, err := dicom.ExtractJPEGFrames(data)
+		if errors.Is(err, dicom.ErrNotEncapsulated) && len(study.Instances) == 1 {
+			// A study sent as Encapsulated PDF already is the document
+			if doc, pdfErr := dicom.ExtractPDFData(data); pdfErr == nil {
+				return doc, study, nil
+			}
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %v", instance.Filename, err)
+		}
+		pages = append(pages, frames...)
+	}
+
+	doc := pdfa.Document{
+		Title:            study.Description,
+		Author:           study.DocumentCreator,
+		Subject:          study.DocumentType,
+		PatientID:        study.PatientID,
+		PatientName:      study.PatientName,
+		StudyInstanceUID: study.StudyInstanceUID,
+		Created:          study.ArchivedAt,
+		Producer:         fmt.Sprintf("%s %s", e.config.AppName, e.config.AppVersion),
+	}
+
+	var buf bytes.Buffer
+	if err := pdfa.Write(&buf, doc, pages); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), study, nil
+}
+
+// ToShare writes the PDF/A document of a study to EXPORT_DIR, usually a
+// mounted file share, and returns its path
+func (e *Exporter) ToShare(studyInstanceUID string) (string, error) {
+	if e.config.ExportDir == "" {
+		return "", fmt.Errorf("EXPORT_DIR is not configured")
+	}
+
+	data, study, err := e.PDF(studyInstanceUID)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(e.config.ExportDir, sanitize(study.PatientID))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create export directory: %v", err)
+	}
+
+	name := fmt.Sprintf("%s_%s_%s.pdf", study.ArchivedAt.Format("20060102"), sanitize(study.Description), study.StudyInstanceUID)
+	path := filepath.Join(dir, name)
+
+	// Write under a temporary name so that other systems polling the share
+	// never pick up a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to write export: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to write export: %v", err)
+	}
+
+	e.logger.WithField(logging.FieldPatientID, study.PatientID).Infof("Export: Wrote study %s to %s", study.StudyInstanceUID, path)
+	return path, nil
+}
+
+func sanitize(s string) string {
+	s = strings.Trim(unsafeChars.ReplaceAllString(s, "_"), "_.")
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
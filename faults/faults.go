@@ -0,0 +1,231 @@
+// Package faults injects latency and failures into the station's services
+// so retry handling and error reporting can be exercised in demo mode
+// without breaking a real PACS or scanner.
+package faults
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"syscall"
+	"time"
+
+	"DICOMScanStation/config"
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/logging"
+	"DICOMScanStation/scanner"
+	"DICOMScanStation/storage"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Settings control which faults are injected; they can be changed at runtime
+type Settings struct {
+	// StoreFailurePercent is the chance that a single instance fails C-STORE
+	StoreFailurePercent int `json:"storeFailurePercent"`
+	// DicomLatency delays every PACS query and upload, in milliseconds
+	DicomLatency int `json:"dicomLatency"`
+	// ScanDelay delays every scan, in milliseconds
+	ScanDelay int `json:"scanDelay"`
+	// DiskFull makes scans and file uploads fail with ENOSPC
+	DiskFull bool `json:"diskFull"`
+}
+
+// Injector holds the current fault settings shared by all wrappers
+type Injector struct {
+	mu       sync.Mutex
+	settings Settings
+	rand     *rand.Rand
+	logger   *logrus.Logger
+}
+
+func NewInjector(cfg *config.Config) *Injector {
+	return &Injector{
+		settings: Settings{
+			StoreFailurePercent: cfg.FaultStoreFailurePercent,
+			DicomLatency:        cfg.FaultDicomLatency,
+			ScanDelay:           cfg.FaultScanDelay,
+			DiskFull:            cfg.FaultDiskFull,
+		},
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		logger: logging.New(),
+	}
+}
+
+func (i *Injector) Settings() Settings {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.settings
+}
+
+func (i *Injector) SetSettings(s Settings) error {
+	if s.StoreFailurePercent < 0 || s.StoreFailurePercent > 100 {
+		return fmt.Errorf("storeFailurePercent must be between 0 and 100")
+	}
+	if s.DicomLatency < 0 || s.ScanDelay < 0 {
+		return fmt.Errorf("delays must not be negative")
+	}
+
+	i.mu.Lock()
+	i.settings = s
+	i.mu.Unlock()
+
+	i.logger.Warnf("Fault injection settings changed: %+v", s)
+	return nil
+}
+
+// Scanner, FileStore and DicomGateway mirror the service interfaces of the
+// web package, which cannot be imported here because the router exposes the
+// injector settings
+type Scanner interface {
+	GetScanners() []*scanner.ScannerInfo
+	GetScannerCapabilities(device string) (*scanner.Capabilities, error)
+	ScanDocument(device string, options *scanner.ScanOptions) ([]string, error)
+}
+
+type FileStore interface {
+	List() ([]storage.FileInfo, error)
+	Path(name string) (string, error)
+	Save(name string, r io.Reader) error
+	Delete(name string) error
+	IsAllowedExtension(ext string) bool
+}
+
+type DicomGateway interface {
+	SearchPatients(searchTerm string, searchType string) ([]dicom.PatientInfo, error)
+	PatientStudies(patientID string) ([]dicom.StudyInfo, error)
+	StudySeries(patientID string, studyInstanceUID string) ([]dicom.SeriesInfo, error)
+	SendToPacs(req dicom.SendRequest) ([]dicom.FileProgress, error)
+	ListQuarantine() []dicom.Quarantine
+	ResolveQuarantinedPage(id string, filename string, decision string) (*dicom.Quarantine, error)
+	ReleaseQuarantine(id string) ([]dicom.FileProgress, error)
+	DiscardQuarantine(id string) error
+	ResendArchived(studyInstanceUID string) ([]dicom.FileProgress, error)
+	Echo() []dicom.EchoResult
+	TagTemplates() map[string]map[string]string
+}
+
+// WrapScanner delays scans and fails them while the disk is "full"
+func (i *Injector) WrapScanner(s Scanner) Scanner {
+	return &scannerService{Scanner: s, injector: i}
+}
+
+// WrapFileStore fails uploads while the disk is "full"
+func (i *Injector) WrapFileStore(f FileStore) FileStore {
+	return &fileStore{FileStore: f, injector: i}
+}
+
+// WrapDicom adds latency and random C-STORE failures
+func (i *Injector) WrapDicom(d DicomGateway) DicomGateway {
+	return &dicomGateway{DicomGateway: d, injector: i}
+}
+
+func (i *Injector) sleep(ms int) {
+	if ms > 0 {
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+	}
+}
+
+func (i *Injector) chance(percent int) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return percent > 0 && i.rand.Intn(100) < percent
+}
+
+func diskFullError(op string) error {
+	return fmt.Errorf("injected fault: %s: %w", op, syscall.ENOSPC)
+}
+
+type scannerService struct {
+	Scanner
+	injector *Injector
+}
+
+func (s *scannerService) ScanDocument(device string, options *scanner.ScanOptions) ([]string, error) {
+	settings := s.injector.Settings()
+	s.injector.sleep(settings.ScanDelay)
+	if settings.DiskFull {
+		return nil, diskFullError("write scanned page")
+	}
+	return s.Scanner.ScanDocument(device, options)
+}
+
+type fileStore struct {
+	FileStore
+	injector *Injector
+}
+
+func (f *fileStore) Save(name string, r io.Reader) error {
+	if f.injector.Settings().DiskFull {
+		return diskFullError("save " + name)
+	}
+	return f.FileStore.Save(name, r)
+}
+
+type dicomGateway struct {
+	DicomGateway
+	injector *Injector
+}
+
+func (d *dicomGateway) SearchPatients(searchTerm string, searchType string) ([]dicom.PatientInfo, error) {
+	d.injector.sleep(d.injector.Settings().DicomLatency)
+	return d.DicomGateway.SearchPatients(searchTerm, searchType)
+}
+
+func (d *dicomGateway) PatientStudies(patientID string) ([]dicom.StudyInfo, error) {
+	d.injector.sleep(d.injector.Settings().DicomLatency)
+	return d.DicomGateway.PatientStudies(patientID)
+}
+
+func (d *dicomGateway) StudySeries(patientID string, studyInstanceUID string) ([]dicom.SeriesInfo, error) {
+	d.injector.sleep(d.injector.Settings().DicomLatency)
+	return d.DicomGateway.StudySeries(patientID, studyInstanceUID)
+}
+
+func (d *dicomGateway) SendToPacs(req dicom.SendRequest) ([]dicom.FileProgress, error) {
+	settings := d.injector.Settings()
+	d.injector.sleep(settings.DicomLatency)
+
+	progress, err := d.DicomGateway.SendToPacs(req)
+	if err != nil {
+		return progress, err
+	}
+	return d.failInstances(progress, settings.StoreFailurePercent), nil
+}
+
+func (d *dicomGateway) ReleaseQuarantine(id string) ([]dicom.FileProgress, error) {
+	settings := d.injector.Settings()
+	d.injector.sleep(settings.DicomLatency)
+
+	progress, err := d.DicomGateway.ReleaseQuarantine(id)
+	if err != nil {
+		return progress, err
+	}
+	return d.failInstances(progress, settings.StoreFailurePercent), nil
+}
+
+func (d *dicomGateway) ResendArchived(studyInstanceUID string) ([]dicom.FileProgress, error) {
+	settings := d.injector.Settings()
+	d.injector.sleep(settings.DicomLatency)
+
+	progress, err := d.DicomGateway.ResendArchived(studyInstanceUID)
+	if err != nil {
+		return progress, err
+	}
+	return d.failInstances(progress, settings.StoreFailurePercent), nil
+}
+
+// failInstances turns random completed instances into C-STORE failures
+func (d *dicomGateway) failInstances(progress []dicom.FileProgress, percent int) []dicom.FileProgress {
+	for i := range progress {
+		if progress[i].Status != "completed" || !d.injector.chance(percent) {
+			continue
+		}
+		progress[i].Status = "failed"
+		progress[i].Message = "Upload failed: injected fault: C-STORE rejected by peer"
+		progress[i].Progress = 0
+		d.injector.logger.Infof("Fault injection: failed C-STORE of %s", progress[i].Filename)
+	}
+	return progress
+}
@@ -0,0 +1,86 @@
+package handoff
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("handoff token is invalid or expired")
+
+// DefaultWorkspace is the shared scan workspace of the station
+const DefaultWorkspace = "default"
+
+// Token binds a mobile device to a workspace for a limited time
+type Token struct {
+	Token     string    `json:"token"`
+	Workspace string    `json:"workspace"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Store keeps the issued handoff tokens in memory
+type Store struct {
+	ttl    time.Duration
+	mu     sync.Mutex
+	tokens map[string]Token
+}
+
+func NewStore(ttl time.Duration) *Store {
+	return &Store{
+		ttl:    ttl,
+		tokens: make(map[string]Token),
+	}
+}
+
+// Issue creates a new short-lived token for the given workspace
+func (s *Store) Issue(workspace string, createdBy string) (Token, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return Token{}, err
+	}
+
+	t := Token{
+		Token:     hex.EncodeToString(b),
+		Workspace: workspace,
+		CreatedBy: createdBy,
+		ExpiresAt: time.Now().Add(s.ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purgeExpired()
+	s.tokens[t.Token] = t
+	return t, nil
+}
+
+// Validate returns the token if it exists and has not expired
+func (s *Store) Validate(token string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[token]
+	if !ok || time.Now().After(t.ExpiresAt) {
+		delete(s.tokens, token)
+		return Token{}, ErrInvalidToken
+	}
+	return t, nil
+}
+
+// Revoke invalidates a token before it expires
+func (s *Store) Revoke(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, token)
+}
+
+func (s *Store) purgeExpired() {
+	now := time.Now()
+	for key, t := range s.tokens {
+		if now.After(t.ExpiresAt) {
+			delete(s.tokens, key)
+		}
+	}
+}
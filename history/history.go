@@ -0,0 +1,179 @@
+// Package history keeps an append-only log of every upload attempt for
+// reporting.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"DICOMScanStation/config"
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/logging"
+
+	"github.com/sirupsen/logrus"
+)
+
+const historyFile = "history.jsonl"
+
+// Upload outcomes
+const (
+	StatusCompleted   = "completed"
+	StatusPartial     = "partial"
+	StatusFailed      = "failed"
+	StatusQuarantined = "quarantined"
+)
+
+// Entry is one upload attempt
+type Entry struct {
+	Time             time.Time `json:"time"`
+	Operator         string    `json:"operator"`
+	StudyInstanceUID string    `json:"studyInstanceUid"`
+	PatientID        string    `json:"patientId"`
+	Description      string    `json:"description"`
+	Status           string    `json:"status"`
+	Pages            int       `json:"pages"`
+	FailedPages      int       `json:"failedPages"`
+	// HandlingTime runs from the first page of the batch until the upload
+	// finished, SendTime covers the upload only
+	HandlingTime time.Duration `json:"handlingTime"`
+	SendTime     time.Duration `json:"sendTime"`
+	// Station is the station the document was scanned at, if it was sent
+	// by another one
+	Station string `json:"station,omitempty"`
+}
+
+// backend persists the entries
+type backend interface {
+	append(entry Entry) error
+	entries(from, to time.Time) ([]Entry, error)
+}
+
+// Store records upload attempts in a JSON lines file in the state directory
+// or in the SQL database
+type Store struct {
+	backend backend
+	logger  *logrus.Logger
+}
+
+func NewStore(cfg *config.Config) (*Store, error) {
+	if err := os.MkdirAll(cfg.StateDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %v", err)
+	}
+	return &Store{
+		backend: &fileBackend{path: filepath.Join(cfg.StateDir, historyFile)},
+		logger:  logging.New(),
+	}, nil
+}
+
+// StudySent implements dicom.SendObserver
+func (s *Store) StudySent(result dicom.StudyResult) {
+	if result.Queued {
+		// Recorded by the sender node once the study is stored
+		return
+	}
+	entry := Entry{
+		Time:             result.FinishedAt,
+		Operator:         result.Request.Operator,
+		StudyInstanceUID: result.Study.StudyInstanceUID,
+		PatientID:        result.Request.Patient.PatientID,
+		Description:      result.Request.Description,
+		Pages:            result.Completed,
+		FailedPages:      result.Failed,
+		SendTime:         result.FinishedAt.Sub(result.StartedAt),
+		Station:          result.Station,
+	}
+
+	started := result.Request.BatchStartedAt
+	if started.IsZero() || started.After(result.StartedAt) {
+		started = result.StartedAt
+	}
+	entry.HandlingTime = result.FinishedAt.Sub(started)
+
+	switch {
+	case result.Succeeded():
+		entry.Status = StatusCompleted
+	case result.Err != nil && isQuarantine(result.Err):
+		entry.Status = StatusQuarantined
+	case result.Completed > 0:
+		entry.Status = StatusPartial
+	default:
+		entry.Status = StatusFailed
+	}
+
+	if err := s.Append(entry); err != nil {
+		s.logger.Warnf("History: Failed to record upload of study %s: %v", entry.StudyInstanceUID, err)
+	}
+}
+
+// Append writes one entry to the log
+func (s *Store) Append(entry Entry) error {
+	return s.backend.append(entry)
+}
+
+// Entries returns all entries with from <= Time < to
+func (s *Store) Entries(from, to time.Time) ([]Entry, error) {
+	return s.backend.entries(from, to)
+}
+
+// fileBackend appends entries to a JSON lines file
+type fileBackend struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (s *fileBackend) append(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+func (s *fileBackend) entries(from, to time.Time) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if entry.Time.Before(from) || !entry.Time.Before(to) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func isQuarantine(err error) bool {
+	_, ok := err.(*dicom.QuarantineError)
+	return ok
+}
@@ -0,0 +1,105 @@
+package history
+
+import (
+	"time"
+
+	"DICOMScanStation/db"
+	"DICOMScanStation/logging"
+)
+
+// migrations creates the history table; durations are stored in
+// milliseconds
+var migrations = []db.Migration{
+	{
+		Version: 1,
+		Name:    "create upload history",
+		Statements: []string{
+			`CREATE TABLE upload_history (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				time TIMESTAMP NOT NULL,
+				station TEXT NOT NULL,
+				operator TEXT NOT NULL,
+				study_instance_uid TEXT NOT NULL,
+				patient_id TEXT NOT NULL,
+				description TEXT NOT NULL,
+				status TEXT NOT NULL,
+				pages INTEGER NOT NULL,
+				failed_pages INTEGER NOT NULL,
+				handling_time_ms BIGINT NOT NULL,
+				send_time_ms BIGINT NOT NULL
+			)`,
+			`CREATE INDEX upload_history_time ON upload_history (time)`,
+		},
+		Postgres: []string{
+			`CREATE TABLE upload_history (
+				id BIGSERIAL PRIMARY KEY,
+				time TIMESTAMPTZ NOT NULL,
+				station TEXT NOT NULL,
+				operator TEXT NOT NULL,
+				study_instance_uid TEXT NOT NULL,
+				patient_id TEXT NOT NULL,
+				description TEXT NOT NULL,
+				status TEXT NOT NULL,
+				pages INTEGER NOT NULL,
+				failed_pages INTEGER NOT NULL,
+				handling_time_ms BIGINT NOT NULL,
+				send_time_ms BIGINT NOT NULL
+			)`,
+			`CREATE INDEX upload_history_time ON upload_history (time)`,
+		},
+	},
+}
+
+// NewDBStore keeps the history in the SQL database. Stations sharing the
+// database share their history; station identifies the rows of this one.
+func NewDBStore(database *db.DB, station string) (*Store, error) {
+	if err := database.Migrate("history", migrations); err != nil {
+		return nil, err
+	}
+	return &Store{
+		backend: &sqlBackend{db: database, station: station},
+		logger:  logging.New(),
+	}, nil
+}
+
+// sqlBackend stores the entries in the upload_history table
+type sqlBackend struct {
+	db      *db.DB
+	station string
+}
+
+func (s *sqlBackend) append(entry Entry) error {
+	station := entry.Station
+	if station == "" {
+		station = s.station
+	}
+	_, err := s.db.Exec(s.db.Rebind(`INSERT INTO upload_history
+		(time, station, operator, study_instance_uid, patient_id, description, status, pages, failed_pages, handling_time_ms, send_time_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		entry.Time.UTC(), station, entry.Operator, entry.StudyInstanceUID, entry.PatientID, entry.Description,
+		entry.Status, entry.Pages, entry.FailedPages, entry.HandlingTime.Milliseconds(), entry.SendTime.Milliseconds())
+	return err
+}
+
+func (s *sqlBackend) entries(from, to time.Time) ([]Entry, error) {
+	rows, err := s.db.Query(s.db.Rebind(`SELECT time, station, operator, study_instance_uid, patient_id, description, status, pages, failed_pages, handling_time_ms, send_time_ms
+		FROM upload_history WHERE time >= ? AND time < ? ORDER BY time`), from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		var handling, send int64
+		if err := rows.Scan(&e.Time, &e.Station, &e.Operator, &e.StudyInstanceUID, &e.PatientID, &e.Description, &e.Status, &e.Pages, &e.FailedPages, &handling, &send); err != nil {
+			return nil, err
+		}
+		e.Time = e.Time.Local()
+		e.HandlingTime = time.Duration(handling) * time.Millisecond
+		e.SendTime = time.Duration(send) * time.Millisecond
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,190 @@
+// Package imap implements the few IMAP4rev1 (RFC 3501) commands needed to
+// fetch new messages from a mailbox over TLS.
+package imap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var literalRe = regexp.MustCompile(`\{(\d+)\}$`)
+
+// Client is a connection to an IMAP server
+type Client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	tagNum int
+}
+
+// response is one untagged server response together with its literal data
+type response struct {
+	text    string
+	literal []byte
+}
+
+// DialTLS connects to an IMAP server using implicit TLS (port 993)
+func DialTLS(addr string, timeout time.Duration, tlsConfig *tls.Config) (*Client, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	c := &Client{conn: conn, reader: bufio.NewReader(conn)}
+	greeting, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected greeting: %s", greeting)
+	}
+	return c, nil
+}
+
+// SetDeadline limits the time for the following commands
+func (c *Client) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+func (c *Client) Login(username, password string) error {
+	_, err := c.command("LOGIN %s %s", quote(username), quote(password))
+	return err
+}
+
+// Select opens a mailbox for reading and writing
+func (c *Client) Select(mailbox string) error {
+	_, err := c.command("SELECT %s", quote(mailbox))
+	return err
+}
+
+// SearchUnseen returns the UIDs of all messages without the \Seen flag
+func (c *Client) SearchUnseen() ([]uint32, error) {
+	responses, err := c.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return nil, err
+	}
+
+	var uids []uint32
+	for _, r := range responses {
+		if !strings.HasPrefix(r.text, "* SEARCH") {
+			continue
+		}
+		for _, field := range strings.Fields(strings.TrimPrefix(r.text, "* SEARCH")) {
+			uid, err := strconv.ParseUint(field, 10, 32)
+			if err == nil {
+				uids = append(uids, uint32(uid))
+			}
+		}
+	}
+	return uids, nil
+}
+
+// Fetch returns the complete RFC 822 message without setting \Seen
+func (c *Client) Fetch(uid uint32) ([]byte, error) {
+	responses, err := c.command("UID FETCH %d BODY.PEEK[]", uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range responses {
+		if strings.Contains(r.text, "FETCH") && r.literal != nil {
+			return r.literal, nil
+		}
+	}
+	return nil, fmt.Errorf("message %d not found", uid)
+}
+
+// MarkSeen sets the \Seen flag so the message is not imported again
+func (c *Client) MarkSeen(uid uint32) error {
+	_, err := c.command(`UID STORE %d +FLAGS.SILENT (\Seen)`, uid)
+	return err
+}
+
+// Delete flags a message as deleted and expunges the mailbox
+func (c *Client) Delete(uid uint32) error {
+	if _, err := c.command(`UID STORE %d +FLAGS.SILENT (\Deleted)`, uid); err != nil {
+		return err
+	}
+	_, err := c.command("EXPUNGE")
+	return err
+}
+
+func (c *Client) Logout() error {
+	_, err := c.command("LOGOUT")
+	c.conn.Close()
+	return err
+}
+
+// command sends a tagged command and collects the untagged responses until
+// the tagged completion result
+func (c *Client) command(format string, args ...interface{}) ([]response, error) {
+	c.tagNum++
+	tag := fmt.Sprintf("a%03d", c.tagNum)
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, err
+	}
+
+	var responses []response
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(line, tag+" ") {
+			status := strings.TrimPrefix(line, tag+" ")
+			if strings.HasPrefix(status, "OK") {
+				return responses, nil
+			}
+			return responses, fmt.Errorf("imap: %s", status)
+		}
+
+		r := response{text: line}
+		// A literal is followed by the rest of the response on a new line
+		for {
+			m := literalRe.FindStringSubmatch(line)
+			if m == nil {
+				break
+			}
+			n, _ := strconv.Atoi(m[1])
+			data := make([]byte, n)
+			if _, err := io.ReadFull(c.reader, data); err != nil {
+				return nil, err
+			}
+			if r.literal == nil {
+				r.literal = data
+			}
+			if line, err = c.readLine(); err != nil {
+				return nil, err
+			}
+			r.text += " " + line
+		}
+		responses = append(responses, r)
+	}
+}
+
+func (c *Client) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// quote encodes s as an IMAP quoted string
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,63 @@
+// Package ingest receives documents from outside the scanner (virtual
+// printer, mailbox) and places them in the pending workspace.
+package ingest
+
+import (
+	"fmt"
+	"strings"
+
+	"DICOMScanStation/config"
+	"DICOMScanStation/ipp"
+	"DICOMScanStation/logging"
+	"DICOMScanStation/pending"
+)
+
+// NewIPPPrinter creates the virtual printer that turns print jobs into
+// pending documents
+func NewIPPPrinter(cfg *config.Config, store *pending.Store) *ipp.Printer {
+	logger := logging.New()
+
+	printer := ipp.NewPrinter(cfg.IPPPrinterName, func(job ipp.Job) error {
+		ext := ".pdf"
+		switch job.DocumentFormat {
+		case "image/jpeg":
+			ext = ".jpg"
+		case "image/tiff":
+			ext = ".tif"
+		}
+		title := job.Name
+		if title == "" {
+			title = fmt.Sprintf("Print job %d", job.ID)
+		}
+
+		doc, err := store.Add(pending.Document{
+			Source: pending.SourceIPP,
+			Sender: job.User,
+			Title:  title,
+			Metadata: map[string]string{
+				"host": hostOnly(job.RemoteAddr),
+			},
+		}, []pending.Attachment{{
+			Name:        "document" + ext,
+			ContentType: job.DocumentFormat,
+			Data:        job.Data,
+		}})
+		if err != nil {
+			logger.Errorf("IPP printer: Failed to store job %d from %s: %v", job.ID, job.RemoteAddr, err)
+			return err
+		}
+
+		logger.Infof("IPP printer: Job %d '%s' from %s stored as pending document %s", job.ID, title, job.User, doc.ID)
+		splitDocument(cfg, store, doc, logger)
+		return nil
+	})
+	printer.MaxJobSize = cfg.MaxFileSize
+	return printer
+}
+
+func hostOnly(remoteAddr string) string {
+	if i := strings.LastIndex(remoteAddr, ":"); i > 0 {
+		return strings.Trim(remoteAddr[:i], "[]")
+	}
+	return remoteAddr
+}
@@ -0,0 +1,277 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"DICOMScanStation/config"
+	"DICOMScanStation/imap"
+	"DICOMScanStation/logging"
+	"DICOMScanStation/pending"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MailPoller imports PDF, JPEG and TIFF attachments from a dedicated mailbox
+type MailPoller struct {
+	config *config.Config
+	store  *pending.Store
+	logger *logrus.Logger
+}
+
+func NewMailPoller(cfg *config.Config, store *pending.Store) *MailPoller {
+	return &MailPoller{
+		config: cfg,
+		store:  store,
+		logger: logging.New(),
+	}
+}
+
+// Start polls the mailbox until ctx is cancelled
+func (p *MailPoller) Start(ctx context.Context) {
+	interval := time.Duration(p.config.IMAPPollInterval) * time.Second
+	if interval < 10*time.Second {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := p.Poll(); err != nil {
+			p.logger.Warnf("Mail ingestion: Poll failed: %v", err)
+		} else if n > 0 {
+			p.logger.Infof("Mail ingestion: Imported %d messages", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll imports all unseen messages and returns how many were stored
+func (p *MailPoller) Poll() (int, error) {
+	timeout := 60 * time.Second
+	addr := net.JoinHostPort(p.config.IMAPHost, strconv.Itoa(p.config.IMAPPort))
+	client, err := imap.DialTLS(addr, timeout, &tls.Config{ServerName: p.config.IMAPHost})
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to %s: %v", addr, err)
+	}
+	defer client.Logout()
+
+	if err := client.Login(p.config.IMAPUsername, p.config.IMAPPassword); err != nil {
+		return 0, err
+	}
+	if err := client.Select(p.config.IMAPMailbox); err != nil {
+		return 0, err
+	}
+
+	uids, err := client.SearchUnseen()
+	if err != nil {
+		return 0, err
+	}
+
+	imported := 0
+	for _, uid := range uids {
+		client.SetDeadline(time.Now().Add(timeout))
+
+		raw, err := client.Fetch(uid)
+		if err != nil {
+			p.logger.Warnf("Mail ingestion: Failed to fetch message %d: %v", uid, err)
+			continue
+		}
+
+		doc, err := p.importMessage(raw)
+		if err != nil {
+			// Leave the message unseen so it is retried on the next poll
+			p.logger.Warnf("Mail ingestion: Failed to import message %d: %v", uid, err)
+			continue
+		}
+		if doc != nil {
+			imported++
+			splitDocument(p.config, p.store, doc, p.logger)
+		}
+
+		if p.config.IMAPDeleteAfterImport {
+			err = client.Delete(uid)
+		} else {
+			err = client.MarkSeen(uid)
+		}
+		if err != nil {
+			p.logger.Warnf("Mail ingestion: Failed to flag message %d: %v", uid, err)
+		}
+	}
+	return imported, nil
+}
+
+// importMessage stores the attachments of a message as a pending document.
+// Messages without usable attachments are skipped and return nil.
+func (p *MailPoller) importMessage(raw []byte) (*pending.Document, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid message: %v", err)
+	}
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	sender := msg.Header.Get("From")
+	senderName := ""
+	if addr, err := mail.ParseAddress(sender); err == nil {
+		sender = addr.Address
+		senderName = addr.Name
+	}
+
+	attachments, err := extractAttachments(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), "", msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 {
+		p.logger.Infof("Mail ingestion: Message '%s' from %s has no PDF, JPEG or TIFF attachment, skipped", subject, sender)
+		return nil, nil
+	}
+
+	title := subject
+	if title == "" {
+		title = "Mail from " + sender
+	}
+	meta := map[string]string{"subject": subject}
+	if senderName != "" {
+		meta["senderName"] = senderName
+	}
+	if date := msg.Header.Get("Date"); date != "" {
+		meta["date"] = date
+	}
+	if id := msg.Header.Get("Message-Id"); id != "" {
+		meta["messageId"] = id
+	}
+
+	return p.store.Add(pending.Document{
+		Source:   pending.SourceIMAP,
+		Sender:   sender,
+		Title:    title,
+		Metadata: meta,
+	}, attachments)
+}
+
+// extractAttachments walks the MIME tree and collects PDF, JPEG and TIFF parts
+func extractAttachments(contentType, encoding, filename string, body io.Reader) ([]pending.Attachment, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		var attachments []pending.Attachment
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("invalid multipart body: %v", err)
+			}
+			found, err := extractAttachments(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), partFilename(part), part)
+			if err != nil {
+				return nil, err
+			}
+			attachments = append(attachments, found...)
+		}
+		return attachments, nil
+	}
+
+	format := attachmentFormat(mediaType, filename)
+	if format == "" {
+		return nil, nil
+	}
+
+	switch strings.ToLower(encoding) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: body})
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode attachment %s: %v", filename, err)
+	}
+
+	if filename == "" {
+		filename = "attachment" + map[string]string{"application/pdf": ".pdf", "image/jpeg": ".jpg", "image/tiff": ".tif"}[format]
+	}
+	return []pending.Attachment{{Name: filename, ContentType: format, Data: data}}, nil
+}
+
+// attachmentFormat accepts PDF, JPEG and TIFF parts, also when the sender only
+// declared application/octet-stream
+func attachmentFormat(mediaType, filename string) string {
+	switch mediaType {
+	case "application/pdf":
+		return "application/pdf"
+	case "image/jpeg", "image/jpg", "image/pjpeg":
+		return "image/jpeg"
+	case "image/tiff", "image/tif":
+		return "image/tiff"
+	case "application/octet-stream":
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".pdf":
+			return "application/pdf"
+		case ".jpg", ".jpeg":
+			return "image/jpeg"
+		case ".tif", ".tiff":
+			return "image/tiff"
+		}
+	}
+	return ""
+}
+
+func partFilename(part *multipart.Part) string {
+	decoder := new(mime.WordDecoder)
+	if name := part.FileName(); name != "" {
+		if decoded, err := decoder.DecodeHeader(name); err == nil {
+			return decoded
+		}
+		return name
+	}
+	if _, params, err := mime.ParseMediaType(part.Header.Get("Content-Type")); err == nil {
+		if decoded, err := decoder.DecodeHeader(params["name"]); err == nil {
+			return decoded
+		}
+	}
+	return ""
+}
+
+// newlineStripper removes line breaks from base64 bodies
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	count, err := n.r.Read(p)
+	j := 0
+	for _, b := range p[:count] {
+		if b != '\r' && b != '\n' {
+			p[j] = b
+			j++
+		}
+	}
+	return j, err
+}
@@ -0,0 +1,27 @@
+package ingest
+
+import (
+	"DICOMScanStation/config"
+	"DICOMScanStation/pending"
+	"DICOMScanStation/separate"
+
+	"github.com/sirupsen/logrus"
+)
+
+// splitDocument applies the configured separation rules to a freshly
+// ingested document. A failed split leaves the document as it arrived.
+func splitDocument(cfg *config.Config, store *pending.Store, doc *pending.Document, logger *logrus.Logger) {
+	opts := separate.OptionsFromConfig(cfg)
+	if !opts.Enabled() {
+		return
+	}
+
+	docs, err := store.Split(doc.ID, opts)
+	if err != nil {
+		logger.Warnf("Ingest: Failed to split pending document %s: %v", doc.ID, err)
+		return
+	}
+	if len(docs) > 1 {
+		logger.Infof("Ingest: Pending document %s split into %d documents", doc.ID, len(docs))
+	}
+}
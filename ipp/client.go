@@ -0,0 +1,96 @@
+package ipp
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+var requestCounter uint32
+
+// Client submits jobs to an IPP printer such as a CUPS queue
+type Client struct {
+	PrinterURI string
+	UserName   string
+	HTTPClient *http.Client
+}
+
+func NewClient(printerURI string, timeout time.Duration) *Client {
+	return &Client{
+		PrinterURI: printerURI,
+		UserName:   "DICOMScanStation",
+		HTTPClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// PrintJob sends a document with the given MIME type to the printer and
+// returns the job id assigned by the printer
+func (c *Client) PrintJob(jobName string, documentFormat string, document []byte) (int32, error) {
+	req := NewRequest(OpPrintJob, atomic.AddUint32(&requestCounter, 1))
+	req.AddString(TagOperation, TagURI, "printer-uri", c.PrinterURI)
+	req.AddString(TagOperation, TagName, "requesting-user-name", c.UserName)
+	req.AddString(TagOperation, TagName, "job-name", jobName)
+	req.AddString(TagOperation, TagMimeMediaType, "document-format", documentFormat)
+	req.Data = document
+
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	jobID, _ := resp.Get("job-id")
+	return jobID.Int(), nil
+}
+
+func (c *Client) do(req *Message) (*Message, error) {
+	endpoint, err := httpURL(c.PrinterURI)
+	if err != nil {
+		return nil, err
+	}
+
+	httpResp, err := c.HTTPClient.Post(endpoint, "application/ipp", bytes.NewReader(req.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to contact printer: %v", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("printer returned HTTP %d", httpResp.StatusCode)
+	}
+
+	resp, err := Decode(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// Successful status codes are in the range 0x0000-0x00FF
+	if resp.Code > 0x00FF {
+		msg, _ := resp.Get("status-message")
+		return resp, &StatusError{Status: resp.Code, Message: msg.String()}
+	}
+	return resp, nil
+}
+
+// httpURL maps ipp:// and ipps:// URIs to the HTTP endpoint on port 631
+func httpURL(printerURI string) (string, error) {
+	u, err := url.Parse(printerURI)
+	if err != nil {
+		return "", fmt.Errorf("invalid printer URI: %v", err)
+	}
+
+	switch u.Scheme {
+	case "ipp":
+		u.Scheme = "http"
+	case "ipps":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return "", fmt.Errorf("unsupported printer URI scheme '%s'", u.Scheme)
+	}
+	if u.Port() == "" {
+		u.Host = u.Hostname() + ":631"
+	}
+	return u.String(), nil
+}
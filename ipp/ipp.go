@@ -0,0 +1,237 @@
+// Package ipp implements the subset of the Internet Printing Protocol
+// (RFC 8010/8011) used to print confirmation slips and to receive print
+// jobs as a virtual printer.
+package ipp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Operation ids
+const (
+	OpPrintJob             uint16 = 0x0002
+	OpValidateJob          uint16 = 0x0004
+	OpGetJobAttributes     uint16 = 0x0009
+	OpGetPrinterAttributes uint16 = 0x000B
+)
+
+// Status codes
+const (
+	StatusOK                         uint16 = 0x0000
+	StatusClientBadRequest           uint16 = 0x0400
+	StatusClientDocumentFormatNotSup uint16 = 0x040A
+	StatusServerInternalError        uint16 = 0x0500
+	StatusServerOperationNotSup      uint16 = 0x0501
+)
+
+// Delimiter tags
+const (
+	TagOperation   byte = 0x01
+	TagJob         byte = 0x02
+	TagEnd         byte = 0x03
+	TagPrinter     byte = 0x04
+	TagUnsupported byte = 0x05
+)
+
+// Value tags
+const (
+	TagInteger       byte = 0x21
+	TagBoolean       byte = 0x22
+	TagEnum          byte = 0x23
+	TagText          byte = 0x41
+	TagName          byte = 0x42
+	TagKeyword       byte = 0x44
+	TagURI           byte = 0x45
+	TagCharset       byte = 0x47
+	TagLanguage      byte = 0x48
+	TagMimeMediaType byte = 0x49
+)
+
+var ErrMalformed = errors.New("ipp: malformed message")
+
+// Attribute is a single attribute value. A multi-valued attribute is a run
+// of consecutive attributes with the same name.
+type Attribute struct {
+	Group byte
+	Tag   byte
+	Name  string
+	Value []byte
+}
+
+// String returns the value of a textual attribute
+func (a Attribute) String() string {
+	return string(a.Value)
+}
+
+// Int returns the value of an integer or enum attribute
+func (a Attribute) Int() int32 {
+	if len(a.Value) != 4 {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(a.Value))
+}
+
+// Message is an IPP request or response
+type Message struct {
+	Version   [2]byte
+	Code      uint16 // operation id for requests, status code for responses
+	RequestID uint32
+	Attrs     []Attribute
+	Data      []byte
+}
+
+// NewRequest creates an IPP/1.1 request with the mandatory charset and
+// natural language operation attributes
+func NewRequest(op uint16, requestID uint32) *Message {
+	m := &Message{Version: [2]byte{1, 1}, Code: op, RequestID: requestID}
+	m.AddString(TagOperation, TagCharset, "attributes-charset", "utf-8")
+	m.AddString(TagOperation, TagLanguage, "attributes-natural-language", "en")
+	return m
+}
+
+// NewResponse creates a response to req with the given status code
+func NewResponse(req *Message, status uint16) *Message {
+	m := &Message{Version: req.Version, Code: status, RequestID: req.RequestID}
+	m.AddString(TagOperation, TagCharset, "attributes-charset", "utf-8")
+	m.AddString(TagOperation, TagLanguage, "attributes-natural-language", "en")
+	return m
+}
+
+func (m *Message) AddString(group, tag byte, name, value string) {
+	m.Attrs = append(m.Attrs, Attribute{Group: group, Tag: tag, Name: name, Value: []byte(value)})
+}
+
+func (m *Message) AddInt(group, tag byte, name string, value int32) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(value))
+	m.Attrs = append(m.Attrs, Attribute{Group: group, Tag: tag, Name: name, Value: b})
+}
+
+func (m *Message) AddBool(group byte, name string, value bool) {
+	b := []byte{0}
+	if value {
+		b[0] = 1
+	}
+	m.Attrs = append(m.Attrs, Attribute{Group: group, Tag: TagBoolean, Name: name, Value: b})
+}
+
+// Get returns the first attribute with the given name
+func (m *Message) Get(name string) (Attribute, bool) {
+	for _, a := range m.Attrs {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Attribute{}, false
+}
+
+// Encode serializes the message including the document data
+func (m *Message) Encode() []byte {
+	var buf bytes.Buffer
+	buf.Write(m.Version[:])
+	binary.Write(&buf, binary.BigEndian, m.Code)
+	binary.Write(&buf, binary.BigEndian, m.RequestID)
+
+	group := byte(0)
+	lastName := ""
+	for _, a := range m.Attrs {
+		name := a.Name
+		if a.Group != group {
+			buf.WriteByte(a.Group)
+			group = a.Group
+		} else if name == lastName {
+			// Additional values are encoded with an empty name
+			name = ""
+		}
+		lastName = a.Name
+		buf.WriteByte(a.Tag)
+		binary.Write(&buf, binary.BigEndian, uint16(len(name)))
+		buf.WriteString(name)
+		binary.Write(&buf, binary.BigEndian, uint16(len(a.Value)))
+		buf.Write(a.Value)
+	}
+	buf.WriteByte(TagEnd)
+	buf.Write(m.Data)
+	return buf.Bytes()
+}
+
+// Decode parses a message; everything after the end-of-attributes tag is
+// returned as document data
+func Decode(r io.Reader) (*Message, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 9 {
+		return nil, ErrMalformed
+	}
+
+	m := &Message{
+		Version:   [2]byte{data[0], data[1]},
+		Code:      binary.BigEndian.Uint16(data[2:4]),
+		RequestID: binary.BigEndian.Uint32(data[4:8]),
+	}
+
+	pos := 8
+	group := byte(0)
+	lastName := ""
+	for {
+		if pos >= len(data) {
+			return nil, ErrMalformed
+		}
+		tag := data[pos]
+		pos++
+
+		if tag == TagEnd {
+			m.Data = data[pos:]
+			return m, nil
+		}
+		if tag < 0x10 {
+			group = tag
+			lastName = ""
+			continue
+		}
+
+		if pos+2 > len(data) {
+			return nil, ErrMalformed
+		}
+		nameLen := int(binary.BigEndian.Uint16(data[pos:]))
+		pos += 2
+		if pos+nameLen+2 > len(data) {
+			return nil, ErrMalformed
+		}
+		name := string(data[pos : pos+nameLen])
+		pos += nameLen
+		valueLen := int(binary.BigEndian.Uint16(data[pos:]))
+		pos += 2
+		if pos+valueLen > len(data) {
+			return nil, ErrMalformed
+		}
+		value := data[pos : pos+valueLen]
+		pos += valueLen
+
+		// An empty name adds a value to the previous attribute
+		if name == "" {
+			name = lastName
+		}
+		lastName = name
+		m.Attrs = append(m.Attrs, Attribute{Group: group, Tag: tag, Name: name, Value: value})
+	}
+}
+
+// StatusError is returned when a printer answers with a non-successful status
+type StatusError struct {
+	Status  uint16
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("ipp status 0x%04x: %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("ipp status 0x%04x", e.Status)
+}
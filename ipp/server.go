@@ -0,0 +1,194 @@
+package ipp
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Job is a document received by the virtual printer
+type Job struct {
+	ID             int32
+	Name           string
+	User           string
+	DocumentFormat string
+	Data           []byte
+	RemoteAddr     string
+}
+
+// Printer is a minimal IPP printer that accepts PDF and JPEG documents and
+// hands every job to a callback. Jobs are processed synchronously and are
+// reported as completed once the callback returns.
+type Printer struct {
+	Name         string
+	MakeAndModel string
+	MaxJobSize   int64
+	// HandleJob stores a received job; a returned error rejects the job
+	HandleJob func(job Job) error
+
+	jobCounter int32
+	startedAt  time.Time
+}
+
+// SupportedFormats lists the document formats accepted by the printer
+var SupportedFormats = []string{"application/pdf", "image/jpeg", "image/tiff"}
+
+func NewPrinter(name string, handle func(job Job) error) *Printer {
+	return &Printer{
+		Name:         name,
+		MakeAndModel: "DICOMScanStation Virtual Printer",
+		HandleJob:    handle,
+		startedAt:    time.Now(),
+	}
+}
+
+func (p *Printer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "IPP requests must use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body := r.Body
+	if p.MaxJobSize > 0 {
+		body = http.MaxBytesReader(w, r.Body, p.MaxJobSize)
+	}
+	req, err := Decode(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var resp *Message
+	switch req.Code {
+	case OpGetPrinterAttributes:
+		resp = NewResponse(req, StatusOK)
+		p.addPrinterAttributes(resp, printerURI(r))
+	case OpValidateJob:
+		resp = p.validate(req)
+	case OpPrintJob:
+		resp = p.printJob(req, r.RemoteAddr)
+	case OpGetJobAttributes:
+		// Jobs finish before Print-Job returns, so every job is completed
+		resp = NewResponse(req, StatusOK)
+		jobID, _ := req.Get("job-id")
+		p.addJobAttributes(resp, printerURI(r), jobID.Int())
+	default:
+		resp = NewResponse(req, StatusServerOperationNotSup)
+	}
+
+	w.Header().Set("Content-Type", "application/ipp")
+	w.Write(resp.Encode())
+}
+
+func (p *Printer) validate(req *Message) *Message {
+	format, _ := req.Get("document-format")
+	if format.String() != "" && format.String() != "application/octet-stream" && !isSupported(format.String()) {
+		resp := NewResponse(req, StatusClientDocumentFormatNotSup)
+		resp.AddString(TagOperation, TagText, "status-message", "unsupported document format "+format.String())
+		return resp
+	}
+	return NewResponse(req, StatusOK)
+}
+
+func (p *Printer) printJob(req *Message, remoteAddr string) *Message {
+	format := detectFormat(req)
+	if !isSupported(format) {
+		resp := NewResponse(req, StatusClientDocumentFormatNotSup)
+		resp.AddString(TagOperation, TagText, "status-message", "only PDF, JPEG and TIFF documents are accepted")
+		return resp
+	}
+
+	name, _ := req.Get("job-name")
+	user, _ := req.Get("requesting-user-name")
+	job := Job{
+		ID:             atomic.AddInt32(&p.jobCounter, 1),
+		Name:           name.String(),
+		User:           user.String(),
+		DocumentFormat: format,
+		Data:           req.Data,
+		RemoteAddr:     remoteAddr,
+	}
+
+	if err := p.HandleJob(job); err != nil {
+		resp := NewResponse(req, StatusServerInternalError)
+		resp.AddString(TagOperation, TagText, "status-message", err.Error())
+		return resp
+	}
+
+	resp := NewResponse(req, StatusOK)
+	uri, _ := req.Get("printer-uri")
+	p.addJobAttributes(resp, uri.String(), job.ID)
+	return resp
+}
+
+func (p *Printer) addJobAttributes(m *Message, printerURI string, jobID int32) {
+	m.AddInt(TagJob, TagInteger, "job-id", jobID)
+	m.AddString(TagJob, TagURI, "job-uri", fmt.Sprintf("%s/jobs/%d", printerURI, jobID))
+	m.AddInt(TagJob, TagEnum, "job-state", 9) // completed
+	m.AddString(TagJob, TagKeyword, "job-state-reasons", "job-completed-successfully")
+}
+
+func (p *Printer) addPrinterAttributes(m *Message, uri string) {
+	m.AddString(TagPrinter, TagURI, "printer-uri-supported", uri)
+	m.AddString(TagPrinter, TagKeyword, "uri-security-supported", "none")
+	m.AddString(TagPrinter, TagKeyword, "uri-authentication-supported", "none")
+	m.AddString(TagPrinter, TagName, "printer-name", p.Name)
+	m.AddString(TagPrinter, TagText, "printer-info", p.Name)
+	m.AddString(TagPrinter, TagText, "printer-make-and-model", p.MakeAndModel)
+	m.AddInt(TagPrinter, TagEnum, "printer-state", 3) // idle
+	m.AddString(TagPrinter, TagKeyword, "printer-state-reasons", "none")
+	m.AddBool(TagPrinter, "printer-is-accepting-jobs", true)
+	m.AddString(TagPrinter, TagKeyword, "ipp-versions-supported", "1.1")
+	m.AddString(TagPrinter, TagKeyword, "ipp-versions-supported", "2.0")
+	for _, op := range []uint16{OpPrintJob, OpValidateJob, OpGetJobAttributes, OpGetPrinterAttributes} {
+		m.AddInt(TagPrinter, TagEnum, "operations-supported", int32(op))
+	}
+	m.AddString(TagPrinter, TagCharset, "charset-configured", "utf-8")
+	m.AddString(TagPrinter, TagCharset, "charset-supported", "utf-8")
+	m.AddString(TagPrinter, TagLanguage, "natural-language-configured", "en")
+	m.AddString(TagPrinter, TagLanguage, "generated-natural-language-supported", "en")
+	m.AddString(TagPrinter, TagMimeMediaType, "document-format-default", SupportedFormats[0])
+	for _, f := range SupportedFormats {
+		m.AddString(TagPrinter, TagMimeMediaType, "document-format-supported", f)
+	}
+	m.AddString(TagPrinter, TagMimeMediaType, "document-format-supported", "application/octet-stream")
+	m.AddBool(TagPrinter, "color-supported", true)
+	m.AddString(TagPrinter, TagKeyword, "pdl-override-supported", "not-attempted")
+	m.AddString(TagPrinter, TagKeyword, "compression-supported", "none")
+	m.AddInt(TagPrinter, TagInteger, "queued-job-count", 0)
+	m.AddInt(TagPrinter, TagInteger, "printer-up-time", int32(time.Since(p.startedAt).Seconds())+1)
+}
+
+// detectFormat uses the declared document format and falls back to the
+// file signature for application/octet-stream
+func detectFormat(req *Message) string {
+	format, _ := req.Get("document-format")
+	if f := format.String(); f != "" && f != "application/octet-stream" {
+		return f
+	}
+	switch {
+	case bytes.HasPrefix(req.Data, []byte("%PDF")):
+		return "application/pdf"
+	case bytes.HasPrefix(req.Data, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(req.Data, []byte("II*\x00")), bytes.HasPrefix(req.Data, []byte("MM\x00*")):
+		return "image/tiff"
+	}
+	return "application/octet-stream"
+}
+
+func isSupported(format string) bool {
+	for _, f := range SupportedFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+func printerURI(r *http.Request) string {
+	return fmt.Sprintf("ipp://%s%s", r.Host, r.URL.Path)
+}
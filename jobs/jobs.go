@@ -0,0 +1,329 @@
+// Package jobs records every scan and send with who did it, for which
+// patient and with which files, so staff can look up weeks later whether a
+// document reached the PACS.
+package jobs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"DICOMScanStation/config"
+	"DICOMScanStation/db"
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/logging"
+
+	"github.com/sirupsen/logrus"
+)
+
+// jobsFile is the embedded SQLite database used without DATABASE_DRIVER
+const jobsFile = "jobs.db"
+
+// Kinds of jobs
+const (
+	KindScan = "scan"
+	KindSend = "send"
+)
+
+// Job outcomes
+const (
+	StatusCompleted   = "completed"
+	StatusPartial     = "partial"
+	StatusFailed      = "failed"
+	StatusQuarantined = "quarantined"
+	// StatusQueued is a send handed to the central send queue
+	StatusQueued = "queued"
+	// StatusCancelled is a scan aborted by the operator
+	StatusCancelled = "cancelled"
+)
+
+// DefaultLimit and MaxLimit bound the number of jobs listed at once
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// ErrNotFound is returned for unknown job IDs
+var ErrNotFound = errors.New("job not found")
+
+// File is a page or instance of a job; scans only name the file
+type File struct {
+	Name           string `json:"name"`
+	Status         string `json:"status,omitempty"`
+	Message        string `json:"message,omitempty"`
+	SOPInstanceUID string `json:"sopInstanceUid,omitempty"`
+	Archive        string `json:"archive,omitempty"`
+}
+
+// Job is one scan or send
+type Job struct {
+	ID          int64  `json:"id"`
+	Kind        string `json:"kind"`
+	Station     string `json:"station"`
+	Operator    string `json:"operator"`
+	PatientID   string `json:"patientId,omitempty"`
+	PatientName string `json:"patientName,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Device is the scanner of a scan job
+	Device           string    `json:"device,omitempty"`
+	StudyInstanceUID string    `json:"studyInstanceUid,omitempty"`
+	Status           string    `json:"status"`
+	Message          string    `json:"message,omitempty"`
+	Pages            int       `json:"pages"`
+	FailedPages      int       `json:"failedPages"`
+	StartedAt        time.Time `json:"startedAt"`
+	FinishedAt       time.Time `json:"finishedAt"`
+	// Files are only returned with a single job
+	Files []File `json:"files,omitempty"`
+}
+
+// Filter selects the jobs to list; empty fields match every job
+type Filter struct {
+	Kind      string
+	Status    string
+	PatientID string
+	Station   string
+	From      time.Time
+	To        time.Time
+	Limit     int
+}
+
+var migrations = []db.Migration{
+	{
+		Version: 1,
+		Name:    "create jobs",
+		Statements: []string{
+			`CREATE TABLE jobs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				kind TEXT NOT NULL,
+				station TEXT NOT NULL,
+				operator TEXT NOT NULL,
+				patient_id TEXT NOT NULL,
+				patient_name TEXT NOT NULL,
+				description TEXT NOT NULL,
+				device TEXT NOT NULL,
+				study_instance_uid TEXT NOT NULL,
+				status TEXT NOT NULL,
+				message TEXT NOT NULL,
+				pages INTEGER NOT NULL,
+				failed_pages INTEGER NOT NULL,
+				files TEXT NOT NULL,
+				started_at TIMESTAMP NOT NULL,
+				finished_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX jobs_started_at ON jobs (started_at)`,
+			`CREATE INDEX jobs_patient_id ON jobs (patient_id)`,
+		},
+		Postgres: []string{
+			`CREATE TABLE jobs (
+				id BIGSERIAL PRIMARY KEY,
+				kind TEXT NOT NULL,
+				station TEXT NOT NULL,
+				operator TEXT NOT NULL,
+				patient_id TEXT NOT NULL,
+				patient_name TEXT NOT NULL,
+				description TEXT NOT NULL,
+				device TEXT NOT NULL,
+				study_instance_uid TEXT NOT NULL,
+				status TEXT NOT NULL,
+				message TEXT NOT NULL,
+				pages INTEGER NOT NULL,
+				failed_pages INTEGER NOT NULL,
+				files TEXT NOT NULL,
+				started_at TIMESTAMPTZ NOT NULL,
+				finished_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX jobs_started_at ON jobs (started_at)`,
+			`CREATE INDEX jobs_patient_id ON jobs (patient_id)`,
+		},
+	},
+}
+
+// Store keeps the jobs in the configured database, or in an embedded
+// SQLite database in the state directory
+type Store struct {
+	db      *db.DB
+	station string
+	logger  *logrus.Logger
+}
+
+// NewStore opens the job store. With a shared database the jobs of all
+// stations are kept together; station identifies the jobs of this one.
+func NewStore(cfg *config.Config, database *db.DB) (*Store, error) {
+	if database == nil {
+		if err := os.MkdirAll(cfg.StateDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create state directory: %v", err)
+		}
+		var err error
+		database, err = db.OpenSQLite(filepath.Join(cfg.StateDir, jobsFile))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := database.Migrate("jobs", migrations); err != nil {
+		return nil, err
+	}
+	return &Store{db: database, station: cfg.DicomStationName, logger: logging.New()}, nil
+}
+
+// Record stores a finished job and returns its ID
+func (s *Store) Record(job Job) (int64, error) {
+	if job.Station == "" {
+		job.Station = s.station
+	}
+	if job.FinishedAt.IsZero() {
+		job.FinishedAt = time.Now()
+	}
+	if job.StartedAt.IsZero() {
+		job.StartedAt = job.FinishedAt
+	}
+	files, err := json.Marshal(job.Files)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = s.db.QueryRow(s.db.Rebind(`INSERT INTO jobs
+		(kind, station, operator, patient_id, patient_name, description, device, study_instance_uid, status, message, pages, failed_pages, files, started_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+		job.Kind, job.Station, job.Operator, job.PatientID, job.PatientName, job.Description, job.Device, job.StudyInstanceUID,
+		job.Status, job.Message, job.Pages, job.FailedPages, string(files), job.StartedAt.UTC(), job.FinishedAt.UTC()).Scan(&id)
+	return id, err
+}
+
+// List returns the jobs matching the filter, the newest first, without
+// their files
+func (s *Store) List(filter Filter) ([]Job, error) {
+	var where []string
+	var args []interface{}
+	add := func(clause string, value interface{}) {
+		where = append(where, clause)
+		args = append(args, value)
+	}
+	if filter.Kind != "" {
+		add("kind = ?", filter.Kind)
+	}
+	if filter.Status != "" {
+		add("status = ?", filter.Status)
+	}
+	if filter.PatientID != "" {
+		add("patient_id = ?", filter.PatientID)
+	}
+	if filter.Station != "" {
+		add("station = ?", filter.Station)
+	}
+	if !filter.From.IsZero() {
+		add("started_at >= ?", filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		add("started_at < ?", filter.To.UTC())
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	query := `SELECT id, kind, station, operator, patient_id, patient_name, description, device, study_instance_uid, status, message, pages, failed_pages, files, started_at, finished_at FROM jobs`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY started_at DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(s.db.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		job.Files = nil
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// Get returns a job with its files
+func (s *Store) Get(id int64) (*Job, error) {
+	row := s.db.QueryRow(s.db.Rebind(`SELECT id, kind, station, operator, patient_id, patient_name, description, device, study_instance_uid, status, message, pages, failed_pages, files, started_at, finished_at
+		FROM jobs WHERE id = ?`), id)
+	job, err := scanJob(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return job, err
+}
+
+func scanJob(row interface{ Scan(...interface{}) error }) (*Job, error) {
+	var job Job
+	var files string
+	err := row.Scan(&job.ID, &job.Kind, &job.Station, &job.Operator, &job.PatientID, &job.PatientName, &job.Description, &job.Device,
+		&job.StudyInstanceUID, &job.Status, &job.Message, &job.Pages, &job.FailedPages, &files, &job.StartedAt, &job.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(files), &job.Files)
+	job.StartedAt = job.StartedAt.Local()
+	job.FinishedAt = job.FinishedAt.Local()
+	return &job, nil
+}
+
+// StudySent implements dicom.SendObserver and records the send as a job
+func (s *Store) StudySent(result dicom.StudyResult) {
+	job := Job{
+		Kind:             KindSend,
+		Station:          result.Station,
+		Operator:         result.Request.Operator,
+		PatientID:        result.Request.Patient.PatientID,
+		PatientName:      result.Request.Patient.Name,
+		Description:      result.Request.Description,
+		StudyInstanceUID: result.Study.StudyInstanceUID,
+		Pages:            result.Completed,
+		FailedPages:      result.Failed,
+		StartedAt:        result.StartedAt,
+		FinishedAt:       result.FinishedAt,
+	}
+	for _, p := range result.Progress {
+		job.Files = append(job.Files, File{
+			Name:           p.Filename,
+			Status:         p.Status,
+			Message:        p.Message,
+			SOPInstanceUID: p.SOPInstanceUID,
+			Archive:        p.Archive,
+		})
+	}
+	if result.Err != nil {
+		job.Message = result.Err.Error()
+	}
+
+	var qErr *dicom.QuarantineError
+	switch {
+	case result.Queued:
+		job.Status = StatusQueued
+	case result.Succeeded():
+		job.Status = StatusCompleted
+	case errors.As(result.Err, &qErr):
+		job.Status = StatusQuarantined
+	case result.Completed > 0:
+		job.Status = StatusPartial
+	default:
+		job.Status = StatusFailed
+	}
+
+	if _, err := s.Record(job); err != nil {
+		s.logger.Warnf("Jobs: Failed to record send of study %s: %v", job.StudyInstanceUID, err)
+	}
+}
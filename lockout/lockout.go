@@ -0,0 +1,175 @@
+// Package lockout tracks failed authentication attempts and locks out
+// callers that keep failing, with a lockout that doubles on every repeat.
+// It guards every credential the station checks, so guessing a key or a
+// password takes years instead of minutes.
+package lockout
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Policy configures when and for how long a key is locked
+type Policy struct {
+	// MaxFailures within Window lock the key; 0 disables the lockout
+	MaxFailures int
+	Window      time.Duration
+	// Duration of the first lockout; each further lockout within
+	// MaxDuration of the previous one doubles it, up to MaxDuration
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+// Lock describes a locked key
+type Lock struct {
+	Key string `json:"key"`
+	// Lockouts counts the lockouts in a row, the current one included
+	Lockouts int       `json:"lockouts"`
+	Until    time.Time `json:"until"`
+}
+
+// maxEntries triggers pruning of expired entries
+const maxEntries = 1000
+
+type entry struct {
+	failures     int
+	firstFailure time.Time
+	lockouts     int
+	lockedUntil  time.Time
+}
+
+// Tracker counts failures per key, e.g. a client address or an account
+type Tracker struct {
+	policy Policy
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+func NewTracker(policy Policy) *Tracker {
+	if policy.MaxDuration < policy.Duration {
+		policy.MaxDuration = policy.Duration
+	}
+	return &Tracker{
+		policy:  policy,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Locked returns how long key stays locked, 0 if it is not locked
+func (t *Tracker) Locked(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.entries[key]
+	if !ok {
+		return 0
+	}
+	if remaining := e.lockedUntil.Sub(time.Now()); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// Failure records a failed attempt. It returns the lockout duration if this
+// failure locked the key, 0 otherwise.
+func (t *Tracker) Failure(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if len(t.entries) > maxEntries {
+		t.prune(now)
+	}
+	e, ok := t.entries[key]
+	if !ok {
+		e = &entry{}
+		t.entries[key] = e
+	}
+	if e.failures == 0 || now.Sub(e.firstFailure) > t.policy.Window {
+		e.failures = 0
+		e.firstFailure = now
+	}
+	e.failures++
+	if t.policy.MaxFailures <= 0 || e.failures < t.policy.MaxFailures {
+		return 0
+	}
+
+	// A key that stayed quiet for MaxDuration after its last lockout
+	// starts over
+	if !e.lockedUntil.IsZero() && now.Sub(e.lockedUntil) > t.policy.MaxDuration {
+		e.lockouts = 0
+	}
+	duration := t.policy.Duration
+	for i := 0; i < e.lockouts && duration < t.policy.MaxDuration; i++ {
+		duration *= 2
+	}
+	if duration > t.policy.MaxDuration {
+		duration = t.policy.MaxDuration
+	}
+
+	e.lockouts++
+	e.lockedUntil = now.Add(duration)
+	e.failures = 0
+	return duration
+}
+
+// prune drops keys whose failures and lockouts have expired, so a scan
+// from many addresses cannot grow the map without bound
+func (t *Tracker) prune(now time.Time) {
+	for key, e := range t.entries {
+		failuresExpired := e.failures == 0 || now.Sub(e.firstFailure) > t.policy.Window
+		lockoutExpired := now.Sub(e.lockedUntil) > t.policy.MaxDuration
+		if failuresExpired && lockoutExpired {
+			delete(t.entries, key)
+		}
+	}
+}
+
+// Success forgets the failures of key after a successful attempt. Its
+// past lockouts are kept, so a key locked again soon after still gets a
+// longer lockout.
+func (t *Tracker) Success(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.entries[key]
+	if !ok {
+		return
+	}
+	if e.lockouts == 0 {
+		delete(t.entries, key)
+		return
+	}
+	e.failures = 0
+}
+
+// Unlock lifts the lockout of key; it reports whether key was locked
+func (t *Tracker) Unlock(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.entries[key]
+	if !ok || !e.lockedUntil.After(time.Now()) {
+		return false
+	}
+	delete(t.entries, key)
+	return true
+}
+
+// Locks returns the currently locked keys, the longest lockout first
+func (t *Tracker) Locks() []Lock {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	locks := []Lock{}
+	for key, e := range t.entries {
+		if e.lockedUntil.After(now) {
+			locks = append(locks, Lock{Key: key, Lockouts: e.lockouts, Until: e.lockedUntil})
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Until.After(locks[j].Until) })
+	return locks
+}
@@ -0,0 +1,53 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	policy := Policy{MaxFailures: 2, Window: time.Minute, Duration: time.Minute, MaxDuration: time.Hour}
+	tests := []struct {
+		name  string
+		steps string
+		// want is the lockout of the last failure
+		want time.Duration
+	}{
+		{"below the limit", "f", 0},
+		{"first lockout", "ff", time.Minute},
+		{"success resets the count", "fsf", 0},
+		{"lockouts double", "ffff", 2 * time.Minute},
+		{"success keeps past lockouts", "ffsff", 2 * time.Minute},
+		{"up to the maximum", "ffffffffffffffff", time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker(policy)
+			var got time.Duration
+			for _, step := range tt.steps {
+				if step == 's' {
+					tracker.Success("anna")
+					continue
+				}
+				got = tracker.Failure("anna")
+			}
+			if got != tt.want {
+				t.Errorf("lockout = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	tracker := NewTracker(Policy{MaxFailures: 1, Window: time.Minute, Duration: time.Minute})
+	tracker.Failure("10.0.0.1")
+	if tracker.Locked("10.0.0.1") <= 0 {
+		t.Fatal("key is not locked")
+	}
+	if !tracker.Unlock("10.0.0.1") {
+		t.Fatal("Unlock did not find the lockout")
+	}
+	if tracker.Locked("10.0.0.1") > 0 || tracker.Unlock("10.0.0.1") {
+		t.Error("key is still locked")
+	}
+}
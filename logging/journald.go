@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// journalSocket is where journald receives entries of its native protocol
+const journalSocket = "/run/systemd/journal/socket"
+
+// JournaldHook writes log entries to the systemd journal with their fields
+// as journal fields, e.g. PATIENTID or UPLOAD, next to MESSAGE and PRIORITY,
+// so they can be filtered with journalctl and forwarded by journald.
+type JournaldHook struct {
+	identifier string
+	mu         sync.Mutex
+	conn       *net.UnixConn
+}
+
+func NewJournaldHook(identifier string) (*JournaldHook, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald at %s: %v", journalSocket, err)
+	}
+	return &JournaldHook{identifier: identifier, conn: conn}, nil
+}
+
+func (h *JournaldHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *JournaldHook) Fire(entry *logrus.Entry) error {
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", entry.Message)
+	writeJournalField(&buf, "PRIORITY", fmt.Sprint(syslogSeverity(entry.Level)))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", h.identifier)
+	for key, value := range entry.Data {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		writeJournalField(&buf, journalFieldName(key), fmt.Sprint(value))
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.conn.Write(buf.Bytes())
+	return err
+}
+
+// writeJournalField adds a field in the native protocol, where values
+// spanning lines are preceded by their length
+func writeJournalField(buf *bytes.Buffer, name string, value string) {
+	buf.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalFieldName turns a log field into a journal field name, which only
+// has upper case letters, digits and underscores and must not start with
+// an underscore or a digit
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	if name == "" || name[0] == '_' || (name[0] >= '0' && name[0] <= '9') {
+		name = "FIELD_" + name
+	}
+	switch name {
+	case "MESSAGE", "PRIORITY", "SYSLOG_IDENTIFIER":
+		// Not to be overridden by a field of the entry
+		name = "FIELD_" + name
+	}
+	return name
+}
@@ -0,0 +1,114 @@
+// Package logging sets up where the loggers of the station write to and in
+// which format, so the log of every package ends up in the same place.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"DICOMScanStation/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	mu        sync.Mutex
+	output    io.Writer        = os.Stdout
+	formatter logrus.Formatter = &logrus.JSONFormatter{}
+	level                      = logrus.InfoLevel
+	// hooks ship entries to syslog or journald
+	hooks []logrus.Hook
+	// redaction removes patient data before entries reach the hooks and
+	// the output
+	redaction *redactHook
+)
+
+// Setup applies LOG_LEVEL, LOG_FORMAT and the log file to all loggers
+// created with New from now on
+func Setup(cfg *config.Config) error {
+	var f logrus.Formatter
+	switch strings.ToLower(strings.TrimSpace(cfg.LogFormat)) {
+	case "", "json":
+		f = &logrus.JSONFormatter{}
+	case "text":
+		f = &logrus.TextFormatter{FullTimestamp: true}
+	default:
+		return fmt.Errorf("unknown LOG_FORMAT '%s' (use json or text)", cfg.LogFormat)
+	}
+	l, err := logrus.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("unknown LOG_LEVEL '%s' (use debug, info, warn or error)", cfg.LogLevel)
+	}
+
+	var writers []io.Writer
+	if cfg.LogStdout || cfg.LogFile == "" {
+		writers = append(writers, os.Stdout)
+	}
+	if cfg.LogFile != "" {
+		file, err := NewRotatingFile(cfg.LogFile, RotationPolicy{
+			MaxSize:    int64(cfg.LogFileMaxSizeMB) * 1024 * 1024,
+			MaxAge:     time.Duration(cfg.LogFileMaxAgeHours) * time.Hour,
+			MaxBackups: cfg.LogFileMaxBackups,
+			Retention:  time.Duration(cfg.LogFileRetentionDays) * 24 * time.Hour,
+		})
+		if err != nil {
+			return err
+		}
+		writers = append(writers, file)
+	}
+
+	var sinks []logrus.Hook
+	if target := strings.TrimSpace(cfg.LogSyslog); target != "" {
+		hook, err := NewSyslogHook(target, cfg.LogSyslogFacility, cfg.AppName)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, hook)
+	}
+	if cfg.LogJournald {
+		hook, err := NewJournaldHook(cfg.AppName)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, hook)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	output = io.MultiWriter(writers...)
+	formatter = f
+	level = l
+	hooks = sinks
+	// Requests logged by gin go to the same place
+	gin.DefaultWriter = output
+	gin.DefaultErrorWriter = output
+	return nil
+}
+
+// New returns a logger that writes where Setup said
+func New() *logrus.Logger {
+	return Apply(logrus.New())
+}
+
+// Apply points an existing logger to the output of Setup
+func Apply(logger *logrus.Logger) *logrus.Logger {
+	mu.Lock()
+	defer mu.Unlock()
+	logger.SetOutput(output)
+	logger.SetFormatter(formatter)
+	logger.SetLevel(level)
+	levelHooks := make(logrus.LevelHooks)
+	if redaction != nil {
+		levelHooks.Add(redaction)
+	}
+	for _, hook := range hooks {
+		levelHooks.Add(hook)
+	}
+	logger.ReplaceHooks(levelHooks)
+	return logger
+}
@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Fields that hold patient data. Log patient data in these fields rather
+// than in the message, so LOG_REDACT_FIELDS can remove it.
+const (
+	FieldPatientID   = "patientId"
+	FieldPatientName = "patientName"
+	FieldBirthDate   = "birthDate"
+	FieldSearchTerm  = "searchTerm"
+)
+
+// Redactor removes patient data from log entries: RedactPHI replaces the
+// value of a field, Redact patient data within a text
+type Redactor interface {
+	Redact(text string) string
+	RedactPHI(value string) string
+}
+
+// redactHook replaces patient data in entries before the other hooks ship
+// them and the formatter writes them
+type redactHook struct {
+	redactor Redactor
+	fields   map[string]bool
+}
+
+// SetRedactor redacts the entries of all loggers configured from now on:
+// the given fields entirely, and patient data recognized in the message
+// and the other fields
+func SetRedactor(redactor Redactor, fields []string) {
+	hook := &redactHook{redactor: redactor, fields: make(map[string]bool)}
+	for _, field := range fields {
+		if field = strings.TrimSpace(field); field != "" {
+			hook.fields[strings.ToLower(field)] = true
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	redaction = hook
+	// Requests logged by gin carry search terms and patient IDs in the URL
+	gin.DefaultWriter = redactingWriter{redactor: redactor, w: output}
+	gin.DefaultErrorWriter = gin.DefaultWriter
+}
+
+func (h *redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *redactHook) Fire(entry *logrus.Entry) error {
+	entry.Message = h.redactor.Redact(entry.Message)
+	// Every entry has a copy of the fields of its logger
+	for key, value := range entry.Data {
+		if h.fields[strings.ToLower(key)] {
+			entry.Data[key] = h.redactor.RedactPHI(fmt.Sprint(value))
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = h.redactor.Redact(v)
+		case error:
+			entry.Data[key] = h.redactor.Redact(v.Error())
+		}
+	}
+	return nil
+}
+
+// redactingWriter redacts text written by gin
+type redactingWriter struct {
+	redactor Redactor
+	w        io.Writer
+}
+
+func (w redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, w.redactor.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
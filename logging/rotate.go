@@ -0,0 +1,146 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotationPolicy says when a log file is rotated and how long rotated
+// files are kept; zero values disable a limit
+type RotationPolicy struct {
+	// MaxSize in bytes and MaxAge of the current file rotate it
+	MaxSize int64
+	MaxAge  time.Duration
+	// MaxBackups rotated files are kept, none older than Retention
+	MaxBackups int
+	Retention  time.Duration
+}
+
+// rotatedTimeFormat is added to the name of rotated files, e.g.
+// app-20240315-143000.log
+const rotatedTimeFormat = "20060102-150405"
+
+// RotatingFile is a log file that is renamed and started anew when it
+// grows too large or too old. Rotated files beyond the policy are deleted.
+type RotatingFile struct {
+	path    string
+	policy  RotationPolicy
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	started time.Time
+}
+
+func NewRotatingFile(path string, policy RotationPolicy) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, policy: policy}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %v", err)
+	}
+	if err := r.open(); err != nil {
+		return nil, fmt.Errorf("failed to open log file: %v", err)
+	}
+	return r, nil
+}
+
+// open continues the log file; an existing file counts as started when it
+// was last written
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file = f
+	r.size = info.Size()
+	r.started = time.Now()
+	if r.size > 0 {
+		r.started = info.ModTime()
+	}
+	return nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.size > 0 && r.due(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			// Keep logging into the current file rather than losing lines
+			fmt.Fprintf(os.Stderr, "Failed to rotate %s: %v\n", r.path, err)
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) due(next int64) bool {
+	if r.policy.MaxSize > 0 && r.size+next > r.policy.MaxSize {
+		return true
+	}
+	return r.policy.MaxAge > 0 && time.Since(r.started) >= r.policy.MaxAge
+}
+
+func (r *RotatingFile) rotate() error {
+	ext := filepath.Ext(r.path)
+	stamp := time.Now()
+	rotated := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(r.path, ext), stamp.Format(rotatedTimeFormat), ext)
+	// Several rotations within a second take the following seconds
+	for _, err := os.Stat(rotated); err == nil; _, err = os.Stat(rotated) {
+		stamp = stamp.Add(time.Second)
+		rotated = fmt.Sprintf("%s-%s%s", strings.TrimSuffix(r.path, ext), stamp.Format(rotatedTimeFormat), ext)
+	}
+	if err := os.Rename(r.path, rotated); err != nil {
+		return err
+	}
+	r.file.Close()
+	r.file = nil
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.cleanup()
+	return nil
+}
+
+// cleanup deletes rotated files beyond MaxBackups or older than Retention
+func (r *RotatingFile) cleanup() {
+	ext := filepath.Ext(r.path)
+	matches, err := filepath.Glob(strings.TrimSuffix(r.path, ext) + "-*" + ext)
+	if err != nil {
+		return
+	}
+	var rotated []string
+	for _, m := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(m, strings.TrimSuffix(r.path, ext)+"-"), ext)
+		if _, err := time.Parse(rotatedTimeFormat, stamp); err == nil {
+			rotated = append(rotated, m)
+		}
+	}
+	// Newest first, the timestamps sort by name
+	sort.Sort(sort.Reverse(sort.StringSlice(rotated)))
+	for i, m := range rotated {
+		expired := false
+		if r.policy.Retention > 0 {
+			if info, err := os.Stat(m); err == nil && time.Since(info.ModTime()) > r.policy.Retention {
+				expired = true
+			}
+		}
+		if expired || (r.policy.MaxBackups > 0 && i >= r.policy.MaxBackups) {
+			os.Remove(m)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package logging
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// syslogQueueSize entries wait while the collector is unreachable
+	syslogQueueSize = 5000
+	syslogRetry     = 5 * time.Second
+	syslogTimeout   = 10 * time.Second
+)
+
+// syslogFacilities are the facilities LOG_SYSLOG_FACILITY accepts
+var syslogFacilities = map[string]int{
+	"user":   1,
+	"daemon": 3,
+	"local0": 16,
+	"local1": 17,
+	"local2": 18,
+	"local3": 19,
+	"local4": 20,
+	"local5": 21,
+	"local6": 22,
+	"local7": 23,
+}
+
+// SyslogHook ships log entries as RFC 5424 messages to the syslog server of
+// LOG_SYSLOG, e.g. "udp://collector:514", "tls://collector:6514" or
+// "unix:///dev/log". The message is the entry as JSON, so collectors can
+// index its fields. Over TCP and TLS messages are framed by octet counting
+// as in RFC 5425.
+type SyslogHook struct {
+	network   string
+	addr      string
+	tlsConfig *tls.Config
+	facility  int
+	appName   string
+	host      string
+	formatter logrus.Formatter
+	queue     chan []byte
+
+	// mu guards the connection, which fatal entries use directly
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogHook returns the hook for target and starts delivering its
+// entries in the background
+func NewSyslogHook(target string, facility string, appName string) (*SyslogHook, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOG_SYSLOG '%s' (use udp://, tcp://, tls://host:port or unix:///path)", target)
+	}
+	code, ok := syslogFacilities[strings.ToLower(strings.TrimSpace(facility))]
+	if !ok {
+		return nil, fmt.Errorf("unknown LOG_SYSLOG_FACILITY '%s' (use user, daemon or local0 to local7)", facility)
+	}
+
+	host, _ := os.Hostname()
+	h := &SyslogHook{
+		addr:      u.Host,
+		facility:  code,
+		appName:   appName,
+		host:      host,
+		formatter: &logrus.JSONFormatter{},
+		queue:     make(chan []byte, syslogQueueSize),
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		h.network = u.Scheme
+	case "tls":
+		h.network = "tcp"
+		h.tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12, ServerName: u.Hostname()}
+	case "unix":
+		// The local syslog daemon, which reads datagrams
+		h.network = "unixgram"
+		h.addr = u.Path
+	default:
+		return nil, fmt.Errorf("unknown LOG_SYSLOG transport '%s' (use udp, tcp, tls or unix)", u.Scheme)
+	}
+	if h.addr == "" {
+		return nil, fmt.Errorf("LOG_SYSLOG '%s' has no address", target)
+	}
+	if h.network != "unixgram" && u.Port() == "" {
+		return nil, fmt.Errorf("LOG_SYSLOG '%s' has no port", target)
+	}
+
+	go h.run()
+	return h, nil
+}
+
+func (h *SyslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire queues the entry. Entries that end the process are sent at once,
+// since the queue would not be delivered anymore.
+func (h *SyslogHook) Fire(entry *logrus.Entry) error {
+	message, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	line := h.message(entry, message)
+
+	if entry.Level <= logrus.FatalLevel {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.write(line)
+	}
+	select {
+	case h.queue <- line:
+	default:
+		// Dropped; the entry is still in the other log outputs
+	}
+	return nil
+}
+
+func (h *SyslogHook) message(entry *logrus.Entry, message []byte) []byte {
+	line := fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		h.facility*8+syslogSeverity(entry.Level), entry.Time.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		nilValue(h.host), nilValue(h.appName), os.Getpid(), strings.TrimRight(string(message), "\n"))
+	if h.network == "tcp" {
+		line = fmt.Sprintf("%d %s", len(line), line)
+	}
+	return []byte(line)
+}
+
+func (h *SyslogHook) run() {
+	for line := range h.queue {
+		for {
+			h.mu.Lock()
+			err := h.write(line)
+			h.mu.Unlock()
+			if err == nil {
+				break
+			}
+			// Not through a logger, which would queue the failure again
+			fmt.Fprintf(os.Stderr, "Log syslog: Failed to reach %s: %v\n", h.addr, err)
+			time.Sleep(syslogRetry)
+		}
+	}
+}
+
+// write sends a message, connecting first if needed; h.mu must be held
+func (h *SyslogHook) write(line []byte) error {
+	if h.conn == nil {
+		dialer := &net.Dialer{Timeout: syslogTimeout}
+		var err error
+		if h.tlsConfig != nil {
+			h.conn, err = tls.DialWithDialer(dialer, h.network, h.addr, h.tlsConfig)
+		} else {
+			h.conn, err = dialer.Dial(h.network, h.addr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	h.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	if _, err := h.conn.Write(line); err != nil {
+		h.conn.Close()
+		h.conn = nil
+		return err
+	}
+	return nil
+}
+
+// syslogSeverity maps a log level to a syslog severity, which journald
+// uses as priority as well
+func syslogSeverity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel:
+		return 0
+	case logrus.FatalLevel:
+		return 2
+	case logrus.ErrorLevel:
+		return 3
+	case logrus.WarnLevel:
+		return 4
+	case logrus.InfoLevel:
+		return 6
+	default:
+		return 7
+	}
+}
+
+// nilValue is the value of an empty syslog header field
+func nilValue(field string) string {
+	if field == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(field, " ", "_")
+}
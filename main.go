@@ -2,19 +2,47 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"DICOMScanStation/alerts"
+	"DICOMScanStation/archive"
+	"DICOMScanStation/audit"
+	"DICOMScanStation/auth"
 	"DICOMScanStation/config"
+	"DICOMScanStation/db"
+	"DICOMScanStation/demo"
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/events"
+	"DICOMScanStation/export"
+	"DICOMScanStation/faults"
+	"DICOMScanStation/history"
+	"DICOMScanStation/ingest"
+	"DICOMScanStation/jobs"
+	"DICOMScanStation/logging"
+	"DICOMScanStation/pending"
+	"DICOMScanStation/preferences"
+	"DICOMScanStation/printing"
+	"DICOMScanStation/profiles"
 	"DICOMScanStation/scanner"
+	"DICOMScanStation/separate"
+	"DICOMScanStation/session"
+	"DICOMScanStation/station"
+	"DICOMScanStation/storage"
+	"DICOMScanStation/support"
+	"DICOMScanStation/tracing"
 	"DICOMScanStation/web"
+	"DICOMScanStation/workflow"
 
-	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
 )
 
@@ -24,48 +52,158 @@ var (
 )
 
 func main() {
+	printConfig := flag.Bool("print-config", false, "print the resolved configuration with value sources and exit")
+	printFormat := flag.String("print-config-format", "text", "output format for --print-config (text, json)")
+	printSchema := flag.Bool("print-config-schema", false, "print a JSON schema of all environment variables and exit")
+	flag.Parse()
+
 	// Initialize logger
 	logger = logrus.New()
 	logger.SetFormatter(&logrus.JSONFormatter{})
 	logger.SetOutput(os.Stdout)
+	if *printConfig || *printSchema {
+		// Keep stdout clean for the configuration dump
+		logger.SetOutput(os.Stderr)
+	}
 
 	// Load environment variables
-	if err := godotenv.Load(); err != nil {
+	if err := config.LoadEnvFile(); err != nil {
 		logger.Warn("No .env file found, using system environment variables")
 	}
 
 	// Load configuration
 	cfg = config.LoadConfig()
 
-	// Set log level
-	if level, err := logrus.ParseLevel(cfg.LogLevel); err == nil {
-		logger.SetLevel(level)
+	if *printConfig || *printSchema {
+		if err := dumpConfig(os.Stdout, cfg, *printSchema, *printFormat); err != nil {
+			logger.Fatalf("Failed to print configuration: %v", err)
+		}
+		return
+	}
+
+	// Log level, format and file of all loggers
+	if err := logging.Setup(cfg); err != nil {
+		logger.Fatalf("Invalid logging configuration: %v", err)
+	}
+	redactor, err := support.NewLogRedactor(cfg)
+	if err != nil {
+		logger.Fatalf("Invalid logging configuration: %v", err)
+	}
+	if redactor != nil {
+		logging.SetRedactor(redactor, cfg.LogRedactFields)
+	}
+	logging.Apply(logger)
+
+	// All settings at once, before anything is started
+	checks := configChecks()
+	if err := cfg.Validate(checks...); err != nil {
+		logger.Fatalf("Invalid configuration: %v", err)
 	}
 
 	logger.Info("Starting DICOMScanStation...")
 
+	// Spans of scans and sends, exported when a collector is configured
+	shutdownTracing, err := tracing.Setup(cfg)
+	if err != nil {
+		logger.Fatalf("Invalid tracing configuration: %v", err)
+	}
+
+	if cfg.Profile != "" {
+		logger.Infof("Using configuration profile '%s'", cfg.Profile)
+	}
+
 	// Create temp directory
 	if err := os.MkdirAll(cfg.TempFilesDir, 0755); err != nil {
 		logger.Fatalf("Failed to create temp directory: %v", err)
 	}
 
+	// Background services stop when ctx is cancelled
+	ctx, stopServices := context.WithCancel(context.Background())
+	defer stopServices()
+
+	// Admin alerts raised by background services
+	alertStore := alerts.NewStore()
+
+	// Live progress of scans and sends, served on /ws
+	eventHub := events.NewHub()
+
+	if cfg.AuthUsersFile != "" || cfg.OIDCIssuer != "" {
+		logger.Info("Login required for the web interface and API")
+	}
+	if cfg.OIDCIssuer != "" {
+		logger.Infof("Single sign-on with %s", cfg.OIDCIssuer)
+	}
+
 	// Initialize scanner manager
 	scannerManager := scanner.NewScannerManager(cfg)
+	scannerManager.SetAlerts(alertStore)
+	scannerManager.SetEvents(eventHub)
 	go scannerManager.StartMonitoring()
 
+	// PACS and scanner settings changed at runtime through the admin API
+	reloader := config.NewReloader(cfg, checks...)
+	reloader.Register(scannerManager)
+	// Configuration management reloads the runtime settings with SIGHUP
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			reloadConfig(reloader)
+		}
+	}()
+
+	// The certificate is checked by configChecks
+	serverTLS, _ := web.LoadServerTLS(cfg)
+
 	// Initialize web server
-	router := setupRouter(scannerManager, cfg)
+	router := setupRouter(ctx, scannerManager, alertStore, eventHub, reloader, cfg)
 
 	// Create HTTP server
 	srv := &http.Server{
-		Addr:    fmt.Sprintf("%s:%s", cfg.AppHost, cfg.AppPort),
-		Handler: router,
+		Addr:      fmt.Sprintf("%s:%s", cfg.AppHost, cfg.AppPort),
+		Handler:   router.GetEngine(),
+		TLSConfig: serverTLS,
+	}
+
+	// Kiosk lockdown serves administration on its own listener
+	var mgmtSrv *http.Server
+	if management := router.GetManagementEngine(); management != nil {
+		mgmtSrv = &http.Server{
+			Addr:      fmt.Sprintf("%s:%s", cfg.ManagementHost, cfg.ManagementPort),
+			Handler:   management,
+			TLSConfig: serverTLS,
+		}
+		go func() {
+			logger.Infof("Kiosk lockdown: management endpoints on %s:%s only", cfg.ManagementHost, cfg.ManagementPort)
+			if err := serve(mgmtSrv); err != nil && err != http.ErrServerClosed {
+				logger.Fatalf("Failed to start management server: %v", err)
+			}
+		}()
+	}
+
+	// Plain HTTP only redirects to HTTPS
+	var redirectSrv *http.Server
+	if serverTLS != nil && cfg.WebHTTPRedirectPort != "" {
+		redirectSrv = &http.Server{
+			Addr:    fmt.Sprintf("%s:%s", cfg.AppHost, cfg.WebHTTPRedirectPort),
+			Handler: web.RedirectToHTTPS(cfg),
+		}
+		go func() {
+			logger.Infof("Redirecting HTTP on port %s to HTTPS", cfg.WebHTTPRedirectPort)
+			if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Fatalf("Failed to start HTTP redirect: %v", err)
+			}
+		}()
 	}
 
 	// Start server in a goroutine
 	go func() {
-		logger.Infof("Starting web server on %s:%s", cfg.AppHost, cfg.AppPort)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		scheme := "http"
+		if serverTLS != nil {
+			scheme = "https"
+		}
+		logger.Infof("Starting web server on %s://%s:%s", scheme, cfg.AppHost, cfg.AppPort)
+		if err := serve(srv); err != nil && err != http.ErrServerClosed {
 			logger.Fatalf("Failed to start server: %v", err)
 		}
 	}()
@@ -78,22 +216,412 @@ func main() {
 	logger.Info("Shutting down server...")
 
 	// Create a deadline for server shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// Shutdown scanner manager
+	// Shutdown scanner manager and background services
 	scannerManager.Stop()
+	stopServices()
 
 	// Shutdown server
-	if err := srv.Shutdown(ctx); err != nil {
+	if mgmtSrv != nil {
+		mgmtSrv.Shutdown(shutdownCtx)
+	}
+	if redirectSrv != nil {
+		redirectSrv.Shutdown(shutdownCtx)
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
 		logger.Fatal("Server forced to shutdown:", err)
 	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Warnf("Failed to export the remaining spans: %v", err)
+	}
 
 	logger.Info("Server exited")
 }
 
-func setupRouter(scannerManager *scanner.ScannerManager, cfg *config.Config) *gin.Engine {
-	router := web.NewRouter(scannerManager, cfg)
+// reloadConfig applies the runtime settings of .env and the admin API;
+// running scans and sends finish with the previous settings
+func reloadConfig(reloader *config.Reloader) {
+	logger.Info("Reloading the configuration")
+	changed, restart, err := reloader.Reload()
+	if err != nil {
+		logger.Errorf("Keeping the current configuration: %v", err)
+		return
+	}
+	if len(changed) > 0 {
+		logger.Infof("Configuration reloaded, changed: %s", strings.Join(changed, ", "))
+	} else {
+		logger.Info("Configuration reloaded without changes")
+	}
+	if len(restart) > 0 {
+		logger.Warnf("Changes to %s take effect after a restart", strings.Join(restart, ", "))
+	}
+}
+
+// configChecks are the checks of other packages the configuration must pass
+// besides Config.Validate, at startup and before a reload
+func configChecks() []func(*config.Config) error {
+	return []func(*config.Config) error{
+		checkSetting("SCANNER_NET_HOSTS", func(cfg *config.Config) error {
+			return scanner.ValidateNetHosts(cfg.ScannerNetHosts)
+		}),
+		checkSetting("SCANNER_DEFAULTS", func(cfg *config.Config) error {
+			_, err := scanner.LoadScannerDefaults(cfg)
+			return err
+		}),
+		checkSetting("AUTH_USERS_FILE", func(cfg *config.Config) error {
+			_, err := auth.LoadUsers(cfg)
+			return err
+		}),
+		checkSetting("WEB_TLS_CERT", func(cfg *config.Config) error {
+			_, err := web.LoadServerTLS(cfg)
+			return err
+		}),
+		checkSetting("CSP_MODE", func(cfg *config.Config) error {
+			return checkValue(cfg.CSPMode, web.ValidCSPMode, "enforce, report-only or off")
+		}),
+		checkSetting("AUDIT_SYSLOG", func(cfg *config.Config) error {
+			_, err := audit.NewSyslog(cfg, nil)
+			return err
+		}),
+		checkSetting("WORKFLOW_REQUIRED_STEPS", func(cfg *config.Config) error {
+			_, err := workflow.NewPolicy(cfg)
+			return err
+		}),
+		checkSetting("DICOM_QUERY_MODEL", func(cfg *config.Config) error {
+			return checkValue(cfg.DicomQueryModel, dicom.ValidQueryModel, "patient or study")
+		}),
+		checkSetting("DICOM_SEND_FORMAT", func(cfg *config.Config) error {
+			return checkValue(cfg.DicomSendFormat, dicom.ValidSendFormat, "images, pdf or multiframe")
+		}),
+		checkSetting("DICOM_CHARACTER_SET", func(cfg *config.Config) error {
+			return checkValue(cfg.DicomCharacterSet, dicom.ValidCharacterSet, "ISO_IR 192, ISO_IR 100 or ISO_IR 6")
+		}),
+		checkSetting("SEND_QUEUE_MODE", func(cfg *config.Config) error {
+			return checkValue(cfg.SendQueueMode, dicom.ValidQueueMode, "enqueue or sender")
+		}),
+		checkSetting("DICOM_TLS", func(cfg *config.Config) error {
+			_, err := dicom.LoadTLSConfig(cfg)
+			return err
+		}),
+		checkSetting("DICOM_UID_ROOT", func(cfg *config.Config) error {
+			return dicom.ValidateUIDRoot(cfg.DicomUIDRoot)
+		}),
+		checkSetting("DICOM_TAG_TEMPLATES", func(cfg *config.Config) error {
+			_, err := dicom.LoadTagTemplates(cfg)
+			return err
+		}),
+		checkSetting("SEPARATION_RULES", func(cfg *config.Config) error {
+			separation := separate.OptionsFromConfig(cfg)
+			return separation.Validate()
+		}),
+		checkSetting("SCAN_SEPARATION_RULES", func(cfg *config.Config) error {
+			if !cfg.ScanSeparation {
+				return nil
+			}
+			scanSeparation := separate.ScanOptionsFromConfig(cfg)
+			if err := scanSeparation.Validate(); err != nil {
+				return err
+			}
+			if !scanSeparation.Enabled() {
+				return fmt.Errorf("no rule given")
+			}
+			return nil
+		}),
+		checkSetting("REMOTE_STATIONS", func(cfg *config.Config) error {
+			_, err := station.ParseRemotes(cfg)
+			return err
+		}),
+	}
+}
+
+// checkSetting reports the error of check under key
+func checkSetting(key string, check func(*config.Config) error) func(*config.Config) error {
+	return func(cfg *config.Config) error {
+		if err := check(cfg); err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		return nil
+	}
+}
+
+// checkValue rejects a value valid does not accept
+func checkValue(value string, valid func(string) bool, choices string) error {
+	if !valid(value) {
+		return fmt.Errorf("unknown value '%s' (use %s)", value, choices)
+	}
+	return nil
+}
+
+func setupRouter(ctx context.Context, scannerManager *scanner.ScannerManager, alertStore *alerts.Store, eventHub *events.Hub, reloader *config.Reloader, cfg *config.Config) *web.Router {
+	fileStore := storage.NewLocalFileStore(cfg)
+	services := web.Services{
+		Scanners:     scannerManager,
+		ScannerAdmin: scannerManager,
+		// Scans on remote stations cannot be cancelled from here
+		ScanCanceller: scannerManager,
+		ScanPreviewer: scannerManager,
+		ScanLocker:    scannerManager,
+		Files:         fileStore,
+		ScanSession:   fileStore,
+		Alerts:        alertStore,
+		Events:        eventHub,
+		Config:        reloader,
+	}
+
+	var workspaces *storage.Workspaces
+	if cfg.WorkspaceSessions {
+		workspaces = storage.NewWorkspaces(cfg)
+		services.Workspaces = workspaces
+		go workspaces.StartJanitor(ctx)
+		logger.Infof("Every browser scans into a workspace of its own in %s/%s", cfg.TempFilesDir, storage.SessionsDir)
+	}
+
+	auditLog, err := audit.NewLog(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to initialize audit trail: %v", err)
+	}
+	// Both are checked by configChecks
+	dicomTLS, _ := dicom.LoadTLSConfig(cfg)
+	auditSyslog, _ := audit.NewSyslog(cfg, dicomTLS)
+	if auditSyslog != nil {
+		auditLog.ForwardTo(auditSyslog)
+		go auditSyslog.Run(ctx)
+		logger.Infof("Forwarding the audit trail to %s", cfg.AuditSyslog)
+	}
+	services.Audit = auditLog
+
+	prefStore, err := preferences.NewStore(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to load user preferences: %v", err)
+	}
+	services.Preferences = prefStore
+
+	profileStore, err := profiles.NewStore(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to load scan profiles: %v", err)
+	}
+	services.Profiles = profileStore
+
+	apiKeys, err := auth.NewAPIKeys(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to load API keys: %v", err)
+	}
+	services.APIKeys = apiKeys
+
+	// The policy is checked by configChecks
+	policy, _ := workflow.NewPolicy(cfg)
+	if len(policy.Steps) > 0 {
+		services.Workflow = policy
+		logger.Infof("Enforcing workflow steps before sending: %v", policy.Steps)
+	}
+
+	dicomService := dicom.NewDicomService(cfg)
+	reloader.Register(dicomService)
+	services.Dicom = dicomService
+	services.Benchmark = dicomService
+	if cfg.DicomAssociationPool {
+		logger.Infof("Reusing store associations, idle associations are released after %d seconds", cfg.DicomAssociationIdleTimeout)
+	}
+	if cfg.DicomStorageCommitment {
+		logger.Infof("Requesting storage commitment after sending, waiting %d seconds for the report", cfg.DicomCommitmentTimeout)
+		if cfg.DicomCommitmentPort > 0 {
+			if err := dicomService.StartCommitmentListener(); err != nil {
+				logger.Fatalf("Failed to start the storage commitment listener: %v", err)
+			}
+			logger.Infof("Accepting storage commitment reports on port %d", cfg.DicomCommitmentPort)
+		}
+	}
+	if cfg.DicomAssociationPool || cfg.DicomStorageCommitment {
+		go func() {
+			<-ctx.Done()
+			dicomService.Close()
+		}()
+	}
+
+	var database *db.DB
+	if db.Enabled(cfg) {
+		database, err = db.Open(cfg)
+		if err != nil {
+			logger.Fatalf("Failed to open the database: %v", err)
+		}
+		logger.Infof("Using %s database for the upload history", database.Driver)
+	}
+
+	if cfg.SendQueueMode != "" {
+		if err := dicomService.EnableQueue(database); err != nil {
+			logger.Fatalf("Failed to initialize the send queue: %v", err)
+		}
+		services.Queue = dicomService
+		if cfg.SendQueueMode == dicom.QueueModeSender {
+			go dicomService.RunQueueSender(ctx)
+			logger.Infof("Sending queued studies of all stations, checking every %d seconds", cfg.SendQueuePollInterval)
+		} else {
+			logger.Info("Studies are queued for the central sender instead of sent to the PACS")
+		}
+	}
+
+	var historyStore *history.Store
+	if database != nil {
+		historyStore, err = history.NewDBStore(database, cfg.DicomStationName)
+		if err != nil {
+			logger.Fatalf("Failed to initialize upload history: %v", err)
+		}
+	} else {
+		historyStore, err = history.NewStore(cfg)
+		if err != nil {
+			logger.Fatalf("Failed to initialize upload history: %v", err)
+		}
+	}
+	dicomService.AddObserver(historyStore)
+	services.History = historyStore
+
+	jobStore, err := jobs.NewStore(cfg, database)
+	if err != nil {
+		logger.Fatalf("Failed to initialize the job log: %v", err)
+	}
+	dicomService.AddObserver(jobStore)
+	services.Jobs = jobStore
+
+	if cfg.PrintConfirmation {
+		if cfg.PrinterURI == "" {
+			logger.Warn("PRINT_CONFIRMATION is enabled but PRINTER_URI is empty, slips will not be printed")
+		} else {
+			dicomService.AddObserver(printing.NewSlipPrinter(cfg))
+			logger.Infof("Confirmation slips will be printed on %s", cfg.PrinterURI)
+		}
+	}
+
+	if cfg.ArchiveEnabled {
+		archiveStore, err := archive.NewStore(cfg)
+		if err != nil {
+			logger.Fatalf("Failed to initialize local archive: %v", err)
+		}
+		dicomService.SetArchive(archiveStore)
+		services.Archive = archiveStore
+		services.Exporter = export.NewExporter(cfg, archiveStore)
+		go archiveStore.StartJanitor(ctx)
+		logger.Infof("Local archive enabled in %s (retention %d days)", cfg.ArchiveDir, cfg.ArchiveRetentionDays)
+	}
+
+	// Started after observers and archive are set, as it reports deliveries
+	if cfg.DicomOutbox {
+		if err := dicomService.EnableOutbox(); err != nil {
+			logger.Fatalf("Failed to initialize the outbox: %v", err)
+		}
+		services.Outbox = dicomService
+		go dicomService.RunOutbox(ctx)
+		logger.Infof("Instances the PACS cannot take are kept in the outbox and retried, waiting at most %d seconds", cfg.DicomOutboxMaxBackoff)
+	}
+
+	if cfg.IPPPrinterEnabled || cfg.IMAPEnabled || cfg.AutoLogoutMinutes > 0 || cfg.ScanSeparation {
+		pendingStore, err := pending.NewStore(cfg)
+		if err != nil {
+			logger.Fatalf("Failed to initialize pending documents: %v", err)
+		}
+		services.Pending = pendingStore
+
+		if cfg.IPPPrinterEnabled {
+			go startIPPPrinter(ctx, cfg, pendingStore)
+		}
+		if cfg.IMAPEnabled {
+			logger.Infof("Importing mail attachments from %s@%s/%s every %d seconds", cfg.IMAPUsername, cfg.IMAPHost, cfg.IMAPMailbox, cfg.IMAPPollInterval)
+			go ingest.NewMailPoller(cfg, pendingStore).Start(ctx)
+		}
+		if cfg.AutoLogoutMinutes > 0 {
+			watcher := session.NewWatcher(cfg, fileStore, workspaces, pendingStore, alertStore)
+			services.Session = watcher
+			go watcher.Start(ctx)
+			logger.Infof("Auto-logout after %d minutes without activity, unsent scans move to the inbox", cfg.AutoLogoutMinutes)
+		}
+	}
+
+	if len(cfg.RemoteStations) > 0 {
+		// The remotes are checked by configChecks
+		remotes, _ := station.ParseRemotes(cfg)
+		services.Scanners = station.NewProxy(services.Scanners, fileStore, remotes, time.Duration(cfg.RemoteStationTimeout)*time.Second)
+		logger.Infof("Offering the scanners of %d remote station(s)", len(remotes))
+	}
+
+	if cfg.DemoMode {
+		// Demo mode answers patient queries and uploads without a PACS
+		logger.Warn("Demo mode enabled: DICOM traffic is simulated")
+		services.Dicom = demo.NewPACS(cfg)
+		services.Benchmark = nil
+	}
+
+	// Config.Validate accepts FAULT_INJECTION in demo mode only
+	if cfg.FaultInjection {
+		logger.Warn("Fault injection enabled: scans, uploads and PACS traffic may fail on purpose")
+		injector := faults.NewInjector(cfg)
+		services.Scanners = injector.WrapScanner(services.Scanners)
+		services.Files = injector.WrapFileStore(services.Files)
+		services.Dicom = injector.WrapDicom(services.Dicom)
+		services.Faults = injector
+	}
+
+	router := web.NewRouter(cfg, services)
+	reloader.Register(router)
 	router.SetupRoutes()
-	return router.GetEngine()
+	return router
+}
+
+// serve runs a server over HTTPS if it has a TLS configuration
+func serve(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServe()
+}
+
+// startIPPPrinter serves the virtual printer until ctx is cancelled
+func startIPPPrinter(ctx context.Context, cfg *config.Config, store *pending.Store) {
+	srv := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", cfg.AppHost, cfg.IPPPrinterPort),
+		Handler: ingest.NewIPPPrinter(cfg, store),
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Infof("Starting IPP virtual printer on ipp://%s:%d/ipp/print", cfg.AppHost, cfg.IPPPrinterPort)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Errorf("IPP virtual printer stopped: %v", err)
+	}
+}
+
+// dumpConfig writes the resolved configuration or its JSON schema to w
+func dumpConfig(w io.Writer, cfg *config.Config, schema bool, format string) error {
+	if schema {
+		data, err := json.MarshalIndent(cfg.Schema(), "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	switch format {
+	case "json":
+		data, err := cfg.MarshalSettings()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "text":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE\tDESCRIPTION")
+		for _, s := range cfg.Settings() {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Key, s.Value, s.Source, s.Description)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown format '%s'", format)
+	}
 }
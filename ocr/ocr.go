@@ -0,0 +1,67 @@
+// Package ocr recognizes the text of scanned pages with tesseract, so
+// letters and forms can be searched for in the PACS.
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Engine runs tesseract on page images
+type Engine struct {
+	path      string
+	languages string
+	timeout   time.Duration
+}
+
+// NewEngine uses the tesseract executable at path with the given languages,
+// e.g. "deu+eng"
+func NewEngine(path string, languages string, timeout time.Duration) *Engine {
+	return &Engine{path: path, languages: languages, timeout: timeout}
+}
+
+// Recognize returns the text of the page image at imagePath
+func (e *Engine) Recognize(imagePath string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	args := []string{imagePath, "stdout"}
+	if e.languages != "" {
+		args = append(args, "-l", e.languages)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.path, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("tesseract timed out after %v", e.timeout)
+		}
+		return "", fmt.Errorf("tesseract failed: %v, output: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return normalize(stdout.String()), nil
+}
+
+// normalize trims trailing spaces and collapses the runs of blank lines
+// tesseract puts between blocks
+func normalize(text string) string {
+	var lines []string
+	blank := false
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\f", "\n"), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,102 @@
+package pdfa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// sRGBProfile builds a minimal ICC v2 display profile for sRGB, used as the
+// output intent of the archived documents. It is generated instead of
+// shipped so that the binary stays self-contained.
+func sRGBProfile() []byte {
+	type tag struct {
+		sig  string
+		data []byte
+	}
+
+	trc := curve()
+	tags := []tag{
+		{"desc", textDescription("sRGB IEC61966-2.1")},
+		{"cprt", text("No copyright, use freely")},
+		{"wtpt", xyz(0.9505, 1.0, 1.0891)},
+		{"rXYZ", xyz(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", xyz(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", xyz(0.1431, 0.0606, 0.7141)},
+		{"rTRC", trc},
+		{"gTRC", trc},
+		{"bTRC", trc},
+	}
+
+	// Tag data follows the 128 byte header and the tag table, 4 byte aligned
+	offset := 128 + 4 + 12*len(tags)
+	var table, data bytes.Buffer
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	for _, t := range tags {
+		table.WriteString(t.sig)
+		binary.Write(&table, binary.BigEndian, uint32(offset+data.Len()))
+		binary.Write(&table, binary.BigEndian, uint32(len(t.data)))
+		data.Write(t.data)
+		for data.Len()%4 != 0 {
+			data.WriteByte(0)
+		}
+	}
+
+	size := offset + data.Len()
+	var header bytes.Buffer
+	binary.Write(&header, binary.BigEndian, uint32(size))
+	header.Write(make([]byte, 4))                                  // preferred CMM
+	header.Write([]byte{0x02, 0x10, 0x00, 0x00})                   // version 2.1
+	header.WriteString("mntrRGB XYZ ")                             // class, color space, PCS
+	header.Write([]byte{0x07, 0xE2, 0, 1, 0, 1, 0, 0, 0, 0, 0, 0}) // 2018-01-01
+	header.WriteString("acsp")
+	header.Write(make([]byte, 4+4+4+4+8+4)) // platform, flags, manufacturer, model, attributes, intent
+	header.Write(s15Fixed16(0.9642, 1.0, 0.8249))
+	header.Write(make([]byte, 4+16+28)) // creator, profile id, reserved
+
+	return append(append(header.Bytes(), table.Bytes()...), data.Bytes()...)
+}
+
+func s15Fixed16(values ...float64) []byte {
+	b := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(b[4*i:], uint32(int32(math.Round(v*65536))))
+	}
+	return b
+}
+
+func xyz(x, y, z float64) []byte {
+	return append([]byte("XYZ \x00\x00\x00\x00"), s15Fixed16(x, y, z)...)
+}
+
+func text(s string) []byte {
+	return append(append([]byte("text\x00\x00\x00\x00"), s...), 0)
+}
+
+func textDescription(s string) []byte {
+	var b bytes.Buffer
+	b.WriteString("desc\x00\x00\x00\x00")
+	binary.Write(&b, binary.BigEndian, uint32(len(s)+1))
+	b.WriteString(s)
+	b.WriteByte(0)
+	b.Write(make([]byte, 4+4+2+1+67)) // no Unicode or ScriptCode description
+	return b.Bytes()
+}
+
+// curve samples the sRGB transfer function
+func curve() []byte {
+	const n = 1024
+	var b bytes.Buffer
+	b.WriteString("curv\x00\x00\x00\x00")
+	binary.Write(&b, binary.BigEndian, uint32(n))
+	for i := 0; i < n; i++ {
+		v := float64(i) / (n - 1)
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		binary.Write(&b, binary.BigEndian, uint16(math.Round(v*65535)))
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,248 @@
+// Package pdfa writes scanned pages as PDF/A-2b documents for long-term
+// archival outside the PACS. JPEG pages are embedded as the original data
+// without recompression, PNG pages losslessly with Flate. The documents
+// carry no text layer, so there are no fonts to embed; the sRGB output
+// intent and XMP metadata with the patient and study identifiers are always
+// included.
+package pdfa
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// DefaultDPI is assumed for JPEGs without a resolution in their JFIF header
+const DefaultDPI = 200
+
+var ErrUnsupportedImage = errors.New("pdfa: unsupported image")
+
+// Document describes the archived document
+type Document struct {
+	Title            string
+	Author           string
+	Subject          string
+	PatientID        string
+	PatientName      string
+	StudyInstanceUID string
+	AccessionNumber  string
+	Created          time.Time
+	Producer         string
+}
+
+// jpegInfo is what we need to know about a page to place it
+type jpegInfo struct {
+	width, height int
+	components    int
+	dpiX, dpiY    float64
+}
+
+// Write renders one page per JPEG or PNG image
+func Write(w io.Writer, doc Document, pages [][]byte) error {
+	if len(pages) == 0 {
+		return errors.New("pdfa: no pages")
+	}
+
+	pw := &writer{}
+	pw.buf.WriteString("%PDF-1.7\n%\xE2\xE3\xCF\xD3\n")
+
+	// Fixed objects: 1 catalog, 2 page tree, 3 metadata, 4 ICC profile,
+	// then image, content and page object per page
+	const (
+		catalogObj = 1
+		pagesObj   = 2
+		xmpObj     = 3
+		iccObj     = 4
+	)
+	pageObj := func(i int) int { return 5 + 3*i + 2 }
+
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageObj(i)))
+	}
+
+	pw.object(catalogObj, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R /Metadata %d 0 R /OutputIntents [<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (sRGB IEC61966-2.1) /Info (sRGB IEC61966-2.1) /DestOutputProfile %d 0 R >>] >>",
+		pagesObj, xmpObj, iccObj))
+	pw.object(pagesObj, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	pw.stream(xmpObj, "/Type /Metadata /Subtype /XML", []byte(xmp(doc)))
+	pw.stream(iccObj, "/N 3", sRGBProfile())
+
+	for i, data := range pages {
+		page, err := readPage(data)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", i+1, err)
+		}
+
+		imageObj, contentObj := 5+3*i, 5+3*i+1
+		pw.stream(imageObj, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent %d /Filter %s",
+			page.width, page.height, page.colorSpace, page.bits, page.filter), page.data)
+
+		// Page size follows the scan resolution, in points
+		width := float64(page.width) * 72 / page.dpiX
+		height := float64(page.height) * 72 / page.dpiY
+		content := fmt.Sprintf("q %.2f 0 0 %.2f 0 0 cm /Im0 Do Q", width, height)
+		pw.stream(contentObj, "", []byte(content))
+		pw.object(pageObj(i), fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+			pagesObj, width, height, imageObj, contentObj))
+	}
+
+	// The file identifier is required by PDF/A
+	id := md5.Sum([]byte(fmt.Sprintf("%s|%s|%d", doc.StudyInstanceUID, doc.Title, doc.Created.UnixNano())))
+	pw.finish(fmt.Sprintf("/Root %d 0 R /ID [<%x> <%x>]", catalogObj, id, id))
+
+	_, err := w.Write(pw.buf.Bytes())
+	return err
+}
+
+// writer keeps track of object offsets for the cross-reference table
+type writer struct {
+	buf     bytes.Buffer
+	offsets map[int]int
+}
+
+func (pw *writer) object(num int, body string) {
+	if pw.offsets == nil {
+		pw.offsets = make(map[int]int)
+	}
+	pw.offsets[num] = pw.buf.Len()
+	fmt.Fprintf(&pw.buf, "%d 0 obj\n%s\nendobj\n", num, body)
+}
+
+func (pw *writer) stream(num int, dict string, data []byte) {
+	if pw.offsets == nil {
+		pw.offsets = make(map[int]int)
+	}
+	pw.offsets[num] = pw.buf.Len()
+	fmt.Fprintf(&pw.buf, "%d 0 obj\n<< %s /Length %d >>\nstream\n", num, dict, len(data))
+	pw.buf.Write(data)
+	pw.buf.WriteString("\nendstream\nendobj\n")
+}
+
+func (pw *writer) finish(trailer string) {
+	xref := pw.buf.Len()
+	count := len(pw.offsets) + 1
+	fmt.Fprintf(&pw.buf, "xref\n0 %d\n0000000000 65535 f\r\n", count)
+	for num := 1; num < count; num++ {
+		fmt.Fprintf(&pw.buf, "%010d 00000 n\r\n", pw.offsets[num])
+	}
+	fmt.Fprintf(&pw.buf, "trailer\n<< /Size %d %s >>\nstartxref\n%d\n%%%%EOF\n", count, trailer, xref)
+}
+
+// readJPEG reads the frame size and JFIF resolution
+func readJPEG(data []byte) (*jpegInfo, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, ErrUnsupportedImage
+	}
+
+	info := &jpegInfo{dpiX: DefaultDPI, dpiY: DefaultDPI}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil, ErrUnsupportedImage
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		segment := data[pos+4 : min(pos+2+length, len(data))]
+
+		switch {
+		case marker == 0xE0 && len(segment) >= 12 && string(segment[:5]) == "JFIF\x00":
+			x := float64(binary.BigEndian.Uint16(segment[8:]))
+			y := float64(binary.BigEndian.Uint16(segment[10:]))
+			switch segment[7] {
+			case 1: // dots per inch
+				if x > 0 && y > 0 {
+					info.dpiX, info.dpiY = x, y
+				}
+			case 2: // dots per cm
+				if x > 0 && y > 0 {
+					info.dpiX, info.dpiY = x*2.54, y*2.54
+				}
+			}
+		case marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC:
+			// Start of frame
+			if len(segment) < 6 {
+				return nil, ErrUnsupportedImage
+			}
+			info.height = int(binary.BigEndian.Uint16(segment[1:]))
+			info.width = int(binary.BigEndian.Uint16(segment[3:]))
+			info.components = int(segment[5])
+			if info.components != 1 && info.components != 3 {
+				return nil, fmt.Errorf("%w: %d color components", ErrUnsupportedImage, info.components)
+			}
+			if info.width == 0 || info.height == 0 {
+				return nil, ErrUnsupportedImage
+			}
+			return info, nil
+		}
+		pos += 2 + length
+	}
+	return nil, ErrUnsupportedImage
+}
+
+// xmp returns the metadata packet. The study identifiers use a custom
+// schema, which PDF/A requires to be declared in an extension schema.
+func xmp(doc Document) string {
+	created := doc.Created.Format("2006-01-02T15:04:05-07:00")
+	esc := html.EscapeString
+
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\xEF\xBB\xBF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about=""
+  xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/"
+  xmlns:dc="http://purl.org/dc/elements/1.1/"
+  xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+  xmlns:pdf="http://ns.adobe.com/pdf/1.3/"
+  xmlns:dss="http://github.com/wyrdnixx/DICOMScanStation/ns/1.0/"
+  xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/"
+  xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#"
+  xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">
+<pdfaid:part>2</pdfaid:part>
+<pdfaid:conformance>B</pdfaid:conformance>
+`)
+	fmt.Fprintf(&b, "<dc:format>application/pdf</dc:format>\n")
+	fmt.Fprintf(&b, "<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:title>\n", esc(doc.Title))
+	if doc.Author != "" {
+		fmt.Fprintf(&b, "<dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>\n", esc(doc.Author))
+	}
+	if doc.Subject != "" {
+		fmt.Fprintf(&b, "<dc:description><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:description>\n", esc(doc.Subject))
+	}
+	fmt.Fprintf(&b, "<xmp:CreateDate>%s</xmp:CreateDate>\n<xmp:ModifyDate>%s</xmp:ModifyDate>\n<xmp:MetadataDate>%s</xmp:MetadataDate>\n", created, created, created)
+	fmt.Fprintf(&b, "<xmp:CreatorTool>%s</xmp:CreatorTool>\n<pdf:Producer>%s</pdf:Producer>\n", esc(doc.Producer), esc(doc.Producer))
+	fmt.Fprintf(&b, "<dss:PatientID>%s</dss:PatientID>\n<dss:PatientName>%s</dss:PatientName>\n", esc(doc.PatientID), esc(doc.PatientName))
+	fmt.Fprintf(&b, "<dss:StudyInstanceUID>%s</dss:StudyInstanceUID>\n<dss:AccessionNumber>%s</dss:AccessionNumber>\n", esc(doc.StudyInstanceUID), esc(doc.AccessionNumber))
+
+	b.WriteString(`<pdfaExtension:schemas><rdf:Bag><rdf:li rdf:parseType="Resource">
+<pdfaSchema:schema>DICOMScanStation study identifiers</pdfaSchema:schema>
+<pdfaSchema:namespaceURI>http://github.com/wyrdnixx/DICOMScanStation/ns/1.0/</pdfaSchema:namespaceURI>
+<pdfaSchema:prefix>dss</pdfaSchema:prefix>
+<pdfaSchema:property><rdf:Seq>
+`)
+	for _, p := range [][2]string{
+		{"PatientID", "Patient ID in the PACS"},
+		{"PatientName", "Patient name in DICOM format"},
+		{"StudyInstanceUID", "DICOM Study Instance UID"},
+		{"AccessionNumber", "Accession number of the order"},
+	} {
+		fmt.Fprintf(&b, "<rdf:li rdf:parseType=\"Resource\"><pdfaProperty:name>%s</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>%s</pdfaProperty:description></rdf:li>\n", p[0], p[1])
+	}
+	b.WriteString(`</rdf:Seq></pdfaSchema:property>
+</rdf:li></rdf:Bag></pdfaExtension:schemas>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`)
+	return b.String()
+}
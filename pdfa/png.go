@@ -0,0 +1,123 @@
+package pdfa
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pageImage is an image XObject ready to be written
+type pageImage struct {
+	width, height int
+	colorSpace    string
+	bits          int
+	filter        string
+	data          []byte
+	dpiX, dpiY    float64
+}
+
+// readPage prepares a scanned page, a JPEG embedded as it is or a PNG
+// compressed losslessly with Flate
+func readPage(data []byte) (*pageImage, error) {
+	if bytes.HasPrefix(data, pngSignature) {
+		return readPNG(data)
+	}
+	info, err := readJPEG(data)
+	if err != nil {
+		return nil, err
+	}
+	colorSpace := "/DeviceRGB"
+	if info.components == 1 {
+		colorSpace = "/DeviceGray"
+	}
+	return &pageImage{
+		width: info.width, height: info.height,
+		colorSpace: colorSpace, bits: 8, filter: "/DCTDecode", data: data,
+		dpiX: info.dpiX, dpiY: info.dpiY,
+	}, nil
+}
+
+// readPNG decodes a PNG page into gray or RGB samples. Alpha is dropped;
+// scans do not have transparency.
+func readPNG(data []byte) (*pageImage, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	bounds := img.Bounds()
+	page := &pageImage{width: bounds.Dx(), height: bounds.Dy(), filter: "/FlateDecode", dpiX: DefaultDPI, dpiY: DefaultDPI}
+	page.dpiX, page.dpiY = pngResolution(data)
+
+	var samples []byte
+	switch img := img.(type) {
+	case *image.Gray:
+		page.colorSpace, page.bits = "/DeviceGray", 8
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			samples = append(samples, img.Pix[img.PixOffset(bounds.Min.X, y):][:page.width]...)
+		}
+	case *image.Gray16:
+		// 16 bit samples are big endian in PDF as in PNG
+		page.colorSpace, page.bits = "/DeviceGray", 16
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			samples = append(samples, img.Pix[img.PixOffset(bounds.Min.X, y):][:2*page.width]...)
+		}
+	default:
+		page.colorSpace, page.bits = "/DeviceRGB", 8
+		samples = make([]byte, 0, 3*page.width*page.height)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+				samples = append(samples, c.R, c.G, c.B)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(samples)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	page.data = buf.Bytes()
+	return page, nil
+}
+
+// pngResolution reads the pHYs chunk, which gives pixels per meter
+func pngResolution(data []byte) (float64, float64) {
+	pos := len(pngSignature)
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		kind := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) || kind == "IDAT" {
+			break
+		}
+		chunk := data[pos+8 : pos+8+length]
+		if kind == "pHYs" && length == 9 && chunk[8] == 1 {
+			x := float64(binary.BigEndian.Uint32(chunk)) * 0.0254
+			y := float64(binary.BigEndian.Uint32(chunk[4:])) * 0.0254
+			if x > 0 && y > 0 {
+				return x, y
+			}
+		}
+		pos += 12 + length
+	}
+	return DefaultDPI, DefaultDPI
+}
+
+// Check reports whether a page can be embedded without converting it
+func Check(data []byte) error {
+	if bytes.HasPrefix(data, pngSignature) {
+		if _, err := png.DecodeConfig(bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+		}
+		return nil
+	}
+	_, err := readJPEG(data)
+	return err
+}
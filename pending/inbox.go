@@ -0,0 +1,265 @@
+package pending
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"DICOMScanStation/dicom"
+)
+
+// pagesDir holds the JPEG pages rendered for preview and sending
+const pagesDir = "pages"
+
+var (
+	ErrNoOperator   = errors.New("operator is required")
+	ErrNotLocked    = errors.New("pending document must be locked before it is changed")
+	ErrNotAssigned  = errors.New("pending document is not assigned to a patient")
+	ErrPageNotFound = errors.New("page not found")
+)
+
+// Lock marks a pending document as being worked on by one operator, so two
+// people do not assign the same letter to different patients
+type Lock struct {
+	Operator string    `json:"operator"`
+	Since    time.Time `json:"since"`
+	Expires  time.Time `json:"expires"`
+}
+
+// LockedError is returned when another operator holds the lock
+type LockedError struct {
+	Lock Lock
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("pending document is locked by %s until %s", e.Lock.Operator, e.Lock.Expires.Format("15:04"))
+}
+
+// Assignment is the patient and study description chosen for a document
+type Assignment struct {
+	Patient         dicom.PatientInfo `json:"patient"`
+	Description     string            `json:"description"`
+	DocumentCreator string            `json:"documentCreator"`
+	AssignedBy      string            `json:"assignedBy"`
+	AssignedAt      time.Time         `json:"assignedAt"`
+}
+
+// active returns the lock if it has not expired
+func (d *Document) active(now time.Time) *Lock {
+	if d.Lock == nil || now.After(d.Lock.Expires) {
+		return nil
+	}
+	return d.Lock
+}
+
+// LockedBy returns the operator holding the lock, or "" if the document is
+// free
+func (d *Document) LockedBy() string {
+	if l := d.active(time.Now()); l != nil {
+		return l.Operator
+	}
+	return ""
+}
+
+// Lock reserves a document for the operator. Locking again extends the lock;
+// an expired lock of another operator is taken over.
+func (s *Store) Lock(id string, operator string) (*Document, error) {
+	return s.update(id, operator, false, func(doc *Document) error { return nil })
+}
+
+// Unlock releases the operator's lock
+func (s *Store) Unlock(id string, operator string) (*Document, error) {
+	return s.update(id, operator, true, func(doc *Document) error {
+		doc.Lock = nil
+		return nil
+	})
+}
+
+// Assign records the patient for a document locked by the operator
+func (s *Store) Assign(id string, operator string, a Assignment) (*Document, error) {
+	if strings.TrimSpace(a.Patient.PatientID) == "" {
+		return nil, fmt.Errorf("patient ID is required")
+	}
+	return s.update(id, operator, true, func(doc *Document) error {
+		a.AssignedBy = operator
+		a.AssignedAt = time.Now()
+		doc.Assignment = &a
+		return nil
+	})
+}
+
+// update applies fn to a document under the operator's lock. With
+// requireLock the operator must already hold the lock, otherwise it is
+// acquired.
+func (s *Store) update(id string, operator string, requireLock bool, fn func(doc *Document) error) (*Document, error) {
+	operator = strings.TrimSpace(operator)
+	if operator == "" {
+		return nil, ErrNoOperator
+	}
+	if err := validateID(id); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.readDocument(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLock(doc, operator, requireLock); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if doc.Lock == nil || doc.Lock.Operator != operator || now.After(doc.Lock.Expires) {
+		doc.Lock = &Lock{Operator: operator, Since: now}
+	}
+	doc.Lock.Expires = now.Add(s.lockDuration())
+
+	if err := fn(doc); err != nil {
+		return nil, err
+	}
+	doc.Version++
+	if err := s.writeDocument(*doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// checkLock fails if another operator holds the lock, or if requireLock is
+// set and the operator does not hold it
+func (s *Store) checkLock(doc *Document, operator string, requireLock bool) error {
+	lock := doc.active(time.Now())
+	if lock != nil && lock.Operator != operator {
+		return &LockedError{Lock: *lock}
+	}
+	if lock == nil && requireLock {
+		return ErrNotLocked
+	}
+	return nil
+}
+
+func (s *Store) lockDuration() time.Duration {
+	minutes := s.config.PendingLockMinutes
+	if minutes <= 0 {
+		minutes = 15
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Pages renders the document as JPEG pages for preview and sending. The
+// pages are rendered once and kept with the document.
+func (s *Store) Pages(id string) ([]string, error) {
+	if err := validateID(id); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.readDocument(id)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Pages != nil {
+		return doc.Pages, nil
+	}
+
+	docDir := filepath.Join(s.dir, id)
+	dir := filepath.Join(docDir, pagesDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	pages := []string{}
+	for i, f := range doc.Files {
+		names, err := s.renderPages(filepath.Join(docDir, f.Name), dir, fmt.Sprintf("page_%02d", i+1))
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("failed to render %s: %v", f.Name, err)
+		}
+		pages = append(pages, names...)
+	}
+
+	// Rendering is not a change of the document, so the version stays
+	doc.Pages = pages
+	if err := s.writeDocument(*doc); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// PagePath returns the path of a rendered page
+func (s *Store) PagePath(id string, page string) (string, error) {
+	pages, err := s.Pages(id)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range pages {
+		if p == page {
+			return filepath.Join(s.dir, id, pagesDir, p), nil
+		}
+	}
+	return "", ErrPageNotFound
+}
+
+// PrepareSend checks that the operator holds the lock and a patient is
+// assigned, and returns the document with the directory of its pages
+func (s *Store) PrepareSend(id string, operator string) (*Document, string, error) {
+	if _, err := s.Pages(id); err != nil {
+		return nil, "", err
+	}
+
+	doc, err := s.update(id, operator, true, func(doc *Document) error {
+		if doc.Assignment == nil {
+			return ErrNotAssigned
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return doc, filepath.Join(s.dir, id, pagesDir), nil
+}
+
+// Sent removes the pages that reached the PACS. The document is deleted
+// once no page is left; otherwise it stays locked so the operator can retry.
+func (s *Store) Sent(id string, sentPages []string) (remaining int, err error) {
+	if err := validateID(id); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.readDocument(id)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := make(map[string]bool)
+	for _, p := range sentPages {
+		sent[p] = true
+	}
+	var left []string
+	for _, p := range doc.Pages {
+		if sent[p] {
+			os.Remove(filepath.Join(s.dir, id, pagesDir, p))
+			continue
+		}
+		left = append(left, p)
+	}
+
+	if len(left) == 0 {
+		s.logger.Infof("Pending: Document %s sent to the PACS", id)
+		return 0, os.RemoveAll(filepath.Join(s.dir, id))
+	}
+
+	doc.Pages = left
+	doc.Version++
+	return len(left), s.writeDocument(*doc)
+}
@@ -0,0 +1,125 @@
+package pending
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"DICOMScanStation/rasterize"
+
+	"golang.org/x/image/tiff"
+)
+
+var errInvalidTIFF = errors.New("invalid TIFF file")
+
+// renderPages writes every page of a PDF, TIFF or JPEG file as JPEG into
+// dir and returns the created file names in page order. PNG files, i.e.
+// lossless scans handed over from the workspace, are kept as they are.
+func (s *Store) renderPages(src string, dir string, prefix string) ([]string, error) {
+	switch strings.ToLower(filepath.Ext(src)) {
+	case ".pdf":
+		return s.rasterizePDF(src, dir, prefix)
+	case ".tif", ".tiff":
+		return splitTIFF(src, dir, prefix)
+	case ".jpg", ".jpeg", ".png":
+		ext := ".jpg"
+		if strings.EqualFold(filepath.Ext(src), ".png") {
+			ext = ".png"
+		}
+		name := prefix + ext
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return nil, err
+		}
+		return []string{name}, nil
+	default:
+		return nil, fmt.Errorf("unsupported file type %s", filepath.Ext(src))
+	}
+}
+
+// rasterizePDF renders every page of a PDF to a JPEG
+func (s *Store) rasterizePDF(pdfPath string, dir string, prefix string) ([]string, error) {
+	return rasterize.PDF(s.config.PopplerPath, s.config.PDFRasterDPI, pdfPath, dir, prefix)
+}
+
+// splitTIFF converts each page of a multi-page TIFF to JPEG. The decoder
+// only reads the first image, so every page is decoded from a copy whose
+// header points at that page's directory; all other offsets in a TIFF are
+// absolute and stay valid.
+func splitTIFF(src string, dir string, prefix string) ([]string, error) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+	offsets, err := tiffDirectories(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for i, offset := range offsets {
+		page := append([]byte(nil), data...)
+		byteOrder(page).PutUint32(page[4:], offset)
+
+		img, err := tiff.Decode(bytes.NewReader(page))
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %v", i+1, err)
+		}
+
+		name := fmt.Sprintf("%s-%03d.jpg", prefix, i+1)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+			return nil, fmt.Errorf("page %d: %v", i+1, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func byteOrder(data []byte) binary.ByteOrder {
+	if data[0] == 'M' {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// tiffDirectories returns the offsets of all image file directories
+func tiffDirectories(data []byte) ([]uint32, error) {
+	if len(data) < 8 || !(bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*"))) {
+		return nil, errInvalidTIFF
+	}
+	order := byteOrder(data)
+
+	var offsets []uint32
+	seen := make(map[uint32]bool)
+	offset := order.Uint32(data[4:])
+	for offset != 0 {
+		if seen[offset] || int(offset)+2 > len(data) {
+			return nil, errInvalidTIFF
+		}
+		seen[offset] = true
+		offsets = append(offsets, offset)
+
+		entries := int(order.Uint16(data[offset:]))
+		next := int(offset) + 2 + 12*entries
+		if next+4 > len(data) {
+			return nil, errInvalidTIFF
+		}
+		offset = order.Uint32(data[next:])
+	}
+	if len(offsets) == 0 {
+		return nil, errInvalidTIFF
+	}
+	return offsets, nil
+}
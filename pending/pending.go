@@ -0,0 +1,281 @@
+// Package pending keeps documents that arrived without a patient (printed to
+// the virtual printer, received by mail or left unsent in the workspace)
+// until an operator assigns them.
+package pending
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"DICOMScanStation/config"
+	"DICOMScanStation/logging"
+
+	"github.com/sirupsen/logrus"
+)
+
+const metadataFile = "document.json"
+
+// Sources of pending documents
+const (
+	SourceIPP  = "ipp"
+	SourceIMAP = "imap"
+	// SourceWorkspace is an abandoned scan workspace after auto-logout
+	SourceWorkspace = "workspace"
+	// SourceScan is a section of an ADF batch split at separator sheets
+	SourceScan = "scan"
+)
+
+var ErrNotFound = errors.New("pending document not found")
+
+// File is one file of a pending document
+type File struct {
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+// Document is a workspace awaiting patient assignment
+type Document struct {
+	ID         string            `json:"id"`
+	Source     string            `json:"source"`
+	Sender     string            `json:"sender"`
+	Title      string            `json:"title"`
+	ReceivedAt time.Time         `json:"receivedAt"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Files      []File            `json:"files"`
+	// Inbox state, see Lock and Assign
+	Lock       *Lock       `json:"lock,omitempty"`
+	Assignment *Assignment `json:"assignment,omitempty"`
+	// Pages are the rendered JPEG pages once previewed
+	Pages []string `json:"pages,omitempty"`
+	// Version is increased on every change for optimistic locking
+	Version int `json:"version"`
+}
+
+// Attachment is a file handed over by an ingestion source
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Store keeps pending documents on disk, one directory per document
+type Store struct {
+	config *config.Config
+	logger *logrus.Logger
+	dir    string
+	mu     sync.Mutex
+}
+
+func NewStore(cfg *config.Config) (*Store, error) {
+	if err := os.MkdirAll(cfg.PendingDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create pending directory: %v", err)
+	}
+	return &Store{
+		config: cfg,
+		logger: logging.New(),
+		dir:    cfg.PendingDir,
+	}, nil
+}
+
+// Add creates a new pending document from the given attachments
+func (s *Store) Add(doc Document, attachments []Attachment) (*Document, error) {
+	if len(attachments) == 0 {
+		return nil, fmt.Errorf("document has no files")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc.ID = newID()
+	doc.ReceivedAt = time.Now()
+	doc.Files = nil
+	doc.Version = 1
+
+	docDir := filepath.Join(s.dir, doc.ID)
+	if err := os.MkdirAll(docDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create document directory: %v", err)
+	}
+
+	for i, a := range attachments {
+		name := safeName(a.Name, i)
+		if err := os.WriteFile(filepath.Join(docDir, name), a.Data, 0644); err != nil {
+			os.RemoveAll(docDir)
+			return nil, fmt.Errorf("failed to store %s: %v", name, err)
+		}
+		doc.Files = append(doc.Files, File{Name: name, ContentType: a.ContentType, Size: int64(len(a.Data))})
+	}
+
+	if err := s.writeDocument(doc); err != nil {
+		os.RemoveAll(docDir)
+		return nil, err
+	}
+
+	s.logger.Infof("Pending: Received document %s from %s via %s (%d files)", doc.ID, doc.Sender, doc.Source, len(doc.Files))
+	return &doc, nil
+}
+
+// List returns all pending documents, oldest first
+func (s *Store) List() ([]Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []Document
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		doc, err := s.readDocument(entry.Name())
+		if err != nil {
+			s.logger.Warnf("Pending: Skipping %s: %v", entry.Name(), err)
+			continue
+		}
+		docs = append(docs, *doc)
+	}
+
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ReceivedAt.Before(docs[j].ReceivedAt) })
+	return docs, nil
+}
+
+// Get returns one pending document
+func (s *Store) Get(id string) (*Document, error) {
+	if err := validateID(id); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readDocument(id)
+}
+
+// FilePath returns the path of a file of a pending document
+func (s *Store) FilePath(id string, filename string) (string, error) {
+	doc, err := s.Get(id)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range doc.Files {
+		if f.Name == filename {
+			return filepath.Join(s.dir, id, f.Name), nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+// Delete discards a pending document
+func (s *Store) Delete(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return os.RemoveAll(filepath.Join(s.dir, id))
+}
+
+// Claim moves a pending document into the scan batch in dir, the
+// workspace, so it can be sent with the normal workflow. PDF and TIFF pages
+// are converted to JPEG. The created file names are returned. Documents
+// locked by another operator cannot be claimed.
+func (s *Store) Claim(id string, operator string, dir string) ([]string, error) {
+	doc, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkLock(doc, strings.TrimSpace(operator), false); err != nil {
+		return nil, err
+	}
+
+	docDir := filepath.Join(s.dir, id)
+	var created []string
+	for i, f := range doc.Files {
+		src := filepath.Join(docDir, f.Name)
+		prefix := fmt.Sprintf("pending_%s_%02d", id, i+1)
+
+		names, err := s.renderPages(src, dir, prefix)
+		if err != nil {
+			// Undo the pages already moved so the document can be claimed again
+			for _, name := range created {
+				os.Remove(filepath.Join(dir, name))
+			}
+			return nil, fmt.Errorf("failed to claim %s: %v", f.Name, err)
+		}
+		created = append(created, names...)
+	}
+
+	if err := os.RemoveAll(docDir); err != nil {
+		s.logger.Warnf("Pending: Failed to remove claimed document %s: %v", id, err)
+	}
+
+	s.logger.Infof("Pending: Document %s claimed into the scan batch (%d pages)", id, len(created))
+	return created, nil
+}
+
+func (s *Store) readDocument(id string) (*Document, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, id, metadataFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid document metadata: %v", err)
+	}
+	return &doc, nil
+}
+
+func (s *Store) writeDocument(doc Document) error {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.dir, doc.ID, metadataFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write document metadata: %v", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func newID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%x", time.Now().Format("20060102-150405"), b)
+}
+
+func validateID(id string) error {
+	if id == "" || strings.Trim(id, "0123456789abcdef-") != "" {
+		return fmt.Errorf("invalid pending document id '%s'", id)
+	}
+	return nil
+}
+
+// safeName strips any directory part from a sender supplied file name and
+// prefixes the position so attachments with the same name do not collide
+func safeName(name string, index int) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == ".." || name == "/" {
+		name = "file"
+	}
+	return fmt.Sprintf("%02d_%s", index+1, name)
+}
@@ -0,0 +1,156 @@
+package pending
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"DICOMScanStation/separate"
+)
+
+// Split breaks a pending document into one document per section between
+// separator pages, e.g. for bulk back-scanning where many patients' records
+// arrive as one large PDF or TIFF. Separator pages are dropped. If no
+// separator is found, the document is returned unchanged.
+func (s *Store) Split(id string, opts separate.Options) ([]Document, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if !opts.Enabled() {
+		return nil, fmt.Errorf("no separation rules selected")
+	}
+
+	doc, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	workDir, err := os.MkdirTemp("", "dss-split-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+
+	var pages []string
+	for i, f := range doc.Files {
+		names, err := s.renderPages(filepath.Join(s.dir, id, f.Name), workDir, fmt.Sprintf("file%02d", i+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", f.Name, err)
+		}
+		pages = append(pages, names...)
+	}
+
+	// Group the pages between separators
+	type section struct {
+		pages   []string
+		barcode string
+	}
+	var sections []section
+	current := section{}
+	separators := 0
+	for i, page := range pages {
+		result, err := classifyPage(filepath.Join(workDir, page), opts)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %v", i+1, err)
+		}
+		if !result.Separator {
+			current.pages = append(current.pages, page)
+			continue
+		}
+
+		separators++
+		s.logger.Debugf("Pending: Page %d of %s is a separator (%s)", i+1, id, result.Rule)
+		if len(current.pages) > 0 {
+			sections = append(sections, current)
+			current = section{}
+		}
+		if result.Barcode != "" {
+			current.barcode = result.Barcode
+		}
+	}
+	if len(current.pages) > 0 {
+		sections = append(sections, current)
+	}
+
+	if separators == 0 {
+		return []Document{*doc}, nil
+	}
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("document %s contains only separator pages", id)
+	}
+
+	var created []Document
+	for n, sec := range sections {
+		part := Document{
+			Source:   doc.Source,
+			Sender:   doc.Sender,
+			Title:    fmt.Sprintf("%s (%d/%d)", doc.Title, n+1, len(sections)),
+			Metadata: map[string]string{},
+		}
+		for k, v := range doc.Metadata {
+			part.Metadata[k] = v
+		}
+		part.Metadata["splitFrom"] = id
+		part.Metadata["section"] = strconv.Itoa(n + 1)
+		if sec.barcode != "" {
+			part.Metadata["barcode"] = sec.barcode
+		}
+
+		var attachments []Attachment
+		for i, page := range sec.pages {
+			data, err := os.ReadFile(filepath.Join(workDir, page))
+			if err == nil {
+				ext, contentType := ".jpg", "image/jpeg"
+				if filepath.Ext(page) == ".png" {
+					ext, contentType = ".png", "image/png"
+				}
+				attachments = append(attachments, Attachment{
+					Name:        fmt.Sprintf("page_%03d%s", i+1, ext),
+					ContentType: contentType,
+					Data:        data,
+				})
+				continue
+			}
+			s.rollbackSplit(created)
+			return nil, err
+		}
+
+		added, err := s.Add(part, attachments)
+		if err != nil {
+			s.rollbackSplit(created)
+			return nil, err
+		}
+		created = append(created, *added)
+	}
+
+	if err := s.Delete(id); err != nil {
+		s.logger.Warnf("Pending: Failed to remove split document %s: %v", id, err)
+	}
+
+	s.logger.Infof("Pending: Split document %s into %d documents at %d separator pages", id, len(created), separators)
+	return created, nil
+}
+
+func (s *Store) rollbackSplit(created []Document) {
+	for _, d := range created {
+		s.Delete(d.ID)
+	}
+}
+
+func classifyPage(path string, opts separate.Options) (separate.Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return separate.Result{}, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return separate.Result{}, err
+	}
+	return separate.Classify(img, opts), nil
+}
@@ -0,0 +1,121 @@
+// Package preferences stores small per-user settings so shared kiosks feel
+// personal after the operator signs in.
+package preferences
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"DICOMScanStation/config"
+)
+
+const preferencesFile = "preferences.json"
+
+// maxValueLength keeps accidental or abusive input out of the state file
+const maxValueLength = 256
+
+// Preferences are the settings remembered for one user
+type Preferences struct {
+	DefaultScanner   string    `json:"defaultScanner"`
+	DefaultProfile   string    `json:"defaultProfile"`
+	Language         string    `json:"language"`
+	LastDocumentType string    `json:"lastDocumentType"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+func (p Preferences) validate() error {
+	for name, value := range map[string]string{
+		"defaultScanner":   p.DefaultScanner,
+		"defaultProfile":   p.DefaultProfile,
+		"language":         p.Language,
+		"lastDocumentType": p.LastDocumentType,
+	} {
+		if len(value) > maxValueLength {
+			return fmt.Errorf("%s is too long", name)
+		}
+	}
+	return nil
+}
+
+// Store keeps the preferences of all users in one JSON file
+type Store struct {
+	path  string
+	mu    sync.Mutex
+	users map[string]Preferences
+}
+
+func NewStore(cfg *config.Config) (*Store, error) {
+	s := &Store{
+		path:  filepath.Join(cfg.StateDir, preferencesFile),
+		users: make(map[string]Preferences),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err == nil {
+		if err := json.Unmarshal(data, &s.users); err != nil {
+			return nil, fmt.Errorf("invalid preferences file: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get returns the preferences of a user; unknown users get empty preferences
+func (s *Store) Get(user string) Preferences {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.users[user]
+}
+
+// Put replaces the preferences of a user
+func (s *Store) Put(user string, prefs Preferences) (Preferences, error) {
+	if err := prefs.validate(); err != nil {
+		return Preferences{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefs.UpdatedAt = time.Now()
+	s.users[user] = prefs
+	return prefs, s.save()
+}
+
+// SetLastDocumentType remembers the document type a user sent last
+func (s *Store) SetLastDocumentType(user string, documentType string) error {
+	if len(documentType) > maxValueLength {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefs := s.users[user]
+	if prefs.LastDocumentType == documentType {
+		return nil
+	}
+	prefs.LastDocumentType = documentType
+	prefs.UpdatedAt = time.Now()
+	s.users[user] = prefs
+	return s.save()
+}
+
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.users, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write preferences: %v", err)
+	}
+	return os.Rename(tmp, s.path)
+}
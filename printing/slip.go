@@ -0,0 +1,80 @@
+// Package printing prints confirmation slips that are stapled to the paper
+// original before it is filed.
+package printing
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"DICOMScanStation/config"
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/ipp"
+	"DICOMScanStation/logging"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SlipPrinter prints a confirmation slip for every successfully sent study
+type SlipPrinter struct {
+	config *config.Config
+	client *ipp.Client
+	logger *logrus.Logger
+}
+
+func NewSlipPrinter(cfg *config.Config) *SlipPrinter {
+	return &SlipPrinter{
+		config: cfg,
+		client: ipp.NewClient(cfg.PrinterURI, time.Duration(cfg.PrintTimeout)*time.Second),
+		logger: logging.New(),
+	}
+}
+
+// StudySent implements dicom.SendObserver. Printing runs in the background
+// so a slow or offline printer never delays the upload response.
+func (p *SlipPrinter) StudySent(result dicom.StudyResult) {
+	if !result.Succeeded() {
+		return
+	}
+	go func() {
+		if err := p.Print(result); err != nil {
+			p.logger.Warnf("Printing: Failed to print confirmation slip for study %s: %v", result.Study.StudyInstanceUID, err)
+		}
+	}()
+}
+
+// Print sends the confirmation slip for result to the configured printer
+func (p *SlipPrinter) Print(result dicom.StudyResult) error {
+	jobName := "Scan confirmation " + result.Study.StudyID
+	jobID, err := p.client.PrintJob(jobName, "text/plain", []byte(FormatSlip(p.config.DicomStationName, result)))
+	if err != nil {
+		return err
+	}
+	p.logger.Infof("Printing: Confirmation slip for study %s queued as job %d", result.Study.StudyInstanceUID, jobID)
+	return nil
+}
+
+// FormatSlip renders the slip as plain text for narrow label printers
+func FormatSlip(stationName string, result dicom.StudyResult) string {
+	patient := result.Request.Patient
+	var b strings.Builder
+	line := strings.Repeat("-", 32)
+
+	fmt.Fprintf(&b, "%s\n", stationName)
+	fmt.Fprintf(&b, "Scan confirmation\n%s\n", line)
+	fmt.Fprintf(&b, "Patient:  %s\n", patient.Name)
+	fmt.Fprintf(&b, "ID:       %s\n", patient.PatientID)
+	if patient.BirthDate != "" {
+		fmt.Fprintf(&b, "Born:     %s\n", patient.BirthDate)
+	}
+	if result.Request.Description != "" {
+		fmt.Fprintf(&b, "Document: %s\n", result.Request.Description)
+	}
+	if result.Request.DocumentCreator != "" {
+		fmt.Fprintf(&b, "Creator:  %s\n", result.Request.DocumentCreator)
+	}
+	fmt.Fprintf(&b, "Pages:    %d\n", result.Completed)
+	fmt.Fprintf(&b, "Sent:     %s\n", result.FinishedAt.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, "%s\nStudy UID:\n%s\n", line, result.Study.StudyInstanceUID)
+	return b.String()
+}
@@ -0,0 +1,196 @@
+// Package profiles keeps named scan presets, e.g. "Consent 200dpi gray
+// duplex", so operators pick a profile instead of setting every scan option.
+package profiles
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"DICOMScanStation/config"
+	"DICOMScanStation/scanner"
+)
+
+const profilesFile = "scan-profiles.json"
+
+// maxNameLength keeps profile names readable in the scan options
+const maxNameLength = 100
+
+var (
+	ErrNotFound  = errors.New("scan profile not found")
+	ErrDuplicate = errors.New("a scan profile with this name already exists")
+)
+
+// Profile is a named set of scan options
+type Profile struct {
+	ID        string              `json:"id"`
+	Name      string              `json:"name"`
+	Options   scanner.ScanOptions `json:"options"`
+	CreatedAt time.Time           `json:"createdAt"`
+	UpdatedAt time.Time           `json:"updatedAt"`
+}
+
+func (p *Profile) validate() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(p.Name) > maxNameLength {
+		return fmt.Errorf("name is too long")
+	}
+	// A profile is for real scans, previews take their own options
+	p.Options.Preview = false
+	if p.Options.Resolution < 0 {
+		return fmt.Errorf("resolution must not be negative")
+	}
+	if p.Options.Quality < 0 || p.Options.Quality > 100 {
+		return fmt.Errorf("quality must be between 1 and 100")
+	}
+	if err := scanner.ValidateSANEOptions(p.Options.SANEOptions); err != nil {
+		return err
+	}
+	if err := scanner.ValidateGeometry(&p.Options); err != nil {
+		return err
+	}
+	return scanner.ValidateAdjustments(&p.Options)
+}
+
+// Store keeps the profiles in one JSON file in STATE_DIR
+type Store struct {
+	path     string
+	mu       sync.Mutex
+	profiles map[string]Profile
+}
+
+func NewStore(cfg *config.Config) (*Store, error) {
+	s := &Store{
+		path:     filepath.Join(cfg.StateDir, profilesFile),
+		profiles: make(map[string]Profile),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err == nil {
+		if err := json.Unmarshal(data, &s.profiles); err != nil {
+			return nil, fmt.Errorf("invalid scan profiles file: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return s, nil
+}
+
+// List returns the profiles sorted by name
+func (s *Store) List() []Profile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Profile, 0, len(s.profiles))
+	for _, p := range s.profiles {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name)
+	})
+	return list
+}
+
+// Get returns a profile by ID
+func (s *Store) Get(id string) (Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.profiles[id]
+	if !ok {
+		return Profile{}, ErrNotFound
+	}
+	return p, nil
+}
+
+// Create adds a profile under a new ID
+func (s *Store) Create(p Profile) (Profile, error) {
+	if err := p.validate(); err != nil {
+		return Profile{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nameTaken(p.Name, "") {
+		return Profile{}, ErrDuplicate
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	p.ID = hex.EncodeToString(b)
+	p.CreatedAt = time.Now()
+	p.UpdatedAt = p.CreatedAt
+	s.profiles[p.ID] = p
+	return p, s.save()
+}
+
+// Update replaces the name and options of a profile
+func (s *Store) Update(id string, p Profile) (Profile, error) {
+	if err := p.validate(); err != nil {
+		return Profile{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.profiles[id]
+	if !ok {
+		return Profile{}, ErrNotFound
+	}
+	if s.nameTaken(p.Name, id) {
+		return Profile{}, ErrDuplicate
+	}
+	existing.Name = p.Name
+	existing.Options = p.Options
+	existing.UpdatedAt = time.Now()
+	s.profiles[id] = existing
+	return existing, s.save()
+}
+
+// Delete removes a profile
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.profiles[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.profiles, id)
+	return s.save()
+}
+
+// nameTaken reports whether another profile than except has the name
+func (s *Store) nameTaken(name string, except string) bool {
+	for id, p := range s.profiles {
+		if id != except && strings.EqualFold(p.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write scan profiles: %v", err)
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,271 @@
+package qrcode
+
+type matrix struct {
+	version    int
+	size       int
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+func newMatrix(version int) *matrix {
+	size := 17 + 4*version
+	m := &matrix{version: version, size: size}
+	m.modules = make([][]bool, size)
+	m.isFunction = make([][]bool, size)
+	for i := range m.modules {
+		m.modules[i] = make([]bool, size)
+		m.isFunction[i] = make([]bool, size)
+	}
+	return m
+}
+
+func (m *matrix) setFunction(x, y int, dark bool) {
+	m.modules[y][x] = dark
+	m.isFunction[y][x] = true
+}
+
+func (m *matrix) drawFunctionPatterns(info versionInfo) {
+	// Timing patterns
+	for i := 0; i < m.size; i++ {
+		m.setFunction(6, i, i%2 == 0)
+		m.setFunction(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with separators
+	m.drawFinder(3, 3)
+	m.drawFinder(m.size-4, 3)
+	m.drawFinder(3, m.size-4)
+
+	// Alignment patterns, skipping the three finder corners
+	n := len(info.alignment)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+				continue
+			}
+			m.drawAlignment(info.alignment[i], info.alignment[j])
+		}
+	}
+
+	// Reserve the format areas, real bits are drawn after masking
+	m.drawFormatBits(0)
+	m.drawVersion()
+}
+
+func (m *matrix) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || y < 0 || x >= m.size || y >= m.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			m.setFunction(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (m *matrix) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			m.setFunction(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits writes the 15 bit format information for level M
+func (m *matrix) drawFormatBits(mask int) {
+	data := 0<<3 | mask // level M is encoded as 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>uint(i))&1 != 0 }
+
+	// First copy around the top left finder
+	for i := 0; i <= 5; i++ {
+		m.setFunction(8, i, bit(i))
+	}
+	m.setFunction(8, 7, bit(6))
+	m.setFunction(8, 8, bit(7))
+	m.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		m.setFunction(14-i, 8, bit(i))
+	}
+
+	// Second copy split between top right and bottom left
+	for i := 0; i < 8; i++ {
+		m.setFunction(m.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		m.setFunction(8, m.size-15+i, bit(i))
+	}
+	m.setFunction(8, m.size-8, true) // dark module
+}
+
+// drawVersion writes the version information blocks for versions 7 and up
+func (m *matrix) drawVersion() {
+	if m.version < 7 {
+		return
+	}
+	rem := m.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := m.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := (bits>>uint(i))&1 != 0
+		a := m.size - 11 + i%3
+		b := i / 3
+		m.setFunction(a, b, dark)
+		m.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords places the data in the zigzag pattern
+func (m *matrix) drawCodewords(data []byte) {
+	i := 0
+	for right := m.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < m.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				upward := (right+1)&2 == 0
+				y := vert
+				if upward {
+					y = m.size - 1 - vert
+				}
+				if m.isFunction[y][x] || i >= len(data)*8 {
+					continue
+				}
+				m.modules[y][x] = (data[i>>3]>>uint(7-i&7))&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+func (m *matrix) applyMask(mask int) {
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if m.isFunction[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				m.modules[y][x] = !m.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol according to the four QR masking rules
+func (m *matrix) penalty() int {
+	score := 0
+	get := func(x, y int, vertical bool) bool {
+		if vertical {
+			return m.modules[x][y]
+		}
+		return m.modules[y][x]
+	}
+
+	for _, vertical := range []bool{false, true} {
+		for y := 0; y < m.size; y++ {
+			// Rule 1: runs of five or more modules of the same color
+			run := 1
+			for x := 1; x < m.size; x++ {
+				if get(x, y, vertical) == get(x-1, y, vertical) {
+					run++
+					if run == 5 {
+						score += 3
+					} else if run > 5 {
+						score++
+					}
+				} else {
+					run = 1
+				}
+			}
+
+			// Rule 3: finder-like 1:1:3:1:1 patterns with four light modules
+			for x := 0; x+10 < m.size; x++ {
+				if matchesFinderLike(func(i int) bool { return get(x+i, y, vertical) }) {
+					score += 40
+				}
+			}
+		}
+	}
+
+	// Rule 2: 2x2 blocks of the same color
+	for y := 0; y < m.size-1; y++ {
+		for x := 0; x < m.size-1; x++ {
+			c := m.modules[y][x]
+			if c == m.modules[y][x+1] && c == m.modules[y+1][x] && c == m.modules[y+1][x+1] {
+				score += 3
+			}
+		}
+	}
+
+	// Rule 4: balance of dark and light modules
+	dark := 0
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if m.modules[y][x] {
+				dark++
+			}
+		}
+	}
+	total := m.size * m.size
+	deviation := abs(dark*20-total*10) / total
+	score += deviation * 10
+
+	return score
+}
+
+func matchesFinderLike(at func(i int) bool) bool {
+	pattern := []bool{true, false, true, true, true, false, true}
+	light := func(from int) bool {
+		for i := from; i < from+4; i++ {
+			if at(i) {
+				return false
+			}
+		}
+		return true
+	}
+	matches := func(from int) bool {
+		for i, p := range pattern {
+			if at(from+i) != p {
+				return false
+			}
+		}
+		return true
+	}
+	return (matches(0) && light(7)) || (light(0) && matches(4))
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
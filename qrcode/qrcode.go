@@ -0,0 +1,184 @@
+// Package qrcode implements a minimal QR code encoder (byte mode, error
+// correction level M, versions 1 to 10) sufficient for short URLs.
+package qrcode
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+var ErrTooLong = errors.New("qrcode: data too long")
+
+// versionInfo describes the error correction block structure for level M
+type versionInfo struct {
+	ecPerBlock int
+	blocks     []int // data codewords per block
+	alignment  []int
+}
+
+var versions = []versionInfo{
+	1:  {10, []int{16}, nil},
+	2:  {16, []int{28}, []int{6, 18}},
+	3:  {26, []int{44}, []int{6, 22}},
+	4:  {18, []int{32, 32}, []int{6, 26}},
+	5:  {24, []int{43, 43}, []int{6, 30}},
+	6:  {16, []int{27, 27, 27, 27}, []int{6, 34}},
+	7:  {18, []int{31, 31, 31, 31}, []int{6, 22, 38}},
+	8:  {22, []int{38, 38, 39, 39}, []int{6, 24, 42}},
+	9:  {22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}},
+	10: {26, []int{43, 43, 43, 43, 44}, []int{6, 28, 50}},
+}
+
+func (v versionInfo) dataCodewords() int {
+	total := 0
+	for _, n := range v.blocks {
+		total += n
+	}
+	return total
+}
+
+// Code is an encoded QR symbol
+type Code struct {
+	Size    int
+	modules [][]bool
+}
+
+// Dark reports whether the module at column x, row y is dark
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// Encode encodes data in byte mode using the smallest fitting version
+func Encode(data []byte) (*Code, error) {
+	for version := 1; version < len(versions); version++ {
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+		capacityBits := versions[version].dataCodewords() * 8
+		if 4+countBits+len(data)*8 <= capacityBits {
+			return encodeVersion(data, version, countBits), nil
+		}
+	}
+	return nil, ErrTooLong
+}
+
+func encodeVersion(data []byte, version int, countBits int) *Code {
+	info := versions[version]
+
+	// Build the data bit stream: mode, length, payload, terminator, padding
+	var bb bitBuffer
+	bb.append(0x4, 4)
+	bb.append(len(data), countBits)
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+	capacity := info.dataCodewords() * 8
+	terminator := capacity - len(bb)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bb.append(0, terminator)
+	bb.append(0, (8-len(bb)%8)%8)
+	codewords := bb.bytes()
+	for pad := byte(0xEC); len(codewords) < info.dataCodewords(); pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+
+	// Split into blocks, compute error correction and interleave
+	generator := rsGenerator(info.ecPerBlock)
+	var dataBlocks, ecBlocks [][]byte
+	offset := 0
+	for _, n := range info.blocks {
+		block := codewords[offset : offset+n]
+		offset += n
+		dataBlocks = append(dataBlocks, block)
+		ecBlocks = append(ecBlocks, rsRemainder(block, generator))
+	}
+
+	var final []byte
+	maxData := info.blocks[len(info.blocks)-1]
+	for i := 0; i < maxData; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				final = append(final, block[i])
+			}
+		}
+	}
+	for i := 0; i < info.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			final = append(final, block[i])
+		}
+	}
+
+	m := newMatrix(version)
+	m.drawFunctionPatterns(info)
+	m.drawCodewords(final)
+
+	// Pick the mask with the lowest penalty
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		m.applyMask(mask)
+		m.drawFormatBits(mask)
+		penalty := m.penalty()
+		if bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		m.applyMask(mask) // masking is an XOR, applying twice undoes it
+	}
+	m.applyMask(bestMask)
+	m.drawFormatBits(bestMask)
+
+	return &Code{Size: m.size, modules: m.modules}
+}
+
+// Image renders the code with the given module size and a 4 module quiet zone
+func (c *Code) Image(scale int) image.Image {
+	if scale < 1 {
+		scale = 1
+	}
+	const quiet = 4
+	dim := (c.Size + 2*quiet) * scale
+	img := image.NewGray(image.Rect(0, 0, dim, dim))
+	for y := 0; y < dim; y++ {
+		for x := 0; x < dim; x++ {
+			mx, my := x/scale-quiet, y/scale-quiet
+			if mx >= 0 && my >= 0 && mx < c.Size && my < c.Size && c.modules[my][mx] {
+				img.SetGray(x, y, color.Gray{Y: 0})
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return img
+}
+
+// WritePNG encodes data and writes the symbol as PNG
+func WritePNG(w io.Writer, data []byte, scale int) error {
+	code, err := Encode(data)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, code.Image(scale))
+}
+
+type bitBuffer []bool
+
+func (bb *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*bb = append(*bb, (value>>uint(i))&1 != 0)
+	}
+}
+
+func (bb bitBuffer) bytes() []byte {
+	out := make([]byte, len(bb)/8)
+	for i, bit := range bb {
+		if bit {
+			out[i/8] |= 1 << uint(7-i%8)
+		}
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package qrcode
+
+// Reed-Solomon arithmetic over GF(256) with the QR polynomial 0x11D
+
+func gfMultiply(x, y byte) byte {
+	var z byte
+	for i := 7; i >= 0; i-- {
+		// Multiply z by x^1 modulo the field polynomial
+		if z&0x80 != 0 {
+			z = (z << 1) ^ 0x1D
+		} else {
+			z <<= 1
+		}
+		if (y>>uint(i))&1 != 0 {
+			z ^= x
+		}
+	}
+	return z
+}
+
+// rsGenerator returns the coefficients of the generator polynomial of the
+// given degree, highest power first, without the leading 1
+func rsGenerator(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := 0; j < degree; j++ {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder computes the error correction codewords for data
+func rsRemainder(data []byte, generator []byte) []byte {
+	result := make([]byte, len(generator))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range generator {
+			result[i] ^= gfMultiply(coef, factor)
+		}
+	}
+	return result
+}
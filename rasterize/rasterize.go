@@ -0,0 +1,38 @@
+// Package rasterize renders PDF documents to page images, so they can go
+// through the same workflow as scanned paper.
+package rasterize
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+// PDF renders every page of a PDF to a JPEG in dir using pdftoppm from
+// poppler-utils, found in popplerPath, and returns the file names in page
+// order
+func PDF(popplerPath string, dpi int, pdfPath string, dir string, prefix string) ([]string, error) {
+	cmd := exec.Command(filepath.Join(popplerPath, "pdftoppm"),
+		"-jpeg",
+		"-r", fmt.Sprintf("%d", dpi),
+		pdfPath,
+		filepath.Join(dir, prefix),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("pdftoppm failed: %v, output: %s", err, string(output))
+	}
+
+	// pdftoppm pads the page numbers to the same width, so they sort
+	matches, err := filepath.Glob(filepath.Join(dir, prefix+"-*.jpg"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = filepath.Base(m)
+	}
+	return names, nil
+}
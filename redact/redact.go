@@ -0,0 +1,129 @@
+// Package redact blacks out regions of scanned pages, e.g. information about
+// third parties that must not reach the archive.
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"strings"
+
+	"DICOMScanStation/colorprofile"
+)
+
+var ErrInvalidBox = errors.New("invalid redaction box")
+
+// Box is a rectangle in image pixels, or in fractions of the image size
+// (0..1) when applied with relative coordinates
+type Box struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Apply fills the boxes with black and rewrites the image in place. The
+// image is re-encoded from the redacted pixels, so no metadata such as EXIF
+// thumbnails survives except the ICC profile. It returns the boxes in
+// pixels as applied.
+func Apply(path string, boxes []Box, relative bool) ([]image.Rectangle, error) {
+	if len(boxes) == 0 {
+		return nil, fmt.Errorf("%w: no boxes given", ErrInvalidBox)
+	}
+
+	profile, _ := colorprofile.Extract(path)
+
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	img, format, err := image.Decode(in)
+	in.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	bounds := img.Bounds()
+	rects := make([]image.Rectangle, 0, len(boxes))
+	for i, b := range boxes {
+		r, err := toRect(b, bounds, relative)
+		if err != nil {
+			return nil, fmt.Errorf("box %d: %w", i+1, err)
+		}
+		rects = append(rects, r)
+	}
+
+	out := image.NewRGBA(bounds)
+	draw.Draw(out, bounds, img, bounds.Min, draw.Src)
+	for _, r := range rects {
+		draw.Draw(out, r, image.NewUniform(color.Black), image.Point{}, draw.Src)
+	}
+
+	tmp := path + ".redact.tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case "png":
+		err = png.Encode(f, out)
+	case "jpeg":
+		err = jpeg.Encode(f, out, &jpeg.Options{Quality: 95})
+	default:
+		err = fmt.Errorf("unsupported image format '%s'", format)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && len(profile) > 0 {
+		err = colorprofile.EmbedFile(tmp, profile)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	return rects, nil
+}
+
+// toRect converts a box to pixels and clips it to the image. Boxes outside
+// the image are rejected rather than silently ignored.
+func toRect(b Box, bounds image.Rectangle, relative bool) (image.Rectangle, error) {
+	if b.Width <= 0 || b.Height <= 0 || b.X < 0 || b.Y < 0 {
+		return image.Rectangle{}, ErrInvalidBox
+	}
+	x, y, w, h := b.X, b.Y, b.Width, b.Height
+	if relative {
+		if x > 1 || y > 1 || w > 1 || h > 1 {
+			return image.Rectangle{}, fmt.Errorf("%w: relative coordinates must be between 0 and 1", ErrInvalidBox)
+		}
+		dx, dy := float64(bounds.Dx()), float64(bounds.Dy())
+		x, y, w, h = x*dx, y*dy, w*dx, h*dy
+	}
+
+	// Round outwards so that nothing at the edges stays visible
+	r := image.Rect(int(x), int(y), int(x+w+0.999), int(y+h+0.999)).Add(bounds.Min)
+	r = r.Intersect(bounds)
+	if r.Empty() {
+		return image.Rectangle{}, fmt.Errorf("%w: box lies outside the image", ErrInvalidBox)
+	}
+	return r, nil
+}
+
+// Describe formats the applied boxes for the audit trail
+func Describe(rects []image.Rectangle) string {
+	parts := make([]string, len(rects))
+	for i, r := range rects {
+		parts[i] = fmt.Sprintf("%d,%d %dx%d", r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,102 @@
+package reports
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 in points
+const (
+	pageWidth  = 595
+	pageHeight = 842
+	margin     = 50
+)
+
+// textPDF writes plain lines of text in a monospaced font, adding pages as
+// needed. It is just enough PDF for tabular reports without a dependency.
+type textPDF struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func newTextPDF() *textPDF {
+	p := &textPDF{}
+	p.newPage()
+	return p
+}
+
+func (p *textPDF) newPage() {
+	p.pages = append(p.pages, &bytes.Buffer{})
+	p.y = pageHeight - margin
+}
+
+// Line adds a line of text with the given font size
+func (p *textPDF) Line(text string, size float64) {
+	leading := size * 1.4
+	if p.y-leading < margin {
+		p.newPage()
+	}
+	p.y -= leading
+	if text == "" {
+		return
+	}
+	fmt.Fprintf(p.pages[len(p.pages)-1], "BT /F1 %.1f Tf %d %.1f Td (%s) Tj ET\n", size, margin, p.y, escapePDF(text))
+}
+
+// Write serializes the document. Object numbers: 1 catalog, 2 page tree,
+// 3 font, then a page and a content stream object per page.
+func (p *textPDF) Write(w io.Writer) error {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+
+	var kids []string
+	for i := range p.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 4+2*i))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	for i, content := range p.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 5+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// escapePDF encodes text as a WinAnsi string literal; characters outside
+// Latin-1 are replaced
+func escapePDF(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7F:
+			b.WriteRune(r)
+		case r >= 0xA0 && r <= 0xFF:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,148 @@
+// Package reports aggregates the upload history into summaries for team
+// leads.
+package reports
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"DICOMScanStation/history"
+)
+
+// UnknownOperator is reported for uploads without an operator name
+const UnknownOperator = "(unknown)"
+
+// OperatorSummary is one row of the shift report
+type OperatorSummary struct {
+	Operator  string `json:"operator"`
+	Documents int    `json:"documents"`
+	Pages     int    `json:"pages"`
+	Failures  int    `json:"failures"`
+	// AverageHandlingSeconds covers successful documents only
+	AverageHandlingSeconds float64 `json:"averageHandlingSeconds"`
+}
+
+// ShiftReport summarizes the uploads of all operators in [From, To)
+type ShiftReport struct {
+	From        time.Time         `json:"from"`
+	To          time.Time         `json:"to"`
+	GeneratedAt time.Time         `json:"generatedAt"`
+	Operators   []OperatorSummary `json:"operators"`
+	Total       OperatorSummary   `json:"total"`
+}
+
+// Shift builds the report from history entries. A document counts as sent
+// when all pages were stored; partial, failed and quarantined uploads count
+// as failures.
+func Shift(entries []history.Entry, from, to time.Time) *ShiftReport {
+	type totals struct {
+		summary  OperatorSummary
+		handling time.Duration
+	}
+
+	byOperator := make(map[string]*totals)
+	var all totals
+	for _, e := range entries {
+		name := e.Operator
+		if name == "" {
+			name = UnknownOperator
+		}
+		t, ok := byOperator[name]
+		if !ok {
+			t = &totals{summary: OperatorSummary{Operator: name}}
+			byOperator[name] = t
+		}
+
+		for _, acc := range []*totals{t, &all} {
+			acc.summary.Pages += e.Pages
+			if e.Status == history.StatusCompleted {
+				acc.summary.Documents++
+				acc.handling += e.HandlingTime
+			} else {
+				acc.summary.Failures++
+			}
+		}
+	}
+
+	average := func(t *totals) OperatorSummary {
+		s := t.summary
+		if s.Documents > 0 {
+			s.AverageHandlingSeconds = (t.handling / time.Duration(s.Documents)).Round(time.Second).Seconds()
+		}
+		return s
+	}
+
+	report := &ShiftReport{
+		From:        from,
+		To:          to,
+		GeneratedAt: time.Now(),
+		Operators:   []OperatorSummary{},
+	}
+	for _, t := range byOperator {
+		report.Operators = append(report.Operators, average(t))
+	}
+	sort.Slice(report.Operators, func(i, j int) bool {
+		return report.Operators[i].Operator < report.Operators[j].Operator
+	})
+	all.summary.Operator = "Total"
+	report.Total = average(&all)
+	return report
+}
+
+// WriteCSV writes one row per operator followed by the total
+func (r *ShiftReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"operator", "documents", "pages", "failures", "average_handling_seconds"})
+	for _, s := range append(r.Operators, r.Total) {
+		cw.Write([]string{
+			s.Operator,
+			strconv.Itoa(s.Documents),
+			strconv.Itoa(s.Pages),
+			strconv.Itoa(s.Failures),
+			strconv.FormatFloat(s.AverageHandlingSeconds, 'f', 0, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WritePDF renders the report as a printable table
+func (r *ShiftReport) WritePDF(w io.Writer, title string) error {
+	doc := newTextPDF()
+	doc.Line(title, 16)
+	doc.Line(fmt.Sprintf("Shift report %s - %s", r.From.Format("2006-01-02 15:04"), r.To.Format("2006-01-02 15:04")), 11)
+	doc.Line(fmt.Sprintf("Generated %s", r.GeneratedAt.Format("2006-01-02 15:04")), 9)
+	doc.Line("", 11)
+
+	row := "%-30s %10s %8s %9s %14s"
+	doc.Line(fmt.Sprintf(row, "Operator", "Documents", "Pages", "Failures", "Avg. handling"), 10)
+	line := func(s OperatorSummary) {
+		doc.Line(fmt.Sprintf(row, truncate(s.Operator, 30), strconv.Itoa(s.Documents), strconv.Itoa(s.Pages),
+			strconv.Itoa(s.Failures), formatSeconds(s.AverageHandlingSeconds)), 10)
+	}
+	for _, s := range r.Operators {
+		line(s)
+	}
+	doc.Line("", 10)
+	line(r.Total)
+	return doc.Write(w)
+}
+
+func formatSeconds(seconds float64) string {
+	if seconds == 0 {
+		return "-"
+	}
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "~"
+}
@@ -0,0 +1,230 @@
+// Package reservation lets staff reserve a shared scanner for a short time
+// and queue for it, so one long batch job does not monopolize the device
+// without others knowing when it frees up.
+package reservation
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// queueTimeout drops waiting entries whose holder stopped asking for the
+// device, e.g. because the browser was closed
+const queueTimeout = 2 * time.Minute
+
+var ErrNoHolder = errors.New("holder is required")
+
+// Reservation is the current holder of a device
+type Reservation struct {
+	Holder  string    `json:"holder"`
+	Since   time.Time `json:"since"`
+	Expires time.Time `json:"expires"`
+}
+
+// Waiting is a holder queued for a device
+type Waiting struct {
+	Holder      string        `json:"holder"`
+	RequestedAt time.Time     `json:"requestedAt"`
+	TTL         time.Duration `json:"-"`
+	lastSeen    time.Time
+}
+
+// Status describes a device from the point of view of one holder
+type Status struct {
+	Device      string       `json:"device"`
+	Reservation *Reservation `json:"reservation,omitempty"`
+	// Granted is true if the holder owns the current reservation
+	Granted bool `json:"granted"`
+	// Position is the holder's place in the queue, starting at 1; 0 if
+	// the holder is not waiting
+	Position int `json:"position,omitempty"`
+	Queue    int `json:"queue"`
+	// AvailableAt estimates when the device is free for the holder (or for
+	// a newcomer, if the holder is not queued)
+	AvailableAt *time.Time `json:"availableAt,omitempty"`
+}
+
+type device struct {
+	current *Reservation
+	queue   []*Waiting
+}
+
+// Board tracks reservations of all devices in memory
+type Board struct {
+	maxTTL     time.Duration
+	defaultTTL time.Duration
+
+	mu      sync.Mutex
+	devices map[string]*device
+}
+
+// NewBoard creates a board; requested durations are capped at maxTTL
+func NewBoard(defaultTTL, maxTTL time.Duration) *Board {
+	if maxTTL < defaultTTL {
+		defaultTTL = maxTTL
+	}
+	return &Board{
+		maxTTL:     maxTTL,
+		defaultTTL: defaultTTL,
+		devices:    make(map[string]*device),
+	}
+}
+
+// Reserve grants the device to holder if it is free, extends the holder's
+// reservation, or queues the holder. Asking again while queued keeps the
+// place in the queue.
+func (b *Board) Reserve(dev string, holder string, ttl time.Duration) (Status, error) {
+	if holder == "" {
+		return Status{}, ErrNoHolder
+	}
+	if ttl <= 0 {
+		ttl = b.defaultTTL
+	}
+	if ttl > b.maxTTL {
+		ttl = b.maxTTL
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	d := b.device(dev, now)
+	switch {
+	case d.current != nil && d.current.Holder == holder:
+		d.current.Expires = now.Add(ttl)
+	case d.current == nil && len(d.queue) == 0:
+		d.current = &Reservation{Holder: holder, Since: now, Expires: now.Add(ttl)}
+	default:
+		if w := d.waiting(holder); w != nil {
+			w.TTL = ttl
+			w.lastSeen = now
+		} else {
+			d.queue = append(d.queue, &Waiting{Holder: holder, RequestedAt: now, TTL: ttl, lastSeen: now})
+		}
+	}
+	return b.status(dev, d, holder, now), nil
+}
+
+// Release ends the holder's reservation or removes it from the queue
+func (b *Board) Release(dev string, holder string) Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	d := b.device(dev, now)
+	if d.current != nil && d.current.Holder == holder {
+		d.current = nil
+		d.promote(now)
+	}
+	for i, w := range d.queue {
+		if w.Holder == holder {
+			d.queue = append(d.queue[:i], d.queue[i+1:]...)
+			break
+		}
+	}
+	return b.status(dev, d, holder, now)
+}
+
+// Status returns the state of a device for holder. A queued holder that
+// asks keeps its place.
+func (b *Board) Status(dev string, holder string) Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	d := b.device(dev, now)
+	if w := d.waiting(holder); w != nil {
+		w.lastSeen = now
+	}
+	return b.status(dev, d, holder, now)
+}
+
+// CanUse reports whether holder may scan on the device now, i.e. the device
+// is not reserved or the holder owns the reservation. Otherwise the current
+// reservation is returned.
+func (b *Board) CanUse(dev string, holder string) (bool, *Reservation) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d := b.device(dev, time.Now())
+	if d.current == nil || (holder != "" && d.current.Holder == holder) {
+		return true, nil
+	}
+	r := *d.current
+	return false, &r
+}
+
+// device returns the state of dev with expired reservations and abandoned
+// queue entries removed. The caller must hold b.mu.
+func (b *Board) device(dev string, now time.Time) *device {
+	d, ok := b.devices[dev]
+	if !ok {
+		d = &device{}
+		b.devices[dev] = d
+	}
+
+	queue := d.queue[:0]
+	for _, w := range d.queue {
+		if now.Sub(w.lastSeen) < queueTimeout {
+			queue = append(queue, w)
+		}
+	}
+	d.queue = queue
+
+	if d.current != nil && now.After(d.current.Expires) {
+		d.current = nil
+	}
+	if d.current == nil {
+		d.promote(now)
+	}
+	return d
+}
+
+// promote hands the device to the first queued holder
+func (d *device) promote(now time.Time) {
+	if d.current != nil || len(d.queue) == 0 {
+		return
+	}
+	w := d.queue[0]
+	d.queue = d.queue[1:]
+	d.current = &Reservation{Holder: w.Holder, Since: now, Expires: now.Add(w.TTL)}
+}
+
+func (d *device) waiting(holder string) *Waiting {
+	for _, w := range d.queue {
+		if w.Holder == holder {
+			return w
+		}
+	}
+	return nil
+}
+
+func (b *Board) status(dev string, d *device, holder string, now time.Time) Status {
+	s := Status{Device: dev, Queue: len(d.queue)}
+	if d.current != nil {
+		r := *d.current
+		s.Reservation = &r
+		s.Granted = holder != "" && r.Holder == holder
+	}
+	if s.Granted {
+		return s
+	}
+
+	// Free once the current reservation and everyone ahead are done
+	available := now
+	if d.current != nil {
+		available = d.current.Expires
+	}
+	for i, w := range d.queue {
+		if w.Holder == holder {
+			s.Position = i + 1
+			break
+		}
+		available = available.Add(w.TTL)
+	}
+	if available.After(now) {
+		s.AvailableAt = &available
+	}
+	return s
+}
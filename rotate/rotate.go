@@ -0,0 +1,99 @@
+// Package rotate turns scanned pages by quarter turns, e.g. a page that was
+// fed upside down.
+package rotate
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+
+	"DICOMScanStation/colorprofile"
+)
+
+var ErrInvalidAngle = errors.New("rotation must be 90, 180 or 270 degrees")
+
+// Apply turns the image clockwise by degrees and rewrites it in place. Like
+// a redaction, the image is re-encoded and keeps only its ICC profile.
+func Apply(path string, degrees int) error {
+	if degrees != 90 && degrees != 180 && degrees != 270 {
+		return ErrInvalidAngle
+	}
+
+	profile, _ := colorprofile.Extract(path)
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	img, format, err := image.Decode(in)
+	in.Close()
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	out := turn(img, degrees)
+
+	tmp := path + ".rotate.tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "png":
+		err = png.Encode(f, out)
+	case "jpeg":
+		err = jpeg.Encode(f, out, &jpeg.Options{Quality: 95})
+	default:
+		err = fmt.Errorf("unsupported image format '%s'", format)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && len(profile) > 0 {
+		err = colorprofile.EmbedFile(tmp, profile)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// turn returns the image rotated clockwise by a quarter, half or three
+// quarter turn
+func turn(img image.Image, degrees int) *image.RGBA {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	sw, sh := b.Dx(), b.Dy()
+	w, h := sw, sh
+	if degrees != 180 {
+		w, h = sh, sw
+	}
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < sh; y++ {
+		for x := 0; x < sw; x++ {
+			var dx, dy int
+			switch degrees {
+			case 90:
+				dx, dy = sh-1-y, x
+			case 180:
+				dx, dy = sw-1-x, sh-1-y
+			case 270:
+				dx, dy = y, sw-1-x
+			}
+			copy(out.Pix[out.PixOffset(dx, dy):out.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package scanner
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// adjustments are the SANE options behind Brightness, Contrast and
+// Threshold
+var adjustments = []string{"brightness", "contrast", "threshold"}
+
+func adjustmentValue(options *ScanOptions, name string) int {
+	switch name {
+	case "brightness":
+		return options.Brightness
+	case "contrast":
+		return options.Contrast
+	default:
+		return options.Threshold
+	}
+}
+
+// ValidateAdjustments rejects brightness, contrast and threshold given both
+// as scan options and as SANE options
+func ValidateAdjustments(options *ScanOptions) error {
+	if options.Threshold < 0 {
+		return fmt.Errorf("threshold must not be negative")
+	}
+	for _, name := range adjustments {
+		if _, ok := options.SANEOptions[name]; ok && adjustmentValue(options, name) != 0 {
+			return fmt.Errorf("SANE option '%s' conflicts with the %s scan option", name, name)
+		}
+	}
+	return nil
+}
+
+// adjustmentArgs passes brightness and contrast, and the threshold of
+// lineart scans, to scanimage. Zero keeps the scanner's default. Values are
+// checked against the range the scanner advertises, if it is known.
+func (sm *ScannerManager) adjustmentArgs(device string, options *ScanOptions) ([]string, error) {
+	if err := ValidateAdjustments(options); err != nil {
+		return nil, err
+	}
+
+	advertised, known := sm.baselines.options(device)
+	var args []string
+	for _, name := range adjustments {
+		value := adjustmentValue(options, name)
+		if value == 0 || (name == "threshold" && !options.Lineart) {
+			continue
+		}
+		if known {
+			values, ok := advertised[name]
+			if !ok {
+				return nil, fmt.Errorf("scanner %s has no %s setting", device, name)
+			}
+			if r, ok := parseRange(values); ok && (float64(value) < r.Min || float64(value) > r.Max) {
+				return nil, fmt.Errorf("%s must be between %g and %g on scanner %s", name, r.Min, r.Max, device)
+			}
+		}
+		args = append(args, "--"+name+"="+strconv.Itoa(value))
+	}
+	return args, nil
+}
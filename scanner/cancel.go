@@ -0,0 +1,71 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ErrScanCancelled is returned by a scan stopped with CancelScan
+var ErrScanCancelled = errors.New("scan cancelled")
+
+// ErrNoScanRunning is returned when cancelling a scanner that is idle
+var ErrNoScanRunning = errors.New("no scan running on this scanner")
+
+// trackScan registers the scan running on a device so CancelScan can stop
+// it; a device scans one batch at a time. The returned function
+// unregisters it.
+func (sm *ScannerManager) trackScan(device string, cancel context.CancelFunc) (func(), error) {
+	sm.runningMu.Lock()
+	defer sm.runningMu.Unlock()
+	if _, busy := sm.running[device]; busy {
+		lease, ok := sm.leases[device]
+		if !ok {
+			lease = ScanLease{Device: device}
+		}
+		return nil, &BusyError{Lease: lease}
+	}
+	sm.running[device] = cancel
+	return func() {
+		sm.runningMu.Lock()
+		delete(sm.running, device)
+		sm.runningMu.Unlock()
+	}, nil
+}
+
+// CancelScan kills the scanimage process of the scan running on a device.
+// The scan removes the pages it already wrote and returns
+// ErrScanCancelled.
+func (sm *ScannerManager) CancelScan(device string) error {
+	sm.runningMu.Lock()
+	cancel, ok := sm.running[device]
+	sm.runningMu.Unlock()
+	if !ok {
+		return ErrNoScanRunning
+	}
+	sm.logger.Warnf("Cancelling scan on %s", device)
+	cancel()
+	return nil
+}
+
+// removeScanFiles deletes the pages a cancelled scan left behind
+func (sm *ScannerManager) removeScanFiles(dir, baseFilename, ext string) {
+	matches, _ := filepath.Glob(filepath.Join(dir, baseFilename+"_*."+ext))
+	matches = append(matches, filepath.Join(dir, baseFilename+"."+ext))
+	for _, path := range matches {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			sm.logger.Warnf("Failed to remove page of cancelled scan %s: %v", path, err)
+		}
+	}
+}
+
+// scanFilesExist reports whether a scan with the base filename already left
+// pages in dir
+func scanFilesExist(dir, baseFilename string) bool {
+	matches, _ := filepath.Glob(filepath.Join(dir, baseFilename+"[._]*"))
+	return len(matches) > 0
+}
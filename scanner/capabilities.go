@@ -0,0 +1,161 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"DICOMScanStation/alerts"
+)
+
+const capabilityFile = "scanner-capabilities.json"
+
+// OptionChange describes an advertised SANE option that changed between two
+// detections
+type OptionChange struct {
+	Option string   `json:"option"`
+	Change string   `json:"change"` // "added", "removed" or "changed"
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// capabilityBaselines remembers the last known option set of every device
+// across restarts, so a driver or firmware update is noticed
+type capabilityBaselines struct {
+	path    string
+	mu      sync.Mutex
+	devices map[string]map[string][]string
+}
+
+func loadCapabilityBaselines(dir string) *capabilityBaselines {
+	b := &capabilityBaselines{
+		path:    filepath.Join(dir, capabilityFile),
+		devices: make(map[string]map[string][]string),
+	}
+	if data, err := os.ReadFile(b.path); err == nil {
+		json.Unmarshal(data, &b.devices)
+	}
+	return b
+}
+
+// update stores the new option set and returns the changes against the
+// previous one. The first sighting of a device returns no changes.
+func (b *capabilityBaselines) update(device string, options map[string][]string) ([]OptionChange, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	previous, known := b.devices[device]
+	b.devices[device] = options
+
+	data, err := json.MarshalIndent(b.devices, "", "  ")
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(b.path), 0755); err == nil {
+			err = os.WriteFile(b.path, data, 0644)
+		}
+	}
+
+	if !known {
+		return nil, err
+	}
+	return diffOptions(previous, options), err
+}
+
+// options returns the last known option set of a device
+func (b *capabilityBaselines) options(device string) (map[string][]string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	options, ok := b.devices[device]
+	return options, ok
+}
+
+// SetAlerts enables admin alerts for scanner problems
+func (sm *ScannerManager) SetAlerts(store *alerts.Store) {
+	sm.alerts = store
+}
+
+// checkCapabilities compares the options a device advertises with the last
+// known set and raises an alert when they changed
+func (sm *ScannerManager) checkCapabilities(device string, name string) {
+	if sm.alerts == nil {
+		return
+	}
+
+	output, err := sm.scanimage(context.Background(), "-d", device, "-A").Output()
+	if err != nil {
+		sm.logger.Warnf("Failed to read options of scanner %s: %v", device, err)
+		return
+	}
+
+	changes, err := sm.baselines.update(device, parseOptions(string(output)))
+	if err != nil {
+		sm.logger.Warnf("Failed to store scanner capabilities: %v", err)
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	var summary []string
+	for _, c := range changes {
+		summary = append(summary, fmt.Sprintf("%s %s", c.Option, c.Change))
+	}
+	sm.alerts.Raise(alerts.SeverityWarning, "scanner",
+		fmt.Sprintf("Scanner %s (%s) advertises different options than before, probably after a driver or firmware update: %s", name, device, strings.Join(summary, ", ")),
+		changes)
+}
+
+// parseOptions reads the output of scanimage -A into option -> allowed
+// values. Current values are ignored so changed settings are not reported.
+func parseOptions(output string) map[string][]string {
+	options := make(map[string][]string)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "-") {
+			continue
+		}
+
+		name, rest, _ := strings.Cut(line, " ")
+		name = strings.TrimLeft(name, "-")
+		if name == "" {
+			continue
+		}
+		// Drop the current value in brackets, which may be all that is left
+		rest = " " + rest
+		if i := strings.LastIndex(rest, " ["); i != -1 {
+			rest = rest[:i]
+		}
+		rest = strings.TrimSpace(rest)
+
+		var values []string
+		if rest != "" {
+			for _, v := range strings.Split(rest, "|") {
+				values = append(values, strings.TrimSpace(v))
+			}
+		}
+		options[name] = values
+	}
+	return options
+}
+
+func diffOptions(before, after map[string][]string) []OptionChange {
+	var changes []OptionChange
+	for name, old := range before {
+		current, ok := after[name]
+		if !ok {
+			changes = append(changes, OptionChange{Option: name, Change: "removed", Before: old})
+		} else if strings.Join(old, "|") != strings.Join(current, "|") {
+			changes = append(changes, OptionChange{Option: name, Change: "changed", Before: old, After: current})
+		}
+	}
+	for name, current := range after {
+		if _, ok := before[name]; !ok {
+			changes = append(changes, OptionChange{Option: name, Change: "added", After: current})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Option < changes[j].Option })
+	return changes
+}
@@ -0,0 +1,223 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"DICOMScanStation/config"
+)
+
+// defaultsFile in STATE_DIR holds the scanner defaults edited through the
+// admin API
+const defaultsFile = "scanner-defaults.json"
+
+// builtinDefaults are the options of a scan that does not bring its own
+func builtinDefaults() ScanOptions {
+	return ScanOptions{
+		MultiPage:  true,
+		Color:      true,
+		Resolution: 300,
+	}
+}
+
+// ScannerDefaults are the default scan options of each scanner model, so
+// departments with different scanners each get sensible defaults. They are
+// read from the JSON file of SCANNER_DEFAULTS, which maps a device or
+// scanner name, or a pattern like "fujitsu:*", to scan options, e.g.
+//
+//	{"fujitsu:fi-7160*": {"resolution": 200, "duplex": true},
+//	 "*Perfection*": {"source": "Flatbed", "multi_page": false}}
+//
+// Options no matching entry sets keep the built-in defaults.
+type ScannerDefaults struct {
+	entries []defaultsEntry
+}
+
+type defaultsEntry struct {
+	pattern string
+	options json.RawMessage
+}
+
+// LoadScannerDefaults reads the defaults file; without SCANNER_DEFAULTS all
+// scanners share the built-in defaults
+func LoadScannerDefaults(cfg *config.Config) (*ScannerDefaults, error) {
+	file := strings.TrimSpace(cfg.ScannerDefaults)
+	if file == "" {
+		return &ScannerDefaults{}, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scanner defaults: %v", err)
+	}
+	defaults, err := ParseScannerDefaults(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return defaults, nil
+}
+
+// ParseScannerDefaults reads defaults in the format of the SCANNER_DEFAULTS
+// file
+func ParseScannerDefaults(data []byte) (*ScannerDefaults, error) {
+	defaults := &ScannerDefaults{}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid scanner defaults: %v", err)
+	}
+	for pattern, options := range raw {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			return nil, fmt.Errorf("scanner defaults with an empty scanner pattern")
+		}
+		if _, err := path.Match(strings.ToLower(pattern), ""); err != nil {
+			return nil, fmt.Errorf("scanner defaults '%s': invalid pattern", pattern)
+		}
+		entry := defaultsEntry{pattern: pattern, options: options}
+		resolved, err := entry.apply(builtinDefaults())
+		if err != nil {
+			return nil, fmt.Errorf("scanner defaults '%s': %v", pattern, err)
+		}
+		if err := validateDefaults(&resolved); err != nil {
+			return nil, fmt.Errorf("scanner defaults '%s': %v", pattern, err)
+		}
+		defaults.entries = append(defaults.entries, entry)
+	}
+
+	// Most specific first: exact names, then longer patterns
+	sort.Slice(defaults.entries, func(i, j int) bool {
+		a, b := defaults.entries[i].pattern, defaults.entries[j].pattern
+		if literalA, literalB := !hasWildcard(a), !hasWildcard(b); literalA != literalB {
+			return literalA
+		}
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return a < b
+	})
+	return defaults, nil
+}
+
+// AdminDefaultsFile is the SCANNER_DEFAULTS file of defaults edited
+// through the admin API, which stays in STATE_DIR across restarts
+func AdminDefaultsFile(stateDir string) string {
+	return filepath.Join(stateDir, defaultsFile)
+}
+
+// SaveScannerDefaults writes defaults edited through the admin API to
+// AdminDefaultsFile. The returned function puts the previous file back.
+func SaveScannerDefaults(stateDir string, data []byte) (func(), error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return nil, fmt.Errorf("invalid scanner defaults: %v", err)
+	}
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return nil, err
+	}
+	path := AdminDefaultsFile(stateDir)
+	previous, readErr := os.ReadFile(path)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write scanner defaults: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, fmt.Errorf("failed to write scanner defaults: %v", err)
+	}
+	return func() {
+		if readErr != nil {
+			os.Remove(path)
+			return
+		}
+		if err := os.WriteFile(tmp, previous, 0644); err == nil {
+			os.Rename(tmp, path)
+		}
+	}, nil
+}
+
+func validateDefaults(options *ScanOptions) error {
+	if options.Preview {
+		return fmt.Errorf("preview cannot be a default")
+	}
+	if options.Resolution <= 0 {
+		return fmt.Errorf("resolution must be positive")
+	}
+	if options.Quality < 0 || options.Quality > 100 {
+		return fmt.Errorf("quality must be between 1 and 100")
+	}
+	if err := ValidateSANEOptions(options.SANEOptions); err != nil {
+		return err
+	}
+	if err := ValidateGeometry(options); err != nil {
+		return err
+	}
+	return ValidateAdjustments(options)
+}
+
+func hasWildcard(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// apply sets the options of the entry over base; unknown options are
+// rejected so a misspelled option does not go unnoticed
+func (e defaultsEntry) apply(base ScanOptions) (ScanOptions, error) {
+	decoder := json.NewDecoder(bytes.NewReader(e.options))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&base); err != nil {
+		return ScanOptions{}, err
+	}
+	return base, nil
+}
+
+// matches returns the entries for a scanner by device or name,
+// case-insensitive, the most specific first
+func (d *ScannerDefaults) matches(device string, name string) []defaultsEntry {
+	if d == nil {
+		return nil
+	}
+	var entries []defaultsEntry
+	for _, entry := range d.entries {
+		pattern := strings.ToLower(entry.pattern)
+		for _, candidate := range []string{device, name} {
+			if candidate == "" {
+				continue
+			}
+			if ok, _ := path.Match(pattern, strings.ToLower(candidate)); ok {
+				entries = append(entries, entry)
+				break
+			}
+		}
+	}
+	return entries
+}
+
+// Options returns the default scan options of a scanner; more specific
+// entries override the options of less specific ones
+func (d *ScannerDefaults) Options(device string, name string) ScanOptions {
+	options := builtinDefaults()
+	entries := d.matches(device, name)
+	for i := len(entries) - 1; i >= 0; i-- {
+		// Entries were checked when the file was loaded
+		if applied, err := entries[i].apply(options); err == nil {
+			options = applied
+		}
+	}
+	return options
+}
+
+// Fill sets the resolution and source a scan leaves open to the scanner's
+// defaults
+func (d *ScannerDefaults) Fill(options *ScanOptions, device string, name string) {
+	defaults := d.Options(device, name)
+	if options.Resolution == 0 {
+		options.Resolution = defaults.Resolution
+	}
+	if options.Source == "" {
+		options.Source = defaults.Source
+	}
+}
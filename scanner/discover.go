@@ -0,0 +1,224 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Capabilities are the choices a scanner offers, read from scanimage -A
+type Capabilities struct {
+	// Detected is false if the options could not be read; the other fields
+	// then hold the defaults the web interface always offered
+	Detected bool `json:"detected"`
+	// Resolutions in dpi; for scanners that accept a range, the common
+	// values within it
+	Resolutions     []int    `json:"resolutions"`
+	ResolutionRange *Range   `json:"resolutionRange,omitempty"`
+	Modes           []string `json:"modes"`
+	Sources         []string `json:"sources"`
+	// MaxWidth and MaxHeight are the largest page in mm, 0 if unknown, and
+	// PageSizes the standard sizes that fit
+	MaxWidth  float64    `json:"maxWidth,omitempty"`
+	MaxHeight float64    `json:"maxHeight,omitempty"`
+	PageSizes []PageSize `json:"pageSizes"`
+	// Brightness, Contrast and Threshold are the ranges of the settings,
+	// nil if the scanner has none
+	Brightness *Range `json:"brightness,omitempty"`
+	Contrast   *Range `json:"contrast,omitempty"`
+	Threshold  *Range `json:"threshold,omitempty"`
+	Color      bool   `json:"color"`
+	Lineart    bool   `json:"lineart"`
+	Flatbed    bool   `json:"flatbed"`
+	Duplex     bool   `json:"duplex"`
+	ADF        bool   `json:"adf"`
+	MultiPage  bool   `json:"multi_page"`
+	// Options are all options of the backend with their allowed values
+	Options map[string][]string `json:"options"`
+	// Defaults are the scan options the scanner starts with, see
+	// ScannerDefaults
+	Defaults ScanOptions `json:"defaults"`
+}
+
+// Range is a range of numeric option values
+type Range struct {
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	Step float64 `json:"step,omitempty"`
+}
+
+// PageSize is a standard paper size in mm
+type PageSize struct {
+	Name   string  `json:"name"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// commonResolutions are offered for scanners that accept a range
+var commonResolutions = []int{75, 100, 150, 200, 300, 400, 600, 1200}
+
+var standardPageSizes = []PageSize{
+	{Name: "A5", Width: 148, Height: 210},
+	{Name: "A4", Width: 210, Height: 297},
+	{Name: "Letter", Width: 215.9, Height: 279.4},
+	{Name: "Legal", Width: 215.9, Height: 355.6},
+	{Name: "A3", Width: 297, Height: 420},
+}
+
+// defaultCapabilities are assumed when a scanner does not list its options
+func defaultCapabilities() *Capabilities {
+	return &Capabilities{
+		Resolutions: []int{150, 300, 600},
+		Modes:       []string{},
+		Sources:     []string{},
+		PageSizes:   []PageSize{},
+		Color:       true,
+		MultiPage:   true,
+		Options:     map[string][]string{},
+	}
+}
+
+// GetScannerCapabilities reads the resolutions, modes, sources and page
+// sizes a scanner offers
+func (sm *ScannerManager) GetScannerCapabilities(device string) (*Capabilities, error) {
+	sm.mu.RLock()
+	scanner, exists := sm.scanners[device]
+	sm.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("scanner device '%s' not found", device)
+	}
+	if !scanner.Connected {
+		return nil, fmt.Errorf("scanner '%s' is not connected", scanner.Name)
+	}
+
+	var caps *Capabilities
+	output, err := sm.scanimage(context.Background(), "-d", device, "-A").Output()
+	if err != nil {
+		sm.logger.Warnf("Failed to get scanner capabilities: %v", err)
+		caps = defaultCapabilities()
+	} else {
+		caps = parseCapabilities(string(output))
+	}
+	caps.Defaults = sm.defaults.Load().Options(device, scanner.Name)
+	return caps, nil
+}
+
+// parseCapabilities interprets the output of scanimage -A
+func parseCapabilities(output string) *Capabilities {
+	options := parseOptions(output)
+	if len(options) == 0 {
+		return defaultCapabilities()
+	}
+
+	caps := defaultCapabilities()
+	caps.Detected = true
+	caps.Options = options
+
+	resolution, ok := options["resolution"]
+	if !ok {
+		resolution = options["x-resolution"]
+	}
+	if r, ok := parseRange(resolution); ok {
+		caps.ResolutionRange = &r
+		caps.Resolutions = []int{}
+		for _, dpi := range commonResolutions {
+			if r.contains(float64(dpi)) {
+				caps.Resolutions = append(caps.Resolutions, dpi)
+			}
+		}
+	} else if len(resolution) > 0 {
+		caps.Resolutions = []int{}
+		for _, v := range resolution {
+			if dpi, err := strconv.Atoi(strings.TrimSuffix(v, "dpi")); err == nil {
+				caps.Resolutions = append(caps.Resolutions, dpi)
+			}
+		}
+	}
+
+	if modes, ok := options["mode"]; ok {
+		caps.Modes = modes
+		caps.Color = false
+		for _, m := range modes {
+			caps.Color = caps.Color || strings.EqualFold(m, "Color")
+			caps.Lineart = caps.Lineart || strings.EqualFold(m, "Lineart")
+		}
+	}
+
+	for name, setting := range map[string]**Range{
+		"brightness": &caps.Brightness,
+		"contrast":   &caps.Contrast,
+		"threshold":  &caps.Threshold,
+	} {
+		if r, ok := parseRange(options[name]); ok {
+			*setting = &r
+		}
+	}
+
+	if sources, ok := options["source"]; ok {
+		caps.Sources = sources
+		for _, s := range sources {
+			lower := strings.ToLower(s)
+			caps.Duplex = caps.Duplex || strings.Contains(lower, "duplex")
+			caps.ADF = caps.ADF || strings.Contains(lower, "adf") || strings.Contains(lower, "feeder")
+			caps.Flatbed = caps.Flatbed || IsFlatbed(s)
+		}
+		caps.MultiPage = caps.ADF
+	}
+
+	// Sheet-fed scanners limit the page separately from the scan area
+	width, height := options["page-width"], options["page-height"]
+	if width == nil || height == nil {
+		width, height = options["x"], options["y"]
+	}
+	if w, ok := parseRange(width); ok {
+		caps.MaxWidth = w.Max
+	}
+	if h, ok := parseRange(height); ok {
+		caps.MaxHeight = h.Max
+	}
+	if caps.MaxWidth > 0 && caps.MaxHeight > 0 {
+		for _, size := range standardPageSizes {
+			// Scan areas are often a fraction of a millimeter short
+			if size.Width <= caps.MaxWidth+1 && size.Height <= caps.MaxHeight+1 {
+				caps.PageSizes = append(caps.PageSizes, size)
+			}
+		}
+	}
+	return caps
+}
+
+// parseRange reads an option value like "50..600dpi (in steps of 1)"
+func parseRange(values []string) (Range, bool) {
+	if len(values) != 1 {
+		return Range{}, false
+	}
+	value, steps, _ := strings.Cut(values[0], "(in steps of ")
+	lo, hi, ok := strings.Cut(strings.TrimSpace(value), "..")
+	if !ok {
+		return Range{}, false
+	}
+	min, err1 := strconv.ParseFloat(lo, 64)
+	max, err2 := strconv.ParseFloat(strings.TrimRight(hi, "abcdefghijklmnopqrstuvwxyz%"), 64)
+	if err1 != nil || err2 != nil {
+		return Range{}, false
+	}
+	r := Range{Min: min, Max: max}
+	if step, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(steps), ")"), 64); err == nil {
+		r.Step = step
+	}
+	return r, true
+}
+
+func (r Range) contains(v float64) bool {
+	if v < r.Min || v > r.Max {
+		return false
+	}
+	if r.Step <= 0 {
+		return true
+	}
+	n := (v - r.Min) / r.Step
+	return math.Abs(n-math.Round(n)) < 1e-6
+}
@@ -0,0 +1,95 @@
+package scanner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ScanArea is the part of the scan area to scan, in mm from the top left
+// corner
+type ScanArea struct {
+	Left   float64 `json:"left"`
+	Top    float64 `json:"top"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// geometryOptions are the SANE options a page size or scan area sets; they
+// cannot be passed through at the same time
+var geometryOptions = []string{"l", "t", "x", "y", "page-width", "page-height"}
+
+// ValidateGeometry checks the page size and scan area of the options
+func ValidateGeometry(options *ScanOptions) error {
+	if options.PageSize != "" && options.Area != nil {
+		return fmt.Errorf("choose either a page size or a scan area")
+	}
+	if options.PageSize != "" {
+		if _, ok := lookupPageSize(options.PageSize); !ok {
+			var names []string
+			for _, size := range standardPageSizes {
+				names = append(names, size.Name)
+			}
+			return fmt.Errorf("unknown page size '%s' (available: %s)", options.PageSize, strings.Join(names, ", "))
+		}
+	}
+	if a := options.Area; a != nil {
+		if a.Left < 0 || a.Top < 0 || a.Width <= 0 || a.Height <= 0 {
+			return fmt.Errorf("the scan area needs a positive width and height and must not start left of or above the scan area")
+		}
+	}
+	if options.PageSize != "" || options.Area != nil {
+		for _, name := range geometryOptions {
+			if _, ok := options.SANEOptions[name]; ok {
+				return fmt.Errorf("SANE option '%s' conflicts with the page size or scan area", name)
+			}
+		}
+	}
+	return nil
+}
+
+func lookupPageSize(name string) (PageSize, bool) {
+	for _, size := range standardPageSizes {
+		if strings.EqualFold(size.Name, name) {
+			return size, true
+		}
+	}
+	return PageSize{}, false
+}
+
+// geometryArgs turns the page size or scan area into scanimage arguments.
+// Without either the backend default applies. Sheet-fed scanners are also
+// told the paper size, so the page is neither clipped nor padded.
+func (sm *ScannerManager) geometryArgs(device string, options *ScanOptions) ([]string, error) {
+	if err := ValidateGeometry(options); err != nil {
+		return nil, err
+	}
+
+	var area ScanArea
+	switch {
+	case options.Area != nil:
+		area = *options.Area
+	case options.PageSize != "":
+		size, _ := lookupPageSize(options.PageSize)
+		area = ScanArea{Width: size.Width, Height: size.Height}
+	default:
+		return nil, nil
+	}
+
+	mm := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	var args []string
+	advertised, known := sm.baselines.options(device)
+	if known && hasOption(advertised, "page-width") && hasOption(advertised, "page-height") {
+		args = append(args,
+			"--page-width="+mm(area.Left+area.Width),
+			"--page-height="+mm(area.Top+area.Height))
+	}
+	args = append(args,
+		"-l", mm(area.Left),
+		"-t", mm(area.Top),
+		"-x", mm(area.Width),
+		"-y", mm(area.Height))
+	return args, nil
+}
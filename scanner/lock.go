@@ -0,0 +1,58 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrScannerBusy is returned when a scanner is already leased to a scan
+var ErrScannerBusy = errors.New("scanner busy")
+
+// ScanLease is the hold of one scan on a scanner, so that a second scan
+// on the same device is refused instead of failing in scanimage
+type ScanLease struct {
+	Device    string    `json:"device"`
+	Owner     string    `json:"owner,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// BusyError tells who is scanning on a busy scanner since when
+type BusyError struct {
+	Lease ScanLease
+}
+
+func (e *BusyError) Error() string {
+	if e.Lease.StartedAt.IsZero() {
+		return fmt.Sprintf("scanner busy: '%s' is already scanning", e.Lease.Device)
+	}
+	if e.Lease.Owner == "" {
+		return fmt.Sprintf("scanner busy: '%s' is scanning since %s", e.Lease.Device, e.Lease.StartedAt.Format("15:04:05"))
+	}
+	return fmt.Sprintf("scanner busy: %s is scanning on '%s' since %s", e.Lease.Owner, e.Lease.Device, e.Lease.StartedAt.Format("15:04:05"))
+}
+
+func (e *BusyError) Unwrap() error {
+	return ErrScannerBusy
+}
+
+// LockScanner leases a device to the scan of owner until the returned
+// function is called. It is taken before a scan is started in the
+// background, so a second request learns right away that the scanner is
+// busy.
+func (sm *ScannerManager) LockScanner(device string, owner string) (func(), error) {
+	sm.runningMu.Lock()
+	defer sm.runningMu.Unlock()
+	if lease, ok := sm.leases[device]; ok {
+		return nil, &BusyError{Lease: lease}
+	}
+	if _, scanning := sm.running[device]; scanning {
+		return nil, &BusyError{Lease: ScanLease{Device: device}}
+	}
+	sm.leases[device] = ScanLease{Device: device, Owner: owner, StartedAt: time.Now()}
+	return func() {
+		sm.runningMu.Lock()
+		delete(sm.leases, device)
+		sm.runningMu.Unlock()
+	}, nil
+}
@@ -8,14 +8,21 @@ import (
 	"image/color"
 	"image/draw"
 	"image/jpeg"
+	"image/png"
+	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"DICOMScanStation/alerts"
+	"DICOMScanStation/colorprofile"
 	"DICOMScanStation/config"
+	"DICOMScanStation/events"
+	"DICOMScanStation/logging"
 
 	"github.com/golang/freetype"
 	"github.com/golang/freetype/truetype"
@@ -29,6 +36,8 @@ type ScannerInfo struct {
 	Connected bool   `json:"connected"`
 	Status    string `json:"status"`
 	LastSeen  string `json:"last_seen"`
+	// Host is the saned host of a network scanner, empty for local ones
+	Host string `json:"host,omitempty"`
 }
 
 type ScanOptions struct {
@@ -36,39 +45,125 @@ type ScanOptions struct {
 	Duplex     bool `json:"duplex"`
 	Color      bool `json:"color"`
 	Resolution int  `json:"resolution"`
+	// ColorCritical scans lossless PNG in color for photographs that must
+	// keep their colors, e.g. in dermatology
+	ColorCritical bool `json:"color_critical"`
+	// Deskew straightens slightly rotated pages, CropBorders cuts off the
+	// dark edges around them
+	Deskew      bool `json:"deskew"`
+	CropBorders bool `json:"crop_borders"`
+	// Preview scans a single page at low resolution to check alignment,
+	// see PreviewScan; only Color and Source apply to it
+	Preview bool `json:"preview"`
+	// Quality is the JPEG quality of the pages from 1 to 100, 0 for
+	// SCANNER_JPEG_QUALITY
+	Quality int `json:"quality"`
+	// Separate splits the batch at separator sheets into inbox documents
+	// with SCAN_SEPARATION; the scanner itself ignores it
+	Separate bool `json:"separate"`
+	// SANEOptions are backend specific options passed to scanimage, e.g.
+	// {"swdeskew": "yes"} for a Fujitsu; see ValidateSANEOptions
+	SANEOptions map[string]string `json:"sane_options,omitempty"`
+	// PageSize is a standard paper size like A4 or Letter, Area a custom
+	// scan area; without either the scanner's default area is scanned
+	PageSize string    `json:"page_size,omitempty"`
+	Area     *ScanArea `json:"area,omitempty"`
+	// Brightness and Contrast in the scanner's range, 0 for its default.
+	// Lineart scans black and white, with pixels darker than Threshold
+	// turning black, e.g. to make faint carbon copies legible.
+	Brightness int  `json:"brightness,omitempty"`
+	Contrast   int  `json:"contrast,omitempty"`
+	Lineart    bool `json:"lineart,omitempty"`
+	Threshold  int  `json:"threshold,omitempty"`
+	// Source is the source to scan from as the scanner names it, e.g.
+	// "Flatbed" for bound booklets; without it the document feeder is used
+	Source string `json:"source,omitempty"`
+	// Dir is the workspace the pages are written to, TEMP_FILES_DIR if
+	// empty; it is set by the station, never by clients
+	Dir string `json:"-"`
 }
 
 type ScannerManager struct {
-	config   *config.Config
-	logger   *logrus.Logger
-	scanners map[string]*ScannerInfo
-	mu       sync.RWMutex
-	ctx      context.Context
-	cancel   context.CancelFunc
-	stopChan chan struct{}
+	config    *config.Config
+	logger    *logrus.Logger
+	scanners  map[string]*ScannerInfo
+	mu        sync.RWMutex
+	ctx       context.Context
+	cancel    context.CancelFunc
+	stopChan  chan struct{}
+	alerts    *alerts.Store
+	baselines *capabilityBaselines
+	// defaults are the scan options of each scanner model, replaced by
+	// Reconfigure
+	defaults atomic.Pointer[ScannerDefaults]
+	// events receives the scanned pages, nil if no one follows them
+	events *events.Hub
+	// running cancels the scan of each scanning device
+	running   map[string]context.CancelFunc
+	runningMu sync.Mutex
+	// leases hold scanners for the scans started on them, see LockScanner
+	leases map[string]ScanLease
+
+	// The monitor loop can be stopped and started again by Restart
+	monitorMu     sync.Mutex
+	monitorCancel context.CancelFunc
+	monitorDone   chan struct{}
+	restartMu     sync.Mutex
 }
 
 func NewScannerManager(cfg *config.Config) *ScannerManager {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &ScannerManager{
-		config:   cfg,
-		logger:   logrus.New(),
-		scanners: make(map[string]*ScannerInfo),
-		ctx:      ctx,
-		cancel:   cancel,
-		stopChan: make(chan struct{}),
+	// Invalid defaults are rejected by LoadScannerDefaults at startup
+	defaults, _ := LoadScannerDefaults(cfg)
+	sm := &ScannerManager{
+		config:    cfg,
+		logger:    logging.New(),
+		scanners:  make(map[string]*ScannerInfo),
+		ctx:       ctx,
+		cancel:    cancel,
+		stopChan:  make(chan struct{}),
+		baselines: loadCapabilityBaselines(cfg.StateDir),
+		running:   make(map[string]context.CancelFunc),
+		leases:    make(map[string]ScanLease),
+	}
+	sm.defaults.Store(defaults)
+	return sm
+}
+
+// Reconfigure reads the scanner defaults of cfg again. Scans already
+// running keep the options they started with.
+func (sm *ScannerManager) Reconfigure(cfg *config.Config) {
+	defaults, err := LoadScannerDefaults(cfg)
+	if err != nil {
+		sm.logger.Errorf("Keeping the previous scanner defaults: %v", err)
+		return
 	}
+	sm.defaults.Store(defaults)
+}
+
+// SetEvents publishes the pages of running scans as they are scanned
+func (sm *ScannerManager) SetEvents(hub *events.Hub) {
+	sm.events = hub
 }
 
 func (sm *ScannerManager) StartMonitoring() {
 	sm.logger.Info("Starting scanner monitoring...")
 
+	ctx, cancel := context.WithCancel(sm.ctx)
+	done := make(chan struct{})
+	defer close(done)
+
+	sm.monitorMu.Lock()
+	sm.monitorCancel = cancel
+	sm.monitorDone = done
+	sm.monitorMu.Unlock()
+
 	ticker := time.NewTicker(time.Duration(sm.config.ScannerPollInterval) * time.Millisecond)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-sm.ctx.Done():
+		case <-ctx.Done():
 			sm.logger.Info("Scanner monitoring stopped")
 			return
 		case <-ticker.C:
@@ -85,12 +180,20 @@ func (sm *ScannerManager) Stop() {
 
 func (sm *ScannerManager) detectScanners() {
 	// Use sane-find-scanner to detect USB scanners
-	cmd := exec.Command("scanimage", "-L")
+	cmd := sm.scanimage(context.Background(), "-L")
 	output, err := cmd.Output()
 
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
+	// Devices that (re)appeared get their options compared outside the lock
+	var appeared []*ScannerInfo
+	defer func() {
+		for _, s := range appeared {
+			go sm.checkCapabilities(s.Device, s.Name)
+		}
+	}()
+
 	if err != nil {
 		sm.logger.Warnf("Failed to detect scanners: %v", err)
 		// Mark all scanners as disconnected
@@ -131,6 +234,9 @@ func (sm *ScannerManager) detectScanners() {
 			currentScanners[device] = true
 
 			if scanner, exists := sm.scanners[device]; exists {
+				if !scanner.Connected {
+					appeared = append(appeared, scanner)
+				}
 				scanner.Connected = true
 				scanner.Status = "connected"
 				scanner.LastSeen = time.Now().Format(time.RFC3339)
@@ -141,8 +247,10 @@ func (sm *ScannerManager) detectScanners() {
 					Connected: true,
 					Status:    "connected",
 					LastSeen:  time.Now().Format(time.RFC3339),
+					Host:      NetHost(device),
 				}
 				sm.logger.Infof("New scanner detected: %s (%s)", name, device)
+				appeared = append(appeared, sm.scanners[device])
 			}
 		}
 	}
@@ -204,26 +312,41 @@ func (sm *ScannerManager) ScanDocument(device string, options *ScanOptions) ([]s
 		return nil, fmt.Errorf("scanner '%s' is not connected", scanner.Name)
 	}
 
-	// Set default options if not provided
+	// Set default options if not provided, the scanner's own if configured
 	if options == nil {
-		options = &ScanOptions{
-			MultiPage:  true,
-			Duplex:     false,
-			Color:      true,
-			Resolution: 300,
-		}
+		defaults := sm.defaults.Load().Options(device, scanner.Name)
+		options = &defaults
+	} else {
+		// A copy, the caller's options stay as they were
+		filled := *options
+		sm.defaults.Load().Fill(&filled, device, scanner.Name)
+		options = &filled
+	}
+	dir := options.Dir
+	if dir == "" {
+		dir = sm.config.TempFilesDir
 	}
 
-	// Generate unique base filename
+	// Generate unique base filename; a batch appended to the workspace
+	// must not overwrite the pages of one started in the same second
 	timestamp := time.Now().Unix()
 	baseFilename := fmt.Sprintf("scan_%d", timestamp)
-	filepath := fmt.Sprintf("%s/%s", sm.config.TempFilesDir, baseFilename)
+	for scanFilesExist(dir, baseFilename) {
+		timestamp++
+		baseFilename = fmt.Sprintf("scan_%d", timestamp)
+	}
+	filepath := fmt.Sprintf("%s/%s", dir, baseFilename)
 
 	// Build scanimage command with options
 	args := []string{"-d", device}
 
-	// Set format
-	args = append(args, "--format=jpeg")
+	// Set format; color critical scans stay lossless all the way to the PACS
+	format, ext := "jpeg", "jpg"
+	if options.ColorCritical {
+		format, ext = "png", "png"
+		options.Color = true
+	}
+	args = append(args, "--format="+format)
 
 	// Set resolution
 	args = append(args, "--resolution", fmt.Sprintf("%d", options.Resolution))
@@ -231,35 +354,60 @@ func (sm *ScannerManager) ScanDocument(device string, options *ScanOptions) ([]s
 	// Set color mode
 	if options.Color {
 		args = append(args, "--mode", "Color")
+	} else if options.Lineart {
+		args = append(args, "--mode", "Lineart")
 	} else {
 		args = append(args, "--mode", "Gray")
 	}
 
+	// The glass holds one page, a batch would scan it over and over
+	source, err := sm.scanSource(device, options)
+	if err != nil {
+		return nil, err
+	}
+	if IsFlatbed(source) && options.MultiPage {
+		sm.logger.Infof("Scanning a single page from %s", source)
+		options.MultiPage = false
+	}
+
 	// Set multi-page options first
 	if options.MultiPage {
 		// Add batch count limit to prevent infinite scanning
 		args = append(args, "--batch-start=1", "--batch-increment=1", "--batch-count=100")
 		// Use batch mode for multi-page scanning - use proper batch pattern
-		batchPattern := sm.config.TempFilesDir + "/" + baseFilename + "_%d.jpg"
+		batchPattern := dir + "/" + baseFilename + "_%d." + ext
 		sm.logger.Debugf("Batch pattern: %s", batchPattern)
 		args = append(args, "--batch="+batchPattern)
 		sm.logger.Infof("Multi-page scanning with batch limit of 100 pages")
 	} else {
 		// Single page scan
-		args = append(args, "-o", fmt.Sprintf("%s.jpg", filepath))
+		args = append(args, "-o", fmt.Sprintf("%s."+ext, filepath))
 	}
 
-	// Set duplex if supported (after batch options)
-	if options.Duplex {
-		args = append(args, "--source", "ADF Duplex")
-	} else {
-		args = append(args, "--source", "ADF Front")
+	// Set the source after the batch options
+	args = append(args, "--source", source)
+
+	geometry, err := sm.geometryArgs(device, options)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, geometry...)
+
+	adjust, err := sm.adjustmentArgs(device, options)
+	if err != nil {
+		return nil, err
 	}
+	args = append(args, adjust...)
+
+	extra, err := sm.saneOptionArgs(device, options.SANEOptions)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, extra...)
 
 	// Use scanimage to scan document
 
 	sm.logger.Infof("Scan command: scanimage %v", args)
-	cmd := exec.Command("scanimage", args...)
 
 	// Increase timeout for large batch operations
 	timeout := time.Duration(sm.config.ScannerTimeout) * time.Millisecond
@@ -271,8 +419,13 @@ func (sm *ScannerManager) ScanDocument(device string, options *ScanOptions) ([]s
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
+	untrack, err := sm.trackScan(device, cancel)
+	if err != nil {
+		return nil, err
+	}
+	defer untrack()
 
-	cmd = exec.CommandContext(ctx, cmd.Path, cmd.Args[1:]...)
+	cmd := sm.scanimage(ctx, args...)
 
 	// Capture both stdout and stderr for better error reporting
 	var stderr bytes.Buffer
@@ -282,8 +435,25 @@ func (sm *ScannerManager) ScanDocument(device string, options *ScanOptions) ([]s
 		options.MultiPage, options.Duplex, options.Color, options.Resolution)
 	sm.logger.Debugf("Scan command: scanimage %v", args)
 
-	if err := cmd.Run(); err != nil {
-		errorMsg := stderr.String()
+	// Pages are reported while the feeder is still running
+	progress := sm.newPageProgress(device, dir, baseFilename, ext)
+	stopWatching := func() {}
+	if options.MultiPage {
+		cmd.Stderr = io.MultiWriter(&stderr, progress)
+		stopWatching = progress.watch()
+	}
+	err = cmd.Run()
+	stopWatching()
+	reported := progress.reported()
+	output := stderr.String()
+	if err != nil {
+		if ctx.Err() == context.Canceled {
+			sm.removeScanFiles(dir, baseFilename, ext)
+			sm.logger.Infof("Scan on %s cancelled after %d pages", device, reported)
+			return nil, ErrScanCancelled
+		}
+
+		errorMsg := output
 		if errorMsg == "" {
 			errorMsg = err.Error()
 		}
@@ -294,6 +464,12 @@ func (sm *ScannerManager) ScanDocument(device string, options *ScanOptions) ([]s
 			return nil, fmt.Errorf("scan timeout after %v. Consider scanning smaller batches or checking scanner settings", timeout)
 		}
 
+		// A jam ends a batch like the last page does, with "Batch terminated"
+		if scanErr := classifyScanError(errorMsg); scanErr != nil && scanErr.Code != ErrorFeederEmpty {
+			sm.logger.Errorf("Scan failed (%s): %s \n %s", scanErr.Code, errorMsg, cmd.String())
+			return nil, scanErr
+		}
+
 		// Check if it's a normal completion (document feeder out of documents)
 		if strings.Contains(errorMsg, "Document feeder out of documents") ||
 			strings.Contains(errorMsg, "Batch terminated") ||
@@ -306,10 +482,8 @@ func (sm *ScannerManager) ScanDocument(device string, options *ScanOptions) ([]s
 		}
 	}
 
-	// Wait a moment to ensure files are fully written and flushed to disk
-	time.Sleep(2 * time.Second)
-
-	// Collect generated filenames
+	// Collect generated filenames, scanimage has written and closed every
+	// page when it exits
 	var filenames []string
 	if options.MultiPage {
 		// Look for batch files
@@ -317,8 +491,8 @@ func (sm *ScannerManager) ScanDocument(device string, options *ScanOptions) ([]s
 		maxPages := 100 // Increased limit to match batch-count
 		sm.logger.Debugf("Looking for batch files with base: %s", baseFilename)
 		for pageNum <= maxPages {
-			filename := fmt.Sprintf("%s_%d.jpg", baseFilename, pageNum)
-			fullPath := fmt.Sprintf("%s/%s", sm.config.TempFilesDir, filename)
+			filename := fmt.Sprintf("%s_%d."+ext, baseFilename, pageNum)
+			fullPath := fmt.Sprintf("%s/%s", dir, filename)
 
 			if _, err := os.Stat(fullPath); os.IsNotExist(err) {
 				sm.logger.Debugf("File not found: %s", fullPath)
@@ -336,16 +510,16 @@ func (sm *ScannerManager) ScanDocument(device string, options *ScanOptions) ([]s
 			for pageNum <= maxPages {
 				// Try different naming patterns that some scanners use for duplex
 				patterns := []string{
-					fmt.Sprintf("%s_%d.jpg", baseFilename, pageNum),
-					fmt.Sprintf("%s_front_%d.jpg", baseFilename, pageNum),
-					fmt.Sprintf("%s_back_%d.jpg", baseFilename, pageNum),
-					fmt.Sprintf("%s_%d_front.jpg", baseFilename, pageNum),
-					fmt.Sprintf("%s_%d_back.jpg", baseFilename, pageNum),
+					fmt.Sprintf("%s_%d."+ext, baseFilename, pageNum),
+					fmt.Sprintf("%s_front_%d."+ext, baseFilename, pageNum),
+					fmt.Sprintf("%s_back_%d."+ext, baseFilename, pageNum),
+					fmt.Sprintf("%s_%d_front."+ext, baseFilename, pageNum),
+					fmt.Sprintf("%s_%d_back."+ext, baseFilename, pageNum),
 				}
 
 				found := false
 				for _, pattern := range patterns {
-					fullPath := fmt.Sprintf("%s/%s", sm.config.TempFilesDir, pattern)
+					fullPath := fmt.Sprintf("%s/%s", dir, pattern)
 					if _, err := os.Stat(fullPath); err == nil {
 						filenames = append(filenames, pattern)
 						sm.logger.Debugf("Found duplex page %d: %s", pageNum, pattern)
@@ -362,11 +536,11 @@ func (sm *ScannerManager) ScanDocument(device string, options *ScanOptions) ([]s
 
 		// If still no files found, list all files in temp directory for debugging
 		if len(filenames) == 0 {
-			entries, err := os.ReadDir(sm.config.TempFilesDir)
+			entries, err := os.ReadDir(dir)
 			if err == nil {
 				sm.logger.Debugf("No scan files found. Files in temp directory:")
 				for _, entry := range entries {
-					if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".jpg") {
+					if !entry.IsDir() && strings.HasSuffix(entry.Name(), "."+ext) {
 						sm.logger.Debugf("  - %s", entry.Name())
 					}
 				}
@@ -374,28 +548,31 @@ func (sm *ScannerManager) ScanDocument(device string, options *ScanOptions) ([]s
 		}
 	} else {
 		// Single page scan
-		filename := fmt.Sprintf("%s.jpg", baseFilename)
-		fullPath := fmt.Sprintf("%s/%s", sm.config.TempFilesDir, filename)
+		filename := fmt.Sprintf("%s."+ext, baseFilename)
+		fullPath := fmt.Sprintf("%s/%s", dir, filename)
 
 		if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-			return nil, fmt.Errorf("scan completed but file was not created")
+			return nil, noPagesError(output, fmt.Errorf("scan completed but file was not created"))
 		}
 		filenames = append(filenames, filename)
 	}
 
 	if len(filenames) == 0 {
-		return nil, fmt.Errorf("scan completed but no files were created")
+		return nil, noPagesError(output, fmt.Errorf("scan completed but no files were created"))
+	}
+	for i := reported; i < len(filenames); i++ {
+		sm.events.Publish(events.ScanPage, events.ScanProgress{Device: device, Page: i + 1, Filename: filenames[i]})
 	}
 
-	// Add header to each scanned image
+	// Post-process and add header to each scanned image
 	sm.logger.Infof("Adding headers to %d scanned images...", len(filenames))
 	for i, filename := range filenames {
 		sm.logger.Debugf("Processing header for file %d/%d: %s", i+1, len(filenames), filename)
-		inputPath := fmt.Sprintf("%s/%s", sm.config.TempFilesDir, filename)
-		tempPath := fmt.Sprintf("%s/%s.tmp", sm.config.TempFilesDir, filename)
+		inputPath := fmt.Sprintf("%s/%s", dir, filename)
+		tempPath := fmt.Sprintf("%s/%s.tmp", dir, filename)
 
 		// Add header to the image
-		err := sm.addHeaderToImage(inputPath, tempPath)
+		err := sm.addHeaderToImage(inputPath, tempPath, options)
 		if err != nil {
 			sm.logger.Errorf("Failed to add header to %s: %v", filename, err)
 			continue
@@ -413,12 +590,20 @@ func (sm *ScannerManager) ScanDocument(device string, options *ScanOptions) ([]s
 		sm.logger.Debugf("Successfully added header to %s", filename)
 	}
 
+	if options.Color {
+		sm.embedColorProfile(scanner.Name, dir, filenames)
+	}
+	if options.ColorCritical && sm.config.ICCProfileDir == "" {
+		sm.logger.Warn("Color critical scan without ICC_PROFILE_DIR, pages carry no color profile")
+	}
+
 	sm.logger.Infof("Document scanned successfully: %d pages", len(filenames))
 	return filenames, nil
 }
 
-// addHeaderToImage adds a header text to the top of an image
-func (sm *ScannerManager) addHeaderToImage(inputPath, outputPath string) error {
+// addHeaderToImage post-processes an image as requested in options and
+// adds a header text to its top
+func (sm *ScannerManager) addHeaderToImage(inputPath, outputPath string, options *ScanOptions) error {
 	// Open the input image
 	inputFile, err := os.Open(inputPath)
 	if err != nil {
@@ -431,6 +616,7 @@ func (sm *ScannerManager) addHeaderToImage(inputPath, outputPath string) error {
 	if err != nil {
 		return fmt.Errorf("failed to decode image: %v", err)
 	}
+	img = sm.postProcess(img, options)
 
 	// Get image bounds
 	bounds := img.Bounds()
@@ -494,8 +680,12 @@ func (sm *ScannerManager) addHeaderToImage(inputPath, outputPath string) error {
 	}
 	defer outputFile.Close()
 
-	// Encode as JPEG
-	err = jpeg.Encode(outputFile, newImg, &jpeg.Options{Quality: 95})
+	// Lossless scans stay lossless, everything else is stored as JPEG
+	if strings.HasSuffix(inputPath, ".png") {
+		err = png.Encode(outputFile, newImg)
+	} else {
+		err = jpeg.Encode(outputFile, newImg, &jpeg.Options{Quality: sm.jpegQuality(options)})
+	}
 	if err != nil {
 		return fmt.Errorf("failed to encode image: %v", err)
 	}
@@ -503,68 +693,40 @@ func (sm *ScannerManager) addHeaderToImage(inputPath, outputPath string) error {
 	return nil
 }
 
-func (sm *ScannerManager) GetScannerCapabilities(device string) (map[string]interface{}, error) {
-	sm.mu.RLock()
-	scanner, exists := sm.scanners[device]
-	sm.mu.RUnlock()
-
-	if !exists {
-		return nil, fmt.Errorf("scanner device '%s' not found", device)
+// jpegQuality returns the JPEG quality a scan asked for, or the configured
+// one
+func (sm *ScannerManager) jpegQuality(options *ScanOptions) int {
+	if options != nil && options.Quality > 0 {
+		return options.Quality
 	}
-	if !scanner.Connected {
-		return nil, fmt.Errorf("scanner '%s' is not connected", scanner.Name)
-	}
-
-	capabilities := make(map[string]interface{})
+	return sm.config.ScannerJPEGQuality
+}
 
-	// Get scanner options using scanimage -h
-	cmd := exec.Command("scanimage", "-d", device, "-h")
-	output, err := cmd.Output()
-	if err != nil {
-		sm.logger.Warnf("Failed to get scanner capabilities: %v", err)
-		return capabilities, nil
+// embedColorProfile attaches the scanner's ICC profile from ICC_PROFILE_DIR
+// to the scanned pages. The header step re-encodes the image, so this has
+// to run afterwards.
+func (sm *ScannerManager) embedColorProfile(scannerName string, dir string, filenames []string) {
+	if sm.config.ICCProfileDir == "" {
+		return
 	}
 
-	outputStr := string(output)
-	lines := strings.Split(outputStr, "\n")
-
-	// Parse capabilities
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-
-		// Check for resolution options
-		if strings.Contains(line, "resolution") {
-			capabilities["resolution"] = true
-		}
-
-		// Check for color mode options
-		if strings.Contains(line, "mode") {
-			capabilities["color"] = true
-		}
-
-		// Check for source options (ADF, duplex)
-		if strings.Contains(line, "source") {
-			capabilities["source"] = true
-		}
-
-		// Check for batch options
-		if strings.Contains(line, "batch") {
-			capabilities["multi_page"] = true
+	profile, profilePath, err := colorprofile.Find(sm.config.ICCProfileDir, scannerName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			sm.logger.Warnf("No ICC profile for scanner '%s' in %s", scannerName, sm.config.ICCProfileDir)
+		} else {
+			sm.logger.Errorf("Failed to read ICC profile %s: %v", profilePath, err)
 		}
+		return
 	}
 
-	// Set default capabilities if not detected
-	if capabilities["multi_page"] == nil {
-		capabilities["multi_page"] = true // Most modern scanners support this
-	}
-	if capabilities["color"] == nil {
-		capabilities["color"] = true // Most modern scanners support this
-	}
-	if capabilities["resolution"] == nil {
-		capabilities["resolution"] = true // Most modern scanners support this
+	for _, filename := range filenames {
+		path := filepath.Join(dir, filename)
+		if err := colorprofile.EmbedFile(path, profile); err != nil {
+			sm.logger.Errorf("Failed to embed ICC profile into %s: %v", filename, err)
+		}
 	}
-
-	return capabilities, nil
+	sm.logger.Infof("Embedded ICC profile %s into %d pages", filepath.Base(profilePath), len(filenames))
 }
 
 func extractScannerName(device string) string {
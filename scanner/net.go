@@ -0,0 +1,67 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// SanedPort is the port saned listens on
+const SanedPort = 6566
+
+// netDevicePrefix starts the names of devices of the SANE net backend,
+// e.g. net:scanpc1:fujitsu:fi-7160:12345
+const netDevicePrefix = "net:"
+
+// ValidateNetHosts rejects saned hosts the net backend cannot parse: the
+// hosts are passed colon separated, so IPv6 addresses need brackets
+func ValidateNetHosts(hosts []string) error {
+	for _, host := range hosts {
+		if host == "" {
+			return fmt.Errorf("empty host")
+		}
+		if strings.HasPrefix(host, "[") {
+			if !strings.HasSuffix(host, "]") || strings.Count(host, "[") != 1 {
+				return fmt.Errorf("invalid IPv6 address '%s'", host)
+			}
+			continue
+		}
+		if strings.ContainsAny(host, ":/ ") {
+			return fmt.Errorf("invalid host '%s', IPv6 addresses must be in brackets", host)
+		}
+	}
+	return nil
+}
+
+// NetHost returns the saned host a device is attached to, empty for local
+// devices
+func NetHost(device string) string {
+	rest, ok := strings.CutPrefix(device, netDevicePrefix)
+	if !ok {
+		return ""
+	}
+	if strings.HasPrefix(rest, "[") {
+		if end := strings.Index(rest, "]"); end != -1 {
+			return rest[:end+1]
+		}
+		return ""
+	}
+	host, _, _ := strings.Cut(rest, ":")
+	return host
+}
+
+// scanimage returns a scanimage command that also reaches the scanners of
+// the configured saned hosts
+func (sm *ScannerManager) scanimage(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "scanimage", args...)
+	if len(sm.config.ScannerNetHosts) > 0 {
+		cmd.Env = append(os.Environ(),
+			"SANE_NET_HOSTS="+strings.Join(sm.config.ScannerNetHosts, ":"),
+			"SANE_NET_TIMEOUT="+strconv.Itoa(sm.config.ScannerNetTimeout),
+		)
+	}
+	return cmd
+}
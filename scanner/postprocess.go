@@ -0,0 +1,181 @@
+package scanner
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// Border detection: a pixel darker than borderDark is background of the
+// scanner lid, an edge line that is at least borderLineRatio dark is
+// border. At most borderMaxCrop of each side is cut off, so dark documents
+// keep their content.
+const (
+	borderDark      = 60
+	borderLineRatio = 0.8
+	borderMaxCrop   = 0.2
+)
+
+// Skew detection works on a copy at most deskewSampleWidth pixels wide and
+// tries angles up to deskewMaxAngle degrees. Pages skewed less than
+// deskewMinAngle are left alone.
+const (
+	deskewSampleWidth = 800
+	deskewMaxAngle    = 5.0
+	deskewMinAngle    = 0.15
+	deskewInk         = 128
+)
+
+// postProcess straightens and crops a scanned page as requested in the
+// options
+func (sm *ScannerManager) postProcess(img image.Image, options *ScanOptions) image.Image {
+	if options.CropBorders {
+		img = cropBorders(img)
+	}
+	if options.Deskew {
+		if angle := detectSkew(img); math.Abs(angle) >= deskewMinAngle {
+			sm.logger.Debugf("Deskewing page by %.2f degrees", angle)
+			img = rotate(img, angle)
+		}
+	}
+	return img
+}
+
+// cropBorders cuts off the dark edges the scanner lid leaves around a page
+func cropBorders(img image.Image) image.Image {
+	b := img.Bounds()
+	dark := func(x, y int) bool {
+		return luminance(img.At(x, y)) < borderDark
+	}
+	rowDark := func(y int) bool {
+		n := 0
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if dark(x, y) {
+				n++
+			}
+		}
+		return float64(n) >= borderLineRatio*float64(b.Dx())
+	}
+	colDark := func(x int) bool {
+		n := 0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			if dark(x, y) {
+				n++
+			}
+		}
+		return float64(n) >= borderLineRatio*float64(b.Dy())
+	}
+
+	maxX := int(borderMaxCrop * float64(b.Dx()))
+	maxY := int(borderMaxCrop * float64(b.Dy()))
+	crop := b
+	for crop.Min.Y-b.Min.Y < maxY && rowDark(crop.Min.Y) {
+		crop.Min.Y++
+	}
+	for b.Max.Y-crop.Max.Y < maxY && rowDark(crop.Max.Y-1) {
+		crop.Max.Y--
+	}
+	for crop.Min.X-b.Min.X < maxX && colDark(crop.Min.X) {
+		crop.Min.X++
+	}
+	for b.Max.X-crop.Max.X < maxX && colDark(crop.Max.X-1) {
+		crop.Max.X--
+	}
+	if crop == b {
+		return img
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, crop.Min, draw.Src)
+	return dst
+}
+
+// detectSkew returns the angle in degrees by which the text lines of a page
+// descend to the right. The lines are straight where the horizontal
+// projection of the dark pixels is sharpest.
+func detectSkew(img image.Image) float64 {
+	b := img.Bounds()
+	scale := 1.0
+	if b.Dx() > deskewSampleWidth {
+		scale = float64(deskewSampleWidth) / float64(b.Dx())
+	}
+	w := int(float64(b.Dx()) * scale)
+	h := int(float64(b.Dy()) * scale)
+	if w < 2 || h < 2 {
+		return 0
+	}
+	sample := image.NewGray(image.Rect(0, 0, w, h))
+	draw.ApproxBiLinear.Scale(sample, sample.Bounds(), img, b, draw.Src, nil)
+
+	type point struct{ x, y float64 }
+	var ink []point
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if sample.GrayAt(x, y).Y < deskewInk {
+				ink = append(ink, point{float64(x), float64(y)})
+			}
+		}
+	}
+	if len(ink) == 0 {
+		return 0
+	}
+
+	diagonal := int(math.Hypot(float64(w), float64(h))) + 1
+	bins := make([]float64, 2*diagonal)
+	sharpness := func(angle float64) float64 {
+		for i := range bins {
+			bins[i] = 0
+		}
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		for _, p := range ink {
+			bins[int(math.Floor(p.y*cos-p.x*sin))+diagonal]++
+		}
+		score := 0.0
+		for i := 1; i < len(bins); i++ {
+			d := bins[i] - bins[i-1]
+			score += d * d
+		}
+		return score
+	}
+	search := func(from, to, step float64) float64 {
+		best, bestScore := 0.0, -1.0
+		for angle := from; angle <= to+step/2; angle += step {
+			if score := sharpness(angle); score > bestScore {
+				best, bestScore = angle, score
+			}
+		}
+		return best
+	}
+
+	coarse := search(-deskewMaxAngle, deskewMaxAngle, 0.5)
+	return search(coarse-0.5, coarse+0.5, 0.05)
+}
+
+// rotate turns a page around its center so that lines descending by angle
+// degrees become level, filling the corners with white like the paper
+func rotate(img image.Image, angle float64) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	cx := float64(b.Min.X) + float64(b.Dx())/2
+	cy := float64(b.Min.Y) + float64(b.Dy())/2
+	dx := float64(b.Dx()) / 2
+	dy := float64(b.Dy()) / 2
+	// Source to destination: rotate around the center of the page
+	s2d := f64.Aff3{
+		cos, sin, dx - (cos*cx + sin*cy),
+		-sin, cos, dy - (-sin*cx + cos*cy),
+	}
+	draw.BiLinear.Transform(dst, s2d, img, b, draw.Over, nil)
+	return dst
+}
+
+// luminance returns the brightness of a color from 0 to 255
+func luminance(c color.Color) uint8 {
+	return color.GrayModel.Convert(c).(color.Gray).Y
+}
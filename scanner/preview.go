@@ -0,0 +1,121 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+// previewMaxSize is the longest side of a preview image in pixels
+const previewMaxSize = 1024
+
+// PreviewScan scans a single page at SCANNER_PREVIEW_RESOLUTION and returns
+// it as a downscaled JPEG, so the operator can check alignment and content
+// before the full batch. The page is not added to the workspace.
+func (sm *ScannerManager) PreviewScan(device string, options *ScanOptions) ([]byte, error) {
+	sm.mu.RLock()
+	scanner, exists := sm.scanners[device]
+	sm.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("scanner device '%s' not found", device)
+	}
+	if !scanner.Connected {
+		return nil, fmt.Errorf("scanner '%s' is not connected", scanner.Name)
+	}
+
+	tmp, err := os.CreateTemp("", "preview-*.jpg")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create preview file: %v", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	mode := "Color"
+	if options != nil && !options.Color {
+		mode = "Gray"
+	}
+	var requested ScanOptions
+	if options != nil {
+		requested.Source = options.Source
+	}
+	sm.defaults.Load().Fill(&requested, device, scanner.Name)
+	source, err := sm.scanSource(device, &requested)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"-d", device, "--format=jpeg",
+		"--resolution", strconv.Itoa(sm.config.ScannerPreviewResolution),
+		"--mode", mode, "-o", tmp.Name(), "--source", source}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(sm.config.ScannerTimeout)*time.Millisecond)
+	defer cancel()
+	untrack, err := sm.trackScan(device, cancel)
+	if err != nil {
+		return nil, err
+	}
+	defer untrack()
+
+	sm.logger.Infof("Preview scan on %s at %d dpi", device, sm.config.ScannerPreviewResolution)
+	var stderr bytes.Buffer
+	cmd := sm.scanimage(ctx, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		switch ctx.Err() {
+		case context.Canceled:
+			return nil, ErrScanCancelled
+		case context.DeadlineExceeded:
+			return nil, fmt.Errorf("preview scan timeout after %v", time.Duration(sm.config.ScannerTimeout)*time.Millisecond)
+		}
+		errorMsg := stderr.String()
+		if errorMsg == "" {
+			errorMsg = err.Error()
+		}
+		if scanErr := classifyScanError(errorMsg); scanErr != nil {
+			return nil, scanErr
+		}
+		return nil, fmt.Errorf("preview scan failed: %s", errorMsg)
+	}
+
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode preview: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, downscale(img, previewMaxSize), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, fmt.Errorf("failed to encode preview: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// downscale shrinks an image so its longest side is at most maxSize
+func downscale(img image.Image, maxSize int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSize && h <= maxSize {
+		return img
+	}
+	if w >= h {
+		h = h * maxSize / w
+		w = maxSize
+	} else {
+		w = w * maxSize / h
+		h = maxSize
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,117 @@
+package scanner
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"DICOMScanStation/events"
+)
+
+// scannedPageRe matches the line scanimage writes to stderr in batch mode
+// when a page is done, e.g. "Scanned page 3. (scanner status = 5)"
+var scannedPageRe = regexp.MustCompile(`^Scanned page (\d+)\.`)
+
+// pageProgress reports the pages of a batch scan while the feeder is still
+// running, so a long batch does not look stuck. A page is done when
+// scanimage says so on stderr or has started writing the next one; either
+// way it is only reported once its file is there.
+type pageProgress struct {
+	sm           *ScannerManager
+	device       string
+	dir          string
+	baseFilename string
+	ext          string
+
+	mu sync.Mutex
+	// scanned is the last page scanimage said it finished, done the pages
+	// reported so far
+	scanned int
+	done    int
+	line    []byte
+}
+
+func (sm *ScannerManager) newPageProgress(device, dir, baseFilename, ext string) *pageProgress {
+	return &pageProgress{sm: sm, device: device, dir: dir, baseFilename: baseFilename, ext: ext}
+}
+
+// Write reads the stderr of scanimage line by line
+func (p *pageProgress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.line = append(p.line, b...)
+	for {
+		i := bytes.IndexByte(p.line, '\n')
+		if i < 0 {
+			break
+		}
+		if m := scannedPageRe.FindSubmatch(bytes.TrimSpace(p.line[:i])); m != nil {
+			if page, err := strconv.Atoi(string(m[1])); err == nil && page > p.scanned {
+				p.scanned = page
+			}
+		}
+		p.line = p.line[i+1:]
+	}
+	p.report()
+	return len(b), nil
+}
+
+// watch checks the directory for finished pages until the returned
+// function is called
+func (p *pageProgress) watch() func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			p.mu.Lock()
+			p.report()
+			p.mu.Unlock()
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// report publishes the pages finished since the last call. The caller
+// must hold mu.
+func (p *pageProgress) report() {
+	for {
+		page := p.done + 1
+		if !p.exists(page) || (page > p.scanned && !p.exists(page+1)) {
+			return
+		}
+		p.done = page
+		filename := p.filename(page)
+		p.sm.events.Publish(events.ScanPage, events.ScanProgress{Device: p.device, Page: page, Filename: filename})
+	}
+}
+
+// reported returns the number of pages reported
+func (p *pageProgress) reported() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.done
+}
+
+func (p *pageProgress) filename(page int) string {
+	return fmt.Sprintf("%s_%d.%s", p.baseFilename, page, p.ext)
+}
+
+func (p *pageProgress) exists(page int) bool {
+	_, err := os.Stat(fmt.Sprintf("%s/%s", p.dir, p.filename(page)))
+	return err == nil
+}
@@ -0,0 +1,142 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var libusbDeviceRe = regexp.MustCompile(`libusb:(\d{3}):(\d{3})`)
+
+// RestartOptions control what Restart does besides restarting detection
+type RestartOptions struct {
+	// USBReset resets the USB devices of the scanners with usbreset
+	USBReset bool `json:"usbReset"`
+	// USBDevices overrides the devices to reset (VVVV:PPPP or BBB/DDD)
+	USBDevices []string `json:"usbDevices"`
+}
+
+// RestartResult reports what Restart did
+type RestartResult struct {
+	KilledProcesses []int          `json:"killedProcesses"`
+	USBReset        []USBResetInfo `json:"usbReset,omitempty"`
+	Scanners        []*ScannerInfo `json:"scanners"`
+}
+
+type USBResetInfo struct {
+	Device string `json:"device"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Restart tears down the scanner subsystem when SANE is wedged: it stops the
+// monitor, kills stray scanimage processes, optionally resets the USB
+// devices and starts detection again. The web server and pending uploads
+// are not affected, but running scans are aborted.
+func (sm *ScannerManager) Restart(opts RestartOptions) (*RestartResult, error) {
+	sm.restartMu.Lock()
+	defer sm.restartMu.Unlock()
+
+	if sm.ctx.Err() != nil {
+		return nil, fmt.Errorf("scanner manager is shutting down")
+	}
+
+	sm.logger.Warn("Restarting scanner subsystem...")
+
+	// Stop the monitor loop and wait until it has returned
+	sm.monitorMu.Lock()
+	cancel, done := sm.monitorCancel, sm.monitorDone
+	sm.monitorCancel, sm.monitorDone = nil, nil
+	sm.monitorMu.Unlock()
+	if cancel != nil {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			sm.logger.Warn("Scanner monitor did not stop in time, continuing restart")
+		}
+	}
+
+	result := &RestartResult{KilledProcesses: killProcesses("scanimage")}
+	if len(result.KilledProcesses) > 0 {
+		sm.logger.Warnf("Killed stray scanimage processes: %v", result.KilledProcesses)
+	}
+
+	if opts.USBReset {
+		devices := opts.USBDevices
+		if len(devices) == 0 {
+			devices = sm.usbDevices()
+		}
+		for _, device := range devices {
+			info := USBResetInfo{Device: device}
+			output, err := exec.Command("usbreset", device).CombinedOutput()
+			if err != nil {
+				info.Error = fmt.Sprintf("%v: %s", err, strings.TrimSpace(string(output)))
+				sm.logger.Warnf("usbreset %s failed: %s", device, info.Error)
+			} else {
+				sm.logger.Infof("USB device %s reset", device)
+			}
+			result.USBReset = append(result.USBReset, info)
+		}
+		// Give the kernel time to re-enumerate the devices
+		time.Sleep(2 * time.Second)
+	}
+
+	// Forget known scanners so reappearing devices are checked again
+	sm.mu.Lock()
+	sm.scanners = make(map[string]*ScannerInfo)
+	sm.mu.Unlock()
+
+	sm.detectScanners()
+	go sm.StartMonitoring()
+
+	result.Scanners = sm.GetScanners()
+	sm.logger.Infof("Scanner subsystem restarted, %d scanner(s) detected", len(result.Scanners))
+	return result, nil
+}
+
+// usbDevices derives usbreset arguments (BBB/DDD) from libusb SANE names
+func (sm *ScannerManager) usbDevices() []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var devices []string
+	for device := range sm.scanners {
+		// Network scanners are reset on their own host
+		if NetHost(device) != "" {
+			continue
+		}
+		if m := libusbDeviceRe.FindStringSubmatch(device); m != nil {
+			devices = append(devices, m[1]+"/"+m[2])
+		}
+	}
+	return devices
+}
+
+// killProcesses sends SIGKILL to all processes with the given command name
+func killProcesses(name string) []int {
+	var killed []int
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "comm"))
+		if err != nil || strings.TrimSpace(string(comm)) != name {
+			continue
+		}
+		if err := syscall.Kill(pid, syscall.SIGKILL); err == nil {
+			killed = append(killed, pid)
+		}
+	}
+	return killed
+}
@@ -0,0 +1,87 @@
+package scanner
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// saneOptionNameRe matches backend option names like swdeskew or page-width;
+// single letters are the geometry options -l, -t, -x and -y
+var saneOptionNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// maxSANEOptionValue bounds the length of a passed through option value
+const maxSANEOptionValue = 256
+
+// reservedSANEOptions are set from the other scan options or would change
+// what scanimage does; they cannot be passed through
+var reservedSANEOptions = map[string]bool{
+	"d": true, "device-name": true, "format": true, "resolution": true,
+	"mode": true, "source": true, "o": true, "output-file": true,
+	"batch": true, "batch-start": true, "batch-count": true,
+	"batch-increment": true, "batch-double": true, "batch-prompt": true,
+	"L": true, "list-devices": true, "f": true, "formatted-device-list": true,
+	"A": true, "all-options": true, "h": true, "help": true,
+	"T": true, "test": true, "n": true, "dont-scan": true,
+	"i": true, "icc-profile": true, "p": true, "progress": true,
+	"v": true, "verbose": true, "B": true, "buffer-size": true,
+	"V": true, "version": true, "accept-md5-only": true,
+}
+
+// ValidateSANEOptions checks the names and values of backend specific
+// options before they are handed to scanimage
+func ValidateSANEOptions(options map[string]string) error {
+	for name, value := range options {
+		if !saneOptionNameRe.MatchString(name) {
+			return fmt.Errorf("invalid SANE option name '%s'", name)
+		}
+		if reservedSANEOptions[name] {
+			return fmt.Errorf("SANE option '%s' is set by the scan station", name)
+		}
+		if len(value) > maxSANEOptionValue || strings.ContainsAny(value, "\x00\r\n") {
+			return fmt.Errorf("invalid value for SANE option '%s'", name)
+		}
+	}
+	return nil
+}
+
+// saneOptionArgs turns backend specific options into scanimage arguments.
+// Options the device is known not to have are rejected, as scanimage would
+// fail with a less helpful message.
+func (sm *ScannerManager) saneOptionArgs(device string, options map[string]string) ([]string, error) {
+	if err := ValidateSANEOptions(options); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	advertised, known := sm.baselines.options(device)
+	var args []string
+	for _, name := range names {
+		if known && !hasOption(advertised, name) {
+			return nil, fmt.Errorf("scanner %s has no option '%s'", device, name)
+		}
+		if len(name) == 1 {
+			args = append(args, "-"+name, options[name])
+		} else {
+			args = append(args, "--"+name+"="+options[name])
+		}
+	}
+	return args, nil
+}
+
+// hasOption looks an option up by name; boolean options are listed as
+// e.g. swdeskew[=(yes|no)]
+func hasOption(advertised map[string][]string, name string) bool {
+	for option := range advertised {
+		if base, _, _ := strings.Cut(option, "["); base == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package scanner
+
+import "strings"
+
+// Codes of the scan failures the operator can fix at the scanner
+const (
+	ErrorFeederEmpty = "feeder_empty"
+	ErrorPaperJam    = "paper_jam"
+	ErrorDoubleFeed  = "double_feed"
+	ErrorCoverOpen   = "cover_open"
+)
+
+// ScanError is a scan failure with a code clients can show an actionable
+// message for instead of the output of scanimage
+type ScanError struct {
+	Code    string
+	Message string
+	// Output is what scanimage reported
+	Output string
+}
+
+func (e *ScanError) Error() string {
+	return e.Message
+}
+
+var scanErrorMessages = map[string]string{
+	ErrorFeederEmpty: "no documents in the feeder",
+	ErrorPaperJam:    "paper jam in the feeder",
+	ErrorDoubleFeed:  "several pages were fed at once",
+	ErrorCoverOpen:   "the scanner cover is open",
+}
+
+// scanErrorPatterns map the messages of SANE and its backends to the codes,
+// double feeds first as some backends report them as jams
+var scanErrorPatterns = []struct {
+	code     string
+	patterns []string
+}{
+	{ErrorDoubleFeed, []string{"double feed", "double-feed", "multifeed", "multi-feed", "multiple feed"}},
+	{ErrorPaperJam, []string{"jammed", "paper jam"}},
+	{ErrorCoverOpen, []string{"cover is open", "cover open"}},
+	{ErrorFeederEmpty, []string{"out of documents", "no documents", "no paper"}},
+}
+
+func newScanError(code string, output string) *ScanError {
+	return &ScanError{Code: code, Message: scanErrorMessages[code], Output: strings.TrimSpace(output)}
+}
+
+// classifyScanError returns the ScanError for the output of a failed
+// scanimage, nil if the failure is not one the operator can fix
+func classifyScanError(output string) *ScanError {
+	lower := strings.ToLower(output)
+	for _, p := range scanErrorPatterns {
+		for _, pattern := range p.patterns {
+			if strings.Contains(lower, pattern) {
+				return newScanError(p.code, output)
+			}
+		}
+	}
+	return nil
+}
+
+// noPagesError is the error of a scan that ended without pages: an empty
+// feeder if scanimage says so, err otherwise
+func noPagesError(output string, err error) error {
+	if scanErr := classifyScanError(output); scanErr != nil && scanErr.Code == ErrorFeederEmpty {
+		return scanErr
+	}
+	return err
+}
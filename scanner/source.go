@@ -0,0 +1,70 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sources used when the scanner's own list is not known, as the station
+// was built for document feeders
+const (
+	defaultSource       = "ADF Front"
+	defaultDuplexSource = "ADF Duplex"
+)
+
+// IsFlatbed reports whether a source is the glass of a flatbed, which
+// scans one page at a time
+func IsFlatbed(source string) bool {
+	return strings.Contains(strings.ToLower(source), "flatbed")
+}
+
+// scanSource picks the source to scan from: the requested one, spelled as
+// the scanner spells it, or the document feeder, with both sides for
+// duplex. Flatbed-only scanners scan from the flatbed.
+func (sm *ScannerManager) scanSource(device string, options *ScanOptions) (string, error) {
+	advertised, known := sm.baselines.options(device)
+	sources := advertised["source"]
+
+	if options.Source != "" {
+		if !known || sources == nil {
+			return options.Source, nil
+		}
+		for _, s := range sources {
+			if strings.EqualFold(s, options.Source) {
+				return s, nil
+			}
+		}
+		return "", fmt.Errorf("scanner %s has no source '%s' (available: %s)", device, options.Source, strings.Join(sources, ", "))
+	}
+
+	if !known || sources == nil {
+		if options.Duplex {
+			return defaultDuplexSource, nil
+		}
+		return defaultSource, nil
+	}
+
+	if options.Duplex {
+		for _, s := range sources {
+			if strings.Contains(strings.ToLower(s), "duplex") {
+				return s, nil
+			}
+		}
+		return "", fmt.Errorf("scanner %s cannot scan duplex (sources: %s)", device, strings.Join(sources, ", "))
+	}
+	var feeder string
+	for _, s := range sources {
+		if strings.EqualFold(s, defaultSource) {
+			return s, nil
+		}
+		lower := strings.ToLower(s)
+		isFeeder := strings.Contains(lower, "adf") || strings.Contains(lower, "feeder")
+		if feeder == "" && isFeeder && !strings.Contains(lower, "duplex") && !strings.Contains(lower, "back") {
+			feeder = s
+		}
+	}
+	if feeder != "" {
+		return feeder, nil
+	}
+	return sources[0], nil
+}
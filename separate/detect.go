@@ -0,0 +1,107 @@
+package separate
+
+import (
+	"image"
+	"image/color"
+)
+
+// darkThreshold is the luminance below which a pixel counts as ink
+const darkThreshold = 128
+
+// IsBlank reports whether at most maxInk per mille of the page is dark.
+// A margin of 5% is ignored because scanners often leave shadows along the
+// edges of the sheet.
+func IsBlank(img image.Image, maxInk int) bool {
+	b := img.Bounds()
+	mx, my := b.Dx()/20, b.Dy()/20
+	inner := image.Rect(b.Min.X+mx, b.Min.Y+my, b.Max.X-mx, b.Max.Y-my)
+
+	// Every second pixel in both directions is plenty for this decision
+	var total, dark int
+	for y := inner.Min.Y; y < inner.Max.Y; y += 2 {
+		for x := inner.Min.X; x < inner.Max.X; x += 2 {
+			total++
+			if luminance(img.At(x, y)) < darkThreshold {
+				dark++
+			}
+		}
+	}
+	if total == 0 {
+		return true
+	}
+	return dark*1000 <= maxInk*total
+}
+
+// DetectPatch looks for a patch code sheet: four thick bars running across
+// the whole sheet, in either orientation. It returns the bar pattern with W
+// for wide and N for narrow bars.
+func DetectPatch(img image.Image) (string, bool) {
+	b := img.Bounds()
+	if pattern, ok := detectBars(b.Dx(), b.Dy(), func(along, across int) color.Color {
+		return img.At(b.Min.X+across, b.Min.Y+along)
+	}); ok {
+		return pattern, true
+	}
+	return detectBars(b.Dy(), b.Dx(), func(along, across int) color.Color {
+		return img.At(b.Min.X+along, b.Min.Y+across)
+	})
+}
+
+// detectBars samples lines across the bars; at least 60% of them must show
+// the same four bars
+func detectBars(width, length int, at func(along, across int) color.Color) (string, bool) {
+	const samples = 20
+
+	// Bars are at least ~1% of the sheet wide, thinner runs are text
+	minBar := width / 100
+	if minBar < 2 {
+		return "", false
+	}
+
+	counts := make(map[string]int)
+	for i := 1; i <= samples; i++ {
+		along := length * i / (samples + 1)
+		var bars []int
+		run := 0
+		for across := 0; across <= width; across++ {
+			if across < width && luminance(at(along, across)) < darkThreshold {
+				run++
+				continue
+			}
+			if run >= minBar {
+				bars = append(bars, run)
+			}
+			run = 0
+		}
+		if len(bars) == 4 {
+			counts[classifyBars(bars)]++
+		}
+	}
+
+	for pattern, n := range counts {
+		if n*10 >= samples*6 {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+func classifyBars(bars []int) string {
+	narrowest := bars[0]
+	for _, w := range bars {
+		narrowest = min(narrowest, w)
+	}
+	pattern := make([]byte, len(bars))
+	for i, w := range bars {
+		if float64(w) >= 1.6*float64(narrowest) {
+			pattern[i] = 'W'
+		} else {
+			pattern[i] = 'N'
+		}
+	}
+	return string(pattern)
+}
+
+func luminance(c color.Color) uint8 {
+	return color.GrayModel.Convert(c).(color.Gray).Y
+}
@@ -0,0 +1,123 @@
+// Package separate detects separator pages in multi-document batches so
+// that bulk back-scanning can be split into one document per patient.
+package separate
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"DICOMScanStation/barcode"
+	"DICOMScanStation/config"
+)
+
+// Separation rules
+const (
+	// RuleBlank splits at empty pages
+	RuleBlank = "blank"
+	// RulePatch splits at patch code sheets (four thick bars)
+	RulePatch = "patch"
+	// RuleBarcode splits at pages with a Code 39 barcode, whose value is
+	// kept with the following document
+	RuleBarcode = "barcode"
+)
+
+var knownRules = []string{RuleBlank, RulePatch, RuleBarcode}
+
+// Options select the rules and their parameters
+type Options struct {
+	Rules []string `json:"rules"`
+	// BlankMaxInk is the share of dark pixels in per mille up to which a
+	// page counts as blank
+	BlankMaxInk int `json:"blankMaxInk"`
+	// BarcodePrefix limits separator barcodes to values with this prefix
+	BarcodePrefix string `json:"barcodePrefix"`
+}
+
+// OptionsFromConfig returns the configured separation rules
+func OptionsFromConfig(cfg *config.Config) Options {
+	return Options{
+		Rules:         cfg.SeparationRules,
+		BlankMaxInk:   cfg.SeparationBlankMaxInk,
+		BarcodePrefix: cfg.SeparationBarcodePrefix,
+	}
+}
+
+// ScanOptionsFromConfig returns the rules that split ADF scan batches;
+// the thresholds are shared with ingested documents
+func ScanOptionsFromConfig(cfg *config.Config) Options {
+	opts := OptionsFromConfig(cfg)
+	opts.Rules = cfg.ScanSeparationRules
+	return opts
+}
+
+// Validate normalizes the rule names and rejects unknown ones
+func (o *Options) Validate() error {
+	var rules []string
+	for _, rule := range o.Rules {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		if rule == "" {
+			continue
+		}
+		known := false
+		for _, k := range knownRules {
+			known = known || k == rule
+		}
+		if !known {
+			return fmt.Errorf("unknown separation rule '%s' (available: %s)", rule, strings.Join(knownRules, ", "))
+		}
+		rules = append(rules, rule)
+	}
+	o.Rules = rules
+	if o.BlankMaxInk < 0 || o.BlankMaxInk > 1000 {
+		return fmt.Errorf("blankMaxInk must be between 0 and 1000")
+	}
+	return nil
+}
+
+// Enabled reports whether any rule is selected
+func (o Options) Enabled() bool {
+	return len(o.Rules) > 0
+}
+
+func (o Options) has(rule string) bool {
+	for _, r := range o.Rules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// Result tells whether a page separates two documents
+type Result struct {
+	Separator bool   `json:"separator"`
+	Rule      string `json:"rule,omitempty"`
+	// Barcode is the separator barcode, e.g. a patient ID or batch number
+	Barcode string `json:"barcode,omitempty"`
+	// Patch is the wide/narrow pattern of a patch code sheet, e.g. WNNW
+	Patch string `json:"patch,omitempty"`
+}
+
+// Classify checks a page against the selected rules. Patch codes are
+// checked before barcodes because the thick bars of a patch sheet never
+// decode as Code 39, while blank detection runs last as it is the cheapest
+// to fool.
+func Classify(img image.Image, opts Options) Result {
+	if opts.has(RulePatch) {
+		if pattern, ok := DetectPatch(img); ok {
+			return Result{Separator: true, Rule: RulePatch, Patch: pattern}
+		}
+	}
+	if opts.has(RuleBarcode) {
+		for _, value := range barcode.Scan(img) {
+			if strings.HasPrefix(value, opts.BarcodePrefix) {
+				return Result{Separator: true, Rule: RuleBarcode, Barcode: strings.TrimPrefix(value, opts.BarcodePrefix)}
+			}
+		}
+	}
+	if opts.has(RuleBlank) && IsBlank(img, opts.BlankMaxInk) {
+		return Result{Separator: true, Rule: RuleBlank}
+	}
+	return Result{}
+}
@@ -0,0 +1,269 @@
+// Package session logs the shared kiosk out after a period of inactivity.
+// With WORKSPACE_SESSIONS every workspace has a session of its own. Unsent
+// scans are not purged but handed over to the pending inbox, tagged with
+// the operator who left them, and supervisors are alerted.
+package session
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"DICOMScanStation/alerts"
+	"DICOMScanStation/config"
+	"DICOMScanStation/logging"
+	"DICOMScanStation/pending"
+	"DICOMScanStation/storage"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Status describes the current kiosk session
+type Status struct {
+	Operator       string    `json:"operator,omitempty"`
+	LastActivity   time.Time `json:"lastActivity"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+	TimeoutMinutes int       `json:"timeoutMinutes"`
+}
+
+// Watcher tracks operator activity per workspace and hands a workspace over
+// to the inbox when its session expires
+type Watcher struct {
+	config *config.Config
+	files  *storage.LocalFileStore
+	// workspaces are the workspaces of WORKSPACE_SESSIONS, nil without
+	workspaces *storage.Workspaces
+	pending    *pending.Store
+	alerts     *alerts.Store
+	logger     *logrus.Logger
+	timeout    time.Duration
+
+	mu sync.Mutex
+	// sessions by workspace ID, "" for the shared workspace
+	sessions map[string]*activity
+}
+
+// activity is the session of one workspace
+type activity struct {
+	operator     string
+	lastActivity time.Time
+}
+
+func NewWatcher(cfg *config.Config, files *storage.LocalFileStore, workspaces *storage.Workspaces, store *pending.Store, alertStore *alerts.Store) *Watcher {
+	return &Watcher{
+		config:     cfg,
+		files:      files,
+		workspaces: workspaces,
+		pending:    store,
+		alerts:     alertStore,
+		logger:     logging.New(),
+		timeout:    time.Duration(cfg.AutoLogoutMinutes) * time.Minute,
+		sessions:   map[string]*activity{"": {lastActivity: time.Now()}},
+	}
+}
+
+// session returns the session of a workspace, starting one on first use;
+// w.mu must be held
+func (w *Watcher) session(workspace string, now time.Time) *activity {
+	s, ok := w.sessions[workspace]
+	if !ok {
+		s = &activity{lastActivity: now}
+		w.sessions[workspace] = s
+	}
+	return s
+}
+
+// Touch records activity in a workspace, "" for the shared one. An empty
+// operator keeps the last known one, so anonymous requests do not hide who
+// scanned the pages.
+func (w *Watcher) Touch(workspace, operator string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s := w.session(workspace, time.Now())
+	s.lastActivity = time.Now()
+	if operator = strings.TrimSpace(operator); operator != "" {
+		s.operator = operator
+	}
+}
+
+// Status returns the operator of a workspace and when its session expires
+func (w *Watcher) Status(workspace string) Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s := w.session(workspace, time.Now())
+	return Status{
+		Operator:       s.operator,
+		LastActivity:   s.lastActivity,
+		ExpiresAt:      s.lastActivity.Add(w.timeout),
+		TimeoutMinutes: int(w.timeout / time.Minute),
+	}
+}
+
+// Start checks for expired sessions until ctx is cancelled
+func (w *Watcher) Start(ctx context.Context) {
+	interval := w.timeout / 10
+	if interval < 10*time.Second {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check(time.Now())
+		}
+	}
+}
+
+// check hands over the workspaces whose session expired
+func (w *Watcher) check(now time.Time) {
+	var ids []string
+	if w.workspaces != nil {
+		var err error
+		if ids, err = w.workspaces.IDs(); err != nil {
+			w.logger.Warnf("Session: Failed to list the workspaces: %v", err)
+			return
+		}
+	}
+
+	w.mu.Lock()
+	// Workspaces found on disk, e.g. left over from before a restart, get
+	// a session from now on; the ones the janitor removed are forgotten
+	exists := map[string]bool{"": true}
+	for _, id := range ids {
+		exists[id] = true
+		w.session(id, now)
+	}
+	type expiredSession struct {
+		workspace string
+		activity
+	}
+	var expired []expiredSession
+	for id, s := range w.sessions {
+		if !exists[id] {
+			delete(w.sessions, id)
+			continue
+		}
+		if now.Sub(s.lastActivity) >= w.timeout {
+			expired = append(expired, expiredSession{id, *s})
+			// Start a fresh session for the next person at the scanner
+			s.operator = ""
+			s.lastActivity = now
+		}
+	}
+	w.mu.Unlock()
+
+	for _, s := range expired {
+		w.expire(s.workspace, s.operator, s.lastActivity)
+	}
+}
+
+// expire hands the pages of a workspace over to the inbox
+func (w *Watcher) expire(workspace, operator string, lastActivity time.Time) {
+	files := w.files
+	if workspace != "" {
+		var err error
+		if files, err = w.workspaces.Workspace(workspace); err != nil {
+			w.logger.Errorf("Session: Failed to open workspace %s: %v", workspace, err)
+			return
+		}
+	}
+
+	doc, err := w.handOff(files, workspace, operator, lastActivity)
+	if err != nil {
+		w.logger.Errorf("Session: Failed to move unsent scans to the inbox: %v", err)
+		w.alerts.Raise(alerts.SeverityError, "session",
+			fmt.Sprintf("Session of %s expired with unsent scans, which could not be moved to the inbox: %v", displayName(operator), err), nil)
+		return
+	}
+	if doc == nil {
+		if operator != "" {
+			w.logger.Infof("Session: %s logged out after inactivity", operator)
+		}
+		return
+	}
+
+	w.logger.Infof("Session: %s logged out after inactivity, %d unsent pages moved to pending document %s", displayName(operator), len(doc.Files), doc.ID)
+	w.alerts.Raise(alerts.SeverityWarning, "session",
+		fmt.Sprintf("Session of %s expired with %d unsent pages; they were moved to the inbox", displayName(operator), len(doc.Files)),
+		map[string]string{"pendingId": doc.ID, "operator": operator})
+}
+
+// handOff moves the files of a workspace into a new pending document, in
+// the order of the scan session. It returns nil if the workspace is empty.
+func (w *Watcher) handOff(store *storage.LocalFileStore, workspace, operator string, lastActivity time.Time) (*pending.Document, error) {
+	files, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+	var attachments []pending.Attachment
+	for _, f := range files {
+		path, err := store.Path(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, pending.Attachment{
+			Name:        f.Name,
+			ContentType: contentType(f.Extension),
+			Data:        data,
+		})
+	}
+
+	metadata := map[string]string{
+		"operator":     operator,
+		"lastActivity": lastActivity.Format(time.RFC3339),
+	}
+	if workspace != "" {
+		metadata["workspace"] = workspace
+	}
+	doc, err := w.pending.Add(pending.Document{
+		Source:   pending.SourceWorkspace,
+		Sender:   operator,
+		Title:    fmt.Sprintf("Unsent scans of %s", displayName(operator)),
+		Metadata: metadata,
+	}, attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only clear the kiosk once the pages are safe in the inbox
+	for _, f := range files {
+		if err := store.Delete(f.Name); err != nil {
+			w.logger.Warnf("Session: Failed to remove %s from the workspace: %v", f.Name, err)
+		}
+	}
+	return doc, nil
+}
+
+func contentType(ext string) string {
+	switch ext {
+	case ".png":
+		return "image/png"
+	case ".tif", ".tiff":
+		return "image/tiff"
+	default:
+		return "image/jpeg"
+	}
+}
+
+func displayName(operator string) string {
+	if operator == "" {
+		return "an unknown operator"
+	}
+	return operator
+}
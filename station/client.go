@@ -0,0 +1,141 @@
+package station
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"DICOMScanStation/scanner"
+)
+
+// ErrUnauthenticated is returned when a remote station does not prove that
+// it knows the shared key
+var ErrUnauthenticated = errors.New("remote station failed authentication")
+
+// ErrKeyRejected is returned when a remote station does not accept the key
+// of this station
+var ErrKeyRejected = errors.New("remote station rejected our key")
+
+// Remote is a configured peer station
+type Remote struct {
+	Name string
+	URL  string
+	Key  string
+}
+
+// Page is a scanned page transferred between stations
+type Page struct {
+	Name string `json:"name"`
+	Data []byte `json:"data"`
+}
+
+// ScanRequest asks a remote station to scan
+type ScanRequest struct {
+	Device  string               `json:"device"`
+	Options *scanner.ScanOptions `json:"options"`
+}
+
+// queryTimeout bounds listing scanners and capabilities, which must not
+// stall the local scanner list when a remote station is down
+const queryTimeout = 5 * time.Second
+
+// Client calls the station API of a remote station
+type Client struct {
+	remote      Remote
+	http        *http.Client
+	scanTimeout time.Duration
+}
+
+func NewClient(remote Remote, scanTimeout time.Duration) *Client {
+	return &Client{
+		remote:      remote,
+		http:        &http.Client{},
+		scanTimeout: scanTimeout,
+	}
+}
+
+// Scanners lists the scanners of the remote station
+func (c *Client) Scanners() ([]*scanner.ScannerInfo, error) {
+	var resp struct {
+		Scanners []*scanner.ScannerInfo `json:"scanners"`
+	}
+	return resp.Scanners, c.do(http.MethodGet, "/api/station/scanners", nil, &resp, queryTimeout)
+}
+
+// Capabilities returns the options of a remote scanner
+func (c *Client) Capabilities(device string) (*scanner.Capabilities, error) {
+	var resp *scanner.Capabilities
+	return resp, c.do(http.MethodGet, "/api/station/scanners/"+url.PathEscape(device)+"/capabilities", nil, &resp, queryTimeout)
+}
+
+// Scan scans on the remote station and returns the pages
+func (c *Client) Scan(req ScanRequest) ([]Page, error) {
+	var resp struct {
+		Pages []Page `json:"pages"`
+	}
+	return resp.Pages, c.do(http.MethodPost, "/api/station/scan", req, &resp, c.scanTimeout)
+}
+
+func (c *Client) do(method, path string, body interface{}, out interface{}, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.remote.URL, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	// The key itself is never sent, only the signature of the request
+	nonce := newNonce()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(c.remote.Key, nonce, timestamp, method, req.URL.EscapedPath(), data))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("station %s unreachable: %v", c.remote.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w: %s", ErrKeyRejected, c.remote.Name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		if e.Error == "" {
+			e.Error = resp.Status
+		}
+		if e.Code != "" {
+			// A jam at the remote scanner is fixed there like at a local one
+			return &scanner.ScanError{Code: e.Code, Message: fmt.Sprintf("station %s: %s", c.remote.Name, e.Error)}
+		}
+		return fmt.Errorf("station %s: %s", c.remote.Name, e.Error)
+	}
+	// Pages and scanners are only taken from a station holding the key
+	if !validProof(c.remote.Key, nonce, resp.Header.Get(HeaderProof)) {
+		return fmt.Errorf("%w: %s", ErrUnauthenticated, c.remote.Name)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,183 @@
+package station
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"DICOMScanStation/config"
+	"DICOMScanStation/logging"
+	"DICOMScanStation/scanner"
+
+	"github.com/sirupsen/logrus"
+)
+
+// devicePrefix marks remote scanners in the device list. The full device
+// name is remote:<station>:<device on that station>.
+const devicePrefix = "remote:"
+
+// listCacheTime limits how often remote scanner lists are fetched, since
+// the web interface polls the scanners every few seconds
+const listCacheTime = 10 * time.Second
+
+type Scanner interface {
+	GetScanners() []*scanner.ScannerInfo
+	GetScannerCapabilities(device string) (*scanner.Capabilities, error)
+	ScanDocument(device string, options *scanner.ScanOptions) ([]string, error)
+}
+
+type FileSaver interface {
+	Save(name string, r io.Reader) error
+}
+
+// Proxy adds the scanners of remote stations to the local ones. Pages
+// scanned remotely are saved in the local workspace.
+type Proxy struct {
+	Scanner
+	files   FileSaver
+	clients map[string]*Client
+	logger  *logrus.Logger
+
+	mu       sync.Mutex
+	cached   []*scanner.ScannerInfo
+	cachedAt time.Time
+}
+
+// ParseRemotes reads REMOTE_STATIONS (name=url) and REMOTE_STATION_KEYS
+// (name=key)
+func ParseRemotes(cfg *config.Config) ([]Remote, error) {
+	keys := make(map[string]string)
+	for _, entry := range cfg.RemoteStationKeys {
+		name, key, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid REMOTE_STATION_KEYS entry, expected name=key")
+		}
+		keys[strings.TrimSpace(name)] = strings.TrimSpace(key)
+	}
+
+	var remotes []Remote
+	for _, entry := range cfg.RemoteStations {
+		name, url, ok := strings.Cut(entry, "=")
+		name, url = strings.TrimSpace(name), strings.TrimSpace(url)
+		if !ok || name == "" || url == "" || strings.Contains(name, ":") {
+			return nil, fmt.Errorf("invalid REMOTE_STATIONS entry '%s', expected name=url", entry)
+		}
+		key := keys[name]
+		if key == "" {
+			return nil, fmt.Errorf("no key for remote station '%s' in REMOTE_STATION_KEYS", name)
+		}
+		remotes = append(remotes, Remote{Name: name, URL: url, Key: key})
+	}
+	return remotes, nil
+}
+
+func NewProxy(local Scanner, files FileSaver, remotes []Remote, timeout time.Duration) *Proxy {
+	p := &Proxy{
+		Scanner: local,
+		files:   files,
+		clients: make(map[string]*Client),
+		logger:  logging.New(),
+	}
+	for _, r := range remotes {
+		p.clients[r.Name] = NewClient(r, timeout)
+	}
+	return p
+}
+
+// GetScanners returns the local scanners followed by those of all
+// reachable remote stations
+func (p *Proxy) GetScanners() []*scanner.ScannerInfo {
+	return append(p.Scanner.GetScanners(), p.remoteScanners()...)
+}
+
+func (p *Proxy) remoteScanners() []*scanner.ScannerInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if time.Since(p.cachedAt) < listCacheTime {
+		return p.cached
+	}
+
+	var list []*scanner.ScannerInfo
+	for name, client := range p.clients {
+		scanners, err := client.Scanners()
+		if err != nil {
+			p.logger.Warnf("Station proxy: %v", err)
+			continue
+		}
+		for _, s := range scanners {
+			remote := *s
+			remote.Name = fmt.Sprintf("%s (%s)", s.Name, name)
+			remote.Device = devicePrefix + name + ":" + s.Device
+			list = append(list, &remote)
+		}
+	}
+	p.cached, p.cachedAt = list, time.Now()
+	return list
+}
+
+func (p *Proxy) GetScannerCapabilities(device string) (*scanner.Capabilities, error) {
+	client, remoteDevice, ok := p.lookup(device)
+	if !ok {
+		return p.Scanner.GetScannerCapabilities(device)
+	}
+	if client == nil {
+		return nil, fmt.Errorf("scanner device '%s' not found", device)
+	}
+	return client.Capabilities(remoteDevice)
+}
+
+// ScanDocument scans on a remote station if the device belongs to one and
+// stores the pages in the local workspace
+func (p *Proxy) ScanDocument(device string, options *scanner.ScanOptions) ([]string, error) {
+	client, remoteDevice, ok := p.lookup(device)
+	if !ok {
+		return p.Scanner.ScanDocument(device, options)
+	}
+	if client == nil {
+		return nil, fmt.Errorf("scanner device '%s' not found", device)
+	}
+
+	pages, err := client.Scan(ScanRequest{Device: remoteDevice, Options: options})
+	if err != nil {
+		return nil, err
+	}
+
+	var saved []string
+	for _, page := range pages {
+		name := filepath.Base(page.Name)
+		var err error
+		if options != nil && options.Dir != "" {
+			// The workspace of a session
+			err = os.WriteFile(filepath.Join(options.Dir, name), page.Data, 0644)
+		} else {
+			err = p.files.Save(name, bytes.NewReader(page.Data))
+		}
+		if err != nil {
+			return saved, fmt.Errorf("failed to save %s: %v", name, err)
+		}
+		saved = append(saved, name)
+	}
+	p.logger.Infof("Station proxy: Scanned %d pages on %s", len(saved), device)
+	return saved, nil
+}
+
+// lookup resolves remote:<station>:<device>. The client is nil for a
+// remote device of an unknown station.
+func (p *Proxy) lookup(device string) (*Client, string, bool) {
+	if !strings.HasPrefix(device, devicePrefix) {
+		return nil, "", false
+	}
+	name, remoteDevice, _ := strings.Cut(strings.TrimPrefix(device, devicePrefix), ":")
+	return p.clients[name], remoteDevice, true
+}
+
+// IsRemote reports whether a device belongs to a remote station
+func IsRemote(device string) bool {
+	return strings.HasPrefix(device, devicePrefix)
+}
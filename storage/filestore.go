@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"DICOMScanStation/config"
+)
+
+var (
+	ErrNotFound    = errors.New("file not found")
+	ErrInvalidName = errors.New("invalid file name")
+)
+
+type FileInfo struct {
+	Name         string `json:"name"`
+	Size         int64  `json:"size"`
+	ModifiedTime string `json:"modified_time"`
+	Extension    string `json:"extension"`
+}
+
+// LocalFileStore keeps scanned and uploaded files in the configured temp directory
+type LocalFileStore struct {
+	config *config.Config
+	dir    string
+	// sessionMu guards the scan session file
+	sessionMu sync.Mutex
+}
+
+func NewLocalFileStore(cfg *config.Config) *LocalFileStore {
+	return &LocalFileStore{
+		config: cfg,
+		dir:    cfg.TempFilesDir,
+	}
+}
+
+func (fs *LocalFileStore) Dir() string {
+	return fs.dir
+}
+
+// List returns all files in the store with an allowed extension, in the
+// order of the scan session
+func (fs *LocalFileStore) List() ([]FileInfo, error) {
+	fs.sessionMu.Lock()
+	defer fs.sessionMu.Unlock()
+	_, files, err := fs.syncScanSession()
+	if err != nil {
+		return []FileInfo{}, err
+	}
+	return files, nil
+}
+
+// listFiles returns the files with an allowed extension in directory order
+func (fs *LocalFileStore) listFiles() ([]FileInfo, error) {
+	var files []FileInfo
+
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return files, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if !fs.IsAllowedExtension(ext) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		files = append(files, FileInfo{
+			Name:         entry.Name(),
+			Size:         info.Size(),
+			ModifiedTime: info.ModTime().Format("2006-01-02 15:04:05"),
+			Extension:    ext,
+		})
+	}
+
+	return files, nil
+}
+
+// Path returns the absolute path of an existing file in the store
+func (fs *LocalFileStore) Path(name string) (string, error) {
+	if err := validateName(name); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(fs.dir, name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Save writes the content of r into a file with the given name
+func (fs *LocalFileStore) Save(name string, r io.Reader) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	destFile, err := os.Create(filepath.Join(fs.dir, name))
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %v", name, err)
+	}
+	defer destFile.Close()
+
+	if _, err := io.Copy(destFile, r); err != nil {
+		return fmt.Errorf("failed to save file %s: %v", name, err)
+	}
+	return nil
+}
+
+// Delete removes a file from the store
+func (fs *LocalFileStore) Delete(name string) error {
+	path, err := fs.Path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (fs *LocalFileStore) IsAllowedExtension(ext string) bool {
+	for _, allowed := range fs.config.AllowedExtensions {
+		if "."+allowed == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func validateName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return ErrInvalidName
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// scanSessionFile keeps the order and metadata of the pages in the
+// workspace. It is never listed, as its extension is not an allowed one.
+const scanSessionFile = ".scan-session.json"
+
+// ErrInvalidOrder is returned when a new page order does not name every
+// page of the scan session exactly once
+var ErrInvalidOrder = errors.New("the order must list every page of the scan session exactly once")
+
+// Sources of pages
+const (
+	SourceScan   = "scan"
+	SourceUpload = "upload"
+	SourceMobile = "mobile"
+)
+
+// PageInfo describes where a page came from
+type PageInfo struct {
+	// Source is one of the Source constants, empty if unknown
+	Source   string `json:"source,omitempty"`
+	Device   string `json:"device,omitempty"`
+	Operator string `json:"operator,omitempty"`
+}
+
+// Page is a page of the scan session
+type Page struct {
+	Name    string    `json:"name"`
+	AddedAt time.Time `json:"addedAt"`
+	PageInfo
+}
+
+// ScanSession owns the pages of the workspace in the order they are sent.
+// It starts with the first page and ends when the workspace is empty.
+type ScanSession struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Pages     []Page    `json:"pages"`
+}
+
+// ScanSession returns the scan session with the files currently in the
+// workspace; pages added behind its back are appended in the order they
+// were scanned
+func (fs *LocalFileStore) ScanSession() (*ScanSession, error) {
+	fs.sessionMu.Lock()
+	defer fs.sessionMu.Unlock()
+	session, _, err := fs.syncScanSession()
+	return session, err
+}
+
+// Reorder puts the pages of the scan session in the given order
+func (fs *LocalFileStore) Reorder(names []string) (*ScanSession, error) {
+	fs.sessionMu.Lock()
+	defer fs.sessionMu.Unlock()
+	session, _, err := fs.syncScanSession()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]Page, len(session.Pages))
+	for _, p := range session.Pages {
+		byName[p.Name] = p
+	}
+	if len(names) != len(session.Pages) {
+		return nil, ErrInvalidOrder
+	}
+	pages := make([]Page, 0, len(names))
+	for _, name := range names {
+		p, ok := byName[name]
+		if !ok {
+			return nil, ErrInvalidOrder
+		}
+		delete(byName, name)
+		pages = append(pages, p)
+	}
+
+	session.Pages = pages
+	if err := fs.saveScanSession(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Annotate records where the named pages came from
+func (fs *LocalFileStore) Annotate(names []string, info PageInfo) error {
+	fs.sessionMu.Lock()
+	defer fs.sessionMu.Unlock()
+	session, _, err := fs.syncScanSession()
+	if err != nil {
+		return err
+	}
+
+	annotate := make(map[string]bool, len(names))
+	for _, name := range names {
+		annotate[name] = true
+	}
+	for i := range session.Pages {
+		if annotate[session.Pages[i].Name] {
+			session.Pages[i].PageInfo = info
+		}
+	}
+	return fs.saveScanSession(session)
+}
+
+// syncScanSession loads the scan session and brings it in line with the
+// files in the workspace. It also returns the files in session order. The
+// caller must hold sessionMu.
+func (fs *LocalFileStore) syncScanSession() (*ScanSession, []FileInfo, error) {
+	files, err := fs.listFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var session ScanSession
+	path := filepath.Join(fs.dir, scanSessionFile)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &session)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("failed to read scan session: %v", err)
+	}
+
+	// An empty workspace ends the session
+	if len(files) == 0 {
+		if session.ID != "" {
+			os.Remove(path)
+		}
+		return &ScanSession{Pages: []Page{}}, files, nil
+	}
+
+	byName := make(map[string]FileInfo, len(files))
+	for _, f := range files {
+		byName[f.Name] = f
+	}
+	changed := false
+	if session.ID == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		session.ID = hex.EncodeToString(b)
+		session.CreatedAt = time.Now()
+		changed = true
+	}
+
+	// Pages that were deleted leave the session
+	pages := make([]Page, 0, len(files))
+	for _, p := range session.Pages {
+		if _, ok := byName[p.Name]; ok {
+			pages = append(pages, p)
+			delete(byName, p.Name)
+		} else {
+			changed = true
+		}
+	}
+
+	// New pages are appended, the oldest first and batch pages by number
+	var added []FileInfo
+	for _, f := range files {
+		if _, ok := byName[f.Name]; ok {
+			added = append(added, f)
+		}
+	}
+	sort.SliceStable(added, func(i, j int) bool {
+		if added[i].ModifiedTime != added[j].ModifiedTime {
+			return added[i].ModifiedTime < added[j].ModifiedTime
+		}
+		return naturalLess(added[i].Name, added[j].Name)
+	})
+	now := time.Now()
+	for _, f := range added {
+		pages = append(pages, Page{Name: f.Name, AddedAt: now})
+		changed = true
+	}
+	session.Pages = pages
+
+	if changed {
+		if err := fs.saveScanSession(&session); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ordered := make([]FileInfo, 0, len(files))
+	all := make(map[string]FileInfo, len(files))
+	for _, f := range files {
+		all[f.Name] = f
+	}
+	for _, p := range session.Pages {
+		ordered = append(ordered, all[p.Name])
+	}
+	return &session, ordered, nil
+}
+
+// saveScanSession writes the scan session atomically. The caller must hold
+// sessionMu.
+func (fs *LocalFileStore) saveScanSession(session *ScanSession) error {
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(fs.dir, scanSessionFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to save scan session: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save scan session: %v", err)
+	}
+	return nil
+}
+
+// naturalLess compares names with their numbers by value, so page 10 of a
+// batch comes after page 9
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := digitPrefix(a), digitPrefix(b)
+		if da != "" && db != "" {
+			na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func digitPrefix(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
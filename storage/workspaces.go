@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"DICOMScanStation/config"
+)
+
+// SessionsDir holds the working directories of the sessions below
+// TEMP_FILES_DIR
+const SessionsDir = "sessions"
+
+// workspaceIdle is how long an empty workspace is kept for its session
+const workspaceIdle = 24 * time.Hour
+
+// ErrInvalidWorkspace is returned for a malformed workspace ID
+var ErrInvalidWorkspace = errors.New("invalid workspace")
+
+var workspaceIDPattern = regexp.MustCompile(`^[a-f0-9]{16,64}$`)
+
+// Workspaces give every session of the web interface its own working
+// directory with WORKSPACE_SESSIONS, so operators at different scanners
+// scan, review and send at the same time without seeing each other's pages
+type Workspaces struct {
+	config *config.Config
+	dir    string
+	mu     sync.Mutex
+	stores map[string]*LocalFileStore
+}
+
+func NewWorkspaces(cfg *config.Config) *Workspaces {
+	return &Workspaces{
+		config: cfg,
+		dir:    filepath.Join(cfg.TempFilesDir, SessionsDir),
+		stores: make(map[string]*LocalFileStore),
+	}
+}
+
+// NewWorkspaceID returns the ID of a new workspace
+func NewWorkspaceID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ValidWorkspaceID reports whether id can name a workspace
+func ValidWorkspaceID(id string) bool {
+	return workspaceIDPattern.MatchString(id)
+}
+
+// Workspace returns the store of a workspace, creating its directory on
+// first use
+func (w *Workspaces) Workspace(id string) (*LocalFileStore, error) {
+	if !ValidWorkspaceID(id) {
+		return nil, ErrInvalidWorkspace
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if store, ok := w.stores[id]; ok {
+		return store, nil
+	}
+	dir := filepath.Join(w.dir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	store := &LocalFileStore{config: w.config, dir: dir}
+	w.stores[id] = store
+	return store, nil
+}
+
+// IDs returns the IDs of the workspaces in TEMP_FILES_DIR/sessions
+func (w *Workspaces) IDs() ([]string, error) {
+	entries, err := os.ReadDir(w.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() && ValidWorkspaceID(entry.Name()) {
+			ids = append(ids, entry.Name())
+		}
+	}
+	return ids, nil
+}
+
+// Prune removes the directories of workspaces that hold no pages and were
+// not used for maxIdle. Workspaces with pages are kept until the pages are
+// sent or deleted.
+func (w *Workspaces) Prune(maxIdle time.Duration) (int, error) {
+	entries, err := os.ReadDir(w.dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	removed := 0
+	for _, entry := range entries {
+		if !entry.IsDir() || !ValidWorkspaceID(entry.Name()) {
+			continue
+		}
+		store, ok := w.stores[entry.Name()]
+		if !ok {
+			store = &LocalFileStore{config: w.config, dir: filepath.Join(w.dir, entry.Name())}
+		}
+		files, err := store.listFiles()
+		if err != nil || len(files) > 0 {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxIdle {
+			continue
+		}
+		if err := os.RemoveAll(store.dir); err != nil {
+			continue
+		}
+		delete(w.stores, entry.Name())
+		removed++
+	}
+	return removed, nil
+}
+
+// StartJanitor prunes idle empty workspaces periodically until ctx is
+// cancelled
+func (w *Workspaces) StartJanitor(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		w.Prune(workspaceIdle)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Package support assembles diagnostics bundles for support tickets. Every
+// file that goes into a bundle passes the redactor, so a bundle can leave
+// the hospital without secrets or patient identifiers in it.
+package support
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// started is used for the uptime in the version information
+var started = time.Now()
+
+// Version describes the running build
+type Version struct {
+	App       string    `json:"app"`
+	Version   string    `json:"version"`
+	GoVersion string    `json:"goVersion"`
+	Platform  string    `json:"platform"`
+	Revision  string    `json:"revision,omitempty"`
+	BuildTime string    `json:"buildTime,omitempty"`
+	Modified  bool      `json:"modified,omitempty"`
+	Started   time.Time `json:"started"`
+	Uptime    string    `json:"uptime"`
+}
+
+// CurrentVersion returns the version of app with the build information the
+// Go toolchain embedded
+func CurrentVersion(app, version string) Version {
+	v := Version{
+		App:       app,
+		Version:   version,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Started:   started,
+		Uptime:    time.Since(started).Round(time.Second).String(),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				v.Revision = s.Value
+			case "vcs.time":
+				v.BuildTime = s.Value
+			case "vcs.modified":
+				v.Modified = s.Value == "true"
+			}
+		}
+	}
+	return v
+}
+
+// manifestEntry lists a file of the bundle, or why it is missing
+type manifestEntry struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+// Bundle writes a redacted zip archive
+type Bundle struct {
+	zip      *zip.Writer
+	redactor *Redactor
+	created  time.Time
+	manifest []manifestEntry
+}
+
+func NewBundle(w io.Writer, redactor *Redactor) *Bundle {
+	return &Bundle{
+		zip:      zip.NewWriter(w),
+		redactor: redactor,
+		created:  time.Now(),
+	}
+}
+
+// AddText adds a redacted text file
+func (b *Bundle) AddText(name, text string) error {
+	return b.add(name, []byte(b.redactor.Redact(text)))
+}
+
+// AddJSON adds v as an indented JSON file, with the patient fields of
+// records replaced by their key rather than by the text patterns
+func (b *Bundle) AddJSON(name string, v interface{}) error {
+	data, err := b.redactor.RedactJSON(v)
+	if err != nil {
+		b.AddError(name, err)
+		return nil
+	}
+	return b.add(name, data)
+}
+
+// add writes a file that is already redacted
+func (b *Bundle) add(name string, data []byte) error {
+	f, err := b.zip.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: b.created,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	b.manifest = append(b.manifest, manifestEntry{Name: name})
+	return nil
+}
+
+// AddError records in the manifest that a file could not be collected
+func (b *Bundle) AddError(name string, err error) {
+	b.manifest = append(b.manifest, manifestEntry{Name: name, Error: b.redactor.Redact(err.Error())})
+}
+
+// Close writes the manifest and finishes the archive
+func (b *Bundle) Close() error {
+	data, err := json.MarshalIndent(struct {
+		Created time.Time       `json:"created"`
+		Files   []manifestEntry `json:"files"`
+	}{b.created, b.manifest}, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := b.zip.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Deflate, Modified: b.created})
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return b.zip.Close()
+}
@@ -0,0 +1,127 @@
+package support
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"DICOMScanStation/config"
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/scanner"
+)
+
+// dialTimeout bounds each PACS reachability check
+const dialTimeout = 3 * time.Second
+
+// minFreeBytes warns about directories that are about to fill up
+const minFreeBytes = 500 * 1024 * 1024
+
+// Check is the result of one diagnostic check
+type Check struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// RunDiagnostics checks the tools, directories and PACS connections the
+// station depends on
+func RunDiagnostics(cfg *config.Config) []Check {
+	var checks []Check
+
+	checks = append(checks, checkExecutable("pdftoppm", filepath.Join(cfg.PopplerPath, "pdftoppm")))
+	if cfg.OCREnabled {
+		checks = append(checks, checkExecutable("tesseract", cfg.OCRTesseractPath))
+	}
+	if path, err := exec.LookPath("scanimage"); err != nil {
+		checks = append(checks, Check{Name: "scanimage", Detail: err.Error()})
+	} else {
+		checks = append(checks, checkExecutable("scanimage", path))
+	}
+	for _, host := range cfg.ScannerNetHosts {
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		checks = append(checks, checkReachable("saned "+host, host, scanner.SanedPort, nil))
+	}
+
+	dirs := []struct{ name, path string }{
+		{"temp directory", cfg.TempFilesDir},
+		{"state directory", cfg.StateDir},
+		{"pending directory", cfg.PendingDir},
+	}
+	if cfg.ArchiveEnabled {
+		dirs = append(dirs, struct{ name, path string }{"archive directory", cfg.ArchiveDir})
+	}
+	for _, d := range dirs {
+		checks = append(checks, checkDirectory(d.name, d.path))
+	}
+
+	tlsConfig, err := dicom.LoadTLSConfig(cfg)
+	if err != nil {
+		checks = append(checks, Check{Name: "DICOM TLS", Detail: err.Error()})
+	}
+	checks = append(checks,
+		checkReachable("query SCP", cfg.DicomQueryHost, cfg.DicomFindscuPort, tlsConfig),
+		checkReachable("store SCP", cfg.DicomStoreHost, cfg.DicomStorescuPort, tlsConfig),
+	)
+	return checks
+}
+
+func checkExecutable(name, path string) Check {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Check{Name: name, Detail: err.Error()}
+	}
+	if info.Mode()&0111 == 0 {
+		return Check{Name: name, Detail: path + " is not executable"}
+	}
+	return Check{Name: name, OK: true, Detail: path}
+}
+
+// checkDirectory verifies a directory is writable and has space left
+func checkDirectory(name, path string) Check {
+	f, err := os.CreateTemp(path, ".diagnostics-*")
+	if err != nil {
+		return Check{Name: name, Detail: err.Error()}
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return Check{Name: name, Detail: err.Error()}
+	}
+	free := fs.Bavail * uint64(fs.Bsize)
+	detail := fmt.Sprintf("%s, %d MB free", path, free/(1024*1024))
+	return Check{Name: name, OK: free >= minFreeBytes, Detail: detail}
+}
+
+// checkReachable opens a TCP connection, with the TLS handshake if DICOM
+// TLS is enabled; it does not open an association
+func checkReachable(name, host string, port int, tlsConfig *tls.Config) Check {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	start := time.Now()
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if tlsConfig == nil {
+		conn, err := dialer.Dial("tcp", address)
+		if err != nil {
+			return Check{Name: name, Detail: err.Error()}
+		}
+		conn.Close()
+		return Check{Name: name, OK: true, Detail: fmt.Sprintf("%s reachable in %v", address, time.Since(start).Round(time.Millisecond))}
+	}
+
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	if err != nil {
+		return Check{Name: name, Detail: err.Error()}
+	}
+	state := conn.ConnectionState()
+	conn.Close()
+	return Check{Name: name, OK: true, Detail: fmt.Sprintf("%s reachable over %s (%s) in %v", address,
+		tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite), time.Since(start).Round(time.Millisecond))}
+}
@@ -0,0 +1,86 @@
+package support
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// logTimeout bounds reading the journal
+const logTimeout = 20 * time.Second
+
+// LogSource is a log collected for the bundle
+type LogSource struct {
+	// Name is the file name in the archive
+	Name string
+	Text string
+	Err  error
+}
+
+// CollectLogs reads the last lines of the systemd journal of unit and of
+// the given log files. Sources that cannot be read carry their error, so
+// the bundle says why a log is missing.
+func CollectLogs(unit string, files []string, lines int) []LogSource {
+	var sources []LogSource
+	if unit != "" {
+		text, err := journal(unit, lines)
+		sources = append(sources, LogSource{Name: "journal.log", Text: text, Err: err})
+	}
+	for _, path := range files {
+		if path == "" {
+			continue
+		}
+		text, err := tail(path, lines)
+		sources = append(sources, LogSource{Name: filepath.Base(path), Text: text, Err: err})
+	}
+	return sources
+}
+
+func journal(unit string, lines int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), logTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "journalctl", "-u", unit, "-o", "short-iso", "--no-pager", "-n", strconv.Itoa(lines))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("journalctl failed: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return string(out), nil
+}
+
+// tail returns the last lines of a file
+func tail(path string, lines int) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	ring := make([]string, 0, lines)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(ring) == lines {
+			ring = ring[1:]
+		}
+		ring = append(ring, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	for _, line := range ring {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.String(), nil
+}
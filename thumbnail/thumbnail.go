@@ -0,0 +1,136 @@
+// Package thumbnail renders small previews of the pages in the workspace, so
+// the file list does not load full-resolution scans.
+package thumbnail
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/tiff"
+)
+
+// maxAge is how long a thumbnail is kept after it was rendered; thumbnails
+// of pages that were deleted are removed after that
+const maxAge = 24 * time.Hour
+
+// Cache renders thumbnails on first request and keeps them in a directory.
+// A thumbnail is rendered again when its page changed, e.g. was rotated.
+type Cache struct {
+	dir  string
+	size int
+	// mu serializes rendering; decoding a scan takes a lot of memory
+	mu sync.Mutex
+}
+
+// NewCache keeps thumbnails with a longest side of size pixels in dir
+func NewCache(dir string, size int) *Cache {
+	return &Cache{dir: dir, size: size}
+}
+
+// Get returns the path of the thumbnail of the image at src, rendering it if
+// there is none for the current content of src
+func (c *Cache) Get(src string) (string, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(src))
+	key := hex.EncodeToString(sum[:8])
+	path := filepath.Join(c.dir, fmt.Sprintf("%s-%d-%d-%d.jpg", key, c.size, info.Size(), info.ModTime().UnixNano()))
+
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Another request may have rendered it in the meantime
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return "", err
+	}
+	if err := c.render(src, path); err != nil {
+		return "", err
+	}
+	c.prune(key, path)
+	return path, nil
+}
+
+func (c *Cache) render(src string, path string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %v", filepath.Base(src), err)
+	}
+
+	tmp, err := os.CreateTemp(c.dir, "render-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := jpeg.Encode(tmp, scale(img, c.size), &jpeg.Options{Quality: 80}); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode thumbnail: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// prune removes older thumbnails of the same page and thumbnails that were
+// not rendered again within maxAge
+func (c *Cache) prune(key string, current string) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		path := filepath.Join(c.dir, entry.Name())
+		if path == current {
+			continue
+		}
+		if strings.HasPrefix(entry.Name(), key+"-") {
+			os.Remove(path)
+			continue
+		}
+		if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > maxAge {
+			os.Remove(path)
+		}
+	}
+}
+
+// scale shrinks an image so its longest side is at most size
+func scale(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	if w >= h {
+		h = max(1, h*size/w)
+		w = size
+	} else {
+		w = max(1, w*size/h)
+		h = size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
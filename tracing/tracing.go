@@ -0,0 +1,86 @@
+// Package tracing records spans of the scan and send pipeline and exports
+// them over OTLP, so the time an upload takes can be broken down into
+// scanning, converting, tagging and storing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"DICOMScanStation/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "DICOMScanStation"
+
+// Setup exports spans to the OTLP/HTTP collector of
+// OTEL_EXPORTER_OTLP_ENDPOINT. Without an endpoint spans are not recorded.
+// The returned function flushes the spans not yet exported.
+func Setup(cfg *config.Config) (func(context.Context) error, error) {
+	endpoint := strings.TrimRight(strings.TrimSpace(cfg.TracingEndpoint), "/")
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	// Headers, timeouts and the sampler follow the other OTEL_* variables
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint+"/v1/traces"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the OTLP exporter: %v", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(cfg.TracingServiceName),
+		semconv.ServiceVersion(cfg.AppVersion),
+		attribute.String("dicom.ae_title", cfg.DicomLocalAETitle),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// Start begins a span as a child of the span in ctx; a nil ctx starts a new
+// trace
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends a span, marking it failed with err
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// StartRequest begins the span of an HTTP request to route, continuing the
+// trace of a client that sends a traceparent header
+func StartRequest(req *http.Request, route string) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+	return otel.Tracer(tracerName).Start(ctx, req.Method+" "+route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.HTTPRoute(route),
+		))
+}
@@ -0,0 +1,165 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"DICOMScanStation/alerts"
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/faults"
+	"DICOMScanStation/scanner"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (r *Router) listAlerts(c *gin.Context) {
+	list := r.alerts.List(c.Query("all") == "true")
+	c.JSON(http.StatusOK, gin.H{
+		"alerts": list,
+		"total":  len(list),
+	})
+}
+
+func (r *Router) acknowledgeAlert(c *gin.Context) {
+	if err := r.alerts.Acknowledge(c.Param("id")); err != nil {
+		if errors.Is(err, alerts.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Alert acknowledged"})
+}
+
+// runBenchmark sends a synthetic batch to the PACS or a test AE and reports
+// the throughput per concurrency and transfer syntax
+func (r *Router) runBenchmark(c *gin.Context) {
+	var req dicom.BenchmarkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid benchmark request"})
+		return
+	}
+
+	report, err := r.benchmark.Benchmark(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// listQueuedJobs shows the recent studies of the shared send queue
+func (r *Router) listQueuedJobs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	jobs, err := r.queue.QueuedJobs(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs, "total": len(jobs)})
+}
+
+// retryQueuedJob puts a study the sender gave up on back into the queue
+func (r *Router) retryQueuedJob(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	if err := r.queue.RetryQueuedJob(id); err != nil {
+		if errors.Is(err, dicom.ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Job queued again"})
+}
+
+// listOutbox shows the instances waiting for another attempt
+func (r *Router) listOutbox(c *gin.Context) {
+	entries, err := r.outbox.OutboxEntries()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "total": len(entries)})
+}
+
+// retryOutboxEntry retries an instance without waiting for its backoff
+func (r *Router) retryOutboxEntry(c *gin.Context) {
+	if err := r.outbox.RetryOutboxEntry(c.Param("id")); err != nil {
+		if errors.Is(err, dicom.ErrOutboxEntryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Instance will be sent again shortly"})
+}
+
+// deleteOutboxEntry discards an instance that should not reach the PACS
+func (r *Router) deleteOutboxEntry(c *gin.Context) {
+	if err := r.outbox.DeleteOutboxEntry(c.Param("id")); err != nil {
+		if errors.Is(err, dicom.ErrOutboxEntryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	r.logger.Warnf("Outbox entry %s discarded from %s", c.Param("id"), c.ClientIP())
+	r.auditDelete(c, c.Param("id"), map[string]string{"outbox": c.Param("id")})
+	c.JSON(http.StatusOK, gin.H{"message": "Instance removed from the outbox"})
+}
+
+func (r *Router) getFaults(c *gin.Context) {
+	c.JSON(http.StatusOK, r.faults.Settings())
+}
+
+func (r *Router) setFaults(c *gin.Context) {
+	var settings faults.Settings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fault settings"})
+		return
+	}
+	if err := r.faults.SetSettings(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// restartScanners recovers from a wedged SANE backend without restarting the
+// service. An empty body restarts detection only.
+func (r *Router) restartScanners(c *gin.Context) {
+	var opts scanner.RestartOptions
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&opts); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid restart options"})
+			return
+		}
+	}
+
+	r.logger.Warnf("Scanner subsystem restart requested from %s", c.ClientIP())
+	result, err := r.scannerAdmin.Restart(opts)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Scanner subsystem restarted",
+		"result":  result,
+	})
+}
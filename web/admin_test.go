@@ -0,0 +1,227 @@
+package web_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"DICOMScanStation/alerts"
+	"DICOMScanStation/auth"
+	"DICOMScanStation/config"
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/faults"
+	"DICOMScanStation/history"
+	"DICOMScanStation/profiles"
+	"DICOMScanStation/scanner"
+	"DICOMScanStation/web"
+	"DICOMScanStation/web/fakes"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testPassword is the password of every account of testConfig
+const testPassword = "secret"
+
+// testConfig returns the configuration of a station working in temporary
+// directories without the web interface, with vars set on top
+func testConfig(t *testing.T, vars map[string]string) *config.Config {
+	t.Setenv("TEMP_FILES_DIR", t.TempDir())
+	t.Setenv("STATE_DIR", t.TempDir())
+	t.Setenv("FEATURE_WEB_UI", "false")
+	for key, value := range vars {
+		t.Setenv(key, value)
+	}
+	return config.LoadConfig()
+}
+
+// usersFile writes a users file with the accounts, all with testPassword
+func usersFile(t *testing.T, users ...string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines strings.Builder
+	for _, user := range users {
+		lines.WriteString(user + ":" + string(hash) + "\n")
+	}
+	path := filepath.Join(t.TempDir(), "users")
+	if err := os.WriteFile(path, []byte(lines.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestRouter(cfg *config.Config, services web.Services) *gin.Engine {
+	if services.Scanners == nil {
+		services.Scanners = &fakes.ScannerService{}
+	}
+	if services.Files == nil {
+		services.Files = fakes.NewFileStore()
+	}
+	if services.Dicom == nil {
+		services.Dicom = &fakes.DicomGateway{}
+	}
+	router := web.NewRouter(cfg, services)
+	router.SetupRoutes()
+	return router.GetEngine()
+}
+
+// request sends a request with a JSON body and the cookies given
+func request(handler http.Handler, method, path, body string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+// signIn logs user in and returns the session cookie
+func signIn(t *testing.T, handler http.Handler, user string) *http.Cookie {
+	w := request(handler, http.MethodPost, "/api/login", `{"username": "`+user+`", "password": "`+testPassword+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login of %s: %d %s", user, w.Code, w.Body)
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Value != "" {
+			return cookie
+		}
+	}
+	t.Fatalf("login of %s set no cookie", user)
+	return nil
+}
+
+type scannerAdmin struct{}
+
+func (scannerAdmin) Restart(opts scanner.RestartOptions) (*scanner.RestartResult, error) {
+	return &scanner.RestartResult{}, nil
+}
+
+type benchmark struct{}
+
+func (benchmark) Benchmark(req dicom.BenchmarkRequest) (*dicom.BenchmarkReport, error) {
+	return nil, errors.New("no PACS")
+}
+
+// adminStation returns a station with login, "admin" as administrator, and
+// every administration endpoint that works without a PACS
+func adminStation(t *testing.T) (*gin.Engine, *auth.APIKeys) {
+	cfg := testConfig(t, map[string]string{
+		"AUTH_USERS_FILE":  usersFile(t, "admin", "operator"),
+		"AUTH_ADMIN_USERS": "admin",
+		"DEMO_MODE":        "true",
+		"FAULT_INJECTION":  "true",
+	})
+	apiKeys, err := auth.NewAPIKeys(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profileStore, err := profiles.NewStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	historyStore, err := history.NewStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestRouter(cfg, web.Services{
+		ScannerAdmin: scannerAdmin{},
+		Alerts:       alerts.NewStore(),
+		Faults:       faults.NewInjector(cfg),
+		Config:       config.NewReloader(cfg),
+		APIKeys:      apiKeys,
+		Profiles:     profileStore,
+		History:      historyStore,
+		Benchmark:    benchmark{},
+	}), apiKeys
+}
+
+// isAdministration tells whether a route is for administrators only
+func isAdministration(route gin.RouteInfo) bool {
+	return strings.HasPrefix(route.Path, "/api/admin/") || strings.HasPrefix(route.Path, "/api/reports/") ||
+		(strings.HasPrefix(route.Path, "/api/scan-profiles") && route.Method != http.MethodGet)
+}
+
+func TestAdministrationRequiresAdmin(t *testing.T) {
+	engine, _ := adminStation(t)
+	operator := signIn(t, engine, "operator")
+
+	var checked []string
+	for _, route := range engine.Routes() {
+		if !isAdministration(route) {
+			continue
+		}
+		path := strings.NewReplacer(":id", "1", ":client", "10.0.0.1").Replace(route.Path)
+		w := request(engine, route.Method, path, "{}", operator)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s as operator: %d, want 403", route.Method, route.Path, w.Code)
+		}
+		checked = append(checked, route.Method+" "+route.Path)
+	}
+
+	// The routes named by the services above must all be there
+	for _, want := range []string{
+		"POST /api/admin/scanner/restart",
+		"POST /api/admin/benchmark",
+		"POST /api/admin/alerts/:id/ack",
+		"PUT /api/admin/faults",
+		"POST /api/admin/api-keys",
+		"PUT /api/admin/config",
+		"DELETE /api/admin/lockouts/:client",
+		"POST /api/admin/support-bundle",
+		"POST /api/scan-profiles",
+		"GET /api/reports/shift",
+	} {
+		if !strings.Contains(strings.Join(checked, "\n")+"\n", want+"\n") {
+			t.Errorf("%s is not registered", want)
+		}
+	}
+}
+
+func TestAdministrationForAdmins(t *testing.T) {
+	engine, apiKeys := adminStation(t)
+	admin := signIn(t, engine, "admin")
+	if w := request(engine, http.MethodGet, "/api/admin/lockouts", "", admin); w.Code != http.StatusOK {
+		t.Errorf("lockouts as admin: %d, want 200", w.Code)
+	}
+
+	tests := []struct {
+		name   string
+		scopes []string
+		method string
+		path   string
+		want   int
+	}{
+		{"admin key", []string{auth.ScopeAdmin}, http.MethodGet, "/api/admin/lockouts", http.StatusOK},
+		{"scan key on the administration", []string{auth.ScopeScan}, http.MethodGet, "/api/admin/lockouts", http.StatusForbidden},
+		{"scan key lists profiles", []string{auth.ScopeScan}, http.MethodGet, "/api/scan-profiles", http.StatusOK},
+		{"scan key changes profiles", []string{auth.ScopeScan}, http.MethodPost, "/api/scan-profiles", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, key, err := apiKeys.Create(tt.name, tt.scopes, "admin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewReader([]byte("{}")))
+			req.Header.Set("X-API-Key", key)
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("%s %s: %d %s, want %d", tt.method, tt.path, w.Code, w.Body, tt.want)
+			}
+		})
+	}
+}
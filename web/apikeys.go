@@ -0,0 +1,153 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"DICOMScanStation/audit"
+	"DICOMScanStation/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyHeader carries the API key of a programmatic client, as does an
+// Authorization header with a bearer token
+const apiKeyHeader = "X-API-Key"
+
+// apiKeyContextKey holds the auth.APIKey of requests authenticated with one
+const apiKeyContextKey = "apiKey"
+
+// apiKeyScopes are the API endpoints each scope allows, by path prefix.
+// Reports, queues and settings are not open to API keys at all.
+var apiKeyScopes = map[string][]string{
+	auth.ScopeScan:    {"/api/scanners", "/api/scan", "/api/scan-profiles"},
+	auth.ScopeFiles:   {"/api/files", "/api/scan-session"},
+	auth.ScopeDicom:   {"/api/dicom", "/api/workflow"},
+	auth.ScopeArchive: {"/api/archive", "/api/documents", "/api/jobs"},
+	auth.ScopePending: {"/api/pending"},
+	auth.ScopeAdmin:   {"/api/admin"},
+}
+
+// presentedAPIKey returns the API key a request carries, "" if none
+func presentedAPIKey(c *gin.Context) string {
+	if key := strings.TrimSpace(c.GetHeader(apiKeyHeader)); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// apiKeyAllows reports whether a key may call the endpoint of path
+func apiKeyAllows(key auth.APIKey, path string) bool {
+	if path == "/api/me" {
+		return true
+	}
+	for _, scope := range key.Scopes {
+		for _, prefix := range apiKeyScopes[scope] {
+			if path == prefix || strings.HasPrefix(path, prefix+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authenticateAPIKey checks the API key of requests that present one and
+// holds requests outside its scopes back. The client acts as "api:<name>"
+// of the key. Requests without a key are left to the login.
+func (r *Router) authenticateAPIKey(c *gin.Context) {
+	presented := presentedAPIKey(c)
+	if presented == "" {
+		c.Next()
+		return
+	}
+	if !r.checkLockout(c, "") {
+		return
+	}
+	key, ok := r.apiKeys.Lookup(presented)
+	if !ok {
+		r.authFailed(c, "api_key", "")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		return
+	}
+	r.authSucceeded(c, "")
+	if !apiKeyAllows(key, c.FullPath()) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "The API key does not allow this request"})
+		return
+	}
+	c.Set(apiKeyContextKey, key)
+	c.Set(userContextKey, "api:"+key.Name)
+	c.Next()
+}
+
+// withoutHash is an API key as listed, without the hash of the key
+func withoutHash(key auth.APIKey) auth.APIKey {
+	key.Hash = ""
+	return key
+}
+
+func (r *Router) listAPIKeys(c *gin.Context) {
+	keys := r.apiKeys.List()
+	list := make([]auth.APIKey, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, withoutHash(key))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"keys":   list,
+		"total":  len(list),
+		"scopes": auth.Scopes,
+	})
+}
+
+// createAPIKey adds a key; the key itself is only in this response
+func (r *Router) createAPIKey(c *gin.Context) {
+	var req struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key"})
+		return
+	}
+
+	user := r.currentUser(c)
+	key, secret, err := r.apiKeys.Create(req.Name, req.Scopes, user)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	r.recordAudit(c, audit.Event{
+		User:    user,
+		Action:  audit.ActionAPIKeyCreate,
+		Target:  key.Name,
+		Details: map[string]string{"id": key.ID, "scopes": strings.Join(key.Scopes, ",")},
+	})
+	r.logger.Infof("API key '%s' created with scopes %s", key.Name, strings.Join(key.Scopes, ", "))
+	c.JSON(http.StatusCreated, gin.H{
+		"apiKey": withoutHash(key),
+		"key":    secret,
+	})
+}
+
+func (r *Router) revokeAPIKey(c *gin.Context) {
+	key, err := r.apiKeys.Revoke(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, auth.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	r.recordAudit(c, audit.Event{
+		User:    r.currentUser(c),
+		Action:  audit.ActionAPIKeyRevoke,
+		Target:  key.Name,
+		Details: map[string]string{"id": key.ID},
+	})
+	r.logger.Infof("API key '%s' revoked", key.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
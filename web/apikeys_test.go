@@ -0,0 +1,42 @@
+package web
+
+import (
+	"testing"
+
+	"DICOMScanStation/auth"
+)
+
+func TestAPIKeyAllows(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		path   string
+		want   bool
+	}{
+		{"own identity without scope", nil, "/api/me", true},
+		{"exact prefix", []string{auth.ScopeScan}, "/api/scanners", true},
+		{"below prefix", []string{auth.ScopeScan}, "/api/scanners/epson/scan", true},
+		{"prefix of another word", []string{auth.ScopeScan}, "/api/scannersX", false},
+		{"other scope", []string{auth.ScopeScan}, "/api/files", false},
+		{"second scope", []string{auth.ScopeScan, auth.ScopeFiles}, "/api/files/page1.jpg", true},
+		{"dicom", []string{auth.ScopeDicom}, "/api/dicom/patients", true},
+		{"archive", []string{auth.ScopeArchive}, "/api/jobs/42", true},
+		{"pending", []string{auth.ScopePending}, "/api/pending", true},
+		{"admin manages keys", []string{auth.ScopeAdmin}, "/api/admin/api-keys", true},
+		{"admin changes settings", []string{auth.ScopeAdmin}, "/api/admin/config/reload", true},
+		{"admin lifts lockouts", []string{auth.ScopeAdmin}, "/api/admin/lockouts/:client", true},
+		{"admin prefix of another word", []string{auth.ScopeAdmin}, "/api/administration", false},
+		{"admin has no reports", []string{auth.ScopeAdmin}, "/api/reports/shift", false},
+		{"admin does not scan", []string{auth.ScopeAdmin}, "/api/scan", false},
+		{"scan does not manage keys", []string{auth.ScopeScan}, "/api/admin/api-keys", false},
+		{"unknown scope", []string{"everything"}, "/api/scan", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := auth.APIKey{Name: "test", Scopes: tt.scopes}
+			if got := apiKeyAllows(key, tt.path); got != tt.want {
+				t.Errorf("apiKeyAllows(%v, %q) = %v, want %v", tt.scopes, tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"DICOMScanStation/archive"
+	"DICOMScanStation/audit"
+	"DICOMScanStation/dicom"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (r *Router) listArchive(c *gin.Context) {
+	studies, err := r.archive.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"studies":        studies,
+		"total":          len(studies),
+		"retention_days": r.config.ArchiveRetentionDays,
+	})
+}
+
+func (r *Router) getArchivedStudy(c *gin.Context) {
+	study, err := r.archive.Get(c.Param("studyUid"))
+	if err != nil {
+		r.archiveError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, study)
+}
+
+func (r *Router) getArchivedFile(c *gin.Context) {
+	rc, instance, err := r.archive.Open(c.Param("studyUid"), c.Param("filename"))
+	if err != nil {
+		r.archiveError(c, err)
+		return
+	}
+	defer rc.Close()
+
+	// Compressed instances are delivered decompressed
+	c.DataFromReader(http.StatusOK, instance.Size, "application/dicom", rc, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", instance.Filename),
+	})
+}
+
+// getArchiveStats reports the disk space saved by compressing the archive
+func (r *Router) getArchiveStats(c *gin.Context) {
+	stats, err := r.archive.Stats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+func (r *Router) resendArchivedStudy(c *gin.Context) {
+	studyUID := c.Param("studyUid")
+	r.logger.Infof("Re-sending archived study %s", studyUID)
+
+	progress, err := r.dicomService.ResendArchived(studyUID)
+	if !errors.Is(err, archive.ErrNotFound) {
+		r.auditSend(c, r.currentUser(c), dicom.PatientInfo{}, studyUID, nil, progress, err)
+	}
+	if err != nil {
+		r.archiveError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Archived study re-sent",
+		"progress": progress,
+		"success":  countCompleted(progress),
+		"total":    len(progress),
+	})
+}
+
+// getArchivedPDF downloads the study as a PDF/A-2b document
+func (r *Router) getArchivedPDF(c *gin.Context) {
+	data, study, err := r.exporter.PDF(c.Param("studyUid"))
+	if err != nil {
+		r.archiveError(c, err)
+		return
+	}
+	r.auditExport(c, study.StudyInstanceUID, study.PatientID, "download")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.pdf", study.StudyInstanceUID))
+	c.Data(http.StatusOK, "application/pdf", data)
+}
+
+// exportArchivedStudy writes the PDF/A document to the export share
+func (r *Router) exportArchivedStudy(c *gin.Context) {
+	if r.config.ExportDir == "" {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "EXPORT_DIR is not configured"})
+		return
+	}
+
+	path, err := r.exporter.ToShare(c.Param("studyUid"))
+	if err != nil {
+		r.archiveError(c, err)
+		return
+	}
+	r.auditExport(c, c.Param("studyUid"), "", path)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Study exported",
+		"path":    path,
+	})
+}
+
+// DocumentResult is an archived study with links for download and re-export
+type DocumentResult struct {
+	archive.Study
+	Links DocumentLinks `json:"links"`
+}
+
+type DocumentLinks struct {
+	Self   string   `json:"self"`
+	Resend string   `json:"resend"`
+	Files  []string `json:"files"`
+}
+
+func (r *Router) searchDocuments(c *gin.Context) {
+	q := archive.Query{
+		Patient:      c.Query("patient"),
+		DocumentType: c.Query("type"),
+		Text:         c.Query("text"),
+	}
+
+	// Dates are inclusive calendar days
+	if from := c.Query("from"); from != "" {
+		t, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' date, expected YYYY-MM-DD"})
+			return
+		}
+		q.From = t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' date, expected YYYY-MM-DD"})
+			return
+		}
+		q.To = t.AddDate(0, 0, 1)
+	}
+
+	studies, err := r.archive.Search(q)
+	r.auditQuery(c, audit.ActionDocumentSearch, q.Patient, map[string]string{
+		audit.DetailQuery: c.Request.URL.RawQuery,
+	}, len(studies), err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]DocumentResult, 0, len(studies))
+	for _, study := range studies {
+		base := "/api/archive/" + url.PathEscape(study.StudyInstanceUID)
+		links := DocumentLinks{
+			Self:   base,
+			Resend: base + "/resend",
+		}
+		for _, instance := range study.Instances {
+			links.Files = append(links.Files, base+"/files/"+url.PathEscape(instance.Filename))
+		}
+		results = append(results, DocumentResult{Study: study, Links: links})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"documents": results,
+		"total":     len(results),
+	})
+}
+
+func (r *Router) archiveError(c *gin.Context, err error) {
+	if errors.Is(err, archive.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
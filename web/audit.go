@@ -0,0 +1,115 @@
+package web
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"DICOMScanStation/audit"
+	"DICOMScanStation/dicom"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordAudit writes an event of the request to the audit trail. A failure
+// is logged, the action itself has already happened.
+func (r *Router) recordAudit(c *gin.Context, event audit.Event) {
+	if r.audit == nil {
+		return
+	}
+	event.Client = c.ClientIP()
+	for key, value := range event.Details {
+		if value == "" {
+			delete(event.Details, key)
+		}
+	}
+	if err := r.audit.Record(event); err != nil {
+		r.logger.Errorf("Failed to record %s of %s in the audit trail: %v", event.Action, event.Target, err)
+	}
+}
+
+// auditSend records who sent which files of a patient to the PACS; err is
+// the failure of the send, if it failed
+func (r *Router) auditSend(c *gin.Context, user string, patient dicom.PatientInfo, studyUID string, filePaths []string, progress []dicom.FileProgress, err error) {
+	files := make([]string, 0, len(filePaths))
+	for _, path := range filePaths {
+		files = append(files, filepath.Base(path))
+	}
+	// Released and re-sent studies are known by their progress
+	if len(filePaths) == 0 {
+		for _, p := range progress {
+			files = append(files, p.Filename)
+		}
+	}
+	target := patient.PatientID
+	if target == "" {
+		target = studyUID
+	}
+	details := map[string]string{
+		audit.DetailPatientID:   patient.PatientID,
+		audit.DetailStudyUID:    studyUID,
+		audit.DetailDestination: r.sendDestination(progress),
+		audit.DetailFiles:       strings.Join(files, ","),
+		"stored":                strconv.Itoa(countCompleted(progress)),
+	}
+	if err != nil {
+		details[audit.DetailError] = err.Error()
+	}
+	r.recordAudit(c, audit.Event{
+		User:    user,
+		Action:  audit.ActionSend,
+		Target:  target,
+		Details: details,
+	})
+}
+
+// sendDestination is the archive that stored the instances of a send, the
+// store system unless it failed over
+func (r *Router) sendDestination(progress []dicom.FileProgress) string {
+	for _, p := range progress {
+		if p.Archive != "" {
+			return p.Archive
+		}
+	}
+	return r.runtime.Load().DicomStoreAETitle
+}
+
+// auditQuery records who searched for which patient or document; err is
+// the failure of the search, if it failed
+func (r *Router) auditQuery(c *gin.Context, action string, target string, details map[string]string, results int, err error) {
+	details["results"] = strconv.Itoa(results)
+	if err != nil {
+		details[audit.DetailError] = err.Error()
+	}
+	r.recordAudit(c, audit.Event{
+		User:    r.currentUser(c),
+		Action:  action,
+		Target:  target,
+		Details: details,
+	})
+}
+
+// auditDelete records that a user deleted a file or document
+func (r *Router) auditDelete(c *gin.Context, target string, details map[string]string) {
+	r.recordAudit(c, audit.Event{
+		User:    r.currentUser(c),
+		Action:  audit.ActionDelete,
+		Target:  target,
+		Details: details,
+	})
+}
+
+// auditExport records that a user took an archived study off the station,
+// to the export share or as a download
+func (r *Router) auditExport(c *gin.Context, studyUID string, patientID string, destination string) {
+	r.recordAudit(c, audit.Event{
+		User:   r.currentUser(c),
+		Action: audit.ActionExport,
+		Target: studyUID,
+		Details: map[string]string{
+			audit.DetailStudyUID:    studyUID,
+			audit.DetailPatientID:   patientID,
+			audit.DetailDestination: destination,
+		},
+	})
+}
@@ -0,0 +1,111 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"DICOMScanStation/audit"
+	"DICOMScanStation/config"
+	"DICOMScanStation/scanner"
+
+	"github.com/gin-gonic/gin"
+)
+
+// configRequest changes runtime settings. An empty value removes the
+// change made through the API, so the setting of the environment applies
+// again. ScannerDefaults replaces the scanner defaults as a whole.
+type configRequest struct {
+	Settings        map[string]string `json:"settings"`
+	ScannerDefaults json.RawMessage   `json:"scannerDefaults"`
+}
+
+// getConfig shows the settings an administrator can change at runtime
+func (r *Router) getConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, r.configResponse(r.configReloader.Current()))
+}
+
+// putConfig changes PACS hosts, AE titles and scanner defaults of the
+// running station
+func (r *Router) putConfig(c *gin.Context) {
+	var req configRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid configuration"})
+		return
+	}
+	if len(req.Settings) == 0 && len(req.ScannerDefaults) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No settings to change"})
+		return
+	}
+
+	changes := make(map[string]string)
+	for key, value := range req.Settings {
+		changes[strings.ToUpper(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	// New scanner defaults are checked first and only written once the
+	// other changes are valid too
+	var commit config.Commit
+	if len(req.ScannerDefaults) > 0 {
+		if _, err := scanner.ParseScannerDefaults(req.ScannerDefaults); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		changes["SCANNER_DEFAULTS"] = scanner.AdminDefaultsFile(r.config.StateDir)
+		commit = func() (func(), error) {
+			return scanner.SaveScannerDefaults(r.config.StateDir, req.ScannerDefaults)
+		}
+	}
+
+	changed, err := r.configReloader.Update(changes, commit)
+	if err != nil {
+		if errors.Is(err, config.ErrInvalidConfig) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// The file name stays the same when only the defaults change
+	if len(req.ScannerDefaults) > 0 && !slices.Contains(changed, "SCANNER_DEFAULTS") {
+		changed = append(changed, "SCANNER_DEFAULTS")
+	}
+
+	cfg := r.configReloader.Current()
+	details := make(map[string]string)
+	for _, s := range cfg.RuntimeSettings() {
+		if slices.Contains(changed, s.Key) {
+			details[s.Key] = s.Value
+		}
+	}
+	r.recordAudit(c, audit.Event{
+		User:    r.currentUser(c),
+		Action:  audit.ActionConfigChange,
+		Target:  "runtime settings",
+		Details: details,
+	})
+	if len(changed) > 0 {
+		r.logger.Infof("Runtime settings changed from %s: %s", c.ClientIP(), strings.Join(changed, ", "))
+	}
+
+	response := r.configResponse(cfg)
+	response["changed"] = changed
+	c.JSON(http.StatusOK, response)
+}
+
+// configResponse lists the runtime settings with their source and the
+// scanner defaults in effect
+func (r *Router) configResponse(cfg *config.Config) gin.H {
+	scannerDefaults := json.RawMessage("{}")
+	if file := strings.TrimSpace(cfg.ScannerDefaults); file != "" {
+		if data, err := os.ReadFile(file); err == nil && json.Valid(data) {
+			scannerDefaults = data
+		}
+	}
+	return gin.H{
+		"settings":        cfg.RuntimeSettings(),
+		"scannerDefaults": scannerDefaults,
+	}
+}
@@ -0,0 +1,138 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/events"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// streamEvents pushes the progress of scans and sends to a WebSocket client
+// until it disconnects
+func (r *Router) streamEvents(c *gin.Context) {
+	workspace := r.workspaceID(c)
+	server := websocket.Server{
+		Handshake: checkEventsOrigin,
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			ch, unsubscribe := r.events.Subscribe()
+			defer unsubscribe()
+
+			// Clients only listen; reading detects that they went away
+			go func() {
+				var discard string
+				for websocket.Message.Receive(ws, &discard) == nil {
+				}
+				unsubscribe()
+			}()
+
+			for event := range ch {
+				if !r.eventVisible(event, workspace) {
+					continue
+				}
+				if err := websocket.JSON.Send(ws, event); err != nil {
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// eventVisible reports whether a client of a workspace sees an event: the
+// progress of scans and sends only goes to the workspace they belong to,
+// so other operators do not learn its file names
+func (r *Router) eventVisible(event events.Event, workspace string) bool {
+	switch data := event.Data.(type) {
+	case events.ScanProgress:
+		// Scans of peer stations have no job and stay with the shared
+		// workspace
+		owner, _ := r.scans.workspaceOf(data.JobID, data.Device)
+		return owner == workspace
+	case sendEvent:
+		owner, _ := r.sends.workspaceOf(data.JobID)
+		return owner == workspace
+	}
+	return true
+}
+
+// checkEventsOrigin refuses browsers connecting from another site. Clients
+// that send no Origin, like scripts, are accepted.
+func checkEventsOrigin(config *websocket.Config, req *http.Request) error {
+	origin, err := websocket.Origin(config, req)
+	if err != nil {
+		return err
+	}
+	if origin != nil && origin.Host != req.Host {
+		return fmt.Errorf("origin %s not allowed", origin.Host)
+	}
+	config.Origin = origin
+	return nil
+}
+
+// sendEventsKeepAlive is how often an idle progress stream sends a comment
+// so proxies keep the connection open
+const sendEventsKeepAlive = 15 * time.Second
+
+// streamSendProgress streams each step of the files of a send as
+// Server-Sent Events: "file" for every transition, then "finished" with the
+// result of GET /api/dicom/send/:jobId, after which the stream ends
+func (r *Router) streamSendProgress(c *gin.Context) {
+	id := c.Param("jobId")
+	// Subscribed before the snapshot, so no transition falls in between
+	ch, unsubscribe := r.events.Subscribe()
+	defer unsubscribe()
+
+	workspace := r.workspace(c).id
+	view, ok := r.sends.view(id, workspace)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Send job not found"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	for _, file := range view["progress"].([]dicom.FileProgress) {
+		c.SSEvent("file", file)
+	}
+	if view["state"] != sendRunning {
+		c.SSEvent("finished", view)
+		return
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(sendEventsKeepAlive)
+	defer keepAlive.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			return true
+		case event, open := <-ch:
+			if !open {
+				return false
+			}
+			data, ok := event.Data.(sendEvent)
+			if !ok || data.JobID != id {
+				return true
+			}
+			switch event.Type {
+			case events.SendFile:
+				c.SSEvent("file", data.File)
+			case events.SendFinished:
+				view, _ := r.sends.view(id, workspace)
+				c.SSEvent("finished", view)
+				return false
+			}
+			return true
+		}
+	})
+}
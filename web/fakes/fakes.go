@@ -0,0 +1,231 @@
+// Package fakes provides in-memory implementations of the router's service
+// interfaces for handler-level tests. It is not used by the station
+// itself; demo mode simulates the PACS with package demo.
+package fakes
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/scanner"
+	"DICOMScanStation/storage"
+	"DICOMScanStation/web"
+)
+
+var (
+	_ web.ScannerService = (*ScannerService)(nil)
+	_ web.FileStore      = (*FileStore)(nil)
+	_ web.DicomGateway   = (*DicomGateway)(nil)
+)
+
+// ScannerService returns canned scanners and scan results
+type ScannerService struct {
+	Scanners     []*scanner.ScannerInfo
+	Capabilities *scanner.Capabilities
+	ScanResult   []string
+	ScanErr      error
+
+	mu        sync.Mutex
+	ScanCalls []string
+}
+
+func (s *ScannerService) GetScanners() []*scanner.ScannerInfo {
+	return s.Scanners
+}
+
+func (s *ScannerService) GetScannerCapabilities(device string) (*scanner.Capabilities, error) {
+	for _, sc := range s.Scanners {
+		if sc.Device == device {
+			return s.Capabilities, nil
+		}
+	}
+	return nil, fmt.Errorf("scanner device '%s' not found", device)
+}
+
+func (s *ScannerService) ScanDocument(device string, options *scanner.ScanOptions) ([]string, error) {
+	s.mu.Lock()
+	s.ScanCalls = append(s.ScanCalls, device)
+	s.mu.Unlock()
+	return s.ScanResult, s.ScanErr
+}
+
+// FileStore keeps file contents in memory
+type FileStore struct {
+	Extensions []string
+
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func NewFileStore(extensions ...string) *FileStore {
+	if len(extensions) == 0 {
+		extensions = []string{"jpg", "jpeg", "png", "tiff", "tif"}
+	}
+	return &FileStore{Extensions: extensions, files: make(map[string][]byte)}
+}
+
+func (f *FileStore) List() ([]storage.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var files []storage.FileInfo
+	for name, data := range f.files {
+		files = append(files, storage.FileInfo{
+			Name:         name,
+			Size:         int64(len(data)),
+			ModifiedTime: time.Now().Format("2006-01-02 15:04:05"),
+			Extension:    strings.ToLower(filepath.Ext(name)),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+func (f *FileStore) Path(name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.files[name]; !ok {
+		return "", storage.ErrNotFound
+	}
+	return "/fake/" + name, nil
+}
+
+func (f *FileStore) Save(name string, r io.Reader) error {
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[name] = buf.Bytes()
+	return nil
+}
+
+func (f *FileStore) Delete(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.files[name]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(f.files, name)
+	return nil
+}
+
+func (f *FileStore) IsAllowedExtension(ext string) bool {
+	for _, allowed := range f.Extensions {
+		if "."+allowed == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// DicomGateway records uploads and returns canned search results
+type DicomGateway struct {
+	Patients []dicom.PatientInfo
+	// Studies by patient ID and series by study instance UID
+	Studies map[string][]dicom.StudyInfo
+	Series  map[string][]dicom.SeriesInfo
+	// Templates are the tag templates by document type
+	Templates map[string]map[string]string
+	SearchErr error
+	SendErr   error
+
+	mu   sync.Mutex
+	Sent [][]string
+}
+
+func (d *DicomGateway) SearchPatients(searchTerm string, searchType string) ([]dicom.PatientInfo, error) {
+	return d.Patients, d.SearchErr
+}
+
+func (d *DicomGateway) PatientStudies(patientID string) ([]dicom.StudyInfo, error) {
+	studies := d.Studies[patientID]
+	if studies == nil {
+		studies = []dicom.StudyInfo{}
+	}
+	return studies, d.SearchErr
+}
+
+func (d *DicomGateway) StudySeries(patientID string, studyInstanceUID string) ([]dicom.SeriesInfo, error) {
+	series := d.Series[studyInstanceUID]
+	if series == nil {
+		series = []dicom.SeriesInfo{}
+	}
+	return series, d.SearchErr
+}
+
+func (d *DicomGateway) SendToPacs(req dicom.SendRequest) ([]dicom.FileProgress, error) {
+	if d.SendErr != nil {
+		return nil, d.SendErr
+	}
+
+	d.mu.Lock()
+	d.Sent = append(d.Sent, req.FilePaths)
+	d.mu.Unlock()
+
+	progress := make([]dicom.FileProgress, 0, len(req.FilePaths))
+	for _, path := range req.FilePaths {
+		progress = append(progress, dicom.FileProgress{
+			Filename: filepath.Base(path),
+			Status:   "completed",
+			Message:  "Successfully uploaded to PACs and cleaned up",
+			Progress: 100,
+		})
+	}
+	return progress, nil
+}
+
+func (d *DicomGateway) ListQuarantine() []dicom.Quarantine {
+	return nil
+}
+
+func (d *DicomGateway) ResolveQuarantinedPage(id string, filename string, decision string) (*dicom.Quarantine, error) {
+	return nil, dicom.ErrQuarantineNotFound
+}
+
+func (d *DicomGateway) ReleaseQuarantine(id string) ([]dicom.FileProgress, error) {
+	return nil, dicom.ErrQuarantineNotFound
+}
+
+func (d *DicomGateway) DiscardQuarantine(id string) error {
+	return dicom.ErrQuarantineNotFound
+}
+
+func (d *DicomGateway) ResendArchived(studyInstanceUID string) ([]dicom.FileProgress, error) {
+	return nil, fmt.Errorf("local archive is not enabled")
+}
+
+func (d *DicomGateway) TagTemplates() map[string]map[string]string {
+	if d.Templates == nil {
+		return map[string]map[string]string{}
+	}
+	return d.Templates
+}
+
+// Echo reports both simulated systems as reachable
+func (d *DicomGateway) Echo() []dicom.EchoResult {
+	var results []dicom.EchoResult
+	for _, role := range []string{"query", "store"} {
+		results = append(results, dicom.EchoResult{
+			Role:      role,
+			AETitle:   "DEMO",
+			Host:      "localhost",
+			Reachable: true,
+			Accepted:  true,
+			Success:   true,
+			Status:    "0x0000",
+		})
+	}
+	return results
+}
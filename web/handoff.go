@@ -0,0 +1,125 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"DICOMScanStation/handoff"
+	"DICOMScanStation/qrcode"
+	"DICOMScanStation/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (r *Router) createHandoff(c *gin.Context) {
+	workspace := handoff.DefaultWorkspace
+	if ws := r.workspace(c); ws.id != "" {
+		workspace = ws.id
+	}
+	// The phone uploads on behalf of the operator who showed the QR code
+	token, err := r.handoff.Issue(workspace, r.currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create handoff token"})
+		return
+	}
+
+	mobileURL := r.baseURL(c) + "/mobile/" + url.PathEscape(token.Token)
+	r.logger.Infof("Issued mobile handoff token for workspace %s (expires %s)", token.Workspace, token.ExpiresAt.Format(time.RFC3339))
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":     token.Token,
+		"url":       mobileURL,
+		"qr":        "/api/handoff/" + url.PathEscape(token.Token) + "/qr.png",
+		"expiresAt": token.ExpiresAt,
+	})
+}
+
+func (r *Router) getHandoffQRCode(c *gin.Context) {
+	token, err := r.handoff.Validate(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	mobileURL := r.baseURL(c) + "/mobile/" + url.PathEscape(token.Token)
+	if err := qrcode.WritePNG(&buf, []byte(mobileURL), 8); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate QR code: %v", err)})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/png", buf.Bytes())
+}
+
+func (r *Router) revokeHandoff(c *gin.Context) {
+	r.handoff.Revoke(c.Param("token"))
+	c.JSON(http.StatusOK, gin.H{"message": "Handoff token revoked"})
+}
+
+func (r *Router) mobilePage(c *gin.Context) {
+	token, err := r.handoff.Validate(c.Param("token"))
+	if err != nil {
+		c.String(http.StatusGone, "This capture link has expired. Please scan a new QR code at the scan station.")
+		return
+	}
+
+	c.HTML(http.StatusOK, "mobile.html", gin.H{
+		"title":     r.config.WebTitle,
+		"token":     token.Token,
+		"expiresAt": token.ExpiresAt.Format("15:04"),
+		"cspNonce":  cspNonce(c),
+	})
+}
+
+func (r *Router) mobileUpload(c *gin.Context) {
+	token, err := r.handoff.Validate(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form data"})
+		return
+	}
+
+	files := c.Request.MultipartForm.File["files"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files provided"})
+		return
+	}
+
+	// The pages go to the workspace of the browser that showed the QR code
+	id := token.Workspace
+	if id == handoff.DefaultWorkspace {
+		id = ""
+	}
+	ws, err := r.lookupWorkspace(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open workspace"})
+		return
+	}
+
+	// Phone cameras reuse file names, prefix them to keep pages apart
+	prefix := fmt.Sprintf("mobile_%d_", time.Now().UnixNano())
+	uploadedCount, errors := r.saveUploadedFiles(ws, files, prefix, storage.PageInfo{Source: storage.SourceMobile, Operator: token.CreatedBy})
+	r.logger.Infof("Mobile handoff upload into workspace %s: %d files", token.Workspace, uploadedCount)
+	r.respondUpload(c, uploadedCount, errors)
+}
+
+// baseURL returns the externally reachable URL of the station
+func (r *Router) baseURL(c *gin.Context) string {
+	if r.config.HandoffBaseURL != "" {
+		return strings.TrimRight(r.config.HandoffBaseURL, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
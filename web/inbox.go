@@ -0,0 +1,228 @@
+package web
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/logging"
+	"DICOMScanStation/pending"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The inbox handlers let operators work on pending documents without
+// touching the scan workspace: lock a document, preview its pages, assign
+// a patient and send it directly from the pending store.
+
+type inboxRequest struct {
+	Operator string `json:"operator"`
+}
+
+// bindOptionalJSON binds the request body if there is one and answers 400
+// for malformed JSON
+func bindOptionalJSON(c *gin.Context, v interface{}) bool {
+	if c.Request.ContentLength == 0 {
+		return true
+	}
+	if err := c.ShouldBindJSON(v); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return false
+	}
+	return true
+}
+
+func (r *Router) lockPending(c *gin.Context) {
+	var req inboxRequest
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	r.workspaceMu.Lock()
+	defer r.workspaceMu.Unlock()
+	if !r.checkPendingVersion(c, c.Param("id")) {
+		return
+	}
+
+	doc, err := r.pending.Lock(c.Param("id"), r.operator(c, req.Operator))
+	if err != nil {
+		r.pendingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, doc)
+}
+
+func (r *Router) unlockPending(c *gin.Context) {
+	var req inboxRequest
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	r.workspaceMu.Lock()
+	defer r.workspaceMu.Unlock()
+	if !r.checkPendingVersion(c, c.Param("id")) {
+		return
+	}
+
+	doc, err := r.pending.Unlock(c.Param("id"), r.operator(c, req.Operator))
+	if err != nil {
+		r.pendingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, doc)
+}
+
+func (r *Router) assignPending(c *gin.Context) {
+	var req struct {
+		Operator        string            `json:"operator"`
+		SelectedPatient dicom.PatientInfo `json:"selectedPatient" binding:"required"`
+		Description     string            `json:"description" binding:"required"`
+		DocumentCreator string            `json:"documentCreator" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Selected patient, description and document creator are required"})
+		return
+	}
+
+	r.workspaceMu.Lock()
+	defer r.workspaceMu.Unlock()
+	if !r.checkPendingVersion(c, c.Param("id")) {
+		return
+	}
+
+	operator := r.operator(c, req.Operator)
+	doc, err := r.pending.Assign(c.Param("id"), operator, pending.Assignment{
+		Patient:         req.SelectedPatient,
+		Description:     req.Description,
+		DocumentCreator: req.DocumentCreator,
+	})
+	if err != nil {
+		r.pendingError(c, err)
+		return
+	}
+
+	r.logger.WithField(logging.FieldPatientID, req.SelectedPatient.PatientID).Infof("Pending document %s assigned to a patient by %s", doc.ID, operator)
+	c.JSON(http.StatusOK, doc)
+}
+
+func (r *Router) listPendingPages(c *gin.Context) {
+	pages, err := r.pending.Pages(c.Param("id"))
+	if err != nil {
+		r.logger.Errorf("Failed to render pending document %s: %v", c.Param("id"), err)
+		r.pendingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"pages": pages,
+		"total": len(pages),
+	})
+}
+
+func (r *Router) getPendingPage(c *gin.Context) {
+	path, err := r.pending.PagePath(c.Param("id"), c.Param("page"))
+	if err != nil {
+		r.pendingError(c, err)
+		return
+	}
+
+	// Same as for scanned pages, only the full-size viewer counts as preview
+	if c.Query("preview") == "true" {
+		r.previews.MarkPreviewed(path)
+	}
+	c.File(path)
+}
+
+// sendPending uploads an assigned inbox document to the PACS. Pages that
+// were stored are removed; the document disappears once all are sent.
+func (r *Router) sendPending(c *gin.Context) {
+	var req struct {
+		Operator           string `json:"operator"`
+		Atomic             bool   `json:"atomic"`
+		Force              bool   `json:"force"`
+		Format             string `json:"format"`
+		ConfirmedBirthDate string `json:"confirmedBirthDate"`
+	}
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+	if !dicom.ValidSendFormat(req.Format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be images, pdf or multiframe"})
+		return
+	}
+
+	id := c.Param("id")
+	r.workspaceMu.Lock()
+	ok := r.checkPendingVersion(c, id)
+	r.workspaceMu.Unlock()
+	if !ok {
+		return
+	}
+
+	operator := r.operator(c, req.Operator)
+	doc, dir, err := r.pending.PrepareSend(id, operator)
+	if err != nil {
+		r.pendingError(c, err)
+		return
+	}
+	if len(doc.Pages) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pending document has no pages to send"})
+		return
+	}
+
+	var filePaths []string
+	for _, page := range doc.Pages {
+		filePaths = append(filePaths, filepath.Join(dir, page))
+	}
+
+	a := doc.Assignment
+	if !r.checkWorkflow(c, filePaths, a.Description, req.ConfirmedBirthDate, a.Patient) {
+		return
+	}
+
+	r.logger.Infof("Sending pending document %s (%d pages) to patient: %+v", id, len(filePaths), a.Patient)
+
+	progress, err := r.dicomService.SendToPacs(dicom.SendRequest{
+		PatientIDs:      []string{a.Patient.PatientID},
+		DocumentCreator: a.DocumentCreator,
+		Description:     a.Description,
+		FilePaths:       filePaths,
+		Patient:         a.Patient,
+		Atomic:          req.Atomic,
+		Force:           req.Force,
+		Format:          req.Format,
+		Operator:        operator,
+		BatchStartedAt:  doc.Lock.Since,
+		SourceDir:       dir,
+	})
+
+	r.auditSend(c, operator, a.Patient, "", filePaths, progress, err)
+
+	var sent []string
+	for _, p := range progress {
+		if p.Status == "completed" {
+			sent = append(sent, p.Filename)
+		}
+	}
+	remaining, markErr := r.pending.Sent(id, sent)
+	if markErr != nil {
+		r.logger.Warnf("Failed to update pending document %s after send: %v", id, markErr)
+	}
+
+	if err != nil {
+		r.sendError(c, progress, err)
+		return
+	}
+
+	r.previews.Forget(filePaths...)
+	r.rememberDocumentType(c, a.Description)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Pending document sent to PACS",
+		"files":     len(filePaths),
+		"patient":   a.Patient.Name,
+		"progress":  progress,
+		"success":   countCompleted(progress),
+		"total":     len(progress),
+		"remaining": remaining,
+	})
+}
@@ -0,0 +1,111 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"DICOMScanStation/jobs"
+	"DICOMScanStation/scanner"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listJobs answers which scans and sends happened, filtered by kind,
+// status, patient, station and time range
+func (r *Router) listJobs(c *gin.Context) {
+	filter := jobs.Filter{
+		Kind:      c.Query("kind"),
+		Status:    c.Query("status"),
+		PatientID: c.Query("patientId"),
+		Station:   c.Query("station"),
+	}
+	if filter.Kind != "" && filter.Kind != jobs.KindScan && filter.Kind != jobs.KindSend {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kind must be scan or send"})
+		return
+	}
+	if from := c.Query("from"); from != "" {
+		t, _, err := parseReportTime(from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from', expected YYYY-MM-DD or YYYY-MM-DDTHH:MM"})
+			return
+		}
+		filter.From = t
+	}
+	if to := c.Query("to"); to != "" {
+		t, dateOnly, err := parseReportTime(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to', expected YYYY-MM-DD or YYYY-MM-DDTHH:MM"})
+			return
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		filter.To = t
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > jobs.MaxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and " + strconv.Itoa(jobs.MaxLimit)})
+			return
+		}
+		filter.Limit = n
+	}
+
+	list, err := r.jobs.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"jobs": list, "total": len(list)})
+}
+
+// getJob returns one job with its files
+func (r *Router) getJob(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := r.jobs.Get(id)
+	if err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// recordScan adds a finished scan to the job log; a failure to record is
+// only logged
+func (r *Router) recordScan(operator string, device string, startedAt time.Time, filenames []string, scanErr error) {
+	if r.jobs == nil {
+		return
+	}
+	job := jobs.Job{
+		Kind:      jobs.KindScan,
+		Operator:  operator,
+		Device:    device,
+		Status:    jobs.StatusCompleted,
+		Pages:     len(filenames),
+		StartedAt: startedAt,
+	}
+	for _, name := range filenames {
+		job.Files = append(job.Files, jobs.File{Name: name})
+	}
+	if scanErr != nil {
+		job.Status = jobs.StatusFailed
+		if errors.Is(scanErr, scanner.ErrScanCancelled) {
+			job.Status = jobs.StatusCancelled
+		}
+		job.Message = scanErr.Error()
+	}
+	if _, err := r.jobs.Record(job); err != nil {
+		r.logger.Warnf("Failed to record scan on %s: %v", device, err)
+	}
+}
@@ -0,0 +1,127 @@
+package web
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"DICOMScanStation/audit"
+	"DICOMScanStation/config"
+	"DICOMScanStation/lockout"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accountPrefix marks the lockout keys of accounts, to tell them from
+// client addresses
+const accountPrefix = "user:"
+
+func lockoutPolicy(cfg *config.Config, maxFailures int) lockout.Policy {
+	return lockout.Policy{
+		MaxFailures: maxFailures,
+		Window:      time.Duration(cfg.AuthFailureWindow) * time.Second,
+		Duration:    time.Duration(cfg.AuthLockout) * time.Second,
+		MaxDuration: time.Duration(cfg.AuthLockoutMax) * time.Second,
+	}
+}
+
+// checkLockout aborts the request with 429 if the caller or the account
+// user signs in to is locked out after repeated authentication failures.
+// It reports whether the request may go on.
+func (r *Router) checkLockout(c *gin.Context, user string) bool {
+	remaining := r.lockouts.Locked(c.ClientIP())
+	if user != "" {
+		remaining = max(remaining, r.accountLockouts.Locked(accountPrefix+user))
+	}
+	if remaining <= 0 {
+		return true
+	}
+	seconds := int(math.Ceil(remaining.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error": fmt.Sprintf("Too many failed attempts, try again in %d seconds", seconds),
+	})
+	return false
+}
+
+// authFailed records a rejected credential in the audit trail and locks
+// out the account once it failed too often, and the caller once it failed
+// too often on any account. method names the credential, user the account
+// if one was given.
+func (r *Router) authFailed(c *gin.Context, method string, user string) {
+	client := c.ClientIP()
+	r.recordAudit(c, audit.Event{
+		User:    user,
+		Action:  audit.ActionAuthFailure,
+		Target:  client,
+		Details: map[string]string{"method": method, "path": c.FullPath()},
+	})
+
+	if user != "" {
+		duration := r.accountLockouts.Failure(accountPrefix + user)
+		r.lockedOut(c, method, user, accountPrefix+user, duration, r.config.AuthMaxFailures)
+	}
+	duration := r.lockouts.Failure(client)
+	r.lockedOut(c, method, user, client, duration, r.config.AuthClientMaxFailures)
+}
+
+// lockedOut logs and audits a lockout of key, if the last failure caused
+// one
+func (r *Router) lockedOut(c *gin.Context, method, user, key string, duration time.Duration, failures int) {
+	if duration <= 0 {
+		return
+	}
+	r.logger.Warnf("Locked out %s for %s after repeated %s failures", key, duration, method)
+	r.recordAudit(c, audit.Event{
+		User:   user,
+		Action: audit.ActionLockout,
+		Target: key,
+		Details: map[string]string{
+			"method":   method,
+			"failures": strconv.Itoa(failures),
+			"duration": duration.String(),
+		},
+	})
+}
+
+// authSucceeded forgets the failures of the caller and of the account user
+// signed in to; their past lockouts still count when they are locked again
+func (r *Router) authSucceeded(c *gin.Context, user string) {
+	r.lockouts.Success(c.ClientIP())
+	if user != "" {
+		r.accountLockouts.Success(accountPrefix + user)
+	}
+}
+
+// listLockouts lists locked client addresses and accounts, the latter as
+// "user:<name>"
+func (r *Router) listLockouts(c *gin.Context) {
+	locks := append(r.lockouts.Locks(), r.accountLockouts.Locks()...)
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Until.After(locks[j].Until) })
+	c.JSON(http.StatusOK, gin.H{"lockouts": locks, "total": len(locks)})
+}
+
+// unlockClient lifts a lockout of a client address or an account before
+// it expires, e.g. after a user mistyped a password too often
+func (r *Router) unlockClient(c *gin.Context) {
+	client := c.Param("client")
+	tracker := r.lockouts
+	if strings.HasPrefix(client, accountPrefix) {
+		tracker = r.accountLockouts
+	}
+	if !tracker.Unlock(client) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Client is not locked out"})
+		return
+	}
+	r.logger.Infof("Lifted the lockout of %s", client)
+	r.recordAudit(c, audit.Event{
+		User:   r.currentUser(c),
+		Action: audit.ActionUnlock,
+		Target: client,
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "Lockout lifted"})
+}
@@ -0,0 +1,247 @@
+package web
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"DICOMScanStation/audit"
+	"DICOMScanStation/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginCookie holds the token of the login session; it ends with the
+// browser
+const loginCookie = "dss_login"
+
+// loggedIn returns the user of the login session the request carries
+func (r *Router) loggedIn(c *gin.Context) (string, bool) {
+	token, err := c.Cookie(loginCookie)
+	if err != nil || token == "" {
+		return "", false
+	}
+	session, ok := r.logins.Lookup(token)
+	if !ok {
+		return "", false
+	}
+	return session.User, true
+}
+
+// requireLogin lets only signed-in users through and records who they are
+// for the handlers. Programmatic clients with an API key, peer stations and
+// phones of a mobile handoff bring credentials of their own, and scanbd
+// reports scanner buttons from the station itself.
+func (r *Router) requireLogin(c *gin.Context) {
+	if _, ok := c.Get(apiKeyContextKey); ok {
+		c.Next()
+		return
+	}
+	if user, ok := r.loggedIn(c); ok {
+		c.Set(userContextKey, user)
+		c.Next()
+		return
+	}
+	path := c.FullPath()
+	if strings.HasPrefix(path, "/api/station/") || strings.HasPrefix(path, "/api/mobile/") ||
+		(path == "/api/scanners/:device/button" && net.ParseIP(c.ClientIP()).IsLoopback()) {
+		c.Next()
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Login required"})
+}
+
+// requireAdmin holds back requests of API keys without the admin scope and
+// of signed-in users not named in AUTH_ADMIN_USERS
+func (r *Router) requireAdmin(c *gin.Context) {
+	if value, ok := c.Get(apiKeyContextKey); ok {
+		if key, _ := value.(auth.APIKey); !slices.Contains(key.Scopes, auth.ScopeAdmin) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "The API key does not allow this request"})
+			return
+		}
+		c.Next()
+		return
+	}
+	if !r.loginRequired() {
+		c.Next()
+		return
+	}
+	if !r.isAdmin(c.GetString(userContextKey)) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Administrator rights required"})
+		return
+	}
+	c.Next()
+}
+
+// isAdmin reports whether user is one of AUTH_ADMIN_USERS
+func (r *Router) isAdmin(user string) bool {
+	for _, admin := range r.config.AuthAdminUsers {
+		if admin = strings.TrimSpace(admin); admin != "" && admin == user {
+			return true
+		}
+	}
+	return false
+}
+
+// requireLoginPage sends browsers without a login to the login page
+func (r *Router) requireLoginPage(c *gin.Context) {
+	user, ok := r.loggedIn(c)
+	if !ok {
+		c.Redirect(http.StatusFound, "/login")
+		c.Abort()
+		return
+	}
+	c.Set(userContextKey, user)
+	c.Next()
+}
+
+func (r *Router) loginPage(c *gin.Context) {
+	if _, ok := r.loggedIn(c); ok {
+		c.Redirect(http.StatusFound, "/")
+		return
+	}
+	r.showLoginPage(c, http.StatusOK, "")
+}
+
+func (r *Router) showLoginPage(c *gin.Context, status int, message string) {
+	c.HTML(status, "login.html", gin.H{
+		"title":    r.config.WebTitle,
+		"cspNonce": cspNonce(c),
+		"password": r.users != nil,
+		"sso":      r.oidc != nil,
+		"error":    message,
+	})
+}
+
+// login checks the user name and password and starts a login session
+func (r *Router) login(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User name and password are required"})
+		return
+	}
+	if !r.checkLockout(c, req.Username) {
+		return
+	}
+
+	if !r.users.Verify(req.Username, req.Password) {
+		r.authFailed(c, "password", req.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user name or password"})
+		return
+	}
+	r.authSucceeded(c, req.Username)
+
+	if err := r.startLogin(c, req.Username, "", "password"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Signed in", "user": req.Username})
+}
+
+// startLogin starts the login session of a user who proved who they are
+// with method
+func (r *Router) startLogin(c *gin.Context, user string, idToken string, method string) error {
+	session, err := r.logins.Create(user, idToken)
+	if err != nil {
+		return err
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(loginCookie, session.Token, 0, "/", "", c.Request.TLS != nil, true)
+	r.recordAudit(c, audit.Event{
+		User:    user,
+		Action:  audit.ActionLogin,
+		Target:  c.ClientIP(),
+		Details: map[string]string{"method": method},
+	})
+	r.logger.Infof("%s signed in from %s (%s)", user, c.ClientIP(), method)
+	return nil
+}
+
+// logout ends the login session of the browser. After a single sign-on
+// the browser is sent on to end the session at the identity provider, so
+// the next person at the station cannot sign in as the same user.
+func (r *Router) logout(c *gin.Context) {
+	response := gin.H{"message": "Signed out"}
+	if token, err := c.Cookie(loginCookie); err == nil && token != "" {
+		if session, ok := r.logins.Lookup(token); ok {
+			r.recordAudit(c, audit.Event{User: session.User, Action: audit.ActionLogout, Target: c.ClientIP()})
+			if session.IDToken != "" && r.oidc != nil {
+				if redirect := r.oidc.LogoutURL(c.Request.Context(), session.IDToken, r.loginPageURL()); redirect != "" {
+					response["redirect"] = redirect
+				}
+			}
+		}
+		r.logins.Delete(token)
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(loginCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, response)
+}
+
+// getMe returns the signed-in user, empty if unknown
+func (r *Router) getMe(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"user": r.currentUser(c)})
+}
+
+// oidcLogin sends the browser to the identity provider
+func (r *Router) oidcLogin(c *gin.Context) {
+	target, err := r.oidc.AuthURL(c.Request.Context())
+	if err != nil {
+		r.logger.Errorf("Single sign-on unavailable: %v", err)
+		r.showLoginPage(c, http.StatusBadGateway, "Single sign-on is currently unavailable")
+		return
+	}
+	c.Redirect(http.StatusFound, target)
+}
+
+// oidcCallback finishes a single sign-on when the identity provider sends
+// the browser back
+func (r *Router) oidcCallback(c *gin.Context) {
+	if !r.checkLockout(c, "") {
+		return
+	}
+	if message := c.Query("error"); message != "" {
+		r.logger.Warnf("Single sign-on refused from %s: %s %s", c.ClientIP(), message, c.Query("error_description"))
+		r.showLoginPage(c, http.StatusUnauthorized, "Single sign-on was refused")
+		return
+	}
+
+	user, idToken, err := r.oidc.Exchange(c.Request.Context(), c.Query("state"), c.Query("code"))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidState) {
+			// An old or reloaded callback, not a forged credential
+			r.showLoginPage(c, http.StatusBadRequest, "Sign-on expired, please sign in again")
+			return
+		}
+		r.logger.Errorf("Single sign-on from %s failed: %v", c.ClientIP(), err)
+		r.authFailed(c, "oidc", "")
+		r.showLoginPage(c, http.StatusUnauthorized, "Single sign-on failed")
+		return
+	}
+	r.authSucceeded(c, user)
+	if err := r.startLogin(c, user, idToken, "oidc"); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Redirect(http.StatusFound, "/")
+}
+
+// loginPageURL is the login page at the address single sign-on returns to
+func (r *Router) loginPageURL() string {
+	u, err := url.Parse(r.config.OIDCRedirectURL)
+	if err != nil {
+		return "/login"
+	}
+	return u.Scheme + "://" + u.Host + "/login"
+}
+
+// loginRequired reports whether the station requires a login
+func (r *Router) loginRequired() bool {
+	return r.users != nil || r.oidc != nil
+}
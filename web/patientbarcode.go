@@ -0,0 +1,68 @@
+package web
+
+import (
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strings"
+
+	"DICOMScanStation/barcode"
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/logging"
+
+	"github.com/sirupsen/logrus"
+)
+
+// identifyPatient reads the patient ID from a Code 39 barcode on the first
+// page of a scan, e.g. on a request form, and looks the patient up on the
+// PACS. It returns the barcode value and the patient, nil unless exactly
+// one patient has that ID.
+func (r *Router) identifyPatient(ws workspace, filename string) (string, *dicom.PatientInfo) {
+	path, err := ws.files.Path(filename)
+	if err != nil {
+		return "", nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		r.logger.Warnf("Failed to read %s for a patient barcode: %v", filename, err)
+		return "", nil
+	}
+
+	var patientID string
+	for _, value := range barcode.Scan(img) {
+		if strings.HasPrefix(value, r.config.PatientBarcodePrefix) {
+			patientID = strings.TrimPrefix(value, r.config.PatientBarcodePrefix)
+			break
+		}
+	}
+	if patientID == "" {
+		return "", nil
+	}
+
+	patients, err := r.dicomService.SearchPatients(patientID, "id")
+	if err != nil {
+		r.logger.WithField(logging.FieldPatientID, patientID).Warnf("Patient search for barcode failed: %v", err)
+		return patientID, nil
+	}
+	var matches []dicom.PatientInfo
+	for _, p := range patients {
+		if p.PatientID == patientID {
+			matches = append(matches, p)
+		}
+	}
+	if len(matches) != 1 {
+		r.logger.WithField(logging.FieldPatientID, patientID).Infof("Barcode on %s matches %d patients, none preselected", filename, len(matches))
+		return patientID, nil
+	}
+	r.logger.WithFields(logrus.Fields{
+		logging.FieldPatientID:   patientID,
+		logging.FieldPatientName: matches[0].Name,
+	}).Infof("Barcode on %s identifies the patient", filename)
+	return patientID, &matches[0]
+}
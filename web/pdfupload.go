@@ -0,0 +1,129 @@
+package web
+
+import (
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"DICOMScanStation/rasterize"
+	"DICOMScanStation/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadPDF splits uploaded PDF documents into one page image each and adds
+// them to the workspace, so they are matched and sent like scanned pages
+func (r *Router) uploadPDF(c *gin.Context) {
+	if err := c.Request.ParseMultipartForm(32 << 20); err != nil { // 32MB max
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form data"})
+		return
+	}
+
+	files := c.Request.MultipartForm.File["files"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files provided"})
+		return
+	}
+
+	ws := r.workspace(c)
+	var pages []string
+	var errors []string
+	split := 0
+	for _, fileHeader := range files {
+		if fileHeader.Size > r.config.MaxFileSize {
+			errors = append(errors, fmt.Sprintf("File %s exceeds maximum size limit", fileHeader.Filename))
+			continue
+		}
+		if strings.ToLower(filepath.Ext(fileHeader.Filename)) != ".pdf" {
+			errors = append(errors, fmt.Sprintf("File %s is not a PDF", fileHeader.Filename))
+			continue
+		}
+
+		saved, err := r.splitPDF(ws, fileHeader)
+		if err != nil {
+			r.logger.Errorf("Failed to split PDF %s: %v", fileHeader.Filename, err)
+			errors = append(errors, fmt.Sprintf("Failed to split %s: %v", fileHeader.Filename, err))
+		} else {
+			split++
+		}
+		if len(saved) > 0 {
+			r.logger.Infof("Split PDF %s into %d pages", fileHeader.Filename, len(saved))
+		}
+		pages = append(pages, saved...)
+	}
+
+	r.annotatePages(ws, pages, storage.PageInfo{Source: storage.SourceUpload, Operator: r.currentUser(c)})
+
+	status := http.StatusOK
+	message := fmt.Sprintf("Split %d PDF files into %d pages", split, len(pages))
+	response := gin.H{"uploaded": len(pages), "pages": pages}
+	if len(errors) > 0 {
+		status = http.StatusPartialContent
+		message = fmt.Sprintf("Added %d pages with %d errors", len(pages), len(errors))
+		response["errors"] = errors
+	}
+	response["message"] = message
+	c.JSON(status, response)
+}
+
+// splitPDF rasterizes one uploaded PDF and saves its pages as
+// <name>_<page>.jpg. It returns the pages saved, also when a later one
+// failed.
+func (r *Router) splitPDF(ws workspace, fileHeader *multipart.FileHeader) ([]string, error) {
+	dir, err := os.MkdirTemp("", "pdf-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	pdfPath := filepath.Join(dir, "upload.pdf")
+	err = saveTo(pdfPath, src)
+	src.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := rasterize.PDF(r.config.PopplerPath, r.config.PDFRasterDPI, pdfPath, dir, "page")
+	if err != nil {
+		return nil, err
+	}
+	if len(rendered) == 0 {
+		return nil, fmt.Errorf("the PDF has no pages")
+	}
+
+	base := strings.TrimSuffix(filepath.Base(fileHeader.Filename), filepath.Ext(fileHeader.Filename))
+	var saved []string
+	for i, page := range rendered {
+		f, err := os.Open(filepath.Join(dir, page))
+		if err != nil {
+			return saved, err
+		}
+		name := fmt.Sprintf("%s_%d.jpg", base, i+1)
+		err = ws.files.Save(name, f)
+		f.Close()
+		if err != nil {
+			return saved, err
+		}
+		saved = append(saved, name)
+	}
+	return saved, nil
+}
+
+func saveTo(path string, src multipart.File) error {
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := dst.ReadFrom(src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,155 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"DICOMScanStation/audit"
+	"DICOMScanStation/pending"
+	"DICOMScanStation/separate"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (r *Router) listPending(c *gin.Context) {
+	docs, err := r.pending.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"documents": docs,
+		"total":     len(docs),
+	})
+}
+
+func (r *Router) getPending(c *gin.Context) {
+	doc, err := r.pending.Get(c.Param("id"))
+	if err != nil {
+		r.pendingError(c, err)
+		return
+	}
+	setETag(c, strconv.Itoa(doc.Version))
+	c.JSON(http.StatusOK, doc)
+}
+
+func (r *Router) getPendingFile(c *gin.Context) {
+	path, err := r.pending.FilePath(c.Param("id"), c.Param("filename"))
+	if err != nil {
+		r.pendingError(c, err)
+		return
+	}
+	c.File(path)
+}
+
+// claimPending moves a pending document into the current scan batch, where
+// it is assigned to a patient and sent like scanned pages
+func (r *Router) claimPending(c *gin.Context) {
+	id := c.Param("id")
+	var req struct {
+		Operator string `json:"operator"`
+	}
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	r.workspaceMu.Lock()
+	defer r.workspaceMu.Unlock()
+	if !r.checkPendingVersion(c, id) {
+		return
+	}
+
+	files, err := r.pending.Claim(id, r.operator(c, req.Operator), r.workspace(c).dir)
+	if err != nil {
+		r.logger.Errorf("Failed to claim pending document %s: %v", id, err)
+		r.pendingError(c, err)
+		return
+	}
+
+	r.logger.Infof("Pending document %s claimed (%d pages)", id, len(files))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Document added to the current batch",
+		"files":   files,
+	})
+}
+
+func (r *Router) deletePending(c *gin.Context) {
+	r.workspaceMu.Lock()
+	defer r.workspaceMu.Unlock()
+	if !r.checkPendingVersion(c, c.Param("id")) {
+		return
+	}
+
+	doc, err := r.pending.Get(c.Param("id"))
+	if err != nil {
+		r.pendingError(c, err)
+		return
+	}
+	if holder := doc.LockedBy(); holder != "" && holder != r.operator(c, c.Query("operator")) {
+		r.pendingError(c, &pending.LockedError{Lock: *doc.Lock})
+		return
+	}
+
+	if err := r.pending.Delete(doc.ID); err != nil {
+		r.pendingError(c, err)
+		return
+	}
+	details := map[string]string{audit.DetailFiles: strings.Join(doc.Pages, ",")}
+	if doc.Assignment != nil {
+		details[audit.DetailPatientID] = doc.Assignment.Patient.PatientID
+	}
+	r.auditDelete(c, doc.ID, details)
+	c.JSON(http.StatusOK, gin.H{"message": "Pending document discarded"})
+}
+
+func (r *Router) pendingError(c *gin.Context, err error) {
+	var lockErr *pending.LockedError
+	switch {
+	case errors.As(err, &lockErr):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "lock": lockErr.Lock})
+	case errors.Is(err, pending.ErrNotLocked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, pending.ErrNotFound), errors.Is(err, pending.ErrPageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// splitPending splits a pending document at separator pages. The body may
+// override the configured rules, e.g. to try blank page separation on a
+// single batch.
+func (r *Router) splitPending(c *gin.Context) {
+	id := c.Param("id")
+	opts := separate.OptionsFromConfig(r.config)
+	if !bindOptionalJSON(c, &opts) {
+		return
+	}
+
+	r.workspaceMu.Lock()
+	defer r.workspaceMu.Unlock()
+	if !r.checkPendingVersion(c, id) {
+		return
+	}
+
+	docs, err := r.pending.Split(id, opts)
+	if err != nil {
+		r.logger.Errorf("Failed to split pending document %s: %v", id, err)
+		r.pendingError(c, err)
+		return
+	}
+
+	message := "No separator pages found"
+	if len(docs) > 1 {
+		message = fmt.Sprintf("Document split into %d documents", len(docs))
+		r.logger.Infof("Pending document %s split into %d documents", id, len(docs))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":   message,
+		"documents": docs,
+	})
+}
@@ -0,0 +1,59 @@
+package web
+
+import (
+	"net/http"
+
+	"DICOMScanStation/preferences"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (r *Router) getPreferences(c *gin.Context) {
+	user := r.currentUser(c)
+	if user == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Preferences require a signed-in user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":        user,
+		"preferences": r.preferences.Get(user),
+	})
+}
+
+func (r *Router) putPreferences(c *gin.Context) {
+	user := r.currentUser(c)
+	if user == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Preferences require a signed-in user"})
+		return
+	}
+
+	var prefs preferences.Preferences
+	if err := c.ShouldBindJSON(&prefs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid preferences"})
+		return
+	}
+
+	saved, err := r.preferences.Put(user, prefs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":        user,
+		"preferences": saved,
+	})
+}
+
+// rememberDocumentType records the document type of a successful send as
+// the user's last used one
+func (r *Router) rememberDocumentType(c *gin.Context, documentType string) {
+	user := r.currentUser(c)
+	if r.preferences == nil || user == "" || documentType == "" {
+		return
+	}
+	if err := r.preferences.SetLastDocumentType(user, documentType); err != nil {
+		r.logger.Warnf("Failed to store preferences of %s: %v", user, err)
+	}
+}
@@ -0,0 +1,78 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"DICOMScanStation/profiles"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (r *Router) listProfiles(c *gin.Context) {
+	list := r.profiles.List()
+	c.JSON(http.StatusOK, gin.H{
+		"profiles": list,
+		"total":    len(list),
+	})
+}
+
+func (r *Router) getProfile(c *gin.Context) {
+	profile, err := r.profiles.Get(c.Param("id"))
+	if err != nil {
+		r.profileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+func (r *Router) createProfile(c *gin.Context) {
+	var profile profiles.Profile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scan profile"})
+		return
+	}
+
+	created, err := r.profiles.Create(profile)
+	if err != nil {
+		r.profileError(c, err)
+		return
+	}
+	r.logger.Infof("Scan profile '%s' created", created.Name)
+	c.JSON(http.StatusCreated, created)
+}
+
+func (r *Router) updateProfile(c *gin.Context) {
+	var profile profiles.Profile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scan profile"})
+		return
+	}
+
+	updated, err := r.profiles.Update(c.Param("id"), profile)
+	if err != nil {
+		r.profileError(c, err)
+		return
+	}
+	r.logger.Infof("Scan profile '%s' updated", updated.Name)
+	c.JSON(http.StatusOK, updated)
+}
+
+func (r *Router) deleteProfile(c *gin.Context) {
+	if err := r.profiles.Delete(c.Param("id")); err != nil {
+		r.profileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Scan profile deleted"})
+}
+
+func (r *Router) profileError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, profiles.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, profiles.ErrDuplicate):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
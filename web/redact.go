@@ -0,0 +1,73 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"DICOMScanStation/audit"
+	"DICOMScanStation/redact"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redactFile permanently blacks out regions of a scanned page before it is
+// converted to DICOM. The boxes come from the redaction tool in the UI.
+func (r *Router) redactFile(c *gin.Context) {
+	ws := r.workspace(c)
+	var req struct {
+		Boxes []redact.Box `json:"boxes" binding:"required"`
+		// Relative coordinates are fractions of the image size, which is
+		// easier for a UI that shows a scaled preview
+		Relative bool   `json:"relative"`
+		Reason   string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one redaction box is required"})
+		return
+	}
+
+	r.workspaceMu.Lock()
+	defer r.workspaceMu.Unlock()
+	if !r.checkWorkspaceVersion(c) {
+		return
+	}
+
+	filename := c.Param("filename")
+	path, err := ws.files.Path(filename)
+	if err != nil {
+		r.fileError(c, err)
+		return
+	}
+
+	rects, err := redact.Apply(path, req.Boxes, req.Relative)
+	if err != nil {
+		if errors.Is(err, redact.ErrInvalidBox) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		r.logger.Errorf("Failed to redact %s: %v", filename, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := r.currentUser(c)
+	r.logger.Infof("Redacted %d region(s) of %s (user: %s)", len(rects), filename, user)
+	r.recordAudit(c, audit.Event{
+		User:   user,
+		Action: audit.ActionRedact,
+		Target: filename,
+		Details: map[string]string{
+			"boxes":  redact.Describe(rects),
+			"count":  strconv.Itoa(len(rects)),
+			"reason": req.Reason,
+		},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Redaction applied",
+		"file":    filename,
+		"regions": len(rects),
+		"version": r.currentWorkspaceVersion(ws),
+	})
+}
@@ -0,0 +1,94 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"DICOMScanStation/reports"
+	"DICOMScanStation/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getShiftReport summarizes uploads per operator. from and to accept a
+// calendar day (inclusive) or a local time like 2006-01-02T15:04 to cover a
+// shift; both default to today.
+func (r *Router) getShiftReport(c *gin.Context) {
+	today := time.Now().Format("2006-01-02")
+
+	from, _, err := parseReportTime(c.DefaultQuery("from", today))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from', expected YYYY-MM-DD or YYYY-MM-DDTHH:MM"})
+		return
+	}
+	to, dateOnly, err := parseReportTime(c.DefaultQuery("to", today))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to', expected YYYY-MM-DD or YYYY-MM-DDTHH:MM"})
+		return
+	}
+	if dateOnly {
+		to = to.AddDate(0, 0, 1)
+	}
+	if !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'to' must be after 'from'"})
+		return
+	}
+
+	entries, err := r.history.Entries(from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	report := reports.Shift(entries, from, to)
+
+	filename := fmt.Sprintf("shift-report-%s", from.Format("2006-01-02-1504"))
+	switch format := c.DefaultQuery("format", "json"); format {
+	case "json":
+		c.JSON(http.StatusOK, report)
+	case "csv":
+		var buf bytes.Buffer
+		if err := report.WriteCSV(&buf); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	case "pdf":
+		var buf bytes.Buffer
+		if err := report.WritePDF(&buf, r.config.WebTitle); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.pdf", filename))
+		c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown format '%s', expected json, csv or pdf", format)})
+	}
+}
+
+// parseReportTime reports whether value was a plain date
+func parseReportTime(value string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02T15:04", value, time.Local)
+	return t, false, err
+}
+
+// batchStartedAt returns the modification time of the oldest scanned page,
+// which approximates when the operator started working on the document
+func batchStartedAt(files []storage.FileInfo) time.Time {
+	var oldest time.Time
+	for _, f := range files {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", f.ModifiedTime, time.Local)
+		if err != nil {
+			continue
+		}
+		if oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+	}
+	return oldest
+}
@@ -0,0 +1,56 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reservationHolder identifies who reserves a scanner: the signed-in user
+// or the name given in the request
+func (r *Router) reservationHolder(c *gin.Context, name string) string {
+	if name == "" {
+		name = c.Query("holder")
+	}
+	return r.operator(c, name)
+}
+
+func (r *Router) getReservation(c *gin.Context) {
+	c.JSON(http.StatusOK, r.reservations.Status(c.Param("device"), r.reservationHolder(c, "")))
+}
+
+// reserveScanner reserves a scanner for a short time. If it is taken, the
+// caller is queued and gets 202 with its position and an estimate of when
+// the scanner frees up; asking again keeps the place in the queue.
+func (r *Router) reserveScanner(c *gin.Context) {
+	var req struct {
+		Holder     string `json:"holder"`
+		TTLSeconds int    `json:"ttlSeconds"`
+	}
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	device := c.Param("device")
+	holder := r.reservationHolder(c, strings.TrimSpace(req.Holder))
+	status, err := r.reservations.Reserve(device, holder, time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A holder name is required to reserve a scanner"})
+		return
+	}
+
+	if !status.Granted {
+		c.JSON(http.StatusAccepted, status)
+		return
+	}
+	r.logger.Infof("Scanner %s reserved by %s until %s", device, holder, status.Reservation.Expires.Format("15:04:05"))
+	c.JSON(http.StatusOK, status)
+}
+
+func (r *Router) releaseScanner(c *gin.Context) {
+	device := c.Param("device")
+	holder := r.reservationHolder(c, "")
+	c.JSON(http.StatusOK, r.reservations.Release(device, holder))
+}
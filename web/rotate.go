@@ -0,0 +1,54 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"DICOMScanStation/rotate"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rotateFile turns a page that was scanned the wrong way round, so the batch
+// does not have to be scanned again
+func (r *Router) rotateFile(c *gin.Context) {
+	ws := r.workspace(c)
+	var req struct {
+		Degrees int `json:"degrees" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": rotate.ErrInvalidAngle.Error()})
+		return
+	}
+
+	r.workspaceMu.Lock()
+	defer r.workspaceMu.Unlock()
+	if !r.checkWorkspaceVersion(c) {
+		return
+	}
+
+	filename := c.Param("filename")
+	path, err := ws.files.Path(filename)
+	if err != nil {
+		r.fileError(c, err)
+		return
+	}
+
+	if err := rotate.Apply(path, req.Degrees); err != nil {
+		if errors.Is(err, rotate.ErrInvalidAngle) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		r.logger.Errorf("Failed to rotate %s: %v", filename, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	r.logger.Infof("Rotated %s by %d degrees", filename, req.Degrees)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Page rotated",
+		"file":    filename,
+		"degrees": req.Degrees,
+		"version": r.currentWorkspaceVersion(ws),
+	})
+}
@@ -1,37 +1,119 @@
 package web
 
 import (
+	"errors"
 	"fmt"
-	"io"
+	"mime/multipart"
+	"net"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"DICOMScanStation/audit"
+	"DICOMScanStation/auth"
 	"DICOMScanStation/config"
 	"DICOMScanStation/dicom"
+	"DICOMScanStation/events"
+	"DICOMScanStation/handoff"
+	"DICOMScanStation/lockout"
+	"DICOMScanStation/logging"
+	"DICOMScanStation/reservation"
 	"DICOMScanStation/scanner"
+	"DICOMScanStation/station"
+	"DICOMScanStation/storage"
+	"DICOMScanStation/thumbnail"
+	"DICOMScanStation/tracing"
+	"DICOMScanStation/workflow"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Router struct {
-	router         *gin.Engine
-	scannerManager *scanner.ScannerManager
-	dicomService   *dicom.DicomService
-	config         *config.Config
-	logger         *logrus.Logger
+	router *gin.Engine
+	// management serves the administration endpoints in kiosk lockdown,
+	// nil otherwise
+	management     *gin.Engine
+	scannerManager ScannerService
+	scannerAdmin   ScannerAdmin
+	scanCanceller  ScanCanceller
+	scanPreviewer  ScanPreviewer
+	scanLocker     ScanLocker
+	scans          *scanTracker
+	// scanDefaults and runtime are replaced by Reconfigure
+	scanDefaults   atomic.Pointer[scanner.ScannerDefaults]
+	fileStore      FileStore
+	scanSession    ScanSessionStore
+	workspaces     WorkspaceProvider
+	dicomService   DicomGateway
+	archive        ArchiveStore
+	exporter       ArchiveExporter
+	pending        PendingStore
+	alerts         AlertStore
+	faults         FaultInjector
+	configReloader ConfigReloader
+	preferences    PreferenceStore
+	profiles       ProfileStore
+	apiKeys        APIKeyStore
+	history        HistoryStore
+	jobs           JobLog
+	workflow       *workflow.Policy
+	previews       *workflow.PreviewTracker
+	thumbnails     *thumbnail.Cache
+	audit          AuditLog
+	session        SessionTracker
+	benchmark      SendBenchmark
+	queue          SendQueue
+	sends          *sendTracker
+	events         *events.Hub
+	outbox         Outbox
+	handoff        *handoff.Store
+	reservations   *reservation.Board
+	// lockouts count authentication failures by client address,
+	// accountLockouts the failed sign-ins of an account
+	lockouts        *lockout.Tracker
+	accountLockouts *lockout.Tracker
+	// trustedProxies may name the user in TRUSTED_USER_HEADER
+	trustedProxies []*net.IPNet
+	// stationVerifier checks calls of peer stations with STATION_API_KEY
+	stationVerifier *station.Verifier
+	// users are the accounts of the login, nil if none is required
+	users  *auth.Users
+	oidc   *auth.OIDC
+	logins *auth.Sessions
+	// workspaceMu serializes version checks with the changes they guard
+	workspaceMu sync.Mutex
+	// config is the configuration the station started with, runtime the
+	// one with the runtime settings changed since
+	config  *config.Config
+	runtime atomic.Pointer[config.Config]
+	logger  *logrus.Logger
 }
 
-func NewRouter(sm *scanner.ScannerManager, cfg *config.Config) *Router {
+func NewRouter(cfg *config.Config, services Services) *Router {
 	router := gin.Default()
+	// Client addresses key the login lockout, so forwarded addresses are
+	// only believed from known proxies
+	trustedProxies, err := parseNetworks(cfg.TrustedProxies)
+	if err == nil {
+		err = router.SetTrustedProxies(cfg.TrustedProxies)
+	}
+	if err != nil {
+		logrus.Warnf("Invalid TRUSTED_PROXIES, trusting no proxy: %v", err)
+		router.SetTrustedProxies(nil)
+		trustedProxies = nil
+	}
 
 	// Set up CORS
 	router.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, If-Match")
+		c.Header("Access-Control-Expose-Headers", "ETag")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -41,69 +123,361 @@ func NewRouter(sm *scanner.ScannerManager, cfg *config.Config) *Router {
 		c.Next()
 	})
 
-	// Initialize DICOM service
-	dicomService := dicom.NewDicomService(cfg)
+	var management *gin.Engine
+	if cfg.KioskLockdown {
+		management = gin.Default()
+	}
+
+	// Invalid defaults are rejected by LoadScannerDefaults at startup
+	scanDefaults, _ := scanner.LoadScannerDefaults(cfg)
+	// Invalid users files are rejected by LoadUsers at startup
+	users, _ := auth.LoadUsers(cfg)
+	oidc := auth.NewOIDC(cfg)
 
-	return &Router{
+	r := &Router{
 		router:         router,
-		scannerManager: sm,
-		dicomService:   dicomService,
-		config:         cfg,
-		logger:         logrus.New(),
+		management:     management,
+		scannerManager: services.Scanners,
+		scannerAdmin:   services.ScannerAdmin,
+		scanCanceller:  services.ScanCanceller,
+		scanPreviewer:  services.ScanPreviewer,
+		scanLocker:     services.ScanLocker,
+		scans:          newScanTracker(),
+		fileStore:      services.Files,
+		scanSession:    services.ScanSession,
+		workspaces:     services.Workspaces,
+		dicomService:   services.Dicom,
+		archive:        services.Archive,
+		exporter:       services.Exporter,
+		pending:        services.Pending,
+		alerts:         services.Alerts,
+		faults:         services.Faults,
+		configReloader: services.Config,
+		preferences:    services.Preferences,
+		profiles:       services.Profiles,
+		apiKeys:        services.APIKeys,
+		history:        services.History,
+		jobs:           services.Jobs,
+		workflow:       services.Workflow,
+		previews:       workflow.NewPreviewTracker(),
+		thumbnails:     thumbnail.NewCache(filepath.Join(cfg.TempFilesDir, ".thumbnails"), thumbnailSize),
+		audit:          services.Audit,
+		session:        services.Session,
+		benchmark:      services.Benchmark,
+		queue:          services.Queue,
+		sends:          newSendTracker(services.Events),
+		events:         services.Events,
+		outbox:         services.Outbox,
+		handoff:        handoff.NewStore(time.Duration(cfg.HandoffTokenTTL) * time.Second),
+		reservations: reservation.NewBoard(
+			time.Duration(cfg.ScannerReservationDefaultMinutes)*time.Minute,
+			time.Duration(cfg.ScannerReservationMaxMinutes)*time.Minute,
+		),
+		lockouts:        lockout.NewTracker(lockoutPolicy(cfg, cfg.AuthClientMaxFailures)),
+		accountLockouts: lockout.NewTracker(lockoutPolicy(cfg, cfg.AuthMaxFailures)),
+		trustedProxies:  trustedProxies,
+		stationVerifier: station.NewVerifier(cfg.StationAPIKey),
+		users:           users,
+		oidc:            oidc,
+		logins:          auth.NewSessions(time.Duration(cfg.AuthSessionMinutes) * time.Minute),
+		config:          cfg,
+		logger:          logging.New(),
+	}
+	r.scanDefaults.Store(scanDefaults)
+	r.runtime.Store(cfg)
+	return r
+}
+
+// Reconfigure picks up changed runtime settings
+func (r *Router) Reconfigure(cfg *config.Config) {
+	// Invalid defaults are rejected before the settings are applied
+	if scanDefaults, err := scanner.LoadScannerDefaults(cfg); err == nil {
+		r.scanDefaults.Store(scanDefaults)
 	}
+	r.runtime.Store(cfg)
 }
 
 func (r *Router) SetupRoutes() {
-	// Serve static files
-	r.router.Static("/static", "./web/static")
-	r.router.LoadHTMLGlob("web/templates/*")
+	if r.config.CSPMode != CSPOff {
+		r.router.Use(r.contentSecurityPolicy)
+	}
+	if r.config.WebTLSCert != "" {
+		r.router.Use(r.strictTransportSecurity)
+	}
 
 	// API routes
 	api := r.router.Group("/api")
+	if r.config.TracingEndpoint != "" {
+		api.Use(r.traceRequest)
+	}
+	if r.apiKeys != nil {
+		api.Use(r.authenticateAPIKey)
+	}
+	if r.loginRequired() {
+		if r.users != nil {
+			r.router.POST("/api/login", r.login)
+		}
+		r.router.POST("/api/logout", r.logout)
+		api.Use(r.requireLogin)
+	}
+	if r.workspaces != nil {
+		api.Use(r.resolveWorkspace)
+	}
+	// Activity counts for the workspace of the request
+	if r.session != nil {
+		api.Use(r.trackActivity)
+	}
 	{
 		api.GET("/scanners", r.getScanners)
 		api.GET("/scanners/:device/capabilities", r.getScannerCapabilities)
+		api.GET("/scanners/:device/reservation", r.getReservation)
+		api.POST("/scanners/:device/reserve", r.reserveScanner)
+		api.DELETE("/scanners/:device/reserve", r.releaseScanner)
+		if r.config.ScanButton && r.events != nil {
+			api.POST("/scanners/:device/button", r.pressScanButton)
+		}
+		api.GET("/me", r.getMe)
 		api.GET("/files", r.getFiles)
 		api.POST("/scan", r.startScan)
+		api.GET("/scan/:jobId", r.getScanJob)
+		if r.scanCanceller != nil {
+			api.POST("/scan/:jobId/cancel", r.cancelScan)
+		}
 		api.GET("/files/:filename", r.getFile)
+		api.GET("/files/:filename/thumbnail", r.getThumbnail)
 		api.DELETE("/files/:filename", r.deleteFile)
-		api.POST("/files/upload", r.uploadFiles)
+		api.POST("/files/:filename/redact", r.redactFile)
+		api.POST("/files/:filename/rotate", r.rotateFile)
+		// Page order of the scanned batch
+		if r.scanSession != nil {
+			api.GET("/scan-session", r.getScanSession)
+			api.PUT("/scan-session/order", r.reorderPages)
+			api.DELETE("/scan-session/pages/:filename", r.removePage)
+		}
+		if r.config.FeatureUpload {
+			api.POST("/files", r.uploadFiles)
+			api.POST("/files/upload", r.uploadFiles)
+			api.POST("/files/upload-pdf", r.uploadPDF)
+		}
 		// DICOM endpoints
 		api.GET("/dicom/search", r.searchPatients)
 		api.POST("/dicom/send", r.sendToPacs)
+		api.GET("/dicom/send/:jobId", r.getSendProgress)
+		if r.events != nil {
+			api.GET("/dicom/send/:jobId/events", r.streamSendProgress)
+		}
+		api.GET("/dicom/echo", r.echoPacs)
+		api.GET("/dicom/studies", r.patientStudies)
+		api.GET("/dicom/studies/:studyUid/series", r.studySeries)
+		api.GET("/workflow", r.getWorkflow)
+		api.GET("/dicom/templates", r.getTagTemplates)
+		api.GET("/dicom/quarantine", r.listQuarantine)
+		api.POST("/dicom/quarantine/:id/pages/:filename", r.resolveQuarantinedPage)
+		api.POST("/dicom/quarantine/:id/release", r.releaseQuarantine)
+		api.DELETE("/dicom/quarantine/:id", r.discardQuarantine)
+		// Local archive endpoints
+		if r.archive != nil {
+			api.GET("/archive", r.listArchive)
+			api.GET("/archive/stats", r.getArchiveStats)
+			api.GET("/archive/:studyUid", r.getArchivedStudy)
+			api.GET("/archive/:studyUid/files/:filename", r.getArchivedFile)
+			api.POST("/archive/:studyUid/resend", r.resendArchivedStudy)
+			api.GET("/documents/search", r.searchDocuments)
+			if r.exporter != nil {
+				api.GET("/archive/:studyUid/pdf", r.getArchivedPDF)
+				api.POST("/archive/:studyUid/export", r.exportArchivedStudy)
+			}
+		}
+		// Record of past scans and sends
+		if r.jobs != nil {
+			api.GET("/jobs", r.listJobs)
+			api.GET("/jobs/:id", r.getJob)
+		}
+		// Documents awaiting patient assignment
+		if r.pending != nil {
+			api.GET("/pending", r.listPending)
+			api.GET("/pending/:id", r.getPending)
+			api.GET("/pending/:id/files/:filename", r.getPendingFile)
+			api.POST("/pending/:id/claim", r.claimPending)
+			api.POST("/pending/:id/split", r.splitPending)
+			api.POST("/pending/:id/lock", r.lockPending)
+			api.POST("/pending/:id/unlock", r.unlockPending)
+			api.PUT("/pending/:id/assignment", r.assignPending)
+			api.GET("/pending/:id/pages", r.listPendingPages)
+			api.GET("/pending/:id/pages/:page", r.getPendingPage)
+			api.POST("/pending/:id/send", r.sendPending)
+			api.DELETE("/pending/:id", r.deletePending)
+		}
+		// Station grouping: peers use this station's scanners
+		if r.config.StationAPIKey != "" {
+			peers := api.Group("/station", r.requireStationKey)
+			peers.GET("/scanners", r.stationScanners)
+			peers.GET("/scanners/:device/capabilities", r.stationCapabilities)
+			peers.POST("/scan", r.stationScan)
+		}
+		// Kiosk session
+		if r.session != nil {
+			api.GET("/session", r.getSession)
+			api.POST("/session/activity", r.sessionActivity)
+		}
+		// Scan profiles to pick from
+		if r.profiles != nil {
+			api.GET("/scan-profiles", r.listProfiles)
+			api.GET("/scan-profiles/:id", r.getProfile)
+		}
+		// Per-user preferences
+		if r.preferences != nil {
+			api.GET("/me/preferences", r.getPreferences)
+			api.PUT("/me/preferences", r.putPreferences)
+		}
+		// Reports, administration and settings are for administrators:
+		// users named in AUTH_ADMIN_USERS and API keys with the admin
+		// scope, or the management listener in kiosk lockdown
+		admin := gin.IRouter(api.Group("", r.requireAdmin))
+		if r.management != nil {
+			admin = r.management.Group("/api")
+		}
+		// Reports
+		if r.history != nil {
+			admin.GET("/reports/shift", r.getShiftReport)
+		}
+		// Administration
+		if r.alerts != nil {
+			admin.GET("/admin/alerts", r.listAlerts)
+			admin.POST("/admin/alerts/:id/ack", r.acknowledgeAlert)
+		}
+		if r.scannerAdmin != nil {
+			admin.POST("/admin/scanner/restart", r.restartScanners)
+		}
+		if r.benchmark != nil {
+			admin.POST("/admin/benchmark", r.runBenchmark)
+		}
+		if r.queue != nil {
+			admin.GET("/queue", r.listQueuedJobs)
+			admin.POST("/queue/:id/retry", r.retryQueuedJob)
+		}
+		if r.outbox != nil {
+			admin.GET("/outbox", r.listOutbox)
+			admin.POST("/outbox/:id/retry", r.retryOutboxEntry)
+			admin.DELETE("/outbox/:id", r.deleteOutboxEntry)
+		}
+		if r.profiles != nil {
+			admin.POST("/scan-profiles", r.createProfile)
+			admin.PUT("/scan-profiles/:id", r.updateProfile)
+			admin.DELETE("/scan-profiles/:id", r.deleteProfile)
+		}
+		admin.GET("/admin/lockouts", r.listLockouts)
+		admin.DELETE("/admin/lockouts/:client", r.unlockClient)
+		admin.POST("/admin/support-bundle", r.createSupportBundle)
+		if r.apiKeys != nil {
+			admin.GET("/admin/api-keys", r.listAPIKeys)
+			admin.POST("/admin/api-keys", r.createAPIKey)
+			admin.DELETE("/admin/api-keys/:id", r.revokeAPIKey)
+		}
+		if r.faults != nil {
+			admin.GET("/admin/faults", r.getFaults)
+			admin.PUT("/admin/faults", r.setFaults)
+		}
+		// Runtime settings change the PACS for everyone, so they are only
+		// offered behind a login or on the management listener
+		if r.configReloader != nil && (r.loginRequired() || r.management != nil) {
+			admin.GET("/admin/config", r.getConfig)
+			admin.PUT("/admin/config", r.putConfig)
+		}
 		// Settings endpoint
-		api.GET("/settings", r.getSettings)
+		if r.config.FeatureSettingsAPI {
+			admin.GET("/settings", r.getSettings)
+		}
+	}
+
+	// Live progress of scans and sends
+	if r.events != nil {
+		if r.loginRequired() {
+			r.router.GET("/ws", r.requireLogin, r.streamEvents)
+		} else {
+			r.router.GET("/ws", r.streamEvents)
+		}
 	}
 
 	// Web routes
-	r.router.GET("/", r.indexPage)
+	if r.config.FeatureWebUI {
+		// Serve static files
+		r.router.Static("/static", "./web/static")
+		r.router.LoadHTMLGlob("web/templates/*")
+
+		if r.loginRequired() {
+			r.router.GET("/login", r.loginPage)
+			if r.oidc != nil {
+				r.router.GET("/login/oidc", r.oidcLogin)
+				r.router.GET("/login/oidc/callback", r.oidcCallback)
+			}
+			r.router.GET("/", r.requireLoginPage, r.indexPage)
+		} else {
+			r.router.GET("/", r.indexPage)
+		}
+
+		// Mobile capture handoff via QR code
+		if r.config.FeatureMobileHandoff {
+			api.POST("/handoff", r.createHandoff)
+			api.GET("/handoff/:token/qr.png", r.getHandoffQRCode)
+			api.DELETE("/handoff/:token", r.revokeHandoff)
+			api.POST("/mobile/:token/upload", r.mobileUpload)
+			r.router.GET("/mobile/:token", r.mobilePage)
+		}
+	}
 }
 
 func (r *Router) getScanners(c *gin.Context) {
 	scanners := r.scannerManager.GetScanners()
+
+	// Reservations as seen by the caller, so the UI can show who holds a
+	// scanner and the caller's place in the queue
+	holder := r.reservationHolder(c, "")
+	reservations := make(map[string]reservation.Status)
+	for _, s := range scanners {
+		reservations[s.Device] = r.reservations.Status(s.Device, holder)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"scanners": scanners,
-		"total":    len(scanners),
+		"scanners":     scanners,
+		"total":        len(scanners),
+		"reservations": reservations,
 	})
 }
 
 func (r *Router) getFiles(c *gin.Context) {
-	files, err := r.getFileList()
+	ws := r.workspace(c)
+	files, err := ws.files.List()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	version := workspaceVersion(files)
+	setETag(c, version)
 	c.JSON(http.StatusOK, gin.H{
-		"files": files,
-		"total": len(files),
+		"files":   files,
+		"total":   len(files),
+		"version": version,
 	})
 }
 
 func (r *Router) startScan(c *gin.Context) {
+	ws := r.workspace(c)
 	var req struct {
 		Device  string               `json:"device" binding:"required"`
 		Options *scanner.ScanOptions `json:"options"`
+		// Operator is matched against scanner reservations
+		Operator string `json:"operator"`
+		// Profile is the ID of a scan profile whose options are used
+		// unless options are given
+		Profile string `json:"profile"`
+		// Append adds the pages to those already in the workspace, e.g. a
+		// page missed in the last batch, instead of requiring an empty
+		// workspace. After places them behind that page instead of at the
+		// end and implies Append.
+		Append bool   `json:"append"`
+		After  string `json:"after"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -111,14 +485,86 @@ func (r *Router) startScan(c *gin.Context) {
 		return
 	}
 
+	if req.Profile != "" && req.Options == nil {
+		if r.profiles == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Scan profiles are not available"})
+			return
+		}
+		profile, err := r.profiles.Get(req.Profile)
+		if err != nil {
+			r.profileError(c, err)
+			return
+		}
+		req.Options = &profile.Options
+	}
+
+	if ok, reserved := r.reservations.CanUse(req.Device, r.operator(c, req.Operator)); !ok {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":       "Scanner is reserved by " + reserved.Holder + " until " + reserved.Expires.Format("15:04"),
+			"reservation": reserved,
+		})
+		return
+	}
+
+	if req.Options != nil && (req.Options.Quality < 0 || req.Options.Quality > 100) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quality must be between 1 and 100"})
+		return
+	}
+	if req.Options != nil {
+		if err := scanner.ValidateSANEOptions(req.Options.SANEOptions); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := scanner.ValidateGeometry(req.Options); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := scanner.ValidateAdjustments(req.Options); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if req.Options != nil && req.Options.Separate && (!r.config.ScanSeparation || r.pending == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Splitting scans at separator sheets is disabled"})
+		return
+	}
+
+	// A preview does not touch the workspace
+	if req.Options != nil && req.Options.Preview {
+		r.previewScan(c, req.Device, req.Options, r.operator(c, req.Operator))
+		return
+	}
+
+	// A busy scanner is the reason a second scan cannot start, even though
+	// the first one already filled the workspace
+	operator := r.operator(c, req.Operator)
+	release, ok := r.lockScanner(c, req.Device, operator)
+	if !ok {
+		return
+	}
+
 	// Check if files already exist
-	files, err := r.getFileList()
+	files, err := ws.files.List()
 	if err != nil {
+		release()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if len(files) > 0 {
+	if req.After != "" {
+		req.Append = true
+		if !hasFile(files, req.After) {
+			release()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Page to append after not found"})
+			return
+		}
+	}
+
+	// Booklets are scanned page by page on the flatbed into one document
+	flatbed := scanner.IsFlatbed(r.scanSource(req.Device, req.Options))
+	if len(files) > 0 && !flatbed && !req.Append {
+		release()
 		c.JSON(http.StatusConflict, gin.H{
 			"error": "Files already exist. Please delete existing files before scanning.",
 			"files": files,
@@ -126,61 +572,141 @@ func (r *Router) startScan(c *gin.Context) {
 		return
 	}
 
-	filenames, err := r.scannerManager.ScanDocument(req.Device, req.Options)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	// The pages of a session go to its own workspace
+	if ws.id != "" {
+		if req.Options == nil {
+			defaults := r.defaultOptions(req.Device)
+			req.Options = &defaults
+		}
+		req.Options.Dir = ws.dir
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":   "Scan completed successfully",
-		"filenames": filenames,
-		"pages":     len(filenames),
+	// The scan runs in the background; clients poll GET /api/scan/:jobId
+	// or follow /ws for the pages
+	startedAt := time.Now()
+	id := r.scans.start(req.Device, ws.id)
+	r.events.Publish(events.ScanStarted, events.ScanProgress{JobID: id, Device: req.Device})
+	stopPages := r.followPages(id, req.Device)
+	_, span := tracing.Start(c.Request.Context(), "scan", attribute.String("scanner.device", req.Device))
+	go func() {
+		filenames, err := r.scannerManager.ScanDocument(req.Device, req.Options)
+		span.SetAttributes(attribute.Int("scan.pages", len(filenames)))
+		tracing.End(span, err)
+		release()
+		stopPages()
+		r.annotatePages(ws, filenames, storage.PageInfo{Source: storage.SourceScan, Device: req.Device, Operator: operator})
+		split := false
+		if err == nil && len(filenames) > 0 && req.Options != nil && req.Options.Separate {
+			documents, splitErr := r.separateBatch(ws, filenames, req.Device, operator)
+			if splitErr != nil {
+				r.logger.Errorf("Failed to split scan %s at separator sheets: %v", id, splitErr)
+			}
+			if len(documents) > 0 {
+				r.scans.split(id, documents)
+				split = true
+			}
+		}
+		if err == nil && len(filenames) > 0 && !split && req.After != "" {
+			if placeErr := r.placePages(ws, filenames, req.After); placeErr != nil {
+				r.logger.Errorf("Failed to place the pages of scan %s after %s: %v", id, req.After, placeErr)
+			}
+		}
+		if err == nil && len(filenames) > 0 && !split && r.config.PatientBarcode {
+			barcode, patient := r.identifyPatient(ws, filenames[0])
+			r.scans.identify(id, barcode, patient)
+		}
+		r.scans.finish(id, filenames, err)
+		r.recordScan(operator, req.Device, startedAt, filenames, err)
+		finished := events.ScanProgress{JobID: id, Device: req.Device, Pages: len(filenames)}
+		if err != nil {
+			finished.Error = err.Error()
+			finished.ErrorCode = scanErrorCode(err)
+		}
+		r.events.Publish(events.ScanFinished, finished)
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Scan started",
+		"jobId":   id,
 	})
 }
 
+// scanSource returns the source a scan asks for, or the default source of
+// the scanner, empty for the document feeder
+func (r *Router) scanSource(device string, options *scanner.ScanOptions) string {
+	if options != nil && options.Source != "" {
+		return options.Source
+	}
+	return r.defaultOptions(device).Source
+}
+
+// defaultOptions returns the options of a scan on device that brings none
+func (r *Router) defaultOptions(device string) scanner.ScanOptions {
+	name := ""
+	for _, s := range r.scannerManager.GetScanners() {
+		if s.Device == device {
+			name = s.Name
+		}
+	}
+	return r.scanDefaults.Load().Options(device, name)
+}
+
 func (r *Router) getFile(c *gin.Context) {
+	ws := r.workspace(c)
 	filename := c.Param("filename")
 	if filename == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Filename is required"})
 		return
 	}
 
-	filepath := filepath.Join(r.config.TempFilesDir, filename)
-
-	// Check if file exists
-	if _, err := os.Stat(filepath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	path, err := ws.files.Path(filename)
+	if err != nil {
+		r.fileError(c, err)
 		return
 	}
 
-	c.File(filepath)
+	// The full-size viewer asks with preview=true, thumbnails do not
+	if c.Query("preview") == "true" {
+		r.previews.MarkPreviewed(path)
+	}
+
+	c.File(path)
 }
 
 func (r *Router) deleteFile(c *gin.Context) {
+	ws := r.workspace(c)
 	filename := c.Param("filename")
 	if filename == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Filename is required"})
 		return
 	}
 
-	filepath := filepath.Join(r.config.TempFilesDir, filename)
-
-	// Check if file exists
-	if _, err := os.Stat(filepath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	r.workspaceMu.Lock()
+	defer r.workspaceMu.Unlock()
+	if !r.checkWorkspaceVersion(c) {
 		return
 	}
 
 	// Delete file
-	if err := os.Remove(filepath); err != nil {
+	if err := ws.files.Delete(filename); err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidName) {
+			r.fileError(c, err)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file"})
 		return
 	}
+	r.auditDelete(c, filename, map[string]string{"workspace": ws.id})
 
-	c.JSON(http.StatusOK, gin.H{"message": "File deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "File deleted successfully",
+		"version": r.currentWorkspaceVersion(ws),
+	})
 }
 
+// uploadFiles adds images to the workspace, e.g. photos or files from a
+// network share. Scripts may send a single image as "file" instead of
+// "files".
 func (r *Router) uploadFiles(c *gin.Context) {
 	// Parse multipart form
 	if err := c.Request.ParseMultipartForm(32 << 20); err != nil { // 32MB max
@@ -188,14 +714,23 @@ func (r *Router) uploadFiles(c *gin.Context) {
 		return
 	}
 
-	files := c.Request.MultipartForm.File["files"]
+	files := append(c.Request.MultipartForm.File["files"], c.Request.MultipartForm.File["file"]...)
 	if len(files) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No files provided"})
 		return
 	}
 
+	uploadedCount, errors := r.saveUploadedFiles(r.workspace(c), files, "", storage.PageInfo{Source: storage.SourceUpload, Operator: r.currentUser(c)})
+	r.respondUpload(c, uploadedCount, errors)
+}
+
+// saveUploadedFiles validates and stores uploaded files, optionally
+// prefixing their names to avoid collisions, and notes in the scan session
+// where they came from
+func (r *Router) saveUploadedFiles(ws workspace, files []*multipart.FileHeader, prefix string, info storage.PageInfo) (int, []string) {
 	uploadedCount := 0
 	var errors []string
+	var saved []string
 
 	for _, fileHeader := range files {
 		// Check file size
@@ -206,7 +741,7 @@ func (r *Router) uploadFiles(c *gin.Context) {
 
 		// Check file extension
 		ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
-		if !r.isAllowedExtension(ext) {
+		if !ws.files.IsAllowedExtension(ext) {
 			errors = append(errors, fmt.Sprintf("File %s has unsupported extension", fileHeader.Filename))
 			continue
 		}
@@ -217,27 +752,26 @@ func (r *Router) uploadFiles(c *gin.Context) {
 			errors = append(errors, fmt.Sprintf("Failed to open file %s: %v", fileHeader.Filename, err))
 			continue
 		}
-		defer file.Close()
 
-		// Create destination file
-		destPath := filepath.Join(r.config.TempFilesDir, fileHeader.Filename)
-		destFile, err := os.Create(destPath)
+		// Copy file content into the store
+		name := prefix + filepath.Base(fileHeader.Filename)
+		err = ws.files.Save(name, file)
+		file.Close()
 		if err != nil {
-			errors = append(errors, fmt.Sprintf("Failed to create file %s: %v", fileHeader.Filename, err))
-			continue
-		}
-		defer destFile.Close()
-
-		// Copy file content
-		if _, err := io.Copy(destFile, file); err != nil {
-			errors = append(errors, fmt.Sprintf("Failed to save file %s: %v", fileHeader.Filename, err))
+			errors = append(errors, err.Error())
 			continue
 		}
 
 		uploadedCount++
+		saved = append(saved, name)
 		r.logger.Infof("Uploaded file: %s", fileHeader.Filename)
 	}
 
+	r.annotatePages(ws, saved, info)
+	return uploadedCount, errors
+}
+
+func (r *Router) respondUpload(c *gin.Context, uploadedCount int, errors []string) {
 	if len(errors) > 0 {
 		c.JSON(http.StatusPartialContent, gin.H{
 			"uploaded": uploadedCount,
@@ -254,54 +788,31 @@ func (r *Router) uploadFiles(c *gin.Context) {
 }
 
 func (r *Router) indexPage(c *gin.Context) {
+	ws := r.browserWorkspace(c)
 	scanners := r.scannerManager.GetScanners()
-	files, _ := r.getFileList()
+	files, _ := ws.files.List()
 
 	c.HTML(http.StatusOK, "index.html", gin.H{
 		"title":    r.config.WebTitle,
 		"scanners": scanners,
 		"files":    files,
 		"config":   r.config,
+		"cspNonce": cspNonce(c),
+		"login":    r.loginRequired(),
+		"user":     r.currentUser(c),
 	})
 }
 
-func (r *Router) getFileList() ([]FileInfo, error) {
-	var files []FileInfo
-
-	entries, err := os.ReadDir(r.config.TempFilesDir)
-	if err != nil {
-		return files, err
-	}
-
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			ext := strings.ToLower(filepath.Ext(entry.Name()))
-			if r.isAllowedExtension(ext) {
-				info, err := entry.Info()
-				if err != nil {
-					continue
-				}
-
-				files = append(files, FileInfo{
-					Name:         entry.Name(),
-					Size:         info.Size(),
-					ModifiedTime: info.ModTime().Format("2006-01-02 15:04:05"),
-					Extension:    ext,
-				})
-			}
-		}
-	}
-
-	return files, nil
-}
-
-func (r *Router) isAllowedExtension(ext string) bool {
-	for _, allowed := range r.config.AllowedExtensions {
-		if "."+allowed == ext {
-			return true
-		}
+// fileError maps file store errors to HTTP responses
+func (r *Router) fileError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	case errors.Is(err, storage.ErrInvalidName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filename"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 	}
-	return false
 }
 
 func (r *Router) getScannerCapabilities(c *gin.Context) {
@@ -329,9 +840,12 @@ func (r *Router) searchPatients(c *gin.Context) {
 		searchType = "name"
 	}
 
-	r.logger.Infof("Searching for patients with term: %s (type: %s)", searchTerm, searchType)
+	r.logger.WithField(logging.FieldSearchTerm, searchTerm).Infof("Searching for patients (type: %s)", searchType)
 
 	patients, err := r.dicomService.SearchPatients(searchTerm, searchType)
+	r.auditQuery(c, audit.ActionPatientSearch, searchTerm, map[string]string{
+		audit.DetailQuery: searchType + "=" + searchTerm,
+	}, len(patients), err)
 	if err != nil {
 		r.logger.Errorf("Patient search failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -344,21 +858,113 @@ func (r *Router) searchPatients(c *gin.Context) {
 	})
 }
 
+// patientStudies lists the studies of the selected patient on the PACS
+func (r *Router) patientStudies(c *gin.Context) {
+	patientID := c.Query("patientId")
+	if patientID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "patientId is required"})
+		return
+	}
+
+	studies, err := r.dicomService.PatientStudies(patientID)
+	r.auditQuery(c, audit.ActionStudyQuery, patientID, map[string]string{
+		audit.DetailPatientID: patientID,
+		audit.DetailQuery:     "PatientID=" + patientID,
+	}, len(studies), err)
+	if err != nil {
+		r.logger.Errorf("Study query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"studies": studies,
+		"total":   len(studies),
+	})
+}
+
+// studySeries lists the series of a study of the selected patient
+func (r *Router) studySeries(c *gin.Context) {
+	patientID := c.Query("patientId")
+	if patientID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "patientId is required"})
+		return
+	}
+
+	series, err := r.dicomService.StudySeries(patientID, c.Param("studyUid"))
+	r.auditQuery(c, audit.ActionStudyQuery, patientID, map[string]string{
+		audit.DetailPatientID: patientID,
+		audit.DetailStudyUID:  c.Param("studyUid"),
+		audit.DetailQuery:     "PatientID=" + patientID + "&StudyInstanceUID=" + c.Param("studyUid"),
+	}, len(series), err)
+	if err != nil {
+		r.logger.Errorf("Series query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"series": series,
+		"total":  len(series),
+	})
+}
+
+// echoPacs verifies the query and store configuration with C-ECHO
+func (r *Router) echoPacs(c *gin.Context) {
+	results := r.dicomService.Echo()
+	ok := true
+	for _, result := range results {
+		ok = ok && result.Success
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": ok,
+		"results": results,
+	})
+}
+
+// getTagTemplates lists the attributes written per document type
+func (r *Router) getTagTemplates(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"templates": r.dicomService.TagTemplates()})
+}
+
 func (r *Router) sendToPacs(c *gin.Context) {
+	ws := r.workspace(c)
 	var req struct {
 		PatientIDs      []string          `json:"patientIds" binding:"required"`
 		DocumentCreator string            `json:"documentCreator" binding:"required"`
 		Description     string            `json:"description" binding:"required"`
 		SelectedPatient dicom.PatientInfo `json:"selectedPatient" binding:"required"`
+		Atomic          bool              `json:"atomic"`
+		Force           bool              `json:"force"`
+		// Format is "images", "pdf" or "multiframe"; empty uses
+		// DICOM_SEND_FORMAT
+		Format string `json:"format"`
+		// Birth date stated by the patient, see workflow.StepConfirmBirthDate
+		ConfirmedBirthDate string `json:"confirmedBirthDate"`
+		// StudyInstanceUID appends the pages to an existing study
+		StudyInstanceUID string `json:"studyInstanceUid"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Patient IDs, document creator, description, and selected patient are required"})
 		return
 	}
+	if !dicom.ValidSendFormat(req.Format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be images, pdf or multiframe"})
+		return
+	}
+
+	// The send takes every page in the workspace, so it must be the set of
+	// pages the operator reviewed
+	r.workspaceMu.Lock()
+	ok := r.checkWorkspaceVersion(c)
+	r.workspaceMu.Unlock()
+	if !ok {
+		return
+	}
 
 	// Get list of scanned files
-	files, err := r.getFileList()
+	files, err := ws.files.List()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file list"})
 		return
@@ -372,37 +978,207 @@ func (r *Router) sendToPacs(c *gin.Context) {
 	// Build file paths
 	var filePaths []string
 	for _, file := range files {
-		filePaths = append(filePaths, filepath.Join(r.config.TempFilesDir, file.Name))
+		path, err := ws.files.Path(file.Name)
+		if err != nil {
+			continue
+		}
+		filePaths = append(filePaths, path)
 	}
 
-	r.logger.Infof("Sending %d files to patient: %+v", len(filePaths), req.SelectedPatient)
+	if !r.checkWorkflow(c, filePaths, req.Description, req.ConfirmedBirthDate, req.SelectedPatient) {
+		return
+	}
 
-	progress, err := r.dicomService.SendToPacs(req.PatientIDs, req.DocumentCreator, req.Description, filePaths, req.SelectedPatient)
-	if err != nil {
-		r.logger.Errorf("Failed to send to PACS: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	id, running := r.sends.start(ws.id, len(filePaths))
+	if running != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another send is still in progress", "jobId": running.id})
 		return
 	}
 
-	// Count successful uploads
+	r.logger.Infof("Sending %d files to patient: %+v (job %s)", len(filePaths), req.SelectedPatient, id)
+
+	sendReq := dicom.SendRequest{
+		PatientIDs:       req.PatientIDs,
+		DocumentCreator:  req.DocumentCreator,
+		Description:      req.Description,
+		FilePaths:        filePaths,
+		Patient:          req.SelectedPatient,
+		Atomic:           req.Atomic,
+		Force:            req.Force,
+		Format:           req.Format,
+		StudyInstanceUID: req.StudyInstanceUID,
+		SourceDir:        ws.dir,
+		Operator:         r.operator(c, req.DocumentCreator),
+		BatchStartedAt:   batchStartedAt(files),
+		Trace:            c.Request.Context(),
+		OnProgress: func(progress []dicom.FileProgress) {
+			r.sends.update(id, progress)
+		},
+	}
+	// The send outlives the request; the context is copied for the user
+	cc := c.Copy()
+	go func() {
+		progress, err := r.dicomService.SendToPacs(sendReq)
+		r.auditSend(cc, sendReq.Operator, req.SelectedPatient, req.StudyInstanceUID, filePaths, progress, err)
+		if err != nil {
+			status, body := r.sendErrorResponse(progress, err)
+			r.sends.finish(id, progress, status, body)
+			return
+		}
+
+		r.previews.Forget(filePaths...)
+		r.rememberDocumentType(cc, req.Description)
+
+		r.sends.finish(id, progress, http.StatusOK, gin.H{
+			"message":  "Files sent to PACS successfully",
+			"files":    len(filePaths),
+			"patient":  req.SelectedPatient.Name,
+			"progress": progress,
+			"success":  countCompleted(progress),
+			"total":    len(progress),
+		})
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Send started",
+		"jobId":   id,
+		"files":   len(filePaths),
+		"patient": req.SelectedPatient.Name,
+	})
+}
+
+// sendError reports a failed or held upload
+func (r *Router) sendError(c *gin.Context, progress []dicom.FileProgress, err error) {
+	status, body := r.sendErrorResponse(progress, err)
+	c.JSON(status, body)
+}
+
+// sendErrorResponse returns the HTTP status and body describing a failed or
+// held upload
+func (r *Router) sendErrorResponse(progress []dicom.FileProgress, err error) (int, gin.H) {
+	var qErr *dicom.QuarantineError
+	if errors.As(err, &qErr) {
+		r.logger.Warnf("Upload held in quarantine: %v", err)
+		return http.StatusConflict, gin.H{
+			"error":      "Some pages failed conversion. The study was held back; resolve the quarantined pages before sending.",
+			"quarantine": qErr.Quarantine,
+			"progress":   progress,
+			"success":    0,
+			"total":      len(progress),
+		}
+	}
+
+	var dupErr *dicom.DuplicateStudyError
+	if errors.As(err, &dupErr) {
+		r.logger.Warnf("Upload stopped: %v", err)
+		return http.StatusConflict, gin.H{
+			"error":      "A similar study already exists for this patient today. Send again with \"force\": true to upload anyway.",
+			"duplicates": dupErr.Matches,
+		}
+	}
+
+	if errors.Is(err, dicom.ErrStudyNotFound) {
+		r.logger.Warnf("Upload stopped: %v", err)
+		return http.StatusNotFound, gin.H{"error": "The selected study was not found on the PACS for this patient"}
+	}
+
+	var atomicErr *dicom.AtomicSendError
+	if errors.As(err, &atomicErr) {
+		r.logger.Errorf("Atomic upload failed: %v", err)
+		return http.StatusBadGateway, gin.H{
+			"error":           "Not all instances could be stored. The study is marked as failed and all local files were kept.",
+			"storedInstances": atomicErr.StoredInstances,
+			"progress":        progress,
+			"success":         0,
+			"total":           len(progress),
+		}
+	}
+
+	r.logger.Errorf("Failed to send to PACS: %v", err)
+	return http.StatusInternalServerError, gin.H{"error": err.Error()}
+}
+
+// countCompleted counts successful uploads
+func countCompleted(progress []dicom.FileProgress) int {
 	successCount := 0
 	for _, p := range progress {
 		if p.Status == "completed" {
 			successCount++
 		}
 	}
+	return successCount
+}
+
+func (r *Router) listQuarantine(c *gin.Context) {
+	entries := r.dicomService.ListQuarantine()
+	c.JSON(http.StatusOK, gin.H{
+		"quarantine": entries,
+		"total":      len(entries),
+	})
+}
+
+func (r *Router) resolveQuarantinedPage(c *gin.Context) {
+	var req struct {
+		Decision string `json:"decision" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Decision is required (skip or rescan)"})
+		return
+	}
+
+	q, err := r.dicomService.ResolveQuarantinedPage(c.Param("id"), c.Param("filename"), req.Decision)
+	if err != nil {
+		r.quarantineError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"quarantine": q,
+		"resolved":   q.Resolved(),
+	})
+}
+
+func (r *Router) releaseQuarantine(c *gin.Context) {
+	progress, err := r.dicomService.ReleaseQuarantine(c.Param("id"))
+	if !errors.Is(err, dicom.ErrQuarantineNotFound) {
+		r.auditSend(c, r.currentUser(c), dicom.PatientInfo{}, "", nil, progress, err)
+	}
+	if err != nil {
+		if errors.Is(err, dicom.ErrQuarantineNotFound) {
+			r.quarantineError(c, err)
+			return
+		}
+		r.sendError(c, progress, err)
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":  "Files sent to PACS successfully",
-		"files":    len(filePaths),
-		"patient":  req.SelectedPatient.Name,
+		"message":  "Quarantined study released to PACS",
 		"progress": progress,
-		"success":  successCount,
+		"success":  countCompleted(progress),
 		"total":    len(progress),
 	})
 }
 
+func (r *Router) discardQuarantine(c *gin.Context) {
+	if err := r.dicomService.DiscardQuarantine(c.Param("id")); err != nil {
+		r.quarantineError(c, err)
+		return
+	}
+	r.auditDelete(c, c.Param("id"), map[string]string{"quarantine": c.Param("id")})
+	c.JSON(http.StatusOK, gin.H{"message": "Quarantine entry discarded"})
+}
+
+func (r *Router) quarantineError(c *gin.Context, err error) {
+	if errors.Is(err, dicom.ErrQuarantineNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
 func (r *Router) getSettings(c *gin.Context) {
+	runtime := r.runtime.Load()
 	c.JSON(http.StatusOK, gin.H{
 		"app": gin.H{
 			"name":    r.config.AppName,
@@ -423,19 +1199,30 @@ func (r *Router) getSettings(c *gin.Context) {
 			"title":       r.config.WebTitle,
 			"description": r.config.WebDescription,
 		},
+		"profile": gin.H{
+			"name":         r.config.Profile,
+			"demo_mode":    r.config.DemoMode,
+			"web_ui":       r.config.FeatureWebUI,
+			"upload":       r.config.FeatureUpload,
+			"settings_api": r.config.FeatureSettingsAPI,
+		},
 		"logging": gin.H{
-			"level":  r.config.LogLevel,
-			"format": r.config.LogFormat,
+			"level":    r.config.LogLevel,
+			"format":   r.config.LogFormat,
+			"file":     r.config.LogFile,
+			"syslog":   r.config.LogSyslog,
+			"journald": r.config.LogJournald,
 		},
 		"dicom": gin.H{
-			"local_ae_title": r.config.DicomLocalAETitle,
-			"query_ae_title": r.config.DicomQueryAETitle,
-			"store_ae_title": r.config.DicomStoreAETitle,
-			"remote_host":    r.config.DicomRemoteHost,
-			"findscu_port":   r.config.DicomFindscuPort,
-			"storescu_port":  r.config.DicomStorescuPort,
-			"dcmtk_path":     r.config.DcmtkPath,
-			"station_name":   r.config.DicomStationName,
+			"local_ae_title": runtime.DicomLocalAETitle,
+			"query_ae_title": runtime.DicomQueryAETitle,
+			"store_ae_title": runtime.DicomStoreAETitle,
+			"remote_host":    runtime.DicomRemoteHost,
+			"query_host":     runtime.DicomQueryHost,
+			"store_host":     runtime.DicomStoreHost,
+			"findscu_port":   runtime.DicomFindscuPort,
+			"storescu_port":  runtime.DicomStorescuPort,
+			"station_name":   runtime.DicomStationName,
 		},
 	})
 }
@@ -444,9 +1231,8 @@ func (r *Router) GetEngine() *gin.Engine {
 	return r.router
 }
 
-type FileInfo struct {
-	Name         string `json:"name"`
-	Size         int64  `json:"size"`
-	ModifiedTime string `json:"modified_time"`
-	Extension    string `json:"extension"`
+// GetManagementEngine returns the handler of the management listener, nil
+// unless kiosk lockdown is enabled
+func (r *Router) GetManagementEngine() *gin.Engine {
+	return r.management
 }
@@ -0,0 +1,183 @@
+package web_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"DICOMScanStation/scanner"
+	"DICOMScanStation/web"
+	"DICOMScanStation/web/fakes"
+)
+
+const testDevice = "fake:0"
+
+// decode returns the JSON object of a response
+func decode(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response %d is not JSON: %s", w.Code, w.Body)
+	}
+	return body
+}
+
+// waitForJob polls a scan or send job until it is no longer running
+func waitForJob(t *testing.T, handler http.Handler, path string) map[string]interface{} {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := request(handler, http.MethodGet, path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: %d %s", path, w.Code, w.Body)
+		}
+		job := decode(t, w)
+		if job["state"] != "running" {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s is still running", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		existing []string
+		result   []string
+		scanErr  error
+		// status is the response to the request, state the one of the job
+		status int
+		state  string
+	}{
+		{name: "pages", body: `{"device": "fake:0"}`, result: []string{"scan_001.jpg", "scan_002.jpg"}, status: http.StatusAccepted, state: "completed"},
+		{name: "scanner error", body: `{"device": "fake:0"}`, scanErr: errors.New("paper jam"), status: http.StatusAccepted, state: "failed"},
+		{name: "no device", body: `{}`, status: http.StatusBadRequest},
+		{name: "pages waiting to be sent", body: `{"device": "fake:0"}`, existing: []string{"scan_001.jpg"}, status: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanners := &fakes.ScannerService{
+				Scanners:   []*scanner.ScannerInfo{{Device: testDevice, Name: "Fake scanner"}},
+				ScanResult: tt.result,
+				ScanErr:    tt.scanErr,
+			}
+			files := fakes.NewFileStore()
+			for _, name := range tt.existing {
+				files.Save(name, strings.NewReader("page"))
+			}
+			engine := newTestRouter(testConfig(t, nil), web.Services{Scanners: scanners, Files: files})
+
+			w := request(engine, http.MethodPost, "/api/scan", tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("POST /api/scan: %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+			if tt.state == "" {
+				if len(scanners.ScanCalls) != 0 {
+					t.Errorf("scanned %v, want no scan", scanners.ScanCalls)
+				}
+				return
+			}
+
+			job := waitForJob(t, engine, "/api/scan/"+decode(t, w)["jobId"].(string))
+			if job["state"] != tt.state {
+				t.Fatalf("scan job %v, want state %s", job, tt.state)
+			}
+			if len(scanners.ScanCalls) != 1 || scanners.ScanCalls[0] != testDevice {
+				t.Errorf("scanned %v, want one scan on %s", scanners.ScanCalls, testDevice)
+			}
+			if filenames, _ := job["filenames"].([]interface{}); len(filenames) != len(tt.result) {
+				t.Errorf("scan job filenames %v, want %v", job["filenames"], tt.result)
+			}
+		})
+	}
+}
+
+func TestSendToPacs(t *testing.T) {
+	const send = `{"patientIds": ["4711"], "documentCreator": "Anna", "description": "Befund",
+		"selectedPatient": {"patientId": "4711", "name": "Doe^John"}}`
+	tests := []struct {
+		name    string
+		body    string
+		pages   []string
+		sendErr error
+		status  int
+		state   string
+	}{
+		{name: "pages", body: send, pages: []string{"scan_001.jpg", "scan_002.jpg"}, status: http.StatusAccepted, state: "completed"},
+		{name: "PACS error", body: send, pages: []string{"scan_001.jpg"}, sendErr: errors.New("association rejected"), status: http.StatusAccepted, state: "failed"},
+		{name: "no pages", body: send, status: http.StatusBadRequest},
+		{name: "no patient", body: `{"description": "Befund"}`, pages: []string{"scan_001.jpg"}, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := fakes.NewFileStore()
+			for _, name := range tt.pages {
+				files.Save(name, strings.NewReader("page"))
+			}
+			pacs := &fakes.DicomGateway{SendErr: tt.sendErr}
+			engine := newTestRouter(testConfig(t, nil), web.Services{Files: files, Dicom: pacs})
+
+			w := request(engine, http.MethodPost, "/api/dicom/send", tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("POST /api/dicom/send: %d %s, want %d", w.Code, w.Body, tt.status)
+			}
+			if tt.state == "" {
+				if len(pacs.Sent) != 0 {
+					t.Errorf("sent %v, want nothing sent", pacs.Sent)
+				}
+				return
+			}
+
+			job := waitForJob(t, engine, "/api/dicom/send/"+decode(t, w)["jobId"].(string))
+			if job["state"] != tt.state {
+				t.Fatalf("send job %v, want state %s", job, tt.state)
+			}
+			if tt.sendErr != nil {
+				return
+			}
+			if len(pacs.Sent) != 1 || len(pacs.Sent[0]) != len(tt.pages) {
+				t.Errorf("sent %v, want the %d pages in one send", pacs.Sent, len(tt.pages))
+			}
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"AUTH_USERS_FILE": usersFile(t, "anna")})
+	engine := newTestRouter(cfg, web.Services{
+		Scanners: &fakes.ScannerService{Scanners: []*scanner.ScannerInfo{{Device: testDevice}}},
+	})
+
+	if w := request(engine, http.MethodGet, "/api/scanners", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("scanners without login: %d, want 401", w.Code)
+	}
+	if w := request(engine, http.MethodPost, "/api/login", `{"username": "anna", "password": "wrong"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("login with a wrong password: %d, want 401", w.Code)
+	}
+	if w := request(engine, http.MethodPost, "/api/login", `{"username": "ben", "password": "`+testPassword+`"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("login of an unknown user: %d, want 401", w.Code)
+	}
+
+	session := signIn(t, engine, "anna")
+	if w := request(engine, http.MethodGet, "/api/scanners", "", session); w.Code != http.StatusOK {
+		t.Errorf("scanners after login: %d %s, want 200", w.Code, w.Body)
+	}
+	if user := decode(t, request(engine, http.MethodGet, "/api/me", "", session))["user"]; user != "anna" {
+		t.Errorf("user = %v, want anna", user)
+	}
+
+	if w := request(engine, http.MethodPost, "/api/logout", "", session); w.Code != http.StatusOK {
+		t.Fatalf("logout: %d %s", w.Code, w.Body)
+	}
+	if w := request(engine, http.MethodGet, "/api/scanners", "", session); w.Code != http.StatusUnauthorized {
+		t.Errorf("scanners after logout: %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,52 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"DICOMScanStation/events"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pressScanButton is called by scanbd when the button of a scanner is
+// pressed. The web interface that has the scanner selected starts a scan
+// with its current options, so the pages land in that operator's
+// workspace.
+func (r *Router) pressScanButton(c *gin.Context) {
+	var req struct {
+		Action string `json:"action"`
+	}
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	device, ok := r.buttonDevice(c.Param("device"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scanner not found"})
+		return
+	}
+
+	r.logger.Infof("Scan button pressed on %s (%s)", device, req.Action)
+	r.events.Publish(events.ScanButton, events.ScanButtonPress{Device: device, Action: req.Action})
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Scan button pressed",
+		"device":  device,
+	})
+}
+
+// buttonDevice finds the scanner scanbd names. scanbd holds the local
+// scanners and hands them to the station through its saned proxy, so
+// they are listed as net:<host>:<device>.
+func (r *Router) buttonDevice(name string) (string, bool) {
+	var proxied string
+	for _, s := range r.scannerManager.GetScanners() {
+		if s.Device == name {
+			return s.Device, true
+		}
+		if strings.HasPrefix(s.Device, "net:") && strings.HasSuffix(s.Device, ":"+name) {
+			proxied = s.Device
+		}
+	}
+	return proxied, proxied != ""
+}
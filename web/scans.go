@@ -0,0 +1,304 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/events"
+	"DICOMScanStation/scanner"
+	"DICOMScanStation/station"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scanJobTTL is how long a finished scan can still be polled
+const scanJobTTL = time.Hour
+
+// States of a background scan
+const (
+	scanRunning   = "running"
+	scanCompleted = "completed"
+	scanFailed    = "failed"
+	scanCancelled = "cancelled"
+)
+
+// scanJob is a scan running in the background
+type scanJob struct {
+	ID        string   `json:"jobId"`
+	Device    string   `json:"device"`
+	State     string   `json:"state"`
+	Filenames []string `json:"filenames"`
+	// Pages counts the pages scanned so far while the scan is running
+	Pages int    `json:"pages"`
+	Error string `json:"error,omitempty"`
+	// ErrorCode names failures the operator can fix at the scanner, see
+	// scanner.ScanError
+	ErrorCode  string     `json:"errorCode,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// Barcode is the patient ID read from the first page with
+	// PATIENT_BARCODE, Patient the patient it identifies on the PACS
+	Barcode string             `json:"barcode,omitempty"`
+	Patient *dicom.PatientInfo `json:"patient,omitempty"`
+	// Documents are the inbox documents a batch was split into at
+	// separator sheets
+	Documents []string `json:"documents,omitempty"`
+	// workspace is the ID of the workspace scanned into, empty for the
+	// shared one
+	workspace string
+}
+
+// scanTracker keeps the background scans so clients can poll them and
+// cancel them by job ID
+type scanTracker struct {
+	mu   sync.Mutex
+	jobs map[string]*scanJob
+}
+
+func newScanTracker() *scanTracker {
+	return &scanTracker{jobs: make(map[string]*scanJob)}
+}
+
+// start registers a scan starting on a device into a workspace and returns
+// its job ID
+func (t *scanTracker) start(device string, workspace string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for jobID, job := range t.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > scanJobTTL {
+			delete(t.jobs, jobID)
+		}
+	}
+	t.jobs[id] = &scanJob{ID: id, Device: device, State: scanRunning, Filenames: []string{}, StartedAt: now, workspace: workspace}
+	return id
+}
+
+// finish records the pages or the error a scan ended with
+func (t *scanTracker) finish(id string, filenames []string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	job, ok := t.jobs[id]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	job.FinishedAt = &now
+	switch {
+	case errors.Is(err, scanner.ErrScanCancelled):
+		job.State = scanCancelled
+	case err != nil:
+		job.State = scanFailed
+		job.Error = err.Error()
+		job.ErrorCode = scanErrorCode(err)
+	default:
+		job.State = scanCompleted
+		job.Filenames = filenames
+		job.Pages = len(filenames)
+	}
+}
+
+// page records that a running scan finished a page
+func (t *scanTracker) page(id string, page int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if job, ok := t.jobs[id]; ok && job.State == scanRunning && page > job.Pages {
+		job.Pages = page
+	}
+}
+
+// identify records the patient the barcode on the first page names
+func (t *scanTracker) identify(id string, barcode string, patient *dicom.PatientInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if job, ok := t.jobs[id]; ok {
+		job.Barcode = barcode
+		job.Patient = patient
+	}
+}
+
+// split records the inbox documents a batch was split into
+func (t *scanTracker) split(id string, documents []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if job, ok := t.jobs[id]; ok {
+		job.Documents = documents
+	}
+}
+
+// get returns a copy of a scan job; jobs of other workspaces are not found
+func (t *scanTracker) get(id string, workspace string) (scanJob, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	job, ok := t.jobs[id]
+	if !ok || job.workspace != workspace {
+		return scanJob{}, false
+	}
+	return *job, true
+}
+
+// workspaceOf returns the workspace of a scan job, or of the scan running
+// on device if id is empty
+func (t *scanTracker) workspaceOf(id string, device string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if id != "" {
+		job, ok := t.jobs[id]
+		if !ok {
+			return "", false
+		}
+		return job.workspace, true
+	}
+	for _, job := range t.jobs {
+		if job.Device == device && job.State == scanRunning {
+			return job.workspace, true
+		}
+	}
+	return "", false
+}
+
+// followPages counts the pages of a scan job as the scanner reports them,
+// for clients that poll the job instead of following /ws. The returned
+// function stops counting.
+func (r *Router) followPages(id string, device string) func() {
+	if r.events == nil {
+		return func() {}
+	}
+	ch, unsubscribe := r.events.Subscribe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for event := range ch {
+			progress, ok := event.Data.(events.ScanProgress)
+			if ok && event.Type == events.ScanPage && progress.Device == device {
+				r.scans.page(id, progress.Page)
+			}
+		}
+	}()
+	return func() {
+		unsubscribe()
+		<-done
+	}
+}
+
+// getScanJob returns the state of a background scan and, once completed,
+// the scanned files
+func (r *Router) getScanJob(c *gin.Context) {
+	job, ok := r.scans.get(c.Param("jobId"), r.workspace(c).id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scan job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// previewScan answers with a quick low-resolution scan of one page as a
+// JPEG image
+func (r *Router) previewScan(c *gin.Context, device string, options *scanner.ScanOptions, operator string) {
+	if r.scanPreviewer == nil || station.IsRemote(device) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Preview is not available for this scanner"})
+		return
+	}
+
+	release, ok := r.lockScanner(c, device, operator)
+	if !ok {
+		return
+	}
+	image, err := r.scanPreviewer.PreviewScan(device, options)
+	release()
+	if err != nil {
+		r.scanFailed(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/jpeg", image)
+}
+
+// lockScanner leases the scanner to a scan of operator, or answers 409 if
+// another scan holds it. The scan calls the returned function when the
+// scanner is free again.
+func (r *Router) lockScanner(c *gin.Context, device string, operator string) (func(), bool) {
+	if r.scanLocker == nil {
+		return func() {}, true
+	}
+	release, err := r.scanLocker.LockScanner(device, operator)
+	if err != nil {
+		if !r.scannerBusy(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return release, true
+}
+
+// scannerBusy answers 409 with who is scanning since when if err says the
+// scanner is busy
+func (r *Router) scannerBusy(c *gin.Context, err error) bool {
+	var busy *scanner.BusyError
+	if !errors.As(err, &busy) {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{
+		"error": busy.Error(),
+		"lease": busy.Lease,
+	})
+	return true
+}
+
+// scanFailed answers a scan that failed: 409 with the lease if the scanner
+// is busy or with the code of a failure the operator can fix at the
+// scanner, like a paper jam
+func (r *Router) scanFailed(c *gin.Context, err error) {
+	if r.scannerBusy(c, err) {
+		return
+	}
+	if code := scanErrorCode(err); code != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// scanErrorCode returns the code of a scan failure the operator can fix at
+// the scanner, "" for other errors
+func scanErrorCode(err error) string {
+	var scanErr *scanner.ScanError
+	if errors.As(err, &scanErr) {
+		return scanErr.Code
+	}
+	return ""
+}
+
+// cancelScan aborts a running scan; its pages are discarded and the job
+// ends "cancelled"
+func (r *Router) cancelScan(c *gin.Context) {
+	job, ok := r.scans.get(c.Param("jobId"), r.workspace(c).id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scan job not found"})
+		return
+	}
+	if job.State != scanRunning {
+		c.JSON(http.StatusConflict, gin.H{"error": "Scan already " + job.State})
+		return
+	}
+
+	if err := r.scanCanceller.CancelScan(job.Device); err != nil {
+		if errors.Is(err, scanner.ErrNoScanRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": "The scan on this scanner cannot be cancelled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	r.logger.Infof("Scan %s on %s cancelled from %s", job.ID, job.Device, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "Scan cancelled", "jobId": c.Param("jobId")})
+}
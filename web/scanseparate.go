@@ -0,0 +1,143 @@
+package web
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"DICOMScanStation/pending"
+	"DICOMScanStation/separate"
+)
+
+// separateBatch splits the pages of an ADF batch at separator sheets into
+// one inbox document per section, so a stack of several patients' records
+// can be scanned in one go. Separator sheets are dropped and the batch
+// leaves the workspace. Without separators the pages stay in the workspace
+// and no documents are returned.
+func (r *Router) separateBatch(ws workspace, filenames []string, device string, operator string) ([]string, error) {
+	opts := separate.ScanOptionsFromConfig(r.config)
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	type section struct {
+		pages   []string
+		barcode string
+	}
+	var sections []section
+	current := section{}
+	separators := 0
+	for i, name := range filenames {
+		path, err := ws.files.Path(name)
+		if err != nil {
+			return nil, err
+		}
+		result, err := classifyScanPage(path, opts)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %v", i+1, err)
+		}
+		if !result.Separator {
+			current.pages = append(current.pages, path)
+			continue
+		}
+
+		separators++
+		r.logger.Debugf("Page %d of the scan on %s is a separator (%s)", i+1, device, result.Rule)
+		if len(current.pages) > 0 {
+			sections = append(sections, current)
+			current = section{}
+		}
+		if result.Barcode != "" {
+			current.barcode = result.Barcode
+		}
+	}
+	if len(current.pages) > 0 {
+		sections = append(sections, current)
+	}
+	if separators == 0 {
+		return nil, nil
+	}
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("the batch contains only separator sheets")
+	}
+
+	r.workspaceMu.Lock()
+	defer r.workspaceMu.Unlock()
+
+	var created []string
+	rollback := func() {
+		for _, id := range created {
+			r.pending.Delete(id)
+		}
+	}
+	for n, sec := range sections {
+		doc := pending.Document{
+			Source: pending.SourceScan,
+			Sender: operator,
+			Title:  fmt.Sprintf("Scan %s (%d/%d)", device, n+1, len(sections)),
+			Metadata: map[string]string{
+				"device":  device,
+				"section": strconv.Itoa(n + 1),
+			},
+		}
+		if operator != "" {
+			doc.Metadata["operator"] = operator
+		}
+		if sec.barcode != "" {
+			doc.Metadata["barcode"] = sec.barcode
+		}
+
+		var attachments []pending.Attachment
+		for i, path := range sec.pages {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				rollback()
+				return nil, err
+			}
+			ext, contentType := ".jpg", "image/jpeg"
+			if filepath.Ext(path) == ".png" {
+				ext, contentType = ".png", "image/png"
+			}
+			attachments = append(attachments, pending.Attachment{
+				Name:        fmt.Sprintf("page_%03d%s", i+1, ext),
+				ContentType: contentType,
+				Data:        data,
+			})
+		}
+
+		added, err := r.pending.Add(doc, attachments)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		created = append(created, added.ID)
+	}
+
+	// Only clear the workspace once every section is safe in the inbox
+	for _, name := range filenames {
+		if err := ws.files.Delete(name); err != nil {
+			r.logger.Warnf("Failed to remove %s from the workspace: %v", name, err)
+		}
+	}
+
+	r.logger.Infof("Split scan on %s into %d inbox documents at %d separator sheets", device, len(created), separators)
+	return created, nil
+}
+
+func classifyScanPage(path string, opts separate.Options) (separate.Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return separate.Result{}, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return separate.Result{}, err
+	}
+	return separate.Classify(img, opts), nil
+}
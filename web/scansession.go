@@ -0,0 +1,143 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"DICOMScanStation/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getScanSession returns the pages of the workspace in the order they are
+// sent, with where each came from
+func (r *Router) getScanSession(c *gin.Context) {
+	ws := r.workspace(c)
+	session, err := ws.scanSession.ScanSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	version := r.currentWorkspaceVersion(ws)
+	setETag(c, version)
+	c.JSON(http.StatusOK, gin.H{"session": session, "version": version})
+}
+
+// reorderPages puts the pages in a new order; the order must name every
+// page once
+func (r *Router) reorderPages(c *gin.Context) {
+	ws := r.workspace(c)
+	var req struct {
+		Pages []string `json:"pages" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pages are required"})
+		return
+	}
+
+	r.workspaceMu.Lock()
+	defer r.workspaceMu.Unlock()
+	if !r.checkWorkspaceVersion(c) {
+		return
+	}
+
+	session, err := ws.scanSession.Reorder(req.Pages)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidOrder) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Pages reordered",
+		"session": session,
+		"version": r.currentWorkspaceVersion(ws),
+	})
+}
+
+// removePage takes a page out of the scan session and deletes it
+func (r *Router) removePage(c *gin.Context) {
+	ws := r.workspace(c)
+	r.workspaceMu.Lock()
+	defer r.workspaceMu.Unlock()
+	if !r.checkWorkspaceVersion(c) {
+		return
+	}
+
+	if err := ws.files.Delete(c.Param("filename")); err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidName) {
+			r.fileError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file"})
+		return
+	}
+	r.auditDelete(c, c.Param("filename"), map[string]string{"workspace": ws.id})
+
+	session, err := ws.scanSession.ScanSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Page removed",
+		"session": session,
+		"version": r.currentWorkspaceVersion(ws),
+	})
+}
+
+// annotatePages notes where new pages came from; a failure is only logged
+func (r *Router) annotatePages(ws workspace, names []string, info storage.PageInfo) {
+	if ws.scanSession == nil || len(names) == 0 {
+		return
+	}
+	if err := ws.scanSession.Annotate(names, info); err != nil {
+		r.logger.Warnf("Failed to record the source of %d pages: %v", len(names), err)
+	}
+}
+
+// placePages moves the named pages, appended by a scan, behind the page
+// after, keeping their order
+func (r *Router) placePages(ws workspace, names []string, after string) error {
+	r.workspaceMu.Lock()
+	defer r.workspaceMu.Unlock()
+
+	session, err := ws.scanSession.ScanSession()
+	if err != nil {
+		return err
+	}
+	placed := make(map[string]bool, len(names))
+	for _, name := range names {
+		placed[name] = true
+	}
+	order := make([]string, 0, len(session.Pages))
+	found := false
+	for _, p := range session.Pages {
+		if placed[p.Name] {
+			continue
+		}
+		order = append(order, p.Name)
+		if p.Name == after {
+			order = append(order, names...)
+			found = true
+		}
+	}
+	if !found {
+		// The page was deleted while scanning, the pages stay at the end
+		return nil
+	}
+	_, err = ws.scanSession.Reorder(order)
+	return err
+}
+
+// hasFile reports whether the workspace holds a file of the name
+func hasFile(files []storage.FileInfo, name string) bool {
+	for _, f := range files {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/events"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sendJobTTL is how long a finished send can still be polled
+const sendJobTTL = time.Hour
+
+// States of a background send
+const (
+	sendRunning   = "running"
+	sendCompleted = "completed"
+	sendFailed    = "failed"
+)
+
+// sendJob is a send to the PACS running in the background
+type sendJob struct {
+	id string
+	// workspace is the ID of the workspace sent, empty for the shared one
+	workspace  string
+	state      string
+	progress   []dicom.FileProgress
+	startedAt  time.Time
+	finishedAt time.Time
+	// status and result are the response the send finished with
+	status int
+	result gin.H
+}
+
+// sendTracker keeps the background sends so clients can poll their
+// progress, and publishes their progress to events if set. Only one send of
+// the workspace runs at a time.
+type sendTracker struct {
+	mu     sync.Mutex
+	jobs   map[string]*sendJob
+	events *events.Hub
+}
+
+func newSendTracker(hub *events.Hub) *sendTracker {
+	return &sendTracker{jobs: make(map[string]*sendJob), events: hub}
+}
+
+// sendEvent is the data of send events
+type sendEvent struct {
+	JobID string `json:"jobId"`
+	// Files is the number of pages of a started send
+	Files int `json:"files,omitempty"`
+	// File is the file a send.file event reports
+	File *dicom.FileProgress `json:"file,omitempty"`
+	// State and HTTPStatus are set when the send finished
+	State      string `json:"state,omitempty"`
+	HTTPStatus int    `json:"httpStatus,omitempty"`
+}
+
+// start registers a new send of files pages of a workspace; if one of the
+// workspace is still running it is returned instead
+func (t *sendTracker) start(workspace string, files int) (string, *sendJob) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for id, job := range t.jobs {
+		if job.state == sendRunning && job.workspace == workspace {
+			return "", job
+		}
+		if job.state == sendRunning {
+			continue
+		}
+		if now.Sub(job.finishedAt) > sendJobTTL {
+			delete(t.jobs, id)
+		}
+	}
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	t.jobs[id] = &sendJob{id: id, workspace: workspace, state: sendRunning, startedAt: now}
+	t.events.Publish(events.SendStarted, sendEvent{JobID: id, Files: files})
+	return id, nil
+}
+
+// update records the progress of a running send and publishes the files
+// whose progress changed
+func (t *sendTracker) update(id string, progress []dicom.FileProgress) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	job, ok := t.jobs[id]
+	if !ok || job.state != sendRunning {
+		return
+	}
+	for i := range progress {
+		if i < len(job.progress) && job.progress[i] == progress[i] {
+			continue
+		}
+		file := progress[i]
+		t.events.Publish(events.SendFile, sendEvent{JobID: id, File: &file})
+	}
+	job.progress = progress
+}
+
+// finish records the response of a send
+func (t *sendTracker) finish(id string, progress []dicom.FileProgress, status int, result gin.H) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	job, ok := t.jobs[id]
+	if !ok {
+		return
+	}
+	job.state = sendCompleted
+	if status != http.StatusOK {
+		job.state = sendFailed
+	}
+	if progress != nil {
+		job.progress = progress
+	}
+	job.finishedAt = time.Now()
+	job.status = status
+	job.result = result
+	t.events.Publish(events.SendFinished, sendEvent{JobID: id, State: job.state, HTTPStatus: status})
+}
+
+// view returns the state of a send as served to clients; a finished send
+// carries the response it finished with. Sends of other workspaces are not
+// found.
+func (t *sendTracker) view(id string, workspace string) (gin.H, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	job, ok := t.jobs[id]
+	if !ok || job.workspace != workspace {
+		return nil, false
+	}
+
+	view := gin.H{}
+	for key, value := range job.result {
+		view[key] = value
+	}
+	view["jobId"] = job.id
+	view["state"] = job.state
+	view["progress"] = job.progress
+	view["success"] = countCompleted(job.progress)
+	view["total"] = len(job.progress)
+	view["startedAt"] = job.startedAt
+	if job.state != sendRunning {
+		view["finishedAt"] = job.finishedAt
+		view["httpStatus"] = job.status
+	}
+	return view, true
+}
+
+// workspaceOf returns the workspace of a send
+func (t *sendTracker) workspaceOf(id string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	job, ok := t.jobs[id]
+	if !ok {
+		return "", false
+	}
+	return job.workspace, true
+}
+
+// getSendProgress returns the progress of a background send
+func (r *Router) getSendProgress(c *gin.Context) {
+	view, ok := r.sends.view(c.Param("jobId"), r.workspace(c).id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Send job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
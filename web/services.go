@@ -0,0 +1,250 @@
+package web
+
+import (
+	"io"
+	"time"
+
+	"DICOMScanStation/alerts"
+	"DICOMScanStation/archive"
+	"DICOMScanStation/audit"
+	"DICOMScanStation/auth"
+	"DICOMScanStation/config"
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/events"
+	"DICOMScanStation/faults"
+	"DICOMScanStation/history"
+	"DICOMScanStation/jobs"
+	"DICOMScanStation/pending"
+	"DICOMScanStation/preferences"
+	"DICOMScanStation/profiles"
+	"DICOMScanStation/scanner"
+	"DICOMScanStation/separate"
+	"DICOMScanStation/session"
+	"DICOMScanStation/storage"
+	"DICOMScanStation/workflow"
+)
+
+// ScannerService is the scanner functionality used by the HTTP handlers
+type ScannerService interface {
+	GetScanners() []*scanner.ScannerInfo
+	GetScannerCapabilities(device string) (*scanner.Capabilities, error)
+	ScanDocument(device string, options *scanner.ScanOptions) ([]string, error)
+}
+
+// ScannerAdmin restarts the scanner subsystem when SANE is stuck
+type ScannerAdmin interface {
+	Restart(opts scanner.RestartOptions) (*scanner.RestartResult, error)
+}
+
+// ScanSessionStore orders the pages of the workspace and keeps where they
+// came from
+type ScanSessionStore interface {
+	ScanSession() (*storage.ScanSession, error)
+	Reorder(names []string) (*storage.ScanSession, error)
+	Annotate(names []string, info storage.PageInfo) error
+}
+
+// ScanCanceller stops the scan running on a device
+type ScanCanceller interface {
+	CancelScan(device string) error
+}
+
+// ScanLocker leases a scanner to one scan at a time
+type ScanLocker interface {
+	LockScanner(device string, owner string) (func(), error)
+}
+
+// ScanPreviewer makes quick low-resolution scans that are not kept
+type ScanPreviewer interface {
+	PreviewScan(device string, options *scanner.ScanOptions) ([]byte, error)
+}
+
+// FileStore gives the handlers access to the scanned files
+type FileStore interface {
+	List() ([]storage.FileInfo, error)
+	Path(name string) (string, error)
+	Save(name string, r io.Reader) error
+	Delete(name string) error
+	IsAllowedExtension(ext string) bool
+}
+
+// WorkspaceProvider gives every session a workspace of its own
+type WorkspaceProvider interface {
+	Workspace(id string) (*storage.LocalFileStore, error)
+}
+
+// DicomGateway talks to the PACS for patient queries and uploads
+type DicomGateway interface {
+	SearchPatients(searchTerm string, searchType string) ([]dicom.PatientInfo, error)
+	PatientStudies(patientID string) ([]dicom.StudyInfo, error)
+	StudySeries(patientID string, studyInstanceUID string) ([]dicom.SeriesInfo, error)
+	SendToPacs(req dicom.SendRequest) ([]dicom.FileProgress, error)
+	ListQuarantine() []dicom.Quarantine
+	ResolveQuarantinedPage(id string, filename string, decision string) (*dicom.Quarantine, error)
+	ReleaseQuarantine(id string) ([]dicom.FileProgress, error)
+	DiscardQuarantine(id string) error
+	ResendArchived(studyInstanceUID string) ([]dicom.FileProgress, error)
+	Echo() []dicom.EchoResult
+	TagTemplates() map[string]map[string]string
+}
+
+// ArchiveStore gives access to the local copies of sent studies
+type ArchiveStore interface {
+	List() ([]archive.Study, error)
+	Get(studyInstanceUID string) (*archive.Study, error)
+	Open(studyInstanceUID string, filename string) (io.ReadCloser, *archive.Instance, error)
+	Search(q archive.Query) ([]archive.Study, error)
+	Stats() (archive.Stats, error)
+}
+
+// ArchiveExporter renders archived studies as PDF/A documents
+type ArchiveExporter interface {
+	PDF(studyInstanceUID string) ([]byte, *archive.Study, error)
+	ToShare(studyInstanceUID string) (string, error)
+}
+
+// PendingStore is the inbox of documents awaiting patient assignment
+type PendingStore interface {
+	List() ([]pending.Document, error)
+	Get(id string) (*pending.Document, error)
+	Add(doc pending.Document, attachments []pending.Attachment) (*pending.Document, error)
+	FilePath(id string, filename string) (string, error)
+	Delete(id string) error
+	Claim(id string, operator string, dir string) ([]string, error)
+	Split(id string, opts separate.Options) ([]pending.Document, error)
+	Lock(id string, operator string) (*pending.Document, error)
+	Unlock(id string, operator string) (*pending.Document, error)
+	Assign(id string, operator string, a pending.Assignment) (*pending.Document, error)
+	Pages(id string) ([]string, error)
+	PagePath(id string, page string) (string, error)
+	PrepareSend(id string, operator string) (*pending.Document, string, error)
+	Sent(id string, sentPages []string) (int, error)
+}
+
+// AlertStore holds notifications for administrators
+type AlertStore interface {
+	List(includeAcknowledged bool) []alerts.Alert
+	Acknowledge(id string) error
+}
+
+// FaultInjector exposes the runtime fault injection settings in demo mode
+type FaultInjector interface {
+	Settings() faults.Settings
+	SetSettings(s faults.Settings) error
+}
+
+// ConfigReloader changes the runtime settings of the running station
+type ConfigReloader interface {
+	Current() *config.Config
+	Update(changes map[string]string, commit config.Commit) ([]string, error)
+}
+
+// PreferenceStore keeps per-user settings
+type PreferenceStore interface {
+	Get(user string) preferences.Preferences
+	Put(user string, prefs preferences.Preferences) (preferences.Preferences, error)
+	SetLastDocumentType(user string, documentType string) error
+}
+
+// ProfileStore keeps the named scan presets
+type ProfileStore interface {
+	List() []profiles.Profile
+	Get(id string) (profiles.Profile, error)
+	Create(p profiles.Profile) (profiles.Profile, error)
+	Update(id string, p profiles.Profile) (profiles.Profile, error)
+	Delete(id string) error
+}
+
+// APIKeyStore keeps the API keys of programmatic clients
+type APIKeyStore interface {
+	List() []auth.APIKey
+	Create(name string, scopes []string, createdBy string) (auth.APIKey, string, error)
+	Revoke(id string) (auth.APIKey, error)
+	Lookup(key string) (auth.APIKey, bool)
+}
+
+// HistoryStore is the log of uploads used for reports
+type HistoryStore interface {
+	Entries(from, to time.Time) ([]history.Entry, error)
+}
+
+// JobLog records scans and sends for later lookup
+type JobLog interface {
+	Record(job jobs.Job) (int64, error)
+	List(filter jobs.Filter) ([]jobs.Job, error)
+	Get(id int64) (*jobs.Job, error)
+}
+
+// AuditLog records security relevant actions
+type AuditLog interface {
+	Record(event audit.Event) error
+}
+
+// SessionTracker logs the kiosk out after inactivity, per workspace with
+// WORKSPACE_SESSIONS; "" names the shared workspace
+type SessionTracker interface {
+	Touch(workspace, operator string)
+	Status(workspace string) session.Status
+}
+
+// SendBenchmark measures the store throughput with synthetic instances
+type SendBenchmark interface {
+	Benchmark(req dicom.BenchmarkRequest) (*dicom.BenchmarkReport, error)
+}
+
+// SendQueue is the queue of studies shared by several stations
+type SendQueue interface {
+	QueuedJobs(limit int) ([]dicom.QueuedJob, error)
+	RetryQueuedJob(id int64) error
+}
+
+// Outbox holds the instances the PACS could not take until they are
+// delivered
+type Outbox interface {
+	OutboxEntries() ([]dicom.OutboxEntry, error)
+	RetryOutboxEntry(id string) error
+	DeleteOutboxEntry(id string) error
+}
+
+// Services bundles the dependencies of the router. Optional services may be
+// nil, in which case their routes are not registered.
+type Services struct {
+	Scanners     ScannerService
+	ScannerAdmin ScannerAdmin
+	// ScanCanceller aborts running scans; nil disables cancelling
+	ScanCanceller ScanCanceller
+	// ScanPreviewer serves preview scans; nil rejects them
+	ScanPreviewer ScanPreviewer
+	// ScanLocker refuses a second scan on a busy scanner right away; nil
+	// leaves it to the scan to fail
+	ScanLocker  ScanLocker
+	Files       FileStore
+	ScanSession ScanSessionStore
+	// Workspaces separates the pages of each session with
+	// WORKSPACE_SESSIONS; nil shares Files between all
+	Workspaces WorkspaceProvider
+	Dicom      DicomGateway
+	Archive    ArchiveStore
+	Exporter   ArchiveExporter
+	Pending    PendingStore
+	Alerts     AlertStore
+	Faults     FaultInjector
+	// Config changes PACS and scanner settings at runtime; nil disables
+	// the admin configuration API
+	Config      ConfigReloader
+	Preferences PreferenceStore
+	Profiles    ProfileStore
+	// APIKeys authenticates programmatic clients; nil disables API keys
+	APIKeys APIKeyStore
+	History HistoryStore
+	Jobs    JobLog
+	// Workflow lists the steps required before sending; nil enforces none
+	Workflow  *workflow.Policy
+	Audit     AuditLog
+	Session   SessionTracker
+	Benchmark SendBenchmark
+	Queue     SendQueue
+	Outbox    Outbox
+	// Events streams scan and send progress over /ws; nil disables it
+	Events *events.Hub
+}
@@ -0,0 +1,33 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// trackActivity keeps the kiosk session alive. Only changes count as
+// activity, since the UI polls the file list and scanners on its own; the
+// UI reports keyboard and mouse input via /api/session/activity. Long
+// requests such as a scan or send count when they start and when they end.
+func (r *Router) trackActivity(c *gin.Context) {
+	// Scripts with an API key are not someone at the kiosk
+	_, apiKey := c.Get(apiKeyContextKey)
+	if c.Request.Method == http.MethodGet || apiKey {
+		c.Next()
+		return
+	}
+
+	workspace := r.workspace(c).id
+	r.session.Touch(workspace, r.currentUser(c))
+	c.Next()
+	r.session.Touch(workspace, r.currentUser(c))
+}
+
+func (r *Router) getSession(c *gin.Context) {
+	c.JSON(http.StatusOK, r.session.Status(r.workspace(c).id))
+}
+
+func (r *Router) sessionActivity(c *gin.Context) {
+	c.JSON(http.StatusOK, r.session.Status(r.workspace(c).id))
+}
@@ -0,0 +1,129 @@
+package web
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"DICOMScanStation/scanner"
+	"DICOMScanStation/station"
+	"DICOMScanStation/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxStationRequest bounds the body of a signed station API call
+const maxStationRequest = 1 << 20
+
+// requireStationKey admits calls from peer stations signed with
+// STATION_API_KEY and answers their nonce, so the caller knows it talks to
+// a station holding the same key
+func (r *Router) requireStationKey(c *gin.Context) {
+	if !r.checkLockout(c, "") {
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxStationRequest))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err := r.stationVerifier.Verify(c.Request, body); err != nil {
+		r.logger.Warnf("Rejected station API call from %s: %v", c.ClientIP(), err)
+		r.authFailed(c, "station key", "")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid station signature"})
+		return
+	}
+	r.authSucceeded(c, "")
+	c.Header(station.HeaderProof, station.Proof(r.config.StationAPIKey, c.GetHeader(station.HeaderNonce)))
+	c.Next()
+}
+
+// stationScanners lists the scanners attached to this station. Scanners
+// proxied from other stations are left out, so stations can point at each
+// other without loops.
+func (r *Router) stationScanners(c *gin.Context) {
+	scanners := []*scanner.ScannerInfo{}
+	for _, s := range r.scannerManager.GetScanners() {
+		if !station.IsRemote(s.Device) {
+			scanners = append(scanners, s)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"scanners": scanners})
+}
+
+func (r *Router) stationCapabilities(c *gin.Context) {
+	device := c.Param("device")
+	if station.IsRemote(device) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scanner not found"})
+		return
+	}
+	r.getScannerCapabilities(c)
+}
+
+// stationScan scans for a peer station and hands the pages over instead of
+// keeping them in this station's workspace
+func (r *Router) stationScan(c *gin.Context) {
+	var req station.ScanRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Device == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Device is required"})
+		return
+	}
+	if station.IsRemote(req.Device) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scanner not found"})
+		return
+	}
+	if ok, reserved := r.reservations.CanUse(req.Device, ""); !ok {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":       "Scanner is reserved by " + reserved.Holder + " until " + reserved.Expires.Format("15:04"),
+			"reservation": reserved,
+		})
+		return
+	}
+
+	// The pages go to a directory of their own, not to the workspace the
+	// local users list and send
+	dir, err := os.MkdirTemp("", "station-scan-*")
+	if err != nil {
+		r.logger.Errorf("Failed to create a directory for a remote scan: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare the scan"})
+		return
+	}
+	defer os.RemoveAll(dir)
+	if req.Options == nil {
+		defaults := r.defaultOptions(req.Device)
+		req.Options = &defaults
+	}
+	req.Options.Dir = dir
+
+	release, ok := r.lockScanner(c, req.Device, "station "+c.ClientIP())
+	if !ok {
+		return
+	}
+	_, span := tracing.Start(c.Request.Context(), "scan", attribute.String("scanner.device", req.Device))
+	filenames, err := r.scannerManager.ScanDocument(req.Device, req.Options)
+	span.SetAttributes(attribute.Int("scan.pages", len(filenames)))
+	tracing.End(span, err)
+	release()
+	if err != nil {
+		r.scanFailed(c, err)
+		return
+	}
+
+	pages := make([]station.Page, 0, len(filenames))
+	for _, name := range filenames {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.Base(name)))
+		if err != nil {
+			r.logger.Errorf("Failed to hand over scanned page %s: %v", name, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read scanned page " + name})
+			return
+		}
+		pages = append(pages, station.Page{Name: name, Data: data})
+	}
+
+	r.logger.Infof("Scanned %d pages on %s for a remote station (%s)", len(pages), req.Device, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"pages": pages})
+}
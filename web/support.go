@@ -0,0 +1,106 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"DICOMScanStation/audit"
+	"DICOMScanStation/support"
+
+	"github.com/gin-gonic/gin"
+)
+
+// supportHistoryDays is how far back a support bundle lists uploads
+const supportHistoryDays = 7
+
+// supportQueueJobs limits the queued studies in a support bundle
+const supportQueueJobs = 200
+
+// quarantineSummary leaves the request and its patient out of the bundle
+type quarantineSummary struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Pages     []string  `json:"pages"`
+}
+
+// createSupportBundle assembles logs, settings, recent jobs, diagnostics and
+// version information into a zip for a support ticket. Everything passes
+// the redactor, which removes configured secrets, credentials and patient
+// identifiers; the patient records in jobs are replaced field by field.
+func (r *Router) createSupportBundle(c *gin.Context) {
+	redactor := support.NewRedactor(r.config.SecretValues())
+	var buf bytes.Buffer
+	bundle := support.NewBundle(&buf, redactor)
+
+	add := func(name string, v interface{}, err error) {
+		if err == nil {
+			err = bundle.AddJSON(name, v)
+		}
+		if err != nil {
+			bundle.AddError(name, err)
+		}
+	}
+
+	add("version.json", support.CurrentVersion(r.config.AppName, r.config.AppVersion), nil)
+	// Settings changed at runtime are reported with their source "admin"
+	runtime := r.runtime.Load()
+	add("config.json", runtime.Settings(), nil)
+	add("diagnostics.json", support.RunDiagnostics(runtime), nil)
+	logFiles := r.config.SupportLogFiles
+	// The log file of the station itself is always included
+	if r.config.LogFile != "" && !slices.Contains(logFiles, r.config.LogFile) {
+		logFiles = append(slices.Clone(logFiles), r.config.LogFile)
+	}
+	for _, log := range support.CollectLogs(r.config.SupportLogUnit, logFiles, r.config.SupportLogLines) {
+		name := "logs/" + log.Name
+		if log.Err != nil {
+			bundle.AddError(name, log.Err)
+			continue
+		}
+		if err := bundle.AddText(name, log.Text); err != nil {
+			bundle.AddError(name, err)
+		}
+	}
+
+	if r.history != nil {
+		now := time.Now()
+		entries, err := r.history.Entries(now.AddDate(0, 0, -supportHistoryDays), now)
+		add("jobs/history.json", entries, err)
+	}
+	if r.queue != nil {
+		jobs, err := r.queue.QueuedJobs(supportQueueJobs)
+		add("jobs/queue.json", jobs, err)
+	}
+	var quarantine []quarantineSummary
+	for _, q := range r.dicomService.ListQuarantine() {
+		summary := quarantineSummary{ID: q.ID, CreatedAt: q.CreatedAt}
+		for _, p := range q.Pages {
+			summary.Pages = append(summary.Pages, fmt.Sprintf("%s: %s (%s)", p.Filename, p.Reason, p.Decision))
+		}
+		quarantine = append(quarantine, summary)
+	}
+	add("jobs/quarantine.json", quarantine, nil)
+	if r.alerts != nil {
+		add("alerts.json", r.alerts.List(true), nil)
+	}
+	add("scanners.json", r.scannerManager.GetScanners(), nil)
+
+	if err := bundle.Close(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create support bundle: " + err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("support-bundle-%s-%s.zip", r.config.DicomStationName, time.Now().Format("20060102-150405"))
+	r.logger.Infof("Support bundle %s created for %s", filename, c.ClientIP())
+	r.recordAudit(c, audit.Event{
+		User:   r.currentUser(c),
+		Action: audit.ActionSupportBundle,
+		Target: filename,
+	})
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
@@ -0,0 +1,33 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// thumbnailSize is the longest side of the thumbnails in the file list
+const thumbnailSize = 300
+
+// getThumbnail serves a small preview of a page for the file list. The file
+// list asks with the size and modification time of the page in the URL, so
+// the browser may keep it.
+func (r *Router) getThumbnail(c *gin.Context) {
+	ws := r.workspace(c)
+	filename := c.Param("filename")
+	path, err := ws.files.Path(filename)
+	if err != nil {
+		r.fileError(c, err)
+		return
+	}
+
+	thumb, err := r.thumbnails.Get(path)
+	if err != nil {
+		r.logger.Errorf("Failed to create thumbnail of %s: %v", filename, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create thumbnail"})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.File(thumb)
+}
@@ -0,0 +1,176 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"DICOMScanStation/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Self-signed certificates are kept in STATE_DIR, so browsers that trust
+// one keep trusting it across restarts
+const (
+	selfSignedDir      = "tls"
+	selfSignedCert     = "server.crt"
+	selfSignedKey      = "server.key"
+	selfSignedValidity = 365 * 24 * time.Hour
+	// selfSignedRenewal renews a certificate that expires within this time
+	selfSignedRenewal = 30 * 24 * time.Hour
+)
+
+// TLSEnabled reports whether the web interface is served over HTTPS
+func TLSEnabled(cfg *config.Config) bool {
+	return cfg.WebTLSCert != "" || cfg.WebTLSKey != "" || cfg.WebTLSSelfSigned
+}
+
+// LoadServerTLS returns the TLS configuration of the web server, nil
+// without HTTPS. With WEB_TLS_SELF_SIGNED a certificate for the host names
+// of the station is generated unless a valid one exists.
+func LoadServerTLS(cfg *config.Config) (*tls.Config, error) {
+	if !TLSEnabled(cfg) {
+		return nil, nil
+	}
+
+	certFile, keyFile := cfg.WebTLSCert, cfg.WebTLSKey
+	if certFile == "" && keyFile == "" {
+		dir := filepath.Join(cfg.StateDir, selfSignedDir)
+		certFile, keyFile = filepath.Join(dir, selfSignedCert), filepath.Join(dir, selfSignedKey)
+		if err := ensureSelfSigned(certFile, keyFile, tlsHostnames(cfg)); err != nil {
+			return nil, fmt.Errorf("failed to create a self-signed certificate: %v", err)
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the web server certificate: %v", err)
+	}
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}, nil
+}
+
+// tlsHostnames are the names and addresses a self-signed certificate is
+// issued for
+func tlsHostnames(cfg *config.Config) []string {
+	names := []string{"localhost", "127.0.0.1", "::1"}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		names = append(names, host)
+	}
+	if ip := net.ParseIP(cfg.AppHost); ip != nil && !ip.IsUnspecified() {
+		names = append(names, cfg.AppHost)
+	}
+	for _, name := range cfg.WebTLSHostnames {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ensureSelfSigned keeps the certificate in certFile if it is valid for a
+// while and covers names, and creates a new one otherwise
+func ensureSelfSigned(certFile string, keyFile string, names []string) error {
+	if data, err := os.ReadFile(certFile); err == nil {
+		if block, _ := pem.Decode(data); block != nil {
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil &&
+				time.Until(cert.NotAfter) > selfSignedRenewal && coversNames(cert, names) {
+				if _, err := os.Stat(keyFile); err == nil {
+					return nil
+				}
+			}
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: names[len(names)-1], Organization: []string{"DICOMScanStation"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+// coversNames reports whether a certificate is valid for all names
+func coversNames(cert *x509.Certificate, names []string) bool {
+	for _, name := range names {
+		if cert.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// RedirectToHTTPS sends plain HTTP requests of WEB_HTTP_REDIRECT_PORT to
+// the HTTPS port of the web interface
+func RedirectToHTTPS(cfg *config.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if cfg.AppPort != "443" {
+			host += ":" + cfg.AppPort
+		}
+		// 308 keeps the method and body of API calls
+		http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// strictTransportSecurity tells browsers to use HTTPS only. It is not sent
+// with a self-signed certificate, which users could then not accept.
+func (r *Router) strictTransportSecurity(c *gin.Context) {
+	c.Header("Strict-Transport-Security", "max-age=31536000")
+	c.Next()
+}
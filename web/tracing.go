@@ -0,0 +1,26 @@
+package web
+
+import (
+	"fmt"
+
+	"DICOMScanStation/tracing"
+
+	"github.com/gin-gonic/gin"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// traceRequest records a span for every API request. Handlers start the
+// spans of scans and sends from the context of the request.
+func (r *Router) traceRequest(c *gin.Context) {
+	ctx, span := tracing.StartRequest(c.Request, c.FullPath())
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+
+	status := c.Writer.Status()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	var err error
+	if status >= 500 {
+		err = fmt.Errorf("HTTP %d", status)
+	}
+	tracing.End(span, err)
+}
@@ -0,0 +1,77 @@
+package web
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userContextKey is where authentication middleware stores the user name
+const userContextKey = "user"
+
+// currentUser returns the signed-in user, or "" for anonymous requests.
+// Until the station has its own login, a user name set by a trusted
+// reverse proxy (badge reader, SSO gateway) is accepted when
+// TRUSTED_USER_HEADER is configured. Other clients could set the header
+// to anything, so it is only believed from TRUSTED_PROXIES.
+func (r *Router) currentUser(c *gin.Context) string {
+	if user := c.GetString(userContextKey); user != "" {
+		return user
+	}
+	if header := r.config.TrustedUserHeader; header != "" && r.fromTrustedProxy(c) {
+		return strings.TrimSpace(c.GetHeader(header))
+	}
+	return ""
+}
+
+// fromTrustedProxy reports whether the request comes straight from one of
+// TRUSTED_PROXIES
+func (r *Router) fromTrustedProxy(c *gin.Context) bool {
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return false
+	}
+	for _, network := range r.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetworks reads addresses and networks in CIDR notation, like gin
+// does for TRUSTED_PROXIES
+func parseNetworks(entries []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: entry}
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			entry += "/" + strconv.Itoa(bits)
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// operator names the person responsible for an upload in reports. Without
+// a signed-in user the document creator entered in the form is used.
+func (r *Router) operator(c *gin.Context, documentCreator string) string {
+	if user := r.currentUser(c); user != "" {
+		return user
+	}
+	return strings.TrimSpace(documentCreator)
+}
@@ -0,0 +1,48 @@
+package web_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"DICOMScanStation/web"
+)
+
+func TestTrustedUserHeader(t *testing.T) {
+	cfg := testConfig(t, map[string]string{
+		"TRUSTED_USER_HEADER": "X-Remote-User",
+		"TRUSTED_PROXIES":     "10.0.0.5,192.168.10.0/24",
+	})
+	engine := newTestRouter(cfg, web.Services{})
+
+	tests := []struct {
+		name   string
+		remote string
+		want   string
+	}{
+		{"trusted proxy", "10.0.0.5:40000", "anna"},
+		{"trusted network", "192.168.10.7:40000", "anna"},
+		{"other client", "10.0.0.6:40000", ""},
+		{"client of a trusted network next door", "192.168.11.7:40000", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+			req.RemoteAddr = tt.remote
+			req.Header.Set("X-Remote-User", "anna")
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			var me struct {
+				User string `json:"user"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &me); err != nil {
+				t.Fatalf("GET /api/me: %d %s", w.Code, w.Body)
+			}
+			if me.User != tt.want {
+				t.Errorf("user = %q, want %q", me.User, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"DICOMScanStation/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Optimistic locking for shared workspaces. Clients send the version they
+// last saw in an If-Match header; if the workspace or inbox document has
+// changed since, the request is rejected with 409 and the current state, so
+// one operator's delete or send does not silently act on pages another
+// operator just added. Requests without If-Match are not checked.
+
+// workspaceVersion derives a version token from the scan workspace listing;
+// reordering the pages changes it as well
+func workspaceVersion(files []storage.FileInfo) string {
+	entries := make([]string, len(files))
+	for i, f := range files {
+		entries[i] = fmt.Sprintf("%s|%d|%s", f.Name, f.Size, f.ModifiedTime)
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(entries, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ifMatch returns the version the client expects, or "" if it sent none
+func ifMatch(c *gin.Context) string {
+	v := strings.TrimSpace(c.GetHeader("If-Match"))
+	v = strings.TrimPrefix(v, "W/")
+	return strings.Trim(v, `"`)
+}
+
+func setETag(c *gin.Context, version string) {
+	c.Header("ETag", `"`+version+`"`)
+}
+
+// checkWorkspaceVersion answers 409 with the current file list if the
+// workspace changed since the client's version. The caller must hold
+// r.workspaceMu.
+func (r *Router) checkWorkspaceVersion(c *gin.Context) bool {
+	expected := ifMatch(c)
+	if expected == "" {
+		return true
+	}
+
+	files, err := r.workspace(c).files.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file list"})
+		return false
+	}
+
+	version := workspaceVersion(files)
+	if version == expected {
+		return true
+	}
+
+	r.logger.Warnf("Workspace changed since version %s (now %s), request rejected", expected, version)
+	setETag(c, version)
+	c.JSON(http.StatusConflict, gin.H{
+		"error":   "The scanned files were changed by someone else. Review the current files and try again.",
+		"version": version,
+		"files":   files,
+		"total":   len(files),
+	})
+	return false
+}
+
+// currentWorkspaceVersion returns the version after a successful change
+func (r *Router) currentWorkspaceVersion(ws workspace) string {
+	files, err := ws.files.List()
+	if err != nil {
+		return ""
+	}
+	return workspaceVersion(files)
+}
+
+// checkPendingVersion answers 409 with the current document if it changed
+// since the client's version. The caller must hold r.workspaceMu.
+func (r *Router) checkPendingVersion(c *gin.Context, id string) bool {
+	expected := ifMatch(c)
+	if expected == "" {
+		return true
+	}
+
+	doc, err := r.pending.Get(id)
+	if err != nil {
+		r.pendingError(c, err)
+		return false
+	}
+
+	version := strconv.Itoa(doc.Version)
+	if version == expected {
+		return true
+	}
+
+	setETag(c, version)
+	c.JSON(http.StatusConflict, gin.H{
+		"error":    "The document was changed by someone else. Review it and try again.",
+		"version":  version,
+		"document": doc,
+	})
+	return false
+}
@@ -0,0 +1,51 @@
+package web
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"DICOMScanStation/dicom"
+	"DICOMScanStation/logging"
+	"DICOMScanStation/workflow"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (r *Router) getWorkflow(c *gin.Context) {
+	policy := r.workflow
+	if policy == nil {
+		policy = &workflow.Policy{Steps: []string{}, DocumentTypes: []string{}}
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// checkWorkflow rejects the send with 422 and the skipped steps unless the
+// site's policy is satisfied
+func (r *Router) checkWorkflow(c *gin.Context, filePaths []string, description string, confirmedBirthDate string, patient dicom.PatientInfo) bool {
+	if r.workflow == nil {
+		return true
+	}
+
+	evidence := workflow.Evidence{
+		Description:        description,
+		ConfirmedBirthDate: confirmedBirthDate,
+		PatientBirthDate:   patient.BirthDate,
+	}
+	for _, path := range filePaths {
+		if !r.previews.Previewed(path) {
+			evidence.UnpreviewedPages = append(evidence.UnpreviewedPages, filepath.Base(path))
+		}
+	}
+
+	violations := r.workflow.Check(evidence)
+	if len(violations) == 0 {
+		return true
+	}
+
+	r.logger.WithField(logging.FieldPatientID, patient.PatientID).Warnf("Send rejected, %d workflow step(s) missing", len(violations))
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":      "Required workflow steps were skipped",
+		"violations": violations,
+	})
+	return false
+}
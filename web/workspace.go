@@ -0,0 +1,108 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"DICOMScanStation/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// With WORKSPACE_SESSIONS every browser scans into a workspace of its own,
+// named by a cookie the index page sets. API clients name theirs in the
+// X-Workspace header; requests that name none use the shared workspace in
+// TEMP_FILES_DIR.
+const (
+	workspaceCookie = "dss_workspace"
+	workspaceHeader = "X-Workspace"
+	// workspaceCookieMaxAge keeps a browser on its workspace across restarts
+	workspaceCookieMaxAge = 30 * 24 * 60 * 60
+	workspaceKey          = "workspace"
+)
+
+// workspace is the working directory a request acts on
+type workspace struct {
+	// id is empty for the shared workspace
+	id          string
+	files       FileStore
+	scanSession ScanSessionStore
+	dir         string
+}
+
+// sharedWorkspace is TEMP_FILES_DIR, the workspace of all requests without
+// WORKSPACE_SESSIONS
+func (r *Router) sharedWorkspace() workspace {
+	return workspace{files: r.fileStore, scanSession: r.scanSession, dir: r.config.TempFilesDir}
+}
+
+// lookupWorkspace returns the workspace named id, the shared one for ""
+func (r *Router) lookupWorkspace(id string) (workspace, error) {
+	if r.workspaces == nil || id == "" {
+		return r.sharedWorkspace(), nil
+	}
+	store, err := r.workspaces.Workspace(id)
+	if err != nil {
+		return workspace{}, err
+	}
+	return workspace{id: id, files: store, scanSession: store, dir: store.Dir()}, nil
+}
+
+// workspaceID returns the ID of the workspace a request names, empty for
+// the shared one
+func (r *Router) workspaceID(c *gin.Context) string {
+	if r.workspaces == nil {
+		return ""
+	}
+	id := c.GetHeader(workspaceHeader)
+	if id == "" {
+		id, _ = c.Cookie(workspaceCookie)
+	}
+	return id
+}
+
+// resolveWorkspace finds the workspace a request names for the handlers
+func (r *Router) resolveWorkspace(c *gin.Context) {
+	id := r.workspaceID(c)
+	ws, err := r.lookupWorkspace(id)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidWorkspace) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace"})
+			return
+		}
+		r.logger.Errorf("Failed to open workspace %s: %v", id, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to open workspace"})
+		return
+	}
+	c.Set(workspaceKey, ws)
+	c.Next()
+}
+
+// workspace returns the workspace of the request
+func (r *Router) workspace(c *gin.Context) workspace {
+	if ws, ok := c.Get(workspaceKey); ok {
+		return ws.(workspace)
+	}
+	return r.sharedWorkspace()
+}
+
+// browserWorkspace returns the workspace of the browser loading the page
+// and gives a browser without one its own
+func (r *Router) browserWorkspace(c *gin.Context) workspace {
+	if r.workspaces == nil {
+		return r.sharedWorkspace()
+	}
+	id, _ := c.Cookie(workspaceCookie)
+	if !storage.ValidWorkspaceID(id) {
+		id = storage.NewWorkspaceID()
+	}
+	// Renewed on every visit, so a browser in use keeps its workspace
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(workspaceCookie, id, workspaceCookieMaxAge, "/", "", c.Request.TLS != nil, true)
+	ws, err := r.lookupWorkspace(id)
+	if err != nil {
+		r.logger.Errorf("Failed to open workspace %s: %v", id, err)
+		return r.sharedWorkspace()
+	}
+	return ws
+}
@@ -0,0 +1,194 @@
+// Package workflow enforces the site specific steps an operator has to
+// complete before a document may be sent to the PACS.
+package workflow
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"DICOMScanStation/config"
+)
+
+// Steps that can be required with WORKFLOW_REQUIRED_STEPS
+const (
+	// StepPreview requires every page to be opened in the full-size preview
+	StepPreview = "preview"
+	// StepDocumentType requires the description to be one of the configured
+	// document types
+	StepDocumentType = "document_type"
+	// StepConfirmBirthDate requires the operator to enter the birth date the
+	// patient stated, which must match the selected patient
+	StepConfirmBirthDate = "confirm_birth_date"
+)
+
+var knownSteps = []string{StepPreview, StepDocumentType, StepConfirmBirthDate}
+
+// Policy lists the required steps of a site
+type Policy struct {
+	Steps         []string `json:"requiredSteps"`
+	DocumentTypes []string `json:"documentTypes"`
+}
+
+// NewPolicy reads the policy from the configuration. Unknown steps are
+// reported as an error so that a typo does not silently disable a check.
+func NewPolicy(cfg *config.Config) (*Policy, error) {
+	p := &Policy{Steps: []string{}, DocumentTypes: []string{}}
+	for _, step := range cfg.WorkflowRequiredSteps {
+		step = strings.ToLower(strings.TrimSpace(step))
+		if step == "" {
+			continue
+		}
+		if !isKnownStep(step) {
+			return nil, fmt.Errorf("unknown workflow step '%s' (available: %s)", step, strings.Join(knownSteps, ", "))
+		}
+		p.Steps = append(p.Steps, step)
+	}
+	for _, t := range cfg.WorkflowDocumentTypes {
+		if t = strings.TrimSpace(t); t != "" {
+			p.DocumentTypes = append(p.DocumentTypes, t)
+		}
+	}
+	if p.Requires(StepDocumentType) && len(p.DocumentTypes) == 0 {
+		return nil, fmt.Errorf("workflow step '%s' requires WORKFLOW_DOCUMENT_TYPES", StepDocumentType)
+	}
+	return p, nil
+}
+
+func isKnownStep(step string) bool {
+	for _, s := range knownSteps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// Requires reports whether step is part of the policy
+func (p *Policy) Requires(step string) bool {
+	for _, s := range p.Steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// Evidence is what the operator did before asking to send
+type Evidence struct {
+	// Pages not opened in the preview
+	UnpreviewedPages   []string
+	Description        string
+	ConfirmedBirthDate string
+	PatientBirthDate   string
+}
+
+// Violation describes a required step that was skipped
+type Violation struct {
+	Step    string `json:"step"`
+	Message string `json:"message"`
+}
+
+// Check returns the required steps missing from the evidence
+func (p *Policy) Check(e Evidence) []Violation {
+	var violations []Violation
+
+	if p.Requires(StepPreview) && len(e.UnpreviewedPages) > 0 {
+		violations = append(violations, Violation{
+			Step:    StepPreview,
+			Message: fmt.Sprintf("%d page(s) have not been previewed: %s", len(e.UnpreviewedPages), strings.Join(e.UnpreviewedPages, ", ")),
+		})
+	}
+
+	if p.Requires(StepDocumentType) && !p.isDocumentType(e.Description) {
+		violations = append(violations, Violation{
+			Step:    StepDocumentType,
+			Message: fmt.Sprintf("'%s' is not a document type, select one of: %s", e.Description, strings.Join(p.DocumentTypes, ", ")),
+		})
+	}
+
+	if p.Requires(StepConfirmBirthDate) {
+		confirmed := normalizeDate(e.ConfirmedBirthDate)
+		switch {
+		case confirmed == "":
+			violations = append(violations, Violation{
+				Step:    StepConfirmBirthDate,
+				Message: "The patient's birth date has not been confirmed",
+			})
+		case confirmed != normalizeDate(e.PatientBirthDate):
+			violations = append(violations, Violation{
+				Step:    StepConfirmBirthDate,
+				Message: "The confirmed birth date does not match the selected patient",
+			})
+		}
+	}
+
+	return violations
+}
+
+func (p *Policy) isDocumentType(description string) bool {
+	description = strings.TrimSpace(description)
+	for _, t := range p.DocumentTypes {
+		if strings.EqualFold(t, description) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeDate accepts YYYYMMDD, YYYY-MM-DD and DD.MM.YYYY
+func normalizeDate(value string) string {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{"20060102", "2006-01-02", "02.01.2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("20060102")
+		}
+	}
+	return ""
+}
+
+// PreviewTracker remembers which page files were opened in the preview. A
+// page that changes after the preview (rescan, rotation) counts as not
+// previewed.
+type PreviewTracker struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func NewPreviewTracker() *PreviewTracker {
+	return &PreviewTracker{seen: make(map[string]time.Time)}
+}
+
+// MarkPreviewed records that the file at path was shown to the operator
+func (t *PreviewTracker) MarkPreviewed(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seen[path] = info.ModTime()
+}
+
+// Previewed reports whether path was previewed in its current version
+func (t *PreviewTracker) Previewed(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	seen, ok := t.seen[path]
+	return ok && seen.Equal(info.ModTime())
+}
+
+// Forget drops the records of files that were sent or deleted
+func (t *PreviewTracker) Forget(paths ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, path := range paths {
+		delete(t.seen, path)
+	}
+}